@@ -0,0 +1,723 @@
+package access
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+	"os"
+	"strings"
+
+	"github.com/rautNishan/diskquery/adt"
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+Columnar storage (the columnar table access method of citus, with zone maps and encodings as in parquet)
+
+The rows of a columnar table are in its relation file like those of any table, and they are written again
+column by column into the columnar file, stamped with the HeapStamp of the relation file they were read from
+as an index is. Scans read the columnar file instead of the relation file: only the columns the query uses,
+and only the chunk groups whose zone maps do not rule out the conditions of WHERE. Once the relation file
+changes the columnar file is out of date, the next columnar scan builds it again before reading it (see
+executor/nodeColumnarscan.go), or VACUUM does
+
+The rows are cut in chunk groups of COLUMNAR_CHUNK_GROUP_ROWS, with a chunk per column holding the values of
+that column for those rows. A chunk is a bitmap of the NULLs, when it has some and not only NULLs, then the
+other values in the encoding that takes the least room of:
+  - PLAIN, the values one after the other: integers as zigzag varints, other values in their text form
+    preceded by its length
+  - DICTIONARY, the distinct values PLAIN, then for every value its number among them, bit-packed
+  - RLE, runs of the same value, each the length of the run and the value PLAIN
+  - DELTA, integers only: the first value, the smallest difference between a value and the one before,
+    then every difference less the smallest one, bit-packed
+  - BITPACK, integers only: the smallest value, then every value less the smallest one, bit-packed
+Bit-packed numbers all take the bits the largest of them needs, lowest bit first. The zone map of a chunk is
+the smallest and the largest of its values, kept for the types with a btree ordering
+
+The file is the chunks one after the other, then the footer saying where each chunk is, its encoding, how
+many NULLs it has and its zone map, then the trailer: the HeapStamp, where the footer starts, a magic number
+and a version. The file is written to a temporary file renamed over the old one when complete
+*/
+
+const (
+	COLUMNAR_CHUNK_GROUP_ROWS = 10000
+
+	columnarMagic       = 0x434f4c52
+	columnarVersion     = 1
+	columnarTrailerSize = 8*3 + 4*2
+)
+
+// Encodings of a chunk
+const (
+	COLUMNAR_ENCODING_PLAIN byte = iota
+	COLUMNAR_ENCODING_DICTIONARY
+	COLUMNAR_ENCODING_RLE
+	COLUMNAR_ENCODING_DELTA
+	COLUMNAR_ENCODING_BITPACK
+)
+
+// ColumnarPath is where the columnar file of a table is, next to its relation file
+func ColumnarPath(heapPath string) string {
+	return strings.TrimSuffix(heapPath, ".txt") + "_columnar.txt"
+}
+
+// ColumnarChunk is what the footer says of a chunk, Min and Max are its zone map, nil when it has none
+type ColumnarChunk struct {
+	Offset    int64
+	Length    int64
+	Encoding  byte
+	NullCount int
+	Min       types.Datum
+	Max       types.Datum
+}
+
+type ColumnarChunkGroup struct {
+	Rows   int
+	Chunks []ColumnarChunk //One per column
+}
+
+// ColumnarFile is the footer of a columnar file, with the file open to read its chunks
+type ColumnarFile struct {
+	HeapStamp HeapStamp //The relation file the rows were read from
+	ColTypes  []types.Oid
+	Groups    []ColumnarChunkGroup
+	relname   string
+	file      *os.File
+}
+
+func isIntegerColumn(typ types.Oid) bool {
+	return typ == types.INT2OID || typ == types.INT4OID || typ == types.INT8OID
+}
+
+// hasZoneMap tells if the values of a type are ordered, so a chunk of them can have a zone map
+func hasZoneMap(typ types.Oid) bool {
+	entry := adt.LookupType(typ)
+	return entry != nil && entry.Compare != nil
+}
+
+// ColumnarWriter writes the rows of a table into a new columnar file
+type ColumnarWriter struct {
+	file     *tmpFile
+	stamp    HeapStamp
+	colTypes []types.Oid
+	columns  [][]types.Datum //Values of the chunk group being filled
+	rows     int
+	offset   int64 //Where the next chunk goes
+	groups   []ColumnarChunkGroup
+}
+
+// ColumnarBeginWrite starts the columnar file of the table whose relation file at heapPath has HeapStamp stamp
+func ColumnarBeginWrite(heapPath string, stamp HeapStamp, colTypes []types.Oid) (*ColumnarWriter, error) {
+	file, err := createTmpFile(ColumnarPath(heapPath))
+	if err != nil {
+		return nil, err
+	}
+	writer := &ColumnarWriter{file: file, stamp: stamp, colTypes: colTypes, columns: make([][]types.Datum, len(colTypes))}
+	for i := range writer.columns {
+		writer.columns[i] = make([]types.Datum, 0, COLUMNAR_CHUNK_GROUP_ROWS)
+	}
+	return writer, nil
+}
+
+// WriteRow adds a row, on an error the caller calls Abort
+func (writer *ColumnarWriter) WriteRow(row types.Tuple) error {
+	for i := range writer.columns {
+		writer.columns[i] = append(writer.columns[i], row[i])
+	}
+	writer.rows++
+	if writer.rows == COLUMNAR_CHUNK_GROUP_ROWS {
+		return writer.flushChunkGroup()
+	}
+	return nil
+}
+
+func (writer *ColumnarWriter) flushChunkGroup() error {
+	group := ColumnarChunkGroup{Rows: writer.rows, Chunks: make([]ColumnarChunk, len(writer.columns))}
+	for i, values := range writer.columns {
+		data, chunk, err := encodeChunk(writer.colTypes[i], values)
+		if err != nil {
+			return err
+		}
+		chunk.Offset, chunk.Length = writer.offset, int64(len(data))
+		writer.file.Write(data)
+		writer.offset += chunk.Length
+		group.Chunks[i] = chunk
+		writer.columns[i] = values[:0]
+	}
+	writer.groups = append(writer.groups, group)
+	writer.rows = 0
+	return nil
+}
+
+// EndWrite writes what is left of the rows, the footer and the trailer and puts the file in place
+func (writer *ColumnarWriter) EndWrite() error {
+	if writer.rows > 0 {
+		if err := writer.flushChunkGroup(); err != nil {
+			writer.Abort()
+			return err
+		}
+	}
+	footer := binary.AppendUvarint(nil, uint64(len(writer.colTypes)))
+	for _, typ := range writer.colTypes {
+		footer = binary.AppendUvarint(footer, uint64(typ))
+	}
+	footer = binary.AppendUvarint(footer, uint64(len(writer.groups)))
+	for _, group := range writer.groups {
+		footer = binary.AppendUvarint(footer, uint64(group.Rows))
+		for _, chunk := range group.Chunks {
+			footer = binary.AppendUvarint(footer, uint64(chunk.Offset))
+			footer = binary.AppendUvarint(footer, uint64(chunk.Length))
+			footer = append(footer, chunk.Encoding)
+			footer = binary.AppendUvarint(footer, uint64(chunk.NullCount))
+			if chunk.Min == nil {
+				footer = append(footer, 0)
+				continue
+			}
+			footer = append(footer, 1)
+			footer = appendPlainText(footer, adt.OutputDatum(chunk.Min, &adt.DefaultSettings))
+			footer = appendPlainText(footer, adt.OutputDatum(chunk.Max, &adt.DefaultSettings))
+		}
+	}
+
+	le := binary.LittleEndian
+	footer = le.AppendUint64(footer, uint64(writer.stamp.Size))
+	footer = le.AppendUint64(footer, uint64(writer.stamp.ModTime))
+	footer = le.AppendUint64(footer, uint64(writer.offset))
+	footer = le.AppendUint32(footer, columnarMagic)
+	footer = le.AppendUint32(footer, columnarVersion)
+	writer.file.Write(footer)
+	return writer.file.commit()
+}
+
+// Abort removes the columnar file being written, the one there was stays
+func (writer *ColumnarWriter) Abort() {
+	writer.file.abort()
+}
+
+/*
+encodeChunk encodes the values of a column in a chunk group, trying every encoding the type can have and
+keeping the smallest, PLAIN when there is a tie
+*/
+func encodeChunk(typ types.Oid, values []types.Datum) ([]byte, ColumnarChunk, error) {
+	var chunk ColumnarChunk
+	nonNull := make([]types.Datum, 0, len(values))
+	for _, value := range values {
+		if value == nil {
+			chunk.NullCount++
+		} else {
+			nonNull = append(nonNull, value)
+		}
+	}
+
+	var data []byte
+	if chunk.NullCount > 0 && len(nonNull) > 0 {
+		data = make([]byte, (len(values)+7)/8)
+		for i, value := range values {
+			if value == nil {
+				data[i/8] |= 1 << (i % 8)
+			}
+		}
+	}
+	if len(nonNull) == 0 {
+		return data, chunk, nil
+	}
+
+	if hasZoneMap(typ) {
+		chunk.Min, chunk.Max = nonNull[0], nonNull[0]
+		for _, value := range nonNull[1:] {
+			cmp, err := adt.CompareDatums(value, chunk.Min)
+			if err != nil {
+				return nil, chunk, err
+			}
+			if cmp < 0 {
+				chunk.Min = value
+			}
+			if cmp, err = adt.CompareDatums(value, chunk.Max); err != nil {
+				return nil, chunk, err
+			}
+			if cmp > 0 {
+				chunk.Max = value
+			}
+		}
+	}
+
+	//Every value PLAIN on its own, the dictionary and the runs are made of these
+	plain := make([][]byte, len(nonNull))
+	var ints []int64
+	if isIntegerColumn(typ) {
+		ints = make([]int64, len(nonNull))
+		for i, value := range nonNull {
+			ints[i] = value.(int64)
+			plain[i] = binary.AppendVarint(nil, ints[i])
+		}
+	} else {
+		for i, value := range nonNull {
+			plain[i] = appendPlainText(nil, adt.OutputDatum(value, &adt.DefaultSettings))
+		}
+	}
+
+	chunk.Encoding = COLUMNAR_ENCODING_PLAIN
+	best := encodePlain(plain)
+	try := func(encoding byte, encoded []byte) {
+		if len(encoded) < len(best) {
+			chunk.Encoding, best = encoding, encoded
+		}
+	}
+	try(COLUMNAR_ENCODING_DICTIONARY, encodeDictionary(plain))
+	try(COLUMNAR_ENCODING_RLE, encodeRLE(plain))
+	if ints != nil {
+		try(COLUMNAR_ENCODING_DELTA, encodeDelta(ints))
+		try(COLUMNAR_ENCODING_BITPACK, encodeBitpack(ints))
+	}
+	return append(data, best...), chunk, nil
+}
+
+func appendPlainText(dst []byte, text string) []byte {
+	dst = binary.AppendUvarint(dst, uint64(len(text)))
+	return append(dst, text...)
+}
+
+func encodePlain(plain [][]byte) []byte {
+	var data []byte
+	for _, value := range plain {
+		data = append(data, value...)
+	}
+	return data
+}
+
+func encodeDictionary(plain [][]byte) []byte {
+	numbers := make(map[string]uint64)
+	var dict []byte
+	indexes := make([]uint64, len(plain))
+	for i, value := range plain {
+		number, ok := numbers[string(value)]
+		if !ok {
+			number = uint64(len(numbers))
+			numbers[string(value)] = number
+			dict = append(dict, value...)
+		}
+		indexes[i] = number
+	}
+	data := binary.AppendUvarint(nil, uint64(len(numbers)))
+	data = append(data, dict...)
+	return appendBitPacked(data, indexes)
+}
+
+func encodeRLE(plain [][]byte) []byte {
+	var data []byte
+	for i := 0; i < len(plain); {
+		run := 1
+		for i+run < len(plain) && string(plain[i+run]) == string(plain[i]) {
+			run++
+		}
+		data = binary.AppendUvarint(data, uint64(run))
+		data = append(data, plain[i]...)
+		i += run
+	}
+	return data
+}
+
+// encodeDelta works in wrapping arithmetic, a difference that overflows comes back when added again
+func encodeDelta(ints []int64) []byte {
+	data := binary.AppendVarint(nil, ints[0])
+	if len(ints) == 1 {
+		return data
+	}
+	minDelta := ints[1] - ints[0]
+	for i := 2; i < len(ints); i++ {
+		minDelta = min(minDelta, ints[i]-ints[i-1])
+	}
+	deltas := make([]uint64, len(ints)-1)
+	for i := range deltas {
+		deltas[i] = uint64(ints[i+1]-ints[i]) - uint64(minDelta)
+	}
+	data = binary.AppendVarint(data, minDelta)
+	return appendBitPacked(data, deltas)
+}
+
+func encodeBitpack(ints []int64) []byte {
+	minValue := ints[0]
+	for _, value := range ints[1:] {
+		minValue = min(minValue, value)
+	}
+	offsets := make([]uint64, len(ints))
+	for i, value := range ints {
+		offsets[i] = uint64(value) - uint64(minValue)
+	}
+	data := binary.AppendVarint(nil, minValue)
+	return appendBitPacked(data, offsets)
+}
+
+// appendBitPacked appends the number of bits a value takes then the values packed in that many bits each
+func appendBitPacked(dst []byte, values []uint64) []byte {
+	var largest uint64
+	for _, value := range values {
+		largest |= value
+	}
+	width := bits.Len64(largest)
+	dst = append(dst, byte(width))
+	start := len(dst)
+	dst = append(dst, make([]byte, (len(values)*width+7)/8)...)
+	packed := dst[start:]
+	pos := 0
+	for _, value := range values {
+		for done := 0; done < width; {
+			shift := pos % 8
+			n := min(8-shift, width-done)
+			packed[pos/8] |= byte(value>>done&(1<<n-1)) << shift
+			done += n
+			pos += n
+		}
+	}
+	return dst
+}
+
+// ColumnarOpen reads the footer of the columnar file of a table, relname is the table's name for messages
+func ColumnarOpen(heapPath string, relname string) (*ColumnarFile, error) {
+	file, err := os.Open(ColumnarPath(heapPath))
+	if err != nil {
+		return nil, fmt.Errorf("could not open columnar file of relation \"%s\": %v", relname, err)
+	}
+	cf := &ColumnarFile{relname: relname, file: file}
+	if err := cf.readFooter(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return cf, nil
+}
+
+func (cf *ColumnarFile) Close() error {
+	return cf.file.Close()
+}
+
+func (cf *ColumnarFile) corrupted() error {
+	return fmt.Errorf("columnar file of relation \"%s\" is corrupted", cf.relname)
+}
+
+// readColumnarTrailer returns the HeapStamp in the trailer of a columnar file and where its footer starts
+func readColumnarTrailer(file *os.File) (HeapStamp, int64, int64, bool) {
+	info, err := file.Stat()
+	if err != nil || info.Size() < columnarTrailerSize {
+		return HeapStamp{}, 0, 0, false
+	}
+	trailerOffset := info.Size() - columnarTrailerSize
+	buf := make([]byte, columnarTrailerSize)
+	if _, err := file.ReadAt(buf, trailerOffset); err != nil {
+		return HeapStamp{}, 0, 0, false
+	}
+	le := binary.LittleEndian
+	if le.Uint32(buf[24:]) != columnarMagic || le.Uint32(buf[28:]) != columnarVersion {
+		return HeapStamp{}, 0, 0, false
+	}
+	stamp := HeapStamp{Size: int64(le.Uint64(buf[0:])), ModTime: int64(le.Uint64(buf[8:]))}
+	footerOffset := int64(le.Uint64(buf[16:]))
+	if footerOffset < 0 || footerOffset > trailerOffset {
+		return HeapStamp{}, 0, 0, false
+	}
+	return stamp, footerOffset, trailerOffset, true
+}
+
+func (cf *ColumnarFile) readFooter() error {
+	stamp, footerOffset, trailerOffset, ok := readColumnarTrailer(cf.file)
+	if !ok {
+		return cf.corrupted()
+	}
+	cf.HeapStamp = stamp
+	buf := make([]byte, trailerOffset-footerOffset)
+	if _, err := cf.file.ReadAt(buf, footerOffset); err != nil {
+		return fmt.Errorf("could not read columnar file of relation \"%s\": %v", cf.relname, err)
+	}
+
+	reader := &chunkReader{buf: buf}
+	cf.ColTypes = make([]types.Oid, reader.count())
+	for i := range cf.ColTypes {
+		cf.ColTypes[i] = types.Oid(reader.uvarint())
+	}
+	cf.Groups = make([]ColumnarChunkGroup, reader.count())
+	for i := range cf.Groups {
+		group := &cf.Groups[i]
+		group.Rows = int(reader.uvarint())
+		group.Chunks = make([]ColumnarChunk, len(cf.ColTypes))
+		for attno, typ := range cf.ColTypes {
+			chunk := &group.Chunks[attno]
+			chunk.Offset = int64(reader.uvarint())
+			chunk.Length = int64(reader.uvarint())
+			chunk.Encoding = reader.byte()
+			chunk.NullCount = int(reader.uvarint())
+			if chunk.Offset+chunk.Length > footerOffset || chunk.NullCount > group.Rows {
+				reader.fail = true
+			}
+			if reader.byte() == 0 || reader.fail {
+				continue
+			}
+			var err error
+			if chunk.Min, err = adt.InputDatum(typ, reader.text(), &adt.DefaultSettings); err == nil {
+				chunk.Max, err = adt.InputDatum(typ, reader.text(), &adt.DefaultSettings)
+			}
+			if err != nil {
+				return fmt.Errorf("columnar file of relation \"%s\": %v", cf.relname, err)
+			}
+		}
+	}
+	if reader.fail || reader.pos != len(buf) {
+		return cf.corrupted()
+	}
+	return nil
+}
+
+// ColumnarIsCurrent tells if the columnar file of a table was made from its relation file as it is now
+func ColumnarIsCurrent(heapPath string) bool {
+	file, err := os.Open(ColumnarPath(heapPath))
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	built, _, _, ok := readColumnarTrailer(file)
+	if !ok {
+		return false
+	}
+	current, err := StatHeap(heapPath)
+	return err == nil && built == current
+}
+
+/*
+ChunkGroupMayMatch tells if some rows of a chunk group could meet every scan key, going by the zone maps of
+its chunks. A chunk of only NULLs meets none, the comparison would be NULL
+*/
+func (cf *ColumnarFile) ChunkGroupMayMatch(group int, scanKeys []ScanKey) (bool, error) {
+	for _, key := range scanKeys {
+		chunk := &cf.Groups[group].Chunks[key.AttNo]
+		if chunk.NullCount == cf.Groups[group].Rows {
+			return false, nil
+		}
+		if chunk.Min == nil {
+			continue
+		}
+		cmpMin, err := adt.CompareDatums(key.Arg, chunk.Min)
+		if err != nil {
+			return false, err
+		}
+		cmpMax, err := adt.CompareDatums(key.Arg, chunk.Max)
+		if err != nil {
+			return false, err
+		}
+		var excluded bool
+		switch key.Strategy {
+		case types.BTLessStrategyNumber:
+			excluded = cmpMin <= 0
+		case types.BTLessEqualStrategyNumber:
+			excluded = cmpMin < 0
+		case types.BTEqualStrategyNumber:
+			excluded = cmpMin < 0 || cmpMax > 0
+		case types.BTGreaterEqualStrategyNumber:
+			excluded = cmpMax > 0
+		case types.BTGreaterStrategyNumber:
+			excluded = cmpMax >= 0
+		}
+		if excluded {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// ReadChunk returns the values of column attno in a chunk group, a value per row
+func (cf *ColumnarFile) ReadChunk(group int, attno int) ([]types.Datum, error) {
+	rows := cf.Groups[group].Rows
+	chunk := &cf.Groups[group].Chunks[attno]
+	typ := cf.ColTypes[attno]
+	values := make([]types.Datum, rows)
+	if chunk.NullCount == rows {
+		return values, nil
+	}
+	buf := make([]byte, chunk.Length)
+	if _, err := cf.file.ReadAt(buf, chunk.Offset); err != nil {
+		return nil, fmt.Errorf("could not read columnar file of relation \"%s\": %v", cf.relname, err)
+	}
+
+	var nulls []byte
+	if chunk.NullCount > 0 {
+		if len(buf) < (rows+7)/8 {
+			return nil, cf.corrupted()
+		}
+		nulls, buf = buf[:(rows+7)/8], buf[(rows+7)/8:]
+	}
+	reader := &chunkReader{buf: buf}
+	nonNull, err := reader.decode(chunk.Encoding, typ, rows-chunk.NullCount)
+	if err != nil {
+		return nil, fmt.Errorf("columnar file of relation \"%s\": %v", cf.relname, err)
+	}
+	if reader.fail || reader.pos != len(buf) {
+		return nil, cf.corrupted()
+	}
+	for i := range values {
+		if nulls != nil && nulls[i/8]&(1<<(i%8)) != 0 {
+			continue
+		}
+		if len(nonNull) == 0 {
+			return nil, cf.corrupted()
+		}
+		values[i], nonNull = nonNull[0], nonNull[1:]
+	}
+	return values, nil
+}
+
+// chunkReader reads what the writer appended, fail is set once something is not there
+type chunkReader struct {
+	buf  []byte
+	pos  int
+	fail bool
+}
+
+func (reader *chunkReader) uvarint() uint64 {
+	value, n := binary.Uvarint(reader.buf[reader.pos:])
+	if n <= 0 {
+		reader.fail = true
+		return 0
+	}
+	reader.pos += n
+	return value
+}
+
+func (reader *chunkReader) varint() int64 {
+	value, n := binary.Varint(reader.buf[reader.pos:])
+	if n <= 0 {
+		reader.fail = true
+		return 0
+	}
+	reader.pos += n
+	return value
+}
+
+// count reads a number of things that follow, each at least a byte, so a corrupted one cannot be huge
+func (reader *chunkReader) count() int {
+	n := reader.uvarint()
+	if n > uint64(len(reader.buf)-reader.pos) {
+		reader.fail = true
+		return 0
+	}
+	return int(n)
+}
+
+func (reader *chunkReader) byte() byte {
+	if reader.pos >= len(reader.buf) {
+		reader.fail = true
+		return 0
+	}
+	reader.pos++
+	return reader.buf[reader.pos-1]
+}
+
+func (reader *chunkReader) text() string {
+	n := reader.count()
+	reader.pos += n
+	return string(reader.buf[reader.pos-n : reader.pos])
+}
+
+// plainValue reads a PLAIN value of a column of type typ
+func (reader *chunkReader) plainValue(typ types.Oid) (types.Datum, error) {
+	if isIntegerColumn(typ) {
+		return reader.varint(), nil
+	}
+	text := reader.text()
+	if reader.fail {
+		return nil, nil
+	}
+	return adt.InputDatum(typ, text, &adt.DefaultSettings)
+}
+
+func (reader *chunkReader) bitPacked(n int) []uint64 {
+	width := int(reader.byte())
+	size := (n*width + 7) / 8
+	if width > 64 || size > len(reader.buf)-reader.pos {
+		reader.fail = true
+		return make([]uint64, n)
+	}
+	packed := reader.buf[reader.pos : reader.pos+size]
+	reader.pos += size
+	values := make([]uint64, n)
+	pos := 0
+	for i := range values {
+		for done := 0; done < width; {
+			shift := pos % 8
+			k := min(8-shift, width-done)
+			values[i] |= uint64(packed[pos/8]>>shift&(1<<k-1)) << done
+			done += k
+			pos += k
+		}
+	}
+	return values
+}
+
+// decode reads n values in an encoding, the caller checks fail
+func (reader *chunkReader) decode(encoding byte, typ types.Oid, n int) ([]types.Datum, error) {
+	values := make([]types.Datum, 0, n)
+	isInt := isIntegerColumn(typ)
+	switch {
+	case encoding == COLUMNAR_ENCODING_PLAIN:
+		for len(values) < n && !reader.fail {
+			value, err := reader.plainValue(typ)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+
+	case encoding == COLUMNAR_ENCODING_DICTIONARY:
+		//The input function runs once per distinct value
+		dict := make([]types.Datum, reader.count())
+		for i := range dict {
+			var err error
+			if dict[i], err = reader.plainValue(typ); err != nil {
+				return nil, err
+			}
+		}
+		for _, index := range reader.bitPacked(n) {
+			if index >= uint64(len(dict)) {
+				reader.fail = true
+				break
+			}
+			values = append(values, dict[index])
+		}
+
+	case encoding == COLUMNAR_ENCODING_RLE:
+		for len(values) < n && !reader.fail {
+			run := reader.uvarint()
+			value, err := reader.plainValue(typ)
+			if err != nil {
+				return nil, err
+			}
+			if run == 0 || run > uint64(n-len(values)) {
+				reader.fail = true
+				break
+			}
+			for ; run > 0; run-- {
+				values = append(values, value)
+			}
+		}
+
+	case encoding == COLUMNAR_ENCODING_DELTA && isInt:
+		value := reader.varint()
+		values = append(values, value)
+		if n > 1 {
+			minDelta := reader.varint()
+			for _, delta := range reader.bitPacked(n - 1) {
+				value += int64(delta + uint64(minDelta))
+				values = append(values, value)
+			}
+		}
+
+	case encoding == COLUMNAR_ENCODING_BITPACK && isInt:
+		minValue := reader.varint()
+		for _, offset := range reader.bitPacked(n) {
+			values = append(values, int64(uint64(minValue)+offset))
+		}
+
+	default:
+		reader.fail = true
+	}
+	if len(values) != n {
+		reader.fail = true
+	}
+	return values, nil
+}
@@ -0,0 +1,142 @@
+package access
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rautNishan/diskquery/types"
+)
+
+func TestColumnarWriteAndRead(t *testing.T) {
+	heapPath := filepath.Join(t.TempDir(), "col_t.txt")
+	if err := os.WriteFile(heapPath, []byte("rows\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	stamp, err := StatHeap(heapPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	colTypes := []types.Oid{types.INT8OID, types.INT8OID, types.TEXTOID, types.TEXTOID, types.TEXTOID, types.FLOAT8OID, types.INT8OID}
+	const nrows = 2*COLUMNAR_CHUNK_GROUP_ROWS + 5000
+	rng := rand.New(rand.NewSource(1))
+	colors := []string{"red", "green", "blue"}
+	rows := make([]types.Tuple, nrows)
+	for i := range rows {
+		var f types.Datum
+		if i%3 != 0 {
+			f = float64(i) / 4
+		}
+		rows[i] = types.Tuple{
+			int64(i),                       //Ascending: DELTA
+			int64(rng.Intn(4)),             //Few bits: BITPACK
+			colors[rng.Intn(len(colors))],  //Few distinct values in no order: DICTIONARY
+			fmt.Sprintf("run%02d", i/1000), //Long runs: RLE
+			fmt.Sprintf("%x", rng.Int63()), //All different: PLAIN
+			f,
+			nil,
+		}
+	}
+
+	writer, err := ColumnarBeginWrite(heapPath, stamp, colTypes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range rows {
+		if err := writer.WriteRow(row); err != nil {
+			writer.Abort()
+			t.Fatal(err)
+		}
+	}
+	if err := writer.EndWrite(); err != nil {
+		t.Fatal(err)
+	}
+	if !ColumnarIsCurrent(heapPath) {
+		t.Errorf("columnar file is not current for the relation file it was written from")
+	}
+
+	cf, err := ColumnarOpen(heapPath, "col_t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cf.Close()
+	if len(cf.Groups) != 3 || cf.Groups[2].Rows != 5000 || cf.HeapStamp != stamp {
+		t.Fatalf("got %d chunk groups, stamp %v", len(cf.Groups), cf.HeapStamp)
+	}
+	wantEncodings := []byte{COLUMNAR_ENCODING_DELTA, COLUMNAR_ENCODING_BITPACK, COLUMNAR_ENCODING_DICTIONARY, COLUMNAR_ENCODING_RLE, COLUMNAR_ENCODING_PLAIN}
+	for attno, want := range wantEncodings {
+		if got := cf.Groups[0].Chunks[attno].Encoding; got != want {
+			t.Errorf("column %d has encoding %d, want %d", attno, got, want)
+		}
+	}
+	if chunk := cf.Groups[1].Chunks[0]; chunk.Min != int64(10000) || chunk.Max != int64(19999) {
+		t.Errorf("zone map of column 0 in group 1 is %v to %v", chunk.Min, chunk.Max)
+	}
+	if chunk := cf.Groups[0].Chunks[5]; chunk.NullCount != 3334 || chunk.Min != 0.25 || chunk.Max != 2499.5 {
+		t.Errorf("chunk of column 5 in group 0 has %d NULLs and zone map %v to %v", chunk.NullCount, chunk.Min, chunk.Max)
+	}
+
+	for group := range cf.Groups {
+		start := group * COLUMNAR_CHUNK_GROUP_ROWS
+		for attno := range colTypes {
+			values, err := cf.ReadChunk(group, attno)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, value := range values {
+				if want := rows[start+i][attno]; value != want {
+					t.Fatalf("group %d column %d row %d: got %v, want %v", group, attno, i, value, want)
+				}
+			}
+		}
+	}
+
+	mayMatch := func(keys ...ScanKey) string {
+		var result []bool
+		for group := range cf.Groups {
+			ok, err := cf.ChunkGroupMayMatch(group, keys)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result = append(result, ok)
+		}
+		return fmt.Sprint(result)
+	}
+	for _, test := range []struct {
+		keys []ScanKey
+		want string
+	}{
+		{[]ScanKey{{AttNo: 0, Strategy: types.BTEqualStrategyNumber, Arg: int64(15000)}}, "[false true false]"},
+		{[]ScanKey{{AttNo: 0, Strategy: types.BTLessStrategyNumber, Arg: int64(10000)}}, "[true false false]"},
+		{[]ScanKey{{AttNo: 0, Strategy: types.BTGreaterEqualStrategyNumber, Arg: int64(19999)}}, "[false true true]"},
+		{[]ScanKey{{AttNo: 3, Strategy: types.BTEqualStrategyNumber, Arg: "run24"}}, "[false false true]"},
+		{[]ScanKey{{AttNo: 0, Strategy: types.BTGreaterStrategyNumber, Arg: int64(5000)}, {AttNo: 5, Strategy: types.BTLessEqualStrategyNumber, Arg: 2499.0}}, "[true false false]"},
+		//A chunk of only NULLs meets no comparison
+		{[]ScanKey{{AttNo: 6, Strategy: types.BTEqualStrategyNumber, Arg: int64(1)}}, "[false false false]"},
+	} {
+		if got := mayMatch(test.keys...); got != test.want {
+			t.Errorf("%v: got %s, want %s", test.keys, got, test.want)
+		}
+	}
+
+	//A changed relation file makes the columnar file out of date, a cut one does not read
+	if err := os.WriteFile(heapPath, []byte("other rows\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if ColumnarIsCurrent(heapPath) {
+		t.Errorf("columnar file is current after the relation file changed")
+	}
+	data, err := os.ReadFile(ColumnarPath(heapPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(ColumnarPath(heapPath), data[:len(data)/2], 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ColumnarOpen(heapPath, "col_t"); err == nil {
+		t.Errorf("no error opening a truncated columnar file")
+	}
+}
@@ -0,0 +1,309 @@
+package access
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+/*
+The free space map (postgres storage/freespace/freespace.c and fsmpage.c)
+
+Rows go into the free space of a relation file before the file grows. Free space here is a run of empty
+lines: a deleted row is blanked out with line breaks (HeapDelete) and files written from outside can have
+them too. A row of n bytes fits in a run of more than n line breaks that starts at the beginning of a line,
+it takes the first n bytes and the line break after them ends it.
+
+The map divides the relation file into pages of BLCKSZ bytes and keeps, for each page, the longest run within
+it as a category of FSM_CAT_STEP bytes, a byte per page. The categories are the leaves of a binary tree whose
+nodes hold the largest category below them, so finding a page with room is a walk down from the root
+(fsm_search_avail) and changing the category of a page a walk up (fsm_set_avail). As in postgres the map is
+only a hint: the insert reads the page it was given and looks for the run itself, a page that turns out not
+to have one gets its category fixed and the search goes on.
+
+Only relations rows are inserted into with HeapInsert have a map: the tables, by INSERT and UPDATE (see
+executor/nodeModifyTable.go) and the system catalogs. Index, toast and columnar files are written whole and
+have none.
+
+The map is kept in a file next to the relation file with the HeapStamp of the version of the relation file
+it was made from and the categories of the pages, the tree is built again when the file is read. A relation
+file changed from outside makes the map out of date, it is made again from the rows by the next insert or
+delete and by VACUUM (FreeSpaceMapVacuum)
+*/
+
+const (
+	BLCKSZ         = 8192
+	FSM_CATEGORIES = 256
+	FSM_CAT_STEP   = BLCKSZ / FSM_CATEGORIES
+
+	fsmMagic      = 0x46534d31
+	fsmVersion    = 1
+	fsmHeaderSize = 4*2 + 8*2 + 4
+)
+
+// FreeSpaceMap is the map of a relation file, tree[1] is the root and the category of page n is tree[leaves+n]
+type FreeSpaceMap struct {
+	HeapStamp HeapStamp
+	Npages    int
+	leaves    int
+	tree      []uint8
+}
+
+// FreeSpaceMapPath is where the free space map of a relation is, next to its relation file
+func FreeSpaceMapPath(heapPath string) string {
+	return strings.TrimSuffix(heapPath, ".txt") + "_fsm.txt"
+}
+
+// fsmSpaceAvailToCat is the category of a page with avail free bytes, the bytes of a category are all there
+func fsmSpaceAvailToCat(avail int) uint8 {
+	return uint8(min(avail/FSM_CAT_STEP, FSM_CATEGORIES-1))
+}
+
+// fsmSpaceNeededToCat is the lowest category sure to have needed free bytes
+func fsmSpaceNeededToCat(needed int) uint8 {
+	return uint8(min((needed+FSM_CAT_STEP-1)/FSM_CAT_STEP, FSM_CATEGORIES-1))
+}
+
+func newFreeSpaceMap(stamp HeapStamp, categories []uint8) *FreeSpaceMap {
+	fsm := &FreeSpaceMap{HeapStamp: stamp, leaves: 1}
+	for fsm.leaves < len(categories) {
+		fsm.leaves *= 2
+	}
+	fsm.tree = make([]uint8, 2*fsm.leaves)
+	copy(fsm.tree[fsm.leaves:], categories)
+	for node := fsm.leaves - 1; node > 0; node-- {
+		fsm.tree[node] = max(fsm.tree[2*node], fsm.tree[2*node+1])
+	}
+	fsm.Npages = len(categories)
+	return fsm
+}
+
+// extend makes the map cover npages pages, the new pages have no free space
+func (fsm *FreeSpaceMap) extend(npages int) {
+	if npages <= fsm.Npages {
+		return
+	}
+	if npages > fsm.leaves {
+		*fsm = *newFreeSpaceMap(fsm.HeapStamp, append(fsm.tree[fsm.leaves:fsm.leaves+fsm.Npages], make([]uint8, npages-fsm.Npages)...))
+		return
+	}
+	fsm.Npages = npages
+}
+
+// setAvail records that the longest run of free bytes in page blkno is avail bytes long
+func (fsm *FreeSpaceMap) setAvail(blkno int, avail int) {
+	fsm.extend(blkno + 1)
+	node := fsm.leaves + blkno
+	fsm.tree[node] = fsmSpaceAvailToCat(avail)
+	for node /= 2; node > 0; node /= 2 {
+		fsm.tree[node] = max(fsm.tree[2*node], fsm.tree[2*node+1])
+	}
+}
+
+// category is the category of page blkno
+func (fsm *FreeSpaceMap) category(blkno int) uint8 {
+	return fsm.tree[fsm.leaves+blkno]
+}
+
+// searchAvail returns the first page of category minCat or more, ok is false when there is none
+func (fsm *FreeSpaceMap) searchAvail(minCat uint8) (blkno int, ok bool) {
+	if fsm.Npages == 0 || fsm.tree[1] < minCat {
+		return 0, false
+	}
+	node := 1
+	for node < fsm.leaves {
+		node *= 2
+		if fsm.tree[node] < minCat {
+			node++
+		}
+	}
+	return node - fsm.leaves, true
+}
+
+/*
+GetPageWithFreeSpace returns a page that has a run of needed free bytes, ok is false when no page has. The top
+category holds every run longer than it, a row longer than that goes at the end of the file
+*/
+func (fsm *FreeSpaceMap) GetPageWithFreeSpace(needed int) (blkno int, ok bool) {
+	if needed > (FSM_CATEGORIES-1)*FSM_CAT_STEP {
+		return 0, false
+	}
+	return fsm.searchAvail(fsmSpaceNeededToCat(needed))
+}
+
+/*
+fsmPageScanner finds the runs of free bytes in the pages of a relation file read one after the other.
+atLineStart is whether the byte before the next one read ends a line, at the start of the file it does
+*/
+type fsmPageScanner struct {
+	atLineStart bool
+}
+
+// longestRun returns the length of the longest run of free bytes in page
+func (ps *fsmPageScanner) longestRun(page []byte) int {
+	longest, run := 0, 0
+	for _, b := range page {
+		if b == '\n' && ps.atLineStart {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+		ps.atLineStart = b == '\n'
+	}
+	return longest
+}
+
+// findRun returns where the first run of needed free bytes starts in page
+func (ps *fsmPageScanner) findRun(page []byte, needed int) (int, bool) {
+	run := 0
+	for i, b := range page {
+		if b == '\n' && ps.atLineStart {
+			run++
+			if run == needed {
+				return i + 1 - needed, true
+			}
+		} else {
+			run = 0
+		}
+		ps.atLineStart = b == '\n'
+	}
+	return 0, false
+}
+
+// readPage reads page blkno of a relation file, shorter at the end of the file, and the scanner to look at it with
+func readPage(file *os.File, blkno int) ([]byte, *fsmPageScanner, error) {
+	start := int64(blkno) * BLCKSZ
+	ps := &fsmPageScanner{atLineStart: true}
+	readFrom := start
+	if start > 0 {
+		readFrom--
+	}
+	buf := make([]byte, start-readFrom+BLCKSZ)
+	n, err := file.ReadAt(buf, readFrom)
+	if err != nil && err != io.EOF {
+		return nil, nil, err
+	}
+	buf = buf[:n]
+	if start > 0 && n > 0 {
+		ps.atLineStart = buf[0] == '\n'
+		buf = buf[1:]
+	}
+	return buf, ps, nil
+}
+
+// recordPages sets the categories of pages first to last from what is in the relation file now
+func (fsm *FreeSpaceMap) recordPages(file *os.File, first int, last int) error {
+	for blkno := first; blkno <= last; blkno++ {
+		page, ps, err := readPage(file, blkno)
+		if err != nil {
+			return err
+		}
+		if len(page) == 0 {
+			break
+		}
+		fsm.setAvail(blkno, ps.longestRun(page))
+	}
+	return nil
+}
+
+// buildFreeSpaceMap makes the map of an open relation file from its contents
+func buildFreeSpaceMap(file *os.File) (*FreeSpaceMap, error) {
+	stamp, err := StatHeapFile(file)
+	if err != nil {
+		return nil, err
+	}
+	reader := bufio.NewReaderSize(io.NewSectionReader(file, 0, stamp.Size), 64*1024)
+	ps := &fsmPageScanner{atLineStart: true}
+	categories := make([]uint8, 0, (stamp.Size+BLCKSZ-1)/BLCKSZ)
+	page := make([]byte, BLCKSZ)
+	for {
+		n, err := io.ReadFull(reader, page)
+		if n > 0 {
+			categories = append(categories, fsmSpaceAvailToCat(ps.longestRun(page[:n])))
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return newFreeSpaceMap(stamp, categories), nil
+}
+
+// readFreeSpaceMap reads the map of a relation, ok is false when it has none or it cannot be read
+func readFreeSpaceMap(heapPath string) (*FreeSpaceMap, bool) {
+	data, err := os.ReadFile(FreeSpaceMapPath(heapPath))
+	if err != nil || len(data) < fsmHeaderSize {
+		return nil, false
+	}
+	le := binary.LittleEndian
+	if le.Uint32(data) != fsmMagic || le.Uint32(data[4:]) != fsmVersion {
+		return nil, false
+	}
+	stamp := HeapStamp{Size: int64(le.Uint64(data[8:])), ModTime: int64(le.Uint64(data[16:]))}
+	npages := int(le.Uint32(data[24:]))
+	if len(data) != fsmHeaderSize+npages {
+		return nil, false
+	}
+	return newFreeSpaceMap(stamp, data[fsmHeaderSize:]), true
+}
+
+// writeFreeSpaceMap puts the map of a relation in its file
+func writeFreeSpaceMap(heapPath string, fsm *FreeSpaceMap) error {
+	return replaceFile(FreeSpaceMapPath(heapPath), func(writer *bufio.Writer) error {
+		le := binary.LittleEndian
+		header := le.AppendUint32(nil, fsmMagic)
+		header = le.AppendUint32(header, fsmVersion)
+		header = le.AppendUint64(header, uint64(fsm.HeapStamp.Size))
+		header = le.AppendUint64(header, uint64(fsm.HeapStamp.ModTime))
+		header = le.AppendUint32(header, uint32(fsm.Npages))
+		writer.Write(header)
+		_, err := writer.Write(fsm.tree[fsm.leaves : fsm.leaves+fsm.Npages])
+		return err
+	})
+}
+
+// openFreeSpaceMap returns the map of an open relation file, made again when the one in its file is out of date
+func openFreeSpaceMap(file *os.File, heapPath string) (*FreeSpaceMap, error) {
+	stamp, err := StatHeapFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if fsm, ok := readFreeSpaceMap(heapPath); ok && fsm.HeapStamp == stamp {
+		return fsm, nil
+	}
+	return buildFreeSpaceMap(file)
+}
+
+// FreeSpaceMapIsCurrent tells if the free space map of a relation was made from its relation file as it is now
+func FreeSpaceMapIsCurrent(heapPath string) bool {
+	fsm, ok := readFreeSpaceMap(heapPath)
+	if !ok {
+		return false
+	}
+	current, err := StatHeap(heapPath)
+	return err == nil && fsm.HeapStamp == current
+}
+
+/*
+FreeSpaceMapVacuum makes the free space map of a relation again from its relation file (postgres'
+FreeSpaceMapVacuum brings the upper levels of the map up to date after VACUUM recorded the pages, here the
+pages are read again as VACUUM does not look at the runs itself)
+*/
+func FreeSpaceMapVacuum(heapPath string, relname string) error {
+	file, err := os.Open(heapPath)
+	if err != nil {
+		return fmt.Errorf("could not open file for relation \"%s\": %v", relname, err)
+	}
+	defer file.Close()
+	fsm, err := buildFreeSpaceMap(file)
+	if err != nil {
+		return fmt.Errorf("could not read relation \"%s\": %v", relname, err)
+	}
+	return writeFreeSpaceMap(heapPath, fsm)
+}
@@ -0,0 +1,247 @@
+package access
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFreeSpaceMapSearch(t *testing.T) {
+	if fsmSpaceAvailToCat(31) != 0 || fsmSpaceAvailToCat(32) != 1 || fsmSpaceAvailToCat(BLCKSZ) != FSM_CATEGORIES-1 {
+		t.Errorf("wrong categories for available space")
+	}
+	if fsmSpaceNeededToCat(1) != 1 || fsmSpaceNeededToCat(32) != 1 || fsmSpaceNeededToCat(33) != 2 {
+		t.Errorf("wrong categories for needed space")
+	}
+
+	fsm := newFreeSpaceMap(HeapStamp{}, []uint8{0, 3, 1, 5, 0})
+	for _, tc := range []struct {
+		needed int
+		blkno  int
+		ok     bool
+	}{{1, 1, true}, {3 * FSM_CAT_STEP, 1, true}, {3*FSM_CAT_STEP + 1, 3, true}, {6 * FSM_CAT_STEP, 0, false}, {BLCKSZ, 0, false}} {
+		blkno, ok := fsm.GetPageWithFreeSpace(tc.needed)
+		if blkno != tc.blkno || ok != tc.ok {
+			t.Errorf("GetPageWithFreeSpace(%d) = %d %v, want %d %v", tc.needed, blkno, ok, tc.blkno, tc.ok)
+		}
+	}
+
+	//Setting a page walks up the tree, pages past the end make it grow
+	fsm.setAvail(1, 0)
+	fsm.setAvail(3, 0)
+	if _, ok := fsm.GetPageWithFreeSpace(FSM_CAT_STEP); !ok {
+		t.Errorf("page 2 not found after the pages before and after it were filled")
+	}
+	fsm.setAvail(2, 0)
+	if _, ok := fsm.GetPageWithFreeSpace(1); ok {
+		t.Errorf("a page found in a full map")
+	}
+	fsm.setAvail(20, BLCKSZ)
+	if blkno, ok := fsm.GetPageWithFreeSpace(1000); fsm.Npages != 21 || blkno != 20 || !ok {
+		t.Errorf("map of %d pages found %d %v after it grew", fsm.Npages, blkno, ok)
+	}
+}
+
+// heapLines returns the rows of a relation file as a scan sees them
+func heapLines(t *testing.T, path string) []string {
+	t.Helper()
+	scan, err := HeapBeginScan(path, "fsm_t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer scan.End()
+	var lines []string
+	for {
+		line, _, _, ok, err := scan.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			return lines
+		}
+		lines = append(lines, line)
+	}
+}
+
+// deleteLines removes the rows of a relation file for which del is true
+func deleteLines(t *testing.T, path string, del func(line string) bool) {
+	t.Helper()
+	scan, err := HeapBeginScan(path, "fsm_t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tids []ItemPointer
+	for {
+		line, offset, length, ok, err := scan.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			break
+		}
+		if del(line) {
+			tids = append(tids, ItemPointer{Offset: offset, Length: length})
+		}
+	}
+	scan.End()
+	if err := HeapDelete(path, "fsm_t", tids, true); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHeapInsertIntoFreeSpace(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fsm_t.txt")
+	if _, err := HeapInsert(path, "fsm_t", []string{"1,aaaa", "2,bbbbbbbb", "3,cc"}); err != nil {
+		t.Fatal(err)
+	}
+	if !FreeSpaceMapIsCurrent(path) {
+		t.Fatal("free space map out of date after insert")
+	}
+
+	//Deleting leaves line breaks in place of the row and its '\r', the other rows stay where they were
+	deleted := "2," + strings.Repeat("b", 38)
+	if err := os.WriteFile(path, []byte("1,aaaa\n"+deleted+"\r\n3,cc"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	deleteLines(t, path, func(line string) bool { return line == deleted })
+	data, _ := os.ReadFile(path)
+	if want := "1,aaaa\n" + strings.Repeat("\n", 42) + "3,cc"; string(data) != want {
+		t.Fatalf("relation file after delete is %q", data)
+	}
+
+	/*
+		Rows go into the run the delete left while the map has room for them there, a row needing the next
+		category and the ones after the run got shorter than a category go at the end
+	*/
+	long := "5," + strings.Repeat("e", 30)
+	inserted := []string{"4,dd", long, "6,f", "7,g", "8,h"}
+	tids, err := HeapInsert(path, "fsm_t", inserted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ = os.ReadFile(path)
+	if want := "1,aaaa\n4,dd\n6,f\n7,g\n" + strings.Repeat("\n", 29) + "3,cc\n" + long + "\n8,h\n"; string(data) != want {
+		t.Fatalf("relation file after insert is %q, want %q", data, want)
+	}
+	//The rows are where the insert says, the ones at the end after the line break the file was missing
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	for i, tid := range tids {
+		if line, err := HeapFetch(file, tid.Offset, tid.Length); err != nil || line != inserted[i] {
+			t.Errorf("row %d is %q at %v, want %q", i, line, tid, inserted[i])
+		}
+	}
+	if got := strings.Join(heapLines(t, path), " "); got != "1,aaaa 4,dd 6,f 7,g 3,cc "+long+" 8,h" {
+		t.Errorf("rows after insert are %s", got)
+	}
+
+	//A file changed from outside gets its map made again, from the runs it has now
+	if err := os.WriteFile(path, []byte("1\n"+strings.Repeat("\n", 40)+"2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if FreeSpaceMapIsCurrent(path) {
+		t.Fatal("free space map current after the relation file changed")
+	}
+	if _, err := HeapInsert(path, "fsm_t", []string{"3,x"}); err != nil {
+		t.Fatal(err)
+	}
+	data, _ = os.ReadFile(path)
+	if want := "1\n3,x\n" + strings.Repeat("\n", 36) + "2\n"; string(data) != want || !FreeSpaceMapIsCurrent(path) {
+		t.Errorf("relation file after insert into a changed file is %q", data)
+	}
+}
+
+func TestHeapBulkInsert(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fsm_t.txt")
+	var lines []string
+	for i := range 20000 {
+		lines = append(lines, fmt.Sprintf("%d,row %d", i, i))
+	}
+	for start := 0; start < len(lines); start += 1000 {
+		if _, err := HeapInsert(path, "fsm_t", lines[start:start+1000]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	before, err := StatHeap(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsm, ok := readFreeSpaceMap(path)
+	if !ok || fsm.Npages != int((before.Size+BLCKSZ-1)/BLCKSZ) {
+		t.Fatalf("free space map does not cover the %d bytes of the relation file", before.Size)
+	}
+	if _, ok := fsm.GetPageWithFreeSpace(1); ok {
+		t.Errorf("free space found in a file of rows only")
+	}
+
+	/*
+		Runs of rows deleted all over the file take most of the same rows back without growing it. A run shorter
+		than a category is not in the map, the last rows of each go at the end
+	*/
+	deleteLines(t, path, func(line string) bool {
+		var i int
+		fmt.Sscanf(line, "%d,", &i)
+		return i/10%10 == 3
+	})
+	var again []string
+	reinserted := 0
+	for i := range lines {
+		if i/10%10 == 3 {
+			again = append(again, fmt.Sprintf("%d,ROW %d", i, i))
+			reinserted += len(again[len(again)-1]) + 1
+		}
+	}
+	if _, err := HeapInsert(path, "fsm_t", again); err != nil {
+		t.Fatal(err)
+	}
+	after, err := StatHeap(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := heapLines(t, path)
+	if after.Size-before.Size > int64(reinserted/4) || len(rows) != len(lines) {
+		t.Errorf("relation file went from %d to %d bytes with %d rows after %d bytes of rows went back in", before.Size, after.Size, len(rows), reinserted)
+	}
+
+	//VACUUM makes the same map again from the file
+	fsm, _ = readFreeSpaceMap(path)
+	if err := FreeSpaceMapVacuum(path, "fsm_t"); err != nil {
+		t.Fatal(err)
+	}
+	rebuilt, ok := readFreeSpaceMap(path)
+	if !ok || fmt.Sprint(rebuilt.tree) != fmt.Sprint(fsm.tree) {
+		t.Errorf("free space map made again differs from the one kept by insert and delete")
+	}
+}
+
+func TestHeapDeleteWithoutReclaim(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fsm_t.txt")
+	tids, err := HeapInsert(path, "fsm_t", []string{"1," + strings.Repeat("a", 100), "2,b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	//The dead row keeps its space until VACUUM records it, rows inserted meanwhile go at the end
+	if err := HeapDelete(path, "fsm_t", tids[:1], false); err != nil {
+		t.Fatal(err)
+	}
+	if !FreeSpaceMapIsCurrent(path) {
+		t.Fatal("free space map out of date after delete")
+	}
+	if tids, err = HeapInsert(path, "fsm_t", []string{"3,c"}); err != nil {
+		t.Fatal(err)
+	}
+	if tids[0].Offset != 107 {
+		t.Errorf("row inserted after a dead row went to offset %d, want the end of the file", tids[0].Offset)
+	}
+	if err := FreeSpaceMapVacuum(path, "fsm_t"); err != nil {
+		t.Fatal(err)
+	}
+	if tids, err = HeapInsert(path, "fsm_t", []string{"4,d"}); err != nil || tids[0].Offset != 0 {
+		t.Errorf("row inserted after VACUUM went to %v (%v), want where the dead row was", tids, err)
+	}
+}
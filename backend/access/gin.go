@@ -0,0 +1,271 @@
+package access
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+
+	"github.com/rautNishan/diskquery/adt"
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+GIN indexes of jsonb (postgres access/gin with the jsonb_path_ops operator class)
+
+An inverted index: for each key of adt.JsonbPathOpsKeys the rows whose document has it, its posting list.
+A search for doc @> query intersects the posting lists of the query's keys, the rows left may contain the
+query and the executor checks the condition on each of them, keys are hashes and a document can have all
+the keys of a query without containing it. A query with no keys ('{}', '[]') is contained in any document
+of the same kind, the search returns every row in the index then, as GIN_SEARCH_MODE_ALL does. NULL
+documents are left out, @> never matches them.
+
+The file is a header, the items (where each row is in the relation file), the key directory sorted by key and
+the posting lists, item numbers in increasing order:
+	magic, version, HeapStamp, number of items, number of keys
+	offset, length          for each item
+	key, first, count       for each key, first is the position of its list among all the posting lists
+	item number             for each posting
+A search reads the header and the directory and then only the posting lists of the query's keys and the items
+they name. Like a hash index it is built once, in memory, and written to a temporary file renamed over the index
+*/
+
+const (
+	ginMagic        = 0x6740677
+	ginVersion      = 1
+	ginHeaderSize   = 4*2 + 8*2 + 4*2
+	ginItemSize     = 8 + 4
+	ginDirEntrySize = 4 * 3
+	ginPostingSize  = 4
+)
+
+type ginHeader struct {
+	HeapStamp HeapStamp
+	Nitems    uint32
+	Nkeys     uint32
+}
+
+type ginDirEntry struct {
+	Key   uint32
+	First uint32
+	Count uint32
+}
+
+// GinBuild writes a gin index file with the keys of the non NULL documents of tuples, which have one key each
+func GinBuild(path string, heapStamp HeapStamp, tuples []IndexTuple) error {
+	var items []IndexTuple
+	postings := make(map[uint32][]uint32)
+	for _, tuple := range tuples {
+		if tuple.Keys[0] == nil {
+			continue
+		}
+		item := uint32(len(items))
+		items = append(items, IndexTuple{Offset: tuple.Offset, Length: tuple.Length})
+		for _, key := range adt.JsonbPathOpsKeys(tuple.Keys[0].(*adt.Jsonb)) {
+			postings[key] = append(postings[key], item)
+		}
+	}
+	keys := make([]uint32, 0, len(postings))
+	for key := range postings {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	return replaceFile(path, func(writer *bufio.Writer) error {
+		le := binary.LittleEndian
+		header := make([]byte, ginHeaderSize)
+		le.PutUint32(header[0:], ginMagic)
+		le.PutUint32(header[4:], ginVersion)
+		le.PutUint64(header[8:], uint64(heapStamp.Size))
+		le.PutUint64(header[16:], uint64(heapStamp.ModTime))
+		le.PutUint32(header[24:], uint32(len(items)))
+		le.PutUint32(header[28:], uint32(len(keys)))
+		writer.Write(header)
+
+		buf := make([]byte, ginItemSize)
+		for _, item := range items {
+			le.PutUint64(buf[0:], uint64(item.Offset))
+			le.PutUint32(buf[8:], uint32(item.Length))
+			writer.Write(buf)
+		}
+		first := uint32(0)
+		for _, key := range keys {
+			le.PutUint32(buf[0:], key)
+			le.PutUint32(buf[4:], first)
+			le.PutUint32(buf[8:], uint32(len(postings[key])))
+			writer.Write(buf[:ginDirEntrySize])
+			first += uint32(len(postings[key]))
+		}
+		for _, key := range keys {
+			for _, item := range postings[key] {
+				le.PutUint32(buf[0:], item)
+				writer.Write(buf[:ginPostingSize])
+			}
+		}
+		return nil
+	})
+}
+
+func decodeGinHeader(buf []byte) (*ginHeader, bool) {
+	le := binary.LittleEndian
+	if len(buf) < ginHeaderSize || le.Uint32(buf[0:]) != ginMagic || le.Uint32(buf[4:]) != ginVersion {
+		return nil, false
+	}
+	return &ginHeader{
+		HeapStamp: HeapStamp{Size: int64(le.Uint64(buf[8:])), ModTime: int64(le.Uint64(buf[16:]))},
+		Nitems:    le.Uint32(buf[24:]),
+		Nkeys:     le.Uint32(buf[28:]),
+	}, true
+}
+
+// ginReadStamp reads the HeapStamp in the header of a gin index file
+func ginReadStamp(indexPath string) (HeapStamp, bool) {
+	file, err := os.Open(indexPath)
+	if err != nil {
+		return HeapStamp{}, false
+	}
+	defer file.Close()
+	buf := make([]byte, ginHeaderSize)
+	if _, err := file.ReadAt(buf, 0); err != nil {
+		return HeapStamp{}, false
+	}
+	header, ok := decodeGinHeader(buf)
+	if !ok {
+		return HeapStamp{}, false
+	}
+	return header.HeapStamp, true
+}
+
+/*
+GinSearch returns the entries of a gin index whose documents may contain every one of queries, in the order
+of the relation file, and the HeapStamp of the relation file they point into
+*/
+func GinSearch(path string, indexName string, queries []*adt.Jsonb) ([]IndexTuple, HeapStamp, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, HeapStamp{}, fmt.Errorf("could not open index \"%s\": %v", indexName, err)
+	}
+	defer file.Close()
+	readAt := func(buf []byte, off int64) error {
+		if _, err := file.ReadAt(buf, off); err != nil {
+			return fmt.Errorf("could not read index \"%s\" at offset %d: %v", indexName, off, err)
+		}
+		return nil
+	}
+	corrupted := func() error {
+		return fmt.Errorf("index \"%s\" is corrupted", indexName)
+	}
+
+	buf := make([]byte, ginHeaderSize)
+	if err := readAt(buf, 0); err != nil {
+		return nil, HeapStamp{}, err
+	}
+	header, ok := decodeGinHeader(buf)
+	if !ok {
+		return nil, HeapStamp{}, fmt.Errorf("index \"%s\" is not a gin index", indexName)
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, HeapStamp{}, fmt.Errorf("could not stat index \"%s\": %v", indexName, err)
+	}
+	itemsStart := int64(ginHeaderSize)
+	dirStart := itemsStart + int64(header.Nitems)*ginItemSize
+	postingsStart := dirStart + int64(header.Nkeys)*ginDirEntrySize
+	if postingsStart > stat.Size() {
+		return nil, HeapStamp{}, corrupted()
+	}
+	npostings := (stat.Size() - postingsStart) / ginPostingSize
+
+	var queryKeys []uint32
+	for _, query := range queries {
+		if keys, ok := adt.JsonbContainmentQueryKeys(query); ok {
+			queryKeys = append(queryKeys, keys...)
+		}
+	}
+	slices.Sort(queryKeys)
+	queryKeys = slices.Compact(queryKeys)
+
+	var matches []uint32
+	if len(queryKeys) == 0 {
+		matches = make([]uint32, header.Nitems)
+		for i := range matches {
+			matches[i] = uint32(i)
+		}
+	} else {
+		le := binary.LittleEndian
+		dirBuf := make([]byte, int64(header.Nkeys)*ginDirEntrySize)
+		if err := readAt(dirBuf, dirStart); err != nil {
+			return nil, HeapStamp{}, err
+		}
+		dirEntry := func(i int) ginDirEntry {
+			pos := i * ginDirEntrySize
+			return ginDirEntry{Key: le.Uint32(dirBuf[pos:]), First: le.Uint32(dirBuf[pos+4:]), Count: le.Uint32(dirBuf[pos+8:])}
+		}
+		for i, key := range queryKeys {
+			n := sort.Search(int(header.Nkeys), func(j int) bool { return dirEntry(j).Key >= key })
+			if n == int(header.Nkeys) || dirEntry(n).Key != key {
+				return nil, header.HeapStamp, nil
+			}
+			entry := dirEntry(n)
+			if int64(entry.First)+int64(entry.Count) > npostings {
+				return nil, HeapStamp{}, corrupted()
+			}
+			postingBuf := make([]byte, int64(entry.Count)*ginPostingSize)
+			if err := readAt(postingBuf, postingsStart+int64(entry.First)*ginPostingSize); err != nil {
+				return nil, HeapStamp{}, err
+			}
+			list := make([]uint32, entry.Count)
+			for j := range list {
+				list[j] = le.Uint32(postingBuf[j*ginPostingSize:])
+			}
+			if i == 0 {
+				matches = list
+			} else {
+				matches = intersectPostings(matches, list)
+			}
+			if len(matches) == 0 {
+				return nil, header.HeapStamp, nil
+			}
+		}
+	}
+
+	tuples := make([]IndexTuple, len(matches))
+	itemBuf := make([]byte, ginItemSize)
+	for i, item := range matches {
+		if item >= header.Nitems {
+			return nil, HeapStamp{}, corrupted()
+		}
+		if err := readAt(itemBuf, itemsStart+int64(item)*ginItemSize); err != nil {
+			return nil, HeapStamp{}, err
+		}
+		le := binary.LittleEndian
+		tuples[i] = IndexTuple{Offset: int64(le.Uint64(itemBuf[0:])), Length: int(le.Uint32(itemBuf[8:]))}
+	}
+	sort.Slice(tuples, func(i, j int) bool { return tuples[i].Offset < tuples[j].Offset })
+	return tuples, header.HeapStamp, nil
+}
+
+// intersectPostings returns the item numbers in both of two increasing lists
+func intersectPostings(a []uint32, b []uint32) []uint32 {
+	var result []uint32
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			result = append(result, a[i])
+			i++
+			j++
+		}
+	}
+	return result
+}
+
+// ginHasOpclass tells if a gin index can be made on values of typ, jsonb_path_ops is the only operator class
+func ginHasOpclass(typ types.Oid) bool {
+	return typ == types.JSONBOID
+}
@@ -0,0 +1,498 @@
+package access
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"math/bits"
+	"os"
+	"sort"
+
+	"github.com/rautNishan/diskquery/adt"
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+Hash indexes (postgres access/hash)
+
+The index file is made of pages of HashPageSize bytes that a search reads one at a time, unlike a btree index
+it is never read whole. Page 0 is the metapage, the others are bucket pages and overflow pages. An entry is the
+32 bit hash code of a key and where the row is in the relation file, the key itself is not kept: a search
+returns every entry with the hash code of the value and the rows must be checked again, as different values
+can have the same code. NULL keys are left out, = never matches them.
+Only a single column and only = can be searched, the hash codes have no order.
+
+The buckets grow by linear hashing. The entries of a bucket are in its bucket page and the chain of overflow
+pages after it, and whenever there are more than HashFillFactor entries per bucket one more bucket is made by
+splitting the one that had the same low bits (see hashToBucket). Bucket pages are allocated a splitpoint at a
+time: buckets 2^(n-1) to 2^n - 1 are allocated together when the first of them is needed, so the page of a
+bucket follows from the number of overflow pages allocated before its splitpoint (hashm_spares) without a
+directory. Overflow pages a split empties are kept in a free list and used again before the file grows.
+
+HashBuild makes the index in memory, with the same splits as if the entries had come one by one, and writes
+it to a temporary file renamed over the index when complete. HashInsert adds the entries of the rows INSERT
+and UPDATE write to the index file as it is, splitting buckets the way the build does, and reads and writes
+only the pages it changes. Postgres WAL-logs every page it changes so a crash cannot leave a half split
+bucket behind. There is no WAL here, hash indexes are not WAL-logged: HashInsert clears the HeapStamp of the
+metapage before it changes any other page and writes the new one last, an index left half changed by a crash
+is of no relation file and is built again by the next statement changing the table or by VACUUM, as any index
+that is out of date
+*/
+
+const (
+	HashPageSize   = 4096
+	HashFillFactor = 192 //Entries per bucket before a split, three quarters of a page
+
+	hashMagic          = 0x6440640 //HASH_MAGIC
+	hashVersion        = 1
+	hashMetaSize       = 4*2 + 8*3 + 4*6 + 4*hashMaxSplitpoints
+	hashMaxSplitpoints = 32
+	hashPageHeaderSize = 16
+	hashEntrySize      = 16
+	hashEntriesPerPage = (HashPageSize - hashPageHeaderSize) / hashEntrySize
+
+	//The metapage is never in a chain of pages, as a link it means there is no next page
+	hashInvalidBlock uint32 = 0
+)
+
+// Page flags
+const (
+	LH_UNUSED_PAGE   uint16 = 0
+	LH_OVERFLOW_PAGE uint16 = 1 << 0
+	LH_BUCKET_PAGE   uint16 = 1 << 1
+)
+
+/*
+hashMeta is the metapage (HashMetaPageData). Spares[n] is the number of overflow pages allocated before the
+bucket pages of splitpoint n+1, Ovflpoint the last splitpoint with allocated bucket pages
+*/
+type hashMeta struct {
+	HeapStamp HeapStamp
+	Ntuples   uint64
+	Maxbucket uint32
+	Highmask  uint32
+	Lowmask   uint32
+	Ovflpoint uint32
+	Firstfree uint32 //First page of the list of free overflow pages
+	Npages    uint32
+	Spares    [hashMaxSplitpoints]uint32
+}
+
+type hashEntry struct {
+	Hash   uint32
+	Length uint32
+	Offset int64
+}
+
+// hashPage is a bucket or overflow page, Bucket is the bucket whose chain it is in
+type hashPage struct {
+	Flags   uint16
+	Bucket  uint32
+	Next    uint32
+	Entries []hashEntry
+}
+
+// HashKey is the hash code of a non NULL key, equal values have the same one whatever their type
+func HashKey(value types.Datum) (uint32, error) {
+	image, err := adt.HashDatum(nil, value)
+	if err != nil {
+		return 0, err
+	}
+	h := fnv.New32a()
+	h.Write(image)
+	return h.Sum32(), nil
+}
+
+// hashToBucket is the bucket of a hash code (_hash_hashkey2bucket)
+func hashToBucket(hash uint32, meta *hashMeta) uint32 {
+	bucket := hash & meta.Highmask
+	if bucket > meta.Maxbucket {
+		bucket &= meta.Lowmask
+	}
+	return bucket
+}
+
+// bucketToBlock is the page number of the bucket page of a bucket (BUCKET_TO_BLKNO)
+func bucketToBlock(bucket uint32, meta *hashMeta) uint32 {
+	blkno := bucket + 1
+	if bucket > 0 {
+		blkno += meta.Spares[bits.Len32(bucket)-1]
+	}
+	return blkno
+}
+
+/*
+hashIndexState is an index being built or changed. Pages are the pages read or made so far by page number, the
+metapage is not among them. A build has no file, all of its pages are made in memory
+*/
+type hashIndexState struct {
+	meta      hashMeta
+	pages     map[uint32]*hashPage
+	file      *os.File
+	indexName string
+}
+
+// getPage returns a page, read from the file the first time
+func (hs *hashIndexState) getPage(blkno uint32) (*hashPage, error) {
+	if page := hs.pages[blkno]; page != nil {
+		return page, nil
+	}
+	if hs.file == nil || blkno == 0 || blkno >= hs.meta.Npages {
+		return nil, fmt.Errorf("index \"%s\" contains corrupted page at block %d", hs.indexName, blkno)
+	}
+	buf := make([]byte, HashPageSize)
+	if _, err := hs.file.ReadAt(buf, int64(blkno)*HashPageSize); err != nil {
+		return nil, fmt.Errorf("could not read block %d in index \"%s\": %v", blkno, hs.indexName, err)
+	}
+	page, ok := decodeHashPage(buf)
+	if !ok {
+		return nil, fmt.Errorf("index \"%s\" contains corrupted page at block %d", hs.indexName, blkno)
+	}
+	hs.pages[blkno] = page
+	return page, nil
+}
+
+// newPage adds a page at the end of the index
+func (hs *hashIndexState) newPage(page *hashPage) uint32 {
+	blkno := hs.meta.Npages
+	hs.meta.Npages++
+	hs.pages[blkno] = page
+	return blkno
+}
+
+// HashBuild writes a hash index file with the entries of the non NULL keys of tuples, which have one key each
+func HashBuild(path string, heapStamp HeapStamp, tuples []IndexTuple) error {
+	//Two buckets to start with, splitpoints 0 and 1
+	hs := &hashIndexState{
+		meta:  hashMeta{HeapStamp: heapStamp, Maxbucket: 1, Highmask: 3, Lowmask: 1, Ovflpoint: 1, Npages: 1},
+		pages: make(map[uint32]*hashPage),
+	}
+	hs.newPage(&hashPage{Flags: LH_BUCKET_PAGE, Bucket: 0})
+	hs.newPage(&hashPage{Flags: LH_BUCKET_PAGE, Bucket: 1})
+	if err := hs.insertTuples(tuples); err != nil {
+		return err
+	}
+
+	return replaceFile(path, func(writer *bufio.Writer) error {
+		buf := make([]byte, HashPageSize)
+		writer.Write(encodeHashMeta(buf, &hs.meta))
+		for blkno := uint32(1); blkno < hs.meta.Npages; blkno++ {
+			writer.Write(encodeHashPage(buf, hs.pages[blkno]))
+		}
+		return nil
+	})
+}
+
+/*
+HashInsert adds the entries of the non NULL keys of tuples to the hash index file at path, for the relation
+file heapStamp is of (postgres' hashinsert). The entries already there must be of rows that have not moved
+*/
+func HashInsert(path string, indexName string, heapStamp HeapStamp, tuples []IndexTuple) error {
+	file, err := os.OpenFile(path, os.O_RDWR, 0644)
+	if err != nil {
+		return fmt.Errorf("could not open index \"%s\": %v", indexName, err)
+	}
+	defer file.Close()
+	buf := make([]byte, HashPageSize)
+	if _, err := file.ReadAt(buf, 0); err != nil {
+		return fmt.Errorf("could not read block 0 in index \"%s\": %v", indexName, err)
+	}
+	meta, ok := decodeHashMeta(buf)
+	if !ok {
+		return fmt.Errorf("index \"%s\" is not a hash index", indexName)
+	}
+	hs := &hashIndexState{meta: *meta, pages: make(map[uint32]*hashPage), file: file, indexName: indexName}
+
+	writeErr := func(err error) error {
+		return fmt.Errorf("could not write to index \"%s\": %v", indexName, err)
+	}
+	//Of no relation file until every page is written
+	meta.HeapStamp = HeapStamp{}
+	if _, err := file.WriteAt(encodeHashMeta(buf, meta), 0); err != nil {
+		return writeErr(err)
+	}
+	if err := file.Sync(); err != nil {
+		return writeErr(err)
+	}
+
+	if err := hs.insertTuples(tuples); err != nil {
+		return err
+	}
+	//The pages read are written back whether they changed or not, it is the ones of the buckets the entries went in
+	for blkno, page := range hs.pages {
+		if _, err := file.WriteAt(encodeHashPage(buf, page), int64(blkno)*HashPageSize); err != nil {
+			return writeErr(err)
+		}
+	}
+	if err := file.Sync(); err != nil {
+		return writeErr(err)
+	}
+	hs.meta.HeapStamp = heapStamp
+	if _, err := file.WriteAt(encodeHashMeta(buf, &hs.meta), 0); err != nil {
+		return writeErr(err)
+	}
+	if err := file.Sync(); err != nil {
+		return writeErr(err)
+	}
+	return nil
+}
+
+// insertTuples adds the entries of the non NULL keys of tuples, splitting a bucket whenever there are too many entries per bucket
+func (hs *hashIndexState) insertTuples(tuples []IndexTuple) error {
+	for _, tuple := range tuples {
+		if tuple.Keys[0] == nil {
+			continue
+		}
+		hash, err := HashKey(tuple.Keys[0])
+		if err != nil {
+			return err
+		}
+		if err := hs.insert(hashEntry{Hash: hash, Length: uint32(tuple.Length), Offset: tuple.Offset}); err != nil {
+			return err
+		}
+		hs.meta.Ntuples++
+		if hs.meta.Ntuples > uint64(HashFillFactor)*uint64(hs.meta.Maxbucket+1) {
+			if err := hs.expandTable(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// insert adds an entry to the first page of its bucket's chain with room, adding an overflow page if none has
+func (hs *hashIndexState) insert(entry hashEntry) error {
+	page, err := hs.getPage(bucketToBlock(hashToBucket(entry.Hash, &hs.meta), &hs.meta))
+	if err != nil {
+		return err
+	}
+	//A chain cannot have more pages than the file, more means the links go round in a circle
+	for pages := uint32(0); len(page.Entries) == hashEntriesPerPage; pages++ {
+		if pages >= hs.meta.Npages {
+			return fmt.Errorf("index \"%s\" contains corrupted page at block %d", hs.indexName, page.Next)
+		}
+		if page.Next == hashInvalidBlock {
+			if page.Next, err = hs.addOverflowPage(page.Bucket); err != nil {
+				return err
+			}
+		}
+		if page, err = hs.getPage(page.Next); err != nil {
+			return err
+		}
+	}
+	page.Entries = append(page.Entries, entry)
+	return nil
+}
+
+// addOverflowPage returns the page number of a new overflow page of bucket, a free one if there is one (_hash_addovflpage)
+func (hs *hashIndexState) addOverflowPage(bucket uint32) (uint32, error) {
+	meta := &hs.meta
+	blkno := meta.Firstfree
+	if blkno != hashInvalidBlock {
+		page, err := hs.getPage(blkno)
+		if err != nil {
+			return 0, err
+		}
+		meta.Firstfree = page.Next
+		*page = hashPage{Flags: LH_OVERFLOW_PAGE, Bucket: bucket}
+		return blkno, nil
+	}
+	meta.Spares[meta.Ovflpoint]++
+	return hs.newPage(&hashPage{Flags: LH_OVERFLOW_PAGE, Bucket: bucket}), nil
+}
+
+/*
+expandTable adds bucket Maxbucket+1 and moves to it the entries of the bucket it splits from, those whose
+hash code has the next bit set (_hash_expandtable)
+*/
+func (hs *hashIndexState) expandTable() error {
+	meta := &hs.meta
+	newBucket := meta.Maxbucket + 1
+	oldBucket := newBucket & meta.Lowmask
+	if newBucket&(newBucket-1) == 0 {
+		//The first bucket of a splitpoint, the bucket pages of all of it go after the pages there are
+		splitpoint := uint32(bits.Len32(newBucket))
+		meta.Spares[splitpoint] = meta.Spares[meta.Ovflpoint]
+		meta.Ovflpoint = splitpoint
+		for bucket := newBucket; bucket < 2*newBucket; bucket++ {
+			hs.newPage(&hashPage{Flags: LH_BUCKET_PAGE, Bucket: bucket})
+		}
+	}
+	meta.Maxbucket = newBucket
+	if newBucket > meta.Highmask {
+		meta.Lowmask = meta.Highmask
+		meta.Highmask = newBucket | meta.Lowmask
+	}
+
+	//Empty the old bucket's chain, its overflow pages go to the free list, and insert its entries again
+	page, err := hs.getPage(bucketToBlock(oldBucket, meta))
+	if err != nil {
+		return err
+	}
+	entries := page.Entries
+	next := page.Next
+	page.Entries, page.Next = nil, hashInvalidBlock
+	for pages := uint32(0); next != hashInvalidBlock; pages++ {
+		ovfl, err := hs.getPage(next)
+		if err != nil {
+			return err
+		}
+		if pages >= meta.Npages {
+			return fmt.Errorf("index \"%s\" contains corrupted page at block %d", hs.indexName, next)
+		}
+		entries = append(entries, ovfl.Entries...)
+		blkno := next
+		next = ovfl.Next
+		*ovfl = hashPage{Flags: LH_UNUSED_PAGE, Next: meta.Firstfree}
+		meta.Firstfree = blkno
+	}
+	for _, entry := range entries {
+		if err := hs.insert(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func encodeHashMeta(buf []byte, meta *hashMeta) []byte {
+	clear(buf)
+	le := binary.LittleEndian
+	le.PutUint32(buf[0:], hashMagic)
+	le.PutUint32(buf[4:], hashVersion)
+	le.PutUint64(buf[8:], uint64(meta.HeapStamp.Size))
+	le.PutUint64(buf[16:], uint64(meta.HeapStamp.ModTime))
+	le.PutUint64(buf[24:], meta.Ntuples)
+	for i, value := range []uint32{meta.Maxbucket, meta.Highmask, meta.Lowmask, meta.Ovflpoint, meta.Firstfree, meta.Npages} {
+		le.PutUint32(buf[32+4*i:], value)
+	}
+	for i, spare := range meta.Spares {
+		le.PutUint32(buf[56+4*i:], spare)
+	}
+	return buf
+}
+
+func decodeHashMeta(buf []byte) (*hashMeta, bool) {
+	le := binary.LittleEndian
+	if len(buf) < hashMetaSize || le.Uint32(buf[0:]) != hashMagic || le.Uint32(buf[4:]) != hashVersion {
+		return nil, false
+	}
+	meta := &hashMeta{
+		HeapStamp: HeapStamp{Size: int64(le.Uint64(buf[8:])), ModTime: int64(le.Uint64(buf[16:]))},
+		Ntuples:   le.Uint64(buf[24:]),
+	}
+	for i, field := range []*uint32{&meta.Maxbucket, &meta.Highmask, &meta.Lowmask, &meta.Ovflpoint, &meta.Firstfree, &meta.Npages} {
+		*field = le.Uint32(buf[32+4*i:])
+	}
+	for i := range meta.Spares {
+		meta.Spares[i] = le.Uint32(buf[56+4*i:])
+	}
+	return meta, true
+}
+
+/*
+A page is a header of flags, number of entries, bucket, next page and 4 unused bytes, then the entries:
+hash code, length and offset
+*/
+func encodeHashPage(buf []byte, page *hashPage) []byte {
+	clear(buf)
+	le := binary.LittleEndian
+	le.PutUint16(buf[0:], page.Flags)
+	le.PutUint16(buf[2:], uint16(len(page.Entries)))
+	le.PutUint32(buf[4:], page.Bucket)
+	le.PutUint32(buf[8:], page.Next)
+	for i, entry := range page.Entries {
+		pos := hashPageHeaderSize + i*hashEntrySize
+		le.PutUint32(buf[pos:], entry.Hash)
+		le.PutUint32(buf[pos+4:], entry.Length)
+		le.PutUint64(buf[pos+8:], uint64(entry.Offset))
+	}
+	return buf
+}
+
+func decodeHashPage(buf []byte) (*hashPage, bool) {
+	le := binary.LittleEndian
+	page := &hashPage{Flags: le.Uint16(buf[0:]), Bucket: le.Uint32(buf[4:]), Next: le.Uint32(buf[8:])}
+	nentries := int(le.Uint16(buf[2:]))
+	if nentries > hashEntriesPerPage {
+		return nil, false
+	}
+	page.Entries = make([]hashEntry, nentries)
+	for i := range page.Entries {
+		pos := hashPageHeaderSize + i*hashEntrySize
+		page.Entries[i] = hashEntry{Hash: le.Uint32(buf[pos:]), Length: le.Uint32(buf[pos+4:]), Offset: int64(le.Uint64(buf[pos+8:]))}
+	}
+	return page, true
+}
+
+// hashReadStamp reads the HeapStamp in the metapage of a hash index file
+func hashReadStamp(indexPath string) (HeapStamp, bool) {
+	file, err := os.Open(indexPath)
+	if err != nil {
+		return HeapStamp{}, false
+	}
+	defer file.Close()
+	buf := make([]byte, hashMetaSize)
+	if _, err := file.ReadAt(buf, 0); err != nil {
+		return HeapStamp{}, false
+	}
+	meta, ok := decodeHashMeta(buf)
+	if !ok {
+		return HeapStamp{}, false
+	}
+	return meta.HeapStamp, true
+}
+
+/*
+HashSearch returns the entries of a hash index whose hash code is the one of value, in the order of the
+relation file, and the HeapStamp of the relation file they point into. Only the metapage and the pages of
+value's bucket are read
+*/
+func HashSearch(path string, indexName string, value types.Datum) ([]IndexTuple, HeapStamp, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, HeapStamp{}, fmt.Errorf("could not open index \"%s\": %v", indexName, err)
+	}
+	defer file.Close()
+	corrupted := func(blkno uint32) error {
+		return fmt.Errorf("index \"%s\" contains corrupted page at block %d", indexName, blkno)
+	}
+
+	buf := make([]byte, HashPageSize)
+	if _, err := file.ReadAt(buf, 0); err != nil {
+		return nil, HeapStamp{}, fmt.Errorf("could not read block 0 in index \"%s\": %v", indexName, err)
+	}
+	meta, ok := decodeHashMeta(buf)
+	if !ok {
+		return nil, HeapStamp{}, fmt.Errorf("index \"%s\" is not a hash index", indexName)
+	}
+
+	hash, err := HashKey(value)
+	if err != nil {
+		return nil, HeapStamp{}, err
+	}
+	bucket := hashToBucket(hash, meta)
+	var tuples []IndexTuple
+	//A chain cannot have more pages than the file, more means the links go round in a circle
+	blkno := bucketToBlock(bucket, meta)
+	for pages := uint32(0); blkno != hashInvalidBlock; pages++ {
+		if blkno >= meta.Npages || pages >= meta.Npages {
+			return nil, HeapStamp{}, corrupted(blkno)
+		}
+		if _, err := file.ReadAt(buf, int64(blkno)*HashPageSize); err != nil {
+			return nil, HeapStamp{}, fmt.Errorf("could not read block %d in index \"%s\": %v", blkno, indexName, err)
+		}
+		page, ok := decodeHashPage(buf)
+		if !ok || page.Flags&(LH_BUCKET_PAGE|LH_OVERFLOW_PAGE) == 0 || page.Bucket != bucket {
+			return nil, HeapStamp{}, corrupted(blkno)
+		}
+		for _, entry := range page.Entries {
+			if entry.Hash == hash {
+				tuples = append(tuples, IndexTuple{Offset: entry.Offset, Length: int(entry.Length)})
+			}
+		}
+		blkno = page.Next
+	}
+	sort.Slice(tuples, func(i, j int) bool { return tuples[i].Offset < tuples[j].Offset })
+	return tuples, meta.HeapStamp, nil
+}
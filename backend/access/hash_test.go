@@ -0,0 +1,141 @@
+package access
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rautNishan/diskquery/types"
+)
+
+func TestHashBuildAndSearch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hash_idx")
+	const nkeys = 5000
+	const ndups = 600
+	var tuples []IndexTuple
+	for i := 0; i < nkeys; i++ {
+		tuples = append(tuples, IndexTuple{Keys: []types.Datum{int64(i)}, Offset: int64(i) * 10, Length: 10})
+	}
+	//More entries with one key than fit a page, the bucket gets overflow pages
+	for i := 0; i < ndups; i++ {
+		tuples = append(tuples, IndexTuple{Keys: []types.Datum{"dup"}, Offset: int64(nkeys+i) * 10, Length: 10})
+	}
+	tuples = append(tuples, IndexTuple{Keys: []types.Datum{nil}, Offset: 1, Length: 1})
+	stamp := HeapStamp{Size: 12345}
+	if err := HashBuild(path, stamp, tuples); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta, ok := decodeHashMeta(data)
+	if !ok {
+		t.Fatal("could not read the metapage")
+	}
+	if meta.Ntuples != nkeys+ndups {
+		t.Errorf("metapage counts %d entries, want %d", meta.Ntuples, nkeys+ndups)
+	}
+	if meta.Maxbucket+1 < (nkeys+ndups)/HashFillFactor {
+		t.Errorf("%d buckets for %d entries, the buckets did not split", meta.Maxbucket+1, nkeys+ndups)
+	}
+	if len(data) != int(meta.Npages)*HashPageSize {
+		t.Errorf("file is %d bytes, want %d pages", len(data), meta.Npages)
+	}
+
+	for i := 0; i < nkeys; i++ {
+		found, heapStamp, err := HashSearch(path, "hash_idx", int64(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if heapStamp != stamp {
+			t.Fatalf("got stamp %v, want %v", heapStamp, stamp)
+		}
+		hit := false
+		for _, tuple := range found {
+			hit = hit || tuple.Offset == int64(i)*10
+		}
+		if !hit {
+			t.Errorf("key %d: entry not found in %v", i, found)
+		}
+	}
+	found, _, err := HashSearch(path, "hash_idx", "dup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != ndups {
+		t.Errorf("got %d entries for a duplicated key, want %d", len(found), ndups)
+	}
+	for i := 1; i < len(found); i++ {
+		if found[i-1].Offset >= found[i].Offset {
+			t.Errorf("entries are not in the order of the relation file")
+			break
+		}
+	}
+	if found, _, err := HashSearch(path, "hash_idx", "missing"); err != nil || len(found) != 0 {
+		t.Errorf("got %v, %v for a missing key, want no entries", found, err)
+	}
+	if got, ok := hashReadStamp(path); !ok || got != stamp {
+		t.Errorf("hashReadStamp got %v, %t", got, ok)
+	}
+
+	//A file cut after the metapage has none of the bucket pages it lists
+	if err := os.WriteFile(path, data[:HashPageSize], 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := HashSearch(path, "hash_idx", int64(1)); err == nil || !strings.Contains(err.Error(), "in index \"hash_idx\"") {
+		t.Errorf("got %v for a truncated index", err)
+	}
+	if _, _, err := HashSearch(path+"_none", "hash_idx", int64(1)); err == nil {
+		t.Errorf("no error for a missing index file")
+	}
+}
+
+func TestHashInsert(t *testing.T) {
+	dir := t.TempDir()
+	var tuples []IndexTuple
+	for i := 0; i < 3000; i++ {
+		key := types.Datum(int64(i % 1000))
+		if i%7 == 0 {
+			key = "dup"
+		}
+		tuples = append(tuples, IndexTuple{Keys: []types.Datum{key}, Offset: int64(i) * 10, Length: 10})
+	}
+	stamp := HeapStamp{Size: 30000}
+
+	//Inserting entries splits the buckets as the build does, the file is the one built with all of them
+	built := filepath.Join(dir, "built")
+	if err := HashBuild(built, stamp, tuples); err != nil {
+		t.Fatal(err)
+	}
+	inserted := filepath.Join(dir, "inserted")
+	if err := HashBuild(inserted, HeapStamp{Size: 1}, tuples[:100]); err != nil {
+		t.Fatal(err)
+	}
+	for start := 100; start < len(tuples); start += 700 {
+		end := min(start+700, len(tuples))
+		if err := HashInsert(inserted, "inserted", HeapStamp{Size: int64(end)}, tuples[start:end]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := HashInsert(inserted, "inserted", stamp, nil); err != nil {
+		t.Fatal(err)
+	}
+	want, err := os.ReadFile(built)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(inserted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("index made by inserts differs from the one built, %d and %d bytes", len(got), len(want))
+	}
+	found, heapStamp, err := HashSearch(inserted, "inserted", "dup")
+	if err != nil || heapStamp != stamp || len(found) != 429 {
+		t.Errorf("got %d entries for a duplicated key, stamp %v, %v", len(found), heapStamp, err)
+	}
+}
@@ -0,0 +1,418 @@
+package access
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+/*
+Access to the rows of a relation file by where they are in it (postgres access/heap/heapam.c)
+
+A row is a line of the file, what a TID is for postgres is for us the byte offset of the line and its length.
+HeapScan reads the lines in order and says where each one is, HeapFetch reads a single line back from there.
+As for SeqScan empty lines are no rows and a line ending in "\r\n" ends before the '\r'
+*/
+
+type HeapScan struct {
+	file   *os.File
+	reader *bufio.Reader
+	offset int64 //Where the next line starts
+	LineNo int   //Line number of the last line returned
+}
+
+func HeapBeginScan(path string, relname string) (*HeapScan, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open file for relation \"%s\": %v", relname, err)
+	}
+	return &HeapScan{file: file, reader: bufio.NewReaderSize(file, 64*1024)}, nil
+}
+
+// Next returns the next row's line with its offset and length, ok is false at the end of the file
+func (scan *HeapScan) Next() (line string, offset int64, length int, ok bool, err error) {
+	for {
+		line, err = scan.reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return "", 0, 0, false, err
+		}
+		if line == "" {
+			return "", 0, 0, false, nil
+		}
+		offset = scan.offset
+		scan.offset += int64(len(line))
+		scan.LineNo++
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+		if line != "" {
+			return line, offset, len(line), true, nil
+		}
+	}
+}
+
+func (scan *HeapScan) End() error {
+	return scan.file.Close()
+}
+
+// HeapFetch reads the line at offset of an open relation file
+func HeapFetch(file *os.File, offset int64, length int) (string, error) {
+	buf := make([]byte, length)
+	if _, err := file.ReadAt(buf, offset); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+/*
+HeapStamp tells one version of a relation file from another. Index entries point at offsets in the file,
+an index is only right for the version it was built from
+*/
+type HeapStamp struct {
+	Size    int64
+	ModTime int64 //Nanoseconds since the epoch
+}
+
+func StatHeap(path string) (HeapStamp, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return HeapStamp{}, err
+	}
+	return HeapStamp{Size: info.Size(), ModTime: info.ModTime().UnixNano()}, nil
+}
+
+// StatHeapFile is the HeapStamp of an open relation file, which is not the one at its path once that is replaced
+func StatHeapFile(file *os.File) (HeapStamp, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return HeapStamp{}, err
+	}
+	return HeapStamp{Size: info.Size(), ModTime: info.ModTime().UnixNano()}, nil
+}
+
+func (stamp HeapStamp) String() string {
+	return fmt.Sprintf("%d %d", stamp.Size, stamp.ModTime)
+}
+
+func parseHeapStamp(str string) (HeapStamp, bool) {
+	var stamp HeapStamp
+	if _, err := fmt.Sscanf(str, "%d %d", &stamp.Size, &stamp.ModTime); err != nil {
+		return HeapStamp{}, false
+	}
+	return stamp, true
+}
+
+/*
+HeapRewrite writes the relation file again with only its rows, each ending in "\n", leaving out the empty
+lines and carriage returns scans step over (postgres' VACUUM FULL makes a new heap of the live tuples in
+access/heap/rewriteheap.c). Returns how many rows there are and the size of the file before and after.
+Every row gets a new offset, the indexes of the relation are out of date after it
+
+storage is the attstorage of each column. Rows are toasted again on the way (see heaptoast.go): their
+fields are detoasted and the rows that are too long toasted into a new toast file, which replaces the old
+one just before the relation file does
+*/
+func HeapRewrite(path string, relname string, storage []byte) (rows int, oldSize int64, newSize int64, err error) {
+	before, err := StatHeap(path)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("could not open file for relation \"%s\": %v", relname, err)
+	}
+	scan, err := HeapBeginScan(path, relname)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	defer scan.End()
+	oldToast, err := OpenToastRelation(path)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	defer oldToast.Close()
+
+	heapFile, err := createTmpFile(path)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	toast, err := beginToastWrite(oldToast)
+	if err != nil {
+		heapFile.abort()
+		return 0, 0, 0, err
+	}
+	toastFile := toast.file
+	for {
+		line, _, _, ok, err := scan.Next()
+		if err == nil && ok {
+			line, err = toastLine(line, storage, oldToast, toast)
+		}
+		if err != nil {
+			heapFile.abort()
+			toastFile.abort()
+			return 0, 0, 0, fmt.Errorf("could not rewrite relation \"%s\": %v", relname, err)
+		}
+		if !ok {
+			break
+		}
+		heapFile.WriteString(line)
+		heapFile.WriteByte('\n')
+		newSize += int64(len(line)) + 1
+		rows++
+	}
+
+	if !toast.used {
+		toastFile.abort()
+		if err := heapFile.commit(); err != nil {
+			return 0, 0, 0, err
+		}
+		return rows, before.Size, newSize, removeFile(oldToast.path)
+	}
+	if err := toastFile.commit(); err != nil {
+		heapFile.abort()
+		return 0, 0, 0, err
+	}
+	return rows, before.Size, newSize, heapFile.commit()
+}
+
+// toastLine detoasts the fields of a row from the old toast file and toasts them into the new one
+func toastLine(line string, storage []byte, oldToast *ToastRelation, toast *toastWriter) (string, error) {
+	fields := strings.SplitN(line, ",", len(storage))
+	for i, field := range fields {
+		var err error
+		if fields[i], err = oldToast.Detoast(field); err != nil {
+			return "", err
+		}
+	}
+	return strings.Join(toastFields(fields, storage[:len(fields)], toast), ","), nil
+}
+
+func removeFile(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("could not remove file \"%s\": %v", path, err)
+	}
+	return nil
+}
+
+// tmpFile is a new version of a file written under a temporary name, commit renames it over the file
+type tmpFile struct {
+	*bufio.Writer
+	path string
+	file *os.File
+}
+
+func createTmpFile(path string) (*tmpFile, error) {
+	file, err := os.Create(path + ".tmp")
+	if err != nil {
+		return nil, fmt.Errorf("could not create file \"%s\": %v", path, err)
+	}
+	return &tmpFile{Writer: bufio.NewWriter(file), path: path, file: file}, nil
+}
+
+func (tmp *tmpFile) commit() error {
+	err := tmp.Flush()
+	if err == nil {
+		err = tmp.file.Sync()
+	}
+	if err != nil {
+		tmp.abort()
+		return fmt.Errorf("could not write to file \"%s\": %v", tmp.path, err)
+	}
+	if err := tmp.file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.path+".tmp", tmp.path)
+}
+
+func (tmp *tmpFile) abort() {
+	tmp.file.Close()
+	os.Remove(tmp.path + ".tmp")
+}
+
+// replaceFile writes a file through a temporary file renamed over it, the old file stays in place until the new one is complete
+func replaceFile(path string, write func(writer *bufio.Writer) error) error {
+	tmp, err := createTmpFile(path)
+	if err != nil {
+		return err
+	}
+	if err := write(tmp.Writer); err != nil {
+		tmp.abort()
+		return err
+	}
+	return tmp.commit()
+}
+
+// ItemPointer is where a row is in its relation file, what HeapScan.Next returns for it (postgres' ItemPointerData)
+type ItemPointer struct {
+	Offset int64
+	Length int
+}
+
+/*
+HeapInsert adds rows to a relation file, lines without their "\n" (postgres' heap_insert, with the page found
+by RelationGetBufferForTuple in access/heap/hio.c). Each row goes into free space the free space map finds for
+it and the ones that fit nowhere go at the end of the file with a single write. The file is made when it does
+not exist. The pages added at the end are all visible in the visibility map. Returns where each row went
+*/
+func HeapInsert(path string, relname string, lines []string) ([]ItemPointer, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("could not open file for relation \"%s\": %v", relname, err)
+	}
+	defer file.Close()
+	fsm, err := openFreeSpaceMap(file, path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read relation \"%s\": %v", relname, err)
+	}
+	vm, err := openVisibilityMap(file, path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read relation \"%s\": %v", relname, err)
+	}
+
+	tids := make([]ItemPointer, len(lines))
+	var appended strings.Builder
+	var appendedRows []int
+	for i, line := range lines {
+		offset, placed, err := heapPlaceRow(file, fsm, line)
+		if err != nil {
+			return nil, fmt.Errorf("could not write to relation \"%s\": %v", relname, err)
+		}
+		if placed {
+			tids[i] = ItemPointer{Offset: offset, Length: len(line)}
+			continue
+		}
+		tids[i] = ItemPointer{Offset: int64(appended.Len()), Length: len(line)}
+		appendedRows = append(appendedRows, i)
+		appended.WriteString(line)
+		appended.WriteByte('\n')
+	}
+	if appended.Len() > 0 {
+		start, err := heapAppend(file, fsm, appended.String())
+		if err != nil {
+			return nil, fmt.Errorf("could not write to relation \"%s\": %v", relname, err)
+		}
+		for _, i := range appendedRows {
+			tids[i].Offset += start
+		}
+		vm.extend(heapPages(start+int64(appended.Len())), true)
+	}
+	return tids, heapFinish(file, path, relname, fsm, vm)
+}
+
+// heapPlaceRow writes a row into a run of free bytes of the file, placed is false when the map knows of none for it
+func heapPlaceRow(file *os.File, fsm *FreeSpaceMap, line string) (offset int64, placed bool, err error) {
+	needed := len(line) + 1
+	for {
+		blkno, ok := fsm.GetPageWithFreeSpace(needed)
+		if !ok {
+			return 0, false, nil
+		}
+		page, ps, err := readPage(file, blkno)
+		if err != nil {
+			return 0, false, err
+		}
+		pageStart := *ps
+		start, found := ps.findRun(page, needed)
+		offset = int64(blkno)*BLCKSZ + int64(start)
+		if found {
+			if _, err := file.WriteAt([]byte(line), offset); err != nil {
+				return 0, false, err
+			}
+			copy(page[start:], line)
+		}
+		//The map said there was room, it is fixed with what the page has now either way
+		fsm.setAvail(blkno, pageStart.longestRun(page))
+		if found {
+			return offset, true, nil
+		}
+	}
+}
+
+// heapAppend writes rows at the end of the file, after a line break when the last line has none. Returns where the first row went
+func heapAppend(file *os.File, fsm *FreeSpaceMap, rows string) (int64, error) {
+	stamp, err := StatHeapFile(file)
+	if err != nil {
+		return 0, err
+	}
+	start := stamp.Size
+	if stamp.Size > 0 {
+		last := make([]byte, 1)
+		if _, err := file.ReadAt(last, stamp.Size-1); err != nil {
+			return 0, err
+		}
+		if last[0] != '\n' {
+			rows = "\n" + rows
+			start++
+		}
+	}
+	if _, err := file.WriteAt([]byte(rows), stamp.Size); err != nil {
+		return 0, err
+	}
+	return start, fsm.recordPages(file, int(stamp.Size/BLCKSZ), int((stamp.Size+int64(len(rows)))/BLCKSZ))
+}
+
+// heapFinish syncs a relation file that was written to and saves its free space and visibility maps with its new HeapStamp
+func heapFinish(file *os.File, path string, relname string, fsm *FreeSpaceMap, vm *VisibilityMap) error {
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("could not fsync relation \"%s\": %v", relname, err)
+	}
+	stamp, err := StatHeapFile(file)
+	if err != nil {
+		return err
+	}
+	fsm.HeapStamp = stamp
+	if err := writeFreeSpaceMap(path, fsm); err != nil {
+		return err
+	}
+	vm.HeapStamp = stamp
+	return writeVisibilityMap(path, vm)
+}
+
+/*
+HeapDelete removes rows from a relation file by writing line breaks over them (and over the '\r' ending one),
+which scans step over as empty lines. Nothing else in the file moves, so the other rows keep their offsets.
+With reclaim the pages the rows were in get their new free space in the free space map for HeapInsert to
+reuse, which is only right when nothing points at the rows any more. The rows of a table are left dead
+instead (postgres' heap_delete): its index entries still point at them until VACUUM builds the indexes again
+and records the free space (see commands/vacuum.go), a row put where an entry points would be found by it.
+The pages they are in are no longer all visible in the visibility map
+*/
+func HeapDelete(path string, relname string, tids []ItemPointer, reclaim bool) error {
+	file, err := os.OpenFile(path, os.O_RDWR, 0644)
+	if err != nil {
+		return fmt.Errorf("could not open file for relation \"%s\": %v", relname, err)
+	}
+	defer file.Close()
+	fsm, err := openFreeSpaceMap(file, path)
+	if err != nil {
+		return fmt.Errorf("could not read relation \"%s\": %v", relname, err)
+	}
+	vm, err := openVisibilityMap(file, path)
+	if err != nil {
+		return fmt.Errorf("could not read relation \"%s\": %v", relname, err)
+	}
+	for _, tid := range tids {
+		blank := make([]byte, tid.Length+1)
+		n, err := file.ReadAt(blank, tid.Offset)
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("could not read relation \"%s\": %v", relname, err)
+		}
+		if n < len(blank) || blank[tid.Length] != '\r' {
+			blank = blank[:tid.Length]
+		}
+		for i := range blank {
+			blank[i] = '\n'
+		}
+		if _, err := file.WriteAt(blank, tid.Offset); err != nil {
+			return fmt.Errorf("could not write to relation \"%s\": %v", relname, err)
+		}
+		//A run going on past the page it ends in changes what the next page has as well
+		end := tid.Offset + int64(len(blank))
+		if !reclaim {
+			for blkno := int(tid.Offset / BLCKSZ); blkno <= int(end/BLCKSZ); blkno++ {
+				vm.clear(blkno)
+			}
+			continue
+		}
+		if err := fsm.recordPages(file, int(tid.Offset/BLCKSZ), int(end/BLCKSZ)+1); err != nil {
+			return fmt.Errorf("could not read relation \"%s\": %v", relname, err)
+		}
+	}
+	return heapFinish(file, path, relname, fsm, vm)
+}
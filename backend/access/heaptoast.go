@@ -0,0 +1,373 @@
+package access
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/rautNishan/diskquery/adt"
+)
+
+/*
+TOAST, The Oversized-Attribute Storage Technique (postgres access/heap/heaptoast.c, access/common/detoast.c)
+
+A row longer than TOAST_TUPLE_THRESHOLD gets its longest fields compressed with pglz in the row, or moved out
+of it to the relation's toast file, until it is no longer than TOAST_TUPLE_TARGET. The storage of each column
+(attstorage) says what may be done with its fields:
+  - PLAIN fields stay as they are
+  - EXTENDED fields are compressed first and moved out when that is not enough
+  - EXTERNAL fields are moved out without compressing, so reading a piece of one is cheap
+  - MAIN fields are compressed and only moved out when the row is still longer than TOAST_TUPLE_TARGET_MAIN
+
+The relation file is text and any text can be a value of a column, so a toasted field is marked with the
+tag of the relation's toast file, a random string its first line holds ("pg_toast <tag>"). Compressed bytes
+go in base64:
+  - \C<tag>:<rawsize>:<base64 of the compressed text>, a field compressed in the row
+  - \X<tag>:<valueid>:<offset>:<rawsize>:<extsize>, a field moved out, rawsize is the length of its text
+    and extsize of what is stored, compressed when it is shorter
+A field is only read as toasted when the relation has a toast file and the field has its tag, so a value
+written by hand that starts with \C or \X is read as it is. A relation with a toasted field always has a
+toast file, even when all of them are compressed in the row, and the tag is kept when it is written again
+
+After its first line the toast file has a line per chunk of at most TOAST_MAX_CHUNK_SIZE bytes of a value,
+chunk_id,chunk_seq,chunk_data with the data in base64, the chunks of a value one after the other starting
+at offset. chunk_id is the valueid, fetching checks it so a pointer into another version of the file is an
+error, not the wrong value
+
+Fields are toasted when VACUUM FULL writes the rows again (HeapRewrite), the rows INSERT and UPDATE add are
+stored as they are until then and cannot have a field the toast file's tag would mark. Reading a row detoasts
+its fields before they are read with the input function of their type, so nothing past the scan sees
+toasted values
+*/
+
+const (
+	TOAST_TUPLE_THRESHOLD   = 2032 //Rows longer than this are toasted
+	TOAST_TUPLE_TARGET      = 2032 //Fields are toasted until the row is no longer than this
+	TOAST_TUPLE_TARGET_MAIN = 8160 //MAIN fields are moved out until the row is no longer than this
+	TOAST_MAX_CHUNK_SIZE    = 1996 //Bytes of a value in a chunk, before base64
+	TOAST_POINTER_SIZE      = 48   //Fields no longer than about a pointer are not worth toasting
+)
+
+// ToastPath is where the toast file of a relation is, next to its file
+func ToastPath(heapPath string) string {
+	return strings.TrimSuffix(heapPath, ".txt") + "_toast.txt"
+}
+
+// toastRelname is the toast file's name in messages, postgres' pg_toast_<relid>
+func toastRelname(toastPath string) string {
+	return "pg_toast_" + strings.TrimSuffix(filepath.Base(toastPath), "_toast.txt")
+}
+
+const toastHeaderPrefix = "pg_toast "
+
+/*
+ToastRelation reads values out of the toast file of a relation. Scans open it with the relation file, which
+keeps both versions they read from when VACUUM FULL replaces them meanwhile
+*/
+type ToastRelation struct {
+	path string
+	file *os.File //nil when the relation has no toast file
+	tag  string   //Tag of the toasted fields, empty without a toast file
+}
+
+func OpenToastRelation(heapPath string) (*ToastRelation, error) {
+	toast := &ToastRelation{path: ToastPath(heapPath)}
+	file, err := os.Open(toast.path)
+	if os.IsNotExist(err) {
+		return toast, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not open file \"%s\": %v", toast.path, err)
+	}
+	toast.file = file
+	header, err := bufio.NewReader(io.NewSectionReader(file, 0, math.MaxInt64)).ReadString('\n')
+	if !strings.HasPrefix(header, toastHeaderPrefix) || err != nil && err != io.EOF {
+		file.Close()
+		return nil, fmt.Errorf("invalid header in file \"%s\"", toast.path)
+	}
+	toast.tag = strings.TrimSuffix(header[len(toastHeaderPrefix):], "\n")
+	return toast, nil
+}
+
+// isToasted tells if a field of a row is compressed or a pointer to the toast file, the rest of it after the tag when it is
+func (toast *ToastRelation) isToasted(field string) (string, bool) {
+	if toast.tag == "" || len(field) < 2 || field[0] != '\\' || field[1] != 'C' && field[1] != 'X' {
+		return "", false
+	}
+	return strings.CutPrefix(field[2:], toast.tag+":")
+}
+
+// IsToasted tells if a field would be read as toasted, a value stored as it is must not be
+func (toast *ToastRelation) IsToasted(field string) bool {
+	_, ok := toast.isToasted(field)
+	return ok
+}
+
+// newToastTag makes the tag of a new toast file
+func newToastTag() (string, error) {
+	var tag [8]byte
+	if _, err := rand.Read(tag[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(tag[:]), nil
+}
+
+func (toast *ToastRelation) Close() error {
+	if toast.file == nil {
+		return nil
+	}
+	return toast.file.Close()
+}
+
+// Detoast returns the text of a field of a row, the field itself when it is not toasted
+func (toast *ToastRelation) Detoast(field string) (string, error) {
+	rest, ok := toast.isToasted(field)
+	if !ok {
+		return field, nil
+	}
+	if field[1] == 'C' {
+		rawsize, data, ok := strings.Cut(rest, ":")
+		size, err := strconv.Atoi(rawsize)
+		if !ok || err != nil {
+			return "", fmt.Errorf("invalid compressed datum \"%.20s\"", field)
+		}
+		return decompressField(data, size)
+	}
+
+	var ptr toastPointer
+	if _, err := fmt.Sscanf(rest, "%d:%d:%d:%d", &ptr.valueid, &ptr.offset, &ptr.rawsize, &ptr.extsize); err != nil {
+		return "", fmt.Errorf("invalid toast pointer \"%s\"", field)
+	}
+	data, err := toast.fetch(ptr)
+	if err != nil {
+		return "", err
+	}
+	if ptr.extsize < ptr.rawsize {
+		raw, err := PglzDecompress(data, ptr.rawsize)
+		if err != nil {
+			return "", err
+		}
+		return string(raw), nil
+	}
+	return string(data), nil
+}
+
+func decompressField(data string, rawsize int) (string, error) {
+	compressed, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return "", errPglzCorrupt
+	}
+	raw, err := PglzDecompress(compressed, rawsize)
+	if err != nil {
+		return "", err
+	}
+	return string(raw), nil
+}
+
+type toastPointer struct {
+	valueid int64
+	offset  int64
+	rawsize int
+	extsize int
+}
+
+// fetch reads the chunks of a value back and checks they are all there (postgres toast_fetch_datum)
+func (toast *ToastRelation) fetch(ptr toastPointer) ([]byte, error) {
+	relname := toastRelname(toast.path)
+	if toast.file == nil {
+		return nil, fmt.Errorf("missing chunk number 0 for toast value %d in %s", ptr.valueid, relname)
+	}
+	reader := bufio.NewReader(io.NewSectionReader(toast.file, ptr.offset, math.MaxInt64-ptr.offset))
+	data := make([]byte, 0, ptr.extsize)
+	for seq := 0; len(data) < ptr.extsize; seq++ {
+		line, err := reader.ReadString('\n')
+		fields := strings.SplitN(strings.TrimSuffix(line, "\n"), ",", 3)
+		if err != nil && (err != io.EOF || line == "") || len(fields) != 3 ||
+			fields[0] != strconv.FormatInt(ptr.valueid, 10) || fields[1] != strconv.Itoa(seq) {
+			return nil, fmt.Errorf("missing chunk number %d for toast value %d in %s", seq, ptr.valueid, relname)
+		}
+		chunk, err := base64.StdEncoding.DecodeString(fields[2])
+		if err != nil || len(data)+len(chunk) > ptr.extsize {
+			return nil, fmt.Errorf("unexpected chunk size %d in chunk %d for toast value %d in %s", len(chunk), seq, ptr.valueid, relname)
+		}
+		data = append(data, chunk...)
+	}
+	return data, nil
+}
+
+// maxValueId is the largest valueid in the toast file, new values get larger ones so no pointer can find them by mistake
+func (toast *ToastRelation) maxValueId() (int64, error) {
+	if toast.file == nil {
+		return 0, nil
+	}
+	var maxId int64
+	scanner := bufio.NewScanner(io.NewSectionReader(toast.file, 0, math.MaxInt64))
+	scanner.Buffer(make([]byte, 64*1024), 64*1024)
+	for scanner.Scan() {
+		id, _, _ := strings.Cut(scanner.Text(), ",")
+		if n, err := strconv.ParseInt(id, 10, 64); err == nil && n > maxId {
+			maxId = n
+		}
+	}
+	return maxId, scanner.Err()
+}
+
+// toastWriter writes the chunks of the values moved out of rows into a new toast file
+type toastWriter struct {
+	file        *tmpFile
+	tag         string
+	size        int64 //Where the next chunk goes
+	nextValueId int64
+	used        bool //A field was toasted, the new toast file is needed
+}
+
+// beginToastWrite starts a new toast file with the tag of old, a new tag when there is no old one
+func beginToastWrite(old *ToastRelation) (*toastWriter, error) {
+	lastValueId, err := old.maxValueId()
+	if err != nil {
+		return nil, fmt.Errorf("could not read file \"%s\": %v", old.path, err)
+	}
+	tag := old.tag
+	if tag == "" {
+		if tag, err = newToastTag(); err != nil {
+			return nil, fmt.Errorf("could not create file \"%s\": %v", old.path, err)
+		}
+	}
+	file, err := createTmpFile(old.path)
+	if err != nil {
+		return nil, err
+	}
+	header := toastHeaderPrefix + tag + "\n"
+	file.WriteString(header)
+	return &toastWriter{file: file, tag: tag, size: int64(len(header)), nextValueId: lastValueId + 1}, nil
+}
+
+func (writer *toastWriter) saveValue(data []byte) (int64, int64) {
+	valueid, offset := writer.nextValueId, writer.size
+	writer.nextValueId++
+	for seq := 0; seq == 0 || len(data) > 0; seq++ {
+		n := min(len(data), TOAST_MAX_CHUNK_SIZE)
+		line := strconv.FormatInt(valueid, 10) + "," + strconv.Itoa(seq) + "," + base64.StdEncoding.EncodeToString(data[:n]) + "\n"
+		writer.file.WriteString(line)
+		writer.size += int64(len(line))
+		data = data[n:]
+	}
+	return valueid, offset
+}
+
+// toastAttr is a field of a row being toasted
+type toastAttr struct {
+	raw        string //The field detoasted
+	value      string //What goes in the row
+	storage    byte
+	compressed []byte //raw compressed, when that was tried and worth it
+	tried      bool   //Compressing was tried
+	external   bool
+}
+
+func (attr *toastAttr) compress(writer *toastWriter) {
+	attr.tried = true
+	compressed, ok := PglzCompress([]byte(attr.raw), PGLZ_strategy_default)
+	if !ok {
+		return
+	}
+	attr.compressed = compressed
+	value := "\\C" + writer.tag + ":" + strconv.Itoa(len(attr.raw)) + ":" + base64.StdEncoding.EncodeToString(compressed)
+	//In base64 the compressed value can come out longer than the text it is made of
+	if len(value) < len(attr.value) {
+		attr.value = value
+		writer.used = true
+	}
+}
+
+func (attr *toastAttr) moveOut(writer *toastWriter) {
+	data := []byte(attr.raw)
+	if attr.compressed != nil {
+		data = attr.compressed
+	}
+	valueid, offset := writer.saveValue(data)
+	attr.value = fmt.Sprintf("\\X%s:%d:%d:%d:%d", writer.tag, valueid, offset, len(attr.raw), len(data))
+	attr.external = true
+	writer.used = true
+}
+
+/*
+toastFields toasts the fields of a row that is too long (postgres heap_toast_insert_or_update). Every round
+takes the longest field that can still be toasted that way:
+ 1. EXTENDED fields are compressed, a field still longer than the target on its own is moved out right away
+ 2. EXTENDED and EXTERNAL fields are moved out
+ 3. MAIN fields are compressed
+ 4. MAIN fields are moved out, only to get the row down to TOAST_TUPLE_TARGET_MAIN
+*/
+func toastFields(fields []string, storage []byte, writer *toastWriter) []string {
+	attrs := make([]*toastAttr, len(fields))
+	size := len(fields) - 1
+	for i, field := range fields {
+		attrs[i] = &toastAttr{raw: field, value: field, storage: storage[i]}
+		size += len(field)
+	}
+	if size <= TOAST_TUPLE_THRESHOLD {
+		return fields
+	}
+
+	//biggest is the longest field that takes part in a round, nil when there are none left
+	biggest := func(eligible func(attr *toastAttr) bool) *toastAttr {
+		var found *toastAttr
+		for _, attr := range attrs {
+			if attr.raw != `\N` && !attr.external && len(attr.value) > TOAST_POINTER_SIZE && eligible(attr) &&
+				(found == nil || len(attr.value) > len(found.value)) {
+				found = attr
+			}
+		}
+		return found
+	}
+	toast := func(target int, eligible func(attr *toastAttr) bool, toast func(attr *toastAttr)) {
+		for size > target {
+			attr := biggest(eligible)
+			if attr == nil {
+				return
+			}
+			before := len(attr.value)
+			toast(attr)
+			size += len(attr.value) - before
+		}
+	}
+
+	toast(TOAST_TUPLE_TARGET, func(attr *toastAttr) bool {
+		return attr.storage == adt.TYPSTORAGE_EXTENDED && !attr.tried
+	}, func(attr *toastAttr) {
+		attr.compress(writer)
+		if len(attr.value) > TOAST_TUPLE_TARGET {
+			attr.moveOut(writer)
+		}
+	})
+	toast(TOAST_TUPLE_TARGET, func(attr *toastAttr) bool {
+		return attr.storage == adt.TYPSTORAGE_EXTENDED || attr.storage == adt.TYPSTORAGE_EXTERNAL
+	}, func(attr *toastAttr) {
+		attr.moveOut(writer)
+	})
+	toast(TOAST_TUPLE_TARGET, func(attr *toastAttr) bool {
+		return attr.storage == adt.TYPSTORAGE_MAIN && !attr.tried
+	}, func(attr *toastAttr) {
+		attr.compress(writer)
+	})
+	toast(TOAST_TUPLE_TARGET_MAIN, func(attr *toastAttr) bool {
+		return attr.storage == adt.TYPSTORAGE_MAIN
+	}, func(attr *toastAttr) {
+		attr.moveOut(writer)
+	})
+
+	toasted := make([]string, len(attrs))
+	for i, attr := range attrs {
+		toasted[i] = attr.value
+	}
+	return toasted
+}
@@ -0,0 +1,94 @@
+package access
+
+import (
+	"github.com/rautNishan/diskquery/adt"
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+Index access methods (postgres access/amapi.h and the pg_am catalog)
+
+CREATE INDEX ... USING names one of these, btree when there is no USING. What a method can do decides what
+CREATE INDEX accepts and which conditions of WHERE the planner gives it as scan keys
+*/
+
+// IndexAmRoutine is what an index access method supports
+type IndexAmRoutine struct {
+	Name        string
+	CanOrder    bool //Keeps the keys in order: ASC, DESC, NULLS FIRST/LAST and the < <= >= > scan keys
+	CanUnique   bool
+	CanMulticol bool
+	CanInclude  bool //Takes INCLUDE columns
+	CanReturn   bool //The entries have the values of the columns, for index-only scans
+	//HasOpclass tells if the method can index values of a type (a default operator class in postgres)
+	HasOpclass func(typ types.Oid) bool
+	//Strategies are the operators the method can search with, key op value
+	Strategies map[string]types.StrategyNumber
+	//ReadStamp reads the HeapStamp an index file was built from
+	ReadStamp func(indexPath string) (HeapStamp, bool)
+}
+
+const (
+	BTREE_AM_NAME = "btree"
+	HASH_AM_NAME  = "hash"
+
+	GIN_AM_NAME = "gin"
+)
+
+var indexAmRoutines = map[string]*IndexAmRoutine{
+	BTREE_AM_NAME: {
+		Name:        BTREE_AM_NAME,
+		CanOrder:    true,
+		CanUnique:   true,
+		CanMulticol: true,
+		CanInclude:  true,
+		CanReturn:   true,
+		HasOpclass: func(typ types.Oid) bool {
+			entry := adt.LookupType(typ)
+			return entry != nil && entry.Compare != nil
+		},
+		Strategies: map[string]types.StrategyNumber{
+			"<":  types.BTLessStrategyNumber,
+			"<=": types.BTLessEqualStrategyNumber,
+			"=":  types.BTEqualStrategyNumber,
+			">=": types.BTGreaterEqualStrategyNumber,
+			">":  types.BTGreaterStrategyNumber,
+		},
+		ReadStamp: btReadStamp,
+	},
+	HASH_AM_NAME: {
+		Name: HASH_AM_NAME,
+		HasOpclass: func(typ types.Oid) bool {
+			entry := adt.LookupType(typ)
+			return entry != nil && entry.Hash != nil
+		},
+		Strategies: map[string]types.StrategyNumber{"=": types.BTEqualStrategyNumber},
+		ReadStamp:  hashReadStamp,
+	},
+
+	GIN_AM_NAME: {
+		Name:       GIN_AM_NAME,
+		HasOpclass: ginHasOpclass,
+		Strategies: map[string]types.StrategyNumber{"@>": types.JsonbContainsStrategyNumber},
+		ReadStamp:  ginReadStamp,
+	},
+}
+
+// GetIndexAmRoutine returns the access method called name, nil if there is none
+func GetIndexAmRoutine(name string) *IndexAmRoutine {
+	return indexAmRoutines[name]
+}
+
+// IndexIsCurrent tells if an index was built from the relation file as it is now, reading only the stamp
+func IndexIsCurrent(accessMethod string, indexPath string, heapPath string) bool {
+	am := GetIndexAmRoutine(accessMethod)
+	if am == nil {
+		return false
+	}
+	built, ok := am.ReadStamp(indexPath)
+	if !ok {
+		return false
+	}
+	current, err := StatHeap(heapPath)
+	return err == nil && built == current
+}
@@ -0,0 +1,240 @@
+package access
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+Relation locks (postgres storage/lmgr/lmgr.c and lock.c)
+
+Package catalog keeps the catalogs consistent under its own lock, these are the locks on the files of a
+table. A query holds AccessShareLock on each table it scans from when the scan starts until it is closed,
+INSERT, UPDATE and DELETE hold AccessExclusiveLock on their table for the whole statement, as postgres'
+RowExclusiveLock would not keep the rows they read in place for us, and DROP and VACUUM take it while they
+remove or replace files. A plain CREATE INDEX holds ShareLock while it reads
+the rows and adds the index, so no rows change under it. A columnar scan that finds the columnar file of its
+table out of date takes ShareUpdateExclusiveLock while it builds it again, which conflicts with itself so two
+scans do not write it at once. The modes are a subset of postgres' with the same conflicts between them:
+AccessExclusiveLock conflicts with every mode, AccessShareLock only with it.
+
+A lock is held by a ResourceOwner, the EState of a query or a statement of its own for DDL, and the locks of
+an owner never conflict with each other: an UPDATE whose scan still holds AccessShareLock gets
+AccessExclusiveLock on the same table. Waiting requests are granted in the order they came, a new request
+waits behind one it conflicts with unless its owner already holds a lock on the table, as in postgres. A
+request that would wait for an owner that is waiting, directly or not, for it fails with "deadlock
+detected" instead (postgres' deadlock check runs after deadlock_timeout, ours before waiting).
+
+Relation locks are always taken before catalogLock, never while holding it
+*/
+
+type LOCKMODE int
+
+const (
+	AccessShareLock          LOCKMODE = iota + 1 //SELECT
+	ShareUpdateExclusiveLock                     //Building a columnar file on a scan
+	ShareLock                                    //CREATE INDEX without CONCURRENTLY
+	AccessExclusiveLock                          //INSERT, UPDATE and DELETE, DROP TABLE, VACUUM
+
+	numLockModes = int(AccessExclusiveLock)
+)
+
+// lockConflicts is the modes each mode conflicts with, a bit per mode
+var lockConflicts = [numLockModes + 1]int{
+	AccessShareLock:          1 << AccessExclusiveLock,
+	ShareUpdateExclusiveLock: 1<<ShareUpdateExclusiveLock | 1<<ShareLock | 1<<AccessExclusiveLock,
+	ShareLock:                1<<ShareUpdateExclusiveLock | 1<<AccessExclusiveLock,
+	AccessExclusiveLock:      1<<AccessShareLock | 1<<ShareUpdateExclusiveLock | 1<<ShareLock | 1<<AccessExclusiveLock,
+}
+
+func (mode LOCKMODE) String() string {
+	switch mode {
+	case AccessShareLock:
+		return "AccessShareLock"
+	case ShareUpdateExclusiveLock:
+		return "ShareUpdateExclusiveLock"
+	case ShareLock:
+		return "ShareLock"
+	case AccessExclusiveLock:
+		return "AccessExclusiveLock"
+	}
+	return "unknown"
+}
+
+// ResourceOwner holds relation locks, LockReleaseAll lets go of what it still has (postgres utils/resowner)
+type ResourceOwner struct {
+	locks map[types.Oid]*[numLockModes + 1]int //How many times each mode is held, per relation
+}
+
+func NewResourceOwner() *ResourceOwner {
+	return &ResourceOwner{locks: make(map[types.Oid]*[numLockModes + 1]int)}
+}
+
+// holdsConflicting tells if the owner holds a lock on relid that conflicts with mode
+func (owner *ResourceOwner) holdsConflicting(relid types.Oid, mode LOCKMODE) bool {
+	held := owner.locks[relid]
+	if held == nil {
+		return false
+	}
+	for other := 1; other <= numLockModes; other++ {
+		if held[other] > 0 && lockConflicts[mode]&(1<<other) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+type lockRequest struct {
+	owner *ResourceOwner
+	relid types.Oid
+	mode  LOCKMODE
+}
+
+var lockMgr struct {
+	sync.Mutex
+	cond    sync.Cond
+	holders map[types.Oid]map[*ResourceOwner]bool //Owners holding a lock on each relation
+	queues  map[types.Oid][]*lockRequest          //Waiting requests of each relation, oldest first
+	waiting map[*ResourceOwner]*lockRequest
+}
+
+func init() {
+	lockMgr.cond.L = &lockMgr.Mutex
+	lockMgr.holders = make(map[types.Oid]map[*ResourceOwner]bool)
+	lockMgr.queues = make(map[types.Oid][]*lockRequest)
+	lockMgr.waiting = make(map[*ResourceOwner]*lockRequest)
+}
+
+// blockers are the owners a request has to wait for: those holding a conflicting lock and, for an owner
+// holding nothing on the relation, those with a conflicting request queued before it
+func (req *lockRequest) blockers() []*ResourceOwner {
+	var blockers []*ResourceOwner
+	for holder := range lockMgr.holders[req.relid] {
+		if holder != req.owner && holder.holdsConflicting(req.relid, req.mode) {
+			blockers = append(blockers, holder)
+		}
+	}
+	if req.owner.locks[req.relid] != nil {
+		return blockers
+	}
+	for _, queued := range lockMgr.queues[req.relid] {
+		if queued == req {
+			break
+		}
+		if queued.owner != req.owner && lockConflicts[req.mode]&(1<<queued.mode) != 0 {
+			blockers = append(blockers, queued.owner)
+		}
+	}
+	return blockers
+}
+
+// waitsFor tells if owner waits for target, directly or through other waiting owners
+func waitsFor(owner *ResourceOwner, target *ResourceOwner, visited map[*ResourceOwner]bool) bool {
+	if visited[owner] {
+		return false
+	}
+	visited[owner] = true
+	req := lockMgr.waiting[owner]
+	if req == nil {
+		return false
+	}
+	for _, blocker := range req.blockers() {
+		if blocker == target || waitsFor(blocker, target, visited) {
+			return true
+		}
+	}
+	return false
+}
+
+// LockRelationOid takes a lock on a relation for owner, waiting until no other owner holds a conflicting one
+func LockRelationOid(relid types.Oid, mode LOCKMODE, owner *ResourceOwner) error {
+	lockMgr.Lock()
+	defer lockMgr.Unlock()
+	req := &lockRequest{owner: owner, relid: relid, mode: mode}
+	lockMgr.queues[relid] = append(lockMgr.queues[relid], req)
+	for {
+		blockers := req.blockers()
+		if len(blockers) == 0 {
+			break
+		}
+		for _, blocker := range blockers {
+			if waitsFor(blocker, owner, make(map[*ResourceOwner]bool)) {
+				removeRequest(req)
+				lockMgr.cond.Broadcast()
+				return fmt.Errorf("deadlock detected: %s on relation %d is held by a statement waiting for this one", mode, relid)
+			}
+		}
+		lockMgr.waiting[owner] = req
+		lockMgr.cond.Wait()
+		delete(lockMgr.waiting, owner)
+	}
+	removeRequest(req)
+	held := owner.locks[relid]
+	if held == nil {
+		held = new([numLockModes + 1]int)
+		owner.locks[relid] = held
+	}
+	held[mode]++
+	if lockMgr.holders[relid] == nil {
+		lockMgr.holders[relid] = make(map[*ResourceOwner]bool)
+	}
+	lockMgr.holders[relid][owner] = true
+	//Requests queued behind this one may not conflict with it
+	lockMgr.cond.Broadcast()
+	return nil
+}
+
+func removeRequest(req *lockRequest) {
+	queue := lockMgr.queues[req.relid]
+	for i, queued := range queue {
+		if queued == req {
+			lockMgr.queues[req.relid] = append(queue[:i:i], queue[i+1:]...)
+			break
+		}
+	}
+	if len(lockMgr.queues[req.relid]) == 0 {
+		delete(lockMgr.queues, req.relid)
+	}
+}
+
+// UnlockRelationOid lets go of a lock LockRelationOid took
+func UnlockRelationOid(relid types.Oid, mode LOCKMODE, owner *ResourceOwner) {
+	lockMgr.Lock()
+	defer lockMgr.Unlock()
+	held := owner.locks[relid]
+	if held == nil || held[mode] == 0 {
+		return
+	}
+	held[mode]--
+	for other := 1; other <= numLockModes; other++ {
+		if held[other] > 0 {
+			lockMgr.cond.Broadcast()
+			return
+		}
+	}
+	releaseRelation(relid, owner)
+	lockMgr.cond.Broadcast()
+}
+
+func releaseRelation(relid types.Oid, owner *ResourceOwner) {
+	delete(owner.locks, relid)
+	delete(lockMgr.holders[relid], owner)
+	if len(lockMgr.holders[relid]) == 0 {
+		delete(lockMgr.holders, relid)
+	}
+}
+
+// LockReleaseAll lets go of every lock owner still holds, what an error left behind
+func LockReleaseAll(owner *ResourceOwner) {
+	lockMgr.Lock()
+	defer lockMgr.Unlock()
+	if len(owner.locks) == 0 {
+		return
+	}
+	for relid := range owner.locks {
+		releaseRelation(relid, owner)
+	}
+	lockMgr.cond.Broadcast()
+}
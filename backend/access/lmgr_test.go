@@ -0,0 +1,109 @@
+package access
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rautNishan/diskquery/types"
+)
+
+// lockInBackground takes a lock in another goroutine, the channel gets its result once it is granted or fails
+func lockInBackground(relid types.Oid, mode LOCKMODE, owner *ResourceOwner) chan error {
+	done := make(chan error, 1)
+	go func() { done <- LockRelationOid(relid, mode, owner) }()
+	return done
+}
+
+func expectWaiting(t *testing.T, done chan error, what string) {
+	t.Helper()
+	select {
+	case err := <-done:
+		t.Fatalf("%s was granted (%v), it should wait", what, err)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func expectGranted(t *testing.T, done chan error, what string) {
+	t.Helper()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("%s: %v", what, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("%s is still waiting", what)
+	}
+}
+
+func TestRelationLockConflicts(t *testing.T) {
+	reader1, reader2, writer := NewResourceOwner(), NewResourceOwner(), NewResourceOwner()
+	expectGranted(t, lockInBackground(1, AccessShareLock, reader1), "first reader")
+	expectGranted(t, lockInBackground(1, ShareLock, reader2), "second reader")
+
+	//The writer waits for both readers, a reader coming after it waits behind it
+	writing := lockInBackground(1, AccessExclusiveLock, writer)
+	expectWaiting(t, writing, "writer")
+	reader3 := NewResourceOwner()
+	reading := lockInBackground(1, AccessShareLock, reader3)
+	expectWaiting(t, reading, "reader queued behind the writer")
+	//An owner already holding a lock on the relation does not queue
+	expectGranted(t, lockInBackground(1, AccessShareLock, reader1), "reader taking a second lock")
+
+	UnlockRelationOid(1, AccessShareLock, reader1)
+	UnlockRelationOid(1, ShareLock, reader2)
+	expectWaiting(t, writing, "writer while the first reader holds its second lock")
+	LockReleaseAll(reader1)
+	expectGranted(t, writing, "writer")
+	expectWaiting(t, reading, "reader while the writer holds its lock")
+
+	//The locks of an owner do not conflict with each other
+	expectGranted(t, lockInBackground(1, AccessShareLock, writer), "writer reading")
+	UnlockRelationOid(1, AccessShareLock, writer)
+	UnlockRelationOid(1, AccessExclusiveLock, writer)
+	expectGranted(t, reading, "reader")
+	LockReleaseAll(reader3)
+	if len(lockMgr.holders) != 0 || len(lockMgr.queues) != 0 {
+		t.Errorf("locks left behind: %v %v", lockMgr.holders, lockMgr.queues)
+	}
+}
+
+func TestShareUpdateExclusiveLock(t *testing.T) {
+	scan1, scan2, indexer := NewResourceOwner(), NewResourceOwner(), NewResourceOwner()
+	expectGranted(t, lockInBackground(1, AccessShareLock, scan1), "first scan")
+	expectGranted(t, lockInBackground(1, AccessShareLock, scan2), "second scan")
+	//One scan builds the columnar file while the other reads, a second build and CREATE INDEX wait for it
+	expectGranted(t, lockInBackground(1, ShareUpdateExclusiveLock, scan1), "first build")
+	building := lockInBackground(1, ShareUpdateExclusiveLock, scan2)
+	expectWaiting(t, building, "second build")
+	indexing := lockInBackground(1, ShareLock, indexer)
+	expectWaiting(t, indexing, "CREATE INDEX during a build")
+
+	UnlockRelationOid(1, ShareUpdateExclusiveLock, scan1)
+	expectGranted(t, building, "second build")
+	expectWaiting(t, indexing, "CREATE INDEX during the second build")
+	UnlockRelationOid(1, ShareUpdateExclusiveLock, scan2)
+	expectGranted(t, indexing, "CREATE INDEX")
+	LockReleaseAll(scan1)
+	LockReleaseAll(scan2)
+	LockReleaseAll(indexer)
+	if len(lockMgr.holders) != 0 || len(lockMgr.queues) != 0 {
+		t.Errorf("locks left behind: %v %v", lockMgr.holders, lockMgr.queues)
+	}
+}
+
+func TestRelationLockDeadlock(t *testing.T) {
+	first, second := NewResourceOwner(), NewResourceOwner()
+	expectGranted(t, lockInBackground(1, AccessShareLock, first), "first on 1")
+	expectGranted(t, lockInBackground(2, AccessShareLock, second), "second on 2")
+	firstWaiting := lockInBackground(2, AccessExclusiveLock, first)
+	expectWaiting(t, firstWaiting, "first writing 2")
+
+	err := LockRelationOid(1, AccessExclusiveLock, second)
+	if err == nil || !strings.HasPrefix(err.Error(), "deadlock detected") {
+		t.Fatalf("second writing 1 got %v, want a deadlock", err)
+	}
+	LockReleaseAll(second)
+	expectGranted(t, firstWaiting, "first writing 2 once second is gone")
+	LockReleaseAll(first)
+}
@@ -0,0 +1,367 @@
+package access
+
+import (
+	"bufio"
+	"container/list"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/rautNishan/diskquery/adt"
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+Btree indexes (postgres access/nbtree)
+
+Ours is not a tree of pages: the index file holds every entry sorted in index order, a line per entry, and
+is read whole into memory the first time it is used (and again when the file changes), a bounded cache keeps
+the indexes used last (see btCache). A search is a binary search over the entries, finding what descending
+the tree finds in postgres. An insert writes the whole file again with the new entries merged in (BTInsert),
+the entries of rows deleted meanwhile stay until VACUUM builds the index again
+
+The first line of the file is the HeapStamp of the relation file the index was built from, then each entry is
+	offset<TAB>length<TAB>key<TAB>key...<TAB>include<TAB>include...
+where offset and length tell where the row is in the relation file and the keys and INCLUDE columns are in
+their text form, \N for NULL and backslash, tab, newline and carriage return escaped as in COPY. An entry points at a byte offset,
+once the relation file is not the one in the stamp the index is out of date and must not be used
+
+In index order NULLs are equal to each other and come after every value unless NullsFirst, Desc reverses
+the values but not where the NULLs go (that is what NullsFirst says)
+*/
+
+// IndexKey is how an index column is ordered
+type IndexKey struct {
+	TypeOid    types.Oid
+	Desc       bool
+	NullsFirst bool
+}
+
+// IndexTuple is an index entry, the key values of a row followed by its INCLUDE columns and where the row is
+type IndexTuple struct {
+	Keys   []types.Datum
+	Offset int64
+	Length int
+}
+
+// ScanKey is index column AttNo compared with a non NULL value
+type ScanKey struct {
+	AttNo    int
+	Strategy types.StrategyNumber
+	Arg      types.Datum
+}
+
+// BTIndex is an index file read into memory, it does not change once loaded and is shared by every scan
+type BTIndex struct {
+	HeapStamp HeapStamp //The relation file the entries point into
+	Keys      []IndexKey
+	Include   []types.Oid //Types of the INCLUDE columns
+	Tuples    []IndexTuple
+	fileStamp HeapStamp //The index file this was read from
+	path      string
+}
+
+/*
+btCache keeps the indexes read last, at most btCacheEntries entries of all of them together. The least
+recently used index goes first when there is no room, one with more entries than that is read for each
+scan and not kept. An index whose file changed is dropped when it is next opened
+*/
+var btCache struct {
+	sync.Mutex
+	indexes map[string]*list.Element //Of lru, the value is the *BTIndex
+	lru     list.List                //Most recently used first
+	ntuples int
+}
+
+var btCacheEntries = 1 << 20
+
+func btCacheRemove(path string) {
+	if elem := btCache.indexes[path]; elem != nil {
+		btCache.ntuples -= len(elem.Value.(*BTIndex).Tuples)
+		btCache.lru.Remove(elem)
+		delete(btCache.indexes, path)
+	}
+}
+
+func btCacheAdd(path string, index *BTIndex) {
+	if len(index.Tuples) > btCacheEntries {
+		return
+	}
+	for btCache.ntuples+len(index.Tuples) > btCacheEntries {
+		btCacheRemove(btCache.lru.Back().Value.(*BTIndex).path)
+	}
+	if btCache.indexes == nil {
+		btCache.indexes = make(map[string]*list.Element)
+	}
+	btCache.indexes[path] = btCache.lru.PushFront(index)
+	btCache.ntuples += len(index.Tuples)
+}
+
+// compareKey compares two values of an index column in index order
+func compareKey(key IndexKey, a types.Datum, b types.Datum) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		if key.NullsFirst {
+			return -1
+		}
+		return 1
+	case b == nil:
+		if key.NullsFirst {
+			return 1
+		}
+		return -1
+	}
+	//Keys have a btree ordering, the planner checked when the index was made
+	cmp, _ := adt.CompareDatums(a, b)
+	if key.Desc {
+		return -cmp
+	}
+	return cmp
+}
+
+// CompareIndexTuples compares the keys of two entries in index order
+func CompareIndexTuples(keys []IndexKey, a []types.Datum, b []types.Datum) int {
+	for i, key := range keys {
+		if cmp := compareKey(key, a[i], b[i]); cmp != 0 {
+			return cmp
+		}
+	}
+	return 0
+}
+
+// BTSort puts entries in index order, entries with equal keys stay in the order of the relation file
+func BTSort(keys []IndexKey, tuples []IndexTuple) {
+	sort.SliceStable(tuples, func(i, j int) bool {
+		return CompareIndexTuples(keys, tuples[i].Keys, tuples[j].Keys) < 0
+	})
+}
+
+// BTWrite writes an index file with sorted entries
+func BTWrite(path string, heapStamp HeapStamp, tuples []IndexTuple) error {
+	return replaceFile(path, func(writer *bufio.Writer) error {
+		writer.WriteString(heapStamp.String() + "\n")
+		for _, tuple := range tuples {
+			writer.WriteString(strconv.FormatInt(tuple.Offset, 10))
+			writer.WriteByte('\t')
+			writer.WriteString(strconv.Itoa(tuple.Length))
+			for _, value := range tuple.Keys {
+				writer.WriteByte('\t')
+				writer.WriteString(escapeKey(value))
+			}
+			writer.WriteByte('\n')
+		}
+		return nil
+	})
+}
+
+/*
+BTInsert writes the index file again with the entries of index and new entries merged in index order, for the
+relation file heapStamp is of (postgres' btinsert). The rows the entries of index point at must not have moved,
+the entries of rows that went dead stay as they are: scans step over dead rows and VACUUM removes their entries
+*/
+func BTInsert(path string, index *BTIndex, heapStamp HeapStamp, tuples []IndexTuple) error {
+	BTSort(index.Keys, tuples)
+	merged := make([]IndexTuple, 0, len(index.Tuples)+len(tuples))
+	old := index.Tuples
+	for _, tuple := range tuples {
+		//Equal keys go after the old ones, the order of the relation file for a file that only grew
+		n := sort.Search(len(old), func(i int) bool { return CompareIndexTuples(index.Keys, old[i].Keys, tuple.Keys) > 0 })
+		merged = append(append(merged, old[:n]...), tuple)
+		old = old[n:]
+	}
+	return BTWrite(path, heapStamp, append(merged, old...))
+}
+
+var keyEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+
+func escapeKey(value types.Datum) string {
+	if value == nil {
+		return `\N`
+	}
+	return keyEscaper.Replace(adt.OutputDatum(value, &adt.DefaultSettings))
+}
+
+func unescapeKey(typ types.Oid, field string) (types.Datum, error) {
+	if field == `\N` {
+		return nil, nil
+	}
+	if strings.IndexByte(field, '\\') >= 0 {
+		var sb strings.Builder
+		for i := 0; i < len(field); i++ {
+			if field[i] != '\\' || i+1 == len(field) {
+				sb.WriteByte(field[i])
+				continue
+			}
+			i++
+			switch field[i] {
+			case 't':
+				sb.WriteByte('\t')
+			case 'n':
+				sb.WriteByte('\n')
+			case 'r':
+				sb.WriteByte('\r')
+			default:
+				sb.WriteByte(field[i])
+			}
+		}
+		field = sb.String()
+	}
+	return adt.InputDatum(typ, field, &adt.DefaultSettings)
+}
+
+// BTOpen returns the entries of an index file, reading it unless it is cached and has not changed since
+func BTOpen(path string, indexName string, keys []IndexKey, include []types.Oid) (*BTIndex, error) {
+	btCache.Lock()
+	defer btCache.Unlock()
+	fileStamp, err := StatHeap(path)
+	if err != nil {
+		btCacheRemove(path)
+		return nil, fmt.Errorf("could not open index \"%s\": %v", indexName, err)
+	}
+	if elem := btCache.indexes[path]; elem != nil {
+		cached := elem.Value.(*BTIndex)
+		if cached.fileStamp == fileStamp && len(cached.Keys) == len(keys) && len(cached.Include) == len(include) {
+			btCache.lru.MoveToFront(elem)
+			return cached, nil
+		}
+		btCacheRemove(path)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open index \"%s\": %v", indexName, err)
+	}
+	defer file.Close()
+	reader := bufio.NewReaderSize(file, 64*1024)
+	index := &BTIndex{Keys: keys, Include: include, fileStamp: fileStamp, path: path}
+	valueTypes := make([]types.Oid, 0, len(keys)+len(include))
+	for _, key := range keys {
+		valueTypes = append(valueTypes, key.TypeOid)
+	}
+	valueTypes = append(valueTypes, include...)
+	corrupted := func(lineNo int) error {
+		return fmt.Errorf("index \"%s\" is corrupted at line %d", indexName, lineNo)
+	}
+	for lineNo := 1; ; lineNo++ {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if line == "" {
+			break
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if lineNo == 1 {
+			var ok bool
+			if index.HeapStamp, ok = parseHeapStamp(line); !ok {
+				return nil, corrupted(lineNo)
+			}
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) != len(valueTypes)+2 {
+			return nil, corrupted(lineNo)
+		}
+		tuple := IndexTuple{Keys: make([]types.Datum, len(valueTypes))}
+		offset, err1 := strconv.ParseInt(fields[0], 10, 64)
+		length, err2 := strconv.Atoi(fields[1])
+		if err1 != nil || err2 != nil {
+			return nil, corrupted(lineNo)
+		}
+		tuple.Offset, tuple.Length = offset, length
+		for i, typ := range valueTypes {
+			if tuple.Keys[i], err = unescapeKey(typ, fields[i+2]); err != nil {
+				return nil, fmt.Errorf("index \"%s\" line %d: %v", indexName, lineNo, err)
+			}
+		}
+		index.Tuples = append(index.Tuples, tuple)
+	}
+
+	btCacheAdd(path, index)
+	return index, nil
+}
+
+// btReadStamp reads the first line of a btree index file
+func btReadStamp(indexPath string) (HeapStamp, bool) {
+	file, err := os.Open(indexPath)
+	if err != nil {
+		return HeapStamp{}, false
+	}
+	defer file.Close()
+	line, err := bufio.NewReader(file).ReadString('\n')
+	if err != nil {
+		return HeapStamp{}, false
+	}
+	return parseHeapStamp(strings.TrimSuffix(line, "\n"))
+}
+
+/*
+Search returns the entries matching every scan key, in index order. The keys compare a prefix of the
+index columns with = and then at most one more column with any of the operators, the entries that match
+are then a single run of the sorted entries and two binary searches find where it starts and ends
+*/
+func (index *BTIndex) Search(scanKeys []ScanKey) []IndexTuple {
+	//position is -1 for an entry before the matching ones, 0 for a match and 1 for one after
+	position := func(tuple *IndexTuple) int {
+		for _, scanKey := range scanKeys {
+			key := index.Keys[scanKey.AttNo]
+			value := tuple.Keys[scanKey.AttNo]
+			cmp := compareKey(key, value, scanKey.Arg)
+			if scanKey.Strategy == types.BTEqualStrategyNumber || value == nil {
+				//NULLs never match, they sort at one end
+				if cmp != 0 {
+					return sign(cmp)
+				}
+				continue
+			}
+			valueCmp := cmp
+			if key.Desc {
+				valueCmp = -cmp
+			}
+			var matches, belowRange bool
+			switch scanKey.Strategy {
+			case types.BTLessStrategyNumber:
+				matches = valueCmp < 0
+			case types.BTLessEqualStrategyNumber:
+				matches = valueCmp <= 0
+			case types.BTGreaterEqualStrategyNumber:
+				matches, belowRange = valueCmp >= 0, true
+			case types.BTGreaterStrategyNumber:
+				matches, belowRange = valueCmp > 0, true
+			}
+			if !matches {
+				//Too small for a lower bound comes first in ascending order, last in descending order
+				if belowRange != key.Desc {
+					return -1
+				}
+				return 1
+			}
+		}
+		return 0
+	}
+
+	tuples := index.Tuples
+	lower := sort.Search(len(tuples), func(i int) bool { return position(&tuples[i]) >= 0 })
+	upper := sort.Search(len(tuples), func(i int) bool { return position(&tuples[i]) > 0 })
+	if lower >= upper {
+		return nil
+	}
+	return tuples[lower:upper]
+}
+
+func sign(cmp int) int {
+	switch {
+	case cmp < 0:
+		return -1
+	case cmp > 0:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,104 @@
+package access
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rautNishan/diskquery/types"
+)
+
+func TestBTCacheIsBounded(t *testing.T) {
+	saved := btCacheEntries
+	btCacheEntries = 10
+	t.Cleanup(func() { btCacheEntries = saved })
+
+	dir := t.TempDir()
+	keys := []IndexKey{{TypeOid: types.INT8OID}}
+	writeIndex := func(name string, n int) string {
+		path := filepath.Join(dir, name)
+		var tuples []IndexTuple
+		for i := 0; i < n; i++ {
+			tuples = append(tuples, IndexTuple{Keys: []types.Datum{int64(i)}, Offset: int64(i), Length: 1})
+		}
+		if err := BTWrite(path, HeapStamp{Size: int64(n)}, tuples); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	open := func(path string) *BTIndex {
+		index, err := BTOpen(path, filepath.Base(path), keys, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return index
+	}
+	cached := func(path string) bool {
+		btCache.Lock()
+		defer btCache.Unlock()
+		return btCache.indexes[path] != nil
+	}
+
+	var paths []string
+	for i := 0; i < 4; i++ {
+		paths = append(paths, writeIndex(fmt.Sprintf("idx%d", i), 4))
+	}
+	open(paths[0])
+	open(paths[1])
+	open(paths[0])
+	//Room for two of them, idx1 was used longest ago
+	open(paths[2])
+	if !cached(paths[0]) || cached(paths[1]) || !cached(paths[2]) {
+		t.Errorf("want idx0 and idx2 cached")
+	}
+
+	big := writeIndex("big", 11)
+	if index := open(big); len(index.Tuples) != 11 || cached(big) {
+		t.Errorf("an index larger than the cache must be read but not kept")
+	}
+
+	//A changed or removed file drops the entry
+	writeIndex("idx0", 3)
+	if index := open(paths[0]); len(index.Tuples) != 3 {
+		t.Errorf("got %d entries of a rewritten index, want 3", len(index.Tuples))
+	}
+	os.Remove(paths[2])
+	if _, err := BTOpen(paths[2], "idx2", keys, nil); err == nil || cached(paths[2]) {
+		t.Errorf("a removed index must not stay cached")
+	}
+	btCache.Lock()
+	defer btCache.Unlock()
+	if btCache.ntuples > btCacheEntries {
+		t.Errorf("cache holds %d entries, more than %d", btCache.ntuples, btCacheEntries)
+	}
+}
+
+func TestBTInsert(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "idx")
+	keys := []IndexKey{{TypeOid: types.INT8OID, Desc: true}}
+	entry := func(key types.Datum, offset int64) IndexTuple {
+		return IndexTuple{Keys: []types.Datum{key}, Offset: offset, Length: 1}
+	}
+	if err := BTWrite(path, HeapStamp{Size: 1}, []IndexTuple{entry(int64(5), 0), entry(int64(3), 2), entry(nil, 4)}); err != nil {
+		t.Fatal(err)
+	}
+	index, err := BTOpen(path, "idx", keys, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//New entries go in index order, after the old ones with equal keys
+	if err := BTInsert(path, index, HeapStamp{Size: 2}, []IndexTuple{entry(int64(3), 6), entry(nil, 8), entry(int64(9), 10)}); err != nil {
+		t.Fatal(err)
+	}
+	if index, err = BTOpen(path, "idx", keys, nil); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, tuple := range index.Tuples {
+		got = append(got, fmt.Sprintf("%v@%d", tuple.Keys[0], tuple.Offset))
+	}
+	if fmt.Sprint(got) != "[9@10 5@0 3@2 3@6 <nil>@4 <nil>@8]" || index.HeapStamp.Size != 2 {
+		t.Errorf("entries after insert are %v for %v", got, index.HeapStamp)
+	}
+}
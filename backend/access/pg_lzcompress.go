@@ -0,0 +1,182 @@
+package access
+
+import (
+	"errors"
+	"math"
+)
+
+/*
+pglz, the LZ compression of TOAST (postgres common/pg_lzcompress.c), with the same format so a value
+compressed here decompresses there
+
+The output is items, each either a literal byte or a tag copying earlier output again, grouped by eight
+behind a control byte whose bits (lowest first) tell which ones are tags. A tag is 2 bytes: the high nibble
+of the first and all of the second are the offset back (1 to 4095), the low nibble of the first is the
+length minus 3. A low nibble 15 means a third byte follows, adding to a length of 18, so a match is 3 to
+273 bytes
+
+The compressor finds matches through a hash table of the positions where each 3 bytes start, chained
+newest first and walked no further back than the 4095 bytes a tag can reach. It gives up when the result
+is not small enough to be worth it (PGLZ_Strategy)
+*/
+
+const (
+	PGLZ_MAX_OFFSET  = 4095
+	PGLZ_MAX_MATCH   = 273
+	pglzHistorySize  = 8192
+	pglzHistoryMask  = pglzHistorySize - 1
+	pglzMinMatch     = 3
+	pglzMaxShortTail = 17 //Longest match that fits a 2 byte tag
+)
+
+// PGLZ_Strategy decides when compressing is worth it
+type PGLZ_Strategy struct {
+	MinInputSize   int //Shorter input is not compressed
+	MaxInputSize   int //Nor is longer
+	MinCompRate    int //Percent the result must save
+	FirstSuccessBy int //Give up when no match is found within this many bytes of output
+	MatchSizeGood  int //A match this long ends the search for a longer one
+	MatchSizeDrop  int //Percent MatchSizeGood drops by for each older match looked at
+}
+
+var PGLZ_strategy_default = &PGLZ_Strategy{
+	MinInputSize:   32,
+	MaxInputSize:   math.MaxInt32,
+	MinCompRate:    25,
+	FirstSuccessBy: 1024,
+	MatchSizeGood:  128,
+	MatchSizeDrop:  10,
+}
+
+var errPglzCorrupt = errors.New("compressed pglz data is corrupt")
+
+func pglzHash(source []byte, pos int) int {
+	return (int(source[pos])<<6 ^ int(source[pos+1])<<3 ^ int(source[pos+2])) & pglzHistoryMask
+}
+
+// PglzCompress compresses source, ok is false when the strategy says it is not worth it
+func PglzCompress(source []byte, strategy *PGLZ_Strategy) (result []byte, ok bool) {
+	slen := len(source)
+	if slen < strategy.MinInputSize || slen > strategy.MaxInputSize {
+		return nil, false
+	}
+	goodMatch := min(max(strategy.MatchSizeGood, pglzMaxShortTail), PGLZ_MAX_MATCH)
+	goodDrop := min(max(strategy.MatchSizeDrop, 0), 100)
+	needRate := min(max(strategy.MinCompRate, 0), 99)
+	resultMax := slen * (100 - needRate) / 100
+
+	//head is the newest position for each hash, prev links a position to the older one with its hash
+	head := make([]int32, pglzHistorySize)
+	for i := range head {
+		head[i] = -1
+	}
+	prev := make([]int32, slen)
+	addHistory := func(pos int) {
+		if pos+pglzMinMatch <= slen {
+			h := pglzHash(source, pos)
+			prev[pos] = head[h]
+			head[h] = int32(pos)
+		}
+	}
+
+	result = make([]byte, 0, resultMax+4)
+	ctrlPos, ctrlBit := 0, 0
+	foundMatch := false
+	for dp := 0; dp < slen; {
+		if len(result) >= resultMax {
+			return nil, false
+		}
+		if !foundMatch && len(result) >= strategy.FirstSuccessBy {
+			return nil, false
+		}
+		if ctrlBit == 0 {
+			ctrlPos = len(result)
+			result = append(result, 0)
+			ctrlBit = 1
+		}
+
+		matchLen, matchOff := 0, 0
+		if dp+pglzMinMatch <= slen {
+			good := goodMatch
+			limit := min(slen-dp, PGLZ_MAX_MATCH)
+			for pos := head[pglzHash(source, dp)]; pos >= 0 && dp-int(pos) <= PGLZ_MAX_OFFSET; pos = prev[pos] {
+				n := 0
+				for n < limit && source[int(pos)+n] == source[dp+n] {
+					n++
+				}
+				if n > matchLen {
+					matchLen, matchOff = n, dp-int(pos)
+				}
+				if matchLen >= good {
+					break
+				}
+				good -= good * goodDrop / 100
+			}
+		}
+
+		if matchLen >= pglzMinMatch {
+			result[ctrlPos] |= byte(ctrlBit)
+			if matchLen > pglzMaxShortTail {
+				result = append(result, byte(matchOff>>4&0xf0|0x0f), byte(matchOff), byte(matchLen-18))
+			} else {
+				result = append(result, byte(matchOff>>4&0xf0|(matchLen-3)), byte(matchOff))
+			}
+			for i := 0; i < matchLen; i++ {
+				addHistory(dp + i)
+			}
+			dp += matchLen
+			foundMatch = true
+		} else {
+			result = append(result, source[dp])
+			addHistory(dp)
+			dp++
+		}
+		ctrlBit = ctrlBit << 1 & 0xff
+	}
+	if len(result) >= resultMax {
+		return nil, false
+	}
+	return result, true
+}
+
+// PglzDecompress expands compressed data back into the rawsize bytes it was compressed from
+func PglzDecompress(source []byte, rawsize int) ([]byte, error) {
+	dest := make([]byte, 0, rawsize)
+	sp := 0
+	for sp < len(source) && len(dest) < rawsize {
+		ctrl := source[sp]
+		sp++
+		for bit := 0; bit < 8 && sp < len(source) && len(dest) < rawsize; bit++ {
+			if ctrl&(1<<bit) == 0 {
+				dest = append(dest, source[sp])
+				sp++
+				continue
+			}
+			if sp+1 >= len(source) {
+				return nil, errPglzCorrupt
+			}
+			length := int(source[sp]&0x0f) + 3
+			offset := int(source[sp]&0xf0)<<4 | int(source[sp+1])
+			sp += 2
+			if length == 18 {
+				if sp >= len(source) {
+					return nil, errPglzCorrupt
+				}
+				length += int(source[sp])
+				sp++
+			}
+			if offset == 0 || offset > len(dest) || len(dest)+length > rawsize {
+				return nil, errPglzCorrupt
+			}
+			//The copy can overlap what it writes, a run of one byte is a tag with offset 1
+			from := len(dest) - offset
+			for i := 0; i < length; i++ {
+				dest = append(dest, dest[from+i])
+			}
+		}
+	}
+	if len(dest) != rawsize || sp != len(source) {
+		return nil, errPglzCorrupt
+	}
+	return dest, nil
+}
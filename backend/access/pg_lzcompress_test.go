@@ -0,0 +1,60 @@
+package access
+
+import (
+	"bytes"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestPglzRoundTrip(t *testing.T) {
+	random := make([]byte, 4000)
+	rand.New(rand.NewSource(1)).Read(random)
+	inputs := map[string][]byte{
+		"text":   []byte(strings.Repeat("the quick brown fox jumps over the lazy dog. ", 100)),
+		"run":    bytes.Repeat([]byte{'a'}, 10000),
+		"mixed":  append(append([]byte(strings.Repeat("0123456789", 50)), random[:200]...), []byte(strings.Repeat("0123456789", 50))...),
+		"repeat": bytes.Repeat(random[:800], 3),
+	}
+	for name, input := range inputs {
+		compressed, ok := PglzCompress(input, PGLZ_strategy_default)
+		if !ok {
+			t.Errorf("%s: not compressed", name)
+			continue
+		}
+		if len(compressed) >= len(input)*(100-PGLZ_strategy_default.MinCompRate)/100 {
+			t.Errorf("%s: %d bytes compressed to %d", name, len(input), len(compressed))
+		}
+		output, err := PglzDecompress(compressed, len(input))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+		} else if !bytes.Equal(output, input) {
+			t.Errorf("%s: decompressed data differs", name)
+		}
+	}
+
+	if _, ok := PglzCompress([]byte("short"), PGLZ_strategy_default); ok {
+		t.Errorf("input shorter than MinInputSize was compressed")
+	}
+	if _, ok := PglzCompress(random, PGLZ_strategy_default); ok {
+		t.Errorf("random data was compressed")
+	}
+}
+
+func TestPglzDecompressFormat(t *testing.T) {
+	//A literal 'a' then a tag copying 5 bytes from offset 1, and a tag with the extra length byte
+	output, err := PglzDecompress([]byte{0x06, 'a', 0x02, 0x01, 0x0f, 0x01, 0x02}, 26)
+	if err != nil || string(output) != strings.Repeat("a", 26) {
+		t.Errorf("got %q, %v", output, err)
+	}
+	for name, input := range map[string][]byte{
+		"zero offset":         {0x02, 'a', 0x02, 0x00},
+		"offset before start": {0x02, 'a', 0x02, 0x02},
+		"truncated tag":       {0x02, 'a', 0x02},
+		"longer than rawsize": {0x02, 'a', 0x0f, 0x01, 0xff},
+	} {
+		if _, err := PglzDecompress(input, 10); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package access
+
+import (
+	"sync"
+
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+Counts of the rows INSERT, UPDATE and DELETE changed in each table (postgres utils/activity/pgstat_relation.c).
+DeadTuples are the rows deleted or replaced by UPDATE since the last VACUUM, the ones VACUUM has to remove.
+LiveTuples are the rows VACUUM last found in the table and the ones inserted and deleted since, autovacuum
+weighs the dead rows against them. The counts are kept in memory and start from zero with the server, as
+postgres' do after a crash: dead rows left from before are only removed by a VACUUM run for another reason
+*/
+
+type PgStat_StatTabEntry struct {
+	TuplesInserted int64
+	TuplesUpdated  int64
+	TuplesDeleted  int64
+	LiveTuples     int64
+	DeadTuples     int64
+}
+
+var pgStatTables struct {
+	sync.Mutex
+	entries map[types.Oid]*PgStat_StatTabEntry
+}
+
+// PgstatCountHeap counts what a statement did to a table
+func PgstatCountHeap(relid types.Oid, inserted int64, updated int64, deleted int64) {
+	pgStatTables.Lock()
+	defer pgStatTables.Unlock()
+	entry := pgstatTabEntry(relid)
+	entry.TuplesInserted += inserted
+	entry.TuplesUpdated += updated
+	entry.TuplesDeleted += deleted
+	//Rows there were before the server started are not counted, they cannot be deleted below zero
+	entry.LiveTuples = max(entry.LiveTuples+inserted-deleted, 0)
+	entry.DeadTuples += updated + deleted
+}
+
+// pgstatTabEntry returns the counts of a table to change, the caller holds pgStatTables
+func pgstatTabEntry(relid types.Oid) *PgStat_StatTabEntry {
+	if pgStatTables.entries == nil {
+		pgStatTables.entries = make(map[types.Oid]*PgStat_StatTabEntry)
+	}
+	entry := pgStatTables.entries[relid]
+	if entry == nil {
+		entry = &PgStat_StatTabEntry{}
+		pgStatTables.entries[relid] = entry
+	}
+	return entry
+}
+
+// PgstatFetchStatTabEntry returns the counts of a table, zero for one nothing was counted for
+func PgstatFetchStatTabEntry(relid types.Oid) PgStat_StatTabEntry {
+	pgStatTables.Lock()
+	defer pgStatTables.Unlock()
+	if entry := pgStatTables.entries[relid]; entry != nil {
+		return *entry
+	}
+	return PgStat_StatTabEntry{}
+}
+
+// PgstatReportVacuum records that the dead rows of a table were removed and how many rows VACUUM found in it
+func PgstatReportVacuum(relid types.Oid, liveTuples int64) {
+	pgStatTables.Lock()
+	defer pgStatTables.Unlock()
+	entry := pgstatTabEntry(relid)
+	entry.LiveTuples = liveTuples
+	entry.DeadTuples = 0
+}
@@ -0,0 +1,107 @@
+package access
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+)
+
+/*
+Pruning (postgres access/heap/pruneheap.c)
+
+HeapPrune moves the rows of each page of a relation file to the start of the page, so the dead rows and
+empty lines between them make a single run of free space at its end that a longer row fits in (postgres'
+heap_page_prune and PageRepairFragmentation). A row running on into the next page stays where it is and
+every row stays in its page, the file keeps its size. The rows that move get other offsets in their page: as
+after HeapRewrite the indexes of the relation are out of date, VACUUM builds them again. The file is written
+again through a temporary file renamed over it. Returns how many pages changed and how many rows there are
+*/
+func HeapPrune(path string, relname string) (pages int, rows int64, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, 0, fmt.Errorf("could not open file for relation \"%s\": %v", relname, err)
+	}
+	defer file.Close()
+	stamp, err := StatHeapFile(file)
+	if err != nil {
+		return 0, 0, fmt.Errorf("could not open file for relation \"%s\": %v", relname, err)
+	}
+
+	err = replaceFile(path, func(writer *bufio.Writer) error {
+		page := make([]byte, BLCKSZ)
+		//How long the line the page before ended in is so far, rows are counted as a scan finds them
+		var lineLen int
+		var crlf bool
+		for blkno := 0; blkno < heapPages(stamp.Size); blkno++ {
+			n, err := file.ReadAt(page, int64(blkno)*BLCKSZ)
+			if err != nil && err != io.EOF {
+				return err
+			}
+			if prunePage(page[:n], lineLen == 0) {
+				pages++
+			}
+			for _, c := range page[:n] {
+				if c != '\n' {
+					lineLen++
+					crlf = c == '\r'
+					continue
+				}
+				if crlf {
+					lineLen--
+				}
+				if lineLen > 0 {
+					rows++
+				}
+				lineLen, crlf = 0, false
+			}
+			if _, err := writer.Write(page[:n]); err != nil {
+				return err
+			}
+		}
+		//The last row of a file may have no line break
+		if lineLen > 0 {
+			rows++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("could not prune relation \"%s\": %v", relname, err)
+	}
+	return pages, rows, nil
+}
+
+/*
+prunePage moves the rows that start and end in a page together at its start, lineStart tells if the page
+starts a line. Empty lines, a dead row is some, and lines of a carriage return only are left out and as many
+line breaks written after the rows. Returns if the page changed
+*/
+func prunePage(page []byte, lineStart bool) bool {
+	start := 0
+	if !lineStart {
+		start = bytes.IndexByte(page, '\n') + 1
+		if start == 0 {
+			return false
+		}
+	}
+	end := bytes.LastIndexByte(page, '\n') + 1
+	if end <= start {
+		return false
+	}
+	region := page[start:end]
+	compacted := make([]byte, 0, len(region))
+	for _, line := range bytes.SplitAfter(region, []byte("\n")) {
+		if len(bytes.TrimSuffix(bytes.TrimSuffix(line, []byte("\n")), []byte("\r"))) > 0 {
+			compacted = append(compacted, line...)
+		}
+	}
+	if len(compacted) == len(region) {
+		return false
+	}
+	copy(region, compacted)
+	for i := len(compacted); i < len(region); i++ {
+		region[i] = '\n'
+	}
+	return true
+}
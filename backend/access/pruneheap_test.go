@@ -0,0 +1,81 @@
+package access
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHeapPrune(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fsm_t.txt")
+	var lines []string
+	for i := range 1500 {
+		lines = append(lines, fmt.Sprintf("%d,row%05d", i, i))
+	}
+	tids, err := HeapInsert(path, "fsm_t", lines)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//Every other row of the first page is dead, and a row with a carriage return is empty
+	var dead []ItemPointer
+	for i, tid := range tids {
+		if i%2 == 0 && (tid.Offset+int64(tid.Length))/BLCKSZ == 0 {
+			dead = append(dead, tid)
+		}
+	}
+	if err := HeapDelete(path, "fsm_t", dead, false); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = append(data, "\r\nlast"...)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	want := heapLines(t, path)
+
+	pages, rows, err := HeapPrune(path, "fsm_t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pages != 2 || rows != int64(len(want)) {
+		t.Errorf("HeapPrune changed %d pages and found %d rows, want 2 and %d", pages, rows, len(want))
+	}
+	if got := heapLines(t, path); strings.Join(got, ";") != strings.Join(want, ";") {
+		t.Errorf("rows after pruning differ")
+	}
+	pruned, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pruned) != len(data) {
+		t.Errorf("pruning made the file %d bytes, was %d", len(pruned), len(data))
+	}
+	//The dead rows of the first page are one run at its end, the row crossing into the next page stays put
+	var crossing ItemPointer
+	for _, tid := range tids {
+		if tid.Offset < BLCKSZ && tid.Offset+int64(tid.Length) >= BLCKSZ {
+			crossing = tid
+		}
+	}
+	if crossing.Length == 0 {
+		t.Fatal("no row crosses into the second page")
+	}
+	if rows := strings.TrimRight(string(pruned[:crossing.Offset]), "\n"); strings.Contains(rows, "\n\n") {
+		t.Errorf("first page still has dead rows between its rows")
+	}
+	if row := string(pruned[crossing.Offset : crossing.Offset+int64(crossing.Length)]); row != string(data[crossing.Offset:crossing.Offset+int64(crossing.Length)]) {
+		t.Errorf("the row crossing into the second page moved")
+	}
+
+	if err := FreeSpaceMapVacuum(path, "fsm_t"); err != nil {
+		t.Fatal(err)
+	}
+	if tids, err = HeapInsert(path, "fsm_t", []string{strings.Repeat("x", 2000)}); err != nil || tids[0].Offset >= BLCKSZ {
+		t.Errorf("a long row inserted after pruning went to %v (%v), want the free space of the first page", tids, err)
+	}
+}
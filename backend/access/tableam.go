@@ -0,0 +1,21 @@
+package access
+
+/*
+Table access methods (postgres access/tableam.h and the pg_am rows of type TABLE)
+
+CREATE TABLE ... USING names one of these, default_table_access_method when there is no USING. Whatever the
+method the rows of a table are in its relation file, written from outside as always:
+  - heap tables are only read from there
+  - columnar tables also have a columnar file made from the relation file, which scans read instead (see
+    columnar.go). The first scan after the relation file changed, or after CREATE TABLE, builds it again
+*/
+
+const (
+	HEAP_TABLE_AM_NAME     = "heap"
+	COLUMNAR_TABLE_AM_NAME = "columnar"
+)
+
+// IsTableAm tells if name is a table access method
+func IsTableAm(name string) bool {
+	return name == HEAP_TABLE_AM_NAME || name == COLUMNAR_TABLE_AM_NAME
+}
@@ -0,0 +1,172 @@
+package access
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+/*
+The visibility map (postgres access/heap/visibilitymap.c)
+
+A bit per page of BLCKSZ bytes of the relation file, set when the page is all visible: no index entry points at
+a dead row in it, so an index-only scan can take the entries of rows in the page as they are without reading
+the row (see executor/nodeIndexonlyscan.go). HeapDelete clears the bits of the pages it leaves dead rows in,
+VACUUM sets every bit once it has built the indexes again (VisibilityMapVacuum). The pages HeapInsert adds at
+the end of the file only have the new rows and are all visible, rows put in free space keep the page as it was.
+
+The map is kept in a file next to the relation file with the HeapStamp of the version of the relation file it
+was made for, as the free space map is. A relation file changed from outside makes the map out of date, it is
+made again from the file: a dead row is a run of at least two line breaks and a page without one is all
+visible. Empty lines look the same, the pages having some are left for the next VACUUM to set
+*/
+
+const (
+	vmMagic      = 0x564d3031
+	vmVersion    = 1
+	vmHeaderSize = 4*2 + 8*2 + 4
+)
+
+// VisibilityMap is the map of a relation file, bit n%8 of bits[n/8] is set for an all visible page n
+type VisibilityMap struct {
+	HeapStamp HeapStamp
+	Npages    int
+	bits      []byte
+}
+
+// VisibilityMapPath is where the visibility map of a relation is, next to its relation file
+func VisibilityMapPath(heapPath string) string {
+	return strings.TrimSuffix(heapPath, ".txt") + "_vm.txt"
+}
+
+// IsAllVisible tells if no index entry points at a dead row in page blkno (VM_ALL_VISIBLE)
+func (vm *VisibilityMap) IsAllVisible(blkno int) bool {
+	return blkno < vm.Npages && vm.bits[blkno/8]&(1<<(blkno%8)) != 0
+}
+
+// extend makes the map cover npages pages, the pages added are all visible or not
+func (vm *VisibilityMap) extend(npages int, allVisible bool) {
+	for ; vm.Npages < npages; vm.Npages++ {
+		if vm.Npages%8 == 0 {
+			vm.bits = append(vm.bits, 0)
+		}
+		if allVisible {
+			vm.bits[vm.Npages/8] |= 1 << (vm.Npages % 8)
+		}
+	}
+}
+
+// clear marks page blkno as having dead rows (visibilitymap_clear)
+func (vm *VisibilityMap) clear(blkno int) {
+	if blkno < vm.Npages {
+		vm.bits[blkno/8] &^= 1 << (blkno % 8)
+	}
+}
+
+func heapPages(size int64) int {
+	return int((size + BLCKSZ - 1) / BLCKSZ)
+}
+
+// buildVisibilityMap makes the map of an open relation file from its contents
+func buildVisibilityMap(file *os.File) (*VisibilityMap, error) {
+	stamp, err := StatHeapFile(file)
+	if err != nil {
+		return nil, err
+	}
+	vm := &VisibilityMap{HeapStamp: stamp}
+	//A page is read with the first byte of the next one, a run starting at its last byte goes on there
+	page := make([]byte, BLCKSZ+1)
+	for blkno := 0; blkno < heapPages(stamp.Size); blkno++ {
+		n, err := file.ReadAt(page, int64(blkno)*BLCKSZ)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		vm.extend(blkno+1, !bytes.Contains(page[:n], []byte("\n\n")))
+	}
+	return vm, nil
+}
+
+// readVisibilityMap reads the map of a relation, ok is false when it has none or it cannot be read
+func readVisibilityMap(heapPath string) (*VisibilityMap, bool) {
+	data, err := os.ReadFile(VisibilityMapPath(heapPath))
+	if err != nil || len(data) < vmHeaderSize {
+		return nil, false
+	}
+	le := binary.LittleEndian
+	if le.Uint32(data) != vmMagic || le.Uint32(data[4:]) != vmVersion {
+		return nil, false
+	}
+	vm := &VisibilityMap{
+		HeapStamp: HeapStamp{Size: int64(le.Uint64(data[8:])), ModTime: int64(le.Uint64(data[16:]))},
+		Npages:    int(le.Uint32(data[24:])),
+	}
+	if len(data) != vmHeaderSize+(vm.Npages+7)/8 {
+		return nil, false
+	}
+	vm.bits = data[vmHeaderSize:]
+	return vm, true
+}
+
+// writeVisibilityMap puts the map of a relation in its file
+func writeVisibilityMap(heapPath string, vm *VisibilityMap) error {
+	return replaceFile(VisibilityMapPath(heapPath), func(writer *bufio.Writer) error {
+		le := binary.LittleEndian
+		header := le.AppendUint32(nil, vmMagic)
+		header = le.AppendUint32(header, vmVersion)
+		header = le.AppendUint64(header, uint64(vm.HeapStamp.Size))
+		header = le.AppendUint64(header, uint64(vm.HeapStamp.ModTime))
+		header = le.AppendUint32(header, uint32(vm.Npages))
+		writer.Write(header)
+		_, err := writer.Write(vm.bits)
+		return err
+	})
+}
+
+// openVisibilityMap returns the map of an open relation file, made again when the one in its file is out of date
+func openVisibilityMap(file *os.File, heapPath string) (*VisibilityMap, error) {
+	stamp, err := StatHeapFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if vm, ok := readVisibilityMap(heapPath); ok && vm.HeapStamp == stamp {
+		return vm, nil
+	}
+	return buildVisibilityMap(file)
+}
+
+// VisibilityMapOpen returns the visibility map of an open relation file for an index-only scan
+func VisibilityMapOpen(file *os.File, heapPath string, relname string) (*VisibilityMap, error) {
+	vm, err := openVisibilityMap(file, heapPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not read relation \"%s\": %v", relname, err)
+	}
+	return vm, nil
+}
+
+/*
+VisibilityMapVacuum marks every page of a relation all visible, for VACUUM once no index has entries of dead
+rows any more (postgres' lazy_scan_heap sets the bits of the pages it finds all visible)
+*/
+func VisibilityMapVacuum(heapPath string, relname string) error {
+	stamp, err := StatHeap(heapPath)
+	if err != nil {
+		return fmt.Errorf("could not open file for relation \"%s\": %v", relname, err)
+	}
+	vm := &VisibilityMap{HeapStamp: stamp}
+	vm.extend(heapPages(stamp.Size), true)
+	return writeVisibilityMap(heapPath, vm)
+}
+
+// VisibilityMapIsCurrent tells if the visibility map of a relation was made for its relation file as it is now
+func VisibilityMapIsCurrent(heapPath string) bool {
+	vm, ok := readVisibilityMap(heapPath)
+	if !ok {
+		return false
+	}
+	current, err := StatHeap(heapPath)
+	return err == nil && vm.HeapStamp == current
+}
@@ -0,0 +1,85 @@
+package access
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// visibleBits returns which pages of a relation are all visible in the map kept for it
+func visibleBits(t *testing.T, path string) []bool {
+	t.Helper()
+	vm, ok := readVisibilityMap(path)
+	if !ok || !VisibilityMapIsCurrent(path) {
+		t.Fatal("visibility map missing or out of date")
+	}
+	bits := make([]bool, vm.Npages)
+	for i := range bits {
+		bits[i] = vm.IsAllVisible(i)
+	}
+	return bits
+}
+
+func TestVisibilityMap(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vm_t.txt")
+	var lines []string
+	for i := range 3000 {
+		lines = append(lines, fmt.Sprintf("%d,row%05d", i, i))
+	}
+	tids, err := HeapInsert(path, "vm_t", lines)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(visibleBits(t, path)); got != "[true true true true true]" {
+		t.Fatalf("pages of a new relation file: %s", got)
+	}
+
+	//A dead row clears its page, and the next one too when it runs past the end of its page
+	var spanning ItemPointer
+	for _, tid := range tids {
+		if tid.Offset/BLCKSZ == 1 && (tid.Offset+int64(tid.Length))/BLCKSZ == 2 {
+			spanning = tid
+		}
+	}
+	if err := HeapDelete(path, "vm_t", []ItemPointer{tids[0], spanning}, false); err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(visibleBits(t, path)); got != "[false false false true true]" {
+		t.Errorf("pages after delete: %s", got)
+	}
+	//The map made again from the file agrees with the one kept by delete
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	built, err := buildVisibilityMap(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kept, _ := readVisibilityMap(path); fmt.Sprint(built.bits) != fmt.Sprint(kept.bits) {
+		t.Errorf("visibility map made from the file is %v, kept %v", built.bits, kept.bits)
+	}
+
+	//Rows added at the end are in new pages that are all visible
+	if _, err := HeapInsert(path, "vm_t", lines[:2000]); err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(visibleBits(t, path)); got != "[false false false true true true true true true]" {
+		t.Errorf("pages after insert: %s", got)
+	}
+	if err := VisibilityMapVacuum(path, "vm_t"); err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(visibleBits(t, path)); got != "[true true true true true true true true true]" {
+		t.Errorf("pages after VACUUM: %s", got)
+	}
+	//Reclaimed rows have no index entries pointing at them, their pages stay all visible
+	if err := HeapDelete(path, "vm_t", tids[1:2], true); err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(visibleBits(t, path)); got != "[true true true true true true true true true]" {
+		t.Errorf("pages after delete with reclaim: %s", got)
+	}
+}
@@ -0,0 +1,602 @@
+package adt
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+Arrays are []Datum, elements can be NULL
+A multidimensional array nests them, {{1,2},{3,4}} is a []Datum of two []Datum. Arrays are rectangular,
+the sub-arrays of one level all have the same dimensions. Every dimension starts at 1 (postgres arrays
+can have other lower bounds, ours cannot) and the empty array has no dimensions at all.
+The functions work on any element type, the elements know their own type
+*/
+
+// MAXDIM is the most dimensions an array can have, as in postgres
+const MAXDIM = 6
+
+// ArrayDims returns the length of each dimension of an array, nil for the empty array
+func ArrayDims(a []types.Datum) []int {
+	var dims []int
+	for len(a) > 0 {
+		dims = append(dims, len(a))
+		sub, ok := a[0].([]types.Datum)
+		if !ok {
+			break
+		}
+		a = sub
+	}
+	return dims
+}
+
+// ArrayElements returns the elements of an array in storage order, whatever its dimensions
+func ArrayElements(a []types.Datum) []types.Datum {
+	if len(a) == 0 {
+		return nil
+	}
+	if _, nested := a[0].([]types.Datum); !nested {
+		return a
+	}
+	var elems []types.Datum
+	for _, sub := range a {
+		elems = append(elems, ArrayElements(sub.([]types.Datum))...)
+	}
+	return elems
+}
+
+func sameDims(a []int, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+arrayIn reads the text form of an array of elemType, {1,2,NULL}, {"a b","c\"d"} or {{1,2},{3,4}}
+(postgres array_in). Elements are read by the element type's input function, unquoted ones without their
+surrounding white space, and an unquoted NULL is the NULL element
+*/
+func arrayIn(elemType types.Oid) func(str string, settings *Settings) (types.Datum, error) {
+	return func(str string, settings *Settings) (types.Datum, error) {
+		parser := &arrayParser{str: str, elemType: elemType, settings: settings}
+		parser.skipSpace()
+		if parser.pos >= len(str) || str[parser.pos] != '{' {
+			return nil, parser.malformed("array value must start with \"{\" or dimension information")
+		}
+		elems, _, err := parser.parseLevel(1)
+		if err != nil {
+			return nil, err
+		}
+		parser.skipSpace()
+		if parser.pos < len(str) {
+			return nil, parser.malformed("junk after closing right brace")
+		}
+		return elems, nil
+	}
+}
+
+type arrayParser struct {
+	str      string
+	pos      int
+	elemType types.Oid
+	settings *Settings
+}
+
+func (ap *arrayParser) malformed(detail string) error {
+	return fmt.Errorf("malformed array literal: \"%s\": %s", ap.str, detail)
+}
+
+func (ap *arrayParser) skipSpace() {
+	for ap.pos < len(ap.str) && isArraySpace(ap.str[ap.pos]) {
+		ap.pos++
+	}
+}
+
+/*
+parseLevel reads one {...} at nesting depth ndim, the current character is its '{'. It returns the dimensions
+of what it read as well, the level's length followed by those of its sub-arrays
+*/
+func (ap *arrayParser) parseLevel(ndim int) ([]types.Datum, []int, error) {
+	if ndim > MAXDIM {
+		return nil, nil, fmt.Errorf("number of array dimensions exceeds the maximum allowed (%d)", MAXDIM)
+	}
+	ap.pos++
+	elems := []types.Datum{}
+	ap.skipSpace()
+	if ap.pos < len(ap.str) && ap.str[ap.pos] == '}' {
+		ap.pos++
+		return elems, nil, nil
+	}
+
+	var subDims []int
+	nested := false
+	for {
+		ap.skipSpace()
+		if ap.pos >= len(ap.str) {
+			return nil, nil, ap.malformed("unexpected end of input")
+		}
+		if ap.str[ap.pos] == '{' {
+			if len(elems) > 0 && !nested {
+				return nil, nil, ap.malformed("unexpected \"{\" character")
+			}
+			sub, dims, err := ap.parseLevel(ndim + 1)
+			if err != nil {
+				return nil, nil, err
+			}
+			if len(dims) == 0 {
+				return nil, nil, ap.malformed("unexpected \"}\" character")
+			}
+			if nested && !sameDims(dims, subDims) {
+				return nil, nil, ap.malformed("multidimensional arrays must have sub-arrays with matching dimensions")
+			}
+			nested, subDims = true, dims
+			elems = append(elems, sub)
+		} else {
+			if nested {
+				return nil, nil, ap.malformed("unexpected array element")
+			}
+			elem, err := ap.parseElement()
+			if err != nil {
+				return nil, nil, err
+			}
+			elems = append(elems, elem)
+		}
+
+		ap.skipSpace()
+		if ap.pos >= len(ap.str) {
+			return nil, nil, ap.malformed("unexpected end of input")
+		}
+		switch ap.str[ap.pos] {
+		case ',':
+			ap.pos++
+		case '}':
+			ap.pos++
+			return elems, append([]int{len(elems)}, subDims...), nil
+		default:
+			return nil, nil, ap.malformed("unexpected array element")
+		}
+	}
+}
+
+// parseElement reads a scalar element, quoted or not, up to the ',' or '}' after it
+func (ap *arrayParser) parseElement() (types.Datum, error) {
+	var text strings.Builder
+	if ap.str[ap.pos] == '"' {
+		ap.pos++
+		for {
+			if ap.pos >= len(ap.str) {
+				return nil, ap.malformed("unexpected end of input")
+			}
+			c := ap.str[ap.pos]
+			ap.pos++
+			if c == '"' {
+				break
+			}
+			if c == '\\' && ap.pos < len(ap.str) {
+				c = ap.str[ap.pos]
+				ap.pos++
+			}
+			text.WriteByte(c)
+		}
+		return InputDatum(ap.elemType, text.String(), ap.settings)
+	}
+
+	//Trailing white space is not part of an unquoted element, unless it was escaped
+	keep, escaped := 0, false
+	for ap.pos < len(ap.str) && ap.str[ap.pos] != ',' && ap.str[ap.pos] != '}' {
+		c := ap.str[ap.pos]
+		ap.pos++
+		switch c {
+		case '{', '"':
+			return nil, ap.malformed(fmt.Sprintf("unexpected \"%c\" character", c))
+		case '\\':
+			if ap.pos >= len(ap.str) {
+				return nil, ap.malformed("unexpected end of input")
+			}
+			text.WriteByte(ap.str[ap.pos])
+			ap.pos++
+			keep, escaped = text.Len(), true
+			continue
+		}
+		text.WriteByte(c)
+		if !isArraySpace(c) {
+			keep = text.Len()
+		}
+	}
+	value := text.String()[:keep]
+	if value == "" {
+		if ap.pos >= len(ap.str) {
+			return nil, ap.malformed("unexpected end of input")
+		}
+		return nil, ap.malformed(fmt.Sprintf("unexpected \"%c\" character", ap.str[ap.pos]))
+	}
+	if strings.EqualFold(value, "null") && !escaped {
+		return nil, nil
+	}
+	return InputDatum(ap.elemType, value, ap.settings)
+}
+
+func isArraySpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\v' || c == '\f'
+}
+
+// Arrays print as {1,2,NULL} or {{1,2},{3,4}}, elements that would be ambiguous are double quoted
+func arrayOut(d types.Datum, settings *Settings) string {
+	var builder strings.Builder
+	appendArrayOut(&builder, d.([]types.Datum), settings)
+	return builder.String()
+}
+
+func appendArrayOut(builder *strings.Builder, elems []types.Datum, settings *Settings) {
+	builder.WriteByte('{')
+	for i, elem := range elems {
+		if i > 0 {
+			builder.WriteByte(',')
+		}
+		switch v := elem.(type) {
+		case nil:
+			builder.WriteString("NULL")
+		case []types.Datum:
+			appendArrayOut(builder, v, settings)
+		default:
+			text := OutputDatum(elem, settings)
+			if text != "" && !strings.EqualFold(text, "null") && !strings.ContainsAny(text, "{},\"\\ \t\n\r\v\f") {
+				builder.WriteString(text)
+				continue
+			}
+			builder.WriteByte('"')
+			for j := 0; j < len(text); j++ {
+				if text[j] == '"' || text[j] == '\\' {
+					builder.WriteByte('\\')
+				}
+				builder.WriteByte(text[j])
+			}
+			builder.WriteByte('"')
+		}
+	}
+	builder.WriteByte('}')
+}
+
+// Arrays compare element by element, NULL elements sort after everything else
+func arrayCmp(a types.Datum, b types.Datum) int {
+	av, bv := a.([]types.Datum), b.([]types.Datum)
+	for i := 0; i < len(av) && i < len(bv); i++ {
+		switch {
+		case av[i] == nil && bv[i] == nil:
+			continue
+		case av[i] == nil:
+			return 1
+		case bv[i] == nil:
+			return -1
+		}
+		//Elements of one array type have the same Go type, so this cannot fail
+		if cmp, _ := CompareDatums(av[i], bv[i]); cmp != 0 {
+			return cmp
+		}
+	}
+	return compareOrdered(int64(len(av)), int64(len(bv)))
+}
+
+func hashArray(buf []byte, d types.Datum) []byte {
+	elems := d.([]types.Datum)
+	buf = binary.AppendUvarint(buf, uint64(len(elems)))
+	for _, elem := range elems {
+		if elem == nil {
+			buf = append(buf, 0)
+			continue
+		}
+		buf = append(buf, 1)
+		buf = hashDatum(buf, elem)
+	}
+	return buf
+}
+
+// arrayCoerce converts every element of an array with the cast of its element type
+func arrayCoerce(elemCast CastFunc) CastFunc {
+	var coerce CastFunc
+	coerce = func(d types.Datum, settings *Settings) (types.Datum, error) {
+		elems := d.([]types.Datum)
+		result := make([]types.Datum, len(elems))
+		for i, elem := range elems {
+			var err error
+			switch elem.(type) {
+			case nil:
+			case []types.Datum:
+				result[i], err = coerce(elem, settings)
+			default:
+				result[i], err = elemCast(elem, settings)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+	}
+	return coerce
+}
+
+/*
+MakeMultidimArray builds ARRAY[sub, sub, ...] from arrays (postgres ExecEvalArrayExpr), the sub-arrays
+become the first dimension. NULL and empty sub-arrays are left out, the others must match
+*/
+func MakeMultidimArray(subs []types.Datum) (types.Datum, error) {
+	result := []types.Datum{}
+	var dims []int
+	for _, sub := range subs {
+		elems, _ := sub.([]types.Datum)
+		if len(elems) == 0 {
+			continue
+		}
+		if len(result) > 0 && !sameDims(ArrayDims(elems), dims) {
+			return nil, fmt.Errorf("multidimensional arrays must have array expressions with matching dimensions")
+		}
+		dims = ArrayDims(elems)
+		if len(dims) >= MAXDIM {
+			return nil, fmt.Errorf("number of array dimensions (%d) exceeds the maximum allowed (%d)", len(dims)+1, MAXDIM)
+		}
+		result = append(result, elems)
+	}
+	return result, nil
+}
+
+// ArrayGetElement fetches a[subscripts], NULL unless there is a subscript per dimension and all are in range
+func ArrayGetElement(a []types.Datum, subscripts []int64) types.Datum {
+	if len(subscripts) != len(ArrayDims(a)) {
+		return nil
+	}
+	var elem types.Datum = a
+	for _, subscript := range subscripts {
+		elems := elem.([]types.Datum)
+		if subscript < 1 || subscript > int64(len(elems)) {
+			return nil
+		}
+		elem = elems[subscript-1]
+	}
+	return elem
+}
+
+/*
+ArrayGetSlice fetches a[lower:upper] with a pair of bounds for each of the first dimensions, the others
+are taken whole. Bounds are clamped to the array, a slice that is empty in any dimension is the empty array
+*/
+func ArrayGetSlice(a []types.Datum, lower []int64, upper []int64) []types.Datum {
+	if len(lower) > len(ArrayDims(a)) {
+		return []types.Datum{}
+	}
+	if slice, ok := arraySliceLevel(a, lower, upper); ok {
+		return slice
+	}
+	return []types.Datum{}
+}
+
+func arraySliceLevel(a []types.Datum, lower []int64, upper []int64) ([]types.Datum, bool) {
+	if len(lower) == 0 {
+		return a, true
+	}
+	lb, ub := max(lower[0], 1), min(upper[0], int64(len(a)))
+	if lb > ub {
+		return nil, false
+	}
+	result := make([]types.Datum, 0, ub-lb+1)
+	for _, elem := range a[lb-1 : ub] {
+		if len(lower) > 1 {
+			sub, ok := arraySliceLevel(elem.([]types.Datum), lower[1:], upper[1:])
+			if !ok {
+				return nil, false
+			}
+			elem = sub
+		}
+		result = append(result, elem)
+	}
+	return result, true
+}
+
+/*
+arrayCat concatenates two arrays (postgres array_cat): arrays of the same number of dimensions are joined
+along the first one, an array with one dimension less is added as a single element of the other
+*/
+func arrayCat(a []types.Datum, b []types.Datum) ([]types.Datum, error) {
+	adims, bdims := ArrayDims(a), ArrayDims(b)
+	switch {
+	case len(adims) == 0:
+		return b, nil
+	case len(bdims) == 0:
+		return a, nil
+	case len(adims) == len(bdims) && sameDims(adims[1:], bdims[1:]):
+		return append(append([]types.Datum{}, a...), b...), nil
+	case len(adims) == len(bdims)+1 && sameDims(adims[1:], bdims):
+		return append(append([]types.Datum{}, a...), types.Datum(b)), nil
+	case len(adims)+1 == len(bdims) && sameDims(adims, bdims[1:]):
+		return append([]types.Datum{a}, b...), nil
+	}
+	return nil, fmt.Errorf("cannot concatenate incompatible arrays")
+}
+
+// arrayAppend adds an element at the end of a one-dimensional array, before it when prepend is set
+func arrayAppend(a []types.Datum, elem types.Datum, prepend bool) ([]types.Datum, error) {
+	if len(ArrayDims(a)) > 1 {
+		return nil, fmt.Errorf("argument must be empty or one-dimensional array")
+	}
+	if prepend {
+		return append([]types.Datum{elem}, a...), nil
+	}
+	return append(append(make([]types.Datum, 0, len(a)+1), a...), elem), nil
+}
+
+// arrayContains tells if every element of b is an element of a, a NULL element is in no array
+func arrayContains(a []types.Datum, b []types.Datum) bool {
+	aelems := ArrayElements(a)
+	for _, belem := range ArrayElements(b) {
+		if belem == nil || !arrayHasElement(aelems, belem) {
+			return false
+		}
+	}
+	return true
+}
+
+func arrayHasElement(elems []types.Datum, elem types.Datum) bool {
+	for _, candidate := range elems {
+		if candidate == nil {
+			continue
+		}
+		if cmp, _ := CompareDatums(candidate, elem); cmp == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// arrayOverlap tells if the arrays have an element in common
+func arrayOverlap(a []types.Datum, b []types.Datum) bool {
+	aelems := ArrayElements(a)
+	for _, belem := range ArrayElements(b) {
+		if belem != nil && arrayHasElement(aelems, belem) {
+			return true
+		}
+	}
+	return false
+}
+
+// arrayToString joins the elements with delimiter, NULLs are left out unless nullString is set
+func arrayToString(a []types.Datum, delimiter string, nullString *string, settings *Settings) string {
+	var builder strings.Builder
+	first := true
+	for _, elem := range ArrayElements(a) {
+		text := ""
+		switch {
+		case elem != nil:
+			text = OutputDatum(elem, settings)
+		case nullString != nil:
+			text = *nullString
+		default:
+			continue
+		}
+		if !first {
+			builder.WriteString(delimiter)
+		}
+		builder.WriteString(text)
+		first = false
+	}
+	return builder.String()
+}
+
+/*
+The array functions and operators are polymorphic, anyarray and anyelement stand for whatever array
+and element type the call has (postgres polymorphic pseudo types), the planner works out the actual types
+*/
+func init() {
+	const (
+		anyarray   = types.ANYARRAYOID
+		anyelement = types.ANYELEMENTOID
+		int8       = types.INT8OID
+		text       = types.TEXTOID
+		boolean    = types.BOOLOID
+	)
+
+	//dimension is 1 based, a dimension the array does not have gives NULL
+	dimensionLength := func(a []types.Datum, dimension int64) (int64, bool) {
+		dims := ArrayDims(a)
+		if dimension < 1 || dimension > int64(len(dims)) {
+			return 0, false
+		}
+		return int64(dims[dimension-1]), true
+	}
+	addFunction("array_length", []types.Oid{anyarray, int8}, int8, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		if length, ok := dimensionLength(fcinfo.Args[0].([]types.Datum), fcinfo.Args[1].(int64)); ok {
+			return length, nil
+		}
+		return nil, nil
+	})
+	addFunction("array_lower", []types.Oid{anyarray, int8}, int8, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		if _, ok := dimensionLength(fcinfo.Args[0].([]types.Datum), fcinfo.Args[1].(int64)); ok {
+			return int64(1), nil
+		}
+		return nil, nil
+	})
+	addFunction("array_upper", []types.Oid{anyarray, int8}, int8, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		if length, ok := dimensionLength(fcinfo.Args[0].([]types.Datum), fcinfo.Args[1].(int64)); ok {
+			return length, nil
+		}
+		return nil, nil
+	})
+	addFunction("array_ndims", []types.Oid{anyarray}, int8, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		if dims := ArrayDims(fcinfo.Args[0].([]types.Datum)); len(dims) > 0 {
+			return int64(len(dims)), nil
+		}
+		return nil, nil
+	})
+	addFunction("array_dims", []types.Oid{anyarray}, text, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		dims := ArrayDims(fcinfo.Args[0].([]types.Datum))
+		if len(dims) == 0 {
+			return nil, nil
+		}
+		var builder strings.Builder
+		for _, dim := range dims {
+			builder.WriteString("[1:" + strconv.Itoa(dim) + "]")
+		}
+		return builder.String(), nil
+	})
+	addFunction("cardinality", []types.Oid{anyarray}, int8, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		return int64(len(ArrayElements(fcinfo.Args[0].([]types.Datum)))), nil
+	})
+
+	//A NULL array is taken as an empty one and a NULL element is appended as such
+	addFunction("array_append", []types.Oid{anyarray, anyelement}, anyarray, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		a, _ := fcinfo.Args[0].([]types.Datum)
+		return arrayAppend(a, fcinfo.Args[1], false)
+	}).Strict = false
+	addFunction("array_prepend", []types.Oid{anyelement, anyarray}, anyarray, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		a, _ := fcinfo.Args[1].([]types.Datum)
+		return arrayAppend(a, fcinfo.Args[0], true)
+	}).Strict = false
+	addFunction("array_cat", []types.Oid{anyarray, anyarray}, anyarray, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		a, aok := fcinfo.Args[0].([]types.Datum)
+		b, bok := fcinfo.Args[1].([]types.Datum)
+		if !aok && !bok {
+			return nil, nil
+		}
+		return arrayCat(a, b)
+	}).Strict = false
+
+	addFunction("array_to_string", []types.Oid{anyarray, text}, text, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		return arrayToString(fcinfo.Args[0].([]types.Datum), fcinfo.Args[1].(string), nil, fcinfo.Settings), nil
+	})
+	addFunction("array_to_string", []types.Oid{anyarray, text, text}, text, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		nullString := fcinfo.Args[2].(string)
+		return arrayToString(fcinfo.Args[0].([]types.Datum), fcinfo.Args[1].(string), &nullString, fcinfo.Settings), nil
+	})
+
+	//unnest returns the elements of any number of dimensions in storage order
+	addFunction("unnest", []types.Oid{anyarray}, anyelement, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		return SetResult(ArrayElements(fcinfo.Args[0].([]types.Datum))), nil
+	}).setRetset()
+
+	addOperator("&&", anyarray, anyarray, boolean, func(l, r types.Datum) (types.Datum, error) {
+		return arrayOverlap(l.([]types.Datum), r.([]types.Datum)), nil
+	})
+	addOperator("@>", anyarray, anyarray, boolean, func(l, r types.Datum) (types.Datum, error) {
+		return arrayContains(l.([]types.Datum), r.([]types.Datum)), nil
+	})
+	addOperator("<@", anyarray, anyarray, boolean, func(l, r types.Datum) (types.Datum, error) {
+		return arrayContains(r.([]types.Datum), l.([]types.Datum)), nil
+	})
+	addOperator("||", anyarray, anyarray, anyarray, func(l, r types.Datum) (types.Datum, error) {
+		return arrayCat(l.([]types.Datum), r.([]types.Datum))
+	})
+	addOperator("||", anyarray, anyelement, anyarray, func(l, r types.Datum) (types.Datum, error) {
+		return arrayAppend(l.([]types.Datum), r, false)
+	})
+	addOperator("||", anyelement, anyarray, anyarray, func(l, r types.Datum) (types.Datum, error) {
+		return arrayAppend(r.([]types.Datum), l, true)
+	})
+}
@@ -0,0 +1,68 @@
+package adt
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rautNishan/diskquery/types"
+)
+
+// boolean accepts true/false, yes/no, on/off, 1/0 and unique prefixes of the words, any case
+func boolIn(str string, _ *Settings) (types.Datum, error) {
+	value := strings.ToLower(strings.TrimSpace(str))
+	switch value {
+	case "1", "on":
+		return true, nil
+	case "0", "off", "of":
+		return false, nil
+	}
+	if value != "" {
+		switch {
+		case strings.HasPrefix("true", value), strings.HasPrefix("yes", value):
+			return true, nil
+		case strings.HasPrefix("false", value), strings.HasPrefix("no", value):
+			return false, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid input syntax for type boolean: \"%s\"", str)
+}
+
+func boolOut(d types.Datum, _ *Settings) string {
+	if d.(bool) {
+		return "t"
+	}
+	return "f"
+}
+
+func boolRecv(buf []byte) (types.Datum, error) {
+	if len(buf) != 1 {
+		return nil, fmt.Errorf("invalid binary data for type boolean")
+	}
+	return buf[0] != 0, nil
+}
+
+func boolSend(d types.Datum) []byte {
+	if d.(bool) {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+// false sorts before true
+func boolCmp(a types.Datum, b types.Datum) int {
+	av, bv := a.(bool), b.(bool)
+	switch {
+	case av == bv:
+		return 0
+	case !av:
+		return -1
+	}
+	return 1
+}
+
+func hashBool(buf []byte, d types.Datum) []byte {
+	if d.(bool) {
+		return append(buf, 1)
+	}
+	return append(buf, 0)
+}
@@ -0,0 +1,248 @@
+package adt
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+Casts between types (postgres pg_cast)
+
+Each cast says in which context it may be applied:
+  - implicit casts are applied wherever a value of the source type meets one of the target type,
+    like an integer compared with a numeric
+  - assignment casts when a value is stored into a column of the target type
+  - explicit casts only when the query asks for the conversion, as in a typed literal or CAST
+
+Besides the casts in the table every type converts to text with its output function (an assignment cast)
+and from text with its input function (explicit), postgres calls these I/O conversions.
+An array converts to another array type in the context its element type converts in, element by element.
+A string literal of unknown type converts to any type through the type's input function
+*/
+
+type CoercionContext int
+
+const (
+	COERCION_IMPLICIT CoercionContext = iota
+	COERCION_ASSIGNMENT
+	COERCION_EXPLICIT
+)
+
+// CastFunc converts a value, settings are those of the session the cast runs in
+type CastFunc func(d types.Datum, settings *Settings) (types.Datum, error)
+
+type castEntry struct {
+	context CoercionContext
+	fn      CastFunc
+	stable  bool //The result depends on the session's settings
+}
+
+var castTable = map[[2]types.Oid]castEntry{}
+
+// addCast adds a cast whose result only depends on its argument (postgres' IMMUTABLE cast functions)
+func addCast(source types.Oid, target types.Oid, context CoercionContext, fn func(d types.Datum) (types.Datum, error)) {
+	castTable[[2]types.Oid{source, target}] = castEntry{
+		context: context,
+		fn: func(d types.Datum, _ *Settings) (types.Datum, error) {
+			return fn(d)
+		},
+	}
+}
+
+// addStableCast adds a cast whose result depends on the session's settings (STABLE in postgres)
+func addStableCast(source types.Oid, target types.Oid, context CoercionContext, fn CastFunc) {
+	castTable[[2]types.Oid{source, target}] = castEntry{context: context, fn: fn, stable: true}
+}
+
+func init() {
+	integers := []types.Oid{types.INT2OID, types.INT4OID, types.INT8OID}
+	for i, source := range integers {
+		for j, target := range integers {
+			switch {
+			case i < j:
+				addCast(source, target, COERCION_IMPLICIT, intWideningCast)
+			case i > j:
+				addCast(source, target, COERCION_ASSIGNMENT, intNarrowingCast(target))
+			}
+		}
+		addCast(source, types.FLOAT8OID, COERCION_IMPLICIT, intToFloat8)
+		addCast(types.FLOAT8OID, source, COERCION_ASSIGNMENT, float8ToIntCast(source))
+		addCast(source, types.NUMERICOID, COERCION_IMPLICIT, intToNumeric)
+		addCast(types.NUMERICOID, source, COERCION_ASSIGNMENT, numericToIntCast(source))
+	}
+	addCast(types.NUMERICOID, types.FLOAT8OID, COERCION_IMPLICIT, numericToFloat8)
+	addCast(types.FLOAT8OID, types.NUMERICOID, COERCION_ASSIGNMENT, float8ToNumeric)
+
+	addCast(types.INT4OID, types.BOOLOID, COERCION_EXPLICIT, intToBool)
+	addCast(types.BOOLOID, types.INT4OID, COERCION_EXPLICIT, boolToInt)
+
+	addCast(types.DATEOID, types.TIMESTAMPOID, COERCION_IMPLICIT, dateToTimestamp)
+	addCast(types.TIMESTAMPOID, types.DATEOID, COERCION_ASSIGNMENT, timestampToDate)
+
+	//Conversions to and from timestamptz happen in the session's time zone
+	addStableCast(types.DATEOID, types.TIMESTAMPTZOID, COERCION_IMPLICIT, dateToTimestampTz)
+	addStableCast(types.TIMESTAMPOID, types.TIMESTAMPTZOID, COERCION_IMPLICIT, timestampToTimestampTz)
+	addStableCast(types.TIMESTAMPTZOID, types.TIMESTAMPOID, COERCION_ASSIGNMENT, timestampTzToTimestamp)
+	addStableCast(types.TIMESTAMPTZOID, types.DATEOID, COERCION_ASSIGNMENT, timestampTzToDate)
+	addStableCast(types.TIMESTAMPTZOID, types.TIMEOID, COERCION_ASSIGNMENT, timestampTzToTime)
+	addCast(types.TIMESTAMPOID, types.TIMEOID, COERCION_ASSIGNMENT, timestampToTime)
+	addCast(types.TIMEOID, types.INTERVALOID, COERCION_IMPLICIT, timeToInterval)
+	addCast(types.INTERVALOID, types.TIMEOID, COERCION_ASSIGNMENT, intervalToTime)
+}
+
+/*
+FindCoercion returns the function converting values of type source to type target,
+false when no cast is allowed in ccontext
+*/
+func FindCoercion(source types.Oid, target types.Oid, ccontext CoercionContext) (CastFunc, bool) {
+	if source == target {
+		return identityCast, true
+	}
+	targetEntry := typeRegistry[target]
+	if targetEntry == nil {
+		return nil, false
+	}
+	if source == types.UNKNOWNOID && targetEntry.Input != nil {
+		return ioCastFrom(targetEntry), true
+	}
+	if cast, ok := castTable[[2]types.Oid{source, target}]; ok {
+		return cast.fn, cast.context <= ccontext
+	}
+	sourceEntry := typeRegistry[source]
+	if sourceEntry == nil {
+		return nil, false
+	}
+	switch {
+	case sourceEntry.Category == TYPCATEGORY_ARRAY && targetEntry.Category == TYPCATEGORY_ARRAY:
+		elemCast, ok := FindCoercion(sourceEntry.ElemType, targetEntry.ElemType, ccontext)
+		if !ok {
+			return nil, false
+		}
+		return arrayCoerce(elemCast), true
+	case targetEntry.Category == TYPCATEGORY_STRING && ccontext >= COERCION_ASSIGNMENT:
+		return ioCastTo, true
+	case sourceEntry.Category == TYPCATEGORY_STRING && ccontext == COERCION_EXPLICIT && targetEntry.Input != nil:
+		return ioCastFrom(targetEntry), true
+	}
+	return nil, false
+}
+
+/*
+CoercionIsStable tells if converting values of type source to target depends on the session's settings, the
+planner leaves such a conversion of a constant to the executor instead of doing it while it analyzes
+*/
+func CoercionIsStable(source types.Oid, target types.Oid) bool {
+	if source == target {
+		return false
+	}
+	if cast, ok := castTable[[2]types.Oid{source, target}]; ok {
+		return cast.stable
+	}
+	sourceEntry, targetEntry := typeRegistry[source], typeRegistry[target]
+	if sourceEntry == nil || targetEntry == nil {
+		return false
+	}
+	if sourceEntry.Category == TYPCATEGORY_ARRAY && targetEntry.Category == TYPCATEGORY_ARRAY {
+		return CoercionIsStable(sourceEntry.ElemType, targetEntry.ElemType)
+	}
+	//I/O conversions
+	return targetEntry.Category == TYPCATEGORY_STRING && sourceEntry.StableOutput ||
+		(source == types.UNKNOWNOID || sourceEntry.Category == TYPCATEGORY_STRING) && targetEntry.StableInput
+}
+
+// CanCoerce tells if a value of type source may be converted to target in ccontext
+func CanCoerce(source types.Oid, target types.Oid, ccontext CoercionContext) bool {
+	_, ok := FindCoercion(source, target, ccontext)
+	return ok
+}
+
+// CoerceDatum converts a non NULL datum of type source to type target, the planner checked the cast is allowed
+func CoerceDatum(d types.Datum, source types.Oid, target types.Oid, settings *Settings) (types.Datum, error) {
+	cast, ok := FindCoercion(source, target, COERCION_EXPLICIT)
+	if !ok {
+		return nil, fmt.Errorf("cannot cast type %s to %s", TypeName(source), TypeName(target))
+	}
+	return cast(d, settings)
+}
+
+func identityCast(d types.Datum, _ *Settings) (types.Datum, error) {
+	return d, nil
+}
+
+func ioCastTo(d types.Datum, settings *Settings) (types.Datum, error) {
+	return OutputDatum(d, settings), nil
+}
+
+func ioCastFrom(target *TypeEntry) CastFunc {
+	return func(d types.Datum, settings *Settings) (types.Datum, error) {
+		return target.Input(d.(string), settings)
+	}
+}
+
+// All integers are int64 datums, a wider type holds the value as it is
+func intWideningCast(d types.Datum) (types.Datum, error) {
+	return d, nil
+}
+
+func intNarrowingCast(target types.Oid) func(d types.Datum) (types.Datum, error) {
+	return func(d types.Datum) (types.Datum, error) {
+		return intRangeCheck(d.(int64), target)
+	}
+}
+
+func intToFloat8(d types.Datum) (types.Datum, error) {
+	return float64(d.(int64)), nil
+}
+
+// Doubles round to the nearest integer, halves to even (rint)
+func float8ToIntCast(target types.Oid) func(d types.Datum) (types.Datum, error) {
+	return func(d types.Datum) (types.Datum, error) {
+		rounded := math.RoundToEven(d.(float64))
+		if math.IsNaN(rounded) || rounded < math.MinInt64 || rounded >= math.MaxInt64 {
+			return nil, fmt.Errorf("%s out of range", TypeName(target))
+		}
+		return intRangeCheck(int64(rounded), target)
+	}
+}
+
+func intToNumeric(d types.Datum) (types.Datum, error) {
+	return NumericFromInt64(d.(int64)), nil
+}
+
+func numericToIntCast(target types.Oid) func(d types.Datum) (types.Datum, error) {
+	return func(d types.Datum) (types.Datum, error) {
+		n := d.(Numeric)
+		switch n.kind {
+		case numericNaN:
+			return nil, fmt.Errorf("cannot convert NaN to %s", TypeName(target))
+		case numericPInf, numericNInf:
+			return nil, fmt.Errorf("cannot convert infinity to %s", TypeName(target))
+		}
+		value, err := n.Int64()
+		if err != nil {
+			return nil, fmt.Errorf("%s out of range", TypeName(target))
+		}
+		return intRangeCheck(value, target)
+	}
+}
+
+func numericToFloat8(d types.Datum) (types.Datum, error) {
+	return d.(Numeric).Float64(), nil
+}
+
+func float8ToNumeric(d types.Datum) (types.Datum, error) {
+	return NumericFromFloat64(d.(float64)), nil
+}
+
+func intToBool(d types.Datum) (types.Datum, error) {
+	return d.(int64) != 0, nil
+}
+
+func boolToInt(d types.Datum) (types.Datum, error) {
+	if d.(bool) {
+		return int64(1), nil
+	}
+	return int64(0), nil
+}
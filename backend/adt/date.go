@@ -0,0 +1,226 @@
+package adt
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+date and time (postgres utils/adt/date.c)
+
+A Date counts days from 2000-01-01, a TimeOfDay microseconds from midnight (24:00:00 is a valid time,
+the end of a day). Neither has a zone
+*/
+
+type Date int32
+type TimeOfDay int64
+
+var errDateOutOfRange = fmt.Errorf("date out of range")
+
+func DateFromTime(t time.Time) Date {
+	return Date(floorDiv(t.Unix()-POSTGRES_EPOCH, SECS_PER_DAY))
+}
+
+func (d Date) Time() time.Time {
+	return time.Unix(POSTGRES_EPOCH+int64(d)*SECS_PER_DAY, 0).UTC()
+}
+
+// Timestamp of midnight at the start of the day
+func (d Date) Timestamp() Timestamp {
+	switch d {
+	case DATEVAL_NOBEGIN:
+		return TIMESTAMP_NOBEGIN
+	case DATEVAL_NOEND:
+		return TIMESTAMP_NOEND
+	}
+	return Timestamp(int64(d) * USECS_PER_DAY)
+}
+
+func (d Date) IsFinite() bool {
+	return d != DATEVAL_NOBEGIN && d != DATEVAL_NOEND
+}
+
+// currentDate is today in the session's time zone
+func currentDate(now time.Time, settings *Settings) Date {
+	y, m, d := now.In(settings.TimeZone).Date()
+	return DateFromTime(time.Date(y, m, d, 0, 0, 0, 0, time.UTC))
+}
+
+func dateIn(str string, settings *Settings) (types.Datum, error) {
+	fields, err := decodeDateTime(str, "date")
+	if err != nil {
+		return nil, err
+	}
+	switch fields.special {
+	case dtEpoch:
+		return DateFromTime(time.Unix(0, 0)), nil
+	case dtLate:
+		return DATEVAL_NOEND, nil
+	case dtEarly:
+		return DATEVAL_NOBEGIN, nil
+	case dtNow, dtToday:
+		return currentDate(time.Now(), settings), nil
+	case dtTomorrow:
+		return currentDate(time.Now(), settings) + 1, nil
+	case dtYesterday:
+		return currentDate(time.Now(), settings) - 1, nil
+	}
+	if !fields.hasDate {
+		return nil, fmt.Errorf("invalid input syntax for type date: \"%s\"", str)
+	}
+	return DateFromTime(time.Date(fields.year, time.Month(fields.month), fields.day, 0, 0, 0, 0, time.UTC)), nil
+}
+
+func dateOut(d types.Datum, _ *Settings) string {
+	switch date := d.(Date); date {
+	case DATEVAL_NOBEGIN:
+		return "-infinity"
+	case DATEVAL_NOEND:
+		return "infinity"
+	default:
+		t := date.Time()
+		return string(appendEra(appendDate(nil, t), t))
+	}
+}
+
+func dateRecv(buf []byte) (types.Datum, error) {
+	if len(buf) != 4 {
+		return nil, fmt.Errorf("invalid binary data for type date")
+	}
+	return Date(int32(binary.BigEndian.Uint32(buf))), nil
+}
+
+func dateSend(d types.Datum) []byte {
+	return binary.BigEndian.AppendUint32(nil, uint32(d.(Date)))
+}
+
+func dateCmp(a types.Datum, b types.Datum) int {
+	return compareOrdered(int32(a.(Date)), int32(b.(Date)))
+}
+
+func hashDate(buf []byte, d types.Datum) []byte {
+	return binary.BigEndian.AppendUint32(buf, uint32(d.(Date)))
+}
+
+// checkDate makes sure a computed day number is a date we can print, infinite dates stay as they are
+func checkDate(days int64) (Date, error) {
+	if days < int64(DateFromTime(minDateTime)) ||
+		days > int64(DateFromTime(time.Date(maxDateYear, 12, 31, 0, 0, 0, 0, time.UTC))) {
+		return 0, errDateOutOfRange
+	}
+	return Date(days), nil
+}
+
+// dateAddDays is date + integer and date - integer
+func dateAddDays(d Date, days int64) (types.Datum, error) {
+	if !d.IsFinite() {
+		return d, nil
+	}
+	if days > maxDateYear*366 || days < -maxDateYear*366 {
+		return nil, errDateOutOfRange
+	}
+	return checkDate(int64(d) + days)
+}
+
+// dateMi is date - date, the number of days between them
+func dateMi(a Date, b Date) (types.Datum, error) {
+	if !a.IsFinite() || !b.IsFinite() {
+		return nil, fmt.Errorf("cannot subtract infinite dates")
+	}
+	return int64(a) - int64(b), nil
+}
+
+// datetimePl is date + time
+func datetimePl(d Date, t TimeOfDay) (types.Datum, error) {
+	ts := d.Timestamp()
+	if !d.IsFinite() {
+		return ts, nil
+	}
+	return checkTimestamp(int64(ts) + int64(t))
+}
+
+func timeIn(str string, settings *Settings) (types.Datum, error) {
+	fields, err := decodeDateTime(str, "time")
+	if err != nil {
+		return nil, err
+	}
+	switch fields.special {
+	case dtNow:
+		return timestampTime(localTimestamp(time.Now(), settings)), nil
+	case dtAllBalls:
+		return TimeOfDay(0), nil
+	case dtNone:
+		if fields.hasTime {
+			return TimeOfDay(fields.usecs), nil
+		}
+	}
+	return nil, fmt.Errorf("invalid input syntax for type time: \"%s\"", str)
+}
+
+func timeOut(d types.Datum, _ *Settings) string {
+	t := int64(d.(TimeOfDay))
+	secs := t / USECS_PER_SEC
+	buf := fmt.Appendf(nil, "%02d:%02d:", secs/3600, secs/60%60)
+	return string(appendSeconds(buf, secs%60, t%USECS_PER_SEC))
+}
+
+func timeRecv(buf []byte) (types.Datum, error) {
+	if len(buf) != 8 {
+		return nil, fmt.Errorf("invalid binary data for type time")
+	}
+	t := int64(binary.BigEndian.Uint64(buf))
+	if t < 0 || t > USECS_PER_DAY {
+		return nil, fmt.Errorf("time out of range")
+	}
+	return TimeOfDay(t), nil
+}
+
+func timeSend(d types.Datum) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(d.(TimeOfDay)))
+}
+
+func timeCmp(a types.Datum, b types.Datum) int {
+	return compareOrdered(int64(a.(TimeOfDay)), int64(b.(TimeOfDay)))
+}
+
+func hashTime(buf []byte, d types.Datum) []byte {
+	return binary.BigEndian.AppendUint64(buf, uint64(d.(TimeOfDay)))
+}
+
+func applyTimeTypmod(d types.Datum, typmod int32) (types.Datum, error) {
+	return TimeOfDay(roundToPrecision(int64(d.(TimeOfDay)), typmod)), nil
+}
+
+// timePlInterval is time + interval, only the interval's time counts and the result wraps around midnight
+func timePlInterval(t TimeOfDay, iv Interval) TimeOfDay {
+	result := (int64(t) + iv.Time) % USECS_PER_DAY
+	if result < 0 {
+		result += USECS_PER_DAY
+	}
+	return TimeOfDay(result)
+}
+
+func timeMi(a TimeOfDay, b TimeOfDay) Interval {
+	return Interval{Time: int64(a) - int64(b)}
+}
+
+func timeToInterval(d types.Datum) (types.Datum, error) {
+	return Interval{Time: int64(d.(TimeOfDay))}, nil
+}
+
+// An interval converts to the time of day it reaches from midnight, whole days dropped
+func intervalToTime(d types.Datum) (types.Datum, error) {
+	return timePlInterval(0, d.(Interval)), nil
+}
+
+func dateToTimestamp(d types.Datum) (types.Datum, error) {
+	return d.(Date).Timestamp(), nil
+}
+
+// A date converts to midnight of that day in the session's time zone
+func dateToTimestampTz(d types.Datum, settings *Settings) (types.Datum, error) {
+	return timestampToTimestampTzIn(d.(Date).Timestamp(), settings.TimeZone)
+}
@@ -0,0 +1,580 @@
+package adt
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" //Zone rules are compiled in, the host's zoneinfo is not needed
+
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+Date and time support shared by date, time, timestamp, timestamptz and interval (postgres utils/adt/datetime.c)
+
+Dates and timestamps count from the postgres epoch 2000-01-01: a Date in days, a Timestamp and a
+TimestampTz in microseconds. A Timestamp is what a wall clock reads, without a zone. A TimestampTz is a
+point in time, kept in UTC and shown in the session's TimeZone.
+Values are read and printed in the ISO 8601 form, 2024-03-01 13:45:00.25+01 (a T between date and time
+is accepted too). Calendar arithmetic is left to package time, zone rules come from its zone database
+*/
+
+const (
+	USECS_PER_SEC        int64 = 1000000
+	USECS_PER_MINUTE     int64 = 60 * USECS_PER_SEC
+	USECS_PER_HOUR       int64 = 60 * USECS_PER_MINUTE
+	USECS_PER_DAY        int64 = 24 * USECS_PER_HOUR
+	SECS_PER_DAY         int64 = 86400
+	DAYS_PER_MONTH       int64 = 30 //What an interval's month is worth when compared with days
+	MONTHS_PER_YEAR      int64 = 12
+	POSTGRES_EPOCH       int64 = 946684800 //2000-01-01 in Unix seconds
+	POSTGRES_EPOCH_JDATE int64 = 2451545   //2000-01-01 as a Julian day number
+
+	MAX_TIMESTAMP_PRECISION = 6
+
+	maxDateYear = 294276 //Last year a timestamp can hold, dates stop there too
+)
+
+// The first day of dates and timestamps is Julian day 0, 4714-11-24 BC (the year -4713 of package time)
+var minDateTime = time.Date(-4713, time.November, 24, 0, 0, 0, 0, time.UTC)
+
+// Infinite dates and timestamps are the ends of their ranges, so they sort before and after every other value
+const (
+	DATEVAL_NOBEGIN     Date        = math.MinInt32
+	DATEVAL_NOEND       Date        = math.MaxInt32
+	TIMESTAMP_NOBEGIN   Timestamp   = math.MinInt64
+	TIMESTAMP_NOEND     Timestamp   = math.MaxInt64
+	TIMESTAMPTZ_NOBEGIN TimestampTz = math.MinInt64
+	TIMESTAMPTZ_NOEND   TimestampTz = math.MaxInt64
+)
+
+// Interval output styles, the IntervalStyle setting
+const (
+	INTSTYLE_POSTGRES = iota
+	INTSTYLE_ISO_8601
+)
+
+/*
+Settings are the settings of a session the functions of the types follow, postgres reads them from the GUC
+variables of its backend. A session has its own, they are handed down to whatever converts or computes values
+in its queries. The values in files (relation files, indexes, spilled tuples) are read and written with
+DefaultSettings, so what they mean does not depend on the session
+*/
+type Settings struct {
+	TimeZone      *time.Location //timestamptz values are shown and split into fields in it
+	IntervalStyle int
+}
+
+var DefaultSettings = Settings{TimeZone: time.UTC, IntervalStyle: INTSTYLE_POSTGRES}
+
+// ParseIntervalStyle checks an IntervalStyle setting, it returns the style and its name as SHOW prints it
+func ParseIntervalStyle(name string) (int, string, error) {
+	switch strings.ToLower(name) {
+	case "postgres":
+		return INTSTYLE_POSTGRES, "postgres", nil
+	case "iso_8601":
+		return INTSTYLE_ISO_8601, "iso_8601", nil
+	}
+	return 0, "", fmt.Errorf("invalid value for parameter \"IntervalStyle\": \"%s\"", name)
+}
+
+/*
+LoadTimeZone finds a zone by name, as in AT TIME ZONE and SET TIME ZONE
+Besides the names of the zone database (Europe/Berlin, UTC) it takes a fixed offset like +05:30.
+Offsets are ISO 8601, positive east of Greenwich (postgres reads a bare offset the POSIX way, west positive)
+*/
+func LoadTimeZone(name string) (*time.Location, error) {
+	name = strings.TrimSpace(name)
+	switch strings.ToLower(name) {
+	case "utc", "z", "gmt", "zulu":
+		return time.UTC, nil
+	}
+	if name != "" && (name[0] == '+' || name[0] == '-') {
+		if offset, ok := parseZoneOffset(name); ok {
+			return time.FixedZone(name, offset), nil
+		}
+	} else if name != "" && !strings.Contains(name, "..") {
+		if loc, err := time.LoadLocation(name); err == nil {
+			return loc, nil
+		}
+	}
+	return nil, fmt.Errorf("time zone \"%s\" not recognized", name)
+}
+
+// parseZoneOffset reads +HH, +HHMM, +HH:MM or +HH:MM:SS as seconds east of Greenwich
+func parseZoneOffset(str string) (int, bool) {
+	sign := 1
+	if str[0] == '-' {
+		sign = -1
+	}
+	digits := str[1:]
+	var parts []string
+	switch {
+	case strings.Contains(digits, ":"):
+		parts = strings.Split(digits, ":")
+	case len(digits) == 4:
+		parts = []string{digits[:2], digits[2:]}
+	default:
+		parts = []string{digits}
+	}
+	if len(parts) > 3 {
+		return 0, false
+	}
+	offset := 0
+	for i, part := range parts {
+		if part == "" || len(part) > 2 {
+			return 0, false
+		}
+		value, err := strconv.Atoi(part)
+		if err != nil || value < 0 || (i > 0 && value > 59) {
+			return 0, false
+		}
+		offset += value * [...]int{3600, 60, 1}[i]
+	}
+	if offset > 15*3600+59*60 {
+		return 0, false
+	}
+	return sign * offset, true
+}
+
+// Special inputs, words that stand for a date or time (postgres DTK_EPOCH, DTK_LATE, ...)
+const (
+	dtNone = iota
+	dtEpoch
+	dtLate  //infinity
+	dtEarly //-infinity
+	dtNow
+	dtToday
+	dtTomorrow
+	dtYesterday
+	dtAllBalls //Midnight, for time
+)
+
+var dateTimeSpecials = map[string]int{
+	"epoch":     dtEpoch,
+	"infinity":  dtLate,
+	"+infinity": dtLate,
+	"-infinity": dtEarly,
+	"now":       dtNow,
+	"today":     dtToday,
+	"tomorrow":  dtTomorrow,
+	"yesterday": dtYesterday,
+	"allballs":  dtAllBalls,
+}
+
+// dateTimeFields is a date/time input split into its parts (postgres DecodeDateTime fills a pg_tm)
+type dateTimeFields struct {
+	special int
+	year    int //Year 0 is 1 BC
+	month   int
+	day     int
+	hasDate bool
+	usecs   int64 //Time of day
+	hasTime bool
+	zone    *time.Location //Zone written in the input, nil if none
+	bc      bool           //The input ends in BC
+}
+
+/*
+decodeDateTime splits a date/time input: YYYY-MM-DD, then optionally HH:MM[:SS[.fraction]] after a space or
+a T, then optionally a zone (Z, +HH[:MM] or a zone name), then optionally the era, AD or BC. A time of day can
+also stand on its own
+*/
+func decodeDateTime(str string, typeName string) (dateTimeFields, error) {
+	var fields dateTimeFields
+	syntaxError := fmt.Errorf("invalid input syntax for type %s: \"%s\"", typeName, str)
+	value := strings.TrimSpace(str)
+	if special, ok := dateTimeSpecials[strings.ToLower(value)]; ok {
+		fields.special = special
+		return fields, nil
+	}
+	if space := strings.LastIndexAny(value, " \t"); space >= 0 {
+		switch strings.ToLower(value[space+1:]) {
+		case "bc":
+			fields.bc = true
+			fallthrough
+		case "ad":
+			value = strings.TrimSpace(value[:space])
+		}
+	}
+
+	if isDateStart(value) {
+		rest, err := decodeDate(value, str, typeName, &fields)
+		if err != nil {
+			return fields, err
+		}
+		value = rest
+		if value != "" {
+			if value[0] != ' ' && value[0] != 'T' && value[0] != 't' {
+				return fields, syntaxError
+			}
+			value = strings.TrimSpace(value[1:])
+		}
+	}
+	if value != "" && value[0] >= '0' && value[0] <= '9' {
+		rest, err := decodeTime(value, str, typeName, &fields)
+		if err != nil {
+			return fields, err
+		}
+		value = strings.TrimSpace(rest)
+	}
+	if value != "" {
+		if !fields.hasDate && !fields.hasTime {
+			return fields, syntaxError
+		}
+		loc, err := LoadTimeZone(value)
+		if err != nil {
+			if value[0] == '+' || value[0] == '-' {
+				return fields, syntaxError
+			}
+			return fields, err
+		}
+		fields.zone = loc
+	}
+	if !fields.hasDate && !fields.hasTime {
+		return fields, syntaxError
+	}
+	if fields.bc && !fields.hasDate {
+		return fields, syntaxError
+	}
+	return fields, nil
+}
+
+// A date starts with its year and a dash
+func isDateStart(value string) bool {
+	end := 0
+	for end < len(value) && value[end] >= '0' && value[end] <= '9' {
+		end++
+	}
+	return end > 0 && end < len(value) && value[end] == '-'
+}
+
+// decodeDate reads YYYY-MM-DD from the start of value and returns the rest
+func decodeDate(value string, str string, typeName string, fields *dateTimeFields) (string, error) {
+	syntaxError := fmt.Errorf("invalid input syntax for type %s: \"%s\"", typeName, str)
+	var parts [3]int
+	for i := range parts {
+		end := 0
+		for end < len(value) && value[end] >= '0' && value[end] <= '9' {
+			end++
+		}
+		if end == 0 || end > 7 {
+			return "", syntaxError
+		}
+		parts[i], _ = strconv.Atoi(value[:end])
+		value = value[end:]
+		if i < 2 {
+			if !strings.HasPrefix(value, "-") {
+				return "", syntaxError
+			}
+			value = value[1:]
+		}
+	}
+
+	//Year 1 BC is the year 0 of package time, 2 BC is -1
+	year, month, day := parts[0], parts[1], parts[2]
+	if fields.bc {
+		year = 1 - year
+	}
+	if parts[0] < 1 || month < 1 || month > 12 || day < 1 || day > daysInMonth(year, time.Month(month)) {
+		return "", fmt.Errorf("date/time field value out of range: \"%s\"", str)
+	}
+	if year > maxDateYear || time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC).Before(minDateTime) {
+		return "", fmt.Errorf("%s out of range: \"%s\"", typeName, str)
+	}
+	fields.year, fields.month, fields.day, fields.hasDate = year, month, day, true
+	return value, nil
+}
+
+// decodeTime reads HH:MM[:SS[.fraction]] from the start of value and returns the rest
+func decodeTime(value string, str string, typeName string, fields *dateTimeFields) (string, error) {
+	syntaxError := fmt.Errorf("invalid input syntax for type %s: \"%s\"", typeName, str)
+	var hms [3]int64
+	n := 0
+	for n < 3 {
+		end := 0
+		for end < len(value) && value[end] >= '0' && value[end] <= '9' {
+			end++
+		}
+		if end == 0 || end > 2 {
+			return "", syntaxError
+		}
+		hms[n], _ = strconv.ParseInt(value[:end], 10, 64)
+		value = value[end:]
+		n++
+		if n == 3 || !strings.HasPrefix(value, ":") {
+			break
+		}
+		value = value[1:]
+	}
+	if n < 2 {
+		return "", syntaxError
+	}
+
+	usecs := int64(0)
+	if n == 3 && strings.HasPrefix(value, ".") {
+		end := 1
+		for end < len(value) && value[end] >= '0' && value[end] <= '9' {
+			end++
+		}
+		fraction := value[1:end]
+		value = value[end:]
+		if fraction == "" {
+			return "", syntaxError
+		}
+		usecs = parseFraction(fraction)
+	}
+	if hms[1] > 59 || hms[2] > 59 || hms[0] > 24 || (hms[0] == 24 && (hms[1] != 0 || hms[2] != 0 || usecs != 0)) {
+		return "", fmt.Errorf("date/time field value out of range: \"%s\"", str)
+	}
+	fields.usecs = hms[0]*USECS_PER_HOUR + hms[1]*USECS_PER_MINUTE + hms[2]*USECS_PER_SEC + usecs
+	fields.hasTime = true
+	return value, nil
+}
+
+// parseFraction turns the digits after a decimal point into microseconds, a seventh digit rounds
+func parseFraction(fraction string) int64 {
+	digits := (fraction + "000000")[:6]
+	usecs, _ := strconv.ParseInt(digits, 10, 64)
+	if len(fraction) > 6 && fraction[6] >= '5' {
+		usecs++
+	}
+	return usecs
+}
+
+func isLeapYear(year int) bool {
+	return year%4 == 0 && (year%100 != 0 || year%400 == 0)
+}
+
+func daysInMonth(year int, month time.Month) int {
+	switch month {
+	case time.February:
+		if isLeapYear(year) {
+			return 29
+		}
+		return 28
+	case time.April, time.June, time.September, time.November:
+		return 30
+	}
+	return 31
+}
+
+func floorDiv(a int64, b int64) int64 {
+	q := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		q--
+	}
+	return q
+}
+
+// appendSeconds prints seconds and microseconds as SS[.ffffff], without trailing zeros in the fraction
+func appendSeconds(buf []byte, secs int64, usecs int64) []byte {
+	buf = fmt.Appendf(buf, "%02d", secs)
+	if usecs != 0 {
+		buf = append(buf, strings.TrimRight(fmt.Sprintf(".%06d", usecs), "0")...)
+	}
+	return buf
+}
+
+/*
+Units of EXTRACT, date_part and date_trunc with the spellings postgres accepts for them
+(postgres datetktbl and deltatktbl), interval input uses the same table
+*/
+var dateTimeUnits = map[string]string{
+	"microseconds": "microseconds", "microsecond": "microseconds", "us": "microseconds", "usec": "microseconds", "usecs": "microseconds",
+	"milliseconds": "milliseconds", "millisecond": "milliseconds", "ms": "milliseconds", "msec": "milliseconds", "msecs": "milliseconds",
+	"second": "second", "seconds": "second", "sec": "second", "secs": "second", "s": "second",
+	"minute": "minute", "minutes": "minute", "min": "minute", "mins": "minute", "m": "minute",
+	"hour": "hour", "hours": "hour", "hr": "hour", "hrs": "hour", "h": "hour",
+	"day": "day", "days": "day", "d": "day",
+	"week": "week", "weeks": "week", "w": "week",
+	"month": "month", "months": "month", "mon": "month", "mons": "month",
+	"quarter": "quarter", "qtr": "quarter",
+	"year": "year", "years": "year", "y": "year", "yr": "year", "yrs": "year",
+	"decade": "decade", "decades": "decade", "dec": "decade",
+	"century": "century", "centuries": "century", "cent": "century", "c": "century",
+	"millennium": "millennium", "millennia": "millennium", "millenniums": "millennium", "mil": "millennium", "mils": "millennium",
+	"dow": "dow", "isodow": "isodow", "doy": "doy", "isoyear": "isoyear",
+	"epoch": "epoch", "julian": "julian", "j": "julian",
+	"timezone": "timezone", "timezone_hour": "timezone_hour", "timezone_minute": "timezone_minute",
+}
+
+func decodeUnit(unit string) (string, bool) {
+	canonical, ok := dateTimeUnits[strings.ToLower(strings.TrimSpace(unit))]
+	return canonical, ok
+}
+
+func unitNotRecognized(unit string, typ types.Oid) error {
+	return fmt.Errorf("unit \"%s\" not recognized for type %s", unit, TypeName(typ))
+}
+
+func unitNotSupported(unit string, typ types.Oid) error {
+	return fmt.Errorf("unit \"%s\" not supported for type %s", unit, TypeName(typ))
+}
+
+// numericScaled is value / 10^scale as a numeric, EXTRACT gives its fractional fields this way
+func numericScaled(value int64, scale int32) Numeric {
+	return Numeric{coef: big.NewInt(value), scale: scale}
+}
+
+/*
+extractFields is EXTRACT of a unit from a date or timestamp broken into fields in its zone (t),
+epochUsecs is the value in microseconds since 1970-01-01. Dates have no time of day, only
+timestamptz has a zone
+*/
+func extractFields(unit string, t time.Time, epochUsecs int64, typ types.Oid) (Numeric, error) {
+	hasTime := typ != types.DATEOID
+	hasZone := typ == types.TIMESTAMPTZOID
+	year := int64(t.Year()) //0 is 1 BC, EXTRACT counts it as -1
+	secUsecs := int64(t.Second())*USECS_PER_SEC + int64(t.Nanosecond()/1000)
+
+	switch unit {
+	case "day":
+		return NumericFromInt64(int64(t.Day())), nil
+	case "month":
+		return NumericFromInt64(int64(t.Month())), nil
+	case "year":
+		if year <= 0 {
+			return NumericFromInt64(year - 1), nil
+		}
+		return NumericFromInt64(year), nil
+	case "quarter":
+		return NumericFromInt64((int64(t.Month())-1)/3 + 1), nil
+	case "week":
+		_, week := t.ISOWeek()
+		return NumericFromInt64(int64(week)), nil
+	case "isoyear":
+		isoYear, _ := t.ISOWeek()
+		return NumericFromInt64(int64(isoYear)), nil
+	case "dow":
+		return NumericFromInt64(int64(t.Weekday())), nil
+	case "isodow":
+		return NumericFromInt64((int64(t.Weekday())+6)%7 + 1), nil
+	case "doy":
+		return NumericFromInt64(int64(t.YearDay())), nil
+	case "decade":
+		return NumericFromInt64(floorDiv(year, 10)), nil
+	case "century":
+		if year <= 0 {
+			return NumericFromInt64(-((100 - year) / 100)), nil
+		}
+		return NumericFromInt64((year + 99) / 100), nil
+	case "millennium":
+		if year <= 0 {
+			return NumericFromInt64(-((1000 - year) / 1000)), nil
+		}
+		return NumericFromInt64((year + 999) / 1000), nil
+	case "julian":
+		y, m, d := t.Date()
+		jdate := DateFromTime(time.Date(y, m, d, 0, 0, 0, 0, time.UTC))
+		julian := NumericFromInt64(int64(jdate) + POSTGRES_EPOCH_JDATE)
+		if !hasTime {
+			return julian, nil
+		}
+		clock := int64(t.Hour())*USECS_PER_HOUR + int64(t.Minute())*USECS_PER_MINUTE + secUsecs
+		fraction, err := NumericFromInt64(clock).Div(NumericFromInt64(USECS_PER_DAY))
+		if err != nil {
+			return Numeric{}, err
+		}
+		return julian.Add(fraction)
+	case "epoch":
+		if !hasTime {
+			return NumericFromInt64(epochUsecs / USECS_PER_SEC), nil
+		}
+		return numericScaled(epochUsecs, 6), nil
+	}
+
+	if !hasTime {
+		return Numeric{}, unitNotSupported(unit, typ)
+	}
+	switch unit {
+	case "microseconds":
+		return NumericFromInt64(secUsecs), nil
+	case "milliseconds":
+		return numericScaled(secUsecs, 3), nil
+	case "second":
+		return numericScaled(secUsecs, 6), nil
+	case "minute":
+		return NumericFromInt64(int64(t.Minute())), nil
+	case "hour":
+		return NumericFromInt64(int64(t.Hour())), nil
+	}
+
+	if !hasZone {
+		return Numeric{}, unitNotSupported(unit, typ)
+	}
+	_, offset := t.Zone()
+	switch unit {
+	case "timezone":
+		return NumericFromInt64(int64(offset)), nil
+	case "timezone_hour":
+		return NumericFromInt64(int64(offset / 3600)), nil
+	case "timezone_minute":
+		return NumericFromInt64(int64(offset / 60 % 60)), nil
+	}
+	return Numeric{}, unitNotSupported(unit, typ)
+}
+
+/*
+extractInfinite is EXTRACT from an infinite date or timestamp: fields that keep growing
+are infinite too, the others are NULL (ok is false then)
+*/
+func extractInfinite(unit string, negative bool) (Numeric, bool) {
+	switch unit {
+	case "epoch", "julian", "year", "isoyear", "decade", "century", "millennium":
+		if negative {
+			return numericInf(-1), true
+		}
+		return numericInf(1), true
+	}
+	return Numeric{}, false
+}
+
+/*
+truncFields is date_trunc on a timestamp broken into fields: everything smaller than the unit is reset,
+weeks start on Monday, centuries and millennia on their year 1 (2001 for the 21st century)
+*/
+func truncFields(unit string, t time.Time, typ types.Oid) (time.Time, error) {
+	y, m, d := t.Date()
+	h, mi, s := t.Clock()
+	ns := t.Nanosecond()
+
+	switch unit {
+	case "microseconds":
+		ns = ns / 1000 * 1000
+	case "milliseconds":
+		ns = ns / 1000000 * 1000000
+	case "second":
+		ns = 0
+	case "minute":
+		s, ns = 0, 0
+	case "hour":
+		mi, s, ns = 0, 0, 0
+	case "day":
+		h, mi, s, ns = 0, 0, 0, 0
+	case "week":
+		d -= (int(t.Weekday()) + 6) % 7
+		h, mi, s, ns = 0, 0, 0, 0
+	case "month":
+		d, h, mi, s, ns = 1, 0, 0, 0, 0
+	case "quarter":
+		m = 3*((m-1)/3) + 1
+		d, h, mi, s, ns = 1, 0, 0, 0, 0
+	case "year", "decade", "century", "millennium":
+		switch unit {
+		case "decade":
+			y = int(floorDiv(int64(y), 10) * 10)
+		case "century":
+			y = int(floorDiv(int64(y)+99, 100)*100 - 99)
+		case "millennium":
+			y = int(floorDiv(int64(y)+999, 1000)*1000 - 999)
+		}
+		m, d, h, mi, s, ns = 1, 1, 0, 0, 0, 0
+	default:
+		return time.Time{}, unitNotSupported(unit, typ)
+	}
+	return zoneTime(y, m, d, h, mi, s, ns, t.Location()), nil
+}
@@ -0,0 +1,159 @@
+package adt
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+double precision
+NaN is equal to itself and sorts after every other value (postgres float8_cmp_internal),
+-0 and 0 are equal so they hash the same
+*/
+
+func float8In(str string, _ *Settings) (types.Datum, error) {
+	value := strings.TrimSpace(str)
+	switch strings.ToLower(value) {
+	case "nan":
+		return math.NaN(), nil
+	case "infinity", "+infinity", "inf", "+inf":
+		return math.Inf(1), nil
+	case "-infinity", "-inf":
+		return math.Inf(-1), nil
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		if numErr, ok := err.(*strconv.NumError); ok && numErr.Err == strconv.ErrRange {
+			return nil, fmt.Errorf("\"%s\" is out of range for type double precision", str)
+		}
+		return nil, fmt.Errorf("invalid input syntax for type double precision: \"%s\"", str)
+	}
+	return f, nil
+}
+
+func float8Out(d types.Datum, _ *Settings) string {
+	return formatFloat8(d.(float64))
+}
+
+/*
+formatFloat8 writes the shortest digits that read back as f, like postgres float8out with the default
+extra_float_digits. The exponent form is only used below 1e-4 and from 1e15 on, with at least two exponent
+digits (1e-05, 1.5e+15)
+*/
+func formatFloat8(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	}
+	if abs := math.Abs(f); abs != 0 && (abs < 1e-4 || abs >= 1e15) {
+		return strconv.FormatFloat(f, 'e', -1, 64)
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func float8Recv(buf []byte) (types.Datum, error) {
+	if len(buf) != 8 {
+		return nil, fmt.Errorf("invalid binary data for type double precision")
+	}
+	return math.Float64frombits(binary.BigEndian.Uint64(buf)), nil
+}
+
+func float8Send(d types.Datum) []byte {
+	return binary.BigEndian.AppendUint64(nil, math.Float64bits(d.(float64)))
+}
+
+func float8Cmp(a types.Datum, b types.Datum) int {
+	return compareFloat8(a.(float64), b.(float64))
+}
+
+func compareFloat8(a float64, b float64) int {
+	switch aNaN, bNaN := math.IsNaN(a), math.IsNaN(b); {
+	case aNaN && bNaN:
+		return 0
+	case aNaN:
+		return 1
+	case bNaN:
+		return -1
+	}
+	return compareOrdered(a, b)
+}
+
+func hashFloat8(buf []byte, d types.Datum) []byte {
+	f := d.(float64)
+	switch {
+	case f == 0:
+		f = 0
+	case math.IsNaN(f):
+		f = math.NaN()
+	}
+	return binary.BigEndian.AppendUint64(buf, math.Float64bits(f))
+}
+
+/*
+Float8Pow is x ^ y for double precision (postgres dpow). The cases without a real result are errors,
+so is a finite result that does not fit
+*/
+func Float8Pow(x float64, y float64) (float64, error) {
+	switch {
+	case x == 0 && y < 0:
+		return 0, fmt.Errorf("zero raised to a negative power is undefined")
+	case x < 0 && !math.IsInf(x, 0) && y != math.Trunc(y) && !math.IsInf(y, 0):
+		return 0, fmt.Errorf("a negative number raised to a non-integer power yields a complex result")
+	}
+	result := math.Pow(x, y)
+	if math.IsInf(result, 0) && !math.IsInf(x, 0) && !math.IsInf(y, 0) {
+		return 0, fmt.Errorf("value out of range: overflow")
+	}
+	return result, nil
+}
+
+func init() {
+	const (
+		float8 = types.FLOAT8OID
+	)
+
+	unary := func(fn func(float64) float64) func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		return func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+			return fn(fcinfo.Args[0].(float64)), nil
+		}
+	}
+	addFunction("abs", []types.Oid{float8}, float8, unary(math.Abs))
+	//round of a double precision is rint, halves go to the even neighbour
+	addFunction("round", []types.Oid{float8}, float8, unary(math.RoundToEven))
+	addFunction("trunc", []types.Oid{float8}, float8, unary(math.Trunc))
+	addFunction("ceil", []types.Oid{float8}, float8, unary(math.Ceil))
+	addFunction("ceiling", []types.Oid{float8}, float8, unary(math.Ceil))
+	addFunction("floor", []types.Oid{float8}, float8, unary(math.Floor))
+	addFunction("sqrt", []types.Oid{float8}, float8, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		x := fcinfo.Args[0].(float64)
+		if x < 0 {
+			return nil, fmt.Errorf("cannot take square root of a negative number")
+		}
+		return math.Sqrt(x), nil
+	})
+
+	power := func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		result, err := Float8Pow(fcinfo.Args[0].(float64), fcinfo.Args[1].(float64))
+		if err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
+	addFunction("power", []types.Oid{float8, float8}, float8, power)
+	addFunction("pow", []types.Oid{float8, float8}, float8, power)
+
+	//random() is uniform in [0, 1)
+	addFunction("random", nil, float8, func(*FunctionCallInfo) (types.Datum, error) {
+		return rand.Float64(), nil
+	}).setMutable()
+}
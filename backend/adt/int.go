@@ -0,0 +1,127 @@
+package adt
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+smallint, integer and bigint
+All three are int64 datums, the narrower types only differ in the range their input and casts accept
+and in the size of their binary form
+*/
+
+func parseInt(str string, typ types.Oid, low int64, high int64) (types.Datum, error) {
+	value, err := strconv.ParseInt(strings.TrimSpace(str), 10, 64)
+	if err != nil {
+		if numErr, ok := err.(*strconv.NumError); ok && numErr.Err == strconv.ErrRange {
+			return nil, fmt.Errorf("value \"%s\" is out of range for type %s", str, TypeName(typ))
+		}
+		return nil, fmt.Errorf("invalid input syntax for type %s: \"%s\"", TypeName(typ), str)
+	}
+	if value < low || value > high {
+		return nil, fmt.Errorf("value \"%s\" is out of range for type %s", str, TypeName(typ))
+	}
+	return value, nil
+}
+
+func int2In(str string, _ *Settings) (types.Datum, error) {
+	return parseInt(str, types.INT2OID, math.MinInt16, math.MaxInt16)
+}
+
+func int4In(str string, _ *Settings) (types.Datum, error) {
+	return parseInt(str, types.INT4OID, math.MinInt32, math.MaxInt32)
+}
+
+func int8In(str string, _ *Settings) (types.Datum, error) {
+	return parseInt(str, types.INT8OID, math.MinInt64, math.MaxInt64)
+}
+
+func intOut(d types.Datum, _ *Settings) string {
+	return strconv.FormatInt(d.(int64), 10)
+}
+
+func int2Recv(buf []byte) (types.Datum, error) {
+	if len(buf) != 2 {
+		return nil, fmt.Errorf("invalid binary data for type smallint")
+	}
+	return int64(int16(binary.BigEndian.Uint16(buf))), nil
+}
+
+func int4Recv(buf []byte) (types.Datum, error) {
+	if len(buf) != 4 {
+		return nil, fmt.Errorf("invalid binary data for type integer")
+	}
+	return int64(int32(binary.BigEndian.Uint32(buf))), nil
+}
+
+func int8Recv(buf []byte) (types.Datum, error) {
+	if len(buf) != 8 {
+		return nil, fmt.Errorf("invalid binary data for type bigint")
+	}
+	return int64(binary.BigEndian.Uint64(buf)), nil
+}
+
+func int2Send(d types.Datum) []byte {
+	return binary.BigEndian.AppendUint16(nil, uint16(d.(int64)))
+}
+
+func int4Send(d types.Datum) []byte {
+	return binary.BigEndian.AppendUint32(nil, uint32(d.(int64)))
+}
+
+func int8Send(d types.Datum) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(d.(int64)))
+}
+
+func intCmp(a types.Datum, b types.Datum) int {
+	return compareOrdered(a.(int64), b.(int64))
+}
+
+func hashInt(buf []byte, d types.Datum) []byte {
+	return binary.BigEndian.AppendUint64(buf, uint64(d.(int64)))
+}
+
+// intRangeCheck is the check of a conversion to a narrower integer type
+func intRangeCheck(value int64, typ types.Oid) (types.Datum, error) {
+	switch {
+	case typ == types.INT2OID && (value < math.MinInt16 || value > math.MaxInt16):
+		return nil, fmt.Errorf("smallint out of range")
+	case typ == types.INT4OID && (value < math.MinInt32 || value > math.MaxInt32):
+		return nil, fmt.Errorf("integer out of range")
+	}
+	return value, nil
+}
+
+func init() {
+	//Each integer type has its own abs and mod, the result has the argument's type and must fit in it
+	for _, typ := range []types.Oid{types.INT2OID, types.INT4OID, types.INT8OID} {
+		typ := typ
+		addFunction("abs", []types.Oid{typ}, typ, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+			value := fcinfo.Args[0].(int64)
+			switch {
+			case value == math.MinInt64:
+				return nil, fmt.Errorf("bigint out of range")
+			case value < 0:
+				return intRangeCheck(-value, typ)
+			}
+			return value, nil
+		})
+		addFunction("mod", []types.Oid{typ, typ}, typ, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+			x, y := fcinfo.Args[0].(int64), fcinfo.Args[1].(int64)
+			switch y {
+			case 0:
+				return nil, fmt.Errorf("division by zero")
+			case -1:
+				//MinInt64 % -1 overflows in the division, the remainder is 0 anyway
+				return int64(0), nil
+			}
+			return x % y, nil
+		})
+	}
+}
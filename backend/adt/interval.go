@@ -0,0 +1,619 @@
+package adt
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+interval (postgres utils/adt/timestamp.c)
+
+An interval keeps months, days and microseconds apart, because a month is not always the same number of
+days and a day not always 24 hours (daylight saving). When intervals are compared a month counts as 30 days
+and a day as 24 hours, so 1 mon = 30 days, like postgres.
+
+Input is postgres' verbose form, 1 year 2 mons 3 days 04:05:06 (units may be abbreviated, @ and ago
+are understood), or ISO 8601, P1Y2M3DT4H5M6S. Output is one of the two, as IntervalStyle says
+*/
+
+type Interval struct {
+	Time  int64 //Microseconds
+	Day   int32
+	Month int32
+}
+
+var errIntervalOutOfRange = fmt.Errorf("interval out of range")
+
+// cmpValue is the interval as whole days and the microseconds left over, months counted as 30 days
+func (iv Interval) cmpValue() (int64, int64) {
+	days := int64(iv.Month)*DAYS_PER_MONTH + int64(iv.Day) + floorDiv(iv.Time, USECS_PER_DAY)
+	return days, iv.Time - floorDiv(iv.Time, USECS_PER_DAY)*USECS_PER_DAY
+}
+
+func intervalCmp(a types.Datum, b types.Datum) int {
+	adays, ausecs := a.(Interval).cmpValue()
+	bdays, busecs := b.(Interval).cmpValue()
+	if cmp := compareOrdered(adays, bdays); cmp != 0 {
+		return cmp
+	}
+	return compareOrdered(ausecs, busecs)
+}
+
+// Intervals that compare equal (1 day and 24:00:00) hash the same
+func hashInterval(buf []byte, d types.Datum) []byte {
+	days, usecs := d.(Interval).cmpValue()
+	buf = binary.BigEndian.AppendUint64(buf, uint64(days))
+	return binary.BigEndian.AppendUint64(buf, uint64(usecs))
+}
+
+func intervalRecv(buf []byte) (types.Datum, error) {
+	if len(buf) != 16 {
+		return nil, fmt.Errorf("invalid binary data for type interval")
+	}
+	return Interval{
+		Time:  int64(binary.BigEndian.Uint64(buf)),
+		Day:   int32(binary.BigEndian.Uint32(buf[8:])),
+		Month: int32(binary.BigEndian.Uint32(buf[12:])),
+	}, nil
+}
+
+func intervalSend(d types.Datum) []byte {
+	iv := d.(Interval)
+	buf := binary.BigEndian.AppendUint64(nil, uint64(iv.Time))
+	buf = binary.BigEndian.AppendUint32(buf, uint32(iv.Day))
+	return binary.BigEndian.AppendUint32(buf, uint32(iv.Month))
+}
+
+// intervalAccum collects the fields of an interval input, fractions of a unit spill into the smaller units
+type intervalAccum struct {
+	months int64
+	days   int64
+	usecs  int64
+	err    bool
+}
+
+func (acc *intervalAccum) addMonths(value float64) {
+	whole := math.Trunc(value)
+	acc.months += int64(whole)
+	acc.addDays((value - whole) * float64(DAYS_PER_MONTH))
+}
+
+func (acc *intervalAccum) addDays(value float64) {
+	whole := math.Trunc(value)
+	acc.days += int64(whole)
+	acc.addUsecs((value - whole) * float64(USECS_PER_DAY))
+}
+
+func (acc *intervalAccum) addUsecs(value float64) {
+	acc.usecs += int64(math.Round(value))
+}
+
+// add takes number units of unit, false if unit is not an interval unit
+func (acc *intervalAccum) add(number float64, unit string) bool {
+	if math.IsInf(number, 0) || math.IsNaN(number) || math.Abs(number) > 1e18 {
+		acc.err = true
+		return true
+	}
+	switch unit {
+	case "microseconds":
+		acc.addUsecs(number)
+	case "milliseconds":
+		acc.addUsecs(number * 1000)
+	case "second":
+		acc.addUsecs(number * float64(USECS_PER_SEC))
+	case "minute":
+		acc.addUsecs(number * float64(USECS_PER_MINUTE))
+	case "hour":
+		acc.addUsecs(number * float64(USECS_PER_HOUR))
+	case "day":
+		acc.addDays(number)
+	case "week":
+		acc.addDays(number * 7)
+	case "month":
+		acc.addMonths(number)
+	case "year":
+		acc.addMonths(number * 12)
+	case "decade":
+		acc.addMonths(number * 120)
+	case "century":
+		acc.addMonths(number * 1200)
+	case "millennium":
+		acc.addMonths(number * 12000)
+	default:
+		return false
+	}
+	return true
+}
+
+func (acc *intervalAccum) result(negate bool) (Interval, bool) {
+	if negate {
+		acc.months, acc.days, acc.usecs = -acc.months, -acc.days, -acc.usecs
+	}
+	if acc.err || acc.months != int64(int32(acc.months)) || acc.days != int64(int32(acc.days)) {
+		return Interval{}, false
+	}
+	return Interval{Time: acc.usecs, Day: int32(acc.days), Month: int32(acc.months)}, true
+}
+
+func intervalIn(str string, _ *Settings) (types.Datum, error) {
+	syntaxError := fmt.Errorf("invalid input syntax for type interval: \"%s\"", str)
+	value := strings.ToLower(strings.TrimSpace(str))
+	if value == "" {
+		return nil, syntaxError
+	}
+	var acc intervalAccum
+	var ok bool
+	negate := false
+	if value[0] == 'p' {
+		ok = decodeISO8601Interval(value[1:], &acc)
+	} else {
+		ok, negate = decodeVerboseInterval(value, &acc)
+	}
+	if !ok {
+		return nil, syntaxError
+	}
+	iv, ok := acc.result(negate)
+	if !ok {
+		return nil, fmt.Errorf("interval field value out of range: \"%s\"", str)
+	}
+	return iv, nil
+}
+
+/*
+decodeVerboseInterval reads numbers each followed by a unit, [@] 1 year 2 months 3.5 days [ago],
+and times of day, -04:05:06.5. A number without a unit is seconds, or days when a time follows it.
+The second result tells if ago negated the interval
+*/
+func decodeVerboseInterval(value string, acc *intervalAccum) (bool, bool) {
+	value = strings.TrimPrefix(value, "@")
+	tokens := strings.Fields(value)
+	//Units may be written without a space, 1day
+	var split []string
+	for _, token := range tokens {
+		end := 0
+		for end < len(token) && strings.IndexByte("+-0123456789.:", token[end]) >= 0 {
+			end++
+		}
+		if end > 0 && end < len(token) {
+			split = append(split, token[:end], token[end:])
+		} else {
+			split = append(split, token)
+		}
+	}
+	tokens = split
+
+	ago := false
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+		switch {
+		case token == "ago":
+			if i != len(tokens)-1 {
+				return false, false
+			}
+			ago = true
+		case strings.Contains(token, ":"):
+			usecs, ok := decodeIntervalTime(token)
+			if !ok {
+				return false, false
+			}
+			acc.usecs += usecs
+		default:
+			number, err := strconv.ParseFloat(token, 64)
+			if err != nil || strings.ContainsAny(token, "einfa") {
+				return false, false
+			}
+			unit := ""
+			if i+1 < len(tokens) {
+				if canonical, ok := decodeUnit(tokens[i+1]); ok {
+					unit = canonical
+					i++
+				}
+			}
+			if unit == "" {
+				unit = "second"
+				if i+1 < len(tokens) && strings.Contains(tokens[i+1], ":") {
+					unit = "day"
+				}
+			}
+			if !acc.add(number, unit) {
+				return false, false
+			}
+		}
+	}
+	return len(tokens) > 0, ago
+}
+
+// decodeIntervalTime reads [-]H:MM[:SS[.fraction]], hours may have any number of digits
+func decodeIntervalTime(token string) (int64, bool) {
+	negative := strings.HasPrefix(token, "-")
+	token = strings.TrimLeft(token, "+-")
+	parts := strings.Split(token, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, false
+	}
+	var usecs int64
+	for i, part := range parts {
+		whole, fraction, hasFraction := strings.Cut(part, ".")
+		if whole == "" || (hasFraction && i != len(parts)-1) || (hasFraction && len(parts) == 2) {
+			return 0, false
+		}
+		number, err := strconv.ParseInt(whole, 10, 64)
+		if err != nil || (i > 0 && number > 59) || number > math.MaxInt64/USECS_PER_HOUR {
+			return 0, false
+		}
+		usecs += number * [...]int64{USECS_PER_HOUR, USECS_PER_MINUTE, USECS_PER_SEC}[i]
+		if hasFraction {
+			for j := 0; j < len(fraction); j++ {
+				if fraction[j] < '0' || fraction[j] > '9' {
+					return 0, false
+				}
+			}
+			usecs += parseFraction(fraction)
+		}
+	}
+	if negative {
+		usecs = -usecs
+	}
+	return usecs, true
+}
+
+// decodeISO8601Interval reads what follows the P of P1Y2M3DT4H5M6S, after the T an M is minutes
+func decodeISO8601Interval(value string, acc *intervalAccum) bool {
+	if value == "" {
+		return false
+	}
+	inTime := false
+	for value != "" {
+		if value[0] == 't' {
+			if inTime || len(value) == 1 {
+				return false
+			}
+			inTime = true
+			value = value[1:]
+			continue
+		}
+		end := 0
+		for end < len(value) && strings.IndexByte("+-0123456789.", value[end]) >= 0 {
+			end++
+		}
+		if end == 0 || end == len(value) {
+			return false
+		}
+		number, err := strconv.ParseFloat(value[:end], 64)
+		if err != nil {
+			return false
+		}
+		var unit string
+		switch designator := value[end]; {
+		case !inTime && designator == 'y':
+			unit = "year"
+		case !inTime && designator == 'm':
+			unit = "month"
+		case !inTime && designator == 'w':
+			unit = "week"
+		case !inTime && designator == 'd':
+			unit = "day"
+		case inTime && designator == 'h':
+			unit = "hour"
+		case inTime && designator == 'm':
+			unit = "minute"
+		case inTime && designator == 's':
+			unit = "second"
+		default:
+			return false
+		}
+		acc.add(number, unit)
+		value = value[end+1:]
+	}
+	return true
+}
+
+// intervalFields splits an interval the way postgres prints it, every field has the sign of its part
+func (iv Interval) fields() (year int64, mon int64, hour int64, min int64, sec int64, usec int64) {
+	year, mon = int64(iv.Month)/12, int64(iv.Month)%12
+	hour = iv.Time / USECS_PER_HOUR
+	min = iv.Time / USECS_PER_MINUTE % 60
+	sec = iv.Time / USECS_PER_SEC % 60
+	usec = iv.Time % USECS_PER_SEC
+	return
+}
+
+func intervalOut(d types.Datum, settings *Settings) string {
+	iv := d.(Interval)
+	if settings.IntervalStyle == INTSTYLE_ISO_8601 {
+		return intervalOutISO8601(iv)
+	}
+
+	year, mon, hour, min, sec, usec := iv.fields()
+	var buf []byte
+	isZero, isBefore := true, false
+	//A part following a negative one gets an explicit + so the sign of the parts is clear
+	addPart := func(value int64, unit string) {
+		if value == 0 {
+			return
+		}
+		if !isZero {
+			buf = append(buf, ' ')
+		}
+		if isBefore && value > 0 {
+			buf = append(buf, '+')
+		}
+		buf = fmt.Appendf(buf, "%d %s", value, unit)
+		if value != 1 {
+			buf = append(buf, 's')
+		}
+		isBefore, isZero = value < 0, false
+	}
+	addPart(year, "year")
+	addPart(mon, "mon")
+	addPart(int64(iv.Day), "day")
+	if isZero || iv.Time != 0 {
+		if !isZero {
+			buf = append(buf, ' ')
+		}
+		switch {
+		case iv.Time < 0:
+			buf = append(buf, '-')
+		case isBefore:
+			buf = append(buf, '+')
+		}
+		buf = fmt.Appendf(buf, "%02d:%02d:", abs64(hour), abs64(min))
+		buf = appendSeconds(buf, abs64(sec), abs64(usec))
+	}
+	return string(buf)
+}
+
+func intervalOutISO8601(iv Interval) string {
+	year, mon, hour, min, sec, usec := iv.fields()
+	if iv.Month == 0 && iv.Day == 0 && iv.Time == 0 {
+		return "PT0S"
+	}
+	buf := []byte{'P'}
+	addPart := func(value int64, designator byte) {
+		if value != 0 {
+			buf = append(strconv.AppendInt(buf, value, 10), designator)
+		}
+	}
+	addPart(year, 'Y')
+	addPart(mon, 'M')
+	addPart(int64(iv.Day), 'D')
+	if iv.Time != 0 {
+		buf = append(buf, 'T')
+		addPart(hour, 'H')
+		addPart(min, 'M')
+		if sec != 0 || usec != 0 {
+			if sec < 0 || usec < 0 {
+				buf = append(buf, '-')
+			}
+			buf = strconv.AppendInt(buf, abs64(sec), 10)
+			if usec != 0 {
+				buf = append(buf, strings.TrimRight(fmt.Sprintf(".%06d", abs64(usec)), "0")...)
+			}
+			buf = append(buf, 'S')
+		}
+	}
+	return string(buf)
+}
+
+func abs64(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func intervalPl(a Interval, b Interval) (Interval, error) {
+	months, days := int64(a.Month)+int64(b.Month), int64(a.Day)+int64(b.Day)
+	usecs, ok := addUsecs(a.Time, b.Time)
+	if !ok || months != int64(int32(months)) || days != int64(int32(days)) {
+		return Interval{}, errIntervalOutOfRange
+	}
+	return Interval{Time: usecs, Day: int32(days), Month: int32(months)}, nil
+}
+
+func intervalUm(iv Interval) (Interval, error) {
+	if iv.Time == math.MinInt64 || iv.Day == math.MinInt32 || iv.Month == math.MinInt32 {
+		return Interval{}, errIntervalOutOfRange
+	}
+	return Interval{Time: -iv.Time, Day: -iv.Day, Month: -iv.Month}, nil
+}
+
+func intervalMi(a Interval, b Interval) (Interval, error) {
+	negated, err := intervalUm(b)
+	if err != nil {
+		return Interval{}, err
+	}
+	return intervalPl(a, negated)
+}
+
+/*
+intervalMul multiplies each part of an interval, what a fractional month leaves over goes into days
+(30 to a month) and what a fractional day leaves over into the time (postgres interval_mul)
+*/
+func intervalMul(iv Interval, factor float64) (Interval, error) {
+	return intervalScale(iv, func(v float64) float64 { return v * factor })
+}
+
+func intervalDiv(iv Interval, factor float64) (Interval, error) {
+	if factor == 0 {
+		return Interval{}, fmt.Errorf("division by zero")
+	}
+	return intervalScale(iv, func(v float64) float64 { return v / factor })
+}
+
+func intervalScale(iv Interval, scale func(float64) float64) (Interval, error) {
+	//Rounded to microseconds of a day, as TSROUND does
+	tsRound := func(v float64) float64 { return math.RoundToEven(v*1e6) / 1e6 }
+
+	months := scale(float64(iv.Month))
+	days := scale(float64(iv.Day))
+	if math.IsNaN(months) || math.IsNaN(days) || months > math.MaxInt32 || months < math.MinInt32 ||
+		days > math.MaxInt32 || days < math.MinInt32 {
+		return Interval{}, errIntervalOutOfRange
+	}
+	result := Interval{Month: int32(months), Day: int32(days)}
+
+	monthRemainderDays := tsRound((months - float64(result.Month)) * float64(DAYS_PER_MONTH))
+	secRemainder := tsRound((days - float64(result.Day) + monthRemainderDays - math.Trunc(monthRemainderDays)) * float64(SECS_PER_DAY))
+	if math.Abs(secRemainder) >= float64(SECS_PER_DAY) {
+		result.Day += int32(secRemainder / float64(SECS_PER_DAY))
+		secRemainder -= math.Trunc(secRemainder/float64(SECS_PER_DAY)) * float64(SECS_PER_DAY)
+	}
+	result.Day += int32(monthRemainderDays)
+
+	usecs := math.RoundToEven(scale(float64(iv.Time)) + secRemainder*float64(USECS_PER_SEC))
+	if math.IsNaN(usecs) || usecs >= math.MaxInt64 || usecs < math.MinInt64 {
+		return Interval{}, errIntervalOutOfRange
+	}
+	result.Time = int64(usecs)
+	return result, nil
+}
+
+// justifyHours moves whole days out of the time into days, the time keeps the sign of the days
+func justifyHours(iv Interval) (Interval, error) {
+	days := int64(iv.Day) + iv.Time/USECS_PER_DAY
+	usecs := iv.Time % USECS_PER_DAY
+	switch {
+	case days > 0 && usecs < 0:
+		usecs += USECS_PER_DAY
+		days--
+	case days < 0 && usecs > 0:
+		usecs -= USECS_PER_DAY
+		days++
+	}
+	if days != int64(int32(days)) {
+		return Interval{}, errIntervalOutOfRange
+	}
+	return Interval{Time: usecs, Day: int32(days), Month: iv.Month}, nil
+}
+
+// justifyDays moves each 30 days into a month, the days keep the sign of the months
+func justifyDays(iv Interval) (Interval, error) {
+	months := int64(iv.Month) + int64(iv.Day)/DAYS_PER_MONTH
+	days := int64(iv.Day) % DAYS_PER_MONTH
+	switch {
+	case months > 0 && days < 0:
+		days += DAYS_PER_MONTH
+		months--
+	case months < 0 && days > 0:
+		days -= DAYS_PER_MONTH
+		months++
+	}
+	if months != int64(int32(months)) {
+		return Interval{}, errIntervalOutOfRange
+	}
+	return Interval{Time: iv.Time, Day: int32(days), Month: int32(months)}, nil
+}
+
+// justifyInterval does both, the parts all end up with the same sign
+func justifyInterval(iv Interval) (Interval, error) {
+	days := int64(iv.Day) + iv.Time/USECS_PER_DAY
+	usecs := iv.Time % USECS_PER_DAY
+	months := int64(iv.Month) + days/DAYS_PER_MONTH
+	days %= DAYS_PER_MONTH
+
+	switch {
+	case months > 0 && (days < 0 || (days == 0 && usecs < 0)):
+		days += DAYS_PER_MONTH
+		months--
+	case months < 0 && (days > 0 || (days == 0 && usecs > 0)):
+		days -= DAYS_PER_MONTH
+		months++
+	}
+	switch {
+	case days > 0 && usecs < 0:
+		usecs += USECS_PER_DAY
+		days--
+	case days < 0 && usecs > 0:
+		usecs -= USECS_PER_DAY
+		days++
+	}
+	if months != int64(int32(months)) {
+		return Interval{}, errIntervalOutOfRange
+	}
+	return Interval{Time: usecs, Day: int32(days), Month: int32(months)}, nil
+}
+
+/*
+extractInterval is EXTRACT from an interval. epoch is the whole interval in seconds, a year counted as
+365.25 days and a month as 30, the other units are the parts intervalOut prints
+*/
+func extractInterval(unit string, iv Interval) (Numeric, error) {
+	year, mon, hour, min, sec, usec := iv.fields()
+	switch unit {
+	case "microseconds":
+		return NumericFromInt64(sec*USECS_PER_SEC + usec), nil
+	case "milliseconds":
+		return numericScaled(sec*USECS_PER_SEC+usec, 3), nil
+	case "second":
+		return numericScaled(sec*USECS_PER_SEC+usec, 6), nil
+	case "minute":
+		return NumericFromInt64(min), nil
+	case "hour":
+		return NumericFromInt64(hour), nil
+	case "day":
+		return NumericFromInt64(int64(iv.Day)), nil
+	case "month":
+		return NumericFromInt64(mon), nil
+	case "quarter":
+		return NumericFromInt64(mon/3 + 1), nil
+	case "year":
+		return NumericFromInt64(year), nil
+	case "decade":
+		return NumericFromInt64(year / 10), nil
+	case "century":
+		return NumericFromInt64(year / 100), nil
+	case "millennium":
+		return NumericFromInt64(year / 1000), nil
+	case "epoch":
+		//In quarter days so that 365.25 stays an integer
+		secs := (1461*year + 4*DAYS_PER_MONTH*mon + 4*int64(iv.Day)) * (SECS_PER_DAY / 4)
+		return numericScaled(iv.Time, 6).Add(NumericFromInt64(secs))
+	}
+	return Numeric{}, unitNotSupported(unit, types.INTERVALOID)
+}
+
+// truncInterval is date_trunc on an interval, the parts smaller than the unit are dropped
+func truncInterval(unit string, iv Interval) (Interval, error) {
+	year, mon, hour, min, sec, usec := iv.fields()
+	day := int64(iv.Day)
+	switch unit {
+	case "millennium":
+		year, mon, day, hour, min, sec, usec = year/1000*1000, 0, 0, 0, 0, 0, 0
+	case "century":
+		year, mon, day, hour, min, sec, usec = year/100*100, 0, 0, 0, 0, 0, 0
+	case "decade":
+		year, mon, day, hour, min, sec, usec = year/10*10, 0, 0, 0, 0, 0, 0
+	case "year":
+		mon, day, hour, min, sec, usec = 0, 0, 0, 0, 0, 0
+	case "quarter":
+		mon, day, hour, min, sec, usec = 3*(mon/3), 0, 0, 0, 0, 0
+	case "month":
+		day, hour, min, sec, usec = 0, 0, 0, 0, 0
+	case "day":
+		hour, min, sec, usec = 0, 0, 0, 0
+	case "hour":
+		min, sec, usec = 0, 0, 0
+	case "minute":
+		sec, usec = 0, 0
+	case "second":
+		usec = 0
+	case "milliseconds":
+		usec = usec / 1000 * 1000
+	case "microseconds":
+	case "week":
+		return Interval{}, fmt.Errorf("interval units \"week\" not supported because months usually have fractional weeks")
+	default:
+		return Interval{}, unitNotSupported(unit, types.INTERVALOID)
+	}
+	return Interval{
+		Month: int32(year*12 + mon),
+		Day:   int32(day),
+		Time:  hour*USECS_PER_HOUR + min*USECS_PER_MINUTE + sec*USECS_PER_SEC + usec,
+	}, nil
+}
@@ -0,0 +1,590 @@
+package adt
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+json (postgres utils/adt/json.c)
+
+A json value is the text it was written as, checked to be valid JSON: whitespace, the order of keys and
+keys given twice are all kept. Operators on json parse the text again and return the pieces as they
+were written. jsonb (jsonb.go) is the parsed form.
+
+The parser here reads both: for json it keeps the text of every value, for jsonb it sorts the keys of
+objects and keeps the last value of a key given twice
+*/
+
+type Json string
+
+type jsonParser struct {
+	input    string
+	pos      int
+	typeName string
+	keepRaw  bool
+}
+
+// parseJson reads a JSON document, typeName is the type errors are reported for
+func parseJson(str string, typeName string, keepRaw bool) (*Jsonb, error) {
+	p := &jsonParser{input: str, typeName: typeName, keepRaw: keepRaw}
+	p.skipSpace()
+	value, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.input) {
+		return nil, p.tokenError()
+	}
+	return value, nil
+}
+
+func (p *jsonParser) skipSpace() {
+	for p.pos < len(p.input) {
+		switch p.input[p.pos] {
+		case ' ', '\t', '\n', '\r':
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (p *jsonParser) syntaxError(detail string) error {
+	return fmt.Errorf("invalid input syntax for type %s: %s", p.typeName, detail)
+}
+
+// tokenError reports the token at the current position, a word or a single character
+func (p *jsonParser) tokenError() error {
+	if p.pos >= len(p.input) {
+		return p.syntaxError("the input string ended unexpectedly")
+	}
+	end := p.pos
+	for end < len(p.input) && isJsonWordChar(p.input[end]) {
+		end++
+	}
+	if end == p.pos {
+		_, size := utf8.DecodeRuneInString(p.input[p.pos:])
+		end += size
+	}
+	return p.syntaxError(fmt.Sprintf("token \"%s\" is invalid", p.input[p.pos:end]))
+}
+
+func isJsonWordChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c >= 0x80
+}
+
+func (p *jsonParser) parseValue() (*Jsonb, error) {
+	if p.pos >= len(p.input) {
+		return nil, p.tokenError()
+	}
+	start := p.pos
+	var value *Jsonb
+	var err error
+	switch c := p.input[p.pos]; {
+	case c == '{':
+		value, err = p.parseObject()
+	case c == '[':
+		value, err = p.parseArray()
+	case c == '"':
+		var str string
+		str, err = p.parseString()
+		value = &Jsonb{kind: jbvString, str: str}
+	case c == '-' || c >= '0' && c <= '9':
+		value, err = p.parseNumber()
+	default:
+		end := p.pos
+		for end < len(p.input) && isJsonWordChar(p.input[end]) {
+			end++
+		}
+		switch p.input[p.pos:end] {
+		case "true", "false":
+			value = &Jsonb{kind: jbvBool, boolean: p.input[p.pos] == 't'}
+		case "null":
+			value = &Jsonb{kind: jbvNull}
+		default:
+			return nil, p.tokenError()
+		}
+		p.pos = end
+	}
+	if err != nil {
+		return nil, err
+	}
+	if p.keepRaw {
+		value.raw = p.input[start:p.pos]
+	}
+	return value, nil
+}
+
+func (p *jsonParser) parseObject() (*Jsonb, error) {
+	p.pos++ //'{'
+	object := &Jsonb{kind: jbvObject}
+	p.skipSpace()
+	if p.pos < len(p.input) && p.input[p.pos] == '}' {
+		p.pos++
+		return object, nil
+	}
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.input) || p.input[p.pos] != '"' {
+			return nil, p.tokenError()
+		}
+		key, err := p.parseString()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if p.pos >= len(p.input) || p.input[p.pos] != ':' {
+			return nil, p.tokenError()
+		}
+		p.pos++
+		p.skipSpace()
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		object.pairs = append(object.pairs, jsonbPair{key: key, value: value})
+		p.skipSpace()
+		if p.pos < len(p.input) && p.input[p.pos] == ',' {
+			p.pos++
+			continue
+		}
+		if p.pos < len(p.input) && p.input[p.pos] == '}' {
+			p.pos++
+			break
+		}
+		return nil, p.tokenError()
+	}
+	if !p.keepRaw {
+		object.normalizeObject()
+	}
+	return object, nil
+}
+
+func (p *jsonParser) parseArray() (*Jsonb, error) {
+	p.pos++ //'['
+	array := &Jsonb{kind: jbvArray, elems: []*Jsonb{}}
+	p.skipSpace()
+	if p.pos < len(p.input) && p.input[p.pos] == ']' {
+		p.pos++
+		return array, nil
+	}
+	for {
+		p.skipSpace()
+		elem, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		array.elems = append(array.elems, elem)
+		p.skipSpace()
+		if p.pos < len(p.input) && p.input[p.pos] == ',' {
+			p.pos++
+			continue
+		}
+		if p.pos < len(p.input) && p.input[p.pos] == ']' {
+			p.pos++
+			return array, nil
+		}
+		return nil, p.tokenError()
+	}
+}
+
+// parseString reads a quoted string and resolves its escapes, \u0000 is refused as text cannot hold it
+func (p *jsonParser) parseString() (string, error) {
+	p.pos++ //'"'
+	var builder strings.Builder
+	for {
+		if p.pos >= len(p.input) {
+			return "", p.syntaxError("the input string ended unexpectedly")
+		}
+		c := p.input[p.pos]
+		switch {
+		case c == '"':
+			p.pos++
+			return builder.String(), nil
+		case c < 0x20:
+			return "", p.syntaxError(fmt.Sprintf("character with value 0x%02x must be escaped", c))
+		case c != '\\':
+			builder.WriteByte(c)
+			p.pos++
+			continue
+		}
+
+		if p.pos+1 >= len(p.input) {
+			return "", p.syntaxError("the input string ended unexpectedly")
+		}
+		escape := p.input[p.pos+1]
+		p.pos += 2
+		switch escape {
+		case '"', '\\', '/':
+			builder.WriteByte(escape)
+		case 'b':
+			builder.WriteByte('\b')
+		case 'f':
+			builder.WriteByte('\f')
+		case 'n':
+			builder.WriteByte('\n')
+		case 'r':
+			builder.WriteByte('\r')
+		case 't':
+			builder.WriteByte('\t')
+		case 'u':
+			r, err := p.parseUnicodeEscape()
+			if err != nil {
+				return "", err
+			}
+			builder.WriteRune(r)
+		default:
+			return "", p.syntaxError(fmt.Sprintf("escape sequence \"\\%c\" is invalid", escape))
+		}
+	}
+}
+
+// parseUnicodeEscape reads the digits of \uXXXX, a high surrogate must be followed by a low one
+func (p *jsonParser) parseUnicodeEscape() (rune, error) {
+	hex := func() (rune, error) {
+		if p.pos+4 > len(p.input) {
+			return 0, p.syntaxError("\"\\u\" must be followed by four hexadecimal digits")
+		}
+		value, err := strconv.ParseUint(p.input[p.pos:p.pos+4], 16, 16)
+		if err != nil {
+			return 0, p.syntaxError("\"\\u\" must be followed by four hexadecimal digits")
+		}
+		p.pos += 4
+		return rune(value), nil
+	}
+	r, err := hex()
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case r == 0:
+		return 0, fmt.Errorf("unsupported Unicode escape sequence: \\u0000 cannot be converted to text")
+	case utf16.IsSurrogate(r) && r < 0xDC00:
+		if !strings.HasPrefix(p.input[p.pos:], "\\u") {
+			return 0, p.syntaxError("Unicode low surrogate must follow a high surrogate")
+		}
+		p.pos += 2
+		low, err := hex()
+		if err != nil {
+			return 0, err
+		}
+		if combined := utf16.DecodeRune(r, low); combined != utf8.RuneError {
+			return combined, nil
+		}
+		return 0, p.syntaxError("Unicode low surrogate must follow a high surrogate")
+	case utf16.IsSurrogate(r):
+		return 0, p.syntaxError("Unicode low surrogate must follow a high surrogate")
+	}
+	return r, nil
+}
+
+// parseNumber reads -?(0|[1-9][0-9]*)(.[0-9]+)?([eE][+-]?[0-9]+)?, a number may not run into a word
+func (p *jsonParser) parseNumber() (*Jsonb, error) {
+	start := p.pos
+	digits := func() int {
+		from := p.pos
+		for p.pos < len(p.input) && p.input[p.pos] >= '0' && p.input[p.pos] <= '9' {
+			p.pos++
+		}
+		return p.pos - from
+	}
+	if p.input[p.pos] == '-' {
+		p.pos++
+	}
+	intStart := p.pos
+	if digits() == 0 || (p.input[intStart] == '0' && p.pos-intStart > 1) {
+		p.pos = start
+		return nil, p.tokenError()
+	}
+	if p.pos < len(p.input) && p.input[p.pos] == '.' {
+		p.pos++
+		if digits() == 0 {
+			p.pos = start
+			return nil, p.tokenError()
+		}
+	}
+	if p.pos < len(p.input) && (p.input[p.pos] == 'e' || p.input[p.pos] == 'E') {
+		p.pos++
+		if p.pos < len(p.input) && (p.input[p.pos] == '+' || p.input[p.pos] == '-') {
+			p.pos++
+		}
+		if digits() == 0 {
+			p.pos = start
+			return nil, p.tokenError()
+		}
+	}
+	if p.pos < len(p.input) && isJsonWordChar(p.input[p.pos]) {
+		p.pos = start
+		return nil, p.tokenError()
+	}
+	num, err := ParseNumeric(p.input[start:p.pos])
+	if err != nil {
+		return nil, err
+	}
+	return &Jsonb{kind: jbvNumeric, num: num}, nil
+}
+
+// escapeJson appends str as a quoted JSON string (postgres escape_json)
+func escapeJson(buf []byte, str string) []byte {
+	buf = append(buf, '"')
+	for i := 0; i < len(str); i++ {
+		switch c := str[i]; c {
+		case '"':
+			buf = append(buf, '\\', '"')
+		case '\\':
+			buf = append(buf, '\\', '\\')
+		case '\b':
+			buf = append(buf, '\\', 'b')
+		case '\f':
+			buf = append(buf, '\\', 'f')
+		case '\n':
+			buf = append(buf, '\\', 'n')
+		case '\r':
+			buf = append(buf, '\\', 'r')
+		case '\t':
+			buf = append(buf, '\\', 't')
+		default:
+			if c < 0x20 {
+				buf = fmt.Appendf(buf, "\\u%04x", c)
+			} else {
+				buf = append(buf, c)
+			}
+		}
+	}
+	return append(buf, '"')
+}
+
+func jsonIn(str string, _ *Settings) (types.Datum, error) {
+	return checkJson(str)
+}
+
+// checkJson makes a json value of str, which must be valid JSON
+func checkJson(str string) (types.Datum, error) {
+	if _, err := parseJson(str, "json", true); err != nil {
+		return nil, err
+	}
+	return Json(str), nil
+}
+
+func jsonOut(d types.Datum, _ *Settings) string {
+	return string(d.(Json))
+}
+
+func jsonRecv(buf []byte) (types.Datum, error) {
+	return checkJson(string(buf))
+}
+
+func jsonSend(d types.Datum) []byte {
+	return []byte(d.(Json))
+}
+
+// json has no equality, values only hash for DISTINCT and UNION by their text
+func hashJson(buf []byte, d types.Datum) []byte {
+	return hashText(buf, string(d.(Json)))
+}
+
+// parse gives the tree of a json value with the text of every piece
+func (j Json) parse() (*Jsonb, error) {
+	return parseJson(string(j), "json", true)
+}
+
+// asJson is a piece of a json value as the json it was written as
+func (j *Jsonb) asJson() Json {
+	if j.raw != "" {
+		return Json(j.raw)
+	}
+	return Json(jsonbText(j))
+}
+
+/*
+appendJsonDatum appends the JSON form of a value of any type (postgres datum_to_json): numbers and
+booleans as they are, json as it was written, arrays as JSON arrays and everything else as a string
+of its text form. Dates and timestamps use the ISO 8601 form with a T
+*/
+func appendJsonDatum(buf []byte, d types.Datum, settings *Settings) []byte {
+	switch v := d.(type) {
+	case nil:
+		return append(buf, "null"...)
+	case bool:
+		return strconv.AppendBool(buf, v)
+	case int64:
+		return strconv.AppendInt(buf, v, 10)
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return escapeJson(buf, formatFloat8(v))
+		}
+		return append(buf, formatFloat8(v)...)
+	case Numeric:
+		if v.kind != numericFinite {
+			return escapeJson(buf, v.String())
+		}
+		return append(buf, v.String()...)
+	case Json:
+		return append(buf, v...)
+	case *Jsonb:
+		return append(buf, jsonbText(v)...)
+	case []types.Datum:
+		buf = append(buf, '[')
+		for i, elem := range v {
+			if i > 0 {
+				buf = append(buf, ',')
+			}
+			buf = appendJsonDatum(buf, elem, settings)
+		}
+		return append(buf, ']')
+	}
+	return escapeJson(buf, jsonScalarText(d, settings))
+}
+
+// jsonScalarText is the string a value that is no JSON scalar becomes
+func jsonScalarText(d types.Datum, settings *Settings) string {
+	switch v := d.(type) {
+	case Date, Timestamp, TimestampTz:
+		text := OutputDatum(v, settings)
+		if text == "infinity" || text == "-infinity" {
+			return text
+		}
+		text, bc := strings.CutSuffix(text, " BC")
+		datePart, timePart, hasTime := strings.Cut(text, " ")
+		if !hasTime {
+			return OutputDatum(v, settings)
+		}
+		//XSD form, 2024-03-01T13:45:00+01:00
+		if _, isTz := v.(TimestampTz); isTz {
+			if i := strings.LastIndexAny(timePart, "+-"); i >= 0 && !strings.Contains(timePart[i:], ":") {
+				timePart += ":00"
+			}
+		}
+		if bc {
+			timePart += " BC"
+		}
+		return datePart + "T" + timePart
+	}
+	return OutputDatum(d, settings)
+}
+
+// ToJson is to_json, the JSON form of any value
+func ToJson(d types.Datum, settings *Settings) Json {
+	return Json(appendJsonDatum(nil, d, settings))
+}
+
+// jsonObjectKey is the text of a value used as an object key, which must be a non NULL scalar
+func jsonObjectKey(d types.Datum, argno int, settings *Settings) (string, error) {
+	switch d.(type) {
+	case nil:
+		return "", fmt.Errorf("argument %d cannot be null", argno)
+	case []types.Datum, Json, *Jsonb:
+		return "", fmt.Errorf("key value must be scalar, not array, composite, or json")
+	}
+	return OutputDatum(d, settings), nil
+}
+
+// jsonBuildObject is json_build_object(k1, v1, k2, v2, ...)
+func jsonBuildObject(args []types.Datum, settings *Settings) (types.Datum, error) {
+	if len(args)%2 != 0 {
+		return nil, fmt.Errorf("argument list must have even number of elements")
+	}
+	buf := []byte{'{'}
+	for i := 0; i < len(args); i += 2 {
+		if i > 0 {
+			buf = append(buf, ", "...)
+		}
+		key, err := jsonObjectKey(args[i], i+1, settings)
+		if err != nil {
+			return nil, err
+		}
+		buf = escapeJson(buf, key)
+		buf = append(buf, " : "...)
+		buf = appendJsonDatum(buf, args[i+1], settings)
+	}
+	return Json(append(buf, '}')), nil
+}
+
+// jsonBuildArray is json_build_array(v1, v2, ...)
+func jsonBuildArray(args []types.Datum, settings *Settings) types.Datum {
+	buf := []byte{'['}
+	for i, arg := range args {
+		if i > 0 {
+			buf = append(buf, ", "...)
+		}
+		buf = appendJsonDatum(buf, arg, settings)
+	}
+	return Json(append(buf, ']'))
+}
+
+/*
+JsonAggState accumulates json_agg and json_object_agg, the executor's aggregates keep one per group
+The text is built as the values come, ", " between them as postgres does
+*/
+type JsonAggState struct {
+	buf      []byte
+	object   bool
+	settings *Settings
+}
+
+func NewJsonAggState(object bool, settings *Settings) *JsonAggState {
+	return &JsonAggState{object: object, settings: settings}
+}
+
+// Add appends one value, key is only used by json_object_agg. Returns the bytes the state grew by
+func (s *JsonAggState) Add(key types.Datum, value types.Datum) (int, error) {
+	before := len(s.buf)
+	if len(s.buf) == 0 {
+		if s.object {
+			s.buf = append(s.buf, "{ "...)
+		} else {
+			s.buf = append(s.buf, '[')
+		}
+	} else {
+		s.buf = append(s.buf, ", "...)
+	}
+	if s.object {
+		if key == nil {
+			return 0, fmt.Errorf("field name must not be null")
+		}
+		name, err := jsonObjectKey(key, 1, s.settings)
+		if err != nil {
+			return 0, err
+		}
+		s.buf = escapeJson(s.buf, name)
+		s.buf = append(s.buf, " : "...)
+	}
+	s.buf = appendJsonDatum(s.buf, value, s.settings)
+	return len(s.buf) - before, nil
+}
+
+// Result is the aggregate's value, NULL when no row was added
+func (s *JsonAggState) Result() types.Datum {
+	if len(s.buf) == 0 {
+		return nil
+	}
+	if s.object {
+		return Json(string(s.buf) + " }")
+	}
+	return Json(string(s.buf) + "]")
+}
+
+// jsonTypeof is json_typeof and jsonb_typeof
+func jsonTypeof(j *Jsonb) string {
+	switch j.kind {
+	case jbvObject:
+		return "object"
+	case jbvArray:
+		return "array"
+	case jbvString:
+		return "string"
+	case jbvNumeric:
+		return "number"
+	case jbvBool:
+		return "boolean"
+	}
+	return "null"
+}
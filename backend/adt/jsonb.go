@@ -0,0 +1,818 @@
+package adt
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+jsonb (postgres utils/adt/jsonb.c, jsonb_util.c and jsonb_op.c)
+
+A jsonb datum is a *Jsonb, the root of a tree of values. Objects hold their keys sorted the way postgres
+stores them, shorter keys first and keys of the same length bytewise, a key given twice keeps its last
+value. Numbers are numerics, so 1.0 and 1.00 are equal (each prints as written).
+Values are never changed once built, operators that modify a document copy the parts they change.
+
+Equal documents compare and hash equal, the btree order between values of different kinds is
+Object > Array > Boolean > Number > String > Null (objects with more pairs and arrays with more elements
+are bigger). A scalar at the top sorts below every non empty top level array and above the empty one,
+as postgres stores top level scalars as one element arrays
+*/
+
+type jsonbKind uint8
+
+const (
+	jbvNull jsonbKind = iota
+	jbvString
+	jbvNumeric
+	jbvBool
+	jbvArray
+	jbvObject
+)
+
+type Jsonb struct {
+	kind    jsonbKind
+	str     string
+	num     Numeric
+	boolean bool
+	elems   []*Jsonb    //Array elements
+	pairs   []jsonbPair //Object members
+	raw     string      //The text of the value, only set for pieces of json values
+}
+
+type jsonbPair struct {
+	key   string
+	value *Jsonb
+}
+
+func (j *Jsonb) isScalar() bool {
+	return j.kind != jbvArray && j.kind != jbvObject
+}
+
+// compareJsonbKeys is the order of object keys, by length first
+func compareJsonbKeys(a string, b string) int {
+	if len(a) != len(b) {
+		return compareOrdered(int64(len(a)), int64(len(b)))
+	}
+	return strings.Compare(a, b)
+}
+
+// normalizeObject sorts the pairs of an object by key, of a key given twice the last one wins
+func (j *Jsonb) normalizeObject() {
+	sort.SliceStable(j.pairs, func(a, b int) bool {
+		return compareJsonbKeys(j.pairs[a].key, j.pairs[b].key) < 0
+	})
+	kept := j.pairs[:0]
+	for _, pair := range j.pairs {
+		if len(kept) > 0 && kept[len(kept)-1].key == pair.key {
+			kept[len(kept)-1] = pair
+			continue
+		}
+		kept = append(kept, pair)
+	}
+	j.pairs = kept
+}
+
+// findKey returns the value of a key of an object, nil if it has none
+func (j *Jsonb) findKey(key string) *Jsonb {
+	if j.kind != jbvObject {
+		return nil
+	}
+	i := sort.Search(len(j.pairs), func(i int) bool { return compareJsonbKeys(j.pairs[i].key, key) >= 0 })
+	if i < len(j.pairs) && j.pairs[i].key == key {
+		return j.pairs[i].value
+	}
+	return nil
+}
+
+// findLastKey is findKey for the unsorted objects of json values, the last pair with the key counts
+func (j *Jsonb) findLastKey(key string) *Jsonb {
+	if j.kind != jbvObject {
+		return nil
+	}
+	for i := len(j.pairs) - 1; i >= 0; i-- {
+		if j.pairs[i].key == key {
+			return j.pairs[i].value
+		}
+	}
+	return nil
+}
+
+// arrayElement returns an element of an array by its index, negative indexes count from the end
+func (j *Jsonb) arrayElement(index int64) *Jsonb {
+	if j.kind != jbvArray {
+		return nil
+	}
+	if index < 0 {
+		index += int64(len(j.elems))
+	}
+	if index < 0 || index >= int64(len(j.elems)) {
+		return nil
+	}
+	return j.elems[index]
+}
+
+func jsonbIn(str string, _ *Settings) (types.Datum, error) {
+	return parseJson(str, "jsonb", false)
+}
+
+func jsonbOut(d types.Datum, _ *Settings) string {
+	return jsonbText(d.(*Jsonb))
+}
+
+func jsonbText(j *Jsonb) string {
+	return string(appendJsonb(nil, j, -1))
+}
+
+// jsonbPretty is jsonb_pretty, four spaces per level
+func jsonbPretty(j *Jsonb) string {
+	return string(appendJsonb(nil, j, 0))
+}
+
+// appendJsonb prints a document, on one line when level is negative and indented otherwise
+func appendJsonb(buf []byte, j *Jsonb, level int) []byte {
+	newline := func(buf []byte, level int) []byte {
+		buf = append(buf, '\n')
+		for i := 0; i < level; i++ {
+			buf = append(buf, "    "...)
+		}
+		return buf
+	}
+	switch j.kind {
+	case jbvNull:
+		return append(buf, "null"...)
+	case jbvString:
+		return escapeJson(buf, j.str)
+	case jbvNumeric:
+		return append(buf, j.num.String()...)
+	case jbvBool:
+		if j.boolean {
+			return append(buf, "true"...)
+		}
+		return append(buf, "false"...)
+	case jbvArray:
+		buf = append(buf, '[')
+		for i, elem := range j.elems {
+			if i > 0 {
+				buf = append(buf, ',')
+				if level < 0 {
+					buf = append(buf, ' ')
+				}
+			}
+			if level >= 0 {
+				buf = newline(buf, level+1)
+				buf = appendJsonb(buf, elem, level+1)
+			} else {
+				buf = appendJsonb(buf, elem, level)
+			}
+		}
+		if level >= 0 && len(j.elems) > 0 {
+			buf = newline(buf, level)
+		}
+		return append(buf, ']')
+	}
+	buf = append(buf, '{')
+	for i, pair := range j.pairs {
+		if i > 0 {
+			buf = append(buf, ',')
+			if level < 0 {
+				buf = append(buf, ' ')
+			}
+		}
+		next := level
+		if level >= 0 {
+			next = level + 1
+			buf = newline(buf, next)
+		}
+		buf = escapeJson(buf, pair.key)
+		buf = append(buf, ": "...)
+		buf = appendJsonb(buf, pair.value, next)
+	}
+	if level >= 0 && len(j.pairs) > 0 {
+		buf = newline(buf, level)
+	}
+	return append(buf, '}')
+}
+
+// The binary wire format is a version number and the text
+const jsonbVersion = 1
+
+func jsonbRecv(buf []byte) (types.Datum, error) {
+	if len(buf) == 0 || buf[0] != jsonbVersion {
+		return nil, fmt.Errorf("unsupported jsonb version number")
+	}
+	return parseJson(string(buf[1:]), "jsonb", false)
+}
+
+func jsonbSend(d types.Datum) []byte {
+	return append([]byte{jsonbVersion}, jsonbText(d.(*Jsonb))...)
+}
+
+func jsonbKindRank(kind jsonbKind) int {
+	switch kind {
+	case jbvNull:
+		return 0
+	case jbvString:
+		return 1
+	case jbvNumeric:
+		return 2
+	case jbvBool:
+		return 3
+	case jbvArray:
+		return 4
+	}
+	return 5
+}
+
+func jsonbCmp(a types.Datum, b types.Datum) int {
+	ja, jb := a.(*Jsonb), b.(*Jsonb)
+	//A top level scalar is a one element array
+	switch {
+	case ja.isScalar() && jb.kind == jbvArray:
+		if len(jb.elems) == 0 {
+			return 1
+		}
+		return -1
+	case ja.kind == jbvArray && jb.isScalar():
+		if len(ja.elems) == 0 {
+			return -1
+		}
+		return 1
+	}
+	return compareJsonb(ja, jb)
+}
+
+func compareJsonb(a *Jsonb, b *Jsonb) int {
+	if a.kind != b.kind {
+		return compareOrdered(int64(jsonbKindRank(a.kind)), int64(jsonbKindRank(b.kind)))
+	}
+	switch a.kind {
+	case jbvString:
+		return strings.Compare(a.str, b.str)
+	case jbvNumeric:
+		return a.num.Cmp(b.num)
+	case jbvBool:
+		return boolCmp(a.boolean, b.boolean)
+	case jbvArray:
+		if len(a.elems) != len(b.elems) {
+			return compareOrdered(int64(len(a.elems)), int64(len(b.elems)))
+		}
+		for i := range a.elems {
+			if cmp := compareJsonb(a.elems[i], b.elems[i]); cmp != 0 {
+				return cmp
+			}
+		}
+	case jbvObject:
+		if len(a.pairs) != len(b.pairs) {
+			return compareOrdered(int64(len(a.pairs)), int64(len(b.pairs)))
+		}
+		for i := range a.pairs {
+			if cmp := compareJsonbKeys(a.pairs[i].key, b.pairs[i].key); cmp != 0 {
+				return cmp
+			}
+			if cmp := compareJsonb(a.pairs[i].value, b.pairs[i].value); cmp != 0 {
+				return cmp
+			}
+		}
+	}
+	return 0
+}
+
+func hashJsonb(buf []byte, d types.Datum) []byte {
+	j := d.(*Jsonb)
+	buf = append(buf, byte(j.kind))
+	switch j.kind {
+	case jbvString:
+		buf = hashText(buf, j.str)
+	case jbvNumeric:
+		buf = hashNumeric(buf, j.num)
+	case jbvBool:
+		buf = hashBool(buf, j.boolean)
+	case jbvArray:
+		buf = binary.AppendUvarint(buf, uint64(len(j.elems)))
+		for _, elem := range j.elems {
+			buf = hashJsonb(buf, elem)
+		}
+	case jbvObject:
+		buf = binary.AppendUvarint(buf, uint64(len(j.pairs)))
+		for _, pair := range j.pairs {
+			buf = hashText(buf, pair.key)
+			buf = hashJsonb(buf, pair.value)
+		}
+	}
+	return buf
+}
+
+// JsonbSize is a rough estimate of the memory a document takes, for the executor's work_mem accounting
+func JsonbSize(j *Jsonb) int {
+	size := 64
+	switch j.kind {
+	case jbvString:
+		size += len(j.str)
+	case jbvArray:
+		for _, elem := range j.elems {
+			size += JsonbSize(elem)
+		}
+	case jbvObject:
+		for _, pair := range j.pairs {
+			size += 16 + len(pair.key) + JsonbSize(pair.value)
+		}
+	}
+	return size
+}
+
+/*
+EncodeJsonb and DecodeJsonb are the form the executor's temporary files keep documents in, so they are
+not parsed again when read back: a kind byte and the value, lengths as uvarints
+*/
+func EncodeJsonb(buf []byte, j *Jsonb) []byte {
+	buf = append(buf, byte(j.kind))
+	switch j.kind {
+	case jbvString:
+		buf = binary.AppendUvarint(buf, uint64(len(j.str)))
+		buf = append(buf, j.str...)
+	case jbvNumeric:
+		text := j.num.String()
+		buf = binary.AppendUvarint(buf, uint64(len(text)))
+		buf = append(buf, text...)
+	case jbvBool:
+		if j.boolean {
+			buf = append(buf, 1)
+		} else {
+			buf = append(buf, 0)
+		}
+	case jbvArray:
+		buf = binary.AppendUvarint(buf, uint64(len(j.elems)))
+		for _, elem := range j.elems {
+			buf = EncodeJsonb(buf, elem)
+		}
+	case jbvObject:
+		buf = binary.AppendUvarint(buf, uint64(len(j.pairs)))
+		for _, pair := range j.pairs {
+			buf = binary.AppendUvarint(buf, uint64(len(pair.key)))
+			buf = append(buf, pair.key...)
+			buf = EncodeJsonb(buf, pair.value)
+		}
+	}
+	return buf
+}
+
+func DecodeJsonb(buf []byte) (*Jsonb, []byte, error) {
+	corrupted := fmt.Errorf("corrupted jsonb value")
+	readString := func() (string, error) {
+		length, n := binary.Uvarint(buf)
+		if n <= 0 || uint64(len(buf)-n) < length {
+			return "", corrupted
+		}
+		str := string(buf[n : n+int(length)])
+		buf = buf[n+int(length):]
+		return str, nil
+	}
+	readCount := func() (int, error) {
+		count, n := binary.Uvarint(buf)
+		if n <= 0 {
+			return 0, corrupted
+		}
+		buf = buf[n:]
+		return int(count), nil
+	}
+
+	if len(buf) == 0 {
+		return nil, nil, corrupted
+	}
+	j := &Jsonb{kind: jsonbKind(buf[0])}
+	buf = buf[1:]
+	var err error
+	switch j.kind {
+	case jbvNull:
+	case jbvString:
+		j.str, err = readString()
+	case jbvNumeric:
+		var text string
+		if text, err = readString(); err == nil {
+			j.num, err = ParseNumeric(text)
+		}
+	case jbvBool:
+		if len(buf) == 0 {
+			return nil, nil, corrupted
+		}
+		j.boolean, buf = buf[0] == 1, buf[1:]
+	case jbvArray:
+		var count int
+		if count, err = readCount(); err != nil {
+			return nil, nil, err
+		}
+		j.elems = make([]*Jsonb, count)
+		for i := range j.elems {
+			if j.elems[i], buf, err = DecodeJsonb(buf); err != nil {
+				return nil, nil, err
+			}
+		}
+	case jbvObject:
+		var count int
+		if count, err = readCount(); err != nil {
+			return nil, nil, err
+		}
+		j.pairs = make([]jsonbPair, count)
+		for i := range j.pairs {
+			if j.pairs[i].key, err = readString(); err != nil {
+				return nil, nil, err
+			}
+			if j.pairs[i].value, buf, err = DecodeJsonb(buf); err != nil {
+				return nil, nil, err
+			}
+		}
+	default:
+		return nil, nil, corrupted
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return j, buf, nil
+}
+
+/*
+ToJsonb is to_jsonb, the document a value of any type becomes (postgres datum_to_jsonb):
+numbers and booleans stay what they are, json is parsed, arrays become JSON arrays and anything
+else a string of its text form. Numbers that are not finite become strings
+*/
+func ToJsonb(d types.Datum, settings *Settings) (*Jsonb, error) {
+	switch v := d.(type) {
+	case nil:
+		return &Jsonb{kind: jbvNull}, nil
+	case bool:
+		return &Jsonb{kind: jbvBool, boolean: v}, nil
+	case int64:
+		return &Jsonb{kind: jbvNumeric, num: NumericFromInt64(v)}, nil
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return &Jsonb{kind: jbvString, str: formatFloat8(v)}, nil
+		}
+		return &Jsonb{kind: jbvNumeric, num: NumericFromFloat64(v)}, nil
+	case Numeric:
+		if v.kind != numericFinite {
+			return &Jsonb{kind: jbvString, str: v.String()}, nil
+		}
+		return &Jsonb{kind: jbvNumeric, num: v}, nil
+	case string:
+		return &Jsonb{kind: jbvString, str: v}, nil
+	case Json:
+		//json keeps what jsonb cannot hold, a \u0000 escape fails here
+		return parseJson(string(v), "jsonb", false)
+	case *Jsonb:
+		return v, nil
+	case []types.Datum:
+		array := &Jsonb{kind: jbvArray, elems: make([]*Jsonb, len(v))}
+		for i, elem := range v {
+			value, err := ToJsonb(elem, settings)
+			if err != nil {
+				return nil, err
+			}
+			array.elems[i] = value
+		}
+		return array, nil
+	}
+	return &Jsonb{kind: jbvString, str: jsonScalarText(d, settings)}, nil
+}
+
+// jsonbBuildObject is jsonb_build_object(k1, v1, k2, v2, ...)
+func jsonbBuildObject(args []types.Datum, settings *Settings) (types.Datum, error) {
+	if len(args)%2 != 0 {
+		return nil, fmt.Errorf("argument list must have even number of elements")
+	}
+	object := &Jsonb{kind: jbvObject}
+	for i := 0; i < len(args); i += 2 {
+		key, err := jsonObjectKey(args[i], i+1, settings)
+		if err != nil {
+			return nil, err
+		}
+		value, err := ToJsonb(args[i+1], settings)
+		if err != nil {
+			return nil, err
+		}
+		object.pairs = append(object.pairs, jsonbPair{key: key, value: value})
+	}
+	object.normalizeObject()
+	return object, nil
+}
+
+func jsonbBuildArray(args []types.Datum, settings *Settings) (types.Datum, error) {
+	return ToJsonb(args, settings)
+}
+
+/*
+JsonbAggState accumulates jsonb_agg and jsonb_object_agg. The object is sorted once at the end, with
+the last value of a key added twice winning
+*/
+type JsonbAggState struct {
+	value    *Jsonb
+	settings *Settings
+}
+
+func NewJsonbAggState(object bool, settings *Settings) *JsonbAggState {
+	if object {
+		return &JsonbAggState{value: &Jsonb{kind: jbvObject}, settings: settings}
+	}
+	return &JsonbAggState{value: &Jsonb{kind: jbvArray}, settings: settings}
+}
+
+// Add appends one value, key is only used by jsonb_object_agg. Returns the bytes the state grew by
+func (s *JsonbAggState) Add(key types.Datum, value types.Datum) (int, error) {
+	elem, err := ToJsonb(value, s.settings)
+	if err != nil {
+		return 0, err
+	}
+	if s.value.kind == jbvArray {
+		s.value.elems = append(s.value.elems, elem)
+		return 16 + len(EncodeJsonb(nil, elem)), nil
+	}
+	if key == nil {
+		return 0, fmt.Errorf("field name must not be null")
+	}
+	name, err := jsonObjectKey(key, 1, s.settings)
+	if err != nil {
+		return 0, err
+	}
+	s.value.pairs = append(s.value.pairs, jsonbPair{key: name, value: elem})
+	return 32 + len(name) + len(EncodeJsonb(nil, elem)), nil
+}
+
+// Result is the aggregate's value, NULL when no row was added
+func (s *JsonbAggState) Result() types.Datum {
+	if len(s.value.elems) == 0 && len(s.value.pairs) == 0 {
+		return nil
+	}
+	if s.value.kind == jbvObject {
+		s.value.normalizeObject()
+	}
+	return s.value
+}
+
+// scalarText is the text ->> returns for a value: strings without quotes, NULL for null
+func (j *Jsonb) scalarText() types.Datum {
+	switch j.kind {
+	case jbvNull:
+		return nil
+	case jbvString:
+		return j.str
+	}
+	if j.raw != "" {
+		return j.raw
+	}
+	return jsonbText(j)
+}
+
+// jsonbEqual tells if two values are the same
+func jsonbEqual(a *Jsonb, b *Jsonb) bool {
+	return a.kind == b.kind && compareJsonb(a, b) == 0
+}
+
+/*
+jsonbContains is @> (postgres JsonbDeepContains): every pair of an object on the right must be in the
+object on the left with a value containing the right one's, every element of an array on the right must
+be contained by some element of the array on the left. At the top, an array contains a scalar that is one
+of its elements
+*/
+func jsonbContains(a *Jsonb, b *Jsonb) bool {
+	if a.kind == jbvArray && b.isScalar() {
+		for _, elem := range a.elems {
+			if elem.isScalar() && jsonbEqual(elem, b) {
+				return true
+			}
+		}
+		return false
+	}
+	return jsonbDeepContains(a, b)
+}
+
+func jsonbDeepContains(a *Jsonb, b *Jsonb) bool {
+	if a.kind != b.kind {
+		return false
+	}
+	switch a.kind {
+	case jbvObject:
+		for _, pair := range b.pairs {
+			value := a.findKey(pair.key)
+			if value == nil {
+				return false
+			}
+			if value.isScalar() || pair.value.isScalar() {
+				if !jsonbEqual(value, pair.value) {
+					return false
+				}
+			} else if !jsonbDeepContains(value, pair.value) {
+				return false
+			}
+		}
+		return true
+	case jbvArray:
+	elements:
+		for _, want := range b.elems {
+			for _, elem := range a.elems {
+				switch {
+				case want.isScalar():
+					if elem.isScalar() && jsonbEqual(elem, want) {
+						continue elements
+					}
+				case jsonbDeepContains(elem, want):
+					continue elements
+				}
+			}
+			return false
+		}
+		return true
+	}
+	return jsonbEqual(a, b)
+}
+
+// jsonbExists is ?, a key of an object at the top, a string element of an array or the string itself
+func jsonbExists(j *Jsonb, key string) bool {
+	switch j.kind {
+	case jbvObject:
+		return j.findKey(key) != nil
+	case jbvArray:
+		for _, elem := range j.elems {
+			if elem.kind == jbvString && elem.str == key {
+				return true
+			}
+		}
+		return false
+	case jbvString:
+		return j.str == key
+	}
+	return false
+}
+
+// jsonbConcat is ||: objects are merged (the right one's keys win), anything else becomes one array
+func jsonbConcat(a *Jsonb, b *Jsonb) *Jsonb {
+	if a.kind == jbvObject && b.kind == jbvObject {
+		merged := &Jsonb{kind: jbvObject, pairs: append(append([]jsonbPair{}, a.pairs...), b.pairs...)}
+		merged.normalizeObject()
+		return merged
+	}
+	elemsOf := func(j *Jsonb) []*Jsonb {
+		if j.kind == jbvArray {
+			return j.elems
+		}
+		return []*Jsonb{j}
+	}
+	return &Jsonb{kind: jbvArray, elems: append(append([]*Jsonb{}, elemsOf(a)...), elemsOf(b)...)}
+}
+
+// jsonbDeleteKey is jsonb - text, removing a key from an object or matching strings from an array
+func jsonbDeleteKey(j *Jsonb, key string) (*Jsonb, error) {
+	switch j.kind {
+	case jbvObject:
+		result := &Jsonb{kind: jbvObject}
+		for _, pair := range j.pairs {
+			if pair.key != key {
+				result.pairs = append(result.pairs, pair)
+			}
+		}
+		return result, nil
+	case jbvArray:
+		result := &Jsonb{kind: jbvArray, elems: []*Jsonb{}}
+		for _, elem := range j.elems {
+			if elem.kind != jbvString || elem.str != key {
+				result.elems = append(result.elems, elem)
+			}
+		}
+		return result, nil
+	}
+	return nil, fmt.Errorf("cannot delete from scalar")
+}
+
+// jsonbDeleteIndex is jsonb - integer, negative indexes count from the end
+func jsonbDeleteIndex(j *Jsonb, index int64) (*Jsonb, error) {
+	switch j.kind {
+	case jbvObject:
+		return nil, fmt.Errorf("cannot delete from object using integer index")
+	case jbvArray:
+	default:
+		return nil, fmt.Errorf("cannot delete from scalar")
+	}
+	if index < 0 {
+		index += int64(len(j.elems))
+	}
+	if index < 0 || index >= int64(len(j.elems)) {
+		return j, nil
+	}
+	elems := append(append([]*Jsonb{}, j.elems[:index]...), j.elems[index+1:]...)
+	return &Jsonb{kind: jbvArray, elems: elems}, nil
+}
+
+/*
+jsonbSetPath is what jsonb_set, jsonb_insert and #- have in common (postgres setPath): it follows path
+down the document and calls change with the value at its end (nil when the last step finds nothing),
+change returns the new value or nil to remove it. Steps into arrays are integers, a step that finds
+nothing leaves the document as it is unless it is the last one
+*/
+func jsonbSetPath(j *Jsonb, path []types.Datum, change func(old *Jsonb) *Jsonb) (*Jsonb, error) {
+	return setPath(j, path, 0, change)
+}
+
+func setPath(j *Jsonb, path []types.Datum, level int, change func(old *Jsonb) *Jsonb) (*Jsonb, error) {
+	if level == len(path) {
+		return j, nil
+	}
+	if path[level] == nil {
+		return nil, fmt.Errorf("path element at position %d is null", level+1)
+	}
+	step, last := path[level].(string), level == len(path)-1
+	switch j.kind {
+	case jbvObject:
+		result := &Jsonb{kind: jbvObject}
+		found := false
+		for _, pair := range j.pairs {
+			if pair.key != step {
+				result.pairs = append(result.pairs, pair)
+				continue
+			}
+			found = true
+			value := pair.value
+			if last {
+				value = change(value)
+			} else {
+				var err error
+				if value, err = setPath(value, path, level+1, change); err != nil {
+					return nil, err
+				}
+			}
+			if value != nil {
+				result.pairs = append(result.pairs, jsonbPair{key: step, value: value})
+			}
+		}
+		if !found && last {
+			if value := change(nil); value != nil {
+				result.pairs = append(result.pairs, jsonbPair{key: step, value: value})
+				result.normalizeObject()
+			}
+		}
+		return result, nil
+	case jbvArray:
+		index, err := ParseNumeric(step)
+		if err != nil || index.scale != 0 {
+			return nil, fmt.Errorf("path element at position %d is not an integer: \"%s\"", level+1, step)
+		}
+		i, err := index.Int64()
+		if err != nil {
+			return nil, err
+		}
+		if i < 0 {
+			i += int64(len(j.elems))
+		}
+		result := &Jsonb{kind: jbvArray, elems: append([]*Jsonb{}, j.elems...)}
+		if i < 0 || i >= int64(len(j.elems)) {
+			//Past either end a new value goes at that end
+			if last {
+				if value := change(nil); value != nil {
+					if i < 0 {
+						result.elems = append([]*Jsonb{value}, result.elems...)
+					} else {
+						result.elems = append(result.elems, value)
+					}
+				}
+			}
+			return result, nil
+		}
+		value := j.elems[i]
+		if last {
+			value = change(value)
+		} else if value, err = setPath(value, path, level+1, change); err != nil {
+			return nil, err
+		}
+		if value == nil {
+			result.elems = append(result.elems[:i], result.elems[i+1:]...)
+		} else {
+			result.elems[i] = value
+		}
+		return result, nil
+	}
+	return j, nil
+}
+
+// jsonbStripNulls is jsonb_strip_nulls, removing object fields whose value is null at every level
+func jsonbStripNulls(j *Jsonb) *Jsonb {
+	switch j.kind {
+	case jbvObject:
+		result := &Jsonb{kind: jbvObject}
+		for _, pair := range j.pairs {
+			if pair.value.kind != jbvNull {
+				result.pairs = append(result.pairs, jsonbPair{key: pair.key, value: jsonbStripNulls(pair.value)})
+			}
+		}
+		return result
+	case jbvArray:
+		result := &Jsonb{kind: jbvArray, elems: make([]*Jsonb, len(j.elems))}
+		for i, elem := range j.elems {
+			result.elems[i] = jsonbStripNulls(elem)
+		}
+		return result
+	}
+	return j
+}
@@ -0,0 +1,63 @@
+package adt
+
+import (
+	"hash/fnv"
+	"slices"
+)
+
+/*
+Index keys of jsonb documents for containment (postgres utils/adt/jsonb_gin.c, the jsonb_path_ops class)
+
+Each scalar of a document gives one key: a hash of the object keys on the way down to it together with the
+scalar itself. Array elements do not add to the path, so '{"a": [1, 2]}' gives the keys of a.1 and a.2.
+If a document contains a query (@>) every key of the query is a key of the document, an inverted index
+from keys to documents finds the candidates for doc @> query by intersecting the lists of the query's keys.
+Keys are hashes, candidates must still be checked with @>.
+
+These are what a gin index (access/gin.go) stores and looks up
+*/
+
+// jsonbPathHash extends the hash of a path by one object key (postgres JsonbHashScalarValue on a key)
+func jsonbPathHash(path uint32, key string) uint32 {
+	h := fnv.New32a()
+	h.Write(hashText(nil, key))
+	return (path<<1 | path>>31) ^ h.Sum32()
+}
+
+func jsonbLeafKey(path uint32, scalar *Jsonb) uint32 {
+	h := fnv.New32a()
+	h.Write(hashJsonb(nil, scalar))
+	return (path<<1 | path>>31) ^ h.Sum32()
+}
+
+func appendJsonbPathKeys(keys []uint32, j *Jsonb, path uint32) []uint32 {
+	switch j.kind {
+	case jbvArray:
+		for _, elem := range j.elems {
+			keys = appendJsonbPathKeys(keys, elem, path)
+		}
+	case jbvObject:
+		for _, pair := range j.pairs {
+			keys = appendJsonbPathKeys(keys, pair.value, jsonbPathHash(path, pair.key))
+		}
+	default:
+		keys = append(keys, jsonbLeafKey(path, j))
+	}
+	return keys
+}
+
+// JsonbPathOpsKeys returns the index keys of a document, sorted and without duplicates
+func JsonbPathOpsKeys(j *Jsonb) []uint32 {
+	keys := appendJsonbPathKeys(nil, j, 0)
+	slices.Sort(keys)
+	return slices.Compact(keys)
+}
+
+/*
+JsonbContainmentQueryKeys returns the keys a document must have to contain query. ok is false when the
+query has no scalars ('{}' or '[]'), every document may contain it and the index cannot narrow the search
+*/
+func JsonbContainmentQueryKeys(query *Jsonb) (keys []uint32, ok bool) {
+	keys = JsonbPathOpsKeys(query)
+	return keys, len(keys) > 0
+}
@@ -0,0 +1,39 @@
+package adt
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/rautNishan/diskquery/types"
+)
+
+func TestToJsonb(t *testing.T) {
+	for _, test := range []struct {
+		value types.Datum
+		want  string
+	}{
+		{nil, "null"},
+		{[]types.Datum{int64(1), "a", nil, true}, `[1, "a", null, true]`},
+		{Json(`{"b": 1, "a": [2, {"c": 3}], "b": 4}`), `{"a": [2, {"c": 3}], "b": 4}`},
+		{Date(0), `"2000-01-01"`},
+	} {
+		got, err := ToJsonb(test.value, &DefaultSettings)
+		if err != nil {
+			t.Errorf("ToJsonb(%v): %v", test.value, err)
+			continue
+		}
+		if text := OutputDatum(got, &DefaultSettings); text != test.want {
+			t.Errorf("ToJsonb(%v) = %s, want %s", test.value, text, test.want)
+		}
+	}
+
+	//json that is not valid, or holds what jsonb cannot, is an error and not a panic
+	for _, value := range []types.Datum{Json(`{"a": `), Json(`"\u0000"`), []types.Datum{Json(`[1,`)}} {
+		if _, err := ToJsonb(value, &DefaultSettings); err == nil {
+			t.Errorf("ToJsonb(%v) did not fail", value)
+		}
+	}
+	if _, err := Json(`[1, 2`).parse(); err == nil || !strings.Contains(err.Error(), "invalid input syntax for type json") {
+		t.Errorf("parse of a broken json value gave %v", err)
+	}
+}
@@ -0,0 +1,395 @@
+package adt
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+Operators and functions of json, jsonb and jsonpath (postgres utils/adt/jsonfuncs.c and jsonb_op.c)
+
+  - -> and ->> take an object field by key or an array element by index (negative from the end),
+    ->> gives text. #> and #>> follow a path of keys and indexes given as text[]
+  - jsonb @> jsonb and <@ are containment, ? ?| ?& test for top level keys (or string elements)
+  - jsonb || jsonb concatenates, - deletes a key, an index or several keys, #- deletes at a path
+  - jsonb @? jsonpath tells if the path selects anything, @@ is the boolean result of a path predicate
+A json value is text, operators on json parse it and give the pieces as they were written. Where
+a json object has a key twice the last one is found, as postgres does
+*/
+
+// jsonExtractPath follows a path of keys and array indexes, nil when a step finds nothing
+func jsonExtractPath(j *Jsonb, path []types.Datum, lastKey bool) *Jsonb {
+	for _, step := range path {
+		if step == nil {
+			return nil
+		}
+		switch j.kind {
+		case jbvObject:
+			if lastKey {
+				j = j.findLastKey(step.(string))
+			} else {
+				j = j.findKey(step.(string))
+			}
+		case jbvArray:
+			index, err := strconv.ParseInt(step.(string), 10, 64)
+			if err != nil {
+				return nil
+			}
+			j = j.arrayElement(index)
+		default:
+			return nil
+		}
+		if j == nil {
+			return nil
+		}
+	}
+	return j
+}
+
+func jsonField(j *Jsonb, key types.Datum, lastKey bool) *Jsonb {
+	switch k := key.(type) {
+	case string:
+		if j.kind != jbvObject {
+			return nil
+		}
+		if lastKey {
+			return j.findLastKey(k)
+		}
+		return j.findKey(k)
+	case int64:
+		return j.arrayElement(k)
+	}
+	return nil
+}
+
+// jsonbDatum and jsonDatum return a piece found by an operator, NULL when there was none
+func jsonbDatum(j *Jsonb) types.Datum {
+	if j == nil {
+		return nil
+	}
+	return j
+}
+
+func jsonDatum(j *Jsonb) types.Datum {
+	if j == nil {
+		return nil
+	}
+	return j.asJson()
+}
+
+func jsonText(j *Jsonb) types.Datum {
+	if j == nil {
+		return nil
+	}
+	return j.scalarText()
+}
+
+// stringsOf gives the non NULL strings of a text[]
+func stringsOf(d types.Datum) []string {
+	var result []string
+	for _, elem := range d.([]types.Datum) {
+		if elem != nil {
+			result = append(result, elem.(string))
+		}
+	}
+	return result
+}
+
+// jsonbToScalar converts a jsonb scalar for the casts to numeric, double precision, bigint and boolean
+func jsonbToScalar(want jsonbKind, target types.Oid, convert func(d types.Datum) (types.Datum, error)) func(d types.Datum) (types.Datum, error) {
+	return func(d types.Datum) (types.Datum, error) {
+		j := d.(*Jsonb)
+		if j.kind != want {
+			return nil, fmt.Errorf("cannot cast jsonb %s to type %s", jsonTypeof(j), TypeName(target))
+		}
+		if want == jbvBool {
+			return j.boolean, nil
+		}
+		return convert(j.num)
+	}
+}
+
+// jsonbPathArgs reads the (target, path [, vars [, silent]]) arguments of the jsonb_path functions
+func jsonbPathArgs(args []types.Datum) (*Jsonb, *JsonPath, *Jsonb, bool) {
+	var vars *Jsonb
+	silent := false
+	if len(args) > 2 {
+		vars = args[2].(*Jsonb)
+	}
+	if len(args) > 3 {
+		silent = args[3].(bool)
+	}
+	return args[0].(*Jsonb), args[1].(*JsonPath), vars, silent
+}
+
+func init() {
+	const (
+		json      = types.JSONOID
+		jsonb     = types.JSONBOID
+		jsonpath  = types.JSONPATHOID
+		text      = types.TEXTOID
+		textArray = types.TEXTARRAYOID
+		int8      = types.INT8OID
+		float8    = types.FLOAT8OID
+		numeric   = types.NUMERICOID
+		boolean   = types.BOOLOID
+		anyType   = types.ANYOID
+	)
+
+	//Field and element access
+	for _, key := range []types.Oid{text, int8} {
+		addOperator("->", json, key, json, func(l, r types.Datum) (types.Datum, error) {
+			doc, err := l.(Json).parse()
+			if err != nil {
+				return nil, err
+			}
+			return jsonDatum(jsonField(doc, r, true)), nil
+		})
+		addOperator("->>", json, key, text, func(l, r types.Datum) (types.Datum, error) {
+			doc, err := l.(Json).parse()
+			if err != nil {
+				return nil, err
+			}
+			return jsonText(jsonField(doc, r, true)), nil
+		})
+		addOperator("->", jsonb, key, jsonb, func(l, r types.Datum) (types.Datum, error) {
+			return jsonbDatum(jsonField(l.(*Jsonb), r, false)), nil
+		})
+		addOperator("->>", jsonb, key, text, func(l, r types.Datum) (types.Datum, error) {
+			return jsonText(jsonField(l.(*Jsonb), r, false)), nil
+		})
+	}
+	addOperator("#>", json, textArray, json, func(l, r types.Datum) (types.Datum, error) {
+		doc, err := l.(Json).parse()
+		if err != nil {
+			return nil, err
+		}
+		return jsonDatum(jsonExtractPath(doc, r.([]types.Datum), true)), nil
+	})
+	addOperator("#>>", json, textArray, text, func(l, r types.Datum) (types.Datum, error) {
+		doc, err := l.(Json).parse()
+		if err != nil {
+			return nil, err
+		}
+		return jsonText(jsonExtractPath(doc, r.([]types.Datum), true)), nil
+	})
+	addOperator("#>", jsonb, textArray, jsonb, func(l, r types.Datum) (types.Datum, error) {
+		return jsonbDatum(jsonExtractPath(l.(*Jsonb), r.([]types.Datum), false)), nil
+	})
+	addOperator("#>>", jsonb, textArray, text, func(l, r types.Datum) (types.Datum, error) {
+		return jsonText(jsonExtractPath(l.(*Jsonb), r.([]types.Datum), false)), nil
+	})
+
+	//Containment and existence
+	addOperator("@>", jsonb, jsonb, boolean, func(l, r types.Datum) (types.Datum, error) {
+		return jsonbContains(l.(*Jsonb), r.(*Jsonb)), nil
+	})
+	addOperator("<@", jsonb, jsonb, boolean, func(l, r types.Datum) (types.Datum, error) {
+		return jsonbContains(r.(*Jsonb), l.(*Jsonb)), nil
+	})
+	addOperator("?", jsonb, text, boolean, func(l, r types.Datum) (types.Datum, error) {
+		return jsonbExists(l.(*Jsonb), r.(string)), nil
+	})
+	addOperator("?|", jsonb, textArray, boolean, func(l, r types.Datum) (types.Datum, error) {
+		for _, key := range stringsOf(r) {
+			if jsonbExists(l.(*Jsonb), key) {
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+	addOperator("?&", jsonb, textArray, boolean, func(l, r types.Datum) (types.Datum, error) {
+		for _, key := range stringsOf(r) {
+			if !jsonbExists(l.(*Jsonb), key) {
+				return false, nil
+			}
+		}
+		return true, nil
+	})
+
+	//Building and taking apart
+	addOperator("||", jsonb, jsonb, jsonb, func(l, r types.Datum) (types.Datum, error) {
+		return jsonbConcat(l.(*Jsonb), r.(*Jsonb)), nil
+	})
+	addOperator("-", jsonb, text, jsonb, func(l, r types.Datum) (types.Datum, error) {
+		return jsonbDeleteKey(l.(*Jsonb), r.(string))
+	})
+	addOperator("-", jsonb, int8, jsonb, func(l, r types.Datum) (types.Datum, error) {
+		return jsonbDeleteIndex(l.(*Jsonb), r.(int64))
+	})
+	addOperator("-", jsonb, textArray, jsonb, func(l, r types.Datum) (types.Datum, error) {
+		j := l.(*Jsonb)
+		for _, key := range stringsOf(r) {
+			var err error
+			if j, err = jsonbDeleteKey(j, key); err != nil {
+				return nil, err
+			}
+		}
+		return j, nil
+	})
+	addOperator("#-", jsonb, textArray, jsonb, func(l, r types.Datum) (types.Datum, error) {
+		j := l.(*Jsonb)
+		if j.isScalar() {
+			return nil, fmt.Errorf("cannot delete path in scalar")
+		}
+		return jsonbSetPath(j, r.([]types.Datum), func(*Jsonb) *Jsonb { return nil })
+	})
+
+	//Path queries, errors of the path are NULL
+	addOperator("@?", jsonb, jsonpath, boolean, func(l, r types.Datum) (types.Datum, error) {
+		return jsonbPathExists(l.(*Jsonb), r.(*JsonPath), nil, true)
+	})
+	addOperator("@@", jsonb, jsonpath, boolean, func(l, r types.Datum) (types.Datum, error) {
+		return jsonbPathMatch(l.(*Jsonb), r.(*JsonPath), nil, true)
+	})
+
+	addFunction("to_json", []types.Oid{anyType}, json, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		return ToJson(fcinfo.Args[0], fcinfo.Settings), nil
+	})
+	addFunction("to_jsonb", []types.Oid{anyType}, jsonb, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		return ToJsonb(fcinfo.Args[0], fcinfo.Settings)
+	})
+
+	//The build functions take NULLs as JSON nulls
+	addFunction("json_build_object", nil, json, func(*FunctionCallInfo) (types.Datum, error) {
+		return Json("{}"), nil
+	})
+	addFunction("json_build_object", []types.Oid{anyType}, json, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		return jsonBuildObject(fcinfo.Args, fcinfo.Settings)
+	}).setVariadic().Strict = false
+	addFunction("jsonb_build_object", nil, jsonb, func(*FunctionCallInfo) (types.Datum, error) {
+		return &Jsonb{kind: jbvObject}, nil
+	})
+	addFunction("jsonb_build_object", []types.Oid{anyType}, jsonb, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		return jsonbBuildObject(fcinfo.Args, fcinfo.Settings)
+	}).setVariadic().Strict = false
+	addFunction("json_build_array", nil, json, func(*FunctionCallInfo) (types.Datum, error) {
+		return Json("[]"), nil
+	})
+	addFunction("json_build_array", []types.Oid{anyType}, json, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		return jsonBuildArray(fcinfo.Args, fcinfo.Settings), nil
+	}).setVariadic().Strict = false
+	addFunction("jsonb_build_array", nil, jsonb, func(*FunctionCallInfo) (types.Datum, error) {
+		return &Jsonb{kind: jbvArray}, nil
+	})
+	addFunction("jsonb_build_array", []types.Oid{anyType}, jsonb, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		return jsonbBuildArray(fcinfo.Args, fcinfo.Settings)
+	}).setVariadic().Strict = false
+
+	//json_extract_path(from, VARIADIC path) is from #> path
+	addFunction("json_extract_path", []types.Oid{json, text}, json, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		doc, err := fcinfo.Args[0].(Json).parse()
+		if err != nil {
+			return nil, err
+		}
+		return jsonDatum(jsonExtractPath(doc, fcinfo.Args[1:], true)), nil
+	}).setVariadic()
+	addFunction("json_extract_path_text", []types.Oid{json, text}, text, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		doc, err := fcinfo.Args[0].(Json).parse()
+		if err != nil {
+			return nil, err
+		}
+		return jsonText(jsonExtractPath(doc, fcinfo.Args[1:], true)), nil
+	}).setVariadic()
+	addFunction("jsonb_extract_path", []types.Oid{jsonb, text}, jsonb, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		return jsonbDatum(jsonExtractPath(fcinfo.Args[0].(*Jsonb), fcinfo.Args[1:], false)), nil
+	}).setVariadic()
+	addFunction("jsonb_extract_path_text", []types.Oid{jsonb, text}, text, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		return jsonText(jsonExtractPath(fcinfo.Args[0].(*Jsonb), fcinfo.Args[1:], false)), nil
+	}).setVariadic()
+
+	addFunction("json_typeof", []types.Oid{json}, text, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		doc, err := fcinfo.Args[0].(Json).parse()
+		if err != nil {
+			return nil, err
+		}
+		return jsonTypeof(doc), nil
+	})
+	addFunction("jsonb_typeof", []types.Oid{jsonb}, text, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		return jsonTypeof(fcinfo.Args[0].(*Jsonb)), nil
+	})
+	arrayLength := func(j *Jsonb) (types.Datum, error) {
+		switch j.kind {
+		case jbvArray:
+			return int64(len(j.elems)), nil
+		case jbvObject:
+			return nil, fmt.Errorf("cannot get array length of a non-array")
+		}
+		return nil, fmt.Errorf("cannot get array length of a scalar")
+	}
+	addFunction("json_array_length", []types.Oid{json}, int8, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		doc, err := fcinfo.Args[0].(Json).parse()
+		if err != nil {
+			return nil, err
+		}
+		return arrayLength(doc)
+	})
+	addFunction("jsonb_array_length", []types.Oid{jsonb}, int8, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		return arrayLength(fcinfo.Args[0].(*Jsonb))
+	})
+	addFunction("jsonb_pretty", []types.Oid{jsonb}, text, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		return jsonbPretty(fcinfo.Args[0].(*Jsonb)), nil
+	})
+	addFunction("jsonb_strip_nulls", []types.Oid{jsonb}, jsonb, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		return jsonbStripNulls(fcinfo.Args[0].(*Jsonb)), nil
+	})
+
+	//jsonb_set(target, path, new_value [, create_if_missing]) replaces the value at path, or adds it
+	jsonbSet := func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		target, replacement := fcinfo.Args[0].(*Jsonb), fcinfo.Args[2].(*Jsonb)
+		createMissing := len(fcinfo.Args) < 4 || fcinfo.Args[3].(bool)
+		if target.isScalar() {
+			return nil, fmt.Errorf("cannot set path in scalar")
+		}
+		return jsonbSetPath(target, fcinfo.Args[1].([]types.Datum), func(old *Jsonb) *Jsonb {
+			if old == nil && !createMissing {
+				return nil
+			}
+			return replacement
+		})
+	}
+	addFunction("jsonb_set", []types.Oid{jsonb, textArray, jsonb}, jsonb, jsonbSet)
+	addFunction("jsonb_set", []types.Oid{jsonb, textArray, jsonb, boolean}, jsonb, jsonbSet)
+
+	pathFunctions := map[string]func(*Jsonb, *JsonPath, *Jsonb, bool) (types.Datum, error){
+		"jsonb_path_exists":      jsonbPathExists,
+		"jsonb_path_match":       jsonbPathMatch,
+		"jsonb_path_query":       jsonbPathQuery,
+		"jsonb_path_query_array": jsonbPathQueryArray,
+		"jsonb_path_query_first": jsonbPathQueryFirst,
+	}
+	pathResults := map[string]types.Oid{
+		"jsonb_path_exists":      boolean,
+		"jsonb_path_match":       boolean,
+		"jsonb_path_query":       jsonb,
+		"jsonb_path_query_array": jsonb,
+		"jsonb_path_query_first": jsonb,
+	}
+	for name, fn := range pathFunctions {
+		call := func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+			return fn(jsonbPathArgs(fcinfo.Args))
+		}
+		//jsonb_path_query returns a row for every item found, like unnest
+		for _, argTypes := range [][]types.Oid{{jsonb, jsonpath}, {jsonb, jsonpath, jsonb}, {jsonb, jsonpath, jsonb, boolean}} {
+			fn := addFunction(name, argTypes, pathResults[name], call)
+			if name == "jsonb_path_query" {
+				fn.setRetset()
+			}
+		}
+	}
+
+	addCast(json, jsonb, COERCION_ASSIGNMENT, func(d types.Datum) (types.Datum, error) {
+		return parseJson(string(d.(Json)), "jsonb", false)
+	})
+	addCast(jsonb, json, COERCION_ASSIGNMENT, func(d types.Datum) (types.Datum, error) {
+		return Json(jsonbText(d.(*Jsonb))), nil
+	})
+	addCast(jsonb, numeric, COERCION_EXPLICIT, jsonbToScalar(jbvNumeric, numeric, func(d types.Datum) (types.Datum, error) {
+		return d, nil
+	}))
+	addCast(jsonb, float8, COERCION_EXPLICIT, jsonbToScalar(jbvNumeric, float8, numericToFloat8))
+	addCast(jsonb, int8, COERCION_EXPLICIT, jsonbToScalar(jbvNumeric, int8, numericToIntCast(int8)))
+	addCast(jsonb, boolean, COERCION_EXPLICIT, jsonbToScalar(jbvBool, boolean, nil))
+}
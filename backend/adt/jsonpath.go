@@ -0,0 +1,971 @@
+package adt
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+jsonpath (postgres utils/adt/jsonpath.c and jsonpath_gram.y)
+
+A path is read into a tree of items once, when the value is read, and printed back in postgres' normal
+form: '$.a ? (@ > 1)' prints as $."a"?(@ > 1). What a path selects from a document is in jsonpath_exec.go.
+
+  - lax or strict mode, lax is the default
+  - $ the document, @ the item a filter is looking at, $name a variable, last the last array index
+  - accessors: .key ."key" .* [subscripts] [*] .** .**{level} .**{from to last}
+  - filters ?(predicate), predicates compare with == != <> < <= > >= and combine with && || !,
+    exists(path), like_regex "pattern" flag "i", starts with "prefix", (predicate) is unknown
+  - arithmetic + - * / % and unary + -
+  - methods .type() .size() .double() .ceiling() .floor() .abs() .keyvalue()
+*/
+
+type jspItemType int
+
+const (
+	jpiNull jspItemType = iota
+	jpiString
+	jpiNumeric
+	jpiBool
+	jpiAnd
+	jpiOr
+	jpiNot
+	jpiIsUnknown
+	jpiEqual
+	jpiNotEqual
+	jpiLess
+	jpiGreater
+	jpiLessOrEqual
+	jpiGreaterOrEqual
+	jpiAdd
+	jpiSub
+	jpiMul
+	jpiDiv
+	jpiMod
+	jpiPlus
+	jpiMinus
+	jpiRoot
+	jpiCurrent
+	jpiVariable
+	jpiLast
+	jpiKey
+	jpiAnyKey
+	jpiIndexArray
+	jpiAnyArray
+	jpiAny
+	jpiFilter
+	jpiExists
+	jpiLikeRegex
+	jpiStartsWith
+	jpiType
+	jpiSize
+	jpiDouble
+	jpiCeiling
+	jpiFloor
+	jpiAbs
+	jpiKeyValue
+)
+
+// jspItem is one node of a path, next is the accessor applied to its result
+type jspItem struct {
+	typ        jspItemType
+	left       *jspItem //Operand of unary items, left operand of binary ones, the predicate of a filter
+	right      *jspItem
+	str        string //Key, variable name, string literal or like_regex pattern
+	flags      string //like_regex flags
+	regex      *regexp.Regexp
+	num        Numeric //Numeric literal
+	boolean    bool
+	subscripts []jspSubscript
+	first      uint32 //Levels of .**, anyLast stands for last
+	last       uint32
+	next       *jspItem
+}
+
+type jspSubscript struct {
+	from *jspItem
+	to   *jspItem //nil for a single index
+}
+
+const anyLast = ^uint32(0)
+
+// A JsonPath datum is the tree of a path and its mode
+type JsonPath struct {
+	lax  bool
+	expr *jspItem
+}
+
+var jspMethods = map[string]jspItemType{
+	"type":     jpiType,
+	"size":     jpiSize,
+	"double":   jpiDouble,
+	"ceiling":  jpiCeiling,
+	"floor":    jpiFloor,
+	"abs":      jpiAbs,
+	"keyvalue": jpiKeyValue,
+}
+
+type jspTokenType int
+
+const (
+	jspEOF jspTokenType = iota
+	jspIdent
+	jspString
+	jspNumber
+	jspVariable //$name, $"name"
+	jspOp       //Punctuation and operators, the text says which
+)
+
+type jspToken struct {
+	typ  jspTokenType
+	text string
+}
+
+type jspParser struct {
+	input  string
+	tokens []jspToken
+	pos    int
+}
+
+// lex splits a path into tokens, strings and quoted variable names lose their quotes and escapes
+func (p *jspParser) lex() error {
+	input := p.input
+	i := 0
+	for i < len(input) {
+		c := input[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			i++
+		case c == '"':
+			str, n, err := jspLexString(input[i:])
+			if err != nil {
+				return err
+			}
+			p.tokens = append(p.tokens, jspToken{typ: jspString, text: str})
+			i += n
+		case c == '$':
+			i++
+			switch {
+			case i < len(input) && input[i] == '"':
+				str, n, err := jspLexString(input[i:])
+				if err != nil {
+					return err
+				}
+				p.tokens = append(p.tokens, jspToken{typ: jspVariable, text: str})
+				i += n
+			case i < len(input) && isJspIdentChar(input[i]):
+				start := i
+				for i < len(input) && isJspIdentChar(input[i]) {
+					i++
+				}
+				p.tokens = append(p.tokens, jspToken{typ: jspVariable, text: input[start:i]})
+			default:
+				p.tokens = append(p.tokens, jspToken{typ: jspOp, text: "$"})
+			}
+		case c >= '0' && c <= '9' || c == '.' && i+1 < len(input) && input[i+1] >= '0' && input[i+1] <= '9' && !p.afterAccessorBase():
+			start := i
+			for i < len(input) && (input[i] >= '0' && input[i] <= '9') {
+				i++
+			}
+			//A point starts a fraction unless an accessor follows it, as in $[1.a]
+			if i+1 < len(input) && input[i] == '.' && input[i+1] >= '0' && input[i+1] <= '9' || i+1 == len(input) && i < len(input) && input[i] == '.' {
+				i++
+				for i < len(input) && input[i] >= '0' && input[i] <= '9' {
+					i++
+				}
+			}
+			if i < len(input) && (input[i] == 'e' || input[i] == 'E') {
+				j := i + 1
+				if j < len(input) && (input[j] == '+' || input[j] == '-') {
+					j++
+				}
+				if j < len(input) && input[j] >= '0' && input[j] <= '9' {
+					for j < len(input) && input[j] >= '0' && input[j] <= '9' {
+						j++
+					}
+					i = j
+				}
+			}
+			if i < len(input) && isJspIdentChar(input[i]) {
+				return fmt.Errorf("trailing junk after numeric literal at or near \"%s\" of jsonpath input", input[start:i+1])
+			}
+			p.tokens = append(p.tokens, jspToken{typ: jspNumber, text: input[start:i]})
+		case isJspIdentChar(c):
+			start := i
+			for i < len(input) && isJspIdentChar(input[i]) {
+				i++
+			}
+			p.tokens = append(p.tokens, jspToken{typ: jspIdent, text: input[start:i]})
+		default:
+			op := ""
+			for _, candidate := range []string{"**", "==", "!=", "<>", "<=", ">=", "&&", "||"} {
+				if strings.HasPrefix(input[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				if !strings.ContainsRune("@.*[](),?<>!+-/%{}", rune(c)) {
+					r, _ := utf8.DecodeRuneInString(input[i:])
+					return fmt.Errorf("syntax error at or near \"%s\" of jsonpath input", string(r))
+				}
+				op = input[i : i+1]
+			}
+			p.tokens = append(p.tokens, jspToken{typ: jspOp, text: op})
+			i += len(op)
+		}
+	}
+	p.tokens = append(p.tokens, jspToken{typ: jspEOF})
+	return nil
+}
+
+// afterAccessorBase tells if a point at this place is an accessor, $.1 is not a number
+func (p *jspParser) afterAccessorBase() bool {
+	if len(p.tokens) == 0 {
+		return false
+	}
+	last := p.tokens[len(p.tokens)-1]
+	switch last.typ {
+	case jspVariable, jspString:
+		return true
+	case jspOp:
+		return last.text == "$" || last.text == "@" || last.text == "]" || last.text == ")" || last.text == "*"
+	case jspIdent:
+		return last.text == "last"
+	}
+	return false
+}
+
+func isJspIdentChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c >= 0x80
+}
+
+// jspLexString reads a double quoted string with JSON and \xNN escapes, returns its length in the input
+func jspLexString(input string) (string, int, error) {
+	var builder strings.Builder
+	i := 1
+	for i < len(input) {
+		c := input[i]
+		switch c {
+		case '"':
+			return builder.String(), i + 1, nil
+		case '\\':
+			if i+1 >= len(input) {
+				return "", 0, fmt.Errorf("unexpected end of quoted string of jsonpath input")
+			}
+			escape := input[i+1]
+			i += 2
+			switch escape {
+			case 'b':
+				builder.WriteByte('\b')
+			case 'f':
+				builder.WriteByte('\f')
+			case 'n':
+				builder.WriteByte('\n')
+			case 'r':
+				builder.WriteByte('\r')
+			case 't':
+				builder.WriteByte('\t')
+			case 'v':
+				builder.WriteByte('\v')
+			case 'x':
+				if i+2 > len(input) {
+					return "", 0, fmt.Errorf("invalid hexadecimal character sequence of jsonpath input")
+				}
+				value, err := strconv.ParseUint(input[i:i+2], 16, 8)
+				if err != nil {
+					return "", 0, fmt.Errorf("invalid hexadecimal character sequence of jsonpath input")
+				}
+				builder.WriteRune(rune(value))
+				i += 2
+			case 'u':
+				if i+4 > len(input) {
+					return "", 0, fmt.Errorf("invalid Unicode escape sequence of jsonpath input")
+				}
+				value, err := strconv.ParseUint(input[i:i+4], 16, 16)
+				if err != nil {
+					return "", 0, fmt.Errorf("invalid Unicode escape sequence of jsonpath input")
+				}
+				builder.WriteRune(rune(value))
+				i += 4
+			default:
+				builder.WriteByte(escape)
+			}
+		default:
+			builder.WriteByte(c)
+			i++
+		}
+	}
+	return "", 0, fmt.Errorf("unexpected end of quoted string of jsonpath input")
+}
+
+func (p *jspParser) current() jspToken {
+	return p.tokens[p.pos]
+}
+
+func (p *jspParser) advance() jspToken {
+	tok := p.tokens[p.pos]
+	if tok.typ != jspEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *jspParser) isOp(text string) bool {
+	tok := p.current()
+	return tok.typ == jspOp && tok.text == text
+}
+
+func (p *jspParser) isKeyword(word string) bool {
+	tok := p.current()
+	return tok.typ == jspIdent && strings.EqualFold(tok.text, word)
+}
+
+func (p *jspParser) acceptOp(text string) bool {
+	if p.isOp(text) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *jspParser) syntaxError() error {
+	tok := p.current()
+	if tok.typ == jspEOF {
+		return fmt.Errorf("syntax error at end of jsonpath input")
+	}
+	text := tok.text
+	switch tok.typ {
+	case jspString:
+		text = string(escapeJson(nil, tok.text))
+	case jspVariable:
+		text = "$" + tok.text
+	}
+	return fmt.Errorf("syntax error at or near \"%s\" of jsonpath input", text)
+}
+
+func (p *jspParser) expectOp(text string) error {
+	if !p.acceptOp(text) {
+		return p.syntaxError()
+	}
+	return nil
+}
+
+// parseJsonPath reads [strict | lax] expression
+func parseJsonPath(str string) (*JsonPath, error) {
+	p := &jspParser{input: str}
+	if err := p.lex(); err != nil {
+		return nil, err
+	}
+	path := &JsonPath{lax: true}
+	switch {
+	case p.isKeyword("strict"):
+		p.advance()
+		path.lax = false
+	case p.isKeyword("lax"):
+		p.advance()
+	}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.current().typ != jspEOF {
+		return nil, p.syntaxError()
+	}
+	path.expr = expr
+	return path, nil
+}
+
+func (p *jspParser) parseOr() (*jspItem, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptOp("||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &jspItem{typ: jpiOr, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *jspParser) parseAnd() (*jspItem, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptOp("&&") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &jspItem{typ: jpiAnd, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *jspParser) parseNot() (*jspItem, error) {
+	if p.acceptOp("!") {
+		arg, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &jspItem{typ: jpiNot, left: arg}, nil
+	}
+	return p.parsePredicate()
+}
+
+var jspComparisons = map[string]jspItemType{
+	"==": jpiEqual,
+	"!=": jpiNotEqual,
+	"<>": jpiNotEqual,
+	"<":  jpiLess,
+	">":  jpiGreater,
+	"<=": jpiLessOrEqual,
+	">=": jpiGreaterOrEqual,
+}
+
+// parsePredicate reads a comparison, like_regex, starts with or is unknown, or a plain expression
+func (p *jspParser) parsePredicate() (*jspItem, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	tok := p.current()
+	switch {
+	case tok.typ == jspOp && jspComparisons[tok.text] != 0:
+		p.advance()
+		right, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		left = &jspItem{typ: jspComparisons[tok.text], left: left, right: right}
+	case p.isKeyword("like_regex"):
+		p.advance()
+		if p.current().typ != jspString {
+			return nil, p.syntaxError()
+		}
+		item := &jspItem{typ: jpiLikeRegex, left: left, str: p.advance().text}
+		if p.isKeyword("flag") {
+			p.advance()
+			if p.current().typ != jspString {
+				return nil, p.syntaxError()
+			}
+			item.flags = p.advance().text
+			for _, flag := range item.flags {
+				if !strings.ContainsRune("ismxq", flag) {
+					return nil, fmt.Errorf("invalid input syntax for type jsonpath: unrecognized flag character \"%c\" in LIKE_REGEX predicate", flag)
+				}
+			}
+		}
+		if item.regex, err = compileLikeRegex(item.str, item.flags); err != nil {
+			return nil, err
+		}
+		left = item
+	case p.isKeyword("starts"):
+		p.advance()
+		if !p.isKeyword("with") {
+			return nil, p.syntaxError()
+		}
+		p.advance()
+		var right *jspItem
+		switch p.current().typ {
+		case jspString:
+			right = &jspItem{typ: jpiString, str: p.advance().text}
+		case jspVariable:
+			right = &jspItem{typ: jpiVariable, str: p.advance().text}
+		default:
+			return nil, p.syntaxError()
+		}
+		left = &jspItem{typ: jpiStartsWith, left: left, right: right}
+	}
+	if p.isKeyword("is") {
+		p.advance()
+		if !p.isKeyword("unknown") {
+			return nil, p.syntaxError()
+		}
+		p.advance()
+		left = &jspItem{typ: jpiIsUnknown, left: left}
+	}
+	return left, nil
+}
+
+func (p *jspParser) parseAdditive() (*jspItem, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("+") || p.isOp("-") {
+		typ := jpiAdd
+		if p.advance().text == "-" {
+			typ = jpiSub
+		}
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = &jspItem{typ: typ, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *jspParser) parseMultiplicative() (*jspItem, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("*") || p.isOp("/") || p.isOp("%") {
+		typ := map[string]jspItemType{"*": jpiMul, "/": jpiDiv, "%": jpiMod}[p.advance().text]
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &jspItem{typ: typ, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *jspParser) parseUnary() (*jspItem, error) {
+	if p.isOp("+") || p.isOp("-") {
+		typ := jpiPlus
+		if p.advance().text == "-" {
+			typ = jpiMinus
+		}
+		arg, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		//Negative literals are folded, -1 is a number
+		if arg.typ == jpiNumeric && arg.next == nil {
+			if typ == jpiMinus {
+				arg.num = arg.num.Neg()
+			}
+			return arg, nil
+		}
+		return &jspItem{typ: typ, left: arg}, nil
+	}
+	return p.parseAccessorExpr()
+}
+
+// parseAccessorExpr reads a primary followed by its accessors
+func (p *jspParser) parseAccessorExpr() (*jspItem, error) {
+	head, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	tail := head
+	for tail.next != nil {
+		tail = tail.next
+	}
+	for {
+		accessor, err := p.parseAccessor()
+		if err != nil {
+			return nil, err
+		}
+		if accessor == nil {
+			return head, nil
+		}
+		tail.next = accessor
+		tail = accessor
+	}
+}
+
+func (p *jspParser) parsePrimary() (*jspItem, error) {
+	tok := p.current()
+	switch tok.typ {
+	case jspString:
+		p.advance()
+		return &jspItem{typ: jpiString, str: tok.text}, nil
+	case jspNumber:
+		p.advance()
+		num, err := ParseNumeric(tok.text)
+		if err != nil {
+			return nil, err
+		}
+		return &jspItem{typ: jpiNumeric, num: num}, nil
+	case jspVariable:
+		p.advance()
+		return &jspItem{typ: jpiVariable, str: tok.text}, nil
+	case jspIdent:
+		switch strings.ToLower(tok.text) {
+		case "true", "false":
+			p.advance()
+			return &jspItem{typ: jpiBool, boolean: strings.EqualFold(tok.text, "true")}, nil
+		case "null":
+			p.advance()
+			return &jspItem{typ: jpiNull}, nil
+		case "last":
+			p.advance()
+			return &jspItem{typ: jpiLast}, nil
+		case "exists":
+			p.advance()
+			if err := p.expectOp("("); err != nil {
+				return nil, err
+			}
+			arg, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectOp(")"); err != nil {
+				return nil, err
+			}
+			return &jspItem{typ: jpiExists, left: arg}, nil
+		}
+	case jspOp:
+		switch tok.text {
+		case "$":
+			p.advance()
+			return &jspItem{typ: jpiRoot}, nil
+		case "@":
+			p.advance()
+			return &jspItem{typ: jpiCurrent}, nil
+		case "(":
+			p.advance()
+			expr, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectOp(")"); err != nil {
+				return nil, err
+			}
+			return expr, nil
+		}
+	}
+	return nil, p.syntaxError()
+}
+
+// parseAccessor reads one accessor, nil when none follows
+func (p *jspParser) parseAccessor() (*jspItem, error) {
+	switch {
+	case p.acceptOp("."):
+		tok := p.current()
+		switch {
+		case tok.typ == jspOp && tok.text == "*":
+			p.advance()
+			return &jspItem{typ: jpiAnyKey}, nil
+		case tok.typ == jspOp && tok.text == "**":
+			p.advance()
+			return p.parseAnyLevels()
+		case tok.typ == jspIdent, tok.typ == jspString:
+			p.advance()
+			if method, ok := jspMethods[strings.ToLower(tok.text)]; ok && tok.typ == jspIdent && p.isOp("(") {
+				p.advance()
+				if err := p.expectOp(")"); err != nil {
+					return nil, err
+				}
+				return &jspItem{typ: method}, nil
+			}
+			return &jspItem{typ: jpiKey, str: tok.text}, nil
+		case tok.typ == jspVariable:
+			//$."$a" style keys are strings, a bare $a after a point is not a key
+			return nil, p.syntaxError()
+		}
+		return nil, p.syntaxError()
+
+	case p.acceptOp("["):
+		if p.acceptOp("*") {
+			if err := p.expectOp("]"); err != nil {
+				return nil, err
+			}
+			return &jspItem{typ: jpiAnyArray}, nil
+		}
+		item := &jspItem{typ: jpiIndexArray}
+		for {
+			from, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			subscript := jspSubscript{from: from}
+			if p.isKeyword("to") {
+				p.advance()
+				if subscript.to, err = p.parseOr(); err != nil {
+					return nil, err
+				}
+			}
+			item.subscripts = append(item.subscripts, subscript)
+			if !p.acceptOp(",") {
+				break
+			}
+		}
+		if err := p.expectOp("]"); err != nil {
+			return nil, err
+		}
+		return item, nil
+
+	case p.acceptOp("?"):
+		if err := p.expectOp("("); err != nil {
+			return nil, err
+		}
+		predicate, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectOp(")"); err != nil {
+			return nil, err
+		}
+		return &jspItem{typ: jpiFilter, left: predicate}, nil
+	}
+	return nil, nil
+}
+
+// parseAnyLevels reads the optional {level} or {from to last} after .**
+func (p *jspParser) parseAnyLevels() (*jspItem, error) {
+	item := &jspItem{typ: jpiAny, first: 0, last: anyLast}
+	if !p.acceptOp("{") {
+		return item, nil
+	}
+	level := func() (uint32, error) {
+		tok := p.current()
+		if tok.typ == jspIdent && strings.EqualFold(tok.text, "last") {
+			p.advance()
+			return anyLast, nil
+		}
+		if tok.typ != jspNumber {
+			return 0, p.syntaxError()
+		}
+		value, err := strconv.ParseUint(tok.text, 10, 31)
+		if err != nil {
+			return 0, p.syntaxError()
+		}
+		p.advance()
+		return uint32(value), nil
+	}
+	var err error
+	if item.first, err = level(); err != nil {
+		return nil, err
+	}
+	item.last = item.first
+	if p.isKeyword("to") {
+		p.advance()
+		if item.last, err = level(); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expectOp("}"); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// jspPriority is how tightly an operator binds, for printing parentheses (postgres operationPriority)
+func jspPriority(typ jspItemType) int {
+	switch typ {
+	case jpiOr:
+		return 0
+	case jpiAnd:
+		return 1
+	case jpiEqual, jpiNotEqual, jpiLess, jpiGreater, jpiLessOrEqual, jpiGreaterOrEqual, jpiStartsWith:
+		return 2
+	case jpiAdd, jpiSub:
+		return 3
+	case jpiMul, jpiDiv, jpiMod:
+		return 4
+	case jpiPlus, jpiMinus:
+		return 5
+	}
+	return 6
+}
+
+var jspOperatorNames = map[jspItemType]string{
+	jpiAnd:            "&&",
+	jpiOr:             "||",
+	jpiEqual:          "==",
+	jpiNotEqual:       "!=",
+	jpiLess:           "<",
+	jpiGreater:        ">",
+	jpiLessOrEqual:    "<=",
+	jpiGreaterOrEqual: ">=",
+	jpiAdd:            "+",
+	jpiSub:            "-",
+	jpiMul:            "*",
+	jpiDiv:            "/",
+	jpiMod:            "%",
+	jpiStartsWith:     "starts with",
+}
+
+// appendJspItem prints an item and its accessors (postgres printJsonPathItem)
+func appendJspItem(buf []byte, item *jspItem, inKey bool, brackets bool) []byte {
+	switch item.typ {
+	case jpiNull:
+		buf = append(buf, "null"...)
+	case jpiString:
+		buf = escapeJson(buf, item.str)
+	case jpiNumeric:
+		buf = append(buf, item.num.String()...)
+	case jpiBool:
+		buf = strconv.AppendBool(buf, item.boolean)
+	case jpiAnd, jpiOr, jpiEqual, jpiNotEqual, jpiLess, jpiGreater, jpiLessOrEqual, jpiGreaterOrEqual,
+		jpiAdd, jpiSub, jpiMul, jpiDiv, jpiMod, jpiStartsWith:
+		if brackets {
+			buf = append(buf, '(')
+		}
+		buf = appendJspItem(buf, item.left, false, jspPriority(item.left.typ) <= jspPriority(item.typ))
+		buf = append(buf, ' ')
+		buf = append(buf, jspOperatorNames[item.typ]...)
+		buf = append(buf, ' ')
+		buf = appendJspItem(buf, item.right, false, jspPriority(item.right.typ) <= jspPriority(item.typ))
+		if brackets {
+			buf = append(buf, ')')
+		}
+	case jpiLikeRegex:
+		if brackets {
+			buf = append(buf, '(')
+		}
+		buf = appendJspItem(buf, item.left, false, jspPriority(item.left.typ) <= jspPriority(item.typ))
+		buf = append(buf, " like_regex "...)
+		buf = escapeJson(buf, item.str)
+		if item.flags != "" {
+			buf = append(buf, " flag "...)
+			buf = escapeJson(buf, item.flags)
+		}
+		if brackets {
+			buf = append(buf, ')')
+		}
+	case jpiPlus, jpiMinus:
+		if brackets {
+			buf = append(buf, '(')
+		}
+		if item.typ == jpiPlus {
+			buf = append(buf, '+')
+		} else {
+			buf = append(buf, '-')
+		}
+		buf = appendJspItem(buf, item.left, false, jspPriority(item.left.typ) <= jspPriority(item.typ))
+		if brackets {
+			buf = append(buf, ')')
+		}
+	case jpiNot:
+		buf = append(buf, "!("...)
+		buf = appendJspItem(buf, item.left, false, false)
+		buf = append(buf, ')')
+	case jpiIsUnknown:
+		buf = append(buf, '(')
+		buf = appendJspItem(buf, item.left, false, false)
+		buf = append(buf, ") is unknown"...)
+	case jpiExists:
+		buf = append(buf, "exists ("...)
+		buf = appendJspItem(buf, item.left, false, false)
+		buf = append(buf, ')')
+	case jpiRoot:
+		buf = append(buf, '$')
+	case jpiCurrent:
+		buf = append(buf, '@')
+	case jpiVariable:
+		buf = append(buf, '$')
+		buf = escapeJson(buf, item.str)
+	case jpiLast:
+		buf = append(buf, "last"...)
+	case jpiKey:
+		if inKey {
+			buf = append(buf, '.')
+		}
+		buf = escapeJson(buf, item.str)
+	case jpiAnyKey:
+		if inKey {
+			buf = append(buf, '.')
+		}
+		buf = append(buf, '*')
+	case jpiAnyArray:
+		buf = append(buf, "[*]"...)
+	case jpiIndexArray:
+		buf = append(buf, '[')
+		for i, subscript := range item.subscripts {
+			if i > 0 {
+				buf = append(buf, ',')
+			}
+			buf = appendJspItem(buf, subscript.from, false, false)
+			if subscript.to != nil {
+				buf = append(buf, " to "...)
+				buf = appendJspItem(buf, subscript.to, false, false)
+			}
+		}
+		buf = append(buf, ']')
+	case jpiAny:
+		if inKey {
+			buf = append(buf, '.')
+		}
+		buf = append(buf, "**"...)
+		level := func(buf []byte, l uint32) []byte {
+			if l == anyLast {
+				return append(buf, "last"...)
+			}
+			return strconv.AppendUint(buf, uint64(l), 10)
+		}
+		switch {
+		case item.first == item.last:
+			buf = append(buf, '{')
+			buf = level(buf, item.first)
+			buf = append(buf, '}')
+		case item.first != 0 || item.last != anyLast:
+			buf = append(buf, '{')
+			buf = level(buf, item.first)
+			buf = append(buf, " to "...)
+			buf = level(buf, item.last)
+			buf = append(buf, '}')
+		}
+	case jpiFilter:
+		buf = append(buf, "?("...)
+		buf = appendJspItem(buf, item.left, false, false)
+		buf = append(buf, ')')
+	default:
+		for name, method := range jspMethods {
+			if method == item.typ {
+				buf = append(buf, '.')
+				buf = append(buf, name...)
+				buf = append(buf, "()"...)
+			}
+		}
+	}
+	if item.next != nil {
+		buf = appendJspItem(buf, item.next, true, true)
+	}
+	return buf
+}
+
+func jsonPathIn(str string, _ *Settings) (types.Datum, error) {
+	path, err := parseJsonPath(str)
+	if err != nil {
+		return nil, err
+	}
+	return path, nil
+}
+
+func jsonPathOut(d types.Datum, _ *Settings) string {
+	return d.(*JsonPath).String()
+}
+
+func (path *JsonPath) String() string {
+	var buf []byte
+	if !path.lax {
+		buf = append(buf, "strict "...)
+	}
+	return string(appendJspItem(buf, path.expr, false, true))
+}
+
+// Like jsonb the binary format is a version number and the text
+func jsonPathRecv(buf []byte) (types.Datum, error) {
+	if len(buf) == 0 || buf[0] != 1 {
+		return nil, fmt.Errorf("unsupported jsonpath version number")
+	}
+	path, err := parseJsonPath(string(buf[1:]))
+	if err != nil {
+		return nil, err
+	}
+	return path, nil
+}
+
+func jsonPathSend(d types.Datum) []byte {
+	return append([]byte{1}, d.(*JsonPath).String()...)
+}
+
+// jsonpath has no ordering, paths hash by their normal form
+func hashJsonPath(buf []byte, d types.Datum) []byte {
+	return hashText(buf, d.(*JsonPath).String())
+}
@@ -0,0 +1,773 @@
+package adt
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+Running a jsonpath over a document (postgres utils/adt/jsonpath_exec.c)
+
+Every item takes one value and passes each of its results on to the next item of the chain, what comes out
+of the last item is the result of the path. Predicates are three valued: true, false and unknown, unknown
+is what an error inside a predicate turns into, so '$ ? (@.a > 1)' skips values where @.a is a string.
+
+In lax mode (the default) structural mismatches are not errors: a member accessor on an array looks into
+its elements, an array accessor on a non-array sees a one element array, missing keys and subscripts out
+of range just give nothing. Strict mode reports them.
+
+Errors of the path itself are jsonPathErrors, the silent argument of the jsonb_path functions and the
+@? and @@ operators turn those into NULL. A missing variable is always an error.
+*/
+
+type jsonPathError struct {
+	msg string
+}
+
+func (e *jsonPathError) Error() string {
+	return e.msg
+}
+
+func jspError(format string, args ...any) error {
+	return &jsonPathError{msg: fmt.Sprintf(format, args...)}
+}
+
+type jspBool int
+
+const (
+	jspFalse jspBool = iota
+	jspTrue
+	jspUnknown
+)
+
+type jspContext struct {
+	root             *Jsonb
+	vars             *Jsonb
+	lax              bool
+	ignoreStructural bool   //Set while below .**, whose descendants may be anything
+	current          *Jsonb //The value @ stands for
+	inSubscript      bool
+	lastIndex        int64 //The value of last inside array subscripts
+}
+
+// execute runs the path over target, vars holds the values of $name variables
+func (p *JsonPath) execute(target *Jsonb, vars *Jsonb) ([]*Jsonb, error) {
+	if vars != nil && vars.kind != jbvObject {
+		return nil, fmt.Errorf("\"vars\" argument is not an object")
+	}
+	cx := &jspContext{root: target, vars: vars, lax: p.lax, current: target}
+	var found []*Jsonb
+	if err := cx.exec(p.expr, target, &found, p.lax); err != nil {
+		return nil, err
+	}
+	return found, nil
+}
+
+// structural reports a structural mismatch, which lax mode ignores
+func (cx *jspContext) structural(format string, args ...any) error {
+	if cx.lax || cx.ignoreStructural {
+		return nil
+	}
+	return jspError(format, args...)
+}
+
+// next passes a result of item on to the rest of the chain
+func (cx *jspContext) next(item *jspItem, v *Jsonb, found *[]*Jsonb) error {
+	if item.next == nil {
+		*found = append(*found, v)
+		return nil
+	}
+	return cx.exec(item.next, v, found, cx.lax)
+}
+
+// unwrapArray applies item to every element of an array instead of the array
+func (cx *jspContext) unwrapArray(item *jspItem, v *Jsonb, found *[]*Jsonb) error {
+	for _, elem := range v.elems {
+		if err := cx.exec(item, elem, found, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func jspLiteral(item *jspItem) *Jsonb {
+	switch item.typ {
+	case jpiString:
+		return &Jsonb{kind: jbvString, str: item.str}
+	case jpiNumeric:
+		return &Jsonb{kind: jbvNumeric, num: item.num}
+	case jpiBool:
+		return &Jsonb{kind: jbvBool, boolean: item.boolean}
+	}
+	return &Jsonb{kind: jbvNull}
+}
+
+func jspBoolValue(b jspBool) *Jsonb {
+	if b == jspUnknown {
+		return &Jsonb{kind: jbvNull}
+	}
+	return &Jsonb{kind: jbvBool, boolean: b == jspTrue}
+}
+
+// exec applies item to v, unwrap says if an array may be unwrapped for accessors expecting something else
+func (cx *jspContext) exec(item *jspItem, v *Jsonb, found *[]*Jsonb, unwrap bool) error {
+	switch item.typ {
+	case jpiNull, jpiString, jpiNumeric, jpiBool:
+		return cx.next(item, jspLiteral(item), found)
+
+	case jpiRoot:
+		return cx.next(item, cx.root, found)
+
+	case jpiCurrent:
+		return cx.next(item, cx.current, found)
+
+	case jpiVariable:
+		var value *Jsonb
+		if cx.vars != nil {
+			value = cx.vars.findKey(item.str)
+		}
+		if value == nil {
+			return fmt.Errorf("could not find jsonpath variable \"%s\"", item.str)
+		}
+		return cx.next(item, value, found)
+
+	case jpiLast:
+		if !cx.inSubscript {
+			return jspError("evaluating jsonpath LAST outside of array subscript")
+		}
+		return cx.next(item, &Jsonb{kind: jbvNumeric, num: NumericFromInt64(cx.lastIndex)}, found)
+
+	case jpiKey:
+		switch {
+		case v.kind == jbvObject:
+			value := v.findKey(item.str)
+			if value == nil {
+				return cx.structural("JSON object does not contain key \"%s\"", item.str)
+			}
+			return cx.next(item, value, found)
+		case v.kind == jbvArray && unwrap:
+			return cx.unwrapArray(item, v, found)
+		}
+		return cx.structural("jsonpath member accessor can only be applied to an object")
+
+	case jpiAnyKey:
+		switch {
+		case v.kind == jbvObject:
+			for _, pair := range v.pairs {
+				if err := cx.next(item, pair.value, found); err != nil {
+					return err
+				}
+			}
+			return nil
+		case v.kind == jbvArray && unwrap:
+			return cx.unwrapArray(item, v, found)
+		}
+		return cx.structural("jsonpath wildcard member accessor can only be applied to an object")
+
+	case jpiAnyArray:
+		if v.kind == jbvArray {
+			for _, elem := range v.elems {
+				if err := cx.next(item, elem, found); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		if cx.lax {
+			return cx.next(item, v, found)
+		}
+		return cx.structural("jsonpath wildcard array accessor can only be applied to an array")
+
+	case jpiIndexArray:
+		return cx.execSubscripts(item, v, found)
+
+	case jpiAny:
+		saved := cx.ignoreStructural
+		cx.ignoreStructural = true
+		err := cx.execAny(item, v, 0, found)
+		cx.ignoreStructural = saved
+		return err
+
+	case jpiFilter:
+		if v.kind == jbvArray && unwrap {
+			return cx.unwrapArray(item, v, found)
+		}
+		saved := cx.current
+		cx.current = v
+		result, err := cx.predicate(item.left, v)
+		cx.current = saved
+		if err != nil {
+			return err
+		}
+		if result != jspTrue {
+			return nil
+		}
+		return cx.next(item, v, found)
+
+	case jpiAnd, jpiOr, jpiNot, jpiIsUnknown, jpiEqual, jpiNotEqual, jpiLess, jpiGreater, jpiLessOrEqual,
+		jpiGreaterOrEqual, jpiExists, jpiLikeRegex, jpiStartsWith:
+		result, err := cx.predicate(item, v)
+		if err != nil {
+			return err
+		}
+		return cx.next(item, jspBoolValue(result), found)
+
+	case jpiAdd, jpiSub, jpiMul, jpiDiv, jpiMod:
+		result, err := cx.execBinaryArithmetic(item, v)
+		if err != nil {
+			return err
+		}
+		return cx.next(item, result, found)
+
+	case jpiPlus, jpiMinus:
+		var operands []*Jsonb
+		if err := cx.exec(item.left, v, &operands, cx.lax); err != nil {
+			return err
+		}
+		for _, operand := range cx.unwrapResults(operands) {
+			if operand.kind != jbvNumeric {
+				return jspError("operand of unary jsonpath operator %s is not a numeric value", jspUnaryName(item.typ))
+			}
+			if item.typ == jpiMinus {
+				operand = &Jsonb{kind: jbvNumeric, num: operand.num.Neg()}
+			}
+			if err := cx.next(item, operand, found); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case jpiType:
+		return cx.next(item, &Jsonb{kind: jbvString, str: jspTypeName(v)}, found)
+
+	case jpiSize:
+		if v.kind == jbvArray {
+			return cx.next(item, &Jsonb{kind: jbvNumeric, num: NumericFromInt64(int64(len(v.elems)))}, found)
+		}
+		if !cx.lax {
+			return cx.structural("jsonpath item method .size() can only be applied to an array")
+		}
+		return cx.next(item, &Jsonb{kind: jbvNumeric, num: NumericFromInt64(1)}, found)
+
+	case jpiDouble, jpiAbs, jpiFloor, jpiCeiling, jpiKeyValue:
+		if v.kind == jbvArray && unwrap {
+			return cx.unwrapArray(item, v, found)
+		}
+		result, err := jspMethod(item.typ, v)
+		if err != nil {
+			return err
+		}
+		for _, value := range result {
+			if err := cx.next(item, value, found); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("unrecognized jsonpath item type: %d", item.typ)
+}
+
+// unwrapResults replaces arrays among the results by their elements, in lax mode
+func (cx *jspContext) unwrapResults(values []*Jsonb) []*Jsonb {
+	if !cx.lax {
+		return values
+	}
+	var result []*Jsonb
+	for _, value := range values {
+		if value.kind == jbvArray {
+			result = append(result, value.elems...)
+			continue
+		}
+		result = append(result, value)
+	}
+	return result
+}
+
+// execSubscripts runs [i, a to b], last is the last index of the array
+func (cx *jspContext) execSubscripts(item *jspItem, v *Jsonb, found *[]*Jsonb) error {
+	elems := v.elems
+	if v.kind != jbvArray {
+		if !cx.lax {
+			return cx.structural("jsonpath array accessor can only be applied to an array")
+		}
+		elems = []*Jsonb{v}
+	}
+	savedIn, savedLast := cx.inSubscript, cx.lastIndex
+	cx.inSubscript, cx.lastIndex = true, int64(len(elems))-1
+	defer func() {
+		cx.inSubscript, cx.lastIndex = savedIn, savedLast
+	}()
+	for _, subscript := range item.subscripts {
+		from, err := cx.subscriptIndex(subscript.from, v)
+		if err != nil {
+			return err
+		}
+		to := from
+		if subscript.to != nil {
+			if to, err = cx.subscriptIndex(subscript.to, v); err != nil {
+				return err
+			}
+		}
+		if from < 0 || from > to || to >= int64(len(elems)) {
+			if !cx.lax && !cx.ignoreStructural {
+				return jspError("jsonpath array subscript is out of bounds")
+			}
+			from = max(from, 0)
+			to = min(to, int64(len(elems))-1)
+		}
+		for i := from; i <= to; i++ {
+			if err := cx.next(item, elems[i], found); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (cx *jspContext) subscriptIndex(expr *jspItem, v *Jsonb) (int64, error) {
+	var values []*Jsonb
+	if err := cx.exec(expr, v, &values, cx.lax); err != nil {
+		return 0, err
+	}
+	if len(values) != 1 || values[0].kind != jbvNumeric {
+		return 0, jspError("jsonpath array subscript is not a single numeric value")
+	}
+	index, err := values[0].num.Round(0, ROUND_DOWN).Int64()
+	if err != nil || index > math.MaxInt32 || index < math.MinInt32 {
+		return 0, jspError("jsonpath array subscript is out of integer range")
+	}
+	return index, nil
+}
+
+// execAny walks .** down the document, level 0 is the value itself
+func (cx *jspContext) execAny(item *jspItem, v *Jsonb, level uint32, found *[]*Jsonb) error {
+	if level >= item.first && level <= item.last {
+		if err := cx.next(item, v, found); err != nil {
+			return err
+		}
+	}
+	if level >= item.last {
+		return nil
+	}
+	var children []*Jsonb
+	switch v.kind {
+	case jbvArray:
+		children = v.elems
+	case jbvObject:
+		for _, pair := range v.pairs {
+			children = append(children, pair.value)
+		}
+	}
+	for _, child := range children {
+		if err := cx.execAny(item, child, level+1, found); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func jspUnaryName(typ jspItemType) string {
+	if typ == jpiMinus {
+		return "-"
+	}
+	return "+"
+}
+
+func jspTypeName(v *Jsonb) string {
+	switch v.kind {
+	case jbvNull:
+		return "null"
+	case jbvString:
+		return "string"
+	case jbvNumeric:
+		return "number"
+	case jbvBool:
+		return "boolean"
+	case jbvArray:
+		return "array"
+	}
+	return "object"
+}
+
+func (cx *jspContext) execBinaryArithmetic(item *jspItem, v *Jsonb) (*Jsonb, error) {
+	name := jspOperatorNames[item.typ]
+	operand := func(expr *jspItem, side string) (Numeric, error) {
+		var values []*Jsonb
+		if err := cx.exec(expr, v, &values, cx.lax); err != nil {
+			return Numeric{}, err
+		}
+		values = cx.unwrapResults(values)
+		if len(values) != 1 || values[0].kind != jbvNumeric {
+			return Numeric{}, jspError("%s operand of jsonpath operator %s is not a single numeric value", side, name)
+		}
+		return values[0].num, nil
+	}
+	left, err := operand(item.left, "left")
+	if err != nil {
+		return nil, err
+	}
+	right, err := operand(item.right, "right")
+	if err != nil {
+		return nil, err
+	}
+	var result Numeric
+	switch item.typ {
+	case jpiAdd:
+		result, err = left.Add(right)
+	case jpiSub:
+		result, err = left.Sub(right)
+	case jpiMul:
+		result, err = left.Mul(right)
+	case jpiDiv:
+		result, err = left.Div(right)
+	case jpiMod:
+		result, err = left.Mod(right)
+	}
+	if err != nil {
+		return nil, jspError("%s", err.Error())
+	}
+	return &Jsonb{kind: jbvNumeric, num: result}, nil
+}
+
+// jspMethod runs the item methods that work on one scalar or object
+func jspMethod(typ jspItemType, v *Jsonb) ([]*Jsonb, error) {
+	switch typ {
+	case jpiDouble:
+		switch v.kind {
+		case jbvNumeric:
+			f := v.num.Float64()
+			if math.IsInf(f, 0) || math.IsNaN(f) {
+				return nil, jspError("numeric argument of jsonpath item method .double() is out of range for type double precision")
+			}
+			return []*Jsonb{{kind: jbvNumeric, num: NumericFromFloat64(f)}}, nil
+		case jbvString:
+			f, err := strconv.ParseFloat(strings.TrimSpace(v.str), 64)
+			if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+				return nil, jspError("string argument of jsonpath item method .double() is not a valid representation of a double precision number")
+			}
+			return []*Jsonb{{kind: jbvNumeric, num: NumericFromFloat64(f)}}, nil
+		}
+		return nil, jspError("jsonpath item method .double() can only be applied to a string or numeric value")
+
+	case jpiAbs, jpiFloor, jpiCeiling:
+		name := map[jspItemType]string{jpiAbs: "abs", jpiFloor: "floor", jpiCeiling: "ceiling"}[typ]
+		if v.kind != jbvNumeric {
+			return nil, jspError("jsonpath item method .%s() can only be applied to a numeric value", name)
+		}
+		var result Numeric
+		switch typ {
+		case jpiAbs:
+			result = v.num.Abs()
+		case jpiFloor:
+			result = v.num.Round(0, ROUND_FLOOR)
+		case jpiCeiling:
+			result = v.num.Round(0, ROUND_CEILING)
+		}
+		return []*Jsonb{{kind: jbvNumeric, num: result}}, nil
+
+	case jpiKeyValue:
+		if v.kind != jbvObject {
+			return nil, jspError("jsonpath item method .keyvalue() can only be applied to an object")
+		}
+		result := make([]*Jsonb, 0, len(v.pairs))
+		for _, pair := range v.pairs {
+			//Pairs are built in key order: id, key, value
+			result = append(result, &Jsonb{kind: jbvObject, pairs: []jsonbPair{
+				{key: "id", value: &Jsonb{kind: jbvNumeric, num: NumericFromInt64(0)}},
+				{key: "key", value: &Jsonb{kind: jbvString, str: pair.key}},
+				{key: "value", value: pair.value},
+			}})
+		}
+		return result, nil
+	}
+	return nil, fmt.Errorf("unrecognized jsonpath item type: %d", typ)
+}
+
+// predicate evaluates a boolean item, errors of the path inside it are unknown
+func (cx *jspContext) predicate(item *jspItem, v *Jsonb) (jspBool, error) {
+	switch item.typ {
+	case jpiAnd:
+		left, err := cx.predicate(item.left, v)
+		if err != nil || left == jspFalse {
+			return jspFalse, err
+		}
+		right, err := cx.predicate(item.right, v)
+		if err != nil {
+			return jspFalse, err
+		}
+		if right == jspTrue {
+			return left, nil
+		}
+		return right, nil
+
+	case jpiOr:
+		left, err := cx.predicate(item.left, v)
+		if err != nil || left == jspTrue {
+			return jspTrue, err
+		}
+		right, err := cx.predicate(item.right, v)
+		if err != nil {
+			return jspFalse, err
+		}
+		if right == jspFalse {
+			return left, nil
+		}
+		return right, nil
+
+	case jpiNot:
+		arg, err := cx.predicate(item.left, v)
+		if err != nil || arg == jspUnknown {
+			return arg, err
+		}
+		if arg == jspTrue {
+			return jspFalse, nil
+		}
+		return jspTrue, nil
+
+	case jpiIsUnknown:
+		arg, err := cx.predicate(item.left, v)
+		if err != nil {
+			return jspFalse, err
+		}
+		if arg == jspUnknown {
+			return jspTrue, nil
+		}
+		return jspFalse, nil
+
+	case jpiExists:
+		var values []*Jsonb
+		if err := cx.exec(item.left, v, &values, cx.lax); err != nil {
+			return cx.predicateError(err)
+		}
+		if len(values) > 0 {
+			return jspTrue, nil
+		}
+		return jspFalse, nil
+
+	case jpiEqual, jpiNotEqual, jpiLess, jpiGreater, jpiLessOrEqual, jpiGreaterOrEqual:
+		var left, right []*Jsonb
+		if err := cx.exec(item.left, v, &left, cx.lax); err != nil {
+			return cx.predicateError(err)
+		}
+		if err := cx.exec(item.right, v, &right, cx.lax); err != nil {
+			return cx.predicateError(err)
+		}
+		left, right = cx.unwrapResults(left), cx.unwrapResults(right)
+		return cx.anyOf(left, func(l *Jsonb) jspBool {
+			return cx.anyOf(right, func(r *Jsonb) jspBool {
+				return jspCompare(item.typ, l, r)
+			})
+		}), nil
+
+	case jpiLikeRegex, jpiStartsWith:
+		var left []*Jsonb
+		if err := cx.exec(item.left, v, &left, cx.lax); err != nil {
+			return cx.predicateError(err)
+		}
+		left = cx.unwrapResults(left)
+		var prefixes []*Jsonb
+		if item.typ == jpiStartsWith {
+			if err := cx.exec(item.right, v, &prefixes, cx.lax); err != nil {
+				return cx.predicateError(err)
+			}
+			if len(prefixes) != 1 || prefixes[0].kind != jbvString {
+				return jspUnknown, nil
+			}
+		}
+		return cx.anyOf(left, func(l *Jsonb) jspBool {
+			switch {
+			case l.kind != jbvString:
+				return jspUnknown
+			case item.typ == jpiStartsWith:
+				return jspBoolOf(strings.HasPrefix(l.str, prefixes[0].str))
+			}
+			return jspBoolOf(item.regex.MatchString(l.str))
+		}), nil
+	}
+	//Any other expression as a predicate, postgres only accepts these in the grammar
+	return jspUnknown, jspError("jsonpath expression is not a predicate")
+}
+
+func jspBoolOf(b bool) jspBool {
+	if b {
+		return jspTrue
+	}
+	return jspFalse
+}
+
+// predicateError turns an error of the path into unknown and passes any other on
+func (cx *jspContext) predicateError(err error) (jspBool, error) {
+	var pathError *jsonPathError
+	if errors.As(err, &pathError) {
+		return jspUnknown, nil
+	}
+	return jspUnknown, err
+}
+
+// anyOf is true if check is true for some value, unknown if it was unknown for one (in strict mode for any)
+func (cx *jspContext) anyOf(values []*Jsonb, check func(*Jsonb) jspBool) jspBool {
+	found, unknown := false, false
+	for _, value := range values {
+		switch check(value) {
+		case jspTrue:
+			if cx.lax {
+				return jspTrue
+			}
+			found = true
+		case jspUnknown:
+			if !cx.lax {
+				return jspUnknown
+			}
+			unknown = true
+		}
+	}
+	if found {
+		return jspTrue
+	}
+	if unknown {
+		return jspUnknown
+	}
+	return jspFalse
+}
+
+// jspCompare compares two scalars, values of different kinds only compare to null (as not equal)
+func jspCompare(op jspItemType, a *Jsonb, b *Jsonb) jspBool {
+	if a.kind != b.kind {
+		if a.kind == jbvNull || b.kind == jbvNull {
+			return jspBoolOf(op == jpiNotEqual)
+		}
+		return jspUnknown
+	}
+	cmp := 0
+	switch a.kind {
+	case jbvString:
+		cmp = strings.Compare(a.str, b.str)
+	case jbvNumeric:
+		cmp = a.num.Cmp(b.num)
+	case jbvBool:
+		cmp = boolCmp(a.boolean, b.boolean)
+	case jbvArray, jbvObject:
+		return jspUnknown
+	}
+	switch op {
+	case jpiEqual:
+		return jspBoolOf(cmp == 0)
+	case jpiNotEqual:
+		return jspBoolOf(cmp != 0)
+	case jpiLess:
+		return jspBoolOf(cmp < 0)
+	case jpiGreater:
+		return jspBoolOf(cmp > 0)
+	case jpiLessOrEqual:
+		return jspBoolOf(cmp <= 0)
+	}
+	return jspBoolOf(cmp >= 0)
+}
+
+// compileLikeRegex builds the regular expression of like_regex, flags as in postgres
+func compileLikeRegex(pattern string, flags string) (*regexp.Regexp, error) {
+	prefix := ""
+	for _, flag := range flags {
+		switch flag {
+		case 'i', 's', 'm':
+			prefix += string(flag)
+		case 'q':
+			pattern = regexp.QuoteMeta(pattern)
+		case 'x':
+			pattern = strings.Join(strings.Fields(pattern), "")
+		}
+	}
+	if prefix != "" {
+		pattern = "(?" + prefix + ")" + pattern
+	}
+	regex, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regular expression: %v", err)
+	}
+	return regex, nil
+}
+
+/*
+jsonb_path_exists, jsonb_path_match, jsonb_path_query_array and jsonb_path_query_first, @? and @@.
+With silent set errors of the path give NULL
+*/
+
+func jsonbPathExecute(target *Jsonb, path *JsonPath, vars *Jsonb, silent bool) ([]*Jsonb, bool, error) {
+	found, err := path.execute(target, vars)
+	if err != nil {
+		var pathError *jsonPathError
+		if silent && errors.As(err, &pathError) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	return found, true, nil
+}
+
+func jsonbPathExists(target *Jsonb, path *JsonPath, vars *Jsonb, silent bool) (types.Datum, error) {
+	found, ok, err := jsonbPathExecute(target, path, vars, silent)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return len(found) > 0, nil
+}
+
+func jsonbPathMatch(target *Jsonb, path *JsonPath, vars *Jsonb, silent bool) (types.Datum, error) {
+	found, ok, err := jsonbPathExecute(target, path, vars, silent)
+	if err != nil || !ok {
+		return nil, err
+	}
+	if len(found) == 1 {
+		switch found[0].kind {
+		case jbvBool:
+			return found[0].boolean, nil
+		case jbvNull:
+			return nil, nil
+		}
+	}
+	if silent {
+		return nil, nil
+	}
+	return nil, fmt.Errorf("single boolean result is expected")
+}
+
+// jsonbPathQuery gives every item the path finds as a row of its own
+func jsonbPathQuery(target *Jsonb, path *JsonPath, vars *Jsonb, silent bool) (types.Datum, error) {
+	found, ok, err := jsonbPathExecute(target, path, vars, silent)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return SetResult(nil), nil
+	}
+	rows := make(SetResult, len(found))
+	for i, item := range found {
+		rows[i] = item
+	}
+	return rows, nil
+}
+
+func jsonbPathQueryArray(target *Jsonb, path *JsonPath, vars *Jsonb, silent bool) (types.Datum, error) {
+	found, ok, err := jsonbPathExecute(target, path, vars, silent)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		found = nil
+	}
+	return &Jsonb{kind: jbvArray, elems: found}, nil
+}
+
+func jsonbPathQueryFirst(target *Jsonb, path *JsonPath, vars *Jsonb, silent bool) (types.Datum, error) {
+	found, ok, err := jsonbPathExecute(target, path, vars, silent)
+	if err != nil || !ok || len(found) == 0 {
+		return nil, err
+	}
+	return found[0], nil
+}
@@ -0,0 +1,205 @@
+package adt
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+LIKE and ILIKE (postgres utils/adt/like.c and like_match.c)
+In a pattern % matches any run of characters, _ any single character and a backslash makes the next
+character literal. x LIKE p ESCAPE e is x ~~ like_escape(p, e), the pattern is rewritten to use
+backslash as its escape. ILIKE compares characters lower cased
+*/
+
+type likeResult int
+
+const (
+	likeTrue  likeResult = iota
+	likeFalse            //No match here
+	likeAbort            //No match at any later start either, the caller can stop trying
+)
+
+/*
+likeMatch matches str against pattern. When a % is followed by more pattern, the rest of the pattern is
+tried at every position of the rest of str. likeAbort means str ran out before the pattern did,
+so starting later cannot help, which keeps patterns with many %s from taking exponential time
+*/
+func likeMatch(str []rune, pattern []rune, caseInsensitive bool) (likeResult, error) {
+	equal := func(a rune, b rune) bool {
+		return a == b || caseInsensitive && unicode.ToLower(a) == unicode.ToLower(b)
+	}
+	for len(pattern) > 0 && len(str) > 0 {
+		switch pattern[0] {
+		case '\\':
+			pattern = pattern[1:]
+			if len(pattern) == 0 {
+				return likeFalse, fmt.Errorf("LIKE pattern must not end with escape character")
+			}
+			if !equal(pattern[0], str[0]) {
+				return likeFalse, nil
+			}
+		case '%':
+			//A run of % and _ matches any string at least as long as the number of _s
+			for len(pattern) > 0 && (pattern[0] == '%' || pattern[0] == '_') {
+				if pattern[0] == '_' {
+					if len(str) == 0 {
+						return likeAbort, nil
+					}
+					str = str[1:]
+				}
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return likeTrue, nil
+			}
+			first := pattern[0]
+			if first == '\\' {
+				if len(pattern) < 2 {
+					return likeFalse, fmt.Errorf("LIKE pattern must not end with escape character")
+				}
+				first = pattern[1]
+			}
+			//Only positions where the next literal character matches are worth a try
+			for ; len(str) > 0; str = str[1:] {
+				if !equal(str[0], first) {
+					continue
+				}
+				result, err := likeMatch(str, pattern, caseInsensitive)
+				if result != likeFalse || err != nil {
+					return result, err
+				}
+			}
+			return likeAbort, nil
+		case '_':
+		default:
+			if !equal(pattern[0], str[0]) {
+				return likeFalse, nil
+			}
+		}
+		pattern, str = pattern[1:], str[1:]
+	}
+	if len(str) > 0 {
+		return likeFalse, nil
+	}
+	//Trailing %s match the empty rest
+	for len(pattern) > 0 && pattern[0] == '%' {
+		pattern = pattern[1:]
+	}
+	if len(pattern) == 0 {
+		return likeTrue, nil
+	}
+	return likeAbort, nil
+}
+
+func textLike(str string, pattern string, caseInsensitive bool) (bool, error) {
+	result, err := likeMatch([]rune(str), []rune(pattern), caseInsensitive)
+	return result == likeTrue, err
+}
+
+/*
+likeEscape rewrites a pattern written with escape character escape to one using backslash.
+An empty escape turns escaping off, backslashes become literal
+*/
+func likeEscape(pattern string, escape string) (string, error) {
+	escapeChars := []rune(escape)
+	switch {
+	case len(escapeChars) > 1:
+		return "", fmt.Errorf("invalid escape string")
+	case escape == "\\":
+		return pattern, nil
+	}
+	var sb strings.Builder
+	afterEscape := false
+	for _, c := range pattern {
+		switch {
+		case len(escapeChars) == 0 && c == '\\':
+			sb.WriteString("\\\\")
+		case len(escapeChars) == 1 && c == escapeChars[0] && !afterEscape:
+			sb.WriteRune('\\')
+			afterEscape = true
+			continue
+		case c == '\\':
+			if !afterEscape {
+				sb.WriteRune('\\')
+			}
+			sb.WriteRune(c)
+		default:
+			sb.WriteRune(c)
+		}
+		afterEscape = false
+	}
+	return sb.String(), nil
+}
+
+/*
+LikeFixedPrefix returns the literal characters a LIKE pattern starts with, every string it matches begins
+with them (postgres like_fixed_prefix). exact is true when the pattern has no wildcards, it only matches
+the prefix itself
+*/
+func LikeFixedPrefix(pattern string) (prefix string, exact bool) {
+	var sb strings.Builder
+	chars := []rune(pattern)
+	for i := 0; i < len(chars); i++ {
+		switch chars[i] {
+		case '%', '_':
+			return sb.String(), false
+		case '\\':
+			i++
+			if i == len(chars) {
+				return sb.String(), false
+			}
+		}
+		sb.WriteRune(chars[i])
+	}
+	return sb.String(), true
+}
+
+/*
+MakeGreaterString returns the smallest string greater than every string starting with prefix in the
+byte order text compares in (postgres make_greater_string): the last byte that is not 0xff incremented
+and what follows it dropped. ok is false when there is no such byte
+*/
+func MakeGreaterString(prefix string) (string, bool) {
+	bytes := []byte(prefix)
+	for i := len(bytes) - 1; i >= 0; i-- {
+		if bytes[i] < 0xff {
+			bytes[i]++
+			return string(bytes[:i+1]), true
+		}
+	}
+	return "", false
+}
+
+func init() {
+	const (
+		text    = types.TEXTOID
+		boolean = types.BOOLOID
+	)
+
+	//~~ is LIKE and ~~* ILIKE, the ! forms are NOT LIKE and NOT ILIKE
+	likeOperator := func(caseInsensitive bool, negated bool) func(l, r types.Datum) (types.Datum, error) {
+		return func(l, r types.Datum) (types.Datum, error) {
+			matched, err := textLike(l.(string), r.(string), caseInsensitive)
+			if err != nil {
+				return nil, err
+			}
+			return matched != negated, nil
+		}
+	}
+	addOperator("~~", text, text, boolean, likeOperator(false, false))
+	addOperator("!~~", text, text, boolean, likeOperator(false, true))
+	addOperator("~~*", text, text, boolean, likeOperator(true, false))
+	addOperator("!~~*", text, text, boolean, likeOperator(true, true))
+
+	addFunction("like_escape", []types.Oid{text, text}, text, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		pattern, err := likeEscape(fcinfo.Args[0].(string), fcinfo.Args[1].(string))
+		if err != nil {
+			return nil, err
+		}
+		return pattern, nil
+	})
+}
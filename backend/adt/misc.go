@@ -0,0 +1,45 @@
+package adt
+
+import (
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+Functions about the server and its catalogs (postgres utils/adt/misc.c, format_type.c and name.c)
+There is one database and no per session search_path, so current_database and current_schema are constants
+*/
+
+const (
+	databaseName  = "diskquery"
+	currentSchema = "public"
+)
+
+func init() {
+	const (
+		text = types.TEXTOID
+		int8 = types.INT8OID
+	)
+
+	addFunction("current_database", nil, text, func(*FunctionCallInfo) (types.Datum, error) {
+		return databaseName, nil
+	})
+	addFunction("current_schema", nil, text, func(*FunctionCallInfo) (types.Datum, error) {
+		return currentSchema, nil
+	})
+
+	//format_type(type oid, typmod), a NULL typmod is the name without modifiers
+	addFunction("format_type", []types.Oid{int8, int8}, text, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		if fcinfo.Args[0] == nil {
+			return nil, nil
+		}
+		typmod := int32(-1)
+		if fcinfo.Args[1] != nil {
+			typmod = int32(fcinfo.Args[1].(int64))
+		}
+		typ := types.Oid(fcinfo.Args[0].(int64))
+		if LookupType(typ) == nil {
+			return "???", nil
+		}
+		return FormatType(typ, typmod), nil
+	}).Strict = false
+}
@@ -0,0 +1,945 @@
+package adt
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+Exact decimal numbers (postgres utils/adt/numeric.c)
+
+A Numeric is coef * 10^-scale, scale being the number of digits after the decimal point the value shows:
+1.50 keeps its scale 2 and prints as 1.50, but is equal to 1.5. Besides finite values there are NaN
+(equal to itself and bigger than everything, like for double precision) and +-Infinity.
+Values are immutable, operations return new ones.
+
+A column or cast can limit the digits with a type modifier, numeric(precision, scale): values are rounded
+to scale digits after the point and may have at most precision - scale digits before it
+*/
+
+const (
+	NUMERIC_MAX_SCALE              = 16383  //Digits after the decimal point
+	NUMERIC_MAX_WEIGHT_DIGITS      = 131072 //Digits before the decimal point
+	numericMaxInputExponent        = NUMERIC_MAX_WEIGHT_DIGITS + NUMERIC_MAX_SCALE
+	numericFloat8SignificantDigits = 15 //DBL_DIG, what a double precision converts to numeric with
+
+	NUMERIC_MAX_PRECISION     = 1000 //Limits of the typmod in numeric(precision, scale)
+	NUMERIC_MIN_SCALE         = -1000
+	NUMERIC_MAX_DISPLAY_SCALE = NUMERIC_MAX_PRECISION //Most digits after the point a division or power produces
+	NUMERIC_MIN_SIG_DIGITS    = 16                    //Fewest significant digits a division or power produces
+
+	//The wire format stores base 10000 digits
+	NBASE      = 10000
+	DEC_DIGITS = 4
+
+	VARHDRSZ = 4 //Type modifiers are offset by this, so no valid typmod is 0 or -1
+)
+
+type numericKind uint8
+
+const (
+	numericFinite numericKind = iota
+	numericNaN
+	numericPInf
+	numericNInf
+)
+
+type Numeric struct {
+	coef  *big.Int
+	scale int32
+	kind  numericKind
+}
+
+var bigTen = big.NewInt(10)
+
+func pow10(n int32) *big.Int {
+	return new(big.Int).Exp(bigTen, big.NewInt(int64(n)), nil)
+}
+
+func NumericNaN() Numeric {
+	return Numeric{kind: numericNaN}
+}
+
+func NumericFromInt64(v int64) Numeric {
+	return Numeric{coef: big.NewInt(v)}
+}
+
+// NumericFromFloat64 keeps the 15 significant digits a double precision is good for
+func NumericFromFloat64(f float64) Numeric {
+	switch {
+	case math.IsNaN(f):
+		return Numeric{kind: numericNaN}
+	case math.IsInf(f, 1):
+		return Numeric{kind: numericPInf}
+	case math.IsInf(f, -1):
+		return Numeric{kind: numericNInf}
+	}
+	n, _ := ParseNumeric(strconv.FormatFloat(f, 'g', numericFloat8SignificantDigits, 64))
+	return n
+}
+
+/*
+ParseNumeric reads [+-]digits[.digits][e[+-]digits], NaN or [+-]Infinity
+An exponent moves the decimal point, 1.5e3 is 1500 with scale 0 and 15e-1 is 1.5
+*/
+func ParseNumeric(str string) (Numeric, error) {
+	syntaxError := fmt.Errorf("invalid input syntax for type numeric: \"%s\"", str)
+	value := strings.TrimSpace(str)
+	switch strings.ToLower(value) {
+	case "nan":
+		return Numeric{kind: numericNaN}, nil
+	case "infinity", "+infinity", "inf", "+inf":
+		return Numeric{kind: numericPInf}, nil
+	case "-infinity", "-inf":
+		return Numeric{kind: numericNInf}, nil
+	}
+
+	mantissa, exponent := value, int64(0)
+	if i := strings.IndexAny(value, "eE"); i >= 0 {
+		exp, err := strconv.ParseInt(value[i+1:], 10, 64)
+		if err != nil {
+			return Numeric{}, syntaxError
+		}
+		if exp > numericMaxInputExponent || exp < -numericMaxInputExponent {
+			return Numeric{}, fmt.Errorf("value overflows numeric format")
+		}
+		mantissa, exponent = value[:i], exp
+	}
+
+	negative := false
+	if mantissa != "" && (mantissa[0] == '+' || mantissa[0] == '-') {
+		negative = mantissa[0] == '-'
+		mantissa = mantissa[1:]
+	}
+	intPart, fracPart, _ := strings.Cut(mantissa, ".")
+	if intPart == "" && fracPart == "" {
+		return Numeric{}, syntaxError
+	}
+	for _, part := range []string{intPart, fracPart} {
+		for i := 0; i < len(part); i++ {
+			if part[i] < '0' || part[i] > '9' {
+				return Numeric{}, syntaxError
+			}
+		}
+	}
+
+	coef, _ := new(big.Int).SetString(intPart+fracPart, 10)
+	scale := int64(len(fracPart)) - exponent
+	if scale < 0 {
+		coef.Mul(coef, pow10(int32(-scale)))
+		scale = 0
+	}
+	if negative {
+		coef.Neg(coef)
+	}
+	n := Numeric{coef: coef, scale: int32(min(scale, math.MaxInt32))}
+	if err := n.checkRange(); err != nil {
+		return Numeric{}, err
+	}
+	return n, nil
+}
+
+func (n Numeric) checkRange() error {
+	if n.kind != numericFinite {
+		return nil
+	}
+	if n.scale > NUMERIC_MAX_SCALE || len(n.coef.Text(10))-int(n.scale) > NUMERIC_MAX_WEIGHT_DIGITS+1 {
+		return fmt.Errorf("value overflows numeric format")
+	}
+	return nil
+}
+
+func (n Numeric) String() string {
+	switch n.kind {
+	case numericNaN:
+		return "NaN"
+	case numericPInf:
+		return "Infinity"
+	case numericNInf:
+		return "-Infinity"
+	}
+	digits := new(big.Int).Abs(n.coef).Text(10)
+	if n.scale > 0 {
+		if pad := int(n.scale) + 1 - len(digits); pad > 0 {
+			digits = strings.Repeat("0", pad) + digits
+		}
+		point := len(digits) - int(n.scale)
+		digits = digits[:point] + "." + digits[point:]
+	}
+	if n.coef.Sign() < 0 {
+		return "-" + digits
+	}
+	return digits
+}
+
+func (n Numeric) IsNaN() bool {
+	return n.kind == numericNaN
+}
+
+// Cmp returns -1, 0 or 1, -Infinity < finite values < Infinity < NaN
+func (n Numeric) Cmp(other Numeric) int {
+	if n.kind != numericFinite || other.kind != numericFinite {
+		return compareOrdered(int64(n.order()), int64(other.order()))
+	}
+	a, b := n.coef, other.coef
+	switch {
+	case n.scale < other.scale:
+		a = new(big.Int).Mul(a, pow10(other.scale-n.scale))
+	case n.scale > other.scale:
+		b = new(big.Int).Mul(b, pow10(n.scale-other.scale))
+	}
+	return a.Cmp(b)
+}
+
+// order ranks the kinds of values, finite values are all in one rank
+func (n Numeric) order() int {
+	switch n.kind {
+	case numericNInf:
+		return -1
+	case numericPInf:
+		return 1
+	case numericNaN:
+		return 2
+	}
+	return 0
+}
+
+// normalized is the same value with the trailing zeros after the decimal point dropped
+func (n Numeric) normalized() Numeric {
+	if n.kind != numericFinite || n.scale == 0 || n.coef.Sign() == 0 {
+		if n.kind == numericFinite {
+			return Numeric{coef: n.coef}
+		}
+		return n
+	}
+	coef, scale := new(big.Int).Set(n.coef), n.scale
+	quotient, remainder := new(big.Int), new(big.Int)
+	for scale > 0 {
+		quotient.QuoRem(coef, bigTen, remainder)
+		if remainder.Sign() != 0 {
+			break
+		}
+		coef.Set(quotient)
+		scale--
+	}
+	return Numeric{coef: coef, scale: scale}
+}
+
+// Int64 rounds to the nearest integer, halves away from zero
+func (n Numeric) Int64() (int64, error) {
+	switch n.kind {
+	case numericNaN:
+		return 0, fmt.Errorf("cannot convert NaN to bigint")
+	case numericPInf, numericNInf:
+		return 0, fmt.Errorf("cannot convert infinity to bigint")
+	}
+	rounded := n.Round(0, ROUND_HALF_UP)
+	if !rounded.coef.IsInt64() {
+		return 0, fmt.Errorf("bigint out of range")
+	}
+	return rounded.coef.Int64(), nil
+}
+
+func (n Numeric) Float64() float64 {
+	switch n.kind {
+	case numericNaN:
+		return math.NaN()
+	case numericPInf:
+		return math.Inf(1)
+	case numericNInf:
+		return math.Inf(-1)
+	}
+	f, _ := strconv.ParseFloat(n.String(), 64)
+	return f
+}
+
+func numericIn(str string, _ *Settings) (types.Datum, error) {
+	n, err := ParseNumeric(str)
+	if err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+func numericOut(d types.Datum, _ *Settings) string {
+	return d.(Numeric).String()
+}
+
+func numericCmp(a types.Datum, b types.Datum) int {
+	return a.(Numeric).Cmp(b.(Numeric))
+}
+
+func hashNumeric(buf []byte, d types.Datum) []byte {
+	n := d.(Numeric).normalized()
+	buf = append(buf, byte(n.kind))
+	if n.kind != numericFinite {
+		return buf
+	}
+	buf = append(buf, byte(n.scale>>8), byte(n.scale), byte(n.coef.Sign()+1))
+	magnitude := n.coef.Bytes()
+	buf = binary.AppendUvarint(buf, uint64(len(magnitude)))
+	return append(buf, magnitude...)
+}
+
+// Sign word of the wire format
+const (
+	NUMERIC_POS  uint16 = 0x0000
+	NUMERIC_NEG  uint16 = 0x4000
+	NUMERIC_NAN  uint16 = 0xC000
+	NUMERIC_PINF uint16 = 0xD000
+	NUMERIC_NINF uint16 = 0xF000
+)
+
+/*
+numericSend writes ndigits, weight, sign and dscale as 16 bit words followed by the base 10000 digits,
+weight being the power of NBASE the first digit is worth. Digit groups are aligned on the decimal point,
+leading and trailing zero digits are left out: 12345.6 is [1, 2345, 6000] with weight 1
+*/
+func numericSend(d types.Datum) []byte {
+	n := d.(Numeric)
+	header := func(ndigits int, weight int, sign uint16, dscale int32) []byte {
+		buf := binary.BigEndian.AppendUint16(nil, uint16(ndigits))
+		buf = binary.BigEndian.AppendUint16(buf, uint16(int16(weight)))
+		buf = binary.BigEndian.AppendUint16(buf, sign)
+		return binary.BigEndian.AppendUint16(buf, uint16(dscale))
+	}
+	switch n.kind {
+	case numericNaN:
+		return header(0, 0, NUMERIC_NAN, 0)
+	case numericPInf:
+		return header(0, 0, NUMERIC_PINF, 0)
+	case numericNInf:
+		return header(0, 0, NUMERIC_NINF, 0)
+	}
+
+	sign := NUMERIC_POS
+	if n.coef.Sign() < 0 {
+		sign = NUMERIC_NEG
+	}
+	digits := new(big.Int).Abs(n.coef).Text(10)
+	fracPad := (DEC_DIGITS - int(n.scale)%DEC_DIGITS) % DEC_DIGITS
+	fracGroups := (int(n.scale) + fracPad) / DEC_DIGITS
+	digits += strings.Repeat("0", fracPad)
+	if rem := len(digits) % DEC_DIGITS; rem != 0 {
+		digits = strings.Repeat("0", DEC_DIGITS-rem) + digits
+	}
+
+	groups := make([]uint16, 0, len(digits)/DEC_DIGITS)
+	for i := 0; i < len(digits); i += DEC_DIGITS {
+		group, _ := strconv.Atoi(digits[i : i+DEC_DIGITS])
+		groups = append(groups, uint16(group))
+	}
+	weight := len(groups) - fracGroups - 1
+	for len(groups) > 0 && groups[0] == 0 {
+		groups = groups[1:]
+		weight--
+	}
+	for len(groups) > 0 && groups[len(groups)-1] == 0 {
+		groups = groups[:len(groups)-1]
+	}
+	if len(groups) == 0 {
+		weight = 0
+	}
+
+	buf := header(len(groups), weight, sign, n.scale)
+	for _, group := range groups {
+		buf = binary.BigEndian.AppendUint16(buf, group)
+	}
+	return buf
+}
+
+func numericRecv(buf []byte) (types.Datum, error) {
+	if len(buf) < 8 {
+		return nil, fmt.Errorf("insufficient data left in message")
+	}
+	ndigits := int(binary.BigEndian.Uint16(buf[0:]))
+	weight := int(int16(binary.BigEndian.Uint16(buf[2:])))
+	sign := binary.BigEndian.Uint16(buf[4:])
+	dscale := int32(binary.BigEndian.Uint16(buf[6:]))
+	switch sign {
+	case NUMERIC_POS, NUMERIC_NEG:
+	case NUMERIC_NAN:
+		return Numeric{kind: numericNaN}, nil
+	case NUMERIC_PINF:
+		return Numeric{kind: numericPInf}, nil
+	case NUMERIC_NINF:
+		return Numeric{kind: numericNInf}, nil
+	default:
+		return nil, fmt.Errorf("invalid sign in external \"numeric\" value")
+	}
+	if dscale > NUMERIC_MAX_SCALE {
+		return nil, fmt.Errorf("invalid scale in external \"numeric\" value")
+	}
+	if len(buf) != 8+2*ndigits {
+		return nil, fmt.Errorf("insufficient data left in message")
+	}
+
+	coef := new(big.Int)
+	nbase := big.NewInt(NBASE)
+	for i := 0; i < ndigits; i++ {
+		digit := binary.BigEndian.Uint16(buf[8+2*i:])
+		if digit >= NBASE {
+			return nil, fmt.Errorf("invalid digit in external \"numeric\" value")
+		}
+		coef.Mul(coef, nbase).Add(coef, big.NewInt(int64(digit)))
+	}
+	if sign == NUMERIC_NEG {
+		coef.Neg(coef)
+	}
+	//The last digit is worth NBASE^(weight - ndigits + 1), the value shows dscale digits after the point
+	n := Numeric{coef: coef}
+	if exponent := DEC_DIGITS * (weight - ndigits + 1); exponent >= 0 {
+		n.coef.Mul(n.coef, pow10(int32(exponent)))
+	} else {
+		n.scale = int32(-exponent)
+	}
+	n = n.Round(dscale, ROUND_HALF_UP)
+	if err := n.checkRange(); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+/*
+Type modifier of numeric(precision, scale), postgres packs both into one int32:
+((precision << 16) | (scale & 0x7ff)) + VARHDRSZ, the scale is 11 bit two's complement (it may be negative,
+numeric(3, -2) rounds to hundreds). numeric(precision) has scale 0, plain numeric has no typmod at all
+*/
+func numericTypmodIn(typmods []int64) (int32, error) {
+	if len(typmods) < 1 || len(typmods) > 2 {
+		return 0, fmt.Errorf("invalid NUMERIC type modifier")
+	}
+	precision, scale := typmods[0], int64(0)
+	if len(typmods) == 2 {
+		scale = typmods[1]
+	}
+	if precision < 1 || precision > NUMERIC_MAX_PRECISION {
+		return 0, fmt.Errorf("NUMERIC precision %d must be between 1 and %d", precision, NUMERIC_MAX_PRECISION)
+	}
+	if scale < NUMERIC_MIN_SCALE || scale > NUMERIC_MAX_PRECISION {
+		return 0, fmt.Errorf("NUMERIC scale %d must be between %d and %d", scale, NUMERIC_MIN_SCALE, NUMERIC_MAX_PRECISION)
+	}
+	return int32((precision<<16)|(scale&0x7ff)) + VARHDRSZ, nil
+}
+
+func numericTypmodPrecision(typmod int32) int32 {
+	return ((typmod - VARHDRSZ) >> 16) & 0xffff
+}
+
+func numericTypmodScale(typmod int32) int32 {
+	return (((typmod - VARHDRSZ) & 0x7ff) ^ 1024) - 1024
+}
+
+func numericTypmodOut(typmod int32) string {
+	return fmt.Sprintf("(%d,%d)", numericTypmodPrecision(typmod), numericTypmodScale(typmod))
+}
+
+// applyNumericTypmod rounds a value to the scale of the typmod and checks it has no more digits before the point than allowed
+func applyNumericTypmod(d types.Datum, typmod int32) (types.Datum, error) {
+	if typmod < VARHDRSZ {
+		return d, nil
+	}
+	n := d.(Numeric)
+	precision, scale := numericTypmodPrecision(typmod), numericTypmodScale(typmod)
+	switch n.kind {
+	case numericNaN:
+		return n, nil
+	case numericPInf, numericNInf:
+		return nil, fmt.Errorf("numeric field overflow, a field with precision %d, scale %d cannot hold an infinite value", precision, scale)
+	}
+
+	rounded := n.Round(scale, ROUND_HALF_UP)
+	if maxDigits := precision - scale; rounded.coef.Sign() != 0 && rounded.integerDigits() > maxDigits {
+		limit := "1"
+		if maxDigits > 0 {
+			limit = fmt.Sprintf("10^%d", maxDigits)
+		}
+		return nil, fmt.Errorf("numeric field overflow, a field with precision %d, scale %d must round to an absolute value less than %s",
+			precision, scale, limit)
+	}
+	return rounded, nil
+}
+
+// integerDigits is the number of digits before the decimal point of a non zero finite value, 0.05 has -1
+func (n Numeric) integerDigits() int32 {
+	return int32(len(new(big.Int).Abs(n.coef).Text(10))) - n.scale
+}
+
+/*
+Rounding
+
+Rounding a value to a scale drops the digits after it and adjusts the last digit kept by the mode.
+round() and typmods round halves away from zero like postgres, trunc() is ROUND_DOWN. A negative
+scale rounds to tens, hundreds and so on. Rounding to a scale bigger than the value's pads with zeros
+*/
+
+type RoundingMode int
+
+const (
+	ROUND_HALF_UP   RoundingMode = iota //Nearest, halves away from zero
+	ROUND_HALF_EVEN                     //Nearest, halves to the even neighbour (banker's rounding)
+	ROUND_DOWN                          //Toward zero, truncation
+	ROUND_UP                            //Away from zero
+	ROUND_CEILING                       //Toward +Infinity
+	ROUND_FLOOR                         //Toward -Infinity
+)
+
+func (n Numeric) Round(scale int32, mode RoundingMode) Numeric {
+	if n.kind != numericFinite {
+		return n
+	}
+	if scale >= n.scale {
+		return Numeric{coef: new(big.Int).Mul(n.coef, pow10(scale-n.scale)), scale: scale}
+	}
+	coef := roundQuotient(n.coef, pow10(n.scale-scale), mode)
+	if scale < 0 {
+		coef.Mul(coef, pow10(-scale))
+		scale = 0
+	}
+	return Numeric{coef: coef, scale: scale}
+}
+
+// roundQuotient divides num by den rounding by mode, den must not be zero
+func roundQuotient(num *big.Int, den *big.Int, mode RoundingMode) *big.Int {
+	quotient, remainder := new(big.Int).QuoRem(num, den, new(big.Int))
+	if remainder.Sign() == 0 {
+		return quotient
+	}
+	//The exact quotient is between quotient and quotient + sign, which one depends on the mode
+	sign := num.Sign() * den.Sign()
+	awayFromZero := false
+	switch mode {
+	case ROUND_HALF_UP, ROUND_HALF_EVEN:
+		//Compare |remainder| * 2 with |den| to know which side of the half we are on
+		half := new(big.Int).Abs(remainder)
+		half.Lsh(half, 1)
+		cmp := half.CmpAbs(den)
+		awayFromZero = cmp > 0 || (cmp == 0 && (mode == ROUND_HALF_UP || quotient.Bit(0) == 1))
+	case ROUND_DOWN:
+	case ROUND_UP:
+		awayFromZero = true
+	case ROUND_CEILING:
+		awayFromZero = sign > 0
+	case ROUND_FLOOR:
+		awayFromZero = sign < 0
+	}
+	if awayFromZero {
+		quotient.Add(quotient, big.NewInt(int64(sign)))
+	}
+	return quotient
+}
+
+/*
+Arithmetic
+
+Results are exact where they can be: sums and differences have the larger scale of the operands,
+products the sum of both scales. Division cannot be exact, the quotient gets at least
+NUMERIC_MIN_SIG_DIGITS significant digits and no fewer digits after the point than either operand
+(postgres select_div_scale), so 1 / 3 is 0.33333333333333333333 and 10 / 4 is 2.5000000000000000.
+
+NaN with anything is NaN, infinities follow the IEEE rules (Infinity - Infinity and 0 * Infinity are NaN)
+*/
+
+// Sign is -1, 0 or 1, and 0 for NaN
+func (n Numeric) Sign() int {
+	switch n.kind {
+	case numericPInf:
+		return 1
+	case numericNInf:
+		return -1
+	case numericNaN:
+		return 0
+	}
+	return n.coef.Sign()
+}
+
+func numericInf(sign int) Numeric {
+	if sign < 0 {
+		return Numeric{kind: numericNInf}
+	}
+	return Numeric{kind: numericPInf}
+}
+
+func (n Numeric) Neg() Numeric {
+	switch n.kind {
+	case numericPInf:
+		return Numeric{kind: numericNInf}
+	case numericNInf:
+		return Numeric{kind: numericPInf}
+	case numericNaN:
+		return n
+	}
+	return Numeric{coef: new(big.Int).Neg(n.coef), scale: n.scale}
+}
+
+func (n Numeric) Abs() Numeric {
+	if n.Sign() < 0 {
+		return n.Neg()
+	}
+	return n
+}
+
+// alignScales returns the coefficients of a and b at the larger of their scales
+func alignScales(a Numeric, b Numeric) (*big.Int, *big.Int, int32) {
+	switch {
+	case a.scale < b.scale:
+		return new(big.Int).Mul(a.coef, pow10(b.scale-a.scale)), b.coef, b.scale
+	case a.scale > b.scale:
+		return a.coef, new(big.Int).Mul(b.coef, pow10(a.scale-b.scale)), a.scale
+	}
+	return a.coef, b.coef, a.scale
+}
+
+// finish checks a computed value fits the numeric format
+func (n Numeric) finish() (Numeric, error) {
+	if err := n.checkRange(); err != nil {
+		return Numeric{}, err
+	}
+	return n, nil
+}
+
+func (n Numeric) Add(other Numeric) (Numeric, error) {
+	if n.kind != numericFinite || other.kind != numericFinite {
+		switch {
+		case n.kind == numericNaN || other.kind == numericNaN:
+			return NumericNaN(), nil
+		case n.kind != numericFinite && other.kind != numericFinite && n.kind != other.kind:
+			return NumericNaN(), nil
+		case n.kind != numericFinite:
+			return n, nil
+		}
+		return other, nil
+	}
+	a, b, scale := alignScales(n, other)
+	return Numeric{coef: new(big.Int).Add(a, b), scale: scale}.finish()
+}
+
+func (n Numeric) Sub(other Numeric) (Numeric, error) {
+	return n.Add(other.Neg())
+}
+
+func (n Numeric) Mul(other Numeric) (Numeric, error) {
+	if n.kind != numericFinite || other.kind != numericFinite {
+		if n.kind == numericNaN || other.kind == numericNaN || n.Sign() == 0 || other.Sign() == 0 {
+			return NumericNaN(), nil
+		}
+		return numericInf(n.Sign() * other.Sign()), nil
+	}
+	return Numeric{coef: new(big.Int).Mul(n.coef, other.coef), scale: n.scale + other.scale}.finish()
+}
+
+func (n Numeric) Div(other Numeric) (Numeric, error) {
+	if n.kind == numericNaN || other.kind == numericNaN {
+		return NumericNaN(), nil
+	}
+	if other.Sign() == 0 {
+		return Numeric{}, fmt.Errorf("division by zero")
+	}
+	switch {
+	case n.kind != numericFinite && other.kind != numericFinite:
+		return NumericNaN(), nil
+	case n.kind != numericFinite:
+		return numericInf(n.Sign() * other.Sign()), nil
+	case other.kind != numericFinite:
+		return NumericFromInt64(0), nil
+	}
+
+	rscale := selectDivScale(n, other)
+	//n / other at scale rscale is n.coef * 10^(rscale + other.scale - n.scale) / other.coef, rscale >= n.scale
+	num := new(big.Int).Mul(n.coef, pow10(rscale+other.scale-n.scale))
+	return Numeric{coef: roundQuotient(num, other.coef, ROUND_HALF_UP), scale: rscale}.finish()
+}
+
+/*
+selectDivScale estimates the weight of the quotient from the leading base 10000 digits of the operands
+(the way postgres does, so we print the same number of digits) and gives it NUMERIC_MIN_SIG_DIGITS
+significant digits
+*/
+func selectDivScale(a Numeric, b Numeric) int32 {
+	weight1, firstDigit1 := a.leadingDigit()
+	weight2, firstDigit2 := b.leadingDigit()
+	qweight := weight1 - weight2
+	if firstDigit1 <= firstDigit2 {
+		qweight--
+	}
+	rscale := NUMERIC_MIN_SIG_DIGITS - qweight*DEC_DIGITS
+	rscale = max(rscale, a.scale, b.scale, 0)
+	return min(rscale, NUMERIC_MAX_DISPLAY_SCALE)
+}
+
+// leadingDigit is the weight and value of the first non zero base 10000 digit, 0 and 0 for zero
+func (n Numeric) leadingDigit() (int32, int) {
+	if n.coef.Sign() == 0 {
+		return 0, 0
+	}
+	digits := new(big.Int).Abs(n.coef).Text(10)
+	exponent := int32(len(digits)) - 1 - n.scale //The leading decimal digit is worth 10^exponent
+	weight := floorDiv(int64(exponent), DEC_DIGITS)
+	//The base 10000 digit holds the decimal digits from 10^exponent down to 10^(4 * weight)
+	width := int(int64(exponent)-weight*DEC_DIGITS) + 1
+	if len(digits) < width {
+		digits += strings.Repeat("0", width-len(digits))
+	}
+	first, _ := strconv.Atoi(digits[:width])
+	return int32(weight), first
+}
+
+// Mod is the remainder of the truncating division, it has the sign of n
+func (n Numeric) Mod(other Numeric) (Numeric, error) {
+	if n.kind == numericNaN || other.kind == numericNaN {
+		return NumericNaN(), nil
+	}
+	if other.Sign() == 0 {
+		return Numeric{}, fmt.Errorf("division by zero")
+	}
+	switch {
+	case n.kind != numericFinite:
+		return NumericNaN(), nil
+	case other.kind != numericFinite:
+		return n, nil
+	}
+	a, b, scale := alignScales(n, other)
+	return Numeric{coef: new(big.Int).Rem(a, b), scale: scale}, nil
+}
+
+/*
+Power raises n to exp. An integer exponent is computed exactly and rounded, anything else goes through
+double precision. Like division the result gets NUMERIC_MIN_SIG_DIGITS significant digits and at least
+the scales of the operands
+*/
+func (n Numeric) Power(exp Numeric) (Numeric, error) {
+	switch {
+	case n.kind == numericNaN || exp.kind == numericNaN:
+		//1 ^ anything and anything ^ 0 are 1, even for NaN
+		if (n.kind == numericFinite && n.Cmp(NumericFromInt64(1)) == 0) || (exp.kind == numericFinite && exp.Sign() == 0) {
+			return NumericFromInt64(1), nil
+		}
+		return NumericNaN(), nil
+	case n.kind == numericFinite && n.Sign() == 0 && exp.Sign() < 0:
+		return Numeric{}, fmt.Errorf("zero raised to a negative power is undefined")
+	}
+	integerExp := exp.kind == numericFinite && exp.normalized().scale == 0
+	if n.Sign() < 0 && !integerExp {
+		return Numeric{}, fmt.Errorf("a negative number raised to a non-integer power yields a complex result")
+	}
+	if n.kind != numericFinite || exp.kind != numericFinite {
+		return NumericFromFloat64(math.Pow(n.Float64(), exp.Float64())), nil
+	}
+	if exp.Sign() == 0 {
+		return Numeric{coef: big.NewInt(1), scale: max(n.scale, exp.scale)}, nil
+	}
+	if n.Sign() == 0 {
+		return Numeric{coef: big.NewInt(0), scale: max(n.scale, exp.scale)}, nil
+	}
+
+	//log10 of the result tells how many digits it has before the point
+	resultLog10 := exp.Float64() * n.log10Abs()
+	if resultLog10 > NUMERIC_MAX_WEIGHT_DIGITS {
+		return Numeric{}, fmt.Errorf("value overflows numeric format")
+	}
+	rscale := NUMERIC_MIN_SIG_DIGITS - int32(resultLog10)
+	rscale = max(rscale, n.scale, exp.scale, 0)
+	rscale = min(rscale, NUMERIC_MAX_DISPLAY_SCALE)
+	if resultLog10 < -float64(rscale)-1 {
+		return Numeric{coef: big.NewInt(0), scale: rscale}, nil
+	}
+
+	if !integerExp {
+		//exp(exp * ln(n)) with enough bits for the digits before the point, rscale after it and some to spare
+		prec := uint((max(resultLog10, 0)+float64(rscale)+20)*math.Log2(10)) + 64
+		result := bigExp(new(big.Float).SetPrec(prec).Mul(bigLn(n.bigFloat(prec)), exp.bigFloat(prec)))
+		//Extra digits so the text conversion does not round before we do
+		value, err := ParseNumeric(result.Text('f', int(rscale)+10))
+		if err != nil {
+			return Numeric{}, err
+		}
+		return value.Round(rscale, ROUND_HALF_UP).finish()
+	}
+
+	//n^k = coef^k / 10^(scale * k), a negative k flips the fraction
+	k := exp.normalized().coef
+	power := new(big.Int).Exp(n.coef, new(big.Int).Abs(k), nil)
+	denominator := new(big.Int).Exp(bigTen, new(big.Int).Mul(big.NewInt(int64(n.scale)), new(big.Int).Abs(k)), nil)
+	if k.Sign() < 0 {
+		power, denominator = denominator, power
+	}
+	power.Mul(power, pow10(rscale))
+	return Numeric{coef: roundQuotient(power, denominator, ROUND_HALF_UP), scale: rscale}.finish()
+}
+
+/*
+Sqrt is the square root of n, with about NUMERIC_MIN_SIG_DIGITS significant digits and at least the scale
+of n (postgres numeric_sqrt, which estimates the digits from the base 10000 weight the same way)
+*/
+func (n Numeric) Sqrt() (Numeric, error) {
+	switch {
+	case n.kind == numericNaN || n.kind == numericPInf:
+		return n, nil
+	case n.Sign() < 0:
+		return Numeric{}, fmt.Errorf("cannot take square root of a negative number")
+	}
+	weight, _ := n.leadingDigit()
+	sweight := (weight+1)*DEC_DIGITS/2 - 1
+	rscale := NUMERIC_MIN_SIG_DIGITS - sweight
+	rscale = max(rscale, n.scale, 0)
+	rscale = min(rscale, NUMERIC_MAX_DISPLAY_SCALE)
+
+	//The integer square root of coef * 10^(2 * (rscale + 1) - scale) has one digit more than we keep
+	radicand := new(big.Int).Mul(n.coef, pow10(2*(rscale+1)-n.scale))
+	root := new(big.Int).Sqrt(radicand)
+	return Numeric{coef: roundQuotient(root, bigTen, ROUND_HALF_UP), scale: rscale}.finish()
+}
+
+func (n Numeric) bigFloat(prec uint) *big.Float {
+	f := new(big.Float).SetPrec(prec).SetInt(n.coef)
+	return f.Quo(f, new(big.Float).SetPrec(prec).SetInt(pow10(n.scale)))
+}
+
+/*
+bigLn is the natural logarithm of x > 0 at the precision of x. With x = m * 2^k, m in [0.5, 1),
+ln(x) = k * ln(2) + ln(m), m is brought close to 1 by square roots and ln(m) = 2 * atanh((m - 1) / (m + 1))
+is summed as a series
+*/
+func bigLn(x *big.Float) *big.Float {
+	prec := x.Prec()
+	m := new(big.Float).SetPrec(prec)
+	k := x.MantExp(m)
+	const roots = 8
+	for i := 0; i < roots; i++ {
+		m.Sqrt(m)
+	}
+	result := bigAtanhLog(m)
+	result.SetMantExp(result, roots)
+	if k != 0 {
+		ln2 := bigAtanhLog(new(big.Float).SetPrec(prec).SetInt64(2))
+		result.Add(result, ln2.Mul(ln2, new(big.Float).SetPrec(prec).SetInt64(int64(k))))
+	}
+	return result
+}
+
+// bigAtanhLog sums ln(m) = 2 * (z + z^3/3 + z^5/5 + ...) with z = (m - 1) / (m + 1)
+func bigAtanhLog(m *big.Float) *big.Float {
+	prec := m.Prec()
+	one := new(big.Float).SetPrec(prec).SetInt64(1)
+	z := new(big.Float).SetPrec(prec).Sub(m, one)
+	z.Quo(z, new(big.Float).SetPrec(prec).Add(m, one))
+	z2 := new(big.Float).SetPrec(prec).Mul(z, z)
+
+	sum := new(big.Float).SetPrec(prec).Set(z)
+	power := new(big.Float).SetPrec(prec).Set(z)
+	term := new(big.Float).SetPrec(prec)
+	for i := int64(3); ; i += 2 {
+		power.Mul(power, z2)
+		term.Quo(power, new(big.Float).SetPrec(prec).SetInt64(i))
+		if term.Sign() == 0 || term.MantExp(nil)-sum.MantExp(nil) < -int(prec) {
+			break
+		}
+		sum.Add(sum, term)
+	}
+	return sum.SetMantExp(sum, 1)
+}
+
+/*
+bigExp is e^x at the precision of x. x = q * ln(2) + r with |r| <= ln(2) / 2, e^r is summed as a Taylor
+series after dividing r by 2^8 and squared back up, multiplying by 2^q is exact
+*/
+func bigExp(x *big.Float) *big.Float {
+	prec := x.Prec()
+	ln2 := bigAtanhLog(new(big.Float).SetPrec(prec).SetInt64(2))
+	q, _ := new(big.Float).SetPrec(prec).Quo(x, ln2).Float64()
+	quotient := math.Round(q)
+	r := new(big.Float).SetPrec(prec).Mul(ln2, new(big.Float).SetPrec(prec).SetFloat64(quotient))
+	r.Sub(x, r)
+	const squarings = 8
+	r.SetMantExp(r, -squarings)
+
+	sum := new(big.Float).SetPrec(prec).SetInt64(1)
+	term := new(big.Float).SetPrec(prec).SetInt64(1)
+	for i := int64(1); ; i++ {
+		term.Mul(term, r)
+		term.Quo(term, new(big.Float).SetPrec(prec).SetInt64(i))
+		if term.Sign() == 0 || term.MantExp(nil) < -int(prec) {
+			break
+		}
+		sum.Add(sum, term)
+	}
+	for i := 0; i < squarings; i++ {
+		sum.Mul(sum, sum)
+	}
+	return sum.SetMantExp(sum, int(quotient))
+}
+
+// log10Abs is log10 of |n| for a non zero finite value, good for estimates and safe for huge values
+func (n Numeric) log10Abs() float64 {
+	digits := new(big.Int).Abs(n.coef).Text(10)
+	lead := digits[:min(len(digits), 17)]
+	f, _ := strconv.ParseFloat(lead, 64)
+	return math.Log10(f) + float64(len(digits)-len(lead)) - float64(n.scale)
+}
+
+func init() {
+	const (
+		numeric = types.NUMERICOID
+		int8    = types.INT8OID
+	)
+
+	unary := func(fn func(Numeric) (Numeric, error)) func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		return func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+			result, err := fn(fcinfo.Args[0].(Numeric))
+			if err != nil {
+				return nil, err
+			}
+			return result, nil
+		}
+	}
+	//rounded rounds to a number of digits after the point given as second argument, 0 without one
+	rounded := func(mode RoundingMode) func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		return func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+			scale := int64(0)
+			if len(fcinfo.Args) > 1 {
+				scale = min(max(fcinfo.Args[1].(int64), NUMERIC_MIN_SCALE), NUMERIC_MAX_SCALE)
+			}
+			return fcinfo.Args[0].(Numeric).Round(int32(scale), mode), nil
+		}
+	}
+
+	addFunction("abs", []types.Oid{numeric}, numeric, unary(func(n Numeric) (Numeric, error) {
+		return n.Abs(), nil
+	}))
+	addFunction("round", []types.Oid{numeric}, numeric, rounded(ROUND_HALF_UP))
+	addFunction("round", []types.Oid{numeric, int8}, numeric, rounded(ROUND_HALF_UP))
+	addFunction("trunc", []types.Oid{numeric}, numeric, rounded(ROUND_DOWN))
+	addFunction("trunc", []types.Oid{numeric, int8}, numeric, rounded(ROUND_DOWN))
+	ceil := unary(func(n Numeric) (Numeric, error) {
+		return n.Round(0, ROUND_CEILING), nil
+	})
+	addFunction("ceil", []types.Oid{numeric}, numeric, ceil)
+	addFunction("ceiling", []types.Oid{numeric}, numeric, ceil)
+	addFunction("floor", []types.Oid{numeric}, numeric, unary(func(n Numeric) (Numeric, error) {
+		return n.Round(0, ROUND_FLOOR), nil
+	}))
+	addFunction("sqrt", []types.Oid{numeric}, numeric, unary(Numeric.Sqrt))
+
+	power := func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		result, err := fcinfo.Args[0].(Numeric).Power(fcinfo.Args[1].(Numeric))
+		if err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
+	addFunction("power", []types.Oid{numeric, numeric}, numeric, power)
+	addFunction("pow", []types.Oid{numeric, numeric}, numeric, power)
+	addFunction("mod", []types.Oid{numeric, numeric}, numeric, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		result, err := fcinfo.Args[0].(Numeric).Mod(fcinfo.Args[1].(Numeric))
+		if err != nil {
+			return nil, err
+		}
+		return result, nil
+	})
+}
@@ -0,0 +1,170 @@
+package adt
+
+import (
+	"math"
+
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+Operators between types the executor does not combine on its own (postgres pg_operator)
+
+The arithmetic of numbers, comparisons and || are built into the executor. Operators whose meaning
+depends on the types, like date + integer or timestamp - timestamp, are looked up here by name and operand
+types. The planner resolves an operator to its entry and records the oid in the OpExpr, the executor calls
+Fn with both operands (Left is nil for a prefix operator) and the settings of the session. All of them are strict
+*/
+
+type Operator struct {
+	Oid        types.Oid
+	Name       string
+	Left       types.Oid //InvalidOid for a prefix operator
+	Right      types.Oid
+	ResultType types.Oid
+	Fn         func(left types.Datum, right types.Datum, settings *Settings) (types.Datum, error)
+}
+
+// Oids of the builtin operators, they do not need to match postgres'
+const firstOperatorOid types.Oid = 20000
+
+var (
+	operators       = make(map[types.Oid]*Operator)
+	operatorsByName = make(map[string][]*Operator)
+)
+
+func addOperator(name string, left types.Oid, right types.Oid, resultType types.Oid, fn func(left types.Datum, right types.Datum) (types.Datum, error)) {
+	addStableOperator(name, left, right, resultType, func(l, r types.Datum, _ *Settings) (types.Datum, error) {
+		return fn(l, r)
+	})
+}
+
+// addStableOperator adds an operator whose result depends on the session's settings, like the time zone
+func addStableOperator(name string, left types.Oid, right types.Oid, resultType types.Oid, fn func(left types.Datum, right types.Datum, settings *Settings) (types.Datum, error)) {
+	op := &Operator{Oid: firstOperatorOid + types.Oid(len(operators)), Name: name, Left: left, Right: right, ResultType: resultType, Fn: fn}
+	operators[op.Oid] = op
+	operatorsByName[name] = append(operatorsByName[name], op)
+}
+
+// LookupOperator returns the operator with an oid, nil if there is none
+func LookupOperator(oid types.Oid) *Operator {
+	return operators[oid]
+}
+
+// OperatorCandidates returns the operators named name, with their operand types, for the planner to choose from
+func OperatorCandidates(name string) []*Operator {
+	return operatorsByName[name]
+}
+
+func init() {
+	const (
+		date        = types.DATEOID
+		timeOfDay   = types.TIMEOID
+		timestamp   = types.TIMESTAMPOID
+		timestamptz = types.TIMESTAMPTZOID
+		interval    = types.INTERVALOID
+		int8        = types.INT8OID
+		float8      = types.FLOAT8OID
+	)
+
+	addOperator("+", date, int8, date, func(l, r types.Datum) (types.Datum, error) {
+		return dateAddDays(l.(Date), r.(int64))
+	})
+	addOperator("+", int8, date, date, func(l, r types.Datum) (types.Datum, error) {
+		return dateAddDays(r.(Date), l.(int64))
+	})
+	addOperator("-", date, int8, date, func(l, r types.Datum) (types.Datum, error) {
+		if r.(int64) == math.MinInt64 {
+			return nil, errDateOutOfRange
+		}
+		return dateAddDays(l.(Date), -r.(int64))
+	})
+	addOperator("-", date, date, int8, func(l, r types.Datum) (types.Datum, error) {
+		return dateMi(l.(Date), r.(Date))
+	})
+	addOperator("+", date, timeOfDay, timestamp, func(l, r types.Datum) (types.Datum, error) {
+		return datetimePl(l.(Date), r.(TimeOfDay))
+	})
+	addOperator("+", timeOfDay, date, timestamp, func(l, r types.Datum) (types.Datum, error) {
+		return datetimePl(r.(Date), l.(TimeOfDay))
+	})
+	addOperator("+", date, interval, timestamp, func(l, r types.Datum) (types.Datum, error) {
+		return timestampPlInterval(l.(Date).Timestamp(), r.(Interval))
+	})
+	addOperator("+", interval, date, timestamp, func(l, r types.Datum) (types.Datum, error) {
+		return timestampPlInterval(r.(Date).Timestamp(), l.(Interval))
+	})
+	addOperator("-", date, interval, timestamp, func(l, r types.Datum) (types.Datum, error) {
+		iv, err := intervalUm(r.(Interval))
+		if err != nil {
+			return nil, err
+		}
+		return timestampPlInterval(l.(Date).Timestamp(), iv)
+	})
+
+	addOperator("+", timestamp, interval, timestamp, func(l, r types.Datum) (types.Datum, error) {
+		return timestampPlInterval(l.(Timestamp), r.(Interval))
+	})
+	addOperator("+", interval, timestamp, timestamp, func(l, r types.Datum) (types.Datum, error) {
+		return timestampPlInterval(r.(Timestamp), l.(Interval))
+	})
+	addOperator("-", timestamp, interval, timestamp, func(l, r types.Datum) (types.Datum, error) {
+		iv, err := intervalUm(r.(Interval))
+		if err != nil {
+			return nil, err
+		}
+		return timestampPlInterval(l.(Timestamp), iv)
+	})
+	addOperator("-", timestamp, timestamp, interval, func(l, r types.Datum) (types.Datum, error) {
+		return timestampMi(int64(l.(Timestamp)), int64(r.(Timestamp)))
+	})
+
+	addStableOperator("+", timestamptz, interval, timestamptz, func(l, r types.Datum, settings *Settings) (types.Datum, error) {
+		return timestamptzPlInterval(l.(TimestampTz), r.(Interval), settings.TimeZone)
+	})
+	addStableOperator("+", interval, timestamptz, timestamptz, func(l, r types.Datum, settings *Settings) (types.Datum, error) {
+		return timestamptzPlInterval(r.(TimestampTz), l.(Interval), settings.TimeZone)
+	})
+	addStableOperator("-", timestamptz, interval, timestamptz, func(l, r types.Datum, settings *Settings) (types.Datum, error) {
+		iv, err := intervalUm(r.(Interval))
+		if err != nil {
+			return nil, err
+		}
+		return timestamptzPlInterval(l.(TimestampTz), iv, settings.TimeZone)
+	})
+	addOperator("-", timestamptz, timestamptz, interval, func(l, r types.Datum) (types.Datum, error) {
+		return timestampMi(int64(l.(TimestampTz)), int64(r.(TimestampTz)))
+	})
+
+	addOperator("+", timeOfDay, interval, timeOfDay, func(l, r types.Datum) (types.Datum, error) {
+		return timePlInterval(l.(TimeOfDay), r.(Interval)), nil
+	})
+	addOperator("+", interval, timeOfDay, timeOfDay, func(l, r types.Datum) (types.Datum, error) {
+		return timePlInterval(r.(TimeOfDay), l.(Interval)), nil
+	})
+	addOperator("-", timeOfDay, interval, timeOfDay, func(l, r types.Datum) (types.Datum, error) {
+		iv := r.(Interval)
+		return timePlInterval(l.(TimeOfDay), Interval{Time: -(iv.Time % USECS_PER_DAY)}), nil
+	})
+	addOperator("-", timeOfDay, timeOfDay, interval, func(l, r types.Datum) (types.Datum, error) {
+		return timeMi(l.(TimeOfDay), r.(TimeOfDay)), nil
+	})
+
+	addOperator("+", interval, interval, interval, func(l, r types.Datum) (types.Datum, error) {
+		return intervalPl(l.(Interval), r.(Interval))
+	})
+	addOperator("-", interval, interval, interval, func(l, r types.Datum) (types.Datum, error) {
+		return intervalMi(l.(Interval), r.(Interval))
+	})
+	addOperator("-", types.InvalidOid, interval, interval, func(_, r types.Datum) (types.Datum, error) {
+		return intervalUm(r.(Interval))
+	})
+	addOperator("*", interval, float8, interval, func(l, r types.Datum) (types.Datum, error) {
+		return intervalMul(l.(Interval), r.(float64))
+	})
+	addOperator("*", float8, interval, interval, func(l, r types.Datum) (types.Datum, error) {
+		return intervalMul(r.(Interval), l.(float64))
+	})
+	addOperator("/", interval, float8, interval, func(l, r types.Datum) (types.Datum, error) {
+		return intervalDiv(l.(Interval), r.(float64))
+	})
+}
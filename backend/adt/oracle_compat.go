@@ -0,0 +1,105 @@
+package adt
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+String functions that came from Oracle (postgres utils/adt/oracle_compat.c): case conversion,
+trimming and padding. Like the rest they work on characters, not bytes
+*/
+
+// initcap upper cases the first letter of each word and lower cases the rest, words are runs of letters and digits
+func initcap(str string) string {
+	var sb strings.Builder
+	inWord := false
+	for _, c := range str {
+		if inWord {
+			sb.WriteRune(unicode.ToLower(c))
+		} else {
+			sb.WriteRune(unicode.ToUpper(c))
+		}
+		inWord = unicode.IsLetter(c) || unicode.IsDigit(c)
+	}
+	return sb.String()
+}
+
+// Longest result lpad and rpad build, postgres' 1GB limit on a value in characters of at most 4 bytes
+const maxStringLength = (1<<30 - 1) / 4
+
+/*
+pad makes str exactly length characters long, by adding copies of fill on the left (or right)
+or by cutting it off at the end. Without fill characters a short string stays as it is
+*/
+func pad(str string, length int64, fill string, left bool) (types.Datum, error) {
+	chars := []rune(str)
+	length = max(length, 0)
+	if int64(len(chars)) >= length {
+		return string(chars[:length]), nil
+	}
+	if fill == "" {
+		return str, nil
+	}
+	if length > maxStringLength {
+		return nil, fmt.Errorf("requested length too large")
+	}
+	fillChars := []rune(fill)
+	padding := make([]rune, length-int64(len(chars)))
+	for i := range padding {
+		padding[i] = fillChars[i%len(fillChars)]
+	}
+	if left {
+		return string(padding) + str, nil
+	}
+	return str + string(padding), nil
+}
+
+func init() {
+	const (
+		text = types.TEXTOID
+		int8 = types.INT8OID
+	)
+
+	addFunction("lower", []types.Oid{text}, text, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		return strings.ToLower(fcinfo.Args[0].(string)), nil
+	})
+	addFunction("upper", []types.Oid{text}, text, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		return strings.ToUpper(fcinfo.Args[0].(string)), nil
+	})
+	addFunction("initcap", []types.Oid{text}, text, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		return initcap(fcinfo.Args[0].(string)), nil
+	})
+
+	//The trim functions take the characters to remove as a set, spaces without one
+	trims := map[string]func(string, string) string{
+		"btrim": strings.Trim,
+		"ltrim": strings.TrimLeft,
+		"rtrim": strings.TrimRight,
+	}
+	for _, name := range []string{"btrim", "ltrim", "rtrim"} {
+		trim := trims[name]
+		addFunction(name, []types.Oid{text}, text, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+			return trim(fcinfo.Args[0].(string), " "), nil
+		})
+		addFunction(name, []types.Oid{text, text}, text, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+			return trim(fcinfo.Args[0].(string), fcinfo.Args[1].(string)), nil
+		})
+	}
+
+	addFunction("lpad", []types.Oid{text, int8}, text, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		return pad(fcinfo.Args[0].(string), fcinfo.Args[1].(int64), " ", true)
+	})
+	addFunction("lpad", []types.Oid{text, int8, text}, text, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		return pad(fcinfo.Args[0].(string), fcinfo.Args[1].(int64), fcinfo.Args[2].(string), true)
+	})
+	addFunction("rpad", []types.Oid{text, int8}, text, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		return pad(fcinfo.Args[0].(string), fcinfo.Args[1].(int64), " ", false)
+	})
+	addFunction("rpad", []types.Oid{text, int8, text}, text, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		return pad(fcinfo.Args[0].(string), fcinfo.Args[1].(int64), fcinfo.Args[2].(string), false)
+	})
+}
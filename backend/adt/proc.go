@@ -0,0 +1,403 @@
+package adt
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+Builtin functions (postgres pg_proc and the fmgr call convention)
+
+A function is known by its name and argument types, one name can have several entries (date_trunc of a
+timestamp and of an interval). The planner picks the entry that fits the arguments and records its oid in
+a FuncExpr, the executor calls Fn with the argument values.
+Functions are strict unless the entry says otherwise: called with a NULL argument they return NULL
+without being run. A variadic function takes any number of values of its last argument type, as
+json_build_object(VARIADIC "any"), Fn sees them as separate arguments.
+A set returning function (unnest) gives any number of rows, its Fn returns them as a SetResult
+*/
+
+type FunctionCallInfo struct {
+	Args          []types.Datum
+	StmtStartTime time.Time //When the statement started, what now() returns for all of its rows
+	Settings      *Settings //Of the session running the statement
+}
+
+type Function struct {
+	Oid        types.Oid
+	Name       string
+	ArgTypes   []types.Oid
+	ResultType types.Oid
+	Strict     bool
+	Variadic   bool //The last argument type repeats, any number of times from one on
+	Retset     bool //Returns a set of values, one row each
+	Mutable    bool //The result depends on more than the arguments (the clock, a random number), not allowed in an index
+	Fn         func(fcinfo *FunctionCallInfo) (types.Datum, error)
+}
+
+// Oids of the builtin functions, they do not need to match postgres'
+const firstFunctionOid types.Oid = 10000
+
+var (
+	functions       = make(map[types.Oid]*Function)
+	functionsByName = make(map[string][]*Function)
+)
+
+func addFunction(name string, argTypes []types.Oid, resultType types.Oid, fn func(fcinfo *FunctionCallInfo) (types.Datum, error)) *Function {
+	f := &Function{Oid: firstFunctionOid + types.Oid(len(functions)), Name: name, ArgTypes: argTypes, ResultType: resultType, Strict: true, Fn: fn}
+	functions[f.Oid] = f
+	functionsByName[name] = append(functionsByName[name], f)
+	return f
+}
+
+// setVariadic makes the last argument type of a function repeat
+func (f *Function) setVariadic() *Function {
+	f.Variadic = true
+	return f
+}
+
+// setRetset makes a function set returning
+func (f *Function) setRetset() *Function {
+	f.Retset = true
+	return f
+}
+
+// setMutable marks a function whose result is not determined by its arguments (not IMMUTABLE in postgres)
+func (f *Function) setMutable() *Function {
+	f.Mutable = true
+	return f
+}
+
+// AllFunctions returns the builtin functions in oid order, the rows of pg_proc
+func AllFunctions() []*Function {
+	procs := make([]*Function, 0, len(functions))
+	for oid := firstFunctionOid; oid < firstFunctionOid+types.Oid(len(functions)); oid++ {
+		procs = append(procs, functions[oid])
+	}
+	return procs
+}
+
+// SetResult is what a set returning function returns, the value of each row it gives
+type SetResult []types.Datum
+
+// LookupFunction returns the function with an oid, nil if there is none
+func LookupFunction(oid types.Oid) *Function {
+	return functions[oid]
+}
+
+// FunctionCandidates returns the functions named name, for the planner to choose from by argument types
+func FunctionCandidates(name string) []*Function {
+	return functionsByName[name]
+}
+
+func init() {
+	const (
+		date        = types.DATEOID
+		timeOfDay   = types.TIMEOID
+		timestamp   = types.TIMESTAMPOID
+		timestamptz = types.TIMESTAMPTZOID
+		interval    = types.INTERVALOID
+		text        = types.TEXTOID
+		int8        = types.INT8OID
+		float8      = types.FLOAT8OID
+		numeric     = types.NUMERICOID
+		boolean     = types.BOOLOID
+	)
+
+	//The current time is the time the statement started, the same for every row. Only clock_timestamp moves
+	statementTime := func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		return TimestampTzFromTime(fcinfo.StmtStartTime), nil
+	}
+	addFunction("now", nil, timestamptz, statementTime).setMutable()
+	addFunction("transaction_timestamp", nil, timestamptz, statementTime).setMutable()
+	addFunction("statement_timestamp", nil, timestamptz, statementTime).setMutable()
+	addFunction("current_timestamp", nil, timestamptz, statementTime).setMutable()
+	addFunction("clock_timestamp", nil, timestamptz, func(*FunctionCallInfo) (types.Datum, error) {
+		return TimestampTzFromTime(time.Now()), nil
+	}).setMutable()
+	addFunction("current_date", nil, date, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		return currentDate(fcinfo.StmtStartTime, fcinfo.Settings), nil
+	}).setMutable()
+	addFunction("localtimestamp", nil, timestamp, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		return localTimestamp(fcinfo.StmtStartTime, fcinfo.Settings), nil
+	}).setMutable()
+	addFunction("localtime", nil, timeOfDay, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		return timestampTime(localTimestamp(fcinfo.StmtStartTime, fcinfo.Settings)), nil
+	}).setMutable()
+
+	//EXTRACT(field FROM source) is extract('field', source), a numeric. date_part is the older double precision form
+	for _, source := range []types.Oid{date, timeOfDay, timestamp, timestamptz, interval} {
+		addFunction("extract", []types.Oid{text, source}, numeric, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+			return extractDatum(fcinfo.Args[0].(string), fcinfo.Args[1], source, fcinfo.Settings)
+		})
+		addFunction("date_part", []types.Oid{text, source}, float8, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+			result, err := extractDatum(fcinfo.Args[0].(string), fcinfo.Args[1], source, fcinfo.Settings)
+			if result == nil || err != nil {
+				return nil, err
+			}
+			return result.(Numeric).Float64(), nil
+		})
+	}
+	for _, source := range []types.Oid{date, timestamp, timestamptz, interval} {
+		addFunction("isfinite", []types.Oid{source}, boolean, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+			switch v := fcinfo.Args[0].(type) {
+			case Date:
+				return v.IsFinite(), nil
+			case Timestamp:
+				return v.IsFinite(), nil
+			case TimestampTz:
+				return v.IsFinite(), nil
+			}
+			return true, nil
+		})
+	}
+
+	addFunction("date_trunc", []types.Oid{text, timestamp}, timestamp, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		unit, ok := decodeUnit(fcinfo.Args[0].(string))
+		if !ok {
+			return nil, unitNotRecognized(fcinfo.Args[0].(string), timestamp)
+		}
+		ts := fcinfo.Args[1].(Timestamp)
+		if !ts.IsFinite() {
+			return ts, nil
+		}
+		t, err := truncFields(unit, ts.Time(), timestamp)
+		if err != nil {
+			return nil, err
+		}
+		return checkTimestamp(int64(TimestampFromTime(t)))
+	})
+	addFunction("date_trunc", []types.Oid{text, timestamptz}, timestamptz, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		return truncTimestampTz(fcinfo.Args[0].(string), fcinfo.Args[1].(TimestampTz), fcinfo.Settings.TimeZone)
+	})
+	addFunction("date_trunc", []types.Oid{text, timestamptz, text}, timestamptz, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		loc, err := LoadTimeZone(fcinfo.Args[2].(string))
+		if err != nil {
+			return nil, err
+		}
+		return truncTimestampTz(fcinfo.Args[0].(string), fcinfo.Args[1].(TimestampTz), loc)
+	})
+	addFunction("date_trunc", []types.Oid{text, interval}, interval, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		unit, ok := decodeUnit(fcinfo.Args[0].(string))
+		if !ok {
+			return nil, unitNotRecognized(fcinfo.Args[0].(string), interval)
+		}
+		return truncInterval(unit, fcinfo.Args[1].(Interval))
+	})
+
+	//age of one timestamp is the age at midnight today
+	addFunction("age", []types.Oid{timestamp, timestamp}, interval, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		return ageOfTimestamps(fcinfo.Args[0].(Timestamp), fcinfo.Args[1].(Timestamp))
+	})
+	addFunction("age", []types.Oid{timestamp}, interval, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		return ageOfTimestamps(currentDate(fcinfo.StmtStartTime, fcinfo.Settings).Timestamp(), fcinfo.Args[0].(Timestamp))
+	})
+	addFunction("age", []types.Oid{timestamptz, timestamptz}, interval, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		return ageOfTimestampTzs(fcinfo.Args[0].(TimestampTz), fcinfo.Args[1].(TimestampTz), fcinfo.Settings.TimeZone)
+	})
+	addFunction("age", []types.Oid{timestamptz}, interval, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		midnight, err := timestampToTimestampTzIn(currentDate(fcinfo.StmtStartTime, fcinfo.Settings).Timestamp(), fcinfo.Settings.TimeZone)
+		if err != nil {
+			return nil, err
+		}
+		return ageOfTimestampTzs(midnight, fcinfo.Args[0].(TimestampTz), fcinfo.Settings.TimeZone)
+	})
+
+	//timezone(zone, value) is value AT TIME ZONE zone: the wall clock of zone at a timestamptz, or the other way round
+	addFunction("timezone", []types.Oid{text, timestamptz}, timestamp, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		loc, err := LoadTimeZone(fcinfo.Args[0].(string))
+		if err != nil {
+			return nil, err
+		}
+		return timestampTzToTimestampIn(fcinfo.Args[1].(TimestampTz), loc)
+	})
+	addFunction("timezone", []types.Oid{text, timestamp}, timestamptz, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		loc, err := LoadTimeZone(fcinfo.Args[0].(string))
+		if err != nil {
+			return nil, err
+		}
+		return timestampToTimestampTzIn(fcinfo.Args[1].(Timestamp), loc)
+	})
+
+	addFunction("to_timestamp", []types.Oid{float8}, timestamptz, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		seconds := fcinfo.Args[0].(float64)
+		switch {
+		case math.IsNaN(seconds):
+			return nil, fmt.Errorf("timestamp cannot be NaN")
+		case math.IsInf(seconds, 1):
+			return TIMESTAMPTZ_NOEND, nil
+		case math.IsInf(seconds, -1):
+			return TIMESTAMPTZ_NOBEGIN, nil
+		}
+		usecs := math.Round((seconds - float64(POSTGRES_EPOCH)) * float64(USECS_PER_SEC))
+		if usecs < float64(minTimestamp) || usecs >= float64(endTimestamp) {
+			return nil, fmt.Errorf("timestamp out of range: \"%g\"", seconds)
+		}
+		return TimestampTz(usecs), nil
+	})
+	addFunction("make_date", []types.Oid{int8, int8, int8}, date, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		return makeDate(fcinfo.Args[0].(int64), fcinfo.Args[1].(int64), fcinfo.Args[2].(int64))
+	})
+	addFunction("make_time", []types.Oid{int8, int8, float8}, timeOfDay, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		return makeTime(fcinfo.Args[0].(int64), fcinfo.Args[1].(int64), fcinfo.Args[2].(float64))
+	})
+	addFunction("make_timestamp", []types.Oid{int8, int8, int8, int8, int8, float8}, timestamp, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		d, err := makeDate(fcinfo.Args[0].(int64), fcinfo.Args[1].(int64), fcinfo.Args[2].(int64))
+		if err != nil {
+			return nil, err
+		}
+		t, err := makeTime(fcinfo.Args[3].(int64), fcinfo.Args[4].(int64), fcinfo.Args[5].(float64))
+		if err != nil {
+			return nil, err
+		}
+		return datetimePl(d, t)
+	})
+
+	justify := map[string]func(Interval) (Interval, error){
+		"justify_days":     justifyDays,
+		"justify_hours":    justifyHours,
+		"justify_interval": justifyInterval,
+	}
+	for _, name := range []string{"justify_days", "justify_hours", "justify_interval"} {
+		fn := justify[name]
+		addFunction(name, []types.Oid{interval}, interval, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+			return fn(fcinfo.Args[0].(Interval))
+		})
+	}
+}
+
+// extractDatum is EXTRACT(unit FROM d) of a value of type typ, NULL for fields an infinite value does not have
+func extractDatum(unitName string, d types.Datum, typ types.Oid, settings *Settings) (types.Datum, error) {
+	unit, ok := decodeUnit(unitName)
+	if !ok {
+		return nil, unitNotRecognized(unitName, typ)
+	}
+	var result Numeric
+	var err error
+	switch v := d.(type) {
+	case Date:
+		if !v.IsFinite() {
+			return extractInfiniteDatum(unit, v == DATEVAL_NOBEGIN, typ)
+		}
+		result, err = extractFields(unit, v.Time(), (int64(v)*SECS_PER_DAY+POSTGRES_EPOCH)*USECS_PER_SEC, typ)
+	case Timestamp:
+		if !v.IsFinite() {
+			return extractInfiniteDatum(unit, v == TIMESTAMP_NOBEGIN, typ)
+		}
+		result, err = extractFields(unit, v.Time(), int64(v)+POSTGRES_EPOCH*USECS_PER_SEC, typ)
+	case TimestampTz:
+		if !v.IsFinite() {
+			return extractInfiniteDatum(unit, v == TIMESTAMPTZ_NOBEGIN, typ)
+		}
+		result, err = extractFields(unit, v.Time().In(settings.TimeZone), int64(v)+POSTGRES_EPOCH*USECS_PER_SEC, typ)
+	case TimeOfDay:
+		result, err = extractTime(unit, v)
+	case Interval:
+		result, err = extractInterval(unit, v)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func extractInfiniteDatum(unit string, negative bool, typ types.Oid) (types.Datum, error) {
+	if result, ok := extractInfinite(unit, negative); ok {
+		return result, nil
+	}
+	//Units that do not exist for the type are still an error
+	if _, err := extractFields(unit, time.Unix(0, 0).UTC(), 0, typ); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func extractTime(unit string, t TimeOfDay) (Numeric, error) {
+	usecs := int64(t)
+	secUsecs := usecs % USECS_PER_MINUTE
+	switch unit {
+	case "microseconds":
+		return NumericFromInt64(secUsecs), nil
+	case "milliseconds":
+		return numericScaled(secUsecs, 3), nil
+	case "second":
+		return numericScaled(secUsecs, 6), nil
+	case "minute":
+		return NumericFromInt64(usecs / USECS_PER_MINUTE % 60), nil
+	case "hour":
+		return NumericFromInt64(usecs / USECS_PER_HOUR), nil
+	case "epoch":
+		return numericScaled(usecs, 6), nil
+	}
+	return Numeric{}, unitNotSupported(unit, types.TIMEOID)
+}
+
+/*
+truncTimestampTz is date_trunc on a timestamptz in zone loc. Units of a day and more start at local
+midnight, smaller units keep the value's offset, so truncating to the hour never jumps across a
+daylight saving change
+*/
+func truncTimestampTz(unitName string, tz TimestampTz, loc *time.Location) (types.Datum, error) {
+	unit, ok := decodeUnit(unitName)
+	if !ok {
+		return nil, unitNotRecognized(unitName, types.TIMESTAMPTZOID)
+	}
+	if !tz.IsFinite() {
+		return tz, nil
+	}
+	t := tz.Time().In(loc)
+	switch unit {
+	case "hour", "minute", "second", "milliseconds", "microseconds":
+		_, offset := t.Zone()
+		t = t.In(time.FixedZone("", offset))
+	}
+	truncated, err := truncFields(unit, t, types.TIMESTAMPTZOID)
+	if err != nil {
+		return nil, err
+	}
+	return checkTimestampTz(int64(TimestampTzFromTime(truncated)))
+}
+
+func ageOfTimestamps(a Timestamp, b Timestamp) (types.Datum, error) {
+	if !a.IsFinite() || !b.IsFinite() {
+		return nil, fmt.Errorf("cannot subtract infinite timestamps")
+	}
+	return timestampAge(a.Time(), b.Time(), a < b), nil
+}
+
+// The age of timestamptz values is counted on the wall clock of the session's time zone
+func ageOfTimestampTzs(a TimestampTz, b TimestampTz, loc *time.Location) (types.Datum, error) {
+	if !a.IsFinite() || !b.IsFinite() {
+		return nil, fmt.Errorf("cannot subtract infinite timestamps")
+	}
+	return timestampAge(a.Time().In(loc), b.Time().In(loc), a < b), nil
+}
+
+// makeDate is make_date, a negative year is BC: -1 is 1 BC, the year 0 of package time
+func makeDate(year int64, month int64, day int64) (Date, error) {
+	y := year
+	if year < 0 {
+		y = year + 1
+	}
+	if year == 0 || y > maxDateYear || y < int64(minDateTime.Year()) || month < 1 || month > 12 || day < 1 ||
+		day > int64(daysInMonth(int(y), time.Month(month))) {
+		return 0, fmt.Errorf("date field value out of range: %d-%02d-%02d", year, month, day)
+	}
+	t := time.Date(int(y), time.Month(month), int(day), 0, 0, 0, 0, time.UTC)
+	if t.Before(minDateTime) {
+		return 0, fmt.Errorf("date out of range: %d-%02d-%02d", year, month, day)
+	}
+	return DateFromTime(t), nil
+}
+
+func makeTime(hour int64, minute int64, sec float64) (TimeOfDay, error) {
+	usecs := int64(math.Round(sec * float64(USECS_PER_SEC)))
+	if hour < 0 || hour > 24 || minute < 0 || minute > 59 || math.IsNaN(sec) || sec < 0 || sec > 60 ||
+		(hour == 24 && (minute > 0 || usecs > 0)) || usecs > 60*USECS_PER_SEC {
+		return 0, fmt.Errorf("time field value out of range: %d:%02d:%02g", hour, minute, sec)
+	}
+	return TimeOfDay(hour*USECS_PER_HOUR + minute*USECS_PER_MINUTE + usecs), nil
+}
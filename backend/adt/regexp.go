@@ -0,0 +1,350 @@
+package adt
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+	"sync"
+
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+Regular expressions (postgres utils/adt/regexp.c)
+Patterns are compiled by Go's regexp package, which reads the usual POSIX extended syntax postgres
+accepts, but not back references in the pattern. By default . and [^...] match a newline too,
+as in postgres. Compiled patterns are cached, a query usually uses the same one for every row
+*/
+
+// regexFlags are the options a flags argument gives, g only where the function has a use for it
+type regexFlags struct {
+	caseInsensitive bool
+	dotNewline      bool //. and [^...] match a newline
+	multiline       bool //^ and $ match at newlines
+	global          bool //Replace every match, not just the first one
+}
+
+var defaultRegexFlags = regexFlags{dotNewline: true}
+
+// parseRegexFlags reads the flags argument of function funcname, allowGlobal says whether g is one of its options
+func parseRegexFlags(flags string, funcname string, allowGlobal bool) (regexFlags, error) {
+	result := defaultRegexFlags
+	for _, c := range flags {
+		switch c {
+		case 'g':
+			if !allowGlobal {
+				return regexFlags{}, fmt.Errorf("%s() does not support the \"global\" option", funcname)
+			}
+			result.global = true
+		case 'i':
+			result.caseInsensitive = true
+		case 'c':
+			result.caseInsensitive = false
+		case 'n', 'm':
+			//Newline sensitive
+			result.dotNewline, result.multiline = false, true
+		case 'p':
+			result.dotNewline, result.multiline = false, false
+		case 'w':
+			result.dotNewline, result.multiline = true, true
+		case 's':
+			result.dotNewline, result.multiline = true, false
+		default:
+			return regexFlags{}, fmt.Errorf("invalid regular expression option: \"%c\"", c)
+		}
+	}
+	return result, nil
+}
+
+type regexCacheKey struct {
+	pattern string
+	flags   regexFlags
+}
+
+var regexCache sync.Map //regexCacheKey to *regexp.Regexp
+
+func compileRegex(pattern string, flags regexFlags) (*regexp.Regexp, error) {
+	flags.global = false
+	key := regexCacheKey{pattern: pattern, flags: flags}
+	if re, ok := regexCache.Load(key); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	var prefix string
+	if flags.caseInsensitive {
+		prefix += "i"
+	}
+	if flags.dotNewline {
+		prefix += "s"
+	}
+	if flags.multiline {
+		prefix += "m"
+	}
+	source := pattern
+	if prefix != "" {
+		source = "(?" + prefix + ")" + pattern
+	}
+	re, err := regexp.Compile(source)
+	if err != nil {
+		//The message without the expression, which has our flags in front
+		var syntaxErr *syntax.Error
+		if errors.As(err, &syntaxErr) {
+			return nil, fmt.Errorf("invalid regular expression: %s", syntaxErr.Code)
+		}
+		return nil, fmt.Errorf("invalid regular expression: %v", err)
+	}
+	regexCache.Store(key, re)
+	return re, nil
+}
+
+/*
+regexpReplace replaces the first match of re in src, or every one with the g flag. In the replacement
+\1 to \9 stand for what the parenthesized subexpressions matched, \& for the whole match and \\ for a backslash
+*/
+func regexpReplace(src string, re *regexp.Regexp, replacement string, global bool) string {
+	matches := re.FindAllStringSubmatchIndex(src, 1)
+	if global {
+		matches = re.FindAllStringSubmatchIndex(src, -1)
+	}
+	if len(matches) == 0 {
+		return src
+	}
+	var sb strings.Builder
+	last := 0
+	for _, match := range matches {
+		sb.WriteString(src[last:match[0]])
+		for i := 0; i < len(replacement); i++ {
+			c := replacement[i]
+			if c != '\\' || i+1 == len(replacement) {
+				sb.WriteByte(c)
+				continue
+			}
+			i++
+			switch next := replacement[i]; {
+			case next >= '1' && next <= '9':
+				if group := int(next - '0'); 2*group < len(match) && match[2*group] >= 0 {
+					sb.WriteString(src[match[2*group]:match[2*group+1]])
+				}
+			case next == '&':
+				sb.WriteString(src[match[0]:match[1]])
+			case next == '\\':
+				sb.WriteByte('\\')
+			default:
+				sb.WriteByte('\\')
+				sb.WriteByte(next)
+			}
+		}
+		last = match[1]
+	}
+	sb.WriteString(src[last:])
+	return sb.String()
+}
+
+// regexMatch tells if re matches somewhere in src, patterns are not anchored unless they say so
+func regexMatch(src string, pattern string, flags regexFlags) (bool, error) {
+	re, err := compileRegex(pattern, flags)
+	if err != nil {
+		return false, err
+	}
+	return re.MatchString(src), nil
+}
+
+/*
+similarToEscape translates a SIMILAR TO pattern to a regular expression matching the whole string
+(postgres similar_escape). % and _ become .* and ., the characters that are special in regular
+expressions but not in SQL ones are escaped. escape is the pattern's escape character, empty for none.
+The escape character followed by a double quote separates the part SUBSTRING(... SIMILAR ...) returns,
+it can appear twice
+*/
+func similarToEscape(pattern string, escape string) (string, error) {
+	escapeChars := []rune(escape)
+	if len(escapeChars) > 1 {
+		return "", fmt.Errorf("invalid escape string")
+	}
+	var sb strings.Builder
+	sb.WriteString("^(?:")
+	afterEscape, inCharClass := false, false
+	quotes := 0
+	for _, c := range pattern {
+		switch {
+		case afterEscape:
+			if c == '"' && !inCharClass {
+				switch quotes {
+				case 0:
+					sb.WriteString("){1,1}?(")
+				case 1:
+					sb.WriteString("){1,1}(?:")
+				default:
+					return "", fmt.Errorf("SQL regular expression may not contain more than two escape-double-quote separators")
+				}
+				quotes++
+			} else {
+				sb.WriteRune('\\')
+				sb.WriteRune(c)
+			}
+			afterEscape = false
+		case len(escapeChars) == 1 && c == escapeChars[0]:
+			afterEscape = true
+		case inCharClass:
+			if c == '\\' {
+				sb.WriteRune('\\')
+			}
+			sb.WriteRune(c)
+			inCharClass = c != ']'
+		case c == '[':
+			sb.WriteRune(c)
+			inCharClass = true
+		case c == '%':
+			sb.WriteString(".*")
+		case c == '_':
+			sb.WriteRune('.')
+		case c == '(':
+			sb.WriteString("(?:")
+		case c == '\\', c == '.', c == '^', c == '$':
+			sb.WriteRune('\\')
+			sb.WriteRune(c)
+		default:
+			sb.WriteRune(c)
+		}
+	}
+	sb.WriteString(")$")
+	return sb.String(), nil
+}
+
+/*
+regexSubstring is substring(src FROM pattern): the part of src the first parenthesized subexpression
+matched, or the whole match when there is none. NULL without a match
+*/
+func regexSubstring(src string, pattern string) (types.Datum, error) {
+	re, err := compileRegex(pattern, defaultRegexFlags)
+	if err != nil {
+		return nil, err
+	}
+	match := re.FindStringSubmatchIndex(src)
+	switch {
+	case match == nil:
+		return nil, nil
+	case len(match) > 2:
+		if match[2] < 0 {
+			return nil, nil
+		}
+		return src[match[2]:match[3]], nil
+	}
+	return src[match[0]:match[1]], nil
+}
+
+func init() {
+	const (
+		text      = types.TEXTOID
+		textArray = types.TEXTARRAYOID
+		boolean   = types.BOOLOID
+	)
+
+	//~ matches a regular expression, ~* ignoring case, the ! forms are their negations
+	regexOperator := func(caseInsensitive bool, negated bool) func(l, r types.Datum) (types.Datum, error) {
+		flags := defaultRegexFlags
+		flags.caseInsensitive = caseInsensitive
+		return func(l, r types.Datum) (types.Datum, error) {
+			matched, err := regexMatch(l.(string), r.(string), flags)
+			if err != nil {
+				return nil, err
+			}
+			return matched != negated, nil
+		}
+	}
+	addOperator("~", text, text, boolean, regexOperator(false, false))
+	addOperator("!~", text, text, boolean, regexOperator(false, true))
+	addOperator("~*", text, text, boolean, regexOperator(true, false))
+	addOperator("!~*", text, text, boolean, regexOperator(true, true))
+
+	//x SIMILAR TO p [ESCAPE e] is x ~ similar_to_escape(p [, e]), backslash is the escape by default
+	addFunction("similar_to_escape", []types.Oid{text}, text, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		pattern, err := similarToEscape(fcinfo.Args[0].(string), "\\")
+		if err != nil {
+			return nil, err
+		}
+		return pattern, nil
+	})
+	addFunction("similar_to_escape", []types.Oid{text, text}, text, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		pattern, err := similarToEscape(fcinfo.Args[0].(string), fcinfo.Args[1].(string))
+		if err != nil {
+			return nil, err
+		}
+		return pattern, nil
+	})
+
+	addFunction("substring", []types.Oid{text, text}, text, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		return regexSubstring(fcinfo.Args[0].(string), fcinfo.Args[1].(string))
+	})
+	like := func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		var flagsArg string
+		if len(fcinfo.Args) > 2 {
+			flagsArg = fcinfo.Args[2].(string)
+		}
+		flags, err := parseRegexFlags(flagsArg, "regexp_like", false)
+		if err != nil {
+			return nil, err
+		}
+		matched, err := regexMatch(fcinfo.Args[0].(string), fcinfo.Args[1].(string), flags)
+		if err != nil {
+			return nil, err
+		}
+		return matched, nil
+	}
+	addFunction("regexp_like", []types.Oid{text, text}, boolean, like)
+	addFunction("regexp_like", []types.Oid{text, text, text}, boolean, like)
+
+	//regexp_match is an array of what the parenthesized subexpressions of the first match matched, or of the whole match
+	match := func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		var flagsArg string
+		if len(fcinfo.Args) > 2 {
+			flagsArg = fcinfo.Args[2].(string)
+		}
+		flags, err := parseRegexFlags(flagsArg, "regexp_match", false)
+		if err != nil {
+			return nil, err
+		}
+		re, err := compileRegex(fcinfo.Args[1].(string), flags)
+		if err != nil {
+			return nil, err
+		}
+		src := fcinfo.Args[0].(string)
+		indexes := re.FindStringSubmatchIndex(src)
+		if indexes == nil {
+			return nil, nil
+		}
+		if len(indexes) == 2 {
+			return []types.Datum{src[indexes[0]:indexes[1]]}, nil
+		}
+		groups := make([]types.Datum, 0, len(indexes)/2-1)
+		for i := 2; i < len(indexes); i += 2 {
+			if indexes[i] < 0 {
+				groups = append(groups, nil)
+				continue
+			}
+			groups = append(groups, src[indexes[i]:indexes[i+1]])
+		}
+		return groups, nil
+	}
+	addFunction("regexp_match", []types.Oid{text, text}, textArray, match)
+	addFunction("regexp_match", []types.Oid{text, text, text}, textArray, match)
+
+	replace := func(src string, pattern string, replacement string, flagsArg string) (types.Datum, error) {
+		flags, err := parseRegexFlags(flagsArg, "regexp_replace", true)
+		if err != nil {
+			return nil, err
+		}
+		re, err := compileRegex(pattern, flags)
+		if err != nil {
+			return nil, err
+		}
+		return regexpReplace(src, re, replacement, flags.global), nil
+	}
+	addFunction("regexp_replace", []types.Oid{text, text, text}, text, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		return replace(fcinfo.Args[0].(string), fcinfo.Args[1].(string), fcinfo.Args[2].(string), "")
+	})
+	addFunction("regexp_replace", []types.Oid{text, text, text, text}, text, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		return replace(fcinfo.Args[0].(string), fcinfo.Args[1].(string), fcinfo.Args[2].(string), fcinfo.Args[3].(string))
+	})
+}
@@ -0,0 +1,157 @@
+package adt
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+regclass (postgres utils/adt/regproc.c), the oid of a relation that reads and writes as its name.
+'name'::regclass looks the name up on the search path, a number is taken as the oid itself.
+A relation that is gone shows its oid. Clients write attrelid = 'tab'::regclass, so it converts to
+and from bigint, the type of our oid columns, without a cast being written.
+
+The relations are in package catalog, which cannot be imported here, it sets RegclassLookup and
+RegclassName when it starts
+*/
+
+type Regclass types.Oid
+
+var (
+	//RegclassLookup finds the oid of a relation, schemaname is empty for an unqualified name
+	RegclassLookup func(schemaname string, relname string) (types.Oid, error)
+	//RegclassName is the name of a relation as regclass shows it, false if there is no such relation
+	RegclassName func(relid types.Oid) (string, bool)
+)
+
+func regclassIn(str string, _ *Settings) (types.Datum, error) {
+	str = strings.TrimSpace(str)
+	if oid, err := strconv.ParseUint(str, 10, 32); err == nil {
+		return Regclass(oid), nil
+	}
+	names, err := splitQualifiedName(str)
+	if err != nil {
+		return nil, err
+	}
+	var schemaname, relname string
+	switch len(names) {
+	case 1:
+		relname = names[0]
+	case 2:
+		schemaname, relname = names[0], names[1]
+	default:
+		return nil, fmt.Errorf("improper relation name (too many dotted names): %s", str)
+	}
+	relid, err := RegclassLookup(schemaname, relname)
+	if err != nil {
+		return nil, err
+	}
+	return Regclass(relid), nil
+}
+
+// splitQualifiedName splits a possibly schema qualified name at its dots, quoted parts keep their case
+func splitQualifiedName(str string) ([]string, error) {
+	invalid := fmt.Errorf("invalid name syntax")
+	var names []string
+	for {
+		var name string
+		if strings.HasPrefix(str, "\"") {
+			end := 1
+			for {
+				next := strings.IndexByte(str[end:], '"')
+				if next < 0 {
+					return nil, invalid
+				}
+				end += next + 1
+				if !strings.HasPrefix(str[end:], "\"") {
+					break
+				}
+				end++ //A doubled quote stands for one
+			}
+			name, str = strings.ReplaceAll(str[1:end-1], "\"\"", "\""), str[end:]
+		} else {
+			end := strings.IndexByte(str, '.')
+			if end < 0 {
+				end = len(str)
+			}
+			name, str = strings.ToLower(strings.TrimSpace(str[:end])), str[end:]
+		}
+		if name == "" {
+			return nil, invalid
+		}
+		names = append(names, name)
+		if str == "" {
+			return names, nil
+		}
+		if str[0] != '.' {
+			return nil, invalid
+		}
+		str = str[1:]
+	}
+}
+
+func regclassOut(d types.Datum, _ *Settings) string {
+	relid := types.Oid(d.(Regclass))
+	if name, ok := RegclassName(relid); ok {
+		return name
+	}
+	return strconv.FormatUint(uint64(relid), 10)
+}
+
+func regclassRecv(buf []byte) (types.Datum, error) {
+	if len(buf) != 4 {
+		return nil, fmt.Errorf("invalid binary data for type regclass")
+	}
+	return Regclass(binary.BigEndian.Uint32(buf)), nil
+}
+
+func regclassSend(d types.Datum) []byte {
+	return binary.BigEndian.AppendUint32(nil, uint32(d.(Regclass)))
+}
+
+func regclassCmp(a types.Datum, b types.Datum) int {
+	return compareOrdered(int64(a.(Regclass)), int64(b.(Regclass)))
+}
+
+func hashRegclass(buf []byte, d types.Datum) []byte {
+	return binary.BigEndian.AppendUint64(buf, uint64(d.(Regclass)))
+}
+
+func init() {
+	registerType(&TypeEntry{
+		Oid:      types.REGCLASSOID,
+		Name:     "regclass",
+		Len:      4,
+		Category: TYPCATEGORY_NUMERIC,
+		Input:    regclassIn,
+		Output:   regclassOut,
+		Receive:  regclassRecv,
+		Send:     regclassSend,
+		Compare:  regclassCmp,
+		Hash:     hashRegclass,
+
+		//The name depends on the catalogs, not on the value alone
+		StableInput:  true,
+		StableOutput: true,
+	})
+
+	addCast(types.INT8OID, types.REGCLASSOID, COERCION_IMPLICIT, func(d types.Datum) (types.Datum, error) {
+		return Regclass(d.(int64)), nil
+	})
+	addCast(types.REGCLASSOID, types.INT8OID, COERCION_IMPLICIT, func(d types.Datum) (types.Datum, error) {
+		return int64(d.(Regclass)), nil
+	})
+
+	//to_regclass is NULL instead of an error when there is no such relation
+	addFunction("to_regclass", []types.Oid{types.TEXTOID}, types.REGCLASSOID, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		result, err := regclassIn(fcinfo.Args[0].(string), fcinfo.Settings)
+		if err != nil {
+			return nil, nil
+		}
+		return result, nil
+	}).setMutable()
+}
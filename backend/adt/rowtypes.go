@@ -0,0 +1,44 @@
+package adt
+
+import (
+	"strings"
+
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+Rows as text (postgres utils/adt/rowtypes.c record_out)
+
+A row is written (v1,v2,...), a NULL column as nothing. A value is double quoted when it is empty or has a
+double quote, backslash, parenthesis, comma or white space in it, and inside the quotes double quotes and
+backslashes are doubled
+*/
+
+// RecordOut writes the values of a row the way record_out does
+func RecordOut(values []types.Datum, settings *Settings) string {
+	var sb strings.Builder
+	sb.WriteByte('(')
+	for i, value := range values {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		if value == nil {
+			continue
+		}
+		str := OutputDatum(value, settings)
+		if str != "" && !strings.ContainsAny(str, "\"\\(), \t\n\r\v\f") {
+			sb.WriteString(str)
+			continue
+		}
+		sb.WriteByte('"')
+		for _, c := range str {
+			if c == '"' || c == '\\' {
+				sb.WriteRune(c)
+			}
+			sb.WriteRune(c)
+		}
+		sb.WriteByte('"')
+	}
+	sb.WriteByte(')')
+	return sb.String()
+}
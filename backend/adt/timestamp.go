@@ -0,0 +1,531 @@
+package adt
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+timestamp and timestamptz (postgres utils/adt/timestamp.c)
+
+Both are microseconds since 2000-01-01 00:00. For a Timestamp that is a wall clock reading, for a
+TimestampTz the point in time 2000-01-01 00:00 UTC. A timestamptz is read in the zone the input names,
+else in the session's TimeZone, and always printed in the session's TimeZone with its offset.
+Adding months or days to a timestamptz counts them in the session's TimeZone, so a day across a daylight
+saving change is 23 or 25 hours long
+*/
+
+type Timestamp int64
+type TimestampTz int64
+
+var (
+	minTimestamp = TimestampFromTime(minDateTime)
+	endTimestamp = TimestampFromTime(time.Date(maxDateYear+1, 1, 1, 0, 0, 0, 0, time.UTC)) //First value out of range
+)
+
+func TimestampFromTime(t time.Time) Timestamp {
+	return Timestamp((t.Unix()-POSTGRES_EPOCH)*USECS_PER_SEC + int64(t.Nanosecond()/1000))
+}
+
+func (ts Timestamp) Time() time.Time {
+	seconds := floorDiv(int64(ts), USECS_PER_SEC)
+	micros := int64(ts) - seconds*USECS_PER_SEC
+	return time.Unix(POSTGRES_EPOCH+seconds, micros*1000).UTC()
+}
+
+// Date of a timestamp, the time of day is dropped
+func (ts Timestamp) Date() Date {
+	switch ts {
+	case TIMESTAMP_NOBEGIN:
+		return DATEVAL_NOBEGIN
+	case TIMESTAMP_NOEND:
+		return DATEVAL_NOEND
+	}
+	return Date(floorDiv(int64(ts), USECS_PER_DAY))
+}
+
+func (ts Timestamp) IsFinite() bool {
+	return ts != TIMESTAMP_NOBEGIN && ts != TIMESTAMP_NOEND
+}
+
+func TimestampTzFromTime(t time.Time) TimestampTz {
+	return TimestampTz(TimestampFromTime(t))
+}
+
+// Time is the point in time in UTC, In(loc) gives the wall clock of a zone
+func (tz TimestampTz) Time() time.Time {
+	return Timestamp(tz).Time()
+}
+
+func (tz TimestampTz) IsFinite() bool {
+	return tz != TIMESTAMPTZ_NOBEGIN && tz != TIMESTAMPTZ_NOEND
+}
+
+// wallTimestamp is what the wall clock of t's zone reads at t
+func wallTimestamp(t time.Time) Timestamp {
+	y, m, d := t.Date()
+	h, mi, s := t.Clock()
+	return TimestampFromTime(time.Date(y, m, d, h, mi, s, t.Nanosecond(), time.UTC))
+}
+
+// localTimestamp is the wall clock of the session's time zone at t
+func localTimestamp(t time.Time, settings *Settings) Timestamp {
+	return wallTimestamp(t.In(settings.TimeZone))
+}
+
+// inZone is the time the wall clock reading ts names in zone loc
+func inZone(ts Timestamp, loc *time.Location) time.Time {
+	t := ts.Time()
+	y, m, d := t.Date()
+	h, mi, s := t.Clock()
+	return zoneTime(y, m, d, h, mi, s, t.Nanosecond(), loc)
+}
+
+/*
+zoneTime is time.Date with postgres' choice of offset (DetermineTimeZoneOffset) where the wall clock of loc
+jumps. A reading skipped when the clocks go forward is taken with the offset before the jump, 02:30 in New
+York on 2024-03-10 is 07:30 UTC, and a reading that happens twice when they go back is the later one.
+time.Date does not say which it picks, it takes the offset after a jump forward
+*/
+func zoneTime(y int, m time.Month, d int, h int, mi int, s int, ns int, loc *time.Location) time.Time {
+	t := time.Date(y, m, d, h, mi, s, ns, loc)
+	wall := time.Date(y, m, d, h, mi, s, ns, time.UTC).Unix()
+	_, offset := t.Zone()
+	if t.Unix()+int64(offset) < wall {
+		//Skipped: t is before the jump, its offset is the one wanted
+		return time.Unix(wall-int64(offset), int64(t.Nanosecond())).In(loc)
+	}
+	if _, end := t.ZoneBounds(); !end.IsZero() {
+		_, next := end.Zone()
+		if later := wall - int64(next); later >= end.Unix() {
+			return time.Unix(later, int64(t.Nanosecond())).In(loc)
+		}
+	}
+	return t
+}
+
+// inTimestampRange tells if t is in the range of timestamps
+func inTimestampRange(t time.Time) bool {
+	return !t.Before(minDateTime) && t.Year() <= maxDateYear
+}
+
+// checkTimestamp makes sure a computed value is in the range of timestamps
+func checkTimestamp(usecs int64) (Timestamp, error) {
+	if usecs < int64(minTimestamp) || usecs >= int64(endTimestamp) {
+		return 0, fmt.Errorf("timestamp out of range")
+	}
+	return Timestamp(usecs), nil
+}
+
+func checkTimestampTz(usecs int64) (TimestampTz, error) {
+	if usecs < int64(minTimestamp) || usecs >= int64(endTimestamp) {
+		return 0, fmt.Errorf("timestamp out of range")
+	}
+	return TimestampTz(usecs), nil
+}
+
+// addUsecs adds b to a, false if the sum does not fit
+func addUsecs(a int64, b int64) (int64, bool) {
+	sum := a + b
+	if (b > 0 && sum < a) || (b < 0 && sum > a) {
+		return 0, false
+	}
+	return sum, true
+}
+
+func timestampIn(str string, settings *Settings) (types.Datum, error) {
+	fields, err := decodeDateTime(str, "timestamp")
+	if err != nil {
+		return nil, err
+	}
+	switch fields.special {
+	case dtEpoch:
+		return TimestampFromTime(time.Unix(0, 0)), nil
+	case dtLate:
+		return TIMESTAMP_NOEND, nil
+	case dtEarly:
+		return TIMESTAMP_NOBEGIN, nil
+	case dtNow:
+		return localTimestamp(time.Now(), settings), nil
+	case dtToday, dtTomorrow, dtYesterday:
+		return (currentDate(time.Now(), settings) + [...]Date{0, 1, -1}[fields.special-dtToday]).Timestamp(), nil
+	}
+	//A zone in the input is ignored, as in postgres
+	if !fields.hasDate {
+		return nil, fmt.Errorf("invalid input syntax for type timestamp: \"%s\"", str)
+	}
+	t := time.Date(fields.year, time.Month(fields.month), fields.day, 0, 0, 0, 0, time.UTC)
+	return checkTimestamp(int64(TimestampFromTime(t)) + fields.usecs)
+}
+
+func timestampOut(d types.Datum, _ *Settings) string {
+	switch ts := d.(Timestamp); ts {
+	case TIMESTAMP_NOBEGIN:
+		return "-infinity"
+	case TIMESTAMP_NOEND:
+		return "infinity"
+	default:
+		t := ts.Time()
+		return string(appendEra(appendDateTime(nil, t), t))
+	}
+}
+
+// appendDateTime prints the wall clock of t as YYYY-MM-DD HH:MM:SS[.ffffff], the era is left to appendEra
+func appendDateTime(buf []byte, t time.Time) []byte {
+	buf = appendDate(buf, t)
+	buf = t.AppendFormat(buf, " 15:04:")
+	return appendSeconds(buf, int64(t.Second()), int64(t.Nanosecond()/1000))
+}
+
+// appendDate prints the date of t as YYYY-MM-DD, a year BC is counted back from 1 BC
+func appendDate(buf []byte, t time.Time) []byte {
+	y, m, d := t.Date()
+	if y <= 0 {
+		y = 1 - y
+	}
+	return fmt.Appendf(buf, "%04d-%02d-%02d", y, m, d)
+}
+
+// appendEra adds " BC" after a value of a year before 1, postgres prints it at the very end
+func appendEra(buf []byte, t time.Time) []byte {
+	if t.Year() <= 0 {
+		buf = append(buf, " BC"...)
+	}
+	return buf
+}
+
+func timestampRecv(buf []byte) (types.Datum, error) {
+	if len(buf) != 8 {
+		return nil, fmt.Errorf("invalid binary data for type timestamp")
+	}
+	return Timestamp(int64(binary.BigEndian.Uint64(buf))), nil
+}
+
+func timestampSend(d types.Datum) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(d.(Timestamp)))
+}
+
+func timestampCmp(a types.Datum, b types.Datum) int {
+	return compareOrdered(int64(a.(Timestamp)), int64(b.(Timestamp)))
+}
+
+func hashTimestamp(buf []byte, d types.Datum) []byte {
+	return binary.BigEndian.AppendUint64(buf, uint64(d.(Timestamp)))
+}
+
+func timestamptzIn(str string, settings *Settings) (types.Datum, error) {
+	fields, err := decodeDateTime(str, "timestamp with time zone")
+	if err != nil {
+		return nil, err
+	}
+	switch fields.special {
+	case dtEpoch:
+		return TimestampTzFromTime(time.Unix(0, 0)), nil
+	case dtLate:
+		return TIMESTAMPTZ_NOEND, nil
+	case dtEarly:
+		return TIMESTAMPTZ_NOBEGIN, nil
+	case dtNow:
+		return TimestampTzFromTime(time.Now()), nil
+	case dtToday, dtTomorrow, dtYesterday:
+		today := currentDate(time.Now(), settings) + [...]Date{0, 1, -1}[fields.special-dtToday]
+		return timestampToTimestampTzIn(today.Timestamp(), settings.TimeZone)
+	}
+	if !fields.hasDate {
+		return nil, fmt.Errorf("invalid input syntax for type timestamp with time zone: \"%s\"", str)
+	}
+	loc := fields.zone
+	if loc == nil {
+		loc = settings.TimeZone
+	}
+	//The time of day is on the zone's wall clock, not a duration since midnight
+	usecs := fields.usecs
+	t := zoneTime(fields.year, time.Month(fields.month), fields.day, int(usecs/USECS_PER_HOUR), int(usecs/USECS_PER_MINUTE%60),
+		int(usecs/USECS_PER_SEC%60), int(usecs%USECS_PER_SEC)*1000, loc)
+	return checkTimestampTz(int64(TimestampTzFromTime(t)))
+}
+
+func timestamptzOut(d types.Datum, settings *Settings) string {
+	switch tz := d.(TimestampTz); tz {
+	case TIMESTAMPTZ_NOBEGIN:
+		return "-infinity"
+	case TIMESTAMPTZ_NOEND:
+		return "infinity"
+	default:
+		t := tz.Time().In(settings.TimeZone)
+		_, offset := t.Zone()
+		return string(appendEra(appendZoneOffset(appendDateTime(nil, t), offset), t))
+	}
+}
+
+// appendZoneOffset prints a zone offset as +HH, +HH:MM or +HH:MM:SS, whichever is enough
+func appendZoneOffset(buf []byte, offset int) []byte {
+	sign := byte('+')
+	if offset < 0 {
+		sign, offset = '-', -offset
+	}
+	buf = fmt.Appendf(buf, "%c%02d", sign, offset/3600)
+	if offset%3600 != 0 {
+		buf = fmt.Appendf(buf, ":%02d", offset/60%60)
+	}
+	if offset%60 != 0 {
+		buf = fmt.Appendf(buf, ":%02d", offset%60)
+	}
+	return buf
+}
+
+func timestamptzRecv(buf []byte) (types.Datum, error) {
+	if len(buf) != 8 {
+		return nil, fmt.Errorf("invalid binary data for type timestamp with time zone")
+	}
+	return TimestampTz(int64(binary.BigEndian.Uint64(buf))), nil
+}
+
+func timestamptzSend(d types.Datum) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(d.(TimestampTz)))
+}
+
+func timestamptzCmp(a types.Datum, b types.Datum) int {
+	return compareOrdered(int64(a.(TimestampTz)), int64(b.(TimestampTz)))
+}
+
+func hashTimestampTz(buf []byte, d types.Datum) []byte {
+	return binary.BigEndian.AppendUint64(buf, uint64(d.(TimestampTz)))
+}
+
+// The typmod of time and timestamps is the number of digits after the second's decimal point, 0 to 6
+func precisionTypmodIn(typeName string) func(typmods []int64) (int32, error) {
+	return func(typmods []int64) (int32, error) {
+		if len(typmods) != 1 {
+			return -1, fmt.Errorf("invalid type modifier")
+		}
+		if typmods[0] < 0 {
+			return -1, fmt.Errorf("%s(%d) precision must not be negative", typeName, typmods[0])
+		}
+		//Postgres warns and reduces a larger precision to the maximum
+		return int32(min(typmods[0], MAX_TIMESTAMP_PRECISION)), nil
+	}
+}
+
+func precisionTypmodOut(typmod int32) string {
+	return fmt.Sprintf("(%d)", typmod)
+}
+
+// roundToPrecision rounds microseconds to typmod digits after the second's decimal point, halves away from zero
+func roundToPrecision(usecs int64, typmod int32) int64 {
+	if typmod >= MAX_TIMESTAMP_PRECISION {
+		return usecs
+	}
+	scale := int64(1)
+	for i := typmod; i < MAX_TIMESTAMP_PRECISION; i++ {
+		scale *= 10
+	}
+	if usecs < 0 {
+		return -((-usecs + scale/2) / scale * scale)
+	}
+	return (usecs + scale/2) / scale * scale
+}
+
+func applyTimestampTypmod(d types.Datum, typmod int32) (types.Datum, error) {
+	ts := d.(Timestamp)
+	if !ts.IsFinite() {
+		return ts, nil
+	}
+	return checkTimestamp(roundToPrecision(int64(ts), typmod))
+}
+
+func applyTimestampTzTypmod(d types.Datum, typmod int32) (types.Datum, error) {
+	tz := d.(TimestampTz)
+	if !tz.IsFinite() {
+		return tz, nil
+	}
+	return checkTimestampTz(roundToPrecision(int64(tz), typmod))
+}
+
+// timestampToTimestampTzIn is the point in time the wall clock of zone loc reads ts
+func timestampToTimestampTzIn(ts Timestamp, loc *time.Location) (TimestampTz, error) {
+	if !ts.IsFinite() {
+		return TimestampTz(ts), nil
+	}
+	return checkTimestampTz(int64(TimestampTzFromTime(inZone(ts, loc))))
+}
+
+// timestampTzToTimestampIn is what the wall clock of zone loc reads at tz
+func timestampTzToTimestampIn(tz TimestampTz, loc *time.Location) (Timestamp, error) {
+	if !tz.IsFinite() {
+		return Timestamp(tz), nil
+	}
+	return checkTimestamp(int64(wallTimestamp(tz.Time().In(loc))))
+}
+
+// timestampTime is the time of day of a timestamp
+func timestampTime(ts Timestamp) TimeOfDay {
+	t := int64(ts) % USECS_PER_DAY
+	if t < 0 {
+		t += USECS_PER_DAY
+	}
+	return TimeOfDay(t)
+}
+
+func timestampToDate(d types.Datum) (types.Datum, error) {
+	return d.(Timestamp).Date(), nil
+}
+
+func timestampToTimestampTz(d types.Datum, settings *Settings) (types.Datum, error) {
+	return timestampToTimestampTzIn(d.(Timestamp), settings.TimeZone)
+}
+
+func timestampTzToTimestamp(d types.Datum, settings *Settings) (types.Datum, error) {
+	return timestampTzToTimestampIn(d.(TimestampTz), settings.TimeZone)
+}
+
+func timestampTzToDate(d types.Datum, settings *Settings) (types.Datum, error) {
+	ts, err := timestampTzToTimestampIn(d.(TimestampTz), settings.TimeZone)
+	if err != nil {
+		return nil, err
+	}
+	return ts.Date(), nil
+}
+
+func timestampToTime(d types.Datum) (types.Datum, error) {
+	ts := d.(Timestamp)
+	if !ts.IsFinite() {
+		return nil, fmt.Errorf("cannot convert infinite timestamp to time")
+	}
+	return timestampTime(ts), nil
+}
+
+func timestampTzToTime(d types.Datum, settings *Settings) (types.Datum, error) {
+	ts, err := timestampTzToTimestamp(d, settings)
+	if err != nil {
+		return nil, err
+	}
+	return timestampToTime(ts)
+}
+
+/*
+addMonthsAndDays moves the wall clock of t by months, then by days. A day of the month the target month
+does not have becomes its last day: 2024-01-31 plus a month is 2024-02-29
+*/
+func addMonthsAndDays(t time.Time, months int32, days int32) time.Time {
+	y, m, d := t.Date()
+	h, mi, s := t.Clock()
+	if months != 0 {
+		total := int64(y)*12 + int64(m) - 1 + int64(months)
+		y, m = int(floorDiv(total, 12)), time.Month(total-floorDiv(total, 12)*12+1)
+		d = min(d, daysInMonth(y, m))
+	}
+	return zoneTime(y, m, d+int(days), h, mi, s, t.Nanosecond(), t.Location())
+}
+
+// timestampPlInterval is timestamp + interval: months first, then days, then the time
+func timestampPlInterval(ts Timestamp, iv Interval) (Timestamp, error) {
+	if !ts.IsFinite() {
+		return ts, nil
+	}
+	if iv.Month != 0 || iv.Day != 0 {
+		if iv.Month > maxDateYear*12 || iv.Month < -maxDateYear*12 || iv.Day > maxDateYear*366 || iv.Day < -maxDateYear*366 {
+			return 0, fmt.Errorf("timestamp out of range")
+		}
+		t := addMonthsAndDays(ts.Time(), iv.Month, iv.Day)
+		if !inTimestampRange(t) {
+			return 0, fmt.Errorf("timestamp out of range")
+		}
+		ts = TimestampFromTime(t)
+	}
+	usecs, ok := addUsecs(int64(ts), iv.Time)
+	if !ok {
+		return 0, fmt.Errorf("timestamp out of range")
+	}
+	return checkTimestamp(usecs)
+}
+
+// timestamptzPlInterval is timestamptz + interval, months and days are counted on the wall clock of zone loc
+func timestamptzPlInterval(tz TimestampTz, iv Interval, loc *time.Location) (TimestampTz, error) {
+	if !tz.IsFinite() {
+		return tz, nil
+	}
+	if iv.Month != 0 || iv.Day != 0 {
+		if iv.Month > maxDateYear*12 || iv.Month < -maxDateYear*12 || iv.Day > maxDateYear*366 || iv.Day < -maxDateYear*366 {
+			return 0, fmt.Errorf("timestamp out of range")
+		}
+		t := addMonthsAndDays(tz.Time().In(loc), iv.Month, iv.Day)
+		if !inTimestampRange(t) {
+			return 0, fmt.Errorf("timestamp out of range")
+		}
+		tz = TimestampTzFromTime(t)
+	}
+	usecs, ok := addUsecs(int64(tz), iv.Time)
+	if !ok {
+		return 0, fmt.Errorf("timestamp out of range")
+	}
+	return checkTimestampTz(usecs)
+}
+
+// timestampMi is the difference of two timestamps, whole days of it are days of the interval
+func timestampMi(a int64, b int64) (Interval, error) {
+	if !Timestamp(a).IsFinite() || !Timestamp(b).IsFinite() {
+		return Interval{}, fmt.Errorf("cannot subtract infinite timestamps")
+	}
+	return justifyHours(Interval{Time: a - b})
+}
+
+/*
+timestampAge is age(a, b), the difference as years, months and days the way people count it:
+field by field, borrowing from the next larger field when one goes negative (a month borrows
+the length of the month b is in, as postgres does)
+*/
+func timestampAge(a time.Time, b time.Time, aBefore bool) Interval {
+	ay, am, ad := a.Date()
+	by, bm, bd := b.Date()
+	ah, ami, as := a.Clock()
+	bh, bmi, bs := b.Clock()
+
+	usec := int64(a.Nanosecond()/1000 - b.Nanosecond()/1000)
+	sec, minute, hour := as-bs, ami-bmi, ah-bh
+	mday, mon, year := ad-bd, int(am)-int(bm), ay-by
+
+	//Borrow on the positive difference, then put the sign back
+	if aBefore {
+		usec, sec, minute, hour, mday, mon, year = -usec, -sec, -minute, -hour, -mday, -mon, -year
+	}
+	for usec < 0 {
+		usec += USECS_PER_SEC
+		sec--
+	}
+	for sec < 0 {
+		sec += 60
+		minute--
+	}
+	for minute < 0 {
+		minute += 60
+		hour--
+	}
+	for hour < 0 {
+		hour += 24
+		mday--
+	}
+	for mday < 0 {
+		if aBefore {
+			mday += daysInMonth(ay, am)
+		} else {
+			mday += daysInMonth(by, bm)
+		}
+		mon--
+	}
+	for mon < 0 {
+		mon += 12
+		year--
+	}
+	if aBefore {
+		usec, sec, minute, hour, mday, mon, year = -usec, -sec, -minute, -hour, -mday, -mon, -year
+	}
+	return Interval{
+		Month: int32(year*12 + mon),
+		Day:   int32(mday),
+		Time:  int64(hour)*USECS_PER_HOUR + int64(minute)*USECS_PER_MINUTE + int64(sec)*USECS_PER_SEC + usec,
+	}
+}
@@ -0,0 +1,653 @@
+package adt
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+Type registry (postgres pg_type plus the utils/adt functions it points at)
+
+Every SQL type has an entry keyed by its oid with the functions that know its values:
+  - Input / Output convert from and to the text form (what the client sees, what the data file holds)
+  - Receive / Send are the binary wire format, nil when the type has none
+  - Compare is the btree ordering, Hash appends an image of the value to a hash key, values that
+    compare equal must give the same image (1.0 and 1.00 are equal numerics)
+  - TypmodIn / TypmodOut read and print the type modifier, as in numeric(10, 2), ApplyTypmod makes a value
+    fit it. Types without modifiers leave them nil
+
+A datum is a plain Go value, its Go type tells which family it belongs to (see TypeOfDatum):
+int64 is any of smallint, integer and bigint, float64 is double precision, string is text, bool is boolean,
+[]byte is bytea, Numeric, Date, TimeOfDay, Timestamp, TimestampTz, Interval, Json, *Jsonb, *JsonPath
+and UUID are their own types and []Datum is an array
+*/
+
+// Type categories, same letters as postgres typcategory
+const (
+	TYPCATEGORY_ARRAY    byte = 'A'
+	TYPCATEGORY_BOOLEAN  byte = 'B'
+	TYPCATEGORY_DATETIME byte = 'D'
+	TYPCATEGORY_NUMERIC  byte = 'N'
+	TYPCATEGORY_PSEUDO   byte = 'P'
+	TYPCATEGORY_STRING   byte = 'S'
+	TYPCATEGORY_TIMESPAN byte = 'T'
+	TYPCATEGORY_USER     byte = 'U'
+	TYPCATEGORY_UNKNOWN  byte = 'X'
+)
+
+// How the values of a column are stored, same letters as postgres typstorage and attstorage (see access/heaptoast.go)
+const (
+	TYPSTORAGE_PLAIN    byte = 'p' //As they are
+	TYPSTORAGE_EXTERNAL byte = 'e' //Moved out of the row when it is too long, never compressed
+	TYPSTORAGE_EXTENDED byte = 'x' //Compressed, then moved out of the row
+	TYPSTORAGE_MAIN     byte = 'm' //Compressed, only moved out of the row as a last resort
+)
+
+type TypeEntry struct {
+	Oid       types.Oid
+	Name      string //How error messages and clients spell the type
+	Len       int16  //Size of the binary form, -1 for variable length
+	Category  byte
+	Preferred bool      //The type values of the category are converted to when mixed
+	ElemType  types.Oid //For array types
+	ArrayType types.Oid //The array type with this element type
+	Storage   byte      //Default storage of its columns, left out it is EXTENDED with variable length and PLAIN without
+
+	Input   func(str string, settings *Settings) (types.Datum, error)
+	Output  func(d types.Datum, settings *Settings) string
+	Receive func(buf []byte) (types.Datum, error)
+	Send    func(d types.Datum) []byte
+	Compare func(a types.Datum, b types.Datum) int
+	Hash    func(buf []byte, d types.Datum) []byte
+
+	//The text form depends on the session's settings (TimeZone, IntervalStyle, the clock for 'now'), on the way in or out
+	StableInput  bool
+	StableOutput bool
+
+	TypmodIn    func(typmods []int64) (int32, error)
+	TypmodOut   func(typmod int32) string
+	ApplyTypmod func(d types.Datum, typmod int32) (types.Datum, error)
+}
+
+var typeRegistry = make(map[types.Oid]*TypeEntry)
+
+// Names a type can be written as, besides its own
+var typeNames = make(map[string]types.Oid)
+
+func registerType(entry *TypeEntry, aliases ...string) {
+	if entry.Storage == 0 {
+		entry.Storage = TYPSTORAGE_PLAIN
+		if entry.Len == -1 {
+			entry.Storage = TYPSTORAGE_EXTENDED
+		}
+	}
+	typeRegistry[entry.Oid] = entry
+	typeNames[entry.Name] = entry.Oid
+	for _, alias := range aliases {
+		typeNames[alias] = entry.Oid
+	}
+}
+
+func init() {
+	registerType(&TypeEntry{
+		Oid:       types.BOOLOID,
+		Name:      "boolean",
+		Len:       1,
+		Category:  TYPCATEGORY_BOOLEAN,
+		Preferred: true,
+		ArrayType: types.BOOLARRAYOID,
+		Input:     boolIn,
+		Output:    boolOut,
+		Receive:   boolRecv,
+		Send:      boolSend,
+		Compare:   boolCmp,
+		Hash:      hashBool,
+	}, "bool")
+	registerType(&TypeEntry{
+		Oid:       types.INT2OID,
+		Name:      "smallint",
+		Len:       2,
+		Category:  TYPCATEGORY_NUMERIC,
+		ArrayType: types.INT2ARRAYOID,
+		Input:     int2In,
+		Output:    intOut,
+		Receive:   int2Recv,
+		Send:      int2Send,
+		Compare:   intCmp,
+		Hash:      hashInt,
+	}, "int2")
+	registerType(&TypeEntry{
+		Oid:       types.INT4OID,
+		Name:      "integer",
+		Len:       4,
+		Category:  TYPCATEGORY_NUMERIC,
+		ArrayType: types.INT4ARRAYOID,
+		Input:     int4In,
+		Output:    intOut,
+		Receive:   int4Recv,
+		Send:      int4Send,
+		Compare:   intCmp,
+		Hash:      hashInt,
+	}, "int4", "int")
+	registerType(&TypeEntry{
+		Oid:       types.INT8OID,
+		Name:      "bigint",
+		Len:       8,
+		Category:  TYPCATEGORY_NUMERIC,
+		ArrayType: types.INT8ARRAYOID,
+		Input:     int8In,
+		Output:    intOut,
+		Receive:   int8Recv,
+		Send:      int8Send,
+		Compare:   intCmp,
+		Hash:      hashInt,
+	}, "int8")
+	registerType(&TypeEntry{
+		Oid:       types.FLOAT8OID,
+		Name:      "double precision",
+		Len:       8,
+		Category:  TYPCATEGORY_NUMERIC,
+		Preferred: true,
+		ArrayType: types.FLOAT8ARRAYOID,
+		Input:     float8In,
+		Output:    float8Out,
+		Receive:   float8Recv,
+		Send:      float8Send,
+		Compare:   float8Cmp,
+		Hash:      hashFloat8,
+	}, "float8", "float")
+	registerType(&TypeEntry{
+		Oid:       types.NUMERICOID,
+		Name:      "numeric",
+		Len:       -1,
+		Category:  TYPCATEGORY_NUMERIC,
+		ArrayType: types.NUMERICARRAYOID,
+		Storage:   TYPSTORAGE_MAIN,
+		Input:     numericIn,
+		Output:    numericOut,
+		Receive:   numericRecv,
+		Send:      numericSend,
+		Compare:   numericCmp,
+		Hash:      hashNumeric,
+
+		TypmodIn:    numericTypmodIn,
+		TypmodOut:   numericTypmodOut,
+		ApplyTypmod: applyNumericTypmod,
+	}, "decimal")
+	registerType(&TypeEntry{
+		Oid:       types.TEXTOID,
+		Name:      "text",
+		Len:       -1,
+		Category:  TYPCATEGORY_STRING,
+		Preferred: true,
+		ArrayType: types.TEXTARRAYOID,
+		Input:     textIn,
+		Output:    textOut,
+		Receive:   textRecv,
+		Send:      textSend,
+		Compare:   textCmp,
+		Hash:      hashText,
+	})
+	registerType(&TypeEntry{
+		Oid:       types.BYTEAOID,
+		Name:      "bytea",
+		Len:       -1,
+		Category:  TYPCATEGORY_USER,
+		ArrayType: types.BYTEAARRAYOID,
+		Input:     byteaIn,
+		Output:    byteaOut,
+		Receive:   byteaRecv,
+		Send:      byteaSend,
+		Compare:   byteaCmp,
+		Hash:      hashBytea,
+	})
+	registerType(&TypeEntry{
+		Oid:       types.DATEOID,
+		Name:      "date",
+		Len:       4,
+		Category:  TYPCATEGORY_DATETIME,
+		ArrayType: types.DATEARRAYOID,
+		Input:     dateIn,
+		Output:    dateOut,
+		Receive:   dateRecv,
+		Send:      dateSend,
+		Compare:   dateCmp,
+		Hash:      hashDate,
+
+		StableInput: true,
+	})
+	registerType(&TypeEntry{
+		Oid:       types.TIMEOID,
+		Name:      "time without time zone",
+		Len:       8,
+		Category:  TYPCATEGORY_DATETIME,
+		ArrayType: types.TIMEARRAYOID,
+		Input:     timeIn,
+		Output:    timeOut,
+		Receive:   timeRecv,
+		Send:      timeSend,
+		Compare:   timeCmp,
+		Hash:      hashTime,
+
+		StableInput: true,
+
+		TypmodIn:    precisionTypmodIn("TIME"),
+		TypmodOut:   precisionTypmodOut,
+		ApplyTypmod: applyTimeTypmod,
+	}, "time")
+	registerType(&TypeEntry{
+		Oid:       types.TIMESTAMPOID,
+		Name:      "timestamp without time zone",
+		Len:       8,
+		Category:  TYPCATEGORY_DATETIME,
+		ArrayType: types.TIMESTAMPARRAYOID,
+		Input:     timestampIn,
+		Output:    timestampOut,
+		Receive:   timestampRecv,
+		Send:      timestampSend,
+		Compare:   timestampCmp,
+		Hash:      hashTimestamp,
+
+		StableInput: true,
+
+		TypmodIn:    precisionTypmodIn("TIMESTAMP"),
+		TypmodOut:   precisionTypmodOut,
+		ApplyTypmod: applyTimestampTypmod,
+	}, "timestamp")
+	registerType(&TypeEntry{
+		Oid:       types.TIMESTAMPTZOID,
+		Name:      "timestamp with time zone",
+		Len:       8,
+		Category:  TYPCATEGORY_DATETIME,
+		Preferred: true,
+		ArrayType: types.TIMESTAMPTZARRAYOID,
+		Input:     timestamptzIn,
+		Output:    timestamptzOut,
+		Receive:   timestamptzRecv,
+		Send:      timestamptzSend,
+		Compare:   timestamptzCmp,
+		Hash:      hashTimestampTz,
+
+		StableInput:  true,
+		StableOutput: true,
+
+		TypmodIn:    precisionTypmodIn("TIMESTAMP"),
+		TypmodOut:   precisionTypmodOut,
+		ApplyTypmod: applyTimestampTzTypmod,
+	}, "timestamptz")
+	registerType(&TypeEntry{
+		Oid:       types.INTERVALOID,
+		Name:      "interval",
+		Len:       16,
+		Category:  TYPCATEGORY_TIMESPAN,
+		Preferred: true,
+		ArrayType: types.INTERVALARRAYOID,
+		Input:     intervalIn,
+		Output:    intervalOut,
+		Receive:   intervalRecv,
+		Send:      intervalSend,
+		Compare:   intervalCmp,
+		Hash:      hashInterval,
+
+		StableOutput: true,
+	})
+
+	//json has no ordering or equality, like in postgres
+	registerType(&TypeEntry{
+		Oid:       types.JSONOID,
+		Name:      "json",
+		Len:       -1,
+		Category:  TYPCATEGORY_USER,
+		ArrayType: types.JSONARRAYOID,
+		Input:     jsonIn,
+		Output:    jsonOut,
+		Receive:   jsonRecv,
+		Send:      jsonSend,
+		Hash:      hashJson,
+	})
+	registerType(&TypeEntry{
+		Oid:       types.JSONBOID,
+		Name:      "jsonb",
+		Len:       -1,
+		Category:  TYPCATEGORY_USER,
+		ArrayType: types.JSONBARRAYOID,
+		Input:     jsonbIn,
+		Output:    jsonbOut,
+		Receive:   jsonbRecv,
+		Send:      jsonbSend,
+		Compare:   jsonbCmp,
+		Hash:      hashJsonb,
+	})
+	registerType(&TypeEntry{
+		Oid:       types.JSONPATHOID,
+		Name:      "jsonpath",
+		Len:       -1,
+		Category:  TYPCATEGORY_USER,
+		ArrayType: types.JSONPATHARRAYOID,
+		Input:     jsonPathIn,
+		Output:    jsonPathOut,
+		Receive:   jsonPathRecv,
+		Send:      jsonPathSend,
+		Hash:      hashJsonPath,
+	})
+	registerType(&TypeEntry{
+		Oid:       types.UUIDOID,
+		Name:      "uuid",
+		Len:       16,
+		Category:  TYPCATEGORY_USER,
+		ArrayType: types.UUIDARRAYOID,
+		Input:     uuidIn,
+		Output:    uuidOut,
+		Receive:   uuidRecv,
+		Send:      uuidSend,
+		Compare:   uuidCmp,
+		Hash:      hashUUID,
+	})
+
+	//String literals are unknown until the context gives them a type, their value is the literal's text
+	registerType(&TypeEntry{
+		Oid:      types.UNKNOWNOID,
+		Name:     "unknown",
+		Len:      -2,
+		Category: TYPCATEGORY_UNKNOWN,
+		Input:    textIn,
+		Output:   textOut,
+		Receive:  textRecv,
+		Send:     textSend,
+		Compare:  textCmp,
+		Hash:     hashText,
+	})
+
+	for _, elem := range []types.Oid{
+		types.BOOLOID, types.INT2OID, types.INT4OID, types.INT8OID, types.FLOAT8OID, types.NUMERICOID,
+		types.TEXTOID, types.BYTEAOID, types.DATEOID, types.TIMEOID, types.TIMESTAMPOID, types.TIMESTAMPTZOID,
+		types.INTERVALOID, types.JSONOID, types.JSONBOID, types.JSONPATHOID, types.UUIDOID,
+	} {
+		elemEntry := typeRegistry[elem]
+		registerType(&TypeEntry{
+			Oid:      elemEntry.ArrayType,
+			Name:     elemEntry.Name + "[]",
+			Len:      -1,
+			Category: TYPCATEGORY_ARRAY,
+			ElemType: elem,
+			Input:    arrayIn(elem),
+			Output:   arrayOut,
+			Compare:  arrayCmp,
+			Hash:     hashArray,
+
+			StableInput:  elemEntry.StableInput,
+			StableOutput: elemEntry.StableOutput,
+		})
+	}
+	registerType(&TypeEntry{
+		Oid:      types.ANYOID,
+		Name:     "\"any\"",
+		Len:      4,
+		Category: TYPCATEGORY_PSEUDO,
+	})
+	registerType(&TypeEntry{
+		Oid:      types.ANYARRAYOID,
+		Name:     "anyarray",
+		Len:      -1,
+		Category: TYPCATEGORY_PSEUDO,
+		Output:   arrayOut,
+		Compare:  arrayCmp,
+		Hash:     hashArray,
+	})
+	registerType(&TypeEntry{
+		Oid:      types.ANYELEMENTOID,
+		Name:     "anyelement",
+		Len:      4,
+		Category: TYPCATEGORY_PSEUDO,
+	})
+}
+
+// LookupType returns the registry entry of a type, nil if there is no such type
+func LookupType(typ types.Oid) *TypeEntry {
+	return typeRegistry[typ]
+}
+
+// LookupTypeName finds a type by any of its names, case insensitive. name[] is the array type of name
+func LookupTypeName(name string) (types.Oid, bool) {
+	if elemName, isArray := strings.CutSuffix(name, "[]"); isArray {
+		elemType, ok := LookupTypeName(elemName)
+		if !ok {
+			return types.InvalidOid, false
+		}
+		arrayType := ArrayTypeOf(elemType)
+		return arrayType, arrayType != types.InvalidOid
+	}
+	typ, ok := typeNames[strings.ToLower(name)]
+	return typ, ok
+}
+
+// TypeName is the name of a type for messages (postgres format_type)
+func TypeName(typ types.Oid) string {
+	if entry := typeRegistry[typ]; entry != nil {
+		return entry.Name
+	}
+	return fmt.Sprintf("oid %d", typ)
+}
+
+// Names of the types in pg_type where they are not spelled as in messages, int8 for bigint
+var internalTypeNames = map[types.Oid]string{
+	types.BOOLOID:        "bool",
+	types.INT2OID:        "int2",
+	types.INT4OID:        "int4",
+	types.INT8OID:        "int8",
+	types.FLOAT8OID:      "float8",
+	types.TIMEOID:        "time",
+	types.TIMESTAMPOID:   "timestamp",
+	types.TIMESTAMPTZOID: "timestamptz",
+	types.ANYOID:         "any",
+}
+
+// TypeInternalName is the name of a type in pg_type, array types are their element's name with a leading '_'
+func TypeInternalName(typ types.Oid) string {
+	entry := typeRegistry[typ]
+	if entry == nil {
+		return fmt.Sprintf("oid %d", typ)
+	}
+	if entry.Category == TYPCATEGORY_ARRAY && entry.ElemType != types.InvalidOid {
+		return "_" + TypeInternalName(entry.ElemType)
+	}
+	if name, ok := internalTypeNames[typ]; ok {
+		return name
+	}
+	return entry.Name
+}
+
+// AllTypes returns the registry entries in oid order, the rows of pg_type
+func AllTypes() []*TypeEntry {
+	entries := make([]*TypeEntry, 0, len(typeRegistry))
+	for _, entry := range typeRegistry {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Oid < entries[j].Oid })
+	return entries
+}
+
+// TypmodIn converts the modifiers written after a type name to its typmod, -1 when there are none
+
+func TypmodIn(typ types.Oid, typmods []int64) (int32, error) {
+	if len(typmods) == 0 {
+		return -1, nil
+	}
+	entry := typeRegistry[typ]
+	if entry == nil || entry.TypmodIn == nil {
+		return -1, fmt.Errorf("type modifier is not allowed for type \"%s\"", TypeName(typ))
+	}
+	return entry.TypmodIn(typmods)
+}
+
+// ApplyTypmod makes a non NULL datum of type typ fit the type modifier, a negative typmod is no modifier
+func ApplyTypmod(d types.Datum, typ types.Oid, typmod int32) (types.Datum, error) {
+	entry := typeRegistry[typ]
+	if typmod < 0 || entry == nil || entry.ApplyTypmod == nil {
+		return d, nil
+	}
+	return entry.ApplyTypmod(d, typmod)
+}
+
+// FormatType is the name of a type with its modifier, numeric(10,2) (postgres format_type)
+// The modifier of a type with a zone goes before the zone, timestamp(3) with time zone
+func FormatType(typ types.Oid, typmod int32) string {
+	if entry := typeRegistry[typ]; entry != nil && entry.TypmodOut != nil && typmod >= 0 {
+		if name, zone, ok := strings.Cut(entry.Name, " with"); ok {
+			return name + entry.TypmodOut(typmod) + " with" + zone
+		}
+		return entry.Name + entry.TypmodOut(typmod)
+	}
+	return TypeName(typ)
+}
+
+// ArrayTypeOf returns the array type whose elements are elemType, InvalidOid if we have none
+func ArrayTypeOf(elemType types.Oid) types.Oid {
+	if elemType == types.UNKNOWNOID {
+		elemType = types.TEXTOID
+	}
+	if entry := typeRegistry[elemType]; entry != nil {
+		return entry.ArrayType
+	}
+	return types.InvalidOid
+}
+
+// TypeOfDatum tells the type family of a non NULL datum by its Go type
+func TypeOfDatum(d types.Datum) types.Oid {
+	switch d.(type) {
+	case int64:
+		return types.INT8OID
+	case float64:
+		return types.FLOAT8OID
+	case string:
+		return types.TEXTOID
+	case bool:
+		return types.BOOLOID
+	case []byte:
+		return types.BYTEAOID
+	case Numeric:
+		return types.NUMERICOID
+	case Date:
+		return types.DATEOID
+	case TimeOfDay:
+		return types.TIMEOID
+	case Timestamp:
+		return types.TIMESTAMPOID
+	case TimestampTz:
+		return types.TIMESTAMPTZOID
+	case Interval:
+		return types.INTERVALOID
+	case Json:
+		return types.JSONOID
+	case *Jsonb:
+		return types.JSONBOID
+	case *JsonPath:
+		return types.JSONPATHOID
+	case UUID:
+		return types.UUIDOID
+	case Regclass:
+		return types.REGCLASSOID
+	case []types.Datum:
+		return types.ANYARRAYOID
+	}
+	return types.InvalidOid
+}
+
+// InputDatum converts the text form of a value of type typ
+func InputDatum(typ types.Oid, str string, settings *Settings) (types.Datum, error) {
+	entry := typeRegistry[typ]
+	if entry == nil || entry.Input == nil {
+		return nil, fmt.Errorf("no input function available for type %s", TypeName(typ))
+	}
+	return entry.Input(str, settings)
+}
+
+// OutputDatum converts a non NULL datum to its text representation
+func OutputDatum(d types.Datum, settings *Settings) string {
+	if entry := typeRegistry[TypeOfDatum(d)]; entry != nil {
+		return entry.Output(d, settings)
+	}
+	return fmt.Sprint(d)
+}
+
+// CompareDatums returns -1, 0 or 1, both datums must be non NULL
+func CompareDatums(a types.Datum, b types.Datum) (int, error) {
+	//The common cases skip the registry
+	switch av := a.(type) {
+	case int64:
+		if bv, ok := b.(int64); ok {
+			return compareOrdered(av, bv), nil
+		}
+	case string:
+		if bv, ok := b.(string); ok {
+			return strings.Compare(av, bv), nil
+		}
+	}
+
+	atype, btype := TypeOfDatum(a), TypeOfDatum(b)
+	if atype == btype && atype != types.InvalidOid {
+		if typeRegistry[atype].Compare == nil {
+			return 0, fmt.Errorf("could not identify a comparison function for type %s", TypeName(atype))
+		}
+		return typeRegistry[atype].Compare(a, b), nil
+	}
+	//Integers and floats are mixed without a cast
+	af, aok := toFloat(a)
+	bf, bok := toFloat(b)
+	if aok && bok {
+		return compareFloat8(af, bf), nil
+	}
+	return 0, fmt.Errorf("cannot compare %s with %s", TypeName(atype), TypeName(btype))
+}
+
+// HashDatum appends the hash image of a non NULL datum to buf
+func HashDatum(buf []byte, d types.Datum) ([]byte, error) {
+	if !isHashable(d) {
+		return nil, fmt.Errorf("could not identify a hash function for a value of type %T", d)
+	}
+	return hashDatum(buf, d), nil
+}
+
+// isHashable tells if a value and the elements of an array have a hash function
+func isHashable(d types.Datum) bool {
+	entry := typeRegistry[TypeOfDatum(d)]
+	if entry == nil || entry.Hash == nil {
+		return false
+	}
+	if elems, ok := d.([]types.Datum); ok {
+		for _, elem := range elems {
+			if elem != nil && !isHashable(elem) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// hashDatum is HashDatum of a value isHashable said yes to
+func hashDatum(buf []byte, d types.Datum) []byte {
+	return typeRegistry[TypeOfDatum(d)].Hash(buf, d)
+}
+
+func compareOrdered[T int64 | int32 | float64](a T, b T) int {
+	if a < b {
+		return -1
+	}
+	if a > b {
+		return 1
+	}
+	return 0
+}
+
+func toFloat(d types.Datum) (float64, bool) {
+	switch v := d.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
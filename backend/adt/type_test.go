@@ -0,0 +1,33 @@
+package adt
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/rautNishan/diskquery/types"
+)
+
+func TestHashDatum(t *testing.T) {
+	one, _ := ParseNumeric("1.0")
+	oneToo, _ := ParseNumeric("1.00")
+	a, err := HashDatum(nil, one)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := HashDatum(nil, oneToo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(a, b) {
+		t.Errorf("1.0 and 1.00 hash differently")
+	}
+
+	for _, d := range []types.Datum{struct{}{}, []types.Datum{int64(1), nil, []types.Datum{struct{}{}}}} {
+		if _, err := HashDatum(nil, d); err == nil {
+			t.Errorf("HashDatum(%v) did not fail", d)
+		}
+	}
+	if _, err := HashDatum(nil, []types.Datum{int64(1), nil, []types.Datum{"a"}}); err != nil {
+		t.Error(err)
+	}
+}
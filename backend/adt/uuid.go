@@ -0,0 +1,243 @@
+package adt
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+uuid (postgres utils/adt/uuid.c), 16 bytes that compare and hash byte by byte.
+
+gen_random_uuid (or uuidv4) is version 4, all random. uuidv7 puts the Unix time in milliseconds in the
+first 48 bits and the fraction of the millisecond in the next 12, so UUIDs generated one after another
+sort in the order they were made and inserts go to the end of an index instead of all over it.
+Within this process they are strictly increasing even when the clock does not move (RFC 9562 method 3)
+*/
+
+type UUID [16]byte
+
+const (
+	uuidVariantRFC4122 = 0x80 //Top bits 10 of byte 8
+
+	//The 12 bits after the milliseconds count steps of 1/4096 ms, about 245ns
+	subMsStepNs = 1000000/4096 + 1
+)
+
+// Seconds from the start of the Gregorian calendar (1582-10-15) to the Unix epoch, the origin of version 1 timestamps
+const gregorianToUnixSecs = 12219292800
+
+func uuidIn(str string, _ *Settings) (types.Datum, error) {
+	invalid := fmt.Errorf("invalid input syntax for type uuid: \"%s\"", str)
+	src := str
+	braces := len(src) > 0 && src[0] == '{'
+	if braces {
+		src = src[1:]
+	}
+
+	//32 hex digits, a hyphen may follow any group of four of them
+	hexDigits := make([]byte, 0, 32)
+	pos := 0
+	for ; pos < len(src) && len(hexDigits) < 32; pos++ {
+		c := src[pos]
+		switch {
+		case isHexDigit(c):
+			hexDigits = append(hexDigits, c)
+		case c == '-' && len(hexDigits) > 0 && len(hexDigits)%4 == 0 && pos+1 < len(src) && src[pos+1] != '-':
+		default:
+			return nil, invalid
+		}
+	}
+	if len(hexDigits) != 32 {
+		return nil, invalid
+	}
+	src = src[pos:]
+	if braces {
+		if src != "}" {
+			return nil, invalid
+		}
+	} else if src != "" {
+		return nil, invalid
+	}
+	var u UUID
+	hex.Decode(u[:], hexDigits)
+	return u, nil
+}
+
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+// uuidOut is the canonical form, lower case 8-4-4-4-12
+func uuidOut(d types.Datum, _ *Settings) string {
+	u := d.(UUID)
+	buf := make([]byte, 0, 36)
+	for i, b := range u {
+		if i == 4 || i == 6 || i == 8 || i == 10 {
+			buf = append(buf, '-')
+		}
+		buf = hex.AppendEncode(buf, []byte{b})
+	}
+	return string(buf)
+}
+
+func uuidRecv(buf []byte) (types.Datum, error) {
+	if len(buf) != 16 {
+		return nil, fmt.Errorf("invalid binary data for type uuid")
+	}
+	return UUID(buf), nil
+}
+
+func uuidSend(d types.Datum) []byte {
+	u := d.(UUID)
+	return u[:]
+}
+
+func uuidCmp(a types.Datum, b types.Datum) int {
+	au, bu := a.(UUID), b.(UUID)
+	return bytes.Compare(au[:], bu[:])
+}
+
+func hashUUID(buf []byte, d types.Datum) []byte {
+	u := d.(UUID)
+	return append(buf, u[:]...)
+}
+
+func (u UUID) version() int {
+	return int(u[6] >> 4)
+}
+
+func (u UUID) isRFC4122() bool {
+	return u[8]&0xc0 == uuidVariantRFC4122
+}
+
+// setVersion stamps the version and the RFC 4122 variant into a UUID
+func (u *UUID) setVersion(version byte) {
+	u[6] = u[6]&0x0f | version<<4
+	u[8] = u[8]&0x3f | uuidVariantRFC4122
+}
+
+func genRandomUUID() (UUID, error) {
+	var u UUID
+	if _, err := rand.Read(u[:]); err != nil {
+		return u, fmt.Errorf("could not generate random values: %v", err)
+	}
+	u.setVersion(4)
+	return u, nil
+}
+
+var uuidv7State struct {
+	sync.Mutex
+	lastNs int64
+}
+
+// uuidv7Now is the time for a new version 7 UUID in Unix nanoseconds, always at least a step after the previous one
+func uuidv7Now() int64 {
+	uuidv7State.Lock()
+	defer uuidv7State.Unlock()
+	ns := time.Now().UnixNano()
+	if ns < uuidv7State.lastNs+subMsStepNs {
+		ns = uuidv7State.lastNs + subMsStepNs
+	}
+	uuidv7State.lastNs = ns
+	return ns
+}
+
+// genUUIDv7 makes a version 7 UUID for the Unix time ms milliseconds and subMsNs nanoseconds
+func genUUIDv7(ms int64, subMsNs int64) (UUID, error) {
+	if ms < 0 || ms >= 1<<48 {
+		return UUID{}, fmt.Errorf("timestamp out of range")
+	}
+	u, err := genRandomUUID()
+	if err != nil {
+		return u, err
+	}
+	subMs := subMsNs * 4096 / 1000000
+	for i := 0; i < 6; i++ {
+		u[i] = byte(ms >> (40 - 8*i))
+	}
+	u[6] = byte(subMs >> 8)
+	u[7] = byte(subMs)
+	u.setVersion(7)
+	return u, nil
+}
+
+// uuidExtractTimestamp is the time a version 1 or 7 UUID was made, NULL for the others
+func uuidExtractTimestamp(u UUID) types.Datum {
+	if !u.isRFC4122() {
+		return nil
+	}
+	switch u.version() {
+	case 1:
+		//60 bits of 100ns intervals, time_low, time_mid and the low 12 bits of time_hi
+		ticks := int64(u[6]&0x0f)<<56 | int64(u[7])<<48 | int64(u[4])<<40 | int64(u[5])<<32 |
+			int64(u[0])<<24 | int64(u[1])<<16 | int64(u[2])<<8 | int64(u[3])
+		usecs := ticks/10 - gregorianToUnixSecs*USECS_PER_SEC
+		return TimestampTzFromTime(time.UnixMicro(usecs))
+	case 7:
+		ms := int64(u[0])<<40 | int64(u[1])<<32 | int64(u[2])<<24 | int64(u[3])<<16 | int64(u[4])<<8 | int64(u[5])
+		return TimestampTzFromTime(time.UnixMilli(ms))
+	}
+	return nil
+}
+
+func init() {
+	const (
+		uuid        = types.UUIDOID
+		int2        = types.INT2OID
+		timestamptz = types.TIMESTAMPTZOID
+		interval    = types.INTERVALOID
+	)
+
+	randomUUID := func(*FunctionCallInfo) (types.Datum, error) {
+		u, err := genRandomUUID()
+		if err != nil {
+			return nil, err
+		}
+		return u, nil
+	}
+	addFunction("gen_random_uuid", nil, uuid, randomUUID).setMutable()
+	addFunction("uuidv4", nil, uuid, randomUUID).setMutable()
+	addFunction("uuidv7", nil, uuid, func(*FunctionCallInfo) (types.Datum, error) {
+		ns := uuidv7Now()
+		u, err := genUUIDv7(ns/1000000, ns%1000000)
+		if err != nil {
+			return nil, err
+		}
+		return u, nil
+	}).setMutable()
+	//uuidv7(shift) makes a UUID for the current time moved by an interval
+	addFunction("uuidv7", []types.Oid{interval}, uuid, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		ns := uuidv7Now()
+		now := TimestampTzFromTime(time.Unix(0, ns))
+		shifted, err := timestamptzPlInterval(now, fcinfo.Args[0].(Interval), fcinfo.Settings.TimeZone)
+		if err != nil {
+			return nil, err
+		}
+		if !shifted.IsFinite() {
+			return nil, fmt.Errorf("timestamp out of range")
+		}
+		//The timestamp only has microseconds, the nanoseconds of the clock are kept
+		us := shifted.Time().UnixMicro()
+		u, err := genUUIDv7(floorDiv(us, 1000), (us-floorDiv(us, 1000)*1000)*1000+ns%1000)
+		if err != nil {
+			return nil, err
+		}
+		return u, nil
+	}).setMutable()
+	addFunction("uuid_extract_version", []types.Oid{uuid}, int2, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		u := fcinfo.Args[0].(UUID)
+		if !u.isRFC4122() {
+			return nil, nil
+		}
+		return int64(u.version()), nil
+	})
+	addFunction("uuid_extract_timestamp", []types.Oid{uuid}, timestamptz, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		return uuidExtractTimestamp(fcinfo.Args[0].(UUID)), nil
+	})
+}
@@ -0,0 +1,447 @@
+package adt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+Variable length types, text and bytea (postgres utils/adt/varlena.c)
+Text compares byte by byte, the C collation
+*/
+
+func textIn(str string, _ *Settings) (types.Datum, error) {
+	return str, nil
+}
+
+func textOut(d types.Datum, _ *Settings) string {
+	return d.(string)
+}
+
+func textRecv(buf []byte) (types.Datum, error) {
+	return string(buf), nil
+}
+
+func textSend(d types.Datum) []byte {
+	return []byte(d.(string))
+}
+
+func textCmp(a types.Datum, b types.Datum) int {
+	return strings.Compare(a.(string), b.(string))
+}
+
+func hashText(buf []byte, d types.Datum) []byte {
+	str := d.(string)
+	buf = binary.AppendUvarint(buf, uint64(len(str)))
+	return append(buf, str...)
+}
+
+/*
+bytea input is either the hex format, \x followed by pairs of hex digits (whitespace between pairs is ignored),
+or the escape format where \\ is a backslash and \ooo an octal byte. Output is always hex
+*/
+func byteaIn(str string, _ *Settings) (types.Datum, error) {
+	if strings.HasPrefix(str, "\\x") {
+		digits := str[2:]
+		result := make([]byte, 0, len(digits)/2)
+		for i := 0; i < len(digits); {
+			c := digits[i]
+			if c == ' ' || c == '\t' || c == '\n' || c == '\r' {
+				i++
+				continue
+			}
+			high, ok := hexValue(c)
+			if !ok {
+				return nil, fmt.Errorf("invalid hexadecimal digit: \"%c\"", c)
+			}
+			if i+1 >= len(digits) {
+				return nil, fmt.Errorf("invalid hexadecimal data: odd number of digits")
+			}
+			low, ok := hexValue(digits[i+1])
+			if !ok {
+				return nil, fmt.Errorf("invalid hexadecimal digit: \"%c\"", digits[i+1])
+			}
+			result = append(result, high<<4|low)
+			i += 2
+		}
+		return result, nil
+	}
+
+	result := make([]byte, 0, len(str))
+	for i := 0; i < len(str); i++ {
+		if str[i] != '\\' {
+			result = append(result, str[i])
+			continue
+		}
+		switch {
+		case i+1 < len(str) && str[i+1] == '\\':
+			result = append(result, '\\')
+			i++
+		case i+3 < len(str) && isOctal(str[i+1]) && str[i+1] <= '3' && isOctal(str[i+2]) && isOctal(str[i+3]):
+			result = append(result, (str[i+1]-'0')<<6|(str[i+2]-'0')<<3|(str[i+3]-'0'))
+			i += 3
+		default:
+			return nil, fmt.Errorf("invalid input syntax for type bytea")
+		}
+	}
+	return result, nil
+}
+
+func hexValue(c byte) (byte, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0', true
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10, true
+	case c >= 'A' && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
+
+func isOctal(c byte) bool {
+	return c >= '0' && c <= '7'
+}
+
+func byteaOut(d types.Datum, _ *Settings) string {
+	return "\\x" + hex.EncodeToString(d.([]byte))
+}
+
+func byteaRecv(buf []byte) (types.Datum, error) {
+	return bytes.Clone(buf), nil
+}
+
+func byteaSend(d types.Datum) []byte {
+	return d.([]byte)
+}
+
+func byteaCmp(a types.Datum, b types.Datum) int {
+	return bytes.Compare(a.([]byte), b.([]byte))
+}
+
+func hashBytea(buf []byte, d types.Datum) []byte {
+	value := d.([]byte)
+	buf = binary.AppendUvarint(buf, uint64(len(value)))
+	return append(buf, value...)
+}
+
+/*
+String functions
+Positions and lengths count characters, not bytes, and positions start at 1
+*/
+
+/*
+textSubstring is substring(str, start, count), the characters from start on, at most up to start + count.
+Parts of that range before the first character are just cut off: substring('hello', 0, 3) is 'he'.
+count < 0 means up to the end
+*/
+func textSubstring(str string, start int64, count int64) string {
+	chars := []rune(str)
+	begin, end := start, int64(len(chars))+1
+	if count >= 0 && start <= int64(len(chars))+1-count {
+		end = start + count
+	}
+	begin = max(begin, 1)
+	end = min(end, int64(len(chars))+1)
+	if begin >= end {
+		return ""
+	}
+	return string(chars[begin-1 : end-1])
+}
+
+// textPosition is the character position of the first search in str, 1 for an empty search and 0 when there is none
+func textPosition(str string, search string) int64 {
+	index := strings.Index(str, search)
+	if index < 0 {
+		return 0
+	}
+	return int64(utf8.RuneCountInString(str[:index])) + 1
+}
+
+/*
+splitPart is field n of str split at delimiter, negative n counts from the end. Fields past the
+last are empty strings, an empty delimiter leaves str as the single field
+*/
+func splitPart(str string, delimiter string, n int64) (string, error) {
+	if n == 0 {
+		return "", fmt.Errorf("field position must not be zero")
+	}
+	fields := []string{str}
+	if delimiter != "" {
+		fields = strings.Split(str, delimiter)
+	}
+	if str == "" {
+		return "", nil
+	}
+	if n < 0 {
+		n += int64(len(fields)) + 1
+	}
+	if n < 1 || n > int64(len(fields)) {
+		return "", nil
+	}
+	return fields[n-1], nil
+}
+
+/*
+textFormat is format(formatstr, args...), printf for SQL. A specifier is %[position$][-][width]type,
+type being s for the text form of a value, I for it quoted as an identifier and L quoted as a literal.
+The width can be * or *position$ to take it from an argument, a negative one left aligns. %% is a %
+*/
+func textFormat(format string, args []types.Datum, settings *Settings) (string, error) {
+	var sb strings.Builder
+	next := 0 //The argument a specifier without a position takes
+	//number reads the digits at format[i:], ok is false when there are none
+	number := func(i int) (value int, end int, ok bool) {
+		for end = i; end < len(format) && format[end] >= '0' && format[end] <= '9'; end++ {
+			if value = value*10 + int(format[end]-'0'); value > math.MaxInt32 {
+				return 0, end, false
+			}
+		}
+		return value, end, end > i
+	}
+	argument := func(position int) (types.Datum, error) {
+		if position < 0 {
+			position = next
+		}
+		if position >= len(args) {
+			return nil, fmt.Errorf("too few arguments for format()")
+		}
+		next = position + 1
+		return args[position], nil
+	}
+	unterminated := fmt.Errorf("unterminated format() type specifier")
+
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			sb.WriteByte(format[i])
+			continue
+		}
+		i++
+		if i >= len(format) {
+			return "", unterminated
+		}
+		if format[i] == '%' {
+			sb.WriteByte('%')
+			continue
+		}
+
+		position := -1
+		if value, end, ok := number(i); ok && end < len(format) && format[end] == '$' {
+			if value == 0 {
+				return "", fmt.Errorf("format specifies argument 0, but arguments are numbered from 1")
+			}
+			position, i = value-1, end+1
+		}
+		leftAlign := false
+		for i < len(format) && format[i] == '-' {
+			leftAlign = true
+			i++
+		}
+		width := 0
+		switch {
+		case i < len(format) && format[i] == '*':
+			widthPosition := -1
+			if value, end, ok := number(i + 1); ok && end < len(format) && format[end] == '$' {
+				if value == 0 {
+					return "", fmt.Errorf("format specifies argument 0, but arguments are numbered from 1")
+				}
+				widthPosition, i = value-1, end+1
+			} else {
+				i++
+			}
+			widthArg, err := argument(widthPosition)
+			if err != nil {
+				return "", err
+			}
+			if widthArg != nil {
+				w, ok := widthArg.(int64)
+				if !ok {
+					return "", fmt.Errorf("width argument must be an integer")
+				}
+				if w < 0 {
+					leftAlign, w = true, -w
+				}
+				width = int(min(w, math.MaxInt32))
+			}
+		default:
+			if value, end, ok := number(i); ok {
+				width, i = value, end
+			}
+		}
+		if i >= len(format) {
+			return "", unterminated
+		}
+
+		specifier := format[i]
+		if specifier != 's' && specifier != 'I' && specifier != 'L' {
+			return "", fmt.Errorf("unrecognized format() type specifier \"%c\"", specifier)
+		}
+		arg, err := argument(position)
+		if err != nil {
+			return "", err
+		}
+		var formatted string
+		switch {
+		case specifier == 's' && arg != nil:
+			formatted = OutputDatum(arg, settings)
+		case specifier == 'I':
+			if arg == nil {
+				return "", fmt.Errorf("null values cannot be formatted as an SQL identifier")
+			}
+			formatted = quoteIdent(OutputDatum(arg, settings))
+		case specifier == 'L':
+			formatted = "NULL"
+			if arg != nil {
+				formatted = quoteLiteral(OutputDatum(arg, settings))
+			}
+		}
+		padding := strings.Repeat(" ", max(width-utf8.RuneCountInString(formatted), 0))
+		if leftAlign {
+			sb.WriteString(formatted + padding)
+		} else {
+			sb.WriteString(padding + formatted)
+		}
+	}
+	return sb.String(), nil
+}
+
+// quoteIdent double quotes an identifier unless it is a plain lower case name
+func quoteIdent(ident string) string {
+	plain := ident != ""
+	for i, c := range ident {
+		if !(c >= 'a' && c <= 'z' || c == '_' || i > 0 && (c >= '0' && c <= '9' || c == '$')) {
+			plain = false
+			break
+		}
+	}
+	if plain {
+		return ident
+	}
+	return "\"" + strings.ReplaceAll(ident, "\"", "\"\"") + "\""
+}
+
+// quoteLiteral single quotes a string, one with backslashes becomes an E string with them doubled
+func quoteLiteral(str string) string {
+	quoted := "'" + strings.ReplaceAll(str, "'", "''") + "'"
+	if strings.Contains(str, "\\") {
+		return "E" + strings.ReplaceAll(quoted, "\\", "\\\\")
+	}
+	return quoted
+}
+
+func init() {
+	const (
+		text    = types.TEXTOID
+		int8    = types.INT8OID
+		anyType = types.ANYOID
+	)
+
+	addFunction("length", []types.Oid{text}, int8, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		return int64(utf8.RuneCountInString(fcinfo.Args[0].(string))), nil
+	})
+	addFunction("char_length", []types.Oid{text}, int8, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		return int64(utf8.RuneCountInString(fcinfo.Args[0].(string))), nil
+	})
+	addFunction("octet_length", []types.Oid{text}, int8, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		return int64(len(fcinfo.Args[0].(string))), nil
+	})
+
+	addFunction("substring", []types.Oid{text, int8}, text, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		return textSubstring(fcinfo.Args[0].(string), fcinfo.Args[1].(int64), -1), nil
+	})
+	addFunction("substring", []types.Oid{text, int8, int8}, text, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		if fcinfo.Args[2].(int64) < 0 {
+			return nil, fmt.Errorf("negative substring length not allowed")
+		}
+		return textSubstring(fcinfo.Args[0].(string), fcinfo.Args[1].(int64), fcinfo.Args[2].(int64)), nil
+	})
+	position := func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		return textPosition(fcinfo.Args[0].(string), fcinfo.Args[1].(string)), nil
+	}
+	addFunction("position", []types.Oid{text, text}, int8, position)
+	addFunction("strpos", []types.Oid{text, text}, int8, position)
+
+	//overlay(str, replacement, start, count) puts replacement in the place of count characters from start on
+	overlay := func(str string, replacement string, start int64, count int64) (types.Datum, error) {
+		if start < 1 || count < 0 {
+			return nil, fmt.Errorf("negative substring length not allowed")
+		}
+		return textSubstring(str, 1, start-1) + replacement + textSubstring(str, start+count, -1), nil
+	}
+	addFunction("overlay", []types.Oid{text, text, int8, int8}, text, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		return overlay(fcinfo.Args[0].(string), fcinfo.Args[1].(string), fcinfo.Args[2].(int64), fcinfo.Args[3].(int64))
+	})
+	addFunction("overlay", []types.Oid{text, text, int8}, text, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		replacement := fcinfo.Args[1].(string)
+		return overlay(fcinfo.Args[0].(string), replacement, fcinfo.Args[2].(int64), int64(utf8.RuneCountInString(replacement)))
+	})
+
+	addFunction("replace", []types.Oid{text, text, text}, text, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		str, from := fcinfo.Args[0].(string), fcinfo.Args[1].(string)
+		if from == "" {
+			return str, nil
+		}
+		return strings.ReplaceAll(str, from, fcinfo.Args[2].(string)), nil
+	})
+	addFunction("split_part", []types.Oid{text, text, int8}, text, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		part, err := splitPart(fcinfo.Args[0].(string), fcinfo.Args[1].(string), fcinfo.Args[2].(int64))
+		if err != nil {
+			return nil, err
+		}
+		return part, nil
+	})
+
+	//concat and concat_ws take values of any type in their text form and skip NULLs
+	addFunction("concat", []types.Oid{anyType}, text, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		var sb strings.Builder
+		for _, arg := range fcinfo.Args {
+			if arg != nil {
+				sb.WriteString(OutputDatum(arg, fcinfo.Settings))
+			}
+		}
+		return sb.String(), nil
+	}).setVariadic().Strict = false
+	addFunction("concat_ws", []types.Oid{text, anyType}, text, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		if fcinfo.Args[0] == nil {
+			return nil, nil
+		}
+		var parts []string
+		for _, arg := range fcinfo.Args[1:] {
+			if arg != nil {
+				parts = append(parts, OutputDatum(arg, fcinfo.Settings))
+			}
+		}
+		return strings.Join(parts, fcinfo.Args[0].(string)), nil
+	}).setVariadic().Strict = false
+
+	addFunction("format", []types.Oid{text}, text, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		result, err := textFormat(fcinfo.Args[0].(string), nil, fcinfo.Settings)
+		if err != nil {
+			return nil, err
+		}
+		return result, nil
+	})
+	addFunction("format", []types.Oid{text, anyType}, text, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		if fcinfo.Args[0] == nil {
+			return nil, nil
+		}
+		result, err := textFormat(fcinfo.Args[0].(string), fcinfo.Args[1:], fcinfo.Settings)
+		if err != nil {
+			return nil, err
+		}
+		return result, nil
+	}).setVariadic().Strict = false
+	addFunction("quote_ident", []types.Oid{text}, text, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		return quoteIdent(fcinfo.Args[0].(string)), nil
+	})
+	addFunction("quote_literal", []types.Oid{text}, text, func(fcinfo *FunctionCallInfo) (types.Datum, error) {
+		return quoteLiteral(fcinfo.Args[0].(string)), nil
+	})
+}
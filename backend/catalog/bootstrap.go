@@ -0,0 +1,178 @@
+package catalog
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/rautNishan/diskquery/adt"
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+Bootstrap (postgres initdb and bootstrap mode)
+
+The first time the catalogs are needed after the server starts their files are written again: the rows of
+what the server build has (the catalogs themselves, namespaces, builtin types, functions and views, all with oids
+below FirstNormalObjectId) come from the code, the rows of objects users made are kept from the files.
+Builtin function oids follow the order they are registered in, rewriting the builtin rows at every start
+keeps pg_proc right for the build that is running. Without a pg_class file this is a new data directory
+and the sample relation "data" is made as the first user object
+
+The oid counter starts after the highest oid in use. Postgres keeps it in pg_control and never hands out
+an oid twice, ours can give a dropped relation's oid again after a restart
+*/
+
+var (
+	bootstrapped bool
+	nextOid      types.Oid
+)
+
+// getNewOid allocates an oid for a new object, the caller holds catalogLock
+func getNewOid() types.Oid {
+	oid := nextOid
+	nextOid++
+	return oid
+}
+
+func bootstrap() error {
+	if bootstrapped {
+		return nil
+	}
+	for _, dir := range []string{globalDir, baseDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("could not create directory \"%s\": %v", dir, err)
+		}
+	}
+	_, err := os.Stat(pgClass.FilePath)
+	initdb := os.IsNotExist(err)
+
+	userRows := make(map[*Relation][]types.Tuple, len(systemCatalogs))
+	for _, cat := range systemCatalogs {
+		rows, err := readHeap(cat)
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			if rowOid(row) >= FirstNormalObjectId {
+				userRows[cat] = append(userRows[cat], row)
+			}
+		}
+	}
+	if initdb {
+		data := &Relation{
+			Relid:        FirstNormalObjectId,
+			Relname:      "data",
+			Relnamespace: PG_PUBLIC_NAMESPACE,
+			Relkind:      RELKIND_RELATION,
+			FilePath:     "./data.txt",
+			Columns: []Column{
+				{Name: "id", TypeOid: types.INT8OID},
+				{Name: "data", TypeOid: types.TEXTOID},
+			},
+		}
+		userRows[pgClass] = append(userRows[pgClass], classRow(data))
+		userRows[pgAttribute] = append(userRows[pgAttribute], attributeRows(data)...)
+	}
+
+	//Columns and indexes of relations whose pg_class row is not there, left by a CREATE or DROP that did not finish
+	relids := make(map[types.Oid]bool)
+	for _, row := range userRows[pgClass] {
+		relids[rowOid(row)] = true
+	}
+	for _, cat := range []*Relation{pgAttribute, pgIndex} {
+		kept := userRows[cat][:0]
+		for _, row := range userRows[cat] {
+			if relids[rowOid(row)] {
+				kept = append(kept, row)
+			}
+		}
+		userRows[cat] = kept
+	}
+
+	nextOid = FirstNormalObjectId
+	for _, rows := range userRows {
+		for _, row := range rows {
+			if oid := rowOid(row); oid >= nextOid {
+				nextOid = oid + 1
+			}
+		}
+	}
+
+	for _, cat := range systemCatalogs {
+		if err := writeHeap(cat, append(builtinRows(cat), userRows[cat]...)); err != nil {
+			return err
+		}
+	}
+	bootstrapped = true
+	return nil
+}
+
+func attributeRows(rel *Relation) []types.Tuple {
+	rows := make([]types.Tuple, len(rel.Columns))
+	for i, col := range rel.Columns {
+		storage := col.Storage
+		if storage == 0 {
+			storage = adt.LookupType(col.TypeOid).Storage
+		}
+		rows[i] = types.Tuple{int64(rel.Relid), col.Name, int64(col.TypeOid), int64(i + 1), int64(col.Typmod), col.NotNull, string(storage)}
+	}
+	return rows
+}
+
+// formOidVector prints a list of oids the way postgres prints an oidvector, separated by spaces
+func formOidVector(oids []types.Oid) string {
+	fields := make([]string, len(oids))
+	for i, oid := range oids {
+		fields[i] = strconv.FormatUint(uint64(oid), 10)
+	}
+	return strings.Join(fields, " ")
+}
+
+// builtinRows are the rows of a catalog for what the server build has
+func builtinRows(cat *Relation) []types.Tuple {
+	var rows []types.Tuple
+	switch cat {
+	case pgNamespace:
+		rows = append(rows,
+			types.Tuple{int64(PG_CATALOG_NAMESPACE), "pg_catalog"},
+			types.Tuple{int64(PG_PUBLIC_NAMESPACE), "public"},
+			types.Tuple{int64(INFORMATION_SCHEMA_NAMESPACE), "information_schema"},
+		)
+	case pgClass:
+		for _, sys := range systemCatalogs {
+			rows = append(rows, classRow(sys))
+		}
+		for _, view := range systemViews {
+			rows = append(rows, classRow(&Relation{Relid: view.oid, Relname: view.name, Relnamespace: view.namespace, Relkind: RELKIND_VIEW}))
+		}
+	case pgRewrite:
+		for _, view := range systemViews {
+			rows = append(rows, types.Tuple{int64(view.oid + rewriteOidOffset), int64(view.oid), view.viewDefinition()})
+		}
+	case pgAttribute:
+		for _, sys := range systemCatalogs {
+			rows = append(rows, attributeRows(sys)...)
+		}
+	case pgType:
+		for _, entry := range adt.AllTypes() {
+			rows = append(rows, types.Tuple{
+				int64(entry.Oid), adt.TypeInternalName(entry.Oid), int64(PG_CATALOG_NAMESPACE), int64(entry.Len),
+				string(entry.Category), entry.Preferred, int64(entry.ElemType), int64(entry.ArrayType), string(entry.Storage),
+			})
+		}
+	case pgProc:
+		for _, proc := range adt.AllFunctions() {
+			var variadic types.Oid
+			if proc.Variadic {
+				variadic = proc.ArgTypes[len(proc.ArgTypes)-1]
+			}
+			rows = append(rows, types.Tuple{
+				int64(proc.Oid), proc.Name, int64(PG_CATALOG_NAMESPACE), proc.Strict, proc.Retset,
+				int64(variadic), int64(proc.ResultType), formOidVector(proc.ArgTypes),
+			})
+		}
+	}
+	return rows
+}
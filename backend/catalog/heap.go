@@ -0,0 +1,254 @@
+package catalog
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/rautNishan/diskquery/access"
+	"github.com/rautNishan/diskquery/adt"
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+Reading and writing the rows of a relation file, and making and removing relations (postgres catalog/heap.c)
+
+The file format is the one SeqScan reads: a row per line, columns separated by ',' where the last column
+gets the rest of the line, \N for NULL. Names go in the middle of catalog rows so they cannot contain a comma
+
+There are no transactions yet, each DDL statement is atomic on its own. Rows are added to a catalog with
+access.HeapInsert, into the space of removed rows its free space map finds or at the end of the file, and
+removed with access.HeapDelete, which blanks them out with line breaks. Changing rows in place (ALTER TABLE
+SET STORAGE) and bootstrap write a new file and rename it over the old one. The catalogs are changed in an
+order that leaves only unreferenced rows behind when we stop in between: a relation's pg_attribute rows (an
+index's pg_index row) are written before its pg_class row and removed after it. Bootstrap drops such
+orphaned rows
+*/
+
+// readHeap returns the rows of a relation, a relation whose file does not exist yet has none
+func readHeap(rel *Relation) ([]types.Tuple, error) {
+	file, err := os.Open(rel.FilePath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not open file for relation \"%s\": %v", rel.Relname, err)
+	}
+	defer file.Close()
+
+	var rows []types.Tuple
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		fields := strings.SplitN(line, ",", len(rel.Columns))
+		row := make(types.Tuple, len(rel.Columns))
+		for i, field := range fields {
+			if field == `\N` {
+				continue
+			}
+			if row[i], err = adt.InputDatum(rel.Columns[i].TypeOid, field, &adt.DefaultSettings); err != nil {
+				return nil, fmt.Errorf("relation \"%s\" line %d: %v", rel.Relname, lineNo, err)
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, scanner.Err()
+}
+
+func formHeapLine(row types.Tuple) string {
+	fields := make([]string, len(row))
+	for i, value := range row {
+		if value == nil {
+			fields[i] = `\N`
+		} else {
+			fields[i] = adt.OutputDatum(value, &adt.DefaultSettings)
+		}
+	}
+	return strings.Join(fields, ",") + "\n"
+}
+
+// appendHeap adds rows to a relation's file, into the free space of rows deleted before or at its end
+func appendHeap(rel *Relation, rows []types.Tuple) error {
+	lines := make([]string, len(rows))
+	for i, row := range rows {
+		lines[i] = strings.TrimSuffix(formHeapLine(row), "\n")
+	}
+	_, err := access.HeapInsert(rel.FilePath, rel.Relname, lines)
+	return err
+}
+
+// writeHeap replaces the rows of a relation, a reader sees either all of the old rows or all of the new ones
+func writeHeap(rel *Relation, rows []types.Tuple) error {
+	tmpPath := rel.FilePath + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("could not create file for relation \"%s\": %v", rel.Relname, err)
+	}
+	writer := bufio.NewWriter(file)
+	for _, row := range rows {
+		writer.WriteString(formHeapLine(row))
+	}
+	if err := writer.Flush(); err == nil {
+		err = file.Sync()
+	}
+	if err != nil {
+		file.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("could not write to relation \"%s\": %v", rel.Relname, err)
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, rel.FilePath)
+}
+
+// deleteHeapRows removes the rows of a relation whose first column is one of oids, leaving free space where they were
+func deleteHeapRows(rel *Relation, oids ...types.Oid) error {
+	deleted := make(map[types.Oid]bool, len(oids))
+	for _, oid := range oids {
+		deleted[oid] = true
+	}
+	if _, err := os.Stat(rel.FilePath); os.IsNotExist(err) {
+		return nil
+	}
+	scan, err := access.HeapBeginScan(rel.FilePath, rel.Relname)
+	if err != nil {
+		return err
+	}
+	var tids []access.ItemPointer
+	for {
+		line, offset, length, ok, err := scan.Next()
+		if err != nil {
+			scan.End()
+			return fmt.Errorf("could not read relation \"%s\": %v", rel.Relname, err)
+		}
+		if !ok {
+			break
+		}
+		first, _, _ := strings.Cut(line, ",")
+		if oid, err := strconv.ParseInt(first, 10, 64); err == nil && deleted[types.Oid(oid)] {
+			tids = append(tids, access.ItemPointer{Offset: offset, Length: length})
+		}
+	}
+	if err := scan.End(); err != nil {
+		return err
+	}
+	if len(tids) == 0 {
+		return nil
+	}
+	return access.HeapDelete(rel.FilePath, rel.Relname, tids, true)
+}
+
+func rowOid(row types.Tuple) types.Oid {
+	if oid, ok := row[0].(int64); ok {
+		return types.Oid(oid)
+	}
+	return types.InvalidOid
+}
+
+// attribute is a column of a relation being made, what its pg_attribute row holds
+type attribute struct {
+	name    string
+	typeOid types.Oid
+	typmod  int32
+	notNull bool
+	storage byte
+}
+
+func checkName(kind string, name string) error {
+	if strings.ContainsAny(name, ",\n") {
+		return fmt.Errorf("invalid %s name \"%s\": names cannot contain a comma or a line break", kind, name)
+	}
+	return nil
+}
+
+/*
+heapCreateWithCatalog makes a table: an empty file for its rows, its pg_attribute rows and its pg_class row
+relam is its table access method
+The caller holds catalogLock and has checked the name is free
+*/
+func heapCreateWithCatalog(relname string, relnamespace types.Oid, attrs []attribute, relam string) (*Relation, error) {
+	relid := getNewOid()
+	rel := &Relation{
+		Relid:        relid,
+		Relname:      relname,
+		Relnamespace: relnamespace,
+		Relkind:      RELKIND_RELATION,
+		FilePath:     baseDir + "/" + strconv.FormatUint(uint64(relid), 10) + ".txt",
+		Relam:        relam,
+	}
+	file, err := os.OpenFile(rel.FilePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("could not create file \"%s\": %v", rel.FilePath, err)
+	}
+	file.Close()
+
+	attRows := make([]types.Tuple, len(attrs))
+	for i, attr := range attrs {
+		attRows[i] = types.Tuple{int64(relid), attr.name, int64(attr.typeOid), int64(i + 1), int64(attr.typmod), attr.notNull, string(attr.storage)}
+		rel.Columns = append(rel.Columns, Column{Name: attr.name, TypeOid: attr.typeOid, Typmod: attr.typmod, NotNull: attr.notNull, Storage: attr.storage})
+	}
+	if err := appendHeap(pgAttribute, attRows); err != nil {
+		return nil, err
+	}
+	if err := appendHeap(pgClass, []types.Tuple{classRow(rel)}); err != nil {
+		return nil, err
+	}
+	invalidateRelcache()
+	return rel, nil
+}
+
+func classRow(rel *Relation) types.Tuple {
+	var relam types.Datum
+	if rel.Relkind == RELKIND_RELATION {
+		relam = tableAm(rel)
+	}
+	return types.Tuple{int64(rel.Relid), rel.Relname, int64(rel.Relnamespace), string(rel.Relkind), int64(len(rel.Columns)), rel.FilePath, relam}
+}
+
+// tableAm is the access method of a table, the system catalogs and the tables made before relam was added are heap tables
+func tableAm(rel *Relation) string {
+	if rel.Relam == "" {
+		return access.HEAP_TABLE_AM_NAME
+	}
+	return rel.Relam
+}
+
+// heapDropWithCatalog removes the pg_class rows of a table and its indexes, then their other rows and their files
+func heapDropWithCatalog(rel *Relation) error {
+	relids := []types.Oid{rel.Relid}
+	files := []string{rel.FilePath, access.ToastPath(rel.FilePath), access.ColumnarPath(rel.FilePath),
+		access.FreeSpaceMapPath(rel.FilePath), access.VisibilityMapPath(rel.FilePath)}
+	for _, index := range rel.Indexes {
+		relids = append(relids, index.Indexrelid)
+		files = append(files, index.FilePath)
+	}
+	if err := deleteHeapRows(pgClass, relids...); err != nil {
+		return err
+	}
+	invalidateRelcache()
+	if err := deleteHeapRows(pgAttribute, rel.Relid); err != nil {
+		return err
+	}
+	if len(rel.Indexes) > 0 {
+		if err := deleteHeapRows(pgIndex, relids[1:]...); err != nil {
+			return err
+		}
+	}
+	return removeRelationFiles(files...)
+}
+
+func removeRelationFiles(paths ...string) error {
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("could not remove file \"%s\": %v", path, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package catalog
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+Making and removing indexes (postgres catalog/index.c)
+
+An index is a pg_class row of kind 'i', a pg_index row and a file in base named by its oid holding the
+index entries (package access writes and reads it). pg_index keeps the CREATE INDEX statement the index
+was made with, the planner analyzes it again to know the keys and the predicate, postgres keeps the
+analyzed expressions instead. The pg_index row is written before the pg_class row and removed after it
+*/
+
+// NAMEDATALEN - 1, the longest name postgres keeps, generated names are cut to it
+const maxIdentifierLength = 63
+
+/*
+IndexCreate makes an index named idxname on rel, build writes its entries to the file at the path it is
+given. A plain build holds catalogLock all the way through, no query can be planned and no DDL run until
+it is done. CONCURRENTLY lets go of the lock while building and checks again afterwards that the table is
+still there and the name still free
+*/
+func IndexCreate(rel *Relation, idxname string, unique bool, indkey []int, nkeyatts int, indexdef string,
+	concurrent bool, ifNotExists bool, build func(path string) error) error {
+	catalogLock.Lock()
+	locked := true
+	defer func() {
+		if locked {
+			catalogLock.Unlock()
+		}
+	}()
+	if err := loadRelcache(); err != nil {
+		return err
+	}
+	if err := checkName("relation", idxname); err != nil {
+		return err
+	}
+	if _, exists := relcache.relations[relcacheKey{rel.Relnamespace, idxname}]; exists {
+		if ifNotExists {
+			return nil
+		}
+		return fmt.Errorf("relation \"%s\" already exists", idxname)
+	}
+
+	indexrelid := getNewOid()
+	path := baseDir + "/" + strconv.FormatUint(uint64(indexrelid), 10) + ".txt"
+	if concurrent {
+		catalogLock.Unlock()
+		locked = false
+	}
+	err := build(path)
+	if concurrent {
+		catalogLock.Lock()
+		locked = true
+		if err == nil {
+			err = loadRelcache()
+		}
+		if err == nil {
+			if table := relcache.relations[relcacheKey{rel.Relnamespace, rel.Relname}]; table == nil || table.Relid != rel.Relid {
+				err = fmt.Errorf("relation \"%s\" was dropped while its index \"%s\" was being built", rel.Relname, idxname)
+			} else if _, exists := relcache.relations[relcacheKey{rel.Relnamespace, idxname}]; exists {
+				err = fmt.Errorf("relation \"%s\" already exists", idxname)
+			}
+		}
+	}
+	if err != nil {
+		removeRelationFiles(path)
+		return err
+	}
+
+	keys := make([]string, len(indkey))
+	for i, attnum := range indkey {
+		keys[i] = strconv.Itoa(attnum)
+	}
+	indexRow := types.Tuple{int64(indexrelid), int64(rel.Relid), int64(len(indkey)), int64(nkeyatts), unique, strings.Join(keys, " "), indexdef}
+	if err := appendHeap(pgIndex, []types.Tuple{indexRow}); err != nil {
+		return err
+	}
+	classRow := types.Tuple{int64(indexrelid), idxname, int64(rel.Relnamespace), string(RELKIND_INDEX), int64(len(indkey)), path}
+	if err := appendHeap(pgClass, []types.Tuple{classRow}); err != nil {
+		return err
+	}
+	invalidateRelcache()
+	return nil
+}
+
+// indexDrop removes an index's pg_class row, then its pg_index row and its file
+func indexDrop(index *Index) error {
+	if err := deleteHeapRows(pgClass, index.Indexrelid); err != nil {
+		return err
+	}
+	invalidateRelcache()
+	if err := deleteHeapRows(pgIndex, index.Indexrelid); err != nil {
+		return err
+	}
+	return removeRelationFiles(index.FilePath)
+}
+
+/*
+ChooseRelationName picks a name for an object the user did not name: name1_name2_label, with a number
+added to the label until no relation of the namespace has it (postgres ChooseRelationName).
+The parts are shortened to keep the name within 63 bytes
+*/
+func ChooseRelationName(name1 string, name2 string, label string, namespace types.Oid) (string, error) {
+	catalogLock.Lock()
+	defer catalogLock.Unlock()
+	if err := loadRelcache(); err != nil {
+		return "", err
+	}
+	for pass := 0; ; pass++ {
+		suffix := label
+		if pass > 0 {
+			suffix = label + strconv.Itoa(pass)
+		}
+		name := makeObjectName(name1, name2, suffix)
+		if _, exists := relcache.relations[relcacheKey{namespace, name}]; !exists {
+			return name, nil
+		}
+	}
+}
+
+// makeObjectName joins the non empty parts with '_', cutting the longer of name1 and name2 until it fits
+func makeObjectName(name1 string, name2 string, label string) string {
+	overhead := 0
+	if label != "" {
+		overhead = len(label) + 1
+	}
+	if name2 != "" {
+		overhead++
+	}
+	for len(name1)+len(name2)+overhead > maxIdentifierLength {
+		if len(name1) > len(name2) {
+			_, size := utf8.DecodeLastRuneInString(name1)
+			name1 = name1[:len(name1)-size]
+		} else {
+			_, size := utf8.DecodeLastRuneInString(name2)
+			name2 = name2[:len(name2)-size]
+		}
+	}
+	var parts []string
+	for _, part := range []string{name1, name2, label} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, "_")
+}
@@ -0,0 +1,133 @@
+package catalog
+
+import (
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+The system catalogs (postgres include/catalog/pg_*.h)
+
+They are ordinary relations stored like any other, what differs is that their own descriptions are compiled in
+here: to read pg_class we have to know its columns before we have read pg_class. Their files are in the
+global directory, tables made by CREATE TABLE get a file in base named by their oid
+
+Columns holding an oid are bigint until we have the oid type, a list of oids (proargtypes) is text with the
+oids separated by spaces as postgres prints an oidvector. Flags postgres keeps as "char" are one letter text
+*/
+
+// Oids of the system catalogs, the same as postgres'
+const (
+	ConstraintRelationId types.Oid = 2606
+	IndexRelationId      types.Oid = 2610
+	NamespaceRelationId  types.Oid = 2615
+	TypeRelationId       types.Oid = 1247
+	AttributeRelationId  types.Oid = 1249
+	ProcedureRelationId  types.Oid = 1255
+	RelationRelationId   types.Oid = 1259
+	RewriteRelationId    types.Oid = 2618
+)
+
+const (
+	PG_CATALOG_NAMESPACE types.Oid = 11
+	PG_PUBLIC_NAMESPACE  types.Oid = 2200
+)
+
+/*
+Oids below FirstNormalObjectId belong to the server build (the catalogs, builtin types, functions and views)
+and are written by bootstrap, objects users create are numbered from here
+*/
+const FirstNormalObjectId types.Oid = 16384
+
+const (
+	globalDir = "./global"
+	baseDir   = "./base"
+)
+
+// Namespaces searched for an unqualified name, in order
+var searchPath = []types.Oid{PG_CATALOG_NAMESPACE, PG_PUBLIC_NAMESPACE}
+
+func systemCatalog(relid types.Oid, relname string, columns ...Column) *Relation {
+	for i := range columns {
+		columns[i].Typmod = -1
+	}
+	return &Relation{
+		Relid:        relid,
+		Relname:      relname,
+		Relnamespace: PG_CATALOG_NAMESPACE,
+		Relkind:      RELKIND_RELATION,
+		FilePath:     globalDir + "/" + relname + ".txt",
+		Columns:      columns,
+	}
+}
+
+var (
+	pgNamespace = systemCatalog(NamespaceRelationId, "pg_namespace",
+		Column{Name: "oid", TypeOid: types.INT8OID},
+		Column{Name: "nspname", TypeOid: types.TEXTOID},
+	)
+	pgClass = systemCatalog(RelationRelationId, "pg_class",
+		Column{Name: "oid", TypeOid: types.INT8OID},
+		Column{Name: "relname", TypeOid: types.TEXTOID},
+		Column{Name: "relnamespace", TypeOid: types.INT8OID},
+		Column{Name: "relkind", TypeOid: types.TEXTOID},
+		Column{Name: "relnatts", TypeOid: types.INT8OID},
+		Column{Name: "relpath", TypeOid: types.TEXTOID}, //Our own, where the rows are (postgres derives it from relfilenode)
+		Column{Name: "relam", TypeOid: types.TEXTOID},   //Table access method by name, postgres has the oid of its pg_am row
+	)
+	pgAttribute = systemCatalog(AttributeRelationId, "pg_attribute",
+		Column{Name: "attrelid", TypeOid: types.INT8OID},
+		Column{Name: "attname", TypeOid: types.TEXTOID},
+		Column{Name: "atttypid", TypeOid: types.INT8OID},
+		Column{Name: "attnum", TypeOid: types.INT8OID},
+		Column{Name: "atttypmod", TypeOid: types.INT8OID},
+		Column{Name: "attnotnull", TypeOid: types.BOOLOID},
+		Column{Name: "attstorage", TypeOid: types.TEXTOID},
+	)
+	pgType = systemCatalog(TypeRelationId, "pg_type",
+		Column{Name: "oid", TypeOid: types.INT8OID},
+		Column{Name: "typname", TypeOid: types.TEXTOID},
+		Column{Name: "typnamespace", TypeOid: types.INT8OID},
+		Column{Name: "typlen", TypeOid: types.INT8OID},
+		Column{Name: "typcategory", TypeOid: types.TEXTOID},
+		Column{Name: "typispreferred", TypeOid: types.BOOLOID},
+		Column{Name: "typelem", TypeOid: types.INT8OID},
+		Column{Name: "typarray", TypeOid: types.INT8OID},
+		Column{Name: "typstorage", TypeOid: types.TEXTOID},
+	)
+	pgProc = systemCatalog(ProcedureRelationId, "pg_proc",
+		Column{Name: "oid", TypeOid: types.INT8OID},
+		Column{Name: "proname", TypeOid: types.TEXTOID},
+		Column{Name: "pronamespace", TypeOid: types.INT8OID},
+		Column{Name: "proisstrict", TypeOid: types.BOOLOID},
+		Column{Name: "proretset", TypeOid: types.BOOLOID},
+		Column{Name: "provariadic", TypeOid: types.INT8OID},
+		Column{Name: "prorettype", TypeOid: types.INT8OID},
+		Column{Name: "proargtypes", TypeOid: types.TEXTOID},
+	)
+	pgIndex = systemCatalog(IndexRelationId, "pg_index",
+		Column{Name: "indexrelid", TypeOid: types.INT8OID},
+		Column{Name: "indrelid", TypeOid: types.INT8OID},
+		Column{Name: "indnatts", TypeOid: types.INT8OID}, //Keys and INCLUDE columns
+		Column{Name: "indnkeyatts", TypeOid: types.INT8OID},
+		Column{Name: "indisunique", TypeOid: types.BOOLOID},
+		Column{Name: "indkey", TypeOid: types.TEXTOID},   //Column numbers of the keys then the INCLUDE columns, 0 for an expression
+		Column{Name: "indexdef", TypeOid: types.TEXTOID}, //Our own, the CREATE INDEX statement (postgres keeps the analyzed trees)
+	)
+	pgConstraint = systemCatalog(ConstraintRelationId, "pg_constraint",
+		Column{Name: "oid", TypeOid: types.INT8OID},
+		Column{Name: "conname", TypeOid: types.TEXTOID},
+		Column{Name: "connamespace", TypeOid: types.INT8OID},
+		Column{Name: "contype", TypeOid: types.TEXTOID},
+		Column{Name: "conrelid", TypeOid: types.INT8OID},
+		Column{Name: "conkey", TypeOid: types.TEXTOID},
+	)
+	pgRewrite = systemCatalog(RewriteRelationId, "pg_rewrite",
+		Column{Name: "oid", TypeOid: types.INT8OID},
+		Column{Name: "ev_class", TypeOid: types.INT8OID},
+		Column{Name: "ev_action", TypeOid: types.TEXTOID}, //The view's query as SQL text
+	)
+)
+
+// Catalogs in the order bootstrap writes them, the first column of each row is the object's oid (for
+// pg_attribute the oid of the relation the column belongs to, for pg_index the index's)
+var systemCatalogs = []*Relation{pgNamespace, pgClass, pgAttribute, pgType, pgProc, pgIndex, pgConstraint, pgRewrite}
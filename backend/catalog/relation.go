@@ -0,0 +1,163 @@
+package catalog
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/rautNishan/diskquery/adt"
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+Relations are what pg_class and pg_attribute say they are, OpenRelation answers from the relation cache
+which is filled from those catalogs (see relcache.go)
+Every relation is a text file with one row per line and columns separated by ',', the system catalogs too
+*/
+
+// Relation kinds, same letters as postgres relkind
+const (
+	RELKIND_RELATION byte = 'r'
+	RELKIND_VIEW     byte = 'v'
+	RELKIND_INDEX    byte = 'i'
+)
+
+type Column struct {
+	Name    string
+	TypeOid types.Oid
+	Typmod  int32 //atttypmod, -1 without a type modifier
+	NotNull bool
+	Storage byte //attstorage, one of adt.TYPSTORAGE_*
+}
+
+type Relation struct {
+	Relid        types.Oid
+	Relname      string
+	Relnamespace types.Oid
+	Relkind      byte
+	FilePath     string
+	Relam        string //Table access method of a table, empty for other relations
+	Columns      []Column
+	ViewQuery    string   //SQL of a view's query, from pg_rewrite
+	Indexes      []*Index //Indexes of a table, from pg_index
+}
+
+// Index is what pg_index says about an index of a table
+type Index struct {
+	Indexrelid types.Oid
+	Indrelid   types.Oid
+	Name       string
+	Unique     bool
+	FilePath   string
+	Indexdef   string //The CREATE INDEX statement, the planner reads the keys and the predicate from it
+}
+
+/*
+OpenRelation looks up a relation by name, an unqualified name is searched for in pg_catalog and then in
+public (postgres' search_path with the default setting)
+*/
+func OpenRelation(schemaname string, relname string) (*Relation, error) {
+	catalogLock.Lock()
+	defer catalogLock.Unlock()
+	if err := loadRelcache(); err != nil {
+		return nil, err
+	}
+	return lookupRelation(schemaname, relname)
+}
+
+// lookupRelation finds a relation in the relation cache, the caller holds catalogLock and has loaded it
+func lookupRelation(schemaname string, relname string) (*Relation, error) {
+	if schemaname != "" {
+		nspid, ok := relcache.namespaces[schemaname]
+		if !ok {
+			return nil, fmt.Errorf("schema \"%s\" does not exist", schemaname)
+		}
+		rel, ok := relcache.relations[relcacheKey{nspid, relname}]
+		if !ok {
+			return nil, fmt.Errorf("relation \"%s.%s\" does not exist", schemaname, relname)
+		}
+		return rel, nil
+	}
+	for _, nspid := range searchPath {
+		if rel, ok := relcache.relations[relcacheKey{nspid, relname}]; ok {
+			return rel, nil
+		}
+	}
+	return nil, fmt.Errorf("relation \"%s\" does not exist", relname)
+}
+
+// RelationIdGetRelation returns the relation with oid relid as the catalogs have it now, nil if there is none
+func RelationIdGetRelation(relid types.Oid) (*Relation, error) {
+	catalogLock.Lock()
+	defer catalogLock.Unlock()
+	if err := loadRelcache(); err != nil {
+		return nil, err
+	}
+	return relcache.byOid[relid], nil
+}
+
+// NamespaceName returns the name of a namespace, empty if there is none
+func NamespaceName(nspid types.Oid) (string, error) {
+	catalogLock.Lock()
+	defer catalogLock.Unlock()
+	if err := loadRelcache(); err != nil {
+		return "", err
+	}
+	for name, oid := range relcache.namespaces {
+		if oid == nspid {
+			return name, nil
+		}
+	}
+	return "", nil
+}
+
+func init() {
+	adt.RegclassLookup = func(schemaname string, relname string) (types.Oid, error) {
+		rel, err := OpenRelation(schemaname, relname)
+		if err != nil {
+			return types.InvalidOid, err
+		}
+		return rel.Relid, nil
+	}
+	adt.RegclassName = regclassName
+}
+
+// regclassName is the name of a relation, qualified by its schema when that is not on the search path
+func regclassName(relid types.Oid) (string, bool) {
+	catalogLock.Lock()
+	defer catalogLock.Unlock()
+	if err := loadRelcache(); err != nil {
+		return "", false
+	}
+	rel := relcache.byOid[relid]
+	if rel == nil {
+		return "", false
+	}
+	for _, nspid := range searchPath {
+		if nspid == rel.Relnamespace {
+			return rel.Relname, true
+		}
+	}
+	for name, nspid := range relcache.namespaces {
+		if nspid == rel.Relnamespace {
+			return name + "." + rel.Relname, true
+		}
+	}
+	return rel.Relname, true
+}
+
+// UserTables returns the tables made by CREATE TABLE in the order they were made, what VACUUM goes through
+func UserTables() ([]*Relation, error) {
+	catalogLock.Lock()
+	defer catalogLock.Unlock()
+	if err := loadRelcache(); err != nil {
+		return nil, err
+	}
+	var tables []*Relation
+	for _, rel := range relcache.relations {
+		if rel.Relkind == RELKIND_RELATION && rel.Relid >= FirstNormalObjectId {
+			tables = append(tables, rel)
+		}
+	}
+	sort.Slice(tables, func(i, j int) bool { return tables[i].Relid < tables[j].Relid })
+	return tables, nil
+}
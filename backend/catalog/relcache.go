@@ -0,0 +1,144 @@
+package catalog
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/rautNishan/diskquery/adt"
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+Relation cache (postgres utils/cache/relcache.c)
+
+Planning a query looks relations up by name, reading pg_class and pg_attribute for each would make every
+query pay for it so the relations are kept in memory, built from the catalogs the first time one is needed.
+A DDL statement throws the cache away and the next lookup reads the catalogs again. Postgres backends
+are processes that each have their own cache and tell each other what changed with invalidation messages,
+our connections are goroutines sharing this one, dropping it is seen by all of them at once
+
+catalogLock serializes everything that reads or changes the catalogs through this package. A query keeps
+the *Relation it planned with, so a relation dropped while a query scans it fails that query when its file is gone
+*/
+
+var catalogLock sync.Mutex
+
+type relcacheKey struct {
+	namespace types.Oid
+	relname   string
+}
+
+var relcache struct {
+	valid      bool
+	namespaces map[string]types.Oid
+	relations  map[relcacheKey]*Relation
+	byOid      map[types.Oid]*Relation
+	indexes    map[types.Oid]*Index //pg_index rows by the index's oid
+}
+
+func invalidateRelcache() {
+	relcache.valid = false
+}
+
+func loadRelcache() error {
+	if relcache.valid {
+		return nil
+	}
+	if err := bootstrap(); err != nil {
+		return err
+	}
+
+	namespaceRows, err := readHeap(pgNamespace)
+	if err != nil {
+		return err
+	}
+	namespaces := make(map[string]types.Oid, len(namespaceRows))
+	for _, row := range namespaceRows {
+		namespaces[row[1].(string)] = rowOid(row)
+	}
+
+	classRows, err := readHeap(pgClass)
+	if err != nil {
+		return err
+	}
+	byOid := make(map[types.Oid]*Relation, len(classRows))
+	relations := make(map[relcacheKey]*Relation, len(classRows))
+	for _, row := range classRows {
+		rel := &Relation{
+			Relid:        rowOid(row),
+			Relname:      row[1].(string),
+			Relnamespace: types.Oid(row[2].(int64)),
+			Relkind:      row[3].(string)[0],
+			FilePath:     row[5].(string),
+		}
+		if rel.Relkind == RELKIND_RELATION {
+			rel.Relam, _ = row[6].(string)
+			rel.Relam = tableAm(rel)
+		}
+		byOid[rel.Relid] = rel
+		relations[relcacheKey{rel.Relnamespace, rel.Relname}] = rel
+	}
+
+	attributeRows, err := readHeap(pgAttribute)
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(attributeRows, func(i, j int) bool {
+		return attributeRows[i][3].(int64) < attributeRows[j][3].(int64)
+	})
+	for _, row := range attributeRows {
+		if rel := byOid[rowOid(row)]; rel != nil {
+			col := Column{Name: row[1].(string), TypeOid: types.Oid(row[2].(int64)), Typmod: -1}
+			if typmod, ok := row[4].(int64); ok {
+				col.Typmod = int32(typmod)
+			}
+			col.NotNull, _ = row[5].(bool)
+			//Rows written before attstorage was added do not have it
+			if storage, ok := row[6].(string); ok && storage != "" {
+				col.Storage = storage[0]
+			} else {
+				col.Storage = adt.LookupType(col.TypeOid).Storage
+			}
+			rel.Columns = append(rel.Columns, col)
+		}
+	}
+
+	rewriteRows, err := readHeap(pgRewrite)
+	if err != nil {
+		return err
+	}
+	for _, row := range rewriteRows {
+		if rel := byOid[types.Oid(row[1].(int64))]; rel != nil {
+			rel.ViewQuery = row[2].(string)
+		}
+	}
+
+	indexRows, err := readHeap(pgIndex)
+	if err != nil {
+		return err
+	}
+	indexes := make(map[types.Oid]*Index, len(indexRows))
+	for _, row := range indexRows {
+		indexRel, table := byOid[rowOid(row)], byOid[types.Oid(row[1].(int64))]
+		if indexRel == nil || table == nil {
+			continue
+		}
+		index := &Index{
+			Indexrelid: indexRel.Relid,
+			Indrelid:   table.Relid,
+			Name:       indexRel.Relname,
+			Unique:     row[4].(bool),
+			FilePath:   indexRel.FilePath,
+			Indexdef:   row[6].(string),
+		}
+		indexes[index.Indexrelid] = index
+		table.Indexes = append(table.Indexes, index)
+	}
+
+	relcache.namespaces = namespaces
+	relcache.relations = relations
+	relcache.byOid = byOid
+	relcache.indexes = indexes
+	relcache.valid = true
+	return nil
+}
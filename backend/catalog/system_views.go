@@ -0,0 +1,128 @@
+package catalog
+
+import (
+	"strings"
+
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+Views over the catalogs for tools that read the schema (postgres catalog/system_views.sql and
+information_schema.sql)
+
+A view is a pg_class row of kind 'v' and a pg_rewrite row holding its query, the planner reads it as that
+subquery. Postgres stores the analyzed query tree in pg_rewrite, we keep the SQL text and analyze it each
+time the view is used. The columns of a view are not in pg_attribute, they are what its query returns
+
+The first views were written before we could join and look up names with scalar subqueries. Only what the
+queries of ORMs and GUI tools most often ask for is there.
+
+We have no table constraints, only unique indexes. table_constraints and key_column_usage show a unique index
+on plain columns without a predicate as the UNIQUE constraint postgres would have made it for, and NOT NULL
+columns as the CHECK constraints postgres shows for them
+*/
+
+const INFORMATION_SCHEMA_NAMESPACE types.Oid = 13000
+
+type systemView struct {
+	oid       types.Oid
+	namespace types.Oid
+	name      string
+	query     string
+}
+
+var systemViews = []systemView{
+	{13001, INFORMATION_SCHEMA_NAMESPACE, "schemata", `
+		SELECT current_database() AS catalog_name, n.nspname AS schema_name
+		FROM pg_catalog.pg_namespace n`},
+	{13002, INFORMATION_SCHEMA_NAMESPACE, "tables", `
+		SELECT current_database() AS table_catalog,
+			(SELECT nspname FROM pg_catalog.pg_namespace n WHERE n.oid = c.relnamespace) AS table_schema,
+			c.relname AS table_name,
+			CASE c.relkind WHEN 'r' THEN 'BASE TABLE' WHEN 'v' THEN 'VIEW' END AS table_type
+		FROM pg_catalog.pg_class c
+		WHERE c.relkind IN ('r', 'v')`},
+	{13003, INFORMATION_SCHEMA_NAMESPACE, "columns", `
+		SELECT current_database() AS table_catalog,
+			(SELECT (SELECT nspname FROM pg_catalog.pg_namespace n WHERE n.oid = c.relnamespace)
+				FROM pg_catalog.pg_class c WHERE c.oid = a.attrelid) AS table_schema,
+			(SELECT relname FROM pg_catalog.pg_class c WHERE c.oid = a.attrelid) AS table_name,
+			a.attname AS column_name,
+			a.attnum AS ordinal_position,
+			NULL::text AS column_default,
+			CASE WHEN a.attnotnull THEN 'NO' ELSE 'YES' END AS is_nullable,
+			CASE WHEN (SELECT typcategory FROM pg_catalog.pg_type t WHERE t.oid = a.atttypid) = 'A' THEN 'ARRAY'
+				ELSE format_type(a.atttypid, NULL) END AS data_type,
+			CASE a.atttypid WHEN 21 THEN 16 WHEN 23 THEN 32 WHEN 20 THEN 64 WHEN 701 THEN 53
+				WHEN 1700 THEN CASE WHEN a.atttypmod >= 0 THEN (a.atttypmod - 4) / 65536 END END AS numeric_precision,
+			CASE a.atttypid WHEN 21 THEN 0 WHEN 23 THEN 0 WHEN 20 THEN 0
+				WHEN 1700 THEN CASE WHEN a.atttypmod >= 0 THEN (a.atttypmod - 4) % 65536 END END AS numeric_scale,
+			(SELECT typname FROM pg_catalog.pg_type t WHERE t.oid = a.atttypid) AS udt_name
+		FROM pg_catalog.pg_attribute a`},
+	{13004, INFORMATION_SCHEMA_NAMESPACE, "views", `
+		SELECT current_database() AS table_catalog,
+			(SELECT nspname FROM pg_catalog.pg_namespace n WHERE n.oid = c.relnamespace) AS table_schema,
+			c.relname AS table_name,
+			(SELECT ev_action FROM pg_catalog.pg_rewrite r WHERE r.ev_class = c.oid) AS view_definition
+		FROM pg_catalog.pg_class c
+		WHERE c.relkind = 'v'`},
+	{13005, PG_CATALOG_NAMESPACE, "pg_tables", `
+		SELECT (SELECT nspname FROM pg_catalog.pg_namespace n WHERE n.oid = c.relnamespace) AS schemaname,
+			c.relname AS tablename,
+			EXISTS (SELECT 1 FROM pg_catalog.pg_index i WHERE i.indrelid = c.oid) AS hasindexes
+		FROM pg_catalog.pg_class c
+		WHERE c.relkind = 'r'`},
+	{13006, PG_CATALOG_NAMESPACE, "pg_views", `
+		SELECT (SELECT nspname FROM pg_catalog.pg_namespace n WHERE n.oid = c.relnamespace) AS schemaname,
+			c.relname AS viewname,
+			(SELECT ev_action FROM pg_catalog.pg_rewrite r WHERE r.ev_class = c.oid) AS definition
+		FROM pg_catalog.pg_class c
+		WHERE c.relkind = 'v'`},
+	{13007, PG_CATALOG_NAMESPACE, "pg_indexes", `
+		SELECT (SELECT (SELECT nspname FROM pg_catalog.pg_namespace n WHERE n.oid = c.relnamespace)
+				FROM pg_catalog.pg_class c WHERE c.oid = i.indexrelid) AS schemaname,
+			(SELECT relname FROM pg_catalog.pg_class t WHERE t.oid = i.indrelid) AS tablename,
+			(SELECT relname FROM pg_catalog.pg_class c WHERE c.oid = i.indexrelid) AS indexname,
+			i.indexdef
+		FROM pg_catalog.pg_index i`},
+	{13008, INFORMATION_SCHEMA_NAMESPACE, "table_constraints", `
+		SELECT current_database() AS constraint_catalog, n.nspname AS constraint_schema, ic.relname AS constraint_name,
+			current_database() AS table_catalog, n.nspname AS table_schema, c.relname AS table_name,
+			'UNIQUE' AS constraint_type, 'NO' AS is_deferrable, 'NO' AS initially_deferred, 'YES' AS enforced
+		FROM pg_catalog.pg_index i
+			JOIN pg_catalog.pg_class ic ON ic.oid = i.indexrelid
+			JOIN pg_catalog.pg_class c ON c.oid = i.indrelid
+			JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+		WHERE i.indisunique AND strpos(' ' || i.indkey || ' ', ' 0 ') = 0 AND i.indexdef NOT LIKE '% WHERE %'
+		UNION ALL
+		SELECT current_database(), n.nspname, n.oid || '_' || c.oid || '_' || a.attnum || '_not_null',
+			current_database(), n.nspname, c.relname, 'CHECK', 'NO', 'NO', 'YES'
+		FROM pg_catalog.pg_attribute a
+			JOIN pg_catalog.pg_class c ON c.oid = a.attrelid
+			JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+		WHERE a.attnotnull AND a.attnum > 0 AND c.relkind = 'r'`},
+	{13009, INFORMATION_SCHEMA_NAMESPACE, "key_column_usage", `
+		SELECT current_database() AS constraint_catalog, k.nspname AS constraint_schema, k.indexname AS constraint_name,
+			current_database() AS table_catalog, k.nspname AS table_schema, k.relname AS table_name,
+			k.attname AS column_name,
+			length(k.keys_before) - length(replace(k.keys_before, ' ', '')) AS ordinal_position,
+			NULL::bigint AS position_in_unique_constraint
+		FROM (SELECT n.nspname, ic.relname AS indexname, c.relname, a.attname, i.indnkeyatts,
+				substring(' ' || i.indkey || ' ' FOR strpos(' ' || i.indkey || ' ', ' ' || a.attnum || ' ')) AS keys_before
+			FROM pg_catalog.pg_index i
+				JOIN pg_catalog.pg_class ic ON ic.oid = i.indexrelid
+				JOIN pg_catalog.pg_class c ON c.oid = i.indrelid
+				JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+				JOIN pg_catalog.pg_attribute a ON a.attrelid = i.indrelid AND a.attnum > 0
+			WHERE i.indisunique AND strpos(' ' || i.indkey || ' ', ' 0 ') = 0 AND i.indexdef NOT LIKE '% WHERE %'
+				AND strpos(' ' || i.indkey || ' ', ' ' || a.attnum || ' ') > 0) k
+		WHERE length(k.keys_before) - length(replace(k.keys_before, ' ', '')) <= k.indnkeyatts`},
+}
+
+// Oids of the pg_rewrite rows are the view's plus this
+const rewriteOidOffset types.Oid = 100
+
+// viewDefinition is a view's query on one line, the way it is stored in pg_rewrite
+func (view *systemView) viewDefinition() string {
+	return strings.Join(strings.Fields(view.query), " ")
+}
@@ -0,0 +1,265 @@
+package catalog
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/rautNishan/diskquery/access"
+	"github.com/rautNishan/diskquery/adt"
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+CREATE TABLE, ALTER TABLE, DROP TABLE and DROP INDEX (postgres commands/tablecmds.c), carried out as changes to
+pg_class, pg_attribute and pg_index. Tables are made in public, the other schemas only hold the system catalogs and views
+
+IF NOT EXISTS and IF EXISTS make a missing or existing table not an error, postgres sends a NOTICE for
+those but we have no notices to send yet
+*/
+
+// creationNamespace returns the namespace a new relation goes in, the caller holds catalogLock
+func creationNamespace(rv *types.RangeVar) (types.Oid, error) {
+	if rv.Schemaname == "" {
+		return PG_PUBLIC_NAMESPACE, nil
+	}
+	nspid, ok := relcache.namespaces[rv.Schemaname]
+	if !ok {
+		return types.InvalidOid, fmt.Errorf("schema \"%s\" does not exist at position %d", rv.Schemaname, rv.Location)
+	}
+	if nspid != PG_PUBLIC_NAMESPACE {
+		return types.InvalidOid, fmt.Errorf("permission denied to create \"%s.%s\" at position %d", rv.Schemaname, rv.Relname, rv.Location)
+	}
+	return nspid, nil
+}
+
+// DefineRelation makes the table of a CREATE TABLE, defaultAm is the session's default_table_access_method
+func DefineRelation(stmt *types.CreateStmt, defaultAm string) error {
+	catalogLock.Lock()
+	defer catalogLock.Unlock()
+	if err := loadRelcache(); err != nil {
+		return err
+	}
+
+	rv := stmt.Relation
+	nspid, err := creationNamespace(rv)
+	if err != nil {
+		return err
+	}
+	if err := checkName("relation", rv.Relname); err != nil {
+		return err
+	}
+	if _, exists := relcache.relations[relcacheKey{nspid, rv.Relname}]; exists {
+		if stmt.IfNotExists {
+			return nil
+		}
+		return fmt.Errorf("relation \"%s\" already exists", rv.Relname)
+	}
+
+	attrs := make([]attribute, 0, len(stmt.TableElts))
+	seen := make(map[string]bool, len(stmt.TableElts))
+	for _, colDef := range stmt.TableElts {
+		if seen[colDef.Colname] {
+			return fmt.Errorf("column \"%s\" specified more than once at position %d", colDef.Colname, colDef.Location)
+		}
+		seen[colDef.Colname] = true
+		if err := checkName("column", colDef.Colname); err != nil {
+			return err
+		}
+
+		typeOid, ok := adt.LookupTypeName(colDef.TypeName.Name)
+		if !ok {
+			return fmt.Errorf("type \"%s\" does not exist at position %d", colDef.TypeName.Name, colDef.TypeName.Location)
+		}
+		if entry := adt.LookupType(typeOid); entry.Category == adt.TYPCATEGORY_PSEUDO || entry.Category == adt.TYPCATEGORY_UNKNOWN {
+			return fmt.Errorf("column \"%s\" has pseudo-type %s at position %d", colDef.Colname, entry.Name, colDef.Location)
+		}
+		typmod, err := adt.TypmodIn(typeOid, colDef.TypeName.Typmods)
+		if err != nil {
+			return fmt.Errorf("%v at position %d", err, colDef.TypeName.Location)
+		}
+		storage := adt.LookupType(typeOid).Storage
+		if colDef.StorageName != "" {
+			if storage, err = storageType(colDef.StorageName, typeOid); err != nil {
+				return fmt.Errorf("%v at position %d", err, colDef.Location)
+			}
+		}
+		attrs = append(attrs, attribute{name: colDef.Colname, typeOid: typeOid, typmod: typmod, notNull: colDef.IsNotNull, storage: storage})
+	}
+
+	relam := stmt.AccessMethod
+	if relam == "" {
+		relam = defaultAm
+	}
+	if !access.IsTableAm(relam) {
+		if access.GetIndexAmRoutine(relam) != nil {
+			return fmt.Errorf("access method \"%s\" is not of type TABLE", relam)
+		}
+		return fmt.Errorf("access method \"%s\" does not exist", relam)
+	}
+
+	_, err = heapCreateWithCatalog(rv.Relname, nspid, attrs, relam)
+	return err
+}
+
+/*
+RemoveRelations drops the tables or indexes of a DROP TABLE or DROP INDEX, all of them are looked up before
+any is dropped. Dropping a table drops its indexes. The tables, those of the indexes for DROP INDEX, are
+locked with AccessExclusiveLock first so no statement is reading or changing them when their files go. The
+locks are taken before catalogLock, in oid order, for what the names were before: the names are looked up
+again and, when they are of other tables now, the locks are taken again for those
+*/
+func RemoveRelations(stmt *types.DropStmt) error {
+	owner := access.NewResourceOwner()
+	defer access.LockReleaseAll(owner)
+	var locked []types.Oid
+	for {
+		done, tables, err := removeLockedRelations(stmt, locked)
+		if done || err != nil {
+			return err
+		}
+		access.LockReleaseAll(owner)
+		for _, relid := range tables {
+			if err := access.LockRelationOid(relid, access.AccessExclusiveLock, owner); err != nil {
+				return err
+			}
+		}
+		locked = tables
+	}
+}
+
+// removeLockedRelations drops the relations of stmt if locked are their tables, else it returns the tables to lock
+func removeLockedRelations(stmt *types.DropStmt, locked []types.Oid) (done bool, tables []types.Oid, err error) {
+	catalogLock.Lock()
+	defer catalogLock.Unlock()
+	if err := loadRelcache(); err != nil {
+		return false, nil, err
+	}
+
+	var rels []*Relation
+	for _, rv := range stmt.Objects {
+		rel, err := lookupRelation(rv.Schemaname, rv.Relname)
+		if err != nil {
+			if stmt.MissingOk {
+				continue
+			}
+			return false, nil, err
+		}
+		switch {
+		case stmt.RemoveType == types.OBJECT_INDEX && rel.Relkind != RELKIND_INDEX:
+			return false, nil, fmt.Errorf("\"%s\" is not an index", rel.Relname)
+		case stmt.RemoveType == types.OBJECT_TABLE && rel.Relkind != RELKIND_RELATION:
+			return false, nil, fmt.Errorf("\"%s\" is not a table", rel.Relname)
+		}
+		if rel.Relid < FirstNormalObjectId {
+			return false, nil, fmt.Errorf("permission denied: \"%s\" is a system catalog", rel.Relname)
+		}
+		rels = append(rels, rel)
+		if rel.Relkind == RELKIND_INDEX {
+			tables = append(tables, relcache.indexes[rel.Relid].Indrelid)
+		} else {
+			tables = append(tables, rel.Relid)
+		}
+	}
+	slices.Sort(tables)
+	tables = slices.Compact(tables)
+	if !slices.Equal(tables, locked) {
+		return false, tables, nil
+	}
+	for _, rel := range rels {
+		var err error
+		if rel.Relkind == RELKIND_INDEX {
+			err = indexDrop(relcache.indexes[rel.Relid])
+		} else {
+			err = heapDropWithCatalog(rel)
+		}
+		if err != nil {
+			return false, nil, err
+		}
+	}
+	return true, nil, nil
+}
+
+// storageType reads the name of a column storage for a column of type typ, DEFAULT is the type's own
+func storageType(name string, typ types.Oid) (byte, error) {
+	var storage byte
+	switch name {
+	case "plain":
+		storage = adt.TYPSTORAGE_PLAIN
+	case "external":
+		storage = adt.TYPSTORAGE_EXTERNAL
+	case "extended":
+		storage = adt.TYPSTORAGE_EXTENDED
+	case "main":
+		storage = adt.TYPSTORAGE_MAIN
+	case "default":
+		return adt.LookupType(typ).Storage, nil
+	default:
+		return 0, fmt.Errorf("invalid storage type \"%s\"", name)
+	}
+	//A type whose values are never toasted (fixed length) has no other storage
+	if storage != adt.TYPSTORAGE_PLAIN && adt.LookupType(typ).Storage == adt.TYPSTORAGE_PLAIN {
+		return 0, fmt.Errorf("column data type %s can only have storage PLAIN", adt.TypeName(typ))
+	}
+	return storage, nil
+}
+
+/*
+AlterTable carries out an ALTER TABLE, SET STORAGE is the only change there is. The rows already in the table
+keep being stored as they are, VACUUM FULL writes them again with the new storage (as in postgres, where it
+is the rows written after the change that use it)
+*/
+func AlterTable(stmt *types.AlterTableStmt) error {
+	catalogLock.Lock()
+	defer catalogLock.Unlock()
+	if err := loadRelcache(); err != nil {
+		return err
+	}
+
+	rv := stmt.Relation
+	rel, err := lookupRelation(rv.Schemaname, rv.Relname)
+	if err != nil {
+		if stmt.MissingOk {
+			return nil
+		}
+		return err
+	}
+	if rel.Relkind != RELKIND_RELATION {
+		return fmt.Errorf("\"%s\" is not a table", rel.Relname)
+	}
+	if rel.Relid < FirstNormalObjectId {
+		return fmt.Errorf("permission denied: \"%s\" is a system catalog", rel.Relname)
+	}
+
+	storages := make(map[string]byte, len(stmt.Cmds))
+	for _, cmd := range stmt.Cmds {
+		var col *Column
+		for i := range rel.Columns {
+			if rel.Columns[i].Name == cmd.Name {
+				col = &rel.Columns[i]
+			}
+		}
+		if col == nil {
+			return fmt.Errorf("column \"%s\" of relation \"%s\" does not exist at position %d", cmd.Name, rel.Relname, cmd.Location)
+		}
+		storage, err := storageType(cmd.StorageName, col.TypeOid)
+		if err != nil {
+			return fmt.Errorf("%v at position %d", err, cmd.Location)
+		}
+		storages[col.Name] = storage
+	}
+
+	rows, err := readHeap(pgAttribute)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if storage, ok := storages[row[1].(string)]; ok && rowOid(row) == rel.Relid {
+			row[6] = string(storage)
+		}
+	}
+	if err := writeHeap(pgAttribute, rows); err != nil {
+		return err
+	}
+	invalidateRelcache()
+	return nil
+}
@@ -0,0 +1,87 @@
+package commands
+
+import (
+	"log"
+	"time"
+
+	"github.com/rautNishan/diskquery/access"
+	"github.com/rautNishan/diskquery/catalog"
+	"github.com/rautNishan/diskquery/guc"
+	"github.com/rautNishan/diskquery/planner"
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+Autovacuum (postgres postmaster/autovacuum.c)
+
+A table is due once the dead rows UPDATE and DELETE left in it (see access/pgstat.go) pass
+autovacuum_vacuum_threshold plus autovacuum_vacuum_scale_factor of its live rows, as in postgres, or when one
+of its indexes, its columnar file or its free space map is out of date: what VACUUM would make again (see
+vacuum.go). A goroutine started with the server looks at every table each autovacuum_naptime and runs a
+plain VACUUM on those that are due, never VACUUM FULL. A table VACUUM failed on, say a unique index the rows of a relation
+file changed from outside no longer fit, is left alone until its file changes again: the error is logged once
+instead of every naptime
+*/
+
+// failedVacuums are the relation files autovacuum failed on by table, only the autovacuum goroutine uses it
+var failedVacuums = make(map[types.Oid]access.HeapStamp)
+
+// AutoVacLauncherMain is the autovacuum goroutine, it runs as long as the server does
+func AutoVacLauncherMain() {
+	for {
+		_, naptime := guc.Autovacuum()
+		time.Sleep(naptime)
+		if enabled, _ := guc.Autovacuum(); enabled {
+			doAutovacuum()
+		}
+	}
+}
+
+func doAutovacuum() {
+	tables, err := catalog.UserTables()
+	if err != nil {
+		log.Printf("ERROR: autovacuum: %v", err)
+		return
+	}
+	for _, rel := range tables {
+		stamp, err := access.StatHeap(rel.FilePath)
+		if failed, ok := failedVacuums[rel.Relid]; ok && err == nil && failed == stamp {
+			continue
+		}
+		delete(failedVacuums, rel.Relid)
+		if !relationNeedsVacuum(rel) {
+			continue
+		}
+		rebuilt, err := vacuumRel(rel.Relid, false, false, nil)
+		if err != nil {
+			log.Printf("ERROR: automatic vacuum of table \"%s\": %v", rel.Relname, err)
+			if stamp, statErr := access.StatHeap(rel.FilePath); statErr == nil {
+				failedVacuums[rel.Relid] = stamp
+			}
+			continue
+		}
+		log.Printf("automatic vacuum of table \"%s\": %d indexes rebuilt", rel.Relname, rebuilt)
+	}
+}
+
+// relationNeedsVacuum tells if a table has enough dead rows, or an index, a columnar file or a free space map made from another version of its file
+func relationNeedsVacuum(rel *catalog.Relation) bool {
+	vacThresh, vacScaleFactor := guc.AutovacuumVacuumThreshold()
+	stats := access.PgstatFetchStatTabEntry(rel.Relid)
+	if float64(stats.DeadTuples) > float64(vacThresh)+vacScaleFactor*float64(stats.LiveTuples) {
+		return true
+	}
+	if rel.Relam == access.COLUMNAR_TABLE_AM_NAME && !access.ColumnarIsCurrent(rel.FilePath) {
+		return true
+	}
+	if !access.FreeSpaceMapIsCurrent(rel.FilePath) {
+		return true
+	}
+	for _, index := range rel.Indexes {
+		info, err := planner.AnalyzeIndexDefinition(index, rel)
+		if err != nil || !access.IndexIsCurrent(info.AccessMethod, index.FilePath, rel.FilePath) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,164 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rautNishan/diskquery/access"
+	"github.com/rautNishan/diskquery/catalog"
+	"github.com/rautNishan/diskquery/executor"
+	"github.com/rautNishan/diskquery/parser"
+	"github.com/rautNishan/diskquery/planner"
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+CREATE INDEX (postgres commands/indexcmds.c)
+
+The keys and the predicate are analyzed by the planner, the rows are read and the index file written by the
+executor and the catalog rows added by package catalog, which is why this is not with CREATE TABLE in catalog.
+pg_index gets the statement back as text with the keys as written, that is what the planner analyzes again
+when it looks at the index for a query and what pg_indexes shows
+*/
+
+// DefineIndex makes the index of a CREATE INDEX
+func DefineIndex(stmt *types.IndexStmt) error {
+	rv := stmt.Relation
+	rel, err := catalog.OpenRelation(rv.Schemaname, rv.Relname)
+	if err != nil {
+		return err
+	}
+	if rel.Relkind != catalog.RELKIND_RELATION {
+		return fmt.Errorf("cannot create index on relation \"%s\"", rel.Relname)
+	}
+	if rel.Relid < catalog.FirstNormalObjectId {
+		return fmt.Errorf("permission denied: \"%s\" is a system catalog", rel.Relname)
+	}
+
+	info, err := planner.TransformIndexStmt(stmt, rel)
+	if err != nil {
+		return err
+	}
+	if info.Name == "" {
+		//Postgres names the indexes of constraints _key and _pkey, we have none of those yet
+		if info.Name, err = catalog.ChooseRelationName(rel.Relname, chooseIndexNameAddition(stmt), "idx", rel.Relnamespace); err != nil {
+			return err
+		}
+	}
+	indexdef, err := indexDefinition(stmt, info.Name, rel)
+	if err != nil {
+		return err
+	}
+
+	colTypes := make([]types.Oid, len(rel.Columns))
+	for i, col := range rel.Columns {
+		colTypes[i] = col.TypeOid
+	}
+	/*
+		ShareLock keeps INSERT, UPDATE and DELETE out from when the rows are read until the index is in the
+		catalogs, where the statements planned after it see it. CONCURRENTLY reads the rows without it and takes
+		it once done, building the index again if the table changed in the meantime (postgres instead waits for
+		the statements that changed the table and adds their rows to the index)
+	*/
+	owner := access.NewResourceOwner()
+	defer access.LockReleaseAll(owner)
+	lockAndCheck := func() error {
+		if err := access.LockRelationOid(rel.Relid, access.ShareLock, owner); err != nil {
+			return err
+		}
+		if current, err := catalog.RelationIdGetRelation(rel.Relid); err != nil || current == nil {
+			if err == nil {
+				err = fmt.Errorf("relation \"%s\" does not exist", rel.Relname)
+			}
+			return err
+		}
+		return nil
+	}
+	if !stmt.Concurrent {
+		if err := lockAndCheck(); err != nil {
+			return err
+		}
+	}
+	return catalog.IndexCreate(rel, info.Name, stmt.Unique, info.Indkey, len(info.Keys), indexdef, stmt.Concurrent, stmt.IfNotExists,
+		func(path string) error {
+			if err := executor.BuildIndex(info, rel.Relname, rel.FilePath, colTypes, path); err != nil || !stmt.Concurrent {
+				return err
+			}
+			if err := lockAndCheck(); err != nil {
+				return err
+			}
+			if access.IndexIsCurrent(info.AccessMethod, path, rel.FilePath) {
+				return nil
+			}
+			return executor.BuildIndex(info, rel.Relname, rel.FilePath, colTypes, path)
+		})
+}
+
+// chooseIndexNameAddition joins the names of the keys and INCLUDE columns for a generated index name: columns
+// by their name, function calls by the function's and other expressions as "expr"
+func chooseIndexNameAddition(stmt *types.IndexStmt) string {
+	elems := append(append([]*types.IndexElem{}, stmt.IndexParams...), stmt.IndexIncludingParams...)
+	names := make([]string, len(elems))
+	for i, elem := range elems {
+		switch expr := elem.Expr.(type) {
+		case nil:
+			names[i] = elem.Name
+		case *types.FuncCall:
+			names[i] = expr.Funcname
+		default:
+			names[i] = "expr"
+		}
+	}
+	return strings.Join(names, "_")
+}
+
+// indexDefinition is the CREATE INDEX statement pg_index keeps, like postgres' pg_get_indexdef
+func indexDefinition(stmt *types.IndexStmt, idxname string, rel *catalog.Relation) (string, error) {
+	nspname, err := catalog.NamespaceName(rel.Relnamespace)
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	sb.WriteString("CREATE ")
+	if stmt.Unique {
+		sb.WriteString("UNIQUE ")
+	}
+	fmt.Fprintf(&sb, "INDEX %s ON %s.%s USING %s (", parser.QuoteIdentifier(idxname), parser.QuoteIdentifier(nspname),
+		parser.QuoteIdentifier(rel.Relname), stmt.AccessMethod)
+	for i, elem := range stmt.IndexParams {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		switch elem.Expr.(type) {
+		case nil:
+			sb.WriteString(parser.QuoteIdentifier(elem.Name))
+		case *types.FuncCall:
+			sb.WriteString(elem.ExprText)
+		default:
+			sb.WriteString("(" + elem.ExprText + ")")
+		}
+		desc := elem.Ordering == types.SORTBY_DESC
+		if desc {
+			sb.WriteString(" DESC")
+		}
+		//Only the NULLS placement that is not the default for the direction
+		switch {
+		case elem.NullsOrdering == types.SORTBY_NULLS_FIRST && !desc:
+			sb.WriteString(" NULLS FIRST")
+		case elem.NullsOrdering == types.SORTBY_NULLS_LAST && desc:
+			sb.WriteString(" NULLS LAST")
+		}
+	}
+	sb.WriteString(")")
+	if len(stmt.IndexIncludingParams) > 0 {
+		names := make([]string, len(stmt.IndexIncludingParams))
+		for i, elem := range stmt.IndexIncludingParams {
+			names[i] = parser.QuoteIdentifier(elem.Name)
+		}
+		sb.WriteString(" INCLUDE (" + strings.Join(names, ", ") + ")")
+	}
+	if stmt.WhereClause != nil {
+		sb.WriteString(" WHERE " + stmt.WhereText)
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,204 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/rautNishan/diskquery/access"
+	"github.com/rautNishan/diskquery/catalog"
+	"github.com/rautNishan/diskquery/executor"
+	"github.com/rautNishan/diskquery/planner"
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+VACUUM (postgres commands/vacuum.c, VACUUM FULL is commands/cluster.c)
+
+VACUUM takes away the rows UPDATE and DELETE leave dead, from their pages, from the indexes and from the free
+space map. A dead row is line breaks in the relation file (see access.HeapDelete) that index entries still
+point at, and its room is only recorded in the free space map once no entry does: for a table with dead rows
+counted since the last VACUUM (see access/pgstat.go) the rows of each page are moved together so the dead
+ones make one run of free space (see access/pruneheap.go), every index is built again, then every page is
+marked all visible in the visibility map (see access/visibilitymap.go) and the free space map is made again.
+A free space map that is out of date is made again as well, its indexes are then either out of date too or were built from
+the file as it is, as INSERT, UPDATE and DELETE write the free space map before the indexes. Dead rows from
+before the server started are only reclaimed once the file changed from outside, or by VACUUM FULL.
+Once a relation file is changed from outside, the entries of its indexes point at offsets of the file that
+was and the planner leaves them alone: VACUUM builds those indexes again, and the columnar file of a columnar table (see access/columnar.go), which goes out of date the same way
+and which the next columnar scan otherwise builds itself.
+VACUUM FULL also writes the relation file again with only its rows, without the empty lines and carriage
+returns scans step over and with the long rows toasted, and then builds every index of the relation, its
+columnar file and its free space map again as all the rows moved.
+
+The table is locked with AccessExclusiveLock while it is vacuumed, no statement reads or changes it meanwhile,
+and the catalogs are only locked to look it up (see vacuumRel). The system catalogs are written by package
+catalog under its own lock and are not vacuumed
+*/
+
+// VacuumReport gets the messages VACUUM sends the client, level is WARNING or INFO (for VERBOSE)
+type VacuumReport func(level string, message string)
+
+// ExecVacuum runs a VACUUM, on every table made by CREATE TABLE when it names none
+func ExecVacuum(stmt *types.VacuumStmt, report VacuumReport) error {
+	var relids []types.Oid
+	if len(stmt.Rels) == 0 {
+		tables, err := catalog.UserTables()
+		if err != nil {
+			return err
+		}
+		for _, rel := range tables {
+			relids = append(relids, rel.Relid)
+		}
+	}
+	for _, rv := range stmt.Rels {
+		rel, err := catalog.OpenRelation(rv.Schemaname, rv.Relname)
+		if err != nil {
+			return err
+		}
+		if rel.Relkind != catalog.RELKIND_RELATION || rel.Relid < catalog.FirstNormalObjectId {
+			report("WARNING", fmt.Sprintf("skipping \"%s\" --- cannot vacuum non-tables or special system tables", rel.Relname))
+			continue
+		}
+		relids = append(relids, rel.Relid)
+	}
+
+	for _, relid := range relids {
+		if _, err := vacuumRel(relid, stmt.Full, stmt.Verbose, report); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+vacuumRel vacuums a table. AccessExclusiveLock keeps the statements, CREATE INDEX and DROP out of it, the
+catalogs are only read under their lock to look the table up. ALTER TABLE takes no lock on the table: the
+table is looked up again once its files were written, like CREATE INDEX CONCURRENTLY does, and vacuumed again
+when its definition changed meanwhile. A table dropped since it was listed is skipped. Returns how many
+indexes were built again
+*/
+func vacuumRel(relid types.Oid, full bool, verbose bool, report VacuumReport) (int, error) {
+	owner := access.NewResourceOwner()
+	defer access.LockReleaseAll(owner)
+	if err := access.LockRelationOid(relid, access.AccessExclusiveLock, owner); err != nil {
+		return 0, err
+	}
+	rebuilt := 0
+	rel, err := catalog.RelationIdGetRelation(relid)
+	for err == nil && rel != nil {
+		var n int
+		n, err = lazyVacuumRel(rel, full, verbose, report)
+		rebuilt += n
+		if err != nil {
+			break
+		}
+		var current *catalog.Relation
+		if current, err = catalog.RelationIdGetRelation(relid); current == nil || !relationChanged(rel, current) {
+			break
+		}
+		rel = current
+	}
+	return rebuilt, err
+}
+
+// relationChanged tells if what VACUUM writes the files of a table for changed between two versions of its catalog entry
+func relationChanged(rel *catalog.Relation, current *catalog.Relation) bool {
+	if rel.FilePath != current.FilePath || len(rel.Columns) != len(current.Columns) || len(rel.Indexes) != len(current.Indexes) {
+		return true
+	}
+	for i, col := range rel.Columns {
+		if col.TypeOid != current.Columns[i].TypeOid || col.Storage != current.Columns[i].Storage {
+			return true
+		}
+	}
+	for i, index := range rel.Indexes {
+		if index.Indexrelid != current.Indexes[i].Indexrelid || index.FilePath != current.Indexes[i].FilePath {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+lazyVacuumRel writes the files of a locked table (postgres' heap_vacuum_rel, VACUUM FULL is cluster_rel): the
+dead rows are pruned from their pages, or the relation file written again for FULL, then the indexes, the
+columnar file, the visibility map and the free space map are made again for what changed
+*/
+func lazyVacuumRel(rel *catalog.Relation, full bool, verbose bool, report VacuumReport) (int, error) {
+	if verbose {
+		report("INFO", fmt.Sprintf("vacuuming \"%s\"", rel.Relname))
+	}
+	colTypes := make([]types.Oid, len(rel.Columns))
+	storage := make([]byte, len(rel.Columns))
+	for i, col := range rel.Columns {
+		colTypes[i] = col.TypeOid
+		storage[i] = col.Storage
+	}
+
+	//Dead rows are removed from every index before the free space map gets their room
+	stats := access.PgstatFetchStatTabEntry(rel.Relid)
+	prune := full || stats.DeadTuples > 0
+	liveTuples := stats.LiveTuples
+	if full {
+		rows, oldSize, newSize, err := access.HeapRewrite(rel.FilePath, rel.Relname, storage)
+		if err != nil {
+			return 0, err
+		}
+		liveTuples = int64(rows)
+		if verbose {
+			report("INFO", fmt.Sprintf("\"%s\": found %d rows, relation file went from %d to %d bytes", rel.Relname, rows, oldSize, newSize))
+		}
+	} else if prune {
+		pages, rows, err := access.HeapPrune(rel.FilePath, rel.Relname)
+		if err != nil {
+			return 0, err
+		}
+		liveTuples = rows
+		if verbose {
+			report("INFO", fmt.Sprintf("\"%s\": found %d rows, %d pages pruned", rel.Relname, rows, pages))
+		}
+	}
+
+	rebuilt := 0
+	for _, index := range rel.Indexes {
+		info, err := planner.AnalyzeIndexDefinition(index, rel)
+		if err != nil {
+			return rebuilt, err
+		}
+		if !prune && access.IndexIsCurrent(info.AccessMethod, index.FilePath, rel.FilePath) {
+			continue
+		}
+		if err := executor.BuildIndex(info, rel.Relname, rel.FilePath, colTypes, index.FilePath); err != nil {
+			return rebuilt, err
+		}
+		rebuilt++
+		if verbose {
+			report("INFO", fmt.Sprintf("index \"%s\" was rebuilt", index.Name))
+		}
+	}
+
+	if rel.Relam == access.COLUMNAR_TABLE_AM_NAME && (full || !access.ColumnarIsCurrent(rel.FilePath)) {
+		if err := executor.BuildColumnar(rel.Relname, rel.FilePath, colTypes); err != nil {
+			return rebuilt, err
+		}
+		if verbose {
+			report("INFO", fmt.Sprintf("columnar file of \"%s\" was rebuilt", rel.Relname))
+		}
+	}
+
+	//No index entry points at a dead row any more, index-only scans need not read the rows
+	if prune {
+		if err := access.VisibilityMapVacuum(rel.FilePath, rel.Relname); err != nil {
+			return rebuilt, err
+		}
+	}
+	if prune || !access.FreeSpaceMapIsCurrent(rel.FilePath) {
+		if err := access.FreeSpaceMapVacuum(rel.FilePath, rel.Relname); err != nil {
+			return rebuilt, err
+		}
+		access.PgstatReportVacuum(rel.Relid, liveTuples)
+		if verbose {
+			report("INFO", fmt.Sprintf("free space map of \"%s\" was rebuilt", rel.Relname))
+		}
+	}
+	return rebuilt, nil
+}
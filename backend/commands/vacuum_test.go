@@ -0,0 +1,237 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/rautNishan/diskquery/access"
+	"github.com/rautNishan/diskquery/catalog"
+	"github.com/rautNishan/diskquery/parser"
+	"github.com/rautNishan/diskquery/planner"
+	"github.com/rautNishan/diskquery/types"
+)
+
+// The catalogs are bootstrapped in a temporary data directory on first use, as in the connection tests
+func TestMain(m *testing.M) {
+	dataDir, err := os.MkdirTemp("", "diskquery_commands")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err := os.Chdir(dataDir); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	log.SetOutput(io.Discard)
+	code := m.Run()
+	os.RemoveAll(dataDir)
+	os.Exit(code)
+}
+
+// execUtility runs the CREATE TABLE, CREATE INDEX and VACUUM statements of query
+func execUtility(t *testing.T, query string, report VacuumReport) {
+	t.Helper()
+	stmts, err := parser.RawParse(query, parser.RAW_PARSE_DEFAULT)
+	if err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	for _, stmt := range stmts {
+		switch stmt := stmt.(type) {
+		case *types.CreateStmt:
+			err = catalog.DefineRelation(stmt, access.HEAP_TABLE_AM_NAME)
+		case *types.IndexStmt:
+			err = DefineIndex(stmt)
+		case *types.VacuumStmt:
+			err = ExecVacuum(stmt, report)
+		default:
+			t.Fatalf("%s: not a utility statement", query)
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", query, err)
+		}
+	}
+}
+
+func openTable(t *testing.T, relname string) *catalog.Relation {
+	t.Helper()
+	rel, err := catalog.OpenRelation("", relname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rel
+}
+
+// indexesCurrent tells for each index of relname if it was built from the relation file as it is now
+func indexesCurrent(t *testing.T, relname string) []bool {
+	t.Helper()
+	rel := openTable(t, relname)
+	var current []bool
+	for _, index := range rel.Indexes {
+		info, err := planner.AnalyzeIndexDefinition(index, rel)
+		if err != nil {
+			t.Fatal(err)
+		}
+		current = append(current, access.IndexIsCurrent(info.AccessMethod, index.FilePath, rel.FilePath))
+	}
+	return current
+}
+
+func TestVacuum(t *testing.T) {
+	var messages []string
+	report := func(level string, message string) {
+		messages = append(messages, level+": "+message)
+	}
+	execUtility(t, "CREATE TABLE vac_t (id bigint, v text)", report)
+	rel := openTable(t, "vac_t")
+	if err := os.WriteFile(rel.FilePath, []byte("1,a\n2,b\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	execUtility(t, "CREATE INDEX vac_t_id ON vac_t (id); CREATE INDEX vac_t_v ON vac_t USING hash (v)", report)
+	if got := fmt.Sprint(indexesCurrent(t, "vac_t")); got != "[true true]" {
+		t.Fatalf("indexes current %s after CREATE INDEX", got)
+	}
+	//The table has no free space map until VACUUM makes one
+	execUtility(t, "VACUUM VERBOSE vac_t", report)
+	if got := strings.Join(messages, "; "); got != `INFO: vacuuming "vac_t"; INFO: free space map of "vac_t" was rebuilt` {
+		t.Errorf("first VACUUM reported %q", got)
+	}
+	messages = nil
+	execUtility(t, "VACUUM VERBOSE vac_t", report)
+	if got := strings.Join(messages, "; "); got != `INFO: vacuuming "vac_t"` {
+		t.Errorf("VACUUM of a table with current indexes reported %q", got)
+	}
+
+	//Rows written from outside leave the indexes out of date until VACUUM builds them again
+	if err := os.WriteFile(rel.FilePath, []byte("1,a\n\r\n\n2,b\r\n3,c\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(indexesCurrent(t, "vac_t")); got != "[false false]" {
+		t.Fatalf("indexes current %s after the relation file changed", got)
+	}
+	messages = nil
+	execUtility(t, "VACUUM VERBOSE vac_t, pg_class", report)
+	want := []string{
+		`WARNING: skipping "pg_class" --- cannot vacuum non-tables or special system tables`,
+		`INFO: vacuuming "vac_t"`,
+		`INFO: index "vac_t_id" was rebuilt`,
+		`INFO: index "vac_t_v" was rebuilt`,
+		`INFO: free space map of "vac_t" was rebuilt`,
+	}
+	if fmt.Sprint(messages) != fmt.Sprint(want) {
+		t.Errorf("VACUUM reported %q, want %q", messages, want)
+	}
+	if got := fmt.Sprint(indexesCurrent(t, "vac_t")); got != "[true true]" {
+		t.Errorf("indexes current %s after VACUUM", got)
+	}
+
+	//VACUUM FULL leaves only the rows in the file
+	messages = nil
+	execUtility(t, "VACUUM FULL vac_t", report)
+	data, err := os.ReadFile(rel.FilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "1,a\n2,b\n3,c\n" {
+		t.Errorf("relation file after VACUUM FULL is %q", data)
+	}
+	if got := fmt.Sprint(indexesCurrent(t, "vac_t")); got != "[true true]" || len(messages) != 0 {
+		t.Errorf("indexes current %s and messages %q after VACUUM FULL", got, messages)
+	}
+	if !access.FreeSpaceMapIsCurrent(rel.FilePath) {
+		t.Error("free space map out of date after VACUUM FULL")
+	}
+}
+
+func TestAutovacuum(t *testing.T) {
+	execUtility(t, "CREATE TABLE autovac_t (id bigint); CREATE TABLE autovac_u (id bigint)", nil)
+	rel := openTable(t, "autovac_t")
+	if err := os.WriteFile(rel.FilePath, []byte("1\n2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	execUtility(t, "CREATE INDEX ON autovac_t (id); CREATE INDEX ON autovac_u (id)", nil)
+	//VACUUM would make the free space maps the tables do not have yet
+	if !relationNeedsVacuum(openTable(t, "autovac_t")) || !relationNeedsVacuum(openTable(t, "autovac_u")) {
+		t.Fatal("tables without a free space map need vacuum")
+	}
+	doAutovacuum()
+	if relationNeedsVacuum(openTable(t, "autovac_t")) || relationNeedsVacuum(openTable(t, "autovac_u")) {
+		t.Fatal("tables with current indexes and free space maps need no vacuum")
+	}
+
+	if err := os.WriteFile(rel.FilePath, []byte("1\n2\n3\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if !relationNeedsVacuum(openTable(t, "autovac_t")) || relationNeedsVacuum(openTable(t, "autovac_u")) {
+		t.Fatal("only the changed table needs vacuum")
+	}
+	doAutovacuum()
+	if relationNeedsVacuum(openTable(t, "autovac_t")) {
+		t.Error("autovacuum left an out of date index")
+	}
+	if got := fmt.Sprint(indexesCurrent(t, "autovac_t")); got != "[true]" {
+		t.Errorf("indexes current %s after autovacuum", got)
+	}
+
+	//Dead rows make a table due once there are more than autovacuum_vacuum_threshold plus
+	//autovacuum_vacuum_scale_factor of its live rows: 50 + 0.2 * 200 after the UPDATE, 50 + 0.2 * 140 after the DELETE
+	u := openTable(t, "autovac_u")
+	access.PgstatCountHeap(u.Relid, 200, 0, 0)
+	access.PgstatCountHeap(u.Relid, 0, 40, 0)
+	if relationNeedsVacuum(u) {
+		t.Error("40 dead rows of 200 are under the threshold")
+	}
+	access.PgstatCountHeap(u.Relid, 0, 0, 60)
+	if !relationNeedsVacuum(u) {
+		t.Error("100 dead rows of 140 are over the threshold")
+	}
+	doAutovacuum()
+	if stats := access.PgstatFetchStatTabEntry(u.Relid); stats.DeadTuples != 0 || stats.LiveTuples != 0 || relationNeedsVacuum(u) {
+		t.Errorf("autovacuum left %d dead and %d live rows counted in an empty table", stats.DeadTuples, stats.LiveTuples)
+	}
+}
+
+func TestVacuumPrunesDeadRows(t *testing.T) {
+	var messages []string
+	report := func(level string, message string) {
+		messages = append(messages, level+": "+message)
+	}
+	execUtility(t, "CREATE TABLE vac_p (id bigint, v text)", report)
+	rel := openTable(t, "vac_p")
+	tids, err := access.HeapInsert(rel.FilePath, rel.Relname, []string{"1,a", "2,b", "3,c", "4,d"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	execUtility(t, "CREATE INDEX vac_p_id ON vac_p (id)", report)
+	if err := access.HeapDelete(rel.FilePath, rel.Relname, []access.ItemPointer{tids[0], tids[2]}, false); err != nil {
+		t.Fatal(err)
+	}
+	access.PgstatCountHeap(rel.Relid, 4, 0, 2)
+
+	execUtility(t, "VACUUM VERBOSE vac_p", report)
+	want := []string{
+		`INFO: vacuuming "vac_p"`,
+		`INFO: "vac_p": found 2 rows, 1 pages pruned`,
+		`INFO: index "vac_p_id" was rebuilt`,
+		`INFO: free space map of "vac_p" was rebuilt`,
+	}
+	if fmt.Sprint(messages) != fmt.Sprint(want) {
+		t.Errorf("VACUUM reported %q, want %q", messages, want)
+	}
+	data, err := os.ReadFile(rel.FilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "2,b\n4,d\n\n\n\n\n\n\n\n\n" {
+		t.Errorf("relation file after VACUUM is %q", data)
+	}
+	if stats := access.PgstatFetchStatTabEntry(rel.Relid); stats.DeadTuples != 0 || stats.LiveTuples != 2 {
+		t.Errorf("VACUUM left %d dead and %d live rows counted", stats.DeadTuples, stats.LiveTuples)
+	}
+	if got := fmt.Sprint(indexesCurrent(t, "vac_p")); got != "[true]" || !access.VisibilityMapIsCurrent(rel.FilePath) {
+		t.Errorf("indexes current %s and visibility map current %v after VACUUM", got, access.VisibilityMapIsCurrent(rel.FilePath))
+	}
+}
@@ -0,0 +1,75 @@
+package connection
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+)
+
+func TestGroupByHaving(t *testing.T) {
+	session := newTestSession(t)
+	session.writeRows("data", "1,eng", "2,eng", "3,eng", "4,ops", "5,ops", "6,hr", "7,eng")
+	for _, hashagg := range []string{"on", "off"} {
+		session.run("SET enable_hashagg = " + hashagg)
+		session.expectUnordered("SELECT data, count(*), count(id), sum(id), min(id), max(id), avg(id) FROM data GROUP BY data",
+			"eng|4|4|13|1|7|3.2500000000000000", "ops|2|2|9|4|5|4.5000000000000000", "hr|1|1|6|6|6|6.0000000000000000")
+		session.expectUnordered("SELECT data, count(DISTINCT id / 2), sum(DISTINCT id / 2) FROM data GROUP BY data HAVING count(*) > 1",
+			"eng|3|4", "ops|1|2")
+		session.expectUnordered("SELECT data, count(*) FILTER (WHERE id > 2), bool_and(id > 1), bool_or(id > 6) FROM data GROUP BY 1",
+			"eng|2|f|t", "ops|2|t|f", "hr|1|t|f")
+		session.expectUnordered("SELECT data, string_agg(data, ','), array_agg(id) FROM data WHERE id > 3 AND id < 7 GROUP BY data",
+			"ops|ops,ops|{4,5}", "hr|hr|{6}")
+		session.expectUnordered("SELECT min(data), max(data), count(DISTINCT data) FROM data", "eng|ops|3")
+	}
+	//Without GROUP BY there is one row, also when there is no input
+	session.expect("SELECT count(*), sum(id), bool_and(id > 0) FROM data WHERE id > 100", "0|<NULL>|<NULL>")
+	session.expect("SELECT count(*) FROM data HAVING count(*) > 100")
+	session.expectError("SELECT data, id FROM data GROUP BY data", "column \"id\" must appear in the GROUP BY clause or be used in an aggregate function")
+	session.expectError("SELECT id FROM data WHERE count(*) > 1", "aggregate functions are not allowed in WHERE")
+	session.expectError("SELECT sum(count(*)) FROM data", "aggregate function calls cannot be nested")
+	session.expectError("SELECT count(*) FILTER (WHERE id) FROM data", "argument of FILTER must be type boolean, not type bigint")
+}
+
+func TestHashAggregateSpill(t *testing.T) {
+	session := newTestSession(t)
+	lines := make([]string, 0, 30000)
+	for i := 0; i < 30000; i++ {
+		lines = append(lines, fmt.Sprintf("%d,group %d", i, i%10000))
+	}
+	session.writeRows("data", lines...)
+
+	//64kB cannot hold 10000 groups, they go to batch files and come back with the same sums
+	check := func() {
+		t.Helper()
+		rows := session.query("SELECT data, count(*), sum(id) FROM data GROUP BY data")
+		if len(rows) != 10000 {
+			t.Fatalf("%d groups, want 10000", len(rows))
+		}
+		var count, sum int64
+		for _, row := range rows {
+			n, _ := strconv.ParseInt(row[1], 10, 64)
+			s, _ := strconv.ParseInt(row[2], 10, 64)
+			count += n
+			sum += s
+		}
+		if count != 30000 || sum != 449985000 {
+			t.Errorf("groups have %d rows summing to %d", count, sum)
+		}
+	}
+	check()
+	session.run("SET work_mem = '64kB'")
+	check()
+	session.expect("SELECT count(DISTINCT data), count(DISTINCT id) FROM data", "10000|30000")
+}
+
+func TestAggregateResultTypes(t *testing.T) {
+	session := newTestSession(t)
+	session.run("CREATE TABLE agg_types (i integer, b bigint, f double precision, n numeric)")
+	session.writeRows("agg_types", "1,9223372036854775807,0.5,1.5", "2,9223372036854775807,1.5,2.5")
+
+	//sum of a bigint and avg of any integer are numerics, they neither overflow nor round
+	session.expect("SELECT sum(i), sum(b), sum(f), sum(n) FROM agg_types", "3|18446744073709551614|2|4.0")
+	session.expect("SELECT avg(i), avg(b), avg(f), avg(n) FROM agg_types",
+		"1.5000000000000000|9223372036854775807|1|2.0000000000000000")
+	session.expect("SELECT sum(i), avg(b) FROM agg_types WHERE false", "<NULL>|<NULL>")
+}
@@ -0,0 +1,48 @@
+package connection
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestArrayConstructorTypes(t *testing.T) {
+	session := newTestSession(t)
+	//Unknown literals and NULLs take the type of the other elements
+	session.expect("SELECT ARRAY[NULL, 2], ARRAY['1', 2], ARRAY[2, NULL, '3'] = ARRAY[2, NULL, 3]", "{NULL,2}|{1,2}|t")
+	session.expect("SELECT ARRAY[NULL, NULL], ARRAY['a', 'b'] || 'c'", "{NULL,NULL}|{a,b,c}")
+	session.expect("SELECT array_length(ARRAY[NULL, 2.5], 1), (ARRAY[NULL, 2])[2] + 1", "2|3")
+
+	//A cast gives ARRAY[...] its type, the elements are converted to its element type
+	session.expect("SELECT ARRAY[]::int[], array_length(ARRAY[]::text[], 1)", "{}|<NULL>")
+	session.expect("SELECT ARRAY['1', '2']::int[], ARRAY[1, 2.5]::text[], ARRAY[[1, 2], [3, 4]]::text[]", "{1,2}|{1,2.5}|{{1,2},{3,4}}")
+	session.expectError("SELECT ARRAY[]", "cannot determine type of empty array")
+	session.expectError("SELECT ARRAY[1, true]", "ARRAY types bigint and boolean cannot be matched")
+}
+
+func TestArrayDimensionLimit(t *testing.T) {
+	session := newTestSession(t)
+	session.expect("SELECT '{{{{{{1}}}}}}'::int[]", "{{{{{{1}}}}}}")
+	session.expectError("SELECT '{{{{{{{1}}}}}}}'::int[]", "number of array dimensions exceeds the maximum allowed (6)")
+	session.expectError("SELECT '"+strings.Repeat("{", 100000)+"'::int[]", "number of array dimensions exceeds the maximum allowed (6)")
+	session.expectError("SELECT '{{1,2},{3}}'::int[]", "multidimensional arrays must have sub-arrays with matching dimensions")
+	session.expect("SELECT ARRAY[[[[[[1]]]]]]", "{{{{{{1}}}}}}")
+	session.expectError("SELECT ARRAY[[[[[[[1]]]]]]]", "number of array dimensions (7) exceeds the maximum allowed (6)")
+}
+
+func TestArrayOperators(t *testing.T) {
+	session := newTestSession(t)
+	session.expect("SELECT ARRAY[1, 2] || 3, 0 || ARRAY[1], ARRAY[1, 2] || ARRAY[3], ARRAY[[1, 2]] || ARRAY[3, 4]", "{1,2,3}|{0,1}|{1,2,3}|{{1,2},{3,4}}")
+	session.expect("SELECT ARRAY[1, 2, 3] @> ARRAY[3, 1], ARRAY[1, 2] <@ ARRAY[1], ARRAY[1, 2] && ARRAY[2, 5], ARRAY[1, NULL] @> ARRAY[NULL]::bigint[]",
+		"t|f|t|f")
+	session.expect("SELECT ARRAY[1, 2] = ARRAY[1, 2], ARRAY[1, 2] < ARRAY[1, 3], ARRAY[1, 2] < ARRAY[1, 2, 0], ARRAY[2] > ARRAY[1, 9]", "t|t|t|t")
+	session.expect("SELECT (ARRAY[10, 20, 30])[2], (ARRAY[10, 20, 30])[2:3], (ARRAY[10, 20, 30])[5], (ARRAY[[1, 2], [3, 4]])[2][1]", "20|{20,30}|<NULL>|3")
+	session.expect("SELECT array_length(ARRAY[[1, 2], [3, 4], [5, 6]], 1), array_length(ARRAY[[1, 2]], 2), cardinality(ARRAY[[1, 2], [3, 4]]), array_dims(ARRAY[[1, 2]])",
+		"3|2|4|[1:1][1:2]")
+	session.expect("SELECT array_lower(ARRAY[1, 2], 1), array_cat(ARRAY[1], ARRAY[2, 3]), array_append(ARRAY[1], 2), array_to_string(ARRAY[1, NULL, 3], ',', '*')",
+		"1|{1,2,3}|{1,2}|1,*,3")
+	session.expect("SELECT 2 = ANY(ARRAY[1, 2]), 3 = ANY(ARRAY[1, NULL]), 3 <> ALL(ARRAY[1, 2]), 1 < ALL(ARRAY[]::bigint[])", "t|<NULL>|t|t")
+	session.expect(`SELECT '{"a b", "c\"d", NULL, "NULL"}'::text[], '{1, 2}'::text[] = ARRAY['1', '2']`, `{"a b","c\"d",NULL,"NULL"}|t`)
+	session.expect("SELECT x FROM unnest(ARRAY[3, 1, 2]) AS x ORDER BY x", "1", "2", "3")
+	session.expectError("SELECT ARRAY[1] || ARRAY[[1, 2]]", "cannot concatenate incompatible arrays")
+	session.expectError("SELECT '{1, 2'::int[]", `malformed array literal: "{1, 2"`)
+}
@@ -0,0 +1,28 @@
+package connection
+
+import "testing"
+
+func TestCaseAndCast(t *testing.T) {
+	session := newTestSession(t)
+	session.expect("SELECT CASE 1 WHEN 1 THEN 'one' WHEN 2 THEN 'two' END, CASE 3 WHEN 1 THEN 'one' END, CASE NULL::bigint WHEN NULL THEN 'x' ELSE 'y' END",
+		"one|<NULL>|y")
+	session.expect("SELECT CASE WHEN 1 > 2 THEN 'a' WHEN 2 > 1 THEN 'b' ELSE 'c' END, CASE WHEN NULL THEN 1 ELSE 2 END, CASE WHEN true THEN 1 ELSE 2.5 END",
+		"b|2|1")
+	session.expect("SELECT CAST('42' AS bigint) + 1, CAST(1.5 AS text), '1'::text::bigint::text || 'x', CAST(NULL AS bigint), CAST('t' AS boolean)", "43|1.5|1x|<NULL>|t")
+	session.expect("SELECT 7::numeric(5, 2), CAST(2.345 AS numeric(4, 2)), '1.5'::float8::numeric, 10 / 4::float8", "7.00|2.35|1.5|2.5")
+	session.expect("SELECT '{1, 2}'::bigint[]::text[], CAST('2024-01-02' AS date), '1 day'::interval * 2", "{1,2}|2024-01-02|2 days")
+
+	vals := "WITH case_vals(id, v) AS (SELECT 1, 4 UNION ALL SELECT 2, 0 UNION ALL SELECT 3, -2 UNION ALL SELECT 4, NULL) "
+	//Only the branch that is taken is evaluated, the division by zero never happens
+	session.expect(vals+"SELECT id, CASE WHEN v = 0 THEN 0 ELSE 8 / v END FROM case_vals ORDER BY id", "1|2", "2|0", "3|-4", "4|<NULL>")
+	session.expect(vals+"SELECT id, CASE v % 3 WHEN 0 THEN 'zero' WHEN 1 THEN 'one' ELSE 'other' END FROM case_vals ORDER BY id",
+		"1|one", "2|zero", "3|other", "4|other")
+	session.expect(vals+"SELECT sum(CASE WHEN v > 0 THEN 1 ELSE 0 END), count(CASE WHEN v < 0 THEN 1 END) FROM case_vals", "1|1")
+	session.expect(vals+"SELECT id FROM case_vals ORDER BY CASE WHEN v IS NULL THEN 0 ELSE 1 END, v", "4", "3", "2", "1")
+
+	session.expectError("SELECT CASE WHEN 1 THEN 'a' END", "argument of CASE/WHEN must be type boolean, not type bigint")
+	session.expectError("SELECT CASE WHEN true THEN 1 ELSE 'a'::text END", "CASE types bigint and text cannot be matched")
+	session.expectError("SELECT CAST('x' AS nosuchtype)", `type "nosuchtype" does not exist`)
+	session.expectError("SELECT 123.456::numeric(4, 2)", "numeric field overflow")
+	session.expectError("SELECT '1 day'::interval::bigint", "cannot cast type interval to bigint")
+}
@@ -0,0 +1,90 @@
+package connection
+
+import (
+	"os"
+	"testing"
+)
+
+func TestCatalogDDL(t *testing.T) {
+	session := newTestSession(t)
+	session.run("CREATE TABLE catalog_t (a bigint, b text, c numeric(6, 2))")
+	session.run("CREATE TABLE IF NOT EXISTS catalog_t (x bigint)")
+	session.expectError("CREATE TABLE catalog_t (x bigint)", `relation "catalog_t" already exists`)
+
+	session.expect("SELECT relkind, relnatts, oid >= 16384, relnamespace = (SELECT oid FROM pg_namespace WHERE nspname = 'public') FROM pg_class WHERE relname = 'catalog_t'",
+		"r|3|t|t")
+	session.expect("SELECT attname, attnum, atttypmod FROM pg_attribute WHERE attrelid = (SELECT oid FROM pg_class WHERE relname = 'catalog_t') ORDER BY attnum",
+		"a|1|-1", "b|2|-1", "c|3|393222")
+	session.expect("SELECT count(*) FROM public.catalog_t", "0")
+	session.expect("SELECT relname FROM pg_catalog.pg_class WHERE oid = 1259", "pg_class")
+	session.expect("SELECT typname FROM pg_type WHERE oid = 1700", "numeric")
+
+	//The catalog is shared, another connection sees the table and a new table gets a higher oid
+	other := newTestSession(t)
+	other.writeRows("catalog_t", "1,x,1.50")
+	other.expect("SELECT a, b, c FROM catalog_t", "1|x|1.50")
+	other.run("CREATE TABLE catalog_u (a bigint)")
+	session.expect("SELECT (SELECT oid FROM pg_class WHERE relname = 'catalog_u') > (SELECT oid FROM pg_class WHERE relname = 'catalog_t')", "t")
+
+	session.expectError("CREATE TABLE catalog_dup (a bigint, a text)", `column "a" specified more than once`)
+	session.expectError("CREATE TABLE catalog_bad (a nosuchtype)", `type "nosuchtype" does not exist`)
+	session.expectError("CREATE TABLE nosuchschema.catalog_bad (a bigint)", `schema "nosuchschema" does not exist`)
+	session.expectError("DROP TABLE pg_class", `permission denied: "pg_class" is a system catalog`)
+	session.expect("SELECT count(*) FROM pg_class WHERE relname LIKE 'catalog_bad%' OR relname = 'catalog_dup'", "0")
+
+	session.run("DROP TABLE catalog_t, catalog_u")
+	session.expectError("SELECT * FROM catalog_t", `relation "catalog_t" does not exist`)
+	other.expectError("SELECT * FROM catalog_u", `relation "catalog_u" does not exist`)
+	session.expect("SELECT count(*) FROM pg_attribute WHERE attrelid NOT IN (SELECT oid FROM pg_class)", "0")
+	session.run("DROP TABLE IF EXISTS catalog_t")
+	session.expectError("DROP TABLE catalog_t", `relation "catalog_t" does not exist`)
+}
+
+func TestCatalogFreeSpace(t *testing.T) {
+	session := newTestSession(t)
+	attSize := func() int64 {
+		t.Helper()
+		info, err := os.Stat("global/pg_attribute.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info.Size()
+	}
+	const columns = "(a bigint, b text, c numeric(6, 2), d boolean, e date, f double precision, g text, h bigint)"
+	session.run("DROP TABLE IF EXISTS catalog_fsm_t")
+	start := attSize()
+	session.run("CREATE TABLE catalog_fsm_t " + columns)
+	created := attSize()
+
+	//Dropping blanks the rows out, the next table's rows go where they were
+	session.run("DROP TABLE catalog_fsm_t")
+	if attSize() != created {
+		t.Fatalf("pg_attribute went from %d to %d bytes on DROP TABLE", created, attSize())
+	}
+	session.run("CREATE TABLE catalog_fsm_t " + columns)
+	if grown := attSize() - created; grown > (created-start)/2 {
+		t.Errorf("pg_attribute grew by %d bytes making again a table whose rows took %d", grown, created-start)
+	}
+	session.expect("SELECT attname FROM pg_attribute WHERE attrelid = (SELECT oid FROM pg_class WHERE relname = 'catalog_fsm_t') ORDER BY attnum",
+		"a", "b", "c", "d", "e", "f", "g", "h")
+	session.expect("SELECT count(*) FROM pg_attribute WHERE attrelid NOT IN (SELECT oid FROM pg_class)", "0")
+	session.run("DROP TABLE catalog_fsm_t")
+}
+
+func TestRegclass(t *testing.T) {
+	session := newTestSession(t)
+	session.run("CREATE TABLE regclass_t (a bigint, b text)")
+	session.expect("SELECT 'regclass_t'::regclass, 'public.regclass_t'::regclass, 'pg_class'::regclass, 1259::regclass, 'information_schema.tables'::regclass",
+		"regclass_t|regclass_t|pg_class|pg_class|information_schema.tables")
+	session.expect("SELECT 'regclass_t'::regclass = (SELECT oid FROM pg_class WHERE relname = 'regclass_t'), 'pg_class'::regclass::bigint, 999999::regclass",
+		"t|1259|999999")
+	session.expect("SELECT attname FROM pg_attribute WHERE attrelid = 'regclass_t'::regclass AND attnum > 0 ORDER BY attnum", "a", "b")
+	session.expect("SELECT relname FROM pg_class WHERE oid = 'REGCLASS_T'::regclass", "regclass_t")
+	session.expect("SELECT c.oid::pg_catalog.regclass, CAST('1259' AS pg_catalog.regclass) FROM pg_class c WHERE c.relname = 'regclass_t'", "regclass_t|pg_class")
+	session.expect("SELECT typname, typlen FROM pg_type WHERE oid = 2205", "regclass|4")
+	session.expect("SELECT to_regclass('regclass_t') IS NOT NULL, to_regclass('regclass_missing') IS NULL", "t|t")
+	session.expectError("SELECT 'regclass_missing'::regclass", `relation "regclass_missing" does not exist`)
+	session.expectError("SELECT 'nosuchschema.regclass_t'::regclass", `schema "nosuchschema" does not exist`)
+	session.expectError("SELECT 1::public.regclass", `type "public.regclass" does not exist`)
+	session.expectError("SELECT 'a.b.c.d'::regclass", "improper relation name (too many dotted names): a.b.c.d")
+}
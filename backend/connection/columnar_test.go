@@ -0,0 +1,94 @@
+package connection
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestColumnarTable(t *testing.T) {
+	session := newTestSession(t)
+	session.run("CREATE TABLE colsales (id bigint, region text, amount numeric(10, 2), sold date) USING columnar")
+	session.expect("SELECT relam FROM pg_class WHERE relname = 'colsales'", "columnar")
+	regions := []string{"north", "south", "east", "west"}
+	var lines []string
+	for i := 1; i <= 25000; i++ {
+		amount := `\N`
+		if i%5 != 0 {
+			amount = fmt.Sprintf("%d.%02d", i%1000, i%100)
+		}
+		lines = append(lines, fmt.Sprintf("%d,%s,%s,2024-%02d-%02d", i, regions[i/7000], amount, i%12+1, i%28+1))
+	}
+	session.writeRows("colsales", lines...)
+
+	queries := []string{
+		"SELECT count(*), sum(amount), min(sold), max(id) FROM colsales",
+		"SELECT region, count(amount), avg(amount) FROM colsales GROUP BY region ORDER BY region",
+		"SELECT id, amount FROM colsales WHERE id > 24995 ORDER BY id",
+		"SELECT count(*) FROM colsales WHERE id >= 10000 AND id < 10010 AND region = 'south'",
+		"SELECT count(*) FROM colsales WHERE amount IS NULL",
+		"SELECT count(*) FROM colsales WHERE region = 'west' AND sold = '2024-01-01'",
+	}
+	//The rows as a scan of the relation file finds them
+	session.run("SET enable_columnarscan = off")
+	want := make([][][]string, len(queries))
+	for i, query := range queries {
+		want[i] = session.query(query)
+	}
+	session.expect(queries[0], "25000|10010000.00|2024-01-01|25000")
+	session.run("SET enable_columnarscan = on")
+	//No columnar file until the first columnar scan builds one
+	relpath := session.query("SELECT relpath FROM pg_class WHERE relname = 'colsales'")[0][0]
+	colpath := strings.TrimSuffix(relpath, ".txt") + "_columnar.txt"
+	if _, err := os.Stat(colpath); !os.IsNotExist(err) {
+		t.Fatalf("columnar file before the first scan: %v", err)
+	}
+	for i, query := range queries {
+		if got := session.query(query); fmt.Sprint(got) != fmt.Sprint(want[i]) {
+			t.Errorf("%s: from the columnar file got %v, want %v", query, got, want[i])
+		}
+	}
+	if _, err := os.Stat(colpath); err != nil {
+		t.Fatalf("no columnar file after a columnar scan: %v", err)
+	}
+
+	//A row inserted leaves the columnar file out of date, the next scan builds it again
+	session.run("INSERT INTO colsales VALUES (25001, 'west', 1.00, '2024-02-02')")
+	session.expect(queries[0], "25001|10010001.00|2024-01-01|25001")
+	session.run("DELETE FROM colsales WHERE id = 25001")
+	session.expect(queries[0], "25000|10010000.00|2024-01-01|25000")
+
+	//The region changes in the relation file but its stamp does not, the columnar scan still has the old one
+	info, err := os.Stat(relpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(relpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(relpath, []byte(strings.ReplaceAll(string(data), ",north,", ",nurth,")), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(relpath, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	session.expect("SELECT count(*) FROM colsales WHERE region = 'north'", "6999")
+	session.run("SET enable_columnarscan = off")
+	session.expect("SELECT count(*) FROM colsales WHERE region = 'north'", "0")
+	session.run("SET enable_columnarscan = on")
+
+	session.run("SET default_table_access_method = columnar")
+	session.run("CREATE TABLE colsales_default (id bigint)")
+	session.run("RESET default_table_access_method")
+	session.run("CREATE TABLE colsales_heap (id bigint)")
+	session.expect("SELECT relname, relam FROM pg_class WHERE relname LIKE 'colsales_%' ORDER BY relname", "colsales_default|columnar", "colsales_heap|heap")
+	session.expectError("CREATE TABLE colsales_bad (id bigint) USING nosuch", `access method "nosuch" does not exist`)
+	session.expectError("CREATE TABLE colsales_bad (id bigint) USING btree", `access method "btree" is not of type TABLE`)
+
+	session.run("DROP TABLE colsales, colsales_default, colsales_heap")
+	if _, err := os.Stat(colpath); !os.IsNotExist(err) {
+		t.Errorf("DROP TABLE left the columnar file: %v", err)
+	}
+}
@@ -0,0 +1,66 @@
+package connection
+
+import (
+	"testing"
+)
+
+func TestTimestampTzInDaylightSavingChange(t *testing.T) {
+	session := newTestSession(t)
+	//A skipped reading takes the offset before the change, a repeated one is the later of the two
+	session.expect("SELECT '2024-03-10 02:30:00 America/New_York'::timestamptz, '2024-11-03 01:30:00 America/New_York'::timestamptz",
+		"2024-03-10 07:30:00+00|2024-11-03 06:30:00+00")
+	session.expect("SELECT '2024-03-31 02:30:00 Europe/Berlin'::timestamptz, '2024-10-27 02:30:00 Europe/Berlin'::timestamptz",
+		"2024-03-31 01:30:00+00|2024-10-27 01:30:00+00")
+	session.expect("SELECT '2024-10-06 02:30:00 Australia/Sydney'::timestamptz, '2024-04-07 02:30:00 Australia/Sydney'::timestamptz",
+		"2024-10-05 16:30:00+00|2024-04-06 16:30:00+00")
+
+	session.run("SET TimeZone = 'America/New_York'")
+	session.expect("SELECT '2024-03-10 02:30:00'::timestamp::timestamptz, '2024-03-09 02:30:00'::timestamptz + interval '1 day'",
+		"2024-03-10 03:30:00-04|2024-03-10 03:30:00-04")
+	session.expect("SELECT '2024-03-10 02:30:00'::timestamp AT TIME ZONE 'America/New_York', date_trunc('day', '2024-11-03 12:00:00'::timestamptz)",
+		"2024-03-10 03:30:00-04|2024-11-03 00:00:00-04")
+}
+
+func TestDateEra(t *testing.T) {
+	session := newTestSession(t)
+	session.expect("SELECT '0001-01-01 BC'::date, '2024-01-01 AD'::date, '0001-12-31 BC'::date + 1", "0001-01-01 BC|2024-01-01|0001-01-01")
+	session.expect("SELECT '4714-11-24 BC'::date, '0044-03-15 12:00:00 BC'::timestamp, '0001-01-01 00:00:00+00 BC'::timestamptz",
+		"4714-11-24 BC|0044-03-15 12:00:00 BC|0001-01-01 00:00:00+00 BC")
+	session.expect("SELECT extract(year FROM '0044-03-15 BC'::date), extract(century FROM '0001-01-01 BC'::date), make_date(-44, 3, 15)",
+		"-44|-1|0044-03-15 BC")
+	session.expect("SELECT to_json('0044-03-15 12:00:00 BC'::timestamp)::text, '0005-02-29 BC'::date", "\"0044-03-15T12:00:00 BC\"|0005-02-29 BC")
+	session.expectError("SELECT '4714-11-23 BC'::date", "date out of range: \"4714-11-23 BC\"")
+	session.expectError("SELECT '0000-01-01'::date", "date/time field value out of range: \"0000-01-01\"")
+	session.expectError("SELECT '4714-11-24 BC'::date - 1", "date out of range")
+	session.expectError("SELECT make_date(0, 1, 1)", "date field value out of range: 0-01-01")
+}
+
+func TestExtractAndIntervals(t *testing.T) {
+	session := newTestSession(t)
+	session.expect("SELECT extract(year FROM timestamp '2024-02-29 13:45:30.5'), extract(second FROM timestamp '2024-02-29 13:45:30.5'), extract(dow FROM date '2024-02-29'), extract(doy FROM date '2024-12-31')",
+		"2024|30.500000|4|366")
+	session.expect("SELECT extract(epoch FROM timestamptz '1970-01-02 00:00:00+00'), extract(week FROM date '2021-01-03'), extract(isoyear FROM date '2021-01-03')",
+		"86400.000000|53|2020")
+	session.expect("SELECT interval '1 day 2 hours', interval '-1 month 3 days', interval '90 minutes', interval '1.5 years'",
+		"1 day 02:00:00|-1 mons +3 days|01:30:00|1 year 6 mons")
+	session.expect("SELECT date '2024-03-31' + interval '1 month', timestamp '2024-01-01 00:00' - timestamp '2023-12-30 12:00'",
+		"2024-04-30 00:00:00|1 day 12:00:00")
+	session.expect("SELECT interval '1 month' = interval '30 days', interval '25 hours' > interval '1 day', justify_hours(interval '25 hours')",
+		"t|t|1 day 01:00:00")
+	session.expect("SELECT date_trunc('month', timestamp '2024-02-29 13:45'), date_trunc('hour', timestamp '2024-02-29 13:45')",
+		"2024-02-01 00:00:00|2024-02-29 13:00:00")
+	session.expectError("SELECT extract(fortnight FROM date '2024-01-01')", `unit "fortnight" not recognized for type date`)
+	session.expectError("SELECT date '2024-02-30'", `date/time field value out of range: "2024-02-30"`)
+	session.expectError("SELECT time '25:00'", `date/time field value out of range: "25:00"`)
+}
+
+func TestTimeZones(t *testing.T) {
+	session := newTestSession(t)
+	session.expect("SELECT timestamptz '2024-07-01 12:00:00 Europe/Berlin', timestamptz '2024-01-01 12:00:00-05'",
+		"2024-07-01 10:00:00+00|2024-01-01 17:00:00+00")
+	session.run("SET TimeZone = 'America/New_York'")
+	session.expect("SELECT timestamptz '2024-07-01 12:00:00+00', timestamp '2024-07-01 12:00:00' AT TIME ZONE 'UTC'",
+		"2024-07-01 08:00:00-04|2024-07-01 08:00:00-04")
+	session.expectError("SET TimeZone = 'Mars/Olympus'", `invalid value for parameter "TimeZone": "Mars/Olympus"`)
+	session.run("RESET TimeZone")
+}
@@ -0,0 +1,100 @@
+package connection
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/rautNishan/diskquery/access"
+)
+
+// expectTags runs a query that must succeed and checks its command tags
+func (session *testSession) expectTags(query string, want ...string) {
+	session.t.Helper()
+	if got := session.run(query).tags; !reflect.DeepEqual(got, want) {
+		session.t.Errorf("%s:\n got tags %q\nwant %q", query, got, want)
+	}
+}
+
+// expectIndexesCurrent checks the indexes of a table were kept up to date, the planner leaves the others alone
+func (session *testSession) expectIndexesCurrent(relname string) {
+	session.t.Helper()
+	rows := session.query(`SELECT t.relpath, i.relpath, x.indexdef FROM pg_index x JOIN pg_class t ON t.oid = x.indrelid
+		JOIN pg_class i ON i.oid = x.indexrelid WHERE t.relname = ` + quoteLiteral(relname))
+	for _, row := range rows {
+		_, using, _ := strings.Cut(row[2], " USING ")
+		am, _, _ := strings.Cut(using, " ")
+		if !access.IndexIsCurrent(am, row[1], row[0]) {
+			session.t.Errorf("index file %s of \"%s\" is out of date", row[1], relname)
+		}
+	}
+}
+
+func TestInsertUpdateDelete(t *testing.T) {
+	session := newTestSession(t)
+	session.run("CREATE TABLE dml_items (id bigint NOT NULL, name text, price numeric)")
+
+	session.expectTags("INSERT INTO dml_items VALUES (1, 'apple', 1.5), (2, 'pear', 2)", "INSERT 0 2")
+	session.expectTags("INSERT INTO dml_items (name, id) VALUES ('plum', 3)", "INSERT 0 1")
+	session.expectTags("INSERT INTO dml_items SELECT id + 10, name || ' dried', price * 2 FROM dml_items WHERE price IS NOT NULL", "INSERT 0 2")
+	session.expect("SELECT id, name, price FROM dml_items ORDER BY id",
+		"1|apple|1.5", "2|pear|2", "3|plum|<NULL>", "11|apple dried|3.0", "12|pear dried|4")
+
+	session.expectTags("UPDATE dml_items SET price = price + 1, name = upper(name) WHERE id < 3", "UPDATE 2")
+	session.expect("SELECT id, name, price FROM dml_items WHERE id < 10 ORDER BY id", "1|APPLE|2.5", "2|PEAR|3", "3|plum|<NULL>")
+	session.expect("UPDATE dml_items SET price = DEFAULT WHERE id = 1 RETURNING id, price IS NULL", "1|t")
+	session.expect("DELETE FROM dml_items WHERE id > 10 RETURNING name", "apple dried", "pear dried")
+	session.expectTags("DELETE FROM dml_items WHERE id = 100", "DELETE 0")
+	session.expect("SELECT id FROM dml_items ORDER BY id", "1", "2", "3")
+	session.expectTags("DELETE FROM dml_items", "DELETE 3")
+	session.expect("SELECT count(*) FROM dml_items", "0")
+
+	session.expectError("INSERT INTO dml_items (name) VALUES ('fig')", `null value in column "id" of relation "dml_items" violates not-null constraint`)
+	session.expectError("INSERT INTO dml_items VALUES (4, 'a,b', 1)", `cannot store value of column "name" of relation "dml_items": only the last column may contain ','`)
+	session.expectError("INSERT INTO dml_items VALUES (4, E'a\\nb', 1)", `cannot store value of column "name" of relation "dml_items": it contains a line break`)
+	session.expectError("INSERT INTO dml_items VALUES (4, '\\N', 1)", `cannot store value of column "name" of relation "dml_items": \N is read as NULL`)
+	session.expectError("INSERT INTO dml_items VALUES (4, 'a', 1, 2)", "INSERT has more expressions than target columns")
+	session.expectError("INSERT INTO dml_items (id, name) VALUES (4)", "INSERT has more target columns than expressions")
+	session.expectError("INSERT INTO dml_items VALUES ('x')", `invalid input syntax for type bigint: "x"`)
+	session.expectError("UPDATE dml_items SET nope = 1", `column "nope" of relation "dml_items" does not exist`)
+	session.expectError("UPDATE dml_items SET id = 1, id = 2", `multiple assignments to same column "id"`)
+	session.expectError("DELETE FROM pg_class", "permission denied")
+	session.expect("SELECT count(*) FROM dml_items", "0")
+}
+
+func TestModifyTableKeepsIndexesUpToDate(t *testing.T) {
+	session := newTestSession(t)
+	session.run("CREATE TABLE dml_keys (id bigint, tag text, doc jsonb)")
+	session.writeRows("dml_keys", "1,a,{}", "2,b,{}", "3,c,{}")
+	session.run("CREATE UNIQUE INDEX dml_keys_id ON dml_keys (id)")
+	session.run("CREATE INDEX dml_keys_tag ON dml_keys USING hash (tag)")
+	session.run("CREATE INDEX dml_keys_doc ON dml_keys USING gin (doc)")
+
+	session.run(`INSERT INTO dml_keys VALUES (4, 'd', '{"n": 4}'), (5, 'a', '{"n": 5}')`)
+	session.expect("SELECT id FROM dml_keys WHERE id = 4", "4")
+	session.expect("SELECT id FROM dml_keys WHERE tag = 'a' ORDER BY id", "1", "5")
+	session.expect(`SELECT id FROM dml_keys WHERE doc @> '{"n": 5}'`, "5")
+
+	session.expectError("INSERT INTO dml_keys VALUES (3, 'x', '{}')", `duplicate key value violates unique constraint "dml_keys_id": Key (id)=(3) already exists`)
+	session.expectError("INSERT INTO dml_keys VALUES (6, 'x', '{}'), (6, 'y', '{}')", `Key (id)=(6) already exists`)
+	session.expectError("UPDATE dml_keys SET id = 1 WHERE id = 2", `Key (id)=(1) already exists`)
+	//The old version of a row does not conflict with the new one, nor does a deleted row
+	session.run("UPDATE dml_keys SET id = id, tag = 'z' WHERE id = 2")
+	session.run("DELETE FROM dml_keys WHERE id = 3")
+	session.run("INSERT INTO dml_keys VALUES (3, 'c2', '{}')")
+	session.run("INSERT INTO dml_keys VALUES (NULL, 'n', '{}'), (NULL, 'n', '{}')")
+
+	session.expect("SELECT id, tag FROM dml_keys WHERE id >= 2 AND id <= 3 ORDER BY id", "2|z", "3|c2")
+	session.expect("SELECT id FROM dml_keys WHERE id >= 2 AND id <= 3 ORDER BY id", "2", "3")
+	session.expect("SELECT count(*) FROM dml_keys WHERE tag = 'b'", "0")
+	session.expect("SELECT count(*) FROM dml_keys WHERE id IS NULL", "2")
+	session.expectIndexesCurrent("dml_keys")
+
+	//VACUUM takes the dead rows out of the indexes and the rows inserted afterwards go in their lines
+	session.run("VACUUM dml_keys")
+	session.run("INSERT INTO dml_keys VALUES (7, 'g', '{}')")
+	session.expect("SELECT id, tag FROM dml_keys WHERE id > 1 ORDER BY id", "2|z", "3|c2", "4|d", "5|a", "7|g")
+	session.expect("SELECT id FROM dml_keys WHERE tag = 'g'", "7")
+	session.expect("SELECT count(*) FROM dml_keys", "8")
+	session.expectIndexesCurrent("dml_keys")
+}
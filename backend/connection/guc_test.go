@@ -0,0 +1,94 @@
+package connection
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSettingsArePerSession(t *testing.T) {
+	ny, utc := newTestSession(t), newTestSession(t)
+	ny.run("SET TimeZone = 'America/New_York'")
+	ny.run("SET work_mem = '64MB'")
+	ny.run("SET enable_hashagg = off")
+
+	ny.expect("SHOW timezone", "America/New_York")
+	utc.expect("SHOW timezone", "UTC")
+	ny.expect("SHOW work_mem", "64MB")
+	utc.expect("SHOW work_mem", "4MB")
+	utc.expect("SHOW enable_hashagg", "on")
+
+	//A literal without a zone is read in the zone of the session running the statement
+	ny.expect("SELECT '2024-01-01 12:00:00+00'::timestamptz, '2024-01-01 12:00:00'::timestamptz",
+		"2024-01-01 07:00:00-05|2024-01-01 12:00:00-05")
+	utc.expect("SELECT '2024-01-01 12:00:00+00'::timestamptz, '2024-01-01 12:00:00'::timestamptz",
+		"2024-01-01 12:00:00+00|2024-01-01 12:00:00+00")
+	ny.expect("SELECT extract(hour FROM '2024-01-01 12:00:00+00'::timestamptz), '2024-01-01 12:00:00+00'::timestamptz::text",
+		"7|2024-01-01 07:00:00-05")
+
+	ny.run("RESET TimeZone")
+	ny.expect("SHOW timezone", "UTC")
+	ny.expect("SHOW work_mem", "64MB")
+}
+
+func TestSettingsOfConcurrentSessions(t *testing.T) {
+	for i, zone := range []string{"UTC", "Asia/Tokyo", "America/New_York", "Europe/Berlin"} {
+		want := []string{"2024-01-01 12:00:00+00", "2024-01-01 21:00:00+09", "2024-01-01 07:00:00-05", "2024-01-01 13:00:00+01"}[i]
+		t.Run(zone, func(t *testing.T) {
+			t.Parallel()
+			session := newTestSession(t)
+			session.run(fmt.Sprintf("SET TimeZone = '%s'", zone))
+			for j := 0; j < 20; j++ {
+				session.expect("SELECT '2024-01-01 12:00:00+00'::timestamptz", want)
+			}
+		})
+	}
+}
+
+func TestAlterSystem(t *testing.T) {
+	before := newTestSession(t)
+	before.run("SET work_mem = '1MB'")
+	before.expectError("SET autovacuum = off", "parameter \"autovacuum\" cannot be changed now")
+	before.expectError("RESET autovacuum_naptime", "parameter \"autovacuum_naptime\" cannot be changed now")
+
+	before.run("ALTER SYSTEM SET work_mem = '8MB'")
+	before.run("ALTER SYSTEM SET autovacuum TO off")
+	t.Cleanup(func() {
+		cleanup := newTestSession(t)
+		cleanup.run("ALTER SYSTEM RESET work_mem")
+		cleanup.run("ALTER SYSTEM RESET autovacuum")
+	})
+
+	//Running sessions keep their values until they RESET, server wide settings change right away
+	before.expect("SHOW work_mem", "1MB")
+	before.expect("SHOW autovacuum", "off")
+	after := newTestSession(t)
+	after.expect("SHOW work_mem", "8MB")
+	before.run("RESET work_mem")
+	before.expect("SHOW work_mem", "8MB")
+
+	before.run("ALTER SYSTEM RESET work_mem")
+	newTestSession(t).expect("SHOW work_mem", "4MB")
+	before.expectError("ALTER SYSTEM SET work_mem = 'lots'", "invalid value for parameter \"work_mem\": \"lots\"")
+	before.expectError("ALTER SYSTEM SET no_such_setting = 1", "unrecognized configuration parameter \"no_such_setting\"")
+
+	before.expect("SHOW autovacuum_vacuum_scale_factor", "0.2")
+	before.expect("SHOW autovacuum_vacuum_threshold", "50")
+	before.run("ALTER SYSTEM SET autovacuum_vacuum_scale_factor = 0.05")
+	before.expect("SHOW autovacuum_vacuum_scale_factor", "0.05")
+	before.run("ALTER SYSTEM RESET autovacuum_vacuum_scale_factor")
+	before.expect("SHOW autovacuum_vacuum_scale_factor", "0.2")
+	before.expectError("SET autovacuum_vacuum_scale_factor = 0.1", "parameter \"autovacuum_vacuum_scale_factor\" cannot be changed now")
+	before.expectError("ALTER SYSTEM SET autovacuum_vacuum_scale_factor = 101",
+		"101 is outside the valid range for parameter \"autovacuum_vacuum_scale_factor\" (0 .. 100)")
+	before.expectError("ALTER SYSTEM SET autovacuum_vacuum_scale_factor = 'x'", "parameter \"autovacuum_vacuum_scale_factor\" requires a numeric value")
+}
+
+func TestIntegerSettingOverflow(t *testing.T) {
+	session := newTestSession(t)
+	session.expectError("SET work_mem = '3000000GB'", "invalid value for parameter \"work_mem\": \"3000000GB\"")
+	session.expectError("SET work_mem = '9223372036854775807kB'", "invalid value for parameter \"work_mem\"")
+	session.expectError("SET work_mem = '-2048TB'", "invalid value for parameter \"work_mem\"")
+	session.expectError("SET work_mem = '1048576GB'", "invalid value for parameter \"work_mem\"")
+	session.run("SET work_mem = '2047GB'")
+	session.expect("SHOW work_mem", "2047GB")
+}
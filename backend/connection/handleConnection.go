@@ -9,10 +9,15 @@ import (
 	"log"
 	"net"
 	"os"
+	"runtime/debug"
 	"sync"
 	"time"
 
+	"github.com/rautNishan/diskquery/executor"
+	"github.com/rautNishan/diskquery/guc"
 	"github.com/rautNishan/diskquery/parser"
+	"github.com/rautNishan/diskquery/planner"
+	"github.com/rautNishan/diskquery/types"
 )
 
 const SEND_BUFFER_SIZE = 8192
@@ -25,6 +30,17 @@ const (
 	Msg_Execute = 'E'
 )
 
+// Messages the backend sends
+const (
+	Msg_RowDescription  = 'T'
+	Msg_DataRow         = 'D'
+	Msg_CommandComplete = 'C'
+	Msg_ErrorResponse   = 'E'
+	Msg_ReadyForQuery   = 'Z'
+
+	Msg_NoticeResponse = 'N'
+)
+
 type InputMessage struct {
 	msgType byte
 	data    []byte
@@ -44,6 +60,7 @@ type Connection struct {
 	tcpKeepAlive bool
 	wg           sync.WaitGroup
 	backendId    int
+	session      *guc.Session //Settings SET changes, only this connection sees them
 }
 
 /*
@@ -79,6 +96,7 @@ func initConnection(conn net.Conn) *Connection {
 		reader:     bufio.NewReaderSize(conn, RECEVE_BUFFER_SIZE),
 		writer:     bufio.NewWriterSize(conn, SEND_BUFFER_SIZE),
 		backendId:  os.Getpid(),
+		session:    guc.NewSession(),
 	}
 	err := configureTCPSocket(port)
 	if err != nil {
@@ -202,5 +220,99 @@ func (connection *Connection) getMessageString(inputMessage *InputMessage) strin
 
 func (connection *Connection) execSimpleQuery(queryString string) {
 	fmt.Printf("Executing query: %v", queryString)
-	parser.RawParse(queryString, parser.RAW_PARSE_DEFAULT)
+	defer func() {
+		//A panic fails the query, not the server: the client gets an error and the other connections go on
+		if r := recover(); r != nil {
+			log.Printf("PANIC: %v\n%s", r, debug.Stack())
+			connection.sendError(fmt.Errorf("internal error: %v", r))
+		}
+		connection.sendReadyForQuery()
+		connection.writer.Flush()
+	}()
+
+	parseTrees, err := parser.RawParse(queryString, parser.RAW_PARSE_DEFAULT)
+	if err != nil {
+		connection.sendError(err)
+		return
+	}
+
+	//Each statement is planned and run on its own, the first error stops the rest
+	for _, parseTree := range parseTrees {
+		if isUtilityStmt(parseTree) {
+			if err := connection.processUtility(parseTree); err != nil {
+				connection.sendError(err)
+				return
+			}
+			continue
+		}
+
+		plannedStmt, err := planner.Plan(parseTree, connection.session)
+		if err != nil {
+			connection.sendError(err)
+			return
+		}
+		//INSERT, UPDATE and DELETE only return rows with RETURNING
+		receive := func(types.Tuple) error { return nil }
+		if plannedStmt.CommandType == types.CMD_SELECT || len(plannedStmt.TargetList) > 0 {
+			printtup, err := connection.startPrinttup(plannedStmt.TargetList, nil)
+			if err != nil {
+				connection.sendError(err)
+				return
+			}
+			receive = printtup.receive
+		}
+		processed, err := executor.ExecutorRun(plannedStmt, connection.session, receive)
+		if err != nil {
+			connection.sendError(err)
+			return
+		}
+		connection.sendCommandComplete(commandTag(plannedStmt.CommandType, processed))
+	}
+}
+
+// commandTag is what CommandComplete reports for a statement (postgres tcop/cmdtag.c), the 0 of INSERT is the oid postgres no longer gives
+func commandTag(commandType types.CmdType, processed int64) string {
+	switch commandType {
+	case types.CMD_INSERT:
+		return fmt.Sprintf("INSERT 0 %d", processed)
+	case types.CMD_UPDATE:
+		return fmt.Sprintf("UPDATE %d", processed)
+	case types.CMD_DELETE:
+		return fmt.Sprintf("DELETE %d", processed)
+	}
+	return fmt.Sprintf("SELECT %d", processed)
+}
+
+func (connection *Connection) sendCommandComplete(tag string) {
+	msg := beginMessage(Msg_CommandComplete)
+	msg.sendString(tag)
+	connection.endMessage(msg)
+}
+
+func (connection *Connection) sendError(err error) {
+	log.Printf("ERROR: %v", err)
+	msg := beginMessage(Msg_ErrorResponse)
+	msg.sendByte('S')
+	msg.sendString("ERROR")
+	msg.sendByte('M')
+	msg.sendString(err.Error())
+	msg.sendByte(0)
+	connection.endMessage(msg)
+}
+
+// sendNotice sends a message that is not an error (WARNING, INFO ...), the statement goes on
+func (connection *Connection) sendNotice(severity string, message string) {
+	msg := beginMessage(Msg_NoticeResponse)
+	msg.sendByte('S')
+	msg.sendString(severity)
+	msg.sendByte('M')
+	msg.sendString(message)
+	msg.sendByte(0)
+	connection.endMessage(msg)
+}
+
+func (connection *Connection) sendReadyForQuery() {
+	msg := beginMessage(Msg_ReadyForQuery)
+	msg.sendByte('I') //Idle, we have no transactions yet
+	connection.endMessage(msg)
 }
@@ -0,0 +1,290 @@
+package connection
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/rautNishan/diskquery/access"
+)
+
+func TestPartialIndexDefinitionKeepsLiterals(t *testing.T) {
+	session := newTestSession(t)
+	session.run("CREATE TABLE idxdef_ws (id bigint, v text)")
+	var lines []string
+	for i := 1; i <= 10; i++ {
+		v := "a b"
+		if i%2 == 0 {
+			v = "a  b"
+		}
+		lines = append(lines, fmt.Sprintf("%d,%s", i, v))
+	}
+	session.writeRows("idxdef_ws", lines...)
+	session.run("CREATE INDEX idxdef_ws_idx ON idxdef_ws (id) WHERE v <> 'a  b'")
+	session.run("CREATE INDEX idxdef_ws_nl ON idxdef_ws ((v || E'\\n'))  WHERE v <> 'x' -- a comment\n AND id > 0")
+
+	session.expect("SELECT indexdef FROM pg_indexes WHERE indexname LIKE 'idxdef_ws%' ORDER BY indexname",
+		`CREATE INDEX idxdef_ws_idx ON public.idxdef_ws USING btree (id) WHERE v <> 'a  b'`,
+		`CREATE INDEX idxdef_ws_nl ON public.idxdef_ws USING btree ((v || E'\n')) WHERE v <> 'x' AND id > 0`)
+	//The predicate says v <> 'a  b', which v <> 'a b' does not imply
+	session.expect("SELECT count(*) FROM idxdef_ws WHERE v <> 'a b' AND id <= 5000", "5")
+	session.expect("SELECT count(*) FROM idxdef_ws WHERE v <> 'a  b' AND id <= 5000", "5")
+	session.expect("SELECT count(*) FROM idxdef_ws WHERE v || E'\\n' = E'a b\\n'", "5")
+}
+
+func TestGinIndexOfJsonb(t *testing.T) {
+	session := newTestSession(t)
+	session.run("CREATE TABLE gin_docs (id bigint, doc jsonb)")
+	var lines []string
+	for i := 1; i <= 200; i++ {
+		lines = append(lines, fmt.Sprintf(`%d,{"n": %d, "tags": ["t%d", "all"], "kind": {"odd": %t}}`, i, i, i%7, i%2 == 1))
+	}
+	lines = append(lines, `201,\N`, `202,{}`, `203,[1, 2]`)
+	session.writeRows("gin_docs", lines...)
+
+	want := session.query(`SELECT count(*) FROM gin_docs WHERE doc @> '{"tags": ["t3"], "kind": {"odd": true}}'`)
+	session.run("CREATE INDEX gin_docs_idx ON gin_docs USING gin (doc)")
+	session.expect(`SELECT count(*) FROM gin_docs WHERE doc @> '{"tags": ["t3"], "kind": {"odd": true}}'`, want[0][0])
+	session.expect(`SELECT id FROM gin_docs WHERE doc @> '{"n": 17}'`, "17")
+	session.expect(`SELECT id FROM gin_docs WHERE '{"n": 18}' <@ doc AND doc @> '{"tags": ["all"]}'`, "18")
+	session.expect(`SELECT count(*) FROM gin_docs WHERE doc @> '{"n": 1000}'`, "0")
+	//No keys to look up, every document is a candidate
+	session.expect(`SELECT count(*) FROM gin_docs WHERE doc @> '{}'`, "201")
+	session.expect(`SELECT id FROM gin_docs WHERE doc @> '[2]'`, "203")
+
+	session.expectError("CREATE INDEX ON gin_docs USING gin (id)", "data type bigint has no default operator class for access method \"gin\"")
+	session.expectError("CREATE UNIQUE INDEX ON gin_docs USING gin (doc)", "access method \"gin\" does not support unique indexes")
+
+	//The index is what finds the rows: with its posting lists cut off the search fails
+	rows := session.query("SELECT relpath FROM pg_class WHERE relname = 'gin_docs_idx'")
+	data, err := os.ReadFile(rows[0][0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(rows[0][0], data[:32], 0644); err != nil {
+		t.Fatal(err)
+	}
+	session.expectError(`SELECT id FROM gin_docs WHERE doc @> '{"n": 17}'`, "index \"gin_docs_idx\" is corrupted")
+}
+
+func TestLikePrefixIndexScan(t *testing.T) {
+	session := newTestSession(t)
+	session.run("CREATE TABLE like_words (id bigint, w text)")
+	session.writeRows("like_words", "1,ab", "2,abc", "3,abd", "4,abcd", "5,ac", "6,b", "7,a_c", "8,a%", "9,\\N", "10,ABC")
+	session.run("CREATE INDEX like_words_w ON like_words (w)")
+
+	session.expect("SELECT id FROM like_words WHERE w LIKE 'abc%' ORDER BY id", "2", "4")
+	session.expect("SELECT id FROM like_words WHERE w LIKE 'ab_' ORDER BY id", "2", "3")
+	session.expect("SELECT id FROM like_words WHERE w LIKE 'abc' ORDER BY id", "2")
+	session.expect("SELECT id FROM like_words WHERE w LIKE 'a\\_c' ORDER BY id", "7")
+	session.expect("SELECT id FROM like_words WHERE w LIKE 'a\\%%' ORDER BY id", "8")
+	session.expect("SELECT id FROM like_words WHERE w LIKE '%c' ORDER BY id", "2", "5", "7")
+	session.expect("SELECT id FROM like_words WHERE w LIKE 'a%' AND id > 4 ORDER BY id", "5", "7", "8")
+
+	//An index without entries finds nothing, which shows which conditions it searched with
+	rows := session.query("SELECT relpath FROM pg_class WHERE relname = 'like_words_w'")
+	data, err := os.ReadFile(rows[0][0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	stamp, _, _ := strings.Cut(string(data), "\n")
+	if err := os.WriteFile(rows[0][0], []byte(stamp+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	session.expect("SELECT count(*) FROM like_words WHERE w LIKE 'abc%'", "0")
+	session.expect("SELECT count(*) FROM like_words WHERE w LIKE 'abc'", "0")
+	session.expect("SELECT count(*) FROM like_words WHERE w LIKE '%c'", "3")
+	session.expect("SELECT count(*) FROM like_words WHERE w ILIKE 'abc%'", "3")
+}
+
+func TestUniqueAndCompositeIndexes(t *testing.T) {
+	session := newTestSession(t)
+	session.run("CREATE TABLE idxmulti (a bigint, b text, c bigint)")
+	var lines []string
+	for i := 1; i <= 300; i++ {
+		lines = append(lines, fmt.Sprintf("%d,k%d,%d", i%10, i%7, i))
+	}
+	lines = append(lines, `\N,\N,\N`, `\N,k1,\N`)
+	session.writeRows("idxmulti", lines...)
+
+	queries := []string{
+		"SELECT c FROM idxmulti WHERE c = 42",
+		"SELECT count(*) FROM idxmulti WHERE c >= 100 AND c <= 150",
+		"SELECT c FROM idxmulti WHERE a = 3 AND b = 'k1' ORDER BY c",
+		"SELECT a, b FROM idxmulti WHERE a = 4 ORDER BY a, b DESC LIMIT 3",
+		"SELECT c FROM idxmulti WHERE c % 13 = 5 AND c > 250 ORDER BY c",
+		"SELECT c FROM idxmulti WHERE a = 3 AND c > 280 ORDER BY c",
+		"SELECT count(*) FROM idxmulti WHERE c IS NULL",
+		"SELECT c FROM idxmulti ORDER BY c DESC NULLS LAST LIMIT 2",
+	}
+	session.run("SET enable_indexscan = off")
+	want := make([][][]string, len(queries))
+	for i, query := range queries {
+		want[i] = session.query(query)
+	}
+	session.run("SET enable_indexscan = on")
+
+	session.run("CREATE UNIQUE INDEX idxmulti_c ON idxmulti (c)")
+	session.run("CREATE INDEX idxmulti_ab ON idxmulti (a, b DESC)")
+	session.run("CREATE INDEX idxmulti_expr ON idxmulti ((c % 13))")
+	session.run("CREATE INDEX CONCURRENTLY idxmulti_part ON idxmulti (c) WHERE a = 3")
+	session.run("CREATE INDEX IF NOT EXISTS idxmulti_c ON idxmulti (a)")
+	session.expect("SELECT indisunique, indnatts, indkey FROM pg_index WHERE indexrelid = (SELECT oid FROM pg_class WHERE relname = 'idxmulti_ab')", "f|2|1 2")
+	session.expect("SELECT indisunique, indkey FROM pg_index WHERE indexrelid = (SELECT oid FROM pg_class WHERE relname = 'idxmulti_c')", "t|3")
+	session.expect("SELECT indkey FROM pg_index WHERE indexrelid = (SELECT oid FROM pg_class WHERE relname = 'idxmulti_expr')", "0")
+	for i, query := range queries {
+		if got := session.query(query); fmt.Sprint(got) != fmt.Sprint(want[i]) {
+			t.Errorf("%s: with indexes got %v, want %v", query, got, want[i])
+		}
+	}
+
+	//NULLs are distinct from each other, (a, b) repeats every 70 rows
+	session.expectError("CREATE UNIQUE INDEX idxmulti_a ON idxmulti (a)", `could not create unique index "idxmulti_a": Key (a)=(0) is duplicated`)
+	session.expectError("CREATE UNIQUE INDEX idxmulti_ab2 ON idxmulti (a, b)", `could not create unique index "idxmulti_ab2": Key (a, b)=(0, k0) is duplicated`)
+	session.expect("SELECT count(*) FROM pg_class WHERE relname IN ('idxmulti_a', 'idxmulti_ab2')", "0")
+	session.expectError("CREATE INDEX idxmulti_c ON idxmulti (a)", `relation "idxmulti_c" already exists`)
+	session.expectError("CREATE INDEX ON idxmulti (zz)", `column "zz" does not exist`)
+	session.expectError("CREATE INDEX ON idxmulti ((random() > 0.5))", "functions in index expression must be marked IMMUTABLE")
+	session.expectError("DROP INDEX idxmulti", `"idxmulti" is not an index`)
+
+	//Without its entries the composite index finds nothing, so it is what answers the query
+	rows := session.query("SELECT relpath FROM pg_class WHERE relname = 'idxmulti_ab'")
+	data, err := os.ReadFile(rows[0][0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	stamp, _, _ := strings.Cut(string(data), "\n")
+	if err := os.WriteFile(rows[0][0], []byte(stamp+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	session.expect("SELECT count(*) FROM idxmulti WHERE a = 4 AND b = 'k1'", "0")
+	session.run("SET enable_indexscan = off")
+	session.expect("SELECT count(*) FROM idxmulti WHERE a = 4 AND b = 'k1'", "4")
+	session.run("SET enable_indexscan = on")
+
+	//Rows written after the index was built make it out of date, queries go back to the rows
+	session.writeRows("idxmulti", "1,k1,42", "3,k1,7")
+	session.expect("SELECT a FROM idxmulti WHERE c = 42", "1")
+	session.expect("SELECT c FROM idxmulti WHERE a = 3 AND b = 'k1'", "7")
+
+	session.run("DROP INDEX idxmulti_ab")
+	session.expect("SELECT count(*) FROM pg_indexes WHERE tablename = 'idxmulti'", "3")
+	session.run("DROP TABLE idxmulti")
+	session.expect("SELECT count(*) FROM pg_index WHERE indexrelid NOT IN (SELECT oid FROM pg_class)", "0")
+}
+
+func TestHashIndex(t *testing.T) {
+	session := newTestSession(t)
+	session.run("CREATE TABLE hashidx (id bigint, code text)")
+	var lines []string
+	for i := 1; i <= 2000; i++ {
+		lines = append(lines, fmt.Sprintf("%d,c%d", i, i%500))
+	}
+	lines = append(lines, `2001,\N`)
+	session.writeRows("hashidx", lines...)
+	session.run("CREATE INDEX hashidx_code ON hashidx USING hash (code)")
+	session.expect("SELECT indexdef FROM pg_indexes WHERE indexname = 'hashidx_code'", "CREATE INDEX hashidx_code ON public.hashidx USING hash (code)")
+
+	session.expect("SELECT id FROM hashidx WHERE code = 'c7' ORDER BY id", "7", "507", "1007", "1507")
+	session.expect("SELECT id FROM hashidx WHERE 'c499' = code AND id > 1000 ORDER BY id", "1499", "1999")
+	session.expect("SELECT count(*) FROM hashidx WHERE code = 'none'", "0")
+	session.expect("SELECT count(*) FROM hashidx WHERE code IS NULL", "1")
+	//Hash codes have no order, a range is answered from the rows
+	session.expect("SELECT count(*) FROM hashidx WHERE code < 'c2'", "448")
+
+	session.expectError("CREATE UNIQUE INDEX ON hashidx USING hash (id)", `access method "hash" does not support unique indexes`)
+	session.expectError("CREATE INDEX ON hashidx USING hash (id, code)", `access method "hash" does not support multicolumn indexes`)
+	session.expectError("CREATE INDEX ON hashidx USING hash (id DESC)", `access method "hash" does not support ASC/DESC options`)
+	session.expectError("CREATE INDEX ON hashidx USING nosuch (id)", `access method "nosuch" does not exist`)
+
+	//INSERT and UPDATE add their entries to the index, splitting buckets on the way
+	session.run("INSERT INTO hashidx SELECT id + 2001, code FROM hashidx WHERE id <= 2000")
+	session.run("UPDATE hashidx SET code = 'moved' WHERE code = 'c8'")
+	session.expectIndexesCurrent("hashidx")
+	session.expect("SELECT count(*) FROM hashidx WHERE code = 'c7'", "8")
+	session.expect("SELECT count(*) FROM hashidx WHERE code = 'c8'", "0")
+	session.expect("SELECT min(id), max(id) FROM hashidx WHERE code = 'moved'", "8|3509")
+
+	//Only the metapage is left, the equality search has to read a bucket page that is not there
+	rows := session.query("SELECT relpath FROM pg_class WHERE relname = 'hashidx_code'")
+	data, err := os.ReadFile(rows[0][0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(rows[0][0], data[:4096], 0644); err != nil {
+		t.Fatal(err)
+	}
+	session.expectError("SELECT id FROM hashidx WHERE code = 'c7'", `in index "hashidx_code"`)
+	session.expect("SELECT count(*) FROM hashidx WHERE code < 'c2'", "896")
+}
+
+func TestIndexOnlyScan(t *testing.T) {
+	session := newTestSession(t)
+	session.run("CREATE TABLE ios (id bigint, name text, payload text)")
+	var lines []string
+	for i := 1; i <= 100; i++ {
+		lines = append(lines, fmt.Sprintf("%d,n%03d,p%d", i, i, i))
+	}
+	session.writeRows("ios", lines...)
+	session.run("CREATE UNIQUE INDEX ios_id ON ios (id) INCLUDE (name)")
+	session.expect("SELECT indnatts, indnkeyatts, indkey FROM pg_index WHERE indexrelid = (SELECT oid FROM pg_class WHERE relname = 'ios_id')", "2|1|1 2")
+	session.expect("SELECT indexdef FROM pg_indexes WHERE indexname = 'ios_id'", "CREATE UNIQUE INDEX ios_id ON public.ios USING btree (id) INCLUDE (name)")
+	session.expect("SELECT id, name FROM ios WHERE id >= 98 ORDER BY id", "98|n098", "99|n099", "100|n100")
+
+	//The names change in the relation file but its stamp does not, so only queries reading payload see them
+	rows := session.query("SELECT relpath FROM pg_class WHERE relname = 'ios'")
+	info, err := os.Stat(rows[0][0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(rows[0][0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(rows[0][0], []byte(strings.ReplaceAll(string(data), ",n", ",m")), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(rows[0][0], info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	session.expect("SELECT name FROM ios WHERE id = 3", "n003")
+	session.expect("SELECT count(*) FROM ios WHERE id > 50 AND name LIKE 'n%'", "50")
+	session.expect("SELECT name, payload FROM ios WHERE id = 3", "m003|p3")
+	session.run("SET enable_indexscan = off")
+	session.expect("SELECT name FROM ios WHERE id = 3", "m003")
+	session.run("SET enable_indexscan = on")
+
+	//DELETE leaves its row dead in a page that is no longer all visible, the scan reads the row there and skips
+	//it. VACUUM marks the page all visible again once the index has no entry of it
+	allVisible := func(want bool) {
+		t.Helper()
+		file, err := os.Open(rows[0][0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+		vm, err := access.VisibilityMapOpen(file, rows[0][0], "ios")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !access.VisibilityMapIsCurrent(rows[0][0]) || vm.IsAllVisible(0) != want {
+			t.Errorf("page 0 of \"ios\" all visible is %v, want %v", vm.IsAllVisible(0), want)
+		}
+	}
+	session.run("DELETE FROM ios WHERE id = 5")
+	allVisible(false)
+	session.expect("SELECT id FROM ios WHERE id < 7 ORDER BY id", "1", "2", "3", "4", "6")
+	session.run("VACUUM ios")
+	allVisible(true)
+	session.expect("SELECT id FROM ios WHERE id < 7 ORDER BY id", "1", "2", "3", "4", "6")
+
+	//INCLUDE columns are not part of the key, they can repeat in a unique index
+	session.run("CREATE TABLE ios_dup (id bigint, v text)")
+	session.writeRows("ios_dup", "1,a", "2,a")
+	session.run("CREATE UNIQUE INDEX ios_dup_id ON ios_dup (id) INCLUDE (v)")
+	session.expectError("CREATE UNIQUE INDEX ON ios_dup (v) INCLUDE (id)", "Key (v)=(a) is duplicated")
+	session.expectError("CREATE INDEX ON ios_dup (id) INCLUDE (v DESC)", "including column does not support ASC/DESC options")
+	session.expectError("CREATE INDEX ON ios_dup (id) INCLUDE ((v || 'x'))", "expressions are not supported in included columns")
+	session.expectError("CREATE INDEX ON ios_dup USING hash (id) INCLUDE (v)", `access method "hash" does not support included columns`)
+}
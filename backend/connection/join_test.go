@@ -0,0 +1,40 @@
+package connection
+
+import "testing"
+
+func TestJoins(t *testing.T) {
+	session := newTestSession(t)
+	session.run("CREATE TABLE join_a (id bigint, name text)")
+	session.run("CREATE TABLE join_b (id bigint, a_id bigint, note text)")
+	session.writeRows("join_a", "1,one", "2,two", "3,three")
+	session.writeRows("join_b", "10,1,x", "11,1,y", "12,2,z", "13,9,orphan")
+
+	session.expect("SELECT a.name, b.note FROM join_a a JOIN join_b b ON a.id = b.a_id ORDER BY b.id", "one|x", "one|y", "two|z")
+	session.expect("SELECT a.name, b.note FROM join_a a, join_b b WHERE a.id = b.a_id AND b.note <> 'x' ORDER BY 2", "one|y", "two|z")
+	session.expect("SELECT a.name, b.note FROM join_a a LEFT JOIN join_b b ON a.id = b.a_id ORDER BY a.id, b.id",
+		"one|x", "one|y", "two|z", "three|<NULL>")
+	session.expect("SELECT a.name, b.note FROM join_a a RIGHT OUTER JOIN join_b b ON a.id = b.a_id ORDER BY b.id",
+		"one|x", "one|y", "two|z", "<NULL>|orphan")
+	session.expect("SELECT a.name, b.note FROM join_a a FULL JOIN join_b b ON a.id = b.a_id ORDER BY a.id, b.id",
+		"one|x", "one|y", "two|z", "three|<NULL>", "<NULL>|orphan")
+	session.expect("SELECT count(*) FROM join_a CROSS JOIN join_b", "12")
+	session.expect("SELECT * FROM join_a a JOIN (SELECT a_id AS id, note FROM join_b ORDER BY id DESC) b USING (id) ORDER BY note",
+		"1|one|x", "1|one|y", "2|two|z")
+	session.expect("SELECT id, name, note FROM join_a NATURAL FULL JOIN (SELECT a_id AS id, note FROM join_b) b ORDER BY id",
+		"1|one|x", "1|one|y", "2|two|z", "3|three|<NULL>", "9|<NULL>|orphan")
+	session.expect("SELECT b.*, a.name FROM join_a a JOIN join_b b ON a.id = b.a_id AND b.note = 'z'", "12|2|z|two")
+	session.expect("SELECT x.name, y.name FROM join_a x JOIN (join_b JOIN join_a y ON y.id = join_b.a_id) ON x.id = join_b.a_id - 1",
+		"one|two")
+	session.expect("SELECT a.name, count(b.id) FROM join_a a LEFT JOIN join_b b ON b.a_id = a.id GROUP BY a.name ORDER BY 2 DESC, 1",
+		"one|2", "two|1", "three|0")
+	session.expect("SELECT name FROM join_a a WHERE EXISTS (SELECT 1 FROM join_b b JOIN join_a c ON c.id = b.a_id WHERE b.a_id = a.id AND c.name <> 'two')",
+		"one")
+
+	session.expectError("SELECT id FROM join_a a JOIN join_b b ON a.id = b.a_id", `column reference "id" is ambiguous`)
+	session.expectError("SELECT 1 FROM join_a JOIN join_a ON true", `table name "join_a" specified more than once`)
+	session.expectError("SELECT 1 FROM join_a a JOIN join_b b USING (name)", `column "name" specified in USING clause does not exist in right table`)
+	session.expectError("SELECT 1 FROM join_a a JOIN join_b b ON a.id", "argument of JOIN/ON must be type boolean, not type bigint")
+	session.expectError("SELECT 1 FROM join_a a JOIN join_b b ON count(*) > 0", "aggregate functions are not allowed in JOIN conditions")
+	session.expectError("SELECT 1 FROM join_a a, join_b b JOIN join_a c ON a.id = c.id", `missing FROM-clause entry for table "a"`)
+	session.expectError("SELECT 1 FROM join_a a JOIN join_b b", "syntax error at end of input")
+}
@@ -0,0 +1,48 @@
+package connection
+
+import "testing"
+
+func TestJsonOperators(t *testing.T) {
+	session := newTestSession(t)
+	//json keeps the text as written, jsonb normalizes it
+	session.expect(`SELECT json '{"b": 1,  "a": [1, 2], "b": 2}', jsonb '{"b": 1,  "a": [1, 2], "b": 2}'`,
+		`{"b": 1,  "a": [1, 2], "b": 2}|{"a": [1, 2], "b": 2}`)
+	session.expect(`SELECT json '{"a": {"b": [10, 20]}}' -> 'a' -> 'b' -> 1, jsonb '{"a": {"b": [10, 20]}}' #>> '{a,b,-1}', jsonb '[1,2]' ->> 5`,
+		`20|20|<NULL>`)
+	session.expect(`SELECT jsonb '{"a": 1, "b": null}' ->> 'b', jsonb '"x"' ->> 0, json_typeof('[1]'), jsonb_typeof('1.5'), jsonb_array_length('[1, [2, 3]]')`,
+		`<NULL>|<NULL>|array|number|2`)
+
+	session.expect(`SELECT jsonb '{"a": 1, "b": {"c": [1, 2, 3]}}' @> '{"b": {"c": [3, 1]}}', jsonb '[1, [2]]' @> '[2]', jsonb '{"a": 1}' <@ '{"a": 1, "b": 2}'`,
+		"t|f|t")
+	session.expect(`SELECT jsonb '{"a": 1, "b": 2}' ? 'a', jsonb '["a", "c"]' ?| ARRAY['b', 'c'], jsonb '{"a": 1}' ?& ARRAY['a', 'b']`, "t|t|f")
+	session.expect(`SELECT jsonb '{"a": 1}' || '{"b": 2}', jsonb '[1, 2, 3]' - 1, jsonb '{"a": 1, "b": 2}' - 'a', jsonb '{"a": [1, 2]}' #- '{a,0}'`,
+		`{"a": 1, "b": 2}|[1, 3]|{"b": 2}|{"a": [2]}`)
+	session.expect(`SELECT jsonb_set('{"a": [1, 2]}', '{a,1}', '"x"'), jsonb_strip_nulls('{"a": null, "b": [null]}'), jsonb_build_object('k', 1, 'l', ARRAY[1, 2])`,
+		`{"a": [1, "x"]}|{"b": [null]}|{"k": 1, "l": [1, 2]}`)
+	session.expect(`SELECT to_json(text 'a"b'), to_jsonb(1.50), json_build_array(1, 'x', NULL, true)`, `"a\"b"|1.50|[1, "x", null, true]`)
+
+	session.expectError(`SELECT jsonb '{"a": }'`, `invalid input syntax for type json`)
+	session.expectError(`SELECT json '[1, 2'`, `invalid input syntax for type json`)
+	session.expectError(`SELECT jsonb_array_length('{}')`, "cannot get array length of a non-array")
+	session.expectError(`SELECT jsonb '"\u0000"'`, `unsupported Unicode escape sequence`)
+}
+
+func TestJsonPath(t *testing.T) {
+	session := newTestSession(t)
+	doc := `jsonb '{"items": [{"id": 1, "price": 5.5}, {"id": 2, "price": 20}, {"id": 3}], "owner": "ann"}'`
+	session.expect(`SELECT `+doc+` @? '$.items[*] ? (@.price > 10)', `+doc+` @? '$.items[*] ? (@.price > 100)', `+doc+` @@ '$.owner == "ann"'`,
+		"t|f|t")
+	session.expect(`SELECT `+doc+` @? '$.items[5]', `+doc+` @@ '$.items.size() == 3', `+doc+` @@ 'exists($.items[*].price)'`,
+		"f|t|t")
+	session.expect(`SELECT jsonpath '$.a[*] ? (@ > 1 && @ < 5)', jsonpath 'strict $."key with space"'`,
+		`$."a"[*]?(@ > 1 && @ < 5)|strict $."key with space"`)
+	session.expectError(`SELECT jsonpath '$.a[*'`, "syntax error")
+
+	//jsonb_path_query gives a row per item, in the select list as well as in FROM
+	session.expect(`SELECT jsonb_path_query(`+doc+`, '$.items[*].id')`, "1", "2", "3")
+	session.expect(`SELECT p FROM jsonb_path_query(`+doc+`, '$.items[*] ? (@.price > $min)', '{"min": 5}') AS p`,
+		`{"id": 1, "price": 5.5}`, `{"id": 2, "price": 20}`)
+	session.expect(`SELECT count(*) FROM jsonb_path_query(`+doc+`, '$.missing')`, "0")
+	session.expectError(`SELECT jsonb_path_query(`+doc+`, 'strict $.missing')`, `JSON object does not contain key "missing"`)
+	session.expect(`SELECT count(*) FROM jsonb_path_query(`+doc+`, 'strict $.missing', '{}', true)`, "0")
+}
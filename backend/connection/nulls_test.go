@@ -0,0 +1,43 @@
+package connection
+
+import "testing"
+
+func TestThreeValuedLogic(t *testing.T) {
+	session := newTestSession(t)
+	session.expect("SELECT NULL AND false, NULL AND true, NULL OR true, NULL OR false, NOT (NULL = true)", "f|<NULL>|t|<NULL>|<NULL>")
+	session.expect("SELECT 1 = NULL, NULL <> NULL, NULL + 1, 'a' || NULL", "<NULL>|<NULL>|<NULL>|<NULL>")
+	session.expect("SELECT 1 IN (1, NULL), 2 IN (1, NULL), 2 NOT IN (1, NULL), 2 NOT IN (1, 3), NULL IN (1)", "t|<NULL>|<NULL>|t|<NULL>")
+	session.expect("SELECT NULL IS NULL, 1 IS NOT NULL, (NULL = true) IS UNKNOWN, true IS NOT UNKNOWN", "t|t|t|t")
+	session.expect("SELECT (NULL = true) IS TRUE, (NULL = true) IS NOT TRUE, (NULL = true) IS FALSE, (NULL = true) IS NOT FALSE, false IS NOT TRUE", "f|t|f|t|t")
+	session.expect("SELECT NOT NULL::boolean, NULL::bigint + 1, NULL::boolean IS UNKNOWN, NULL::boolean IS NOT FALSE", "<NULL>|<NULL>|t|t")
+	session.expect("SELECT NULL IS DISTINCT FROM NULL, 1 IS DISTINCT FROM NULL, 1 IS NOT DISTINCT FROM 1, NULL IS NOT DISTINCT FROM 2", "f|t|t|f")
+	session.expect("SELECT CASE WHEN NULL THEN 'yes' ELSE 'no' END, coalesce(NULL, NULL, 3), nullif(1, 1)", "no|3|<NULL>")
+}
+
+func TestNullsInRows(t *testing.T) {
+	session := newTestSession(t)
+	session.writeRows("data", `1,a`, `2,\N`, `3,c`, `4,\N`)
+	vals := "WITH nulls_vals(id, v, b) AS (SELECT 1, 10, true UNION ALL SELECT 2, NULL, false UNION ALL SELECT 3, 30, NULL UNION ALL SELECT 4, NULL, NULL) "
+	session.expect(vals+"SELECT count(*), count(v), sum(v), min(v), max(v) FROM nulls_vals", "4|2|40|10|30")
+	session.expect(vals+"SELECT bool_and(b), bool_or(b), count(b) FROM nulls_vals", "f|t|2")
+	session.expect(vals+"SELECT sum(v), max(v) FROM nulls_vals WHERE v IS NULL", "<NULL>|<NULL>")
+	//WHERE treats NULL like false, so neither a condition nor its negation returns the NULL rows
+	session.expect(vals+"SELECT id FROM nulls_vals WHERE v > 15 ORDER BY id", "3")
+	session.expect(vals+"SELECT id FROM nulls_vals WHERE NOT (v > 15) ORDER BY id", "1")
+	session.expect(vals+"SELECT id FROM nulls_vals WHERE v IS DISTINCT FROM 10 ORDER BY id", "2", "3", "4")
+	session.expect(vals+"SELECT id FROM nulls_vals WHERE b IS NOT TRUE ORDER BY id", "2", "3", "4")
+	session.expect(vals+"SELECT id, v FROM nulls_vals ORDER BY v, id", "1|10", "3|30", "2|<NULL>", "4|<NULL>")
+	session.expect(vals+"SELECT id FROM nulls_vals ORDER BY v DESC, id LIMIT 2", "2", "4")
+	session.expect(vals+"SELECT v, count(*) FROM nulls_vals GROUP BY v ORDER BY v", "10|1", "30|1", "<NULL>|2")
+	session.expect(vals+"SELECT count(DISTINCT v) FROM nulls_vals", "2")
+	session.expect(vals+"SELECT DISTINCT b FROM nulls_vals ORDER BY b", "f", "t", "<NULL>")
+
+	//\N in a relation file is NULL
+	session.expect("SELECT id, data FROM data WHERE data IS NULL ORDER BY id", "2|<NULL>", "4|<NULL>")
+	session.expect("SELECT count(data), string_agg(data, ',') FROM data", "2|a,c")
+
+	session.run("CREATE TABLE nulls_vals (id bigint, v bigint, b boolean)")
+	session.writeRows("nulls_vals", `1,10,t`, `2,\N,f`, `3,30,\N`, `4,\N,\N`)
+	session.expect("SELECT count(*), count(v), sum(v), avg(v), min(v), max(v) FROM nulls_vals", "4|2|40|20.0000000000000000|10|30")
+	session.expect("SELECT id FROM nulls_vals WHERE b IS NOT TRUE ORDER BY id", "2", "3", "4")
+}
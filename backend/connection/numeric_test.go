@@ -0,0 +1,21 @@
+package connection
+
+import "testing"
+
+func TestNumericArithmetic(t *testing.T) {
+	session := newTestSession(t)
+	//Exact, with the display scale of the inputs
+	session.expect("SELECT 0.1 + 0.2, 1.10 * 2, 1.5 - 1.50, 123456789012345678901234567890.5 + 1",
+		"0.3|2.20|0.00|123456789012345678901234567891.5")
+	session.expect("SELECT 1 / 3.0, 10.0 / 4, 2.0 ^ 0.5, 10.5 % 3",
+		"0.33333333333333333333|2.5000000000000000|1.4142135623730950|1.5")
+	session.expectError("SELECT 1.0 / 0", "division by zero")
+
+	session.expect("SELECT numeric 'NaN', numeric 'NaN' = numeric 'NaN', numeric 'NaN' > 1e100, numeric '-Infinity' < -1e100",
+		"NaN|t|t|t")
+	session.expect("SELECT 1.0 = 1.00, numeric '1e2', numeric '  -0.000 '", "t|100|0.000")
+	session.expect("SELECT 12.3450::numeric(10,2), 0.005::numeric(3,2), sqrt(2::numeric)", "12.35|0.01|1.414213562373095")
+	session.expectError("SELECT 123.456::numeric(4,2)", "numeric field overflow")
+	session.expectError("SELECT 1::numeric(1001,0)", "NUMERIC precision 1001 must be between 1 and 1000")
+	session.expectError("SELECT numeric 'abc'", `invalid input syntax for type numeric: "abc"`)
+}
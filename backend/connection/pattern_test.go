@@ -0,0 +1,25 @@
+package connection
+
+import "testing"
+
+func TestPatternMatching(t *testing.T) {
+	session := newTestSession(t)
+	session.expect("SELECT 'abc' LIKE 'a%', 'abc' LIKE '_b_', 'abc' NOT LIKE 'c', 'abc' LIKE 'ab', 'ab' LIKE 'a%b%'", "t|t|t|f|t")
+	session.expect("SELECT 'a%c' LIKE 'a#%c' ESCAPE '#', 'abc' LIKE 'a#%c' ESCAPE '#', 'a_c' LIKE 'a\\_c', 'a\\c' LIKE 'a\\c' ESCAPE ''", "t|f|t|t")
+	session.expect("SELECT 'ABC' ILIKE 'a%', 'ABC' NOT ILIKE 'b%', 'Straße' ILIKE 'STRASSE', NULL LIKE 'a', 'a' LIKE NULL", "t|t|f|<NULL>|<NULL>")
+	session.expect("SELECT 'abc' SIMILAR TO 'abc', 'abc' SIMILAR TO 'a', 'abc' SIMILAR TO '%(b|d)%', 'abc' SIMILAR TO '(b|c)%', 'abc' SIMILAR TO 'a_c', 'abc' SIMILAR TO 'a.c'",
+		"t|f|t|f|t|f")
+	session.expect("SELECT 'aaa' SIMILAR TO 'a{2,3}', 'ab+' SIMILAR TO 'ab#+' ESCAPE '#', 'abc' NOT SIMILAR TO '[a-c]*'", "t|t|f")
+	session.expect("SELECT 'thomas' ~ 't.*ma', 'thomas' ~* 'T.*ma', 'thomas' !~ 't.*max', 'thomas' !~* 'T.*ma', 'thomas' ~ '^hom'", "t|t|t|f|f")
+	session.expect("SELECT regexp_match('foobarbequebaz', '(bar)(beque)'), regexp_match('abc', 'x'), regexp_like('Hello', 'hello', 'i')", "{bar,beque}|<NULL>|t")
+
+	session.writeRows("data", "1,apple", "2,Apricot", "3,banana", "4,grape", "5,\\N")
+	session.expect("SELECT id FROM data WHERE data LIKE 'ap%' ORDER BY id", "1")
+	session.expect("SELECT id FROM data WHERE data ILIKE 'ap%' ORDER BY id", "1", "2")
+	session.expect("SELECT id FROM data WHERE data ~ 'an' OR data SIMILAR TO '%pe' ORDER BY id", "3", "4")
+	session.expect("SELECT count(*) FROM data WHERE data NOT LIKE '%a%'", "1")
+
+	session.expectError("SELECT 'ab' LIKE 'a\\'", "LIKE pattern must not end with escape character")
+	session.expectError("SELECT 'a' LIKE 'a' ESCAPE 'xy'", "invalid escape string")
+	session.expectError("SELECT 'a' ~ '('", "invalid regular expression")
+}
@@ -0,0 +1,53 @@
+package connection
+
+import (
+	"encoding/binary"
+)
+
+/*
+Outgoing message construction, modeled after postgres pqformat.c
+A message is its type byte, a 4 byte length (including itself) and the payload
+*/
+
+type OutputMessage struct {
+	msgType byte
+	data    []byte
+}
+
+func beginMessage(msgType byte) *OutputMessage {
+	return &OutputMessage{msgType: msgType}
+}
+
+func (msg *OutputMessage) sendInt16(value int16) {
+	msg.data = binary.BigEndian.AppendUint16(msg.data, uint16(value))
+}
+
+func (msg *OutputMessage) sendInt32(value int32) {
+	msg.data = binary.BigEndian.AppendUint32(msg.data, uint32(value))
+}
+
+func (msg *OutputMessage) sendBytes(value []byte) {
+	msg.data = append(msg.data, value...)
+}
+
+// sendString writes a null terminated string
+func (msg *OutputMessage) sendString(value string) {
+	msg.data = append(msg.data, value...)
+	msg.data = append(msg.data, 0)
+}
+
+func (msg *OutputMessage) sendByte(value byte) {
+	msg.data = append(msg.data, value)
+}
+
+// endMessage puts the message in the send buffer, it goes out on the next flush
+func (connection *Connection) endMessage(msg *OutputMessage) error {
+	if err := connection.writer.WriteByte(msg.msgType); err != nil {
+		return err
+	}
+	if err := binary.Write(connection.writer, binary.BigEndian, uint32(len(msg.data)+4)); err != nil {
+		return err
+	}
+	_, err := connection.writer.Write(msg.data)
+	return err
+}
@@ -0,0 +1,96 @@
+package connection
+
+import (
+	"fmt"
+
+	"github.com/rautNishan/diskquery/adt"
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+Sending result rows to the client (postgres access/common/printtup.c)
+RowDescription announces the columns, then every row goes out as a DataRow with each value converted
+by its type: the output function for the text format, the send function for binary
+*/
+
+const (
+	FORMAT_TEXT   int16 = 0
+	FORMAT_BINARY int16 = 1
+)
+
+type printtupColumn struct {
+	name   string
+	typ    *adt.TypeEntry
+	format int16
+}
+
+type Printtup struct {
+	connection *Connection
+	columns    []printtupColumn
+}
+
+/*
+startPrinttup sends the RowDescription of the visible columns of targetList
+formats holds a format code per column, a single code for all of them, or none for text (like Bind)
+*/
+func (connection *Connection) startPrinttup(targetList []*types.TargetEntry, formats []int16) (*Printtup, error) {
+	printtup := &Printtup{connection: connection}
+	for _, tle := range targetList {
+		if tle.ResJunk {
+			continue
+		}
+		typ := types.ExprType(tle.Expr)
+		entry := adt.LookupType(typ)
+		if entry == nil {
+			return nil, fmt.Errorf("cache lookup failed for type %d", typ)
+		}
+		printtup.columns = append(printtup.columns, printtupColumn{name: tle.ResName, typ: entry})
+	}
+	for i := range printtup.columns {
+		format := FORMAT_TEXT
+		switch {
+		case len(formats) == 1:
+			format = formats[0]
+		case len(formats) > 1:
+			format = formats[i]
+		}
+		if format == FORMAT_BINARY && printtup.columns[i].typ.Send == nil {
+			return nil, fmt.Errorf("no binary output function available for type %s", printtup.columns[i].typ.Name)
+		}
+		printtup.columns[i].format = format
+	}
+
+	msg := beginMessage(Msg_RowDescription)
+	msg.sendInt16(int16(len(printtup.columns)))
+	for _, column := range printtup.columns {
+		msg.sendString(column.name)
+		msg.sendInt32(0)                     //Table oid
+		msg.sendInt16(0)                     //Column number
+		msg.sendInt32(int32(column.typ.Oid)) //Type oid
+		msg.sendInt16(column.typ.Len)        //Type length
+		msg.sendInt32(-1)                    //Type modifier
+		msg.sendInt16(column.format)         //Format code
+	}
+	return printtup, connection.endMessage(msg)
+}
+
+// receive sends one result row, it is the callback ExecutorRun hands the rows to
+func (printtup *Printtup) receive(tuple types.Tuple) error {
+	msg := beginMessage(Msg_DataRow)
+	msg.sendInt16(int16(len(tuple)))
+	for i, value := range tuple {
+		if value == nil {
+			msg.sendInt32(-1)
+			continue
+		}
+		var data []byte
+		if column := printtup.columns[i]; column.format == FORMAT_BINARY {
+			data = column.typ.Send(value)
+		} else {
+			data = []byte(column.typ.Output(value, &printtup.connection.session.Settings))
+		}
+		msg.sendInt32(int32(len(data)))
+		msg.sendBytes(data)
+	}
+	return printtup.connection.endMessage(msg)
+}
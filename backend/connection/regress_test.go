@@ -0,0 +1,219 @@
+package connection
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+/*
+SQL regression tests (postgres src/test/regress)
+
+Each test opens a session over an in-memory connection and runs statements through the same message loop
+a client gets. The relation files are in a temporary data directory made for the test binary, a test writes
+the rows it queries with writeRows first
+*/
+
+func TestMain(m *testing.M) {
+	dataDir, err := os.MkdirTemp("", "diskquery_regress")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err := os.Chdir(dataDir); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	log.SetOutput(io.Discard)
+	code := m.Run()
+	os.RemoveAll(dataDir)
+	os.Exit(code)
+}
+
+// queryResult is what the backend sent back for a query string
+type queryResult struct {
+	columns  []string
+	typeOids []uint32
+	rows     [][]string //NULL is <NULL>
+	tags     []string
+	err      string
+}
+
+type testSession struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func newTestSession(t *testing.T) *testSession {
+	t.Helper()
+	client, server := net.Pipe()
+	go HandelConnection(server)
+	t.Cleanup(func() { client.Close() })
+	return &testSession{t: t, conn: client, reader: bufio.NewReader(client)}
+}
+
+// exec sends a simple query message and reads the messages up to ReadyForQuery
+func (session *testSession) exec(query string) queryResult {
+	session.t.Helper()
+	payload := append([]byte(query), 0)
+	var msg bytes.Buffer
+	msg.WriteByte(Msg_Query)
+	binary.Write(&msg, binary.BigEndian, uint32(len(payload)+4))
+	msg.Write(payload)
+	if _, err := session.conn.Write(msg.Bytes()); err != nil {
+		session.t.Fatalf("%s: could not send query: %v", query, err)
+	}
+
+	var result queryResult
+	for {
+		msgType, err := session.reader.ReadByte()
+		if err != nil {
+			session.t.Fatalf("%s: could not read response: %v", query, err)
+		}
+		var length uint32
+		if err := binary.Read(session.reader, binary.BigEndian, &length); err != nil {
+			session.t.Fatalf("%s: could not read response: %v", query, err)
+		}
+		data := make([]byte, length-4)
+		if _, err := io.ReadFull(session.reader, data); err != nil {
+			session.t.Fatalf("%s: could not read response: %v", query, err)
+		}
+
+		switch msgType {
+		case Msg_RowDescription:
+			count := int(binary.BigEndian.Uint16(data))
+			data = data[2:]
+			result.columns, result.typeOids = nil, nil
+			for i := 0; i < count; i++ {
+				end := bytes.IndexByte(data, 0)
+				result.columns = append(result.columns, string(data[:end]))
+				result.typeOids = append(result.typeOids, binary.BigEndian.Uint32(data[end+1+6:]))
+				data = data[end+1+18:] //Name terminator and the fixed size column fields
+			}
+		case Msg_DataRow:
+			count := int(binary.BigEndian.Uint16(data))
+			data = data[2:]
+			row := make([]string, count)
+			for i := range row {
+				size := int32(binary.BigEndian.Uint32(data))
+				data = data[4:]
+				if size < 0 {
+					row[i] = "<NULL>"
+					continue
+				}
+				row[i] = string(data[:size])
+				data = data[size:]
+			}
+			result.rows = append(result.rows, row)
+		case Msg_CommandComplete:
+			result.tags = append(result.tags, string(bytes.TrimRight(data, "\x00")))
+		case Msg_ErrorResponse:
+			result.err = responseMessage(data)
+		case Msg_ReadyForQuery:
+			return result
+		}
+	}
+}
+
+// responseMessage is the M field of an ErrorResponse or NoticeResponse
+func responseMessage(data []byte) string {
+	for len(data) > 1 {
+		field := data[0]
+		end := bytes.IndexByte(data[1:], 0)
+		if field == 'M' {
+			return string(data[1 : 1+end])
+		}
+		data = data[end+2:]
+	}
+	return ""
+}
+
+// run executes statements that must succeed
+func (session *testSession) run(query string) queryResult {
+	session.t.Helper()
+	result := session.exec(query)
+	if result.err != "" {
+		session.t.Fatalf("%s: %s", query, result.err)
+	}
+	return result
+}
+
+// query returns the rows of a query that must succeed
+func (session *testSession) query(query string) [][]string {
+	session.t.Helper()
+	return session.run(query).rows
+}
+
+// expect checks the rows of a query, each row given as its values joined with "|"
+func (session *testSession) expect(query string, want ...string) {
+	session.t.Helper()
+	got := make([]string, 0)
+	for _, row := range session.query(query) {
+		got = append(got, strings.Join(row, "|"))
+	}
+	if want == nil {
+		want = []string{}
+	}
+	if !reflect.DeepEqual(got, want) {
+		session.t.Errorf("%s:\n got %q\nwant %q", query, got, want)
+	}
+}
+
+// expectUnordered is expect for a query whose rows come in no particular order
+func (session *testSession) expectUnordered(query string, want ...string) {
+	session.t.Helper()
+	got := make([]string, 0)
+	for _, row := range session.query(query) {
+		got = append(got, strings.Join(row, "|"))
+	}
+	sort.Strings(got)
+	want = append([]string{}, want...)
+	sort.Strings(want)
+	if !reflect.DeepEqual(got, want) {
+		session.t.Errorf("%s:\n got %q\nwant %q", query, got, want)
+	}
+}
+
+/*
+writeRows replaces the rows of a table, a line per row in the format of its relation file: there is no
+INSERT, the rows of a table are written from outside
+*/
+func (session *testSession) writeRows(relname string, lines ...string) {
+	session.t.Helper()
+	rows := session.query("SELECT relpath FROM pg_class WHERE relname = " + quoteLiteral(relname))
+	if len(rows) != 1 {
+		session.t.Fatalf("relation \"%s\" does not exist", relname)
+	}
+	var data strings.Builder
+	for _, line := range lines {
+		data.WriteString(line + "\n")
+	}
+	if err := os.WriteFile(rows[0][0], []byte(data.String()), 0644); err != nil {
+		session.t.Fatal(err)
+	}
+}
+
+func quoteLiteral(str string) string {
+	return "'" + strings.ReplaceAll(str, "'", "''") + "'"
+}
+
+// expectError checks a query fails with an error containing message
+func (session *testSession) expectError(query string, message string) {
+	session.t.Helper()
+	result := session.exec(query)
+	if result.err == "" {
+		session.t.Errorf("%s: no error, want %q", query, message)
+	} else if !strings.Contains(result.err, message) {
+		session.t.Errorf("%s:\n got error %q\nwant %q", query, result.err, message)
+	}
+}
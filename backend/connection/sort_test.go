@@ -0,0 +1,62 @@
+package connection
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestExternalSort(t *testing.T) {
+	session := newTestSession(t)
+	type row struct {
+		id, k int
+		v     string
+	}
+	rows := make([]row, 0, 50000)
+	lines := make([]string, 0, 50000)
+	for i := 0; i < 50000; i++ {
+		r := row{id: i, k: (i * 7919) % 1000, v: fmt.Sprintf("v%05d", (i*104729)%50000)}
+		rows = append(rows, r)
+		lines = append(lines, fmt.Sprintf("%d,%s", r.id, r.v))
+	}
+	session.writeRows("data", lines...)
+
+	//k ascending, then v descending, then id
+	sort.Slice(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		if a.k != b.k {
+			return a.k < b.k
+		}
+		if a.v != b.v {
+			return a.v > b.v
+		}
+		return a.id < b.id
+	})
+	want := make([]string, len(rows))
+	for i, r := range rows {
+		want[i] = fmt.Sprintf("%d|%d", r.k, r.id)
+	}
+
+	//64kB holds a few hundred rows, the sort writes more runs than it merges at once
+	query := "SELECT id * 7919 % 1000 AS k, id FROM data ORDER BY k, data DESC NULLS LAST, id"
+	for _, workMem := range []string{"64MB", "64kB"} {
+		session.run("SET work_mem = '" + workMem + "'")
+		got := session.query(query)
+		if len(got) != len(want) {
+			t.Fatalf("work_mem %s: got %d rows, want %d", workMem, len(got), len(want))
+		}
+		for i, r := range got {
+			if strings.Join(r, "|") != want[i] {
+				t.Fatalf("work_mem %s: row %d is %v, want %s", workMem, i, r, want[i])
+			}
+		}
+		//A bounded sort keeps only the rows LIMIT lets through
+		session.expect(query+" LIMIT 3", want[:3]...)
+		session.expect("SELECT data FROM data ORDER BY data NULLS FIRST, id OFFSET 49999 LIMIT 2", "v49999")
+		session.expect("SELECT id FROM data ORDER BY 1 DESC LIMIT ALL OFFSET 49998", "1", "0")
+	}
+	session.run("RESET work_mem")
+	session.expect("SHOW work_mem", "4MB")
+	session.expectError("SET work_mem = 'lots'", `invalid value for parameter "work_mem": "lots"`)
+}
@@ -0,0 +1,58 @@
+package connection
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestStringConstants(t *testing.T) {
+	session := newTestSession(t)
+	session.expect(`SELECT '\x41'::bytea`, `\x41`)
+	session.expect(`SELECT E'\\x41'::bytea`, `\x41`)
+	session.expect(`SELECT 'it''s', length('a\nb'), length(E'a\nb')`, "it's|4|3")
+	session.expect(`SELECT quote_literal('a\b')`, `E'a\\b'`)
+	if columns := session.run(`SELECT 1 AS "x""y"`).columns; len(columns) != 1 || columns[0] != `x"y` {
+		t.Errorf("column names %q, want [x\"y]", columns)
+	}
+	session.expectError(`SELECT 'abc`, "unterminated quoted string")
+}
+
+func TestStringFunctions(t *testing.T) {
+	session := newTestSession(t)
+	session.expect("SELECT substring('Thomas' FROM 2 FOR 3), substring('Thomas' FROM 3), substring('Thomas', 0, 3), substring('Thomas' FOR 2)", "hom|omas|Th|Th")
+	session.expect("SELECT position('om' IN 'Thomas'), position('x' IN 'Thomas'), strpos('high', 'ig')", "3|0|2")
+	session.expect("SELECT overlay('Txxxxas' PLACING 'hom' FROM 2 FOR 4), overlay('Txxxxas' PLACING 'hom' FROM 2)", "Thomas|Thomxas")
+	session.expect("SELECT trim(BOTH 'xy' FROM 'yxTomxx'), trim(LEADING FROM '  a  '), trim(TRAILING 'x' FROM 'xax'), trim('  a  '), trim('xy' FROM 'xyxay')",
+		"Tom|a  |xa|a|a")
+	session.expect("SELECT lower('TOM'), upper('tom'), initcap('hi THOMAS'), length('jose'), length(NULL)", "tom|TOM|Hi Thomas|4|<NULL>")
+	session.expect("SELECT replace('abcdefabcdef', 'cd', 'XX'), split_part('abc~@~def~@~ghi', '~@~', 2), split_part('a,b', ',', 5)", "abXXefabXXef|def|")
+	session.expect("SELECT regexp_replace('Thomas', '.[mN]a.', 'M'), regexp_replace('foobarbaz', 'b..', 'X', 'g'), regexp_replace('abc', '(b)', '[\\1]')",
+		"ThM|fooXX|a[b]c")
+	session.expect("SELECT concat('abcde', 2, NULL, 22), concat_ws(',', 'abcde', 2, NULL, 22)", "abcde222|abcde,2,22")
+	session.expect("SELECT format('Hello %s, %I, %L, %L', 'World', 'a b', NULL, 'it''s'), format('%2$s %1$s', 'a', 'b')", `Hello World, "a b", NULL, 'it''s'|b a`)
+	session.expect("SELECT lpad('hi', 5, 'xy'), rpad('hi', 5, 'xy'), lpad('hello', 2)", "xyxhi|hixyx|he")
+	session.expect("SELECT greatest(1, 3, 2), least(1, NULL, 2), greatest('b', 'a'), coalesce(NULL, 'x'), nullif(1, 2)", "3|1|b|x|1")
+	session.expectError("SELECT format('%s %s', 'a')", "too few arguments for format()")
+}
+
+func TestMathFunctions(t *testing.T) {
+	session := newTestSession(t)
+	session.expect("SELECT abs(-17.4), abs(-3), abs(float8 '-2.5')", "17.4|3|2.5")
+	session.expect("SELECT round(42.4382, 2), round(2.5), round(-2.5), round(float8 '2.5'), round(1234.5, -2)", "42.44|3|-3|2|1200")
+	session.expect("SELECT ceil(-42.8), floor(-42.8), ceil(float8 '42.2'), trunc(42.8), trunc(42.4382, 2), trunc(-42.8)", "-42|-43|43|42|42.43|-42")
+	session.expect("SELECT sqrt(16), power(2, 10), mod(9, 4), mod(-9, 4), mod(9.5, 4)", "4|1024|1|-1|1.5")
+	session.expect("SELECT random() >= 0 AND random() < 1", "t")
+	session.expectError("SELECT sqrt(-1)", "cannot take square root of a negative number")
+	session.expectError("SELECT mod(1, 0)", "division by zero")
+
+	//smallint and integer columns use the overloads of their own type
+	session.run("CREATE TABLE math_ints (s smallint, i integer)")
+	session.writeRows("math_ints", "-7,-2147483647", "-32768,-2147483648")
+	session.expect("SELECT abs(i), mod(i, i + 2), mod(s, 3::int2), mod(7::int4, 3::int4), abs(-5::int2) FROM math_ints WHERE s = -7",
+		"2147483647|-2|-1|1|5")
+	if got := session.run("SELECT abs(i), mod(s, s), mod(i, s), abs(s) FROM math_ints WHERE s = -7").typeOids; fmt.Sprint(got) != "[23 21 23 21]" {
+		t.Errorf("abs and mod result types = %v, want [23 21 23 21]", got)
+	}
+	session.expectError("SELECT abs(i) FROM math_ints WHERE s = -32768", "integer out of range")
+	session.expectError("SELECT abs(s) FROM math_ints WHERE s = -32768", "smallint out of range")
+}
@@ -0,0 +1,32 @@
+package connection
+
+import "testing"
+
+func TestSubqueries(t *testing.T) {
+	session := newTestSession(t)
+	//Departments have ids below 10, employees are 100 and up with the name of their department
+	session.writeRows("data", "1,eng", "2,ops", "3,sales", "100,eng", "300,eng", "50,ops", "70,none")
+	dept := "SELECT id, data FROM data WHERE id < 10"
+
+	//Scalar subqueries, correlated or not
+	session.expect("SELECT (SELECT max(id) FROM data), (SELECT data FROM data WHERE id = 4)", "300|<NULL>")
+	session.expect("SELECT data, (SELECT sum(e.id) FROM data e WHERE e.data = d.data AND e.id >= 10) FROM data d WHERE id < 10 ORDER BY id",
+		"eng|400", "ops|50", "sales|<NULL>")
+	session.expectError("SELECT (SELECT id FROM data)", "more than one row returned by a subquery used as an expression")
+	session.expectError("SELECT (SELECT id, data FROM data)", "subquery must return only one column")
+
+	session.expect("SELECT data FROM data WHERE id < 10 AND data IN (SELECT data FROM data WHERE id >= 10) ORDER BY 1", "eng", "ops")
+	session.expect("SELECT data FROM data d WHERE id < 10 AND EXISTS (SELECT 1 FROM data e WHERE e.data = d.data AND e.id > 200)", "eng")
+	session.expect("SELECT data FROM data d WHERE id < 10 AND NOT EXISTS (SELECT 1 FROM data e WHERE e.data = d.data AND e.id >= 10)", "sales")
+	//NOT IN over a set with a NULL is never true
+	session.expect("SELECT data FROM data WHERE id < 10 AND id NOT IN (SELECT max(id) FROM data WHERE id > 1000)")
+	session.expect("SELECT data FROM data WHERE id < 10 AND id NOT IN (SELECT id FROM data WHERE id < 3)", "sales")
+	session.expect("SELECT 5 IN (SELECT max(id) FROM data WHERE id > 1000), 1 IN (SELECT id FROM data), 5 NOT IN (SELECT id FROM data WHERE false)",
+		"<NULL>|t|t")
+	session.expect("SELECT id FROM data WHERE id > ALL (SELECT id FROM data WHERE data = 'eng') ORDER BY 1")
+	session.expect("SELECT id FROM data WHERE id >= ALL (SELECT id FROM data WHERE data = 'eng') ORDER BY 1", "300")
+	session.expect("SELECT id FROM data WHERE id < ANY (SELECT id FROM data WHERE data = 'ops') ORDER BY 1", "1", "2", "3")
+	session.expect("SELECT data, n FROM (SELECT data, count(*) AS n FROM data GROUP BY data) e WHERE n > 2", "eng|3")
+	session.expect("SELECT d.data FROM ("+dept+") d WHERE d.id = 2", "ops")
+	session.expectError("SELECT * FROM data WHERE id IN (SELECT id, data FROM data)", "subquery has too many columns")
+}
@@ -0,0 +1,38 @@
+package connection
+
+import "testing"
+
+func TestSystemViews(t *testing.T) {
+	session := newTestSession(t)
+	session.run("CREATE TABLE sysview_t (id bigint, name text, price numeric(8, 2), tags text[])")
+	session.run("CREATE INDEX sysview_t_id ON sysview_t (id)")
+
+	session.expect("SELECT table_schema, table_type FROM information_schema.tables WHERE table_name = 'sysview_t'", "public|BASE TABLE")
+	session.expect("SELECT table_schema, table_type FROM information_schema.tables WHERE table_name = 'columns'", "information_schema|VIEW")
+	session.expect("SELECT column_name, ordinal_position, is_nullable, data_type, numeric_precision, numeric_scale, udt_name FROM information_schema.columns WHERE table_name = 'sysview_t' ORDER BY ordinal_position",
+		"id|1|YES|bigint|64|0|int8", "name|2|YES|text|<NULL>|<NULL>|text", "price|3|YES|numeric|8|2|numeric", "tags|4|YES|ARRAY|<NULL>|<NULL>|_text")
+	session.expect("SELECT schema_name FROM information_schema.schemata WHERE schema_name IN ('public', 'pg_catalog', 'information_schema') ORDER BY schema_name",
+		"information_schema", "pg_catalog", "public")
+	session.expect("SELECT schemaname, hasindexes FROM pg_tables WHERE tablename = 'sysview_t'", "public|t")
+	session.expect("SELECT tablename, indexdef FROM pg_indexes WHERE indexname = 'sysview_t_id'", "sysview_t|CREATE INDEX sysview_t_id ON public.sysview_t USING btree (id)")
+	session.expect("SELECT definition LIKE 'SELECT %' FROM pg_views WHERE viewname = 'pg_tables'", "t")
+
+	//Unique indexes on plain columns are the table's UNIQUE constraints, NOT NULL columns its CHECK constraints
+	session.run("CREATE TABLE sysview_k (a bigint NOT NULL, b text, c text, d bigint)")
+	session.run("CREATE UNIQUE INDEX sysview_k_cb ON sysview_k (c, b) INCLUDE (d)")
+	session.run("CREATE UNIQUE INDEX sysview_k_lower ON sysview_k (lower(b))")
+	session.run("CREATE UNIQUE INDEX sysview_k_partial ON sysview_k (d) WHERE d > 0")
+	session.run("CREATE INDEX sysview_k_a ON sysview_k (a)")
+	session.expect("SELECT constraint_type, constraint_name LIKE '%_not_null', table_schema FROM information_schema.table_constraints WHERE table_name = 'sysview_k' ORDER BY constraint_type",
+		"CHECK|t|public", "UNIQUE|f|public")
+	session.expect("SELECT constraint_name, column_name, ordinal_position FROM information_schema.key_column_usage WHERE table_name = 'sysview_k' ORDER BY ordinal_position",
+		"sysview_k_cb|c|1", "sysview_k_cb|b|2")
+	session.expect(`SELECT tc.constraint_name, kcu.column_name FROM information_schema.table_constraints tc
+		JOIN information_schema.key_column_usage kcu ON kcu.constraint_name = tc.constraint_name AND kcu.table_schema = tc.table_schema
+		WHERE tc.table_name = 'sysview_k' AND tc.constraint_type = 'UNIQUE' ORDER BY kcu.ordinal_position`,
+		"sysview_k_cb|c", "sysview_k_cb|b")
+
+	session.run("DROP TABLE sysview_t")
+	session.expect("SELECT count(*) FROM information_schema.columns WHERE table_name = 'sysview_t'", "0")
+	session.expect("SELECT count(*) FROM pg_indexes WHERE tablename = 'sysview_t'", "0")
+}
@@ -0,0 +1,86 @@
+package connection
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestToastedFieldsAndLookalikes(t *testing.T) {
+	session := newTestSession(t)
+	session.run("CREATE TABLE toast_t (id bigint, v text, w text)")
+	long := strings.Repeat("abcdefghij", 400)
+	session.writeRows("toast_t",
+		`1,`+long+`,x`,
+		`2,`+long+`,`+long,
+		`3,\Cnot base64 at all,\N`,
+		`4,\X1:0:10:10,\C5:abc`)
+	want := []string{"1|4000|x", "2|4000|4000", `3|\Cnot base64 at all|<NULL>`, `4|\X1:0:10:10|\C5:abc`}
+	query := "SELECT id, CASE WHEN length(v) > 100 THEN length(v)::text ELSE v END, CASE WHEN length(w) > 100 THEN length(w)::text ELSE w END FROM toast_t ORDER BY id"
+
+	//Without a toast file nothing is toasted
+	session.expect(query, want...)
+	session.run("VACUUM FULL toast_t")
+	//The long values are toasted now, the lookalikes are still plain values
+	relpath := session.query("SELECT relpath FROM pg_class WHERE relname = 'toast_t'")[0][0]
+	data, err := os.ReadFile(relpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), long) {
+		t.Errorf("VACUUM FULL did not toast the long values:\n%.300s", data)
+	}
+	session.expect(query, want...)
+	session.expect("SELECT count(*) FROM toast_t WHERE v = '"+long+"'", "2")
+	session.run("VACUUM FULL toast_t")
+	session.expect(query, want...)
+}
+
+func TestColumnStorage(t *testing.T) {
+	session := newTestSession(t)
+	session.run("CREATE TABLE toast_storage (id bigint, p text, e text, m text, x text)")
+	session.run("ALTER TABLE toast_storage ALTER COLUMN p SET STORAGE PLAIN, ALTER COLUMN e SET STORAGE EXTERNAL, ALTER m SET STORAGE MAIN")
+	session.expect("SELECT attname, attstorage FROM pg_attribute WHERE attrelid = (SELECT oid FROM pg_class WHERE relname = 'toast_storage') ORDER BY attnum",
+		"id|p", "p|p", "e|e", "m|m", "x|x")
+
+	values := []string{strings.Repeat("plain ", 500), strings.Repeat("external ", 400), strings.Repeat("main ", 600), strings.Repeat("extended ", 400)}
+	session.writeRows("toast_storage", "1,"+strings.Join(values, ","), "2,short,short,short,short")
+	session.run("VACUUM FULL toast_storage")
+
+	relpath := session.query("SELECT relpath FROM pg_class WHERE relname = 'toast_storage'")[0][0]
+	data, err := os.ReadFile(relpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) != 2 || lines[1] != "2,short,short,short,short" {
+		t.Fatalf("relation file after VACUUM FULL:\n%.300s", data)
+	}
+	fields := strings.Split(lines[0], ",")
+	//PLAIN stays in the row, EXTERNAL is moved out as it is, MAIN is compressed in the row, EXTENDED is compressed
+	if fields[1] != values[0] {
+		t.Errorf("PLAIN field was toasted: %.60s", fields[1])
+	}
+	if parts := strings.Split(fields[2], ":"); !strings.HasPrefix(fields[2], `\X`) || len(parts) != 5 || parts[3] != parts[4] {
+		t.Errorf("EXTERNAL field is %.60s, want moved out uncompressed", fields[2])
+	}
+	if !strings.HasPrefix(fields[3], `\C`) {
+		t.Errorf("MAIN field is %.60s, want compressed", fields[3])
+	}
+	if !strings.HasPrefix(fields[4], `\C`) && !strings.HasPrefix(fields[4], `\X`) {
+		t.Errorf("EXTENDED field was not toasted: %.60s", fields[4])
+	}
+	for i, name := range []string{"p", "e", "m", "x"} {
+		session.expect("SELECT "+name+" = "+quoteLiteral(values[i])+", length("+name+") FROM toast_storage WHERE id = 1", "t|"+fmt.Sprint(len(values[i])))
+	}
+	session.expect("SELECT count(*) FROM toast_storage WHERE m LIKE 'main main%' AND x LIKE '%extended '", "1")
+
+	session.expectError("ALTER TABLE toast_storage ALTER COLUMN id SET STORAGE EXTERNAL", "column data type bigint can only have storage PLAIN")
+	session.expectError("ALTER TABLE toast_storage ALTER COLUMN p SET STORAGE fancy", `invalid storage type "fancy"`)
+	session.expectError("ALTER TABLE toast_storage ALTER COLUMN zz SET STORAGE PLAIN", `column "zz" of relation "toast_storage" does not exist`)
+	session.expectError("ALTER TABLE pg_class ALTER COLUMN relname SET STORAGE PLAIN", `permission denied: "pg_class" is a system catalog`)
+	session.run("ALTER TABLE IF EXISTS toast_none ALTER COLUMN v SET STORAGE PLAIN")
+	session.run("ALTER TABLE toast_storage ALTER COLUMN p SET STORAGE DEFAULT")
+	session.expect("SELECT attstorage FROM pg_attribute WHERE attrelid = (SELECT oid FROM pg_class WHERE relname = 'toast_storage') AND attname = 'p'", "x")
+}
@@ -0,0 +1,66 @@
+package connection
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestTypeInputOutput(t *testing.T) {
+	session := newTestSession(t)
+	session.expect("SELECT int '  42 ', smallint '-32768', bigint '9223372036854775807', boolean 'yes', boolean ' OFF '",
+		"42|-32768|9223372036854775807|t|f")
+	session.expectError("SELECT smallint '32768'", `value "32768" is out of range for type smallint`)
+	session.expectError("SELECT int '2147483648'", `value "2147483648" is out of range for type integer`)
+	session.expectError("SELECT int '12a'", `invalid input syntax for type integer: "12a"`)
+	session.expectError("SELECT boolean 'maybe'", `invalid input syntax for type boolean: "maybe"`)
+
+	session.expect("SELECT 7 / 2, -7 / 2, -7 % 3, 7.0 / 2, 2 ^ 10", "3|-3|-1|3.5000000000000000|1024")
+	session.expectError("SELECT bigint '9223372036854775807' + 1", "bigint out of range")
+	session.expectError("SELECT 1 / 0", "division by zero")
+	//Two smallints or integers are combined in their own type, which the result must fit
+	session.expect("SELECT 7::int4 / 2::int4, 3::int2 * 4::int2, -(5::int2)", "3|12|-5")
+	session.expectError("SELECT 2147483647::int4 + 1::int4", "integer out of range")
+	session.expectError("SELECT (-2147483648)::int4 * (-1)::int4", "integer out of range")
+	session.expectError("SELECT (-32768)::int2 / (-1)::int2", "smallint out of range")
+	session.expectError("SELECT -((-32768)::int2)", "smallint out of range")
+	if got := session.run("SELECT 1::int4 + 1::int4, 1::int2 - 1::int2, 1::int2 * 1::int4, 1::int4 + 1").typeOids; fmt.Sprint(got) != "[23 21 23 20]" {
+		t.Errorf("integer arithmetic result types = %v, want [23 21 23 20]", got)
+	}
+	session.expect("SELECT 3.7::int, (-3.5)::int, 2.5::int, '1e3'::float8::bigint", "4|-4|3|1000")
+	//double precision is written out plainly from 1e-4 up to 1e15, with an exponent outside of that
+	session.expect("SELECT 1e6::float8, 123456789012345::float8, 1e15::float8, -2.5e20::float8, 0.0001::float8, 0.00001::float8, 1.5e-7::float8",
+		"1000000|123456789012345|1e+15|-2.5e+20|0.0001|1e-05|1.5e-07")
+	session.expect("SELECT 0.1::float8 + 0.2::float8, 1::float8 / 3, '-0'::float8", "0.30000000000000004|0.3333333333333333|-0")
+	session.expectError("SELECT 'abc'::text::bigint", `invalid input syntax for type bigint: "abc"`)
+
+	session.expect("SELECT '2024-02-29'::date + 1, '2024-03-01'::date - '2024-02-01'::date, '2024-01-31 10:00'::timestamp + interval '1 month'",
+		"2024-03-01|29|2024-02-29 10:00:00")
+	session.expect(`SELECT 'abc'::bytea, '\x00ff'::bytea, 'a\\b'::bytea`, `\x616263|\x00ff|\x615c62`)
+	session.expectError(`SELECT '\x0'::bytea`, "invalid hexadecimal data: odd number of digits")
+	session.expect("SELECT bytea 'abc', date '2024-02-29', timestamp '2024-01-31 10:00'",
+		`\x616263|2024-02-29|2024-01-31 10:00:00`)
+}
+
+func TestTypedColumns(t *testing.T) {
+	session := newTestSession(t)
+	session.writeRows("data", "1,10", "2,9", "10,1")
+
+	//id is a bigint column, data a text column, so they sort and compare as such
+	session.expect("SELECT id FROM data ORDER BY id DESC", "10", "2", "1")
+	session.expect("SELECT data FROM data ORDER BY data", "1", "10", "9")
+	session.expect("SELECT id + 1, data || '!' FROM data WHERE id > 1 ORDER BY id", "3|9!", "11|1!")
+}
+
+func TestColumnTypes(t *testing.T) {
+	session := newTestSession(t)
+	session.run("CREATE TABLE types_cols (i smallint, n numeric(5,2), v text, b boolean, d date)")
+	session.writeRows("types_cols", "1,1.50,abc,t,2024-01-01", "\\N,\\N,\\N,\\N,\\N")
+	session.expect("SELECT i + 1, n, v, NOT b, d FROM types_cols ORDER BY i", "2|1.50|abc|f|2024-01-01", "<NULL>|<NULL>|<NULL>|<NULL>|<NULL>")
+	session.expect("SELECT attname, format_type(atttypid, atttypmod) FROM pg_attribute WHERE attrelid = (SELECT oid FROM pg_class WHERE relname = 'types_cols') AND attnum > 0 ORDER BY attnum",
+		"i|smallint", "n|numeric(5,2)", "v|text", "b|boolean", "d|date")
+	//psql and the drivers qualify the functions they call with pg_catalog
+	session.expect("SELECT pg_catalog.format_type(atttypid, NULL), pg_catalog.upper(attname) FROM pg_catalog.pg_attribute WHERE attrelid = 'types_cols'::pg_catalog.regclass AND attnum = 2", "numeric|N")
+	session.expect("SELECT count(*) FROM pg_catalog.unnest(ARRAY[1, 2, 3])", "3")
+	session.expectError("SELECT public.format_type(23, NULL)", "function public.format_type does not exist")
+	session.expectError("CREATE TABLE types_bad (x nosuchtype)", `type "nosuchtype" does not exist`)
+}
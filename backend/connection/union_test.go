@@ -0,0 +1,29 @@
+package connection
+
+import "testing"
+
+func TestSetOperations(t *testing.T) {
+	session := newTestSession(t)
+	//Rows below 10 are one side, the rest the other
+	session.writeRows("data", "1,1", "2,1", "3,2", "4,3", "11,1", "12,3", "13,3", "14,4")
+	a := "SELECT data FROM data WHERE id < 10"
+	b := "SELECT data FROM data WHERE id > 10"
+
+	session.expect(a+" UNION "+b+" ORDER BY 1", "1", "2", "3", "4")
+	session.expect(a+" UNION ALL "+b+" ORDER BY 1", "1", "1", "1", "2", "3", "3", "3", "4")
+	session.expect(a+" INTERSECT "+b+" ORDER BY 1", "1", "3")
+	session.expect(a+" INTERSECT ALL "+b+" ORDER BY 1", "1", "3")
+	session.expect(a+" EXCEPT "+b+" ORDER BY 1", "2")
+	session.expect(a+" EXCEPT ALL "+b+" ORDER BY 1", "1", "2")
+	session.expect(b+" EXCEPT ALL "+a+" ORDER BY 1", "3", "4")
+
+	//INTERSECT binds tighter than UNION and EXCEPT, which go left to right
+	session.expect("SELECT 1 UNION SELECT 2 INTERSECT SELECT 3 ORDER BY 1", "1")
+	session.expect("SELECT 1 UNION SELECT 2 EXCEPT SELECT 1", "2")
+	session.expect("("+a+" UNION "+b+") ORDER BY data DESC NULLS LAST LIMIT 2", "4", "3")
+	//The result columns take the common type of both sides
+	session.expect("SELECT 1 UNION ALL SELECT 2.5 ORDER BY 1", "1", "2.5")
+
+	session.expectError("SELECT 1 UNION SELECT 1, 2", "each UNION query must have the same number of columns")
+	session.expectError("SELECT 1 INTERSECT SELECT true", "INTERSECT types bigint and boolean cannot be matched")
+}
@@ -0,0 +1,123 @@
+package connection
+
+import (
+	"github.com/rautNishan/diskquery/catalog"
+	"github.com/rautNishan/diskquery/commands"
+	"github.com/rautNishan/diskquery/guc"
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+Utility statements are everything that is not planned and executed as a query
+(postgres tcop/utility.c), they are run directly here
+*/
+
+// isUtilityStmt tells if a parse tree bypasses the planner
+func isUtilityStmt(parseTree types.Node) bool {
+	switch parseTree.(type) {
+	case *types.VariableSetStmt, *types.VariableShowStmt, *types.AlterSystemStmt, *types.CreateStmt, *types.DropStmt, *types.IndexStmt,
+		*types.VacuumStmt, *types.AlterTableStmt:
+		return true
+	}
+	return false
+}
+
+func (connection *Connection) processUtility(parseTree types.Node) error {
+	switch stmt := parseTree.(type) {
+	case *types.VariableSetStmt:
+		return connection.execSetVariable(stmt)
+	case *types.VariableShowStmt:
+		return connection.execShowVariable(stmt)
+	case *types.AlterSystemStmt:
+		var value *string
+		if stmt.Setstmt.Kind == types.VAR_SET_VALUE {
+			value = &stmt.Setstmt.Value
+		}
+		if err := guc.AlterSystemSetConfigOption(stmt.Setstmt.Name, value); err != nil {
+			return err
+		}
+		connection.sendCommandComplete("ALTER SYSTEM")
+	case *types.CreateStmt:
+		if err := catalog.DefineRelation(stmt, connection.session.DefaultTableAccessMethod); err != nil {
+			return err
+		}
+		connection.sendCommandComplete("CREATE TABLE")
+	case *types.DropStmt:
+		if err := catalog.RemoveRelations(stmt); err != nil {
+			return err
+		}
+		if stmt.RemoveType == types.OBJECT_INDEX {
+			connection.sendCommandComplete("DROP INDEX")
+		} else {
+			connection.sendCommandComplete("DROP TABLE")
+		}
+	case *types.IndexStmt:
+		if err := commands.DefineIndex(stmt); err != nil {
+			return err
+		}
+		connection.sendCommandComplete("CREATE INDEX")
+	case *types.AlterTableStmt:
+		if err := catalog.AlterTable(stmt); err != nil {
+			return err
+		}
+		connection.sendCommandComplete("ALTER TABLE")
+	case *types.VacuumStmt:
+		if err := commands.ExecVacuum(stmt, connection.sendNotice); err != nil {
+			return err
+		}
+		connection.sendCommandComplete("VACUUM")
+	}
+	return nil
+}
+
+func (connection *Connection) execSetVariable(stmt *types.VariableSetStmt) error {
+	var err error
+	if stmt.Kind == types.VAR_SET_VALUE {
+		err = connection.session.SetConfigOption(stmt.Name, stmt.Value)
+	} else {
+		err = connection.session.ResetConfigOption(stmt.Name)
+	}
+	if err != nil {
+		return err
+	}
+	if stmt.Kind == types.VAR_RESET {
+		connection.sendCommandComplete("RESET")
+	} else {
+		connection.sendCommandComplete("SET")
+	}
+	return nil
+}
+
+func (connection *Connection) execShowVariable(stmt *types.VariableShowStmt) error {
+	if stmt.Name == "all" {
+		printtup, err := connection.startPrinttup(textColumns("name", "setting", "description"), nil)
+		if err != nil {
+			return err
+		}
+		for _, opt := range connection.session.GetAllConfigOptions() {
+			printtup.receive(types.Tuple{opt.Name, opt.Setting, opt.Description})
+		}
+		connection.sendCommandComplete("SHOW")
+		return nil
+	}
+
+	value, err := connection.session.GetConfigOption(stmt.Name)
+	if err != nil {
+		return err
+	}
+	printtup, err := connection.startPrinttup(textColumns(stmt.Name), nil)
+	if err != nil {
+		return err
+	}
+	printtup.receive(types.Tuple{value})
+	connection.sendCommandComplete("SHOW")
+	return nil
+}
+
+func textColumns(names ...string) []*types.TargetEntry {
+	columns := make([]*types.TargetEntry, len(names))
+	for i, name := range names {
+		columns[i] = &types.TargetEntry{Expr: &types.Const{ConstType: types.TEXTOID}, ResName: name}
+	}
+	return columns
+}
@@ -0,0 +1,35 @@
+package connection
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestUuid(t *testing.T) {
+	session := newTestSession(t)
+	session.expect("SELECT uuid 'A0EEBC99-9C0B-4EF8-BB6D-6BB9BD380A11', uuid '{a0eebc99-9c0b4ef8-bb6d6bb9-bd380a11}', uuid 'a0eebc999c0b4ef8bb6d6bb9bd380a11'",
+		"a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11|a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11|a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11")
+	session.expect("SELECT uuid '00000000-0000-0000-0000-000000000001' < uuid 'ffffffff-0000-0000-0000-000000000000', uuid 'a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11' = 'A0EEBC99-9C0B-4EF8-BB6D-6BB9BD380A11'",
+		"t|t")
+	session.expect("SELECT gen_random_uuid()::text ~ '^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$', uuid_extract_version(gen_random_uuid()), gen_random_uuid() <> gen_random_uuid()",
+		"t|4|t")
+	session.expect("SELECT uuid_extract_version(uuidv7()), uuid_extract_timestamp(uuidv7()) > now() - interval '1 minute', uuidv7() < uuidv7()", "7|t|t")
+	session.expect("SELECT uuid_extract_timestamp('a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11'), uuid_extract_version('a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11')", "<NULL>|4")
+	session.expectError("SELECT uuid 'a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a1'", `invalid input syntax for type uuid: "a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a1"`)
+	session.expectError("SELECT uuid 'a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a1g'", "invalid input syntax for type uuid")
+
+	session.run("CREATE TABLE uuid_keys (id uuid, n bigint)")
+	var lines []string
+	for i := 1; i <= 300; i++ {
+		lines = append(lines, fmt.Sprintf("%08x-0000-4000-8000-%012x,%d", 301-i, i, i))
+	}
+	lines = append(lines, `\N,0`)
+	session.writeRows("uuid_keys", lines...)
+	session.expect("SELECT n FROM uuid_keys ORDER BY id LIMIT 2", "300", "299")
+	session.expect("SELECT count(DISTINCT id), count(id) FROM uuid_keys", "300|300")
+	session.run("CREATE INDEX uuid_keys_id ON uuid_keys (id)")
+	session.expect("SELECT n FROM uuid_keys WHERE id = '00000003-0000-4000-8000-00000000012a'", "298")
+	session.expect("SELECT count(*) FROM uuid_keys WHERE id < '00000003-0000-4000-8000-000000000000'", "2")
+	session.run("CREATE INDEX uuid_keys_hash ON uuid_keys USING hash (id)")
+	session.expect("SELECT n FROM uuid_keys WHERE id = '00000001-0000-4000-8000-00000000012c'", "300")
+}
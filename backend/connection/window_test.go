@@ -0,0 +1,47 @@
+package connection
+
+import "testing"
+
+func TestWindowFunctions(t *testing.T) {
+	session := newTestSession(t)
+	with := "WITH win_s(id, grp, v) AS (SELECT 1, 'a', 10 UNION ALL SELECT 2, 'a', 20 UNION ALL SELECT 3, 'a', 20 UNION ALL SELECT 4, 'a', 40 UNION ALL SELECT 5, 'b', 5 UNION ALL SELECT 6, 'b', NULL) "
+
+	session.expect(with+"SELECT id, row_number() OVER w, rank() OVER w, dense_rank() OVER w, percent_rank() OVER w, cume_dist() OVER w FROM win_s WHERE grp = 'a' WINDOW w AS (ORDER BY v) ORDER BY id",
+		"1|1|1|1|0|0.25", "2|2|2|2|0.3333333333333333|0.75", "3|3|2|2|0.3333333333333333|0.75", "4|4|4|3|1|1")
+	session.expect(with+"SELECT id, ntile(3) OVER (ORDER BY id), lag(v) OVER (ORDER BY id), lead(v, 2, -1) OVER (ORDER BY id) FROM win_s ORDER BY id",
+		"1|1|<NULL>|20", "2|1|10|40", "3|2|20|5", "4|2|20|<NULL>", "5|3|40|-1", "6|3|5|-1")
+	session.expect(with+"SELECT id, sum(v) OVER (PARTITION BY grp), count(v) OVER (PARTITION BY grp ORDER BY id), first_value(id) OVER (PARTITION BY grp ORDER BY v DESC) FROM win_s ORDER BY id",
+		"1|90|1|4", "2|90|2|4", "3|90|3|4", "4|90|4|4", "5|5|1|6", "6|5|1|6")
+}
+
+func TestWindowFrames(t *testing.T) {
+	session := newTestSession(t)
+	with := "WITH win_f(id, v) AS (SELECT 1, 1 UNION ALL SELECT 2, 2 UNION ALL SELECT 3, 2 UNION ALL SELECT 4, 4 UNION ALL SELECT 5, 7) "
+
+	//The default frame with ORDER BY ends at the last peer of the current row
+	session.expect(with+"SELECT id, sum(v) OVER (ORDER BY v), last_value(id) OVER (ORDER BY v) FROM win_f ORDER BY id",
+		"1|1|1", "2|5|3", "3|5|3", "4|9|4", "5|16|5")
+	session.expect(with+"SELECT id, sum(v) OVER (ORDER BY id ROWS BETWEEN 1 PRECEDING AND 1 FOLLOWING) FROM win_f ORDER BY id",
+		"1|3", "2|5", "3|8", "4|13", "5|11")
+	session.expect(with+"SELECT id, sum(v) OVER (ORDER BY v RANGE BETWEEN 1 PRECEDING AND CURRENT ROW) FROM win_f ORDER BY id",
+		"1|1", "2|5", "3|5", "4|4", "5|7")
+	session.expect(with+"SELECT id, sum(v) OVER (ORDER BY v GROUPS BETWEEN 1 PRECEDING AND 1 FOLLOWING) FROM win_f ORDER BY id",
+		"1|5", "2|9", "3|9", "4|15", "5|11")
+	session.expect(with+"SELECT id, sum(v) OVER (ORDER BY id ROWS BETWEEN CURRENT ROW AND UNBOUNDED FOLLOWING) FROM win_f ORDER BY id",
+		"1|16", "2|15", "3|13", "4|11", "5|7")
+	session.expect(with+"SELECT id, nth_value(id, 2) OVER (ORDER BY id ROWS BETWEEN UNBOUNDED PRECEDING AND UNBOUNDED FOLLOWING) FROM win_f WHERE id < 3 ORDER BY id",
+		"1|2", "2|2")
+
+	//EXCLUDE takes rows out of the middle of the frame
+	session.expect(with+"SELECT id, sum(v) OVER (ORDER BY v ROWS BETWEEN UNBOUNDED PRECEDING AND UNBOUNDED FOLLOWING EXCLUDE CURRENT ROW) FROM win_f ORDER BY id",
+		"1|15", "2|14", "3|14", "4|12", "5|9")
+	session.expect(with+"SELECT id, sum(v) OVER (ORDER BY v ROWS BETWEEN UNBOUNDED PRECEDING AND UNBOUNDED FOLLOWING EXCLUDE GROUP) FROM win_f ORDER BY id",
+		"1|15", "2|12", "3|12", "4|12", "5|9")
+	session.expect(with+"SELECT id, sum(v) OVER (ORDER BY v ROWS BETWEEN UNBOUNDED PRECEDING AND UNBOUNDED FOLLOWING EXCLUDE TIES) FROM win_f ORDER BY id",
+		"1|16", "2|14", "3|14", "4|16", "5|16")
+
+	session.expectError(with+"SELECT sum(v) OVER (ORDER BY id ROWS BETWEEN -1 PRECEDING AND CURRENT ROW) FROM win_f", "frame starting offset must not be negative")
+	session.expectError(with+"SELECT sum(v) OVER (ROWS BETWEEN CURRENT ROW AND 1 PRECEDING) FROM win_f", "frame starting from current row cannot have preceding rows")
+	session.expectError(with+"SELECT sum(v) OVER (RANGE BETWEEN 1 PRECEDING AND CURRENT ROW) FROM win_f", "RANGE with offset PRECEDING/FOLLOWING requires exactly one ORDER BY column")
+	session.expectError(with+"SELECT id FROM win_f WHERE row_number() OVER () > 1", "window functions are not allowed in WHERE")
+}
@@ -0,0 +1,85 @@
+package connection
+
+import (
+	"testing"
+)
+
+func TestWith(t *testing.T) {
+	session := newTestSession(t)
+	//The parent of a node is the one at half its id
+	session.writeRows("data", "1,root", "2,a", "3,b", "4,c", "5,d")
+
+	session.expect("WITH big AS (SELECT id FROM data WHERE id > 2) SELECT count(*), sum(id) FROM big", "3|12")
+	session.expect("WITH a AS (SELECT 1 AS x), b AS (SELECT x + 1 AS y FROM a) SELECT y FROM b", "2")
+	session.expect("WITH m AS MATERIALIZED (SELECT data FROM data WHERE id = 3), n AS NOT MATERIALIZED (SELECT data FROM m) SELECT data FROM n", "b")
+	session.expect(`WITH RECURSIVE up(id, depth) AS (
+			SELECT 5, 0
+			UNION ALL
+			SELECT (SELECT id / 2 FROM data t WHERE t.id = up.id), depth + 1 FROM up WHERE id > 1
+		) SELECT id, depth FROM up`,
+		"5|0", "2|1", "1|2")
+	//UNION drops the rows seen before, so the walk around a cycle ends
+	session.expect("WITH RECURSIVE r(n) AS (SELECT 1 UNION SELECT (n + 1) % 3 FROM r) SELECT n FROM r ORDER BY n", "0", "1", "2")
+	session.expect("WITH RECURSIVE r(n) AS (SELECT 1 UNION ALL SELECT n + 1 FROM r WHERE n < 5) SELECT sum(n) FROM r", "15")
+	session.expect("WITH RECURSIVE r(n) AS (SELECT id FROM data WHERE id = 1 UNION ALL SELECT n * 2 FROM r WHERE n < 4) SELECT n FROM r", "1", "2", "4")
+
+	session.expectError("WITH RECURSIVE r(n) AS (SELECT n FROM r) SELECT * FROM r",
+		`recursive query "r" does not have the form non-recursive-term UNION [ALL] recursive-term`)
+	session.expectError("WITH a AS (SELECT 1), a AS (SELECT 2) SELECT 1", `WITH query name "a" specified more than once`)
+	session.expectError("WITH a(x, y) AS (SELECT 1) SELECT 1", `WITH query "a" has 1 columns available but 2 columns specified`)
+}
+
+func TestRecursiveCycle(t *testing.T) {
+	session := newTestSession(t)
+	session.run("CREATE TABLE cycle_graph (f bigint, t bigint)")
+	session.writeRows("cycle_graph", "1,2", "2,1")
+
+	//UNION ALL around 1 -> 2 -> 3 -> 4 -> 5 -> 1 ends because the row that closes the cycle is marked
+	session.expect(`WITH RECURSIVE walk(n) AS (
+			SELECT 1
+			UNION ALL
+			SELECT (n % 5) + 1 FROM walk WHERE n < 100
+		) CYCLE n SET is_cycle USING path
+		SELECT n, is_cycle, path FROM walk`,
+		"1|f|{(1)}",
+		"2|f|{(1),(2)}",
+		"3|f|{(1),(2),(3)}",
+		"4|f|{(1),(2),(3),(4)}",
+		"5|f|{(1),(2),(3),(4),(5)}",
+		"1|t|{(1),(2),(3),(4),(5),(1)}")
+
+	session.expect(`WITH RECURSIVE walk(a, b) AS (
+			SELECT 0, 'x y'
+			UNION ALL
+			SELECT (a + 1) % 2, b FROM walk
+		) CYCLE a, b SET looped TO 'Y' DEFAULT 'N' USING trail
+		SELECT a, looped, trail FROM walk`,
+		`0|N|{"(0,\"x y\")"}`,
+		`1|N|{"(0,\"x y\")","(1,\"x y\")"}`,
+		`0|Y|{"(0,\"x y\")","(1,\"x y\")","(0,\"x y\")"}`)
+
+	//1, 2, 4 and then 2 again, CYCLE on some of the columns
+	session.expect(`WITH RECURSIVE walk(n, depth) AS (
+			SELECT 1, 0
+			UNION
+			SELECT n * 2 % 6, depth + 1 FROM walk
+		) CYCLE n SET is_cycle USING path
+		SELECT count(*), max(depth), sum(CASE WHEN is_cycle THEN 1 ELSE 0 END) FROM walk`,
+		"4|3|1")
+
+	session.expectError(`WITH RECURSIVE w(n) AS (SELECT 1 UNION ALL SELECT n + 1 FROM w) CYCLE m SET c USING p SELECT * FROM w`,
+		`cycle column "m" not in WITH query column list`)
+	session.expectError(`WITH RECURSIVE w(n) AS (SELECT 1 UNION ALL SELECT n + 1 FROM w) CYCLE n, n SET c USING p SELECT * FROM w`,
+		`cycle column "n" specified more than once`)
+	session.expectError(`WITH RECURSIVE w(n) AS (SELECT 1 UNION ALL SELECT n + 1 FROM w) CYCLE n SET n USING p SELECT * FROM w`,
+		`cycle mark column name "n" already used in WITH query column list`)
+	session.expectError(`WITH RECURSIVE w(n) AS (SELECT 1 UNION ALL SELECT n + 1 FROM w) CYCLE n SET c USING c SELECT * FROM w`,
+		"cycle mark column name and cycle path column name are the same")
+	session.expectError(`WITH RECURSIVE w(n) AS (SELECT 1 UNION ALL SELECT n + 1 FROM w) CYCLE n SET c TO 1 DEFAULT true USING p SELECT * FROM w`,
+		"CYCLE types bigint and boolean cannot be matched")
+	session.expectError(`WITH RECURSIVE w(n) AS (SELECT 1) CYCLE n SET c USING p SELECT * FROM w`, "WITH query is not recursive")
+	session.expectError(`WITH RECURSIVE w(n) AS (SELECT 1 UNION ALL SELECT t FROM cycle_graph WHERE f IN (SELECT n FROM w)) CYCLE n SET c USING p SELECT * FROM w`,
+		`with a SEARCH or CYCLE clause, the recursive reference to WITH query "w" must be at the top level of its right-hand SELECT`)
+	session.expectError(`WITH RECURSIVE w(n) AS (SELECT 1 UNION ALL SELECT n + 1 FROM w) SEARCH DEPTH FIRST BY n SET s SELECT * FROM w`,
+		"SEARCH in a recursive query is not implemented")
+}
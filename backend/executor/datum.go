@@ -0,0 +1,61 @@
+package executor
+
+import (
+	"encoding/binary"
+
+	"github.com/rautNishan/diskquery/adt"
+	"github.com/rautNishan/diskquery/types"
+)
+
+// datumSize is a rough estimate of the memory a datum takes, used for work_mem accounting
+func datumSize(d types.Datum) int {
+	switch v := d.(type) {
+	case string:
+		return 16 + len(v)
+	case []byte:
+		return 24 + len(v)
+	case adt.Numeric:
+		return 64
+	case adt.Interval:
+		return 24
+	case adt.Json:
+		return 16 + len(v)
+	case *adt.Jsonb:
+		return adt.JsonbSize(v)
+	case []types.Datum:
+		size := 24
+		for _, elem := range v {
+			size += datumSize(elem)
+		}
+		return size
+	}
+	return 16
+}
+
+func tupleSize(tuple types.Tuple) int {
+	size := 24
+	for _, d := range tuple {
+		size += datumSize(d)
+	}
+	return size
+}
+
+/*
+hashKey is the key of values in a hash table (grouping, hash joins, duplicate removal)
+Values that are equal for their type get the same key even if they differ otherwise, like 1.0 and 1.00
+*/
+func hashKey(values []types.Datum) (string, error) {
+	buf := binary.AppendUvarint(nil, uint64(len(values)))
+	for _, d := range values {
+		if d == nil {
+			buf = append(buf, 0)
+			continue
+		}
+		buf = append(buf, 1)
+		var err error
+		if buf, err = adt.HashDatum(buf, d); err != nil {
+			return "", err
+		}
+	}
+	return string(buf), nil
+}
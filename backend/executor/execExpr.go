@@ -0,0 +1,588 @@
+package executor
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/rautNishan/diskquery/adt"
+	"github.com/rautNishan/diskquery/types"
+)
+
+// ExecEvalExpr evaluates a primitive expression, a nil Datum is SQL NULL
+func ExecEvalExpr(expr types.Node, econtext *ExprContext) (types.Datum, error) {
+	switch e := expr.(type) {
+	case *types.Const:
+		return e.Val, nil
+
+	case *types.Var:
+		if e.AttNo >= len(econtext.ScanTuple) {
+			return nil, fmt.Errorf("attribute number %d exceeds number of columns %d", e.AttNo+1, len(econtext.ScanTuple))
+		}
+		return econtext.ScanTuple[e.AttNo], nil
+
+	case *types.Aggref:
+		if econtext.AggValues == nil {
+			return nil, fmt.Errorf("aggregate %s evaluated outside of an Agg node", e.AggName)
+		}
+		return econtext.AggValues[e.AggNo], nil
+
+	case *types.OpExpr:
+		return execEvalOpExpr(e, econtext)
+
+	case *types.FuncExpr:
+		return execEvalFuncExpr(e, econtext)
+
+	case *types.BoolExpr:
+		return execEvalBoolExpr(e, econtext)
+
+	case *types.NullTest:
+		arg, err := ExecEvalExpr(e.Arg, econtext)
+		if err != nil {
+			return nil, err
+		}
+		return (arg == nil) == (e.NullTestType == types.IS_NULL), nil
+
+	case *types.BooleanTest:
+		return execEvalBooleanTest(e, econtext)
+
+	case *types.DistinctExpr:
+		return execEvalDistinct(e, econtext)
+
+	case *types.NullIfExpr:
+		return execEvalNullIf(e, econtext)
+
+	case *types.CoalesceExpr:
+		//Arguments after the first one that is not NULL are not evaluated
+		for _, argExpr := range e.Args {
+			arg, err := ExecEvalExpr(argExpr, econtext)
+			if err != nil || arg != nil {
+				return arg, err
+			}
+		}
+		return nil, nil
+
+	case *types.MinMaxExpr:
+		return execEvalMinMax(e, econtext)
+
+	case *types.CaseExpr:
+		return execEvalCase(e, econtext)
+
+	case *types.CaseTestExpr:
+		return econtext.CaseValue, nil
+
+	case *types.ArrayExpr:
+		return execEvalArrayExpr(e, econtext)
+
+	case *types.RowExpr:
+		values := make([]types.Datum, len(e.Args))
+		for i, arg := range e.Args {
+			value, err := ExecEvalExpr(arg, econtext)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = value
+		}
+		return adt.RecordOut(values, econtext.EState.settings), nil
+
+	case *types.SubscriptingRef:
+		return execEvalSubscriptingRef(e, econtext)
+
+	case *types.ScalarArrayOpExpr:
+		return execEvalScalarArrayOp(e, econtext)
+
+	case *types.CoerceExpr:
+		arg, err := ExecEvalExpr(e.Arg, econtext)
+		if err != nil || arg == nil {
+			return nil, err
+		}
+		result, err := adt.CoerceDatum(arg, types.ExprType(e.Arg), e.ResultType, econtext.EState.settings)
+		if err != nil {
+			return nil, err
+		}
+		return adt.ApplyTypmod(result, e.ResultType, e.ResultTypmod)
+
+	case *types.Param:
+		return econtext.EState.ParamExecVals[e.ParamId], nil
+
+	case *types.SubPlan:
+		return execEvalSubPlan(e, econtext)
+	}
+	return nil, fmt.Errorf("unrecognized expression node type: %T", expr)
+}
+
+func execEvalOpExpr(op *types.OpExpr, econtext *ExprContext) (types.Datum, error) {
+	args := make([]types.Datum, len(op.Args))
+	for i, argExpr := range op.Args {
+		arg, err := ExecEvalExpr(argExpr, econtext)
+		if err != nil {
+			return nil, err
+		}
+		//All our operators are strict, NULL in gives NULL out
+		if arg == nil {
+			return nil, nil
+		}
+		args[i] = arg
+	}
+	result, err := applyOperator(op.Op, op.Opno, args, econtext.EState.settings)
+	if err != nil || op.Opno != types.InvalidOid {
+		return result, err
+	}
+	//The executor's own arithmetic is done in bigint, a smallint or integer result must still fit its type
+	if op.ResultType == types.INT2OID || op.ResultType == types.INT4OID {
+		return adt.CoerceDatum(result, types.INT8OID, op.ResultType, econtext.EState.settings)
+	}
+	return result, nil
+}
+
+// applyOperator runs an operator on non NULL arguments, Opno is InvalidOid for the executor's own operators
+func applyOperator(op string, opno types.Oid, args []types.Datum, settings *adt.Settings) (types.Datum, error) {
+	if opno != types.InvalidOid {
+		oper := adt.LookupOperator(opno)
+		if len(args) == 1 {
+			return oper.Fn(nil, args[0], settings)
+		}
+		return oper.Fn(args[0], args[1], settings)
+	}
+	return execOperator(op, args, settings)
+}
+
+// execEvalDistinct is IS DISTINCT FROM, NULL is not distinct from NULL and distinct from anything else
+func execEvalDistinct(d *types.DistinctExpr, econtext *ExprContext) (types.Datum, error) {
+	left, err := ExecEvalExpr(d.Args[0], econtext)
+	if err != nil {
+		return nil, err
+	}
+	right, err := ExecEvalExpr(d.Args[1], econtext)
+	if err != nil {
+		return nil, err
+	}
+	if left == nil || right == nil {
+		return (left == nil) != (right == nil), nil
+	}
+	equal, err := applyOperator(d.Op, d.Opno, []types.Datum{left, right}, econtext.EState.settings)
+	if err != nil || equal == nil {
+		return nil, err
+	}
+	return !equal.(bool), nil
+}
+
+// execEvalNullIf is NULLIF(a, b), a unless a = b. A NULL b never equals a
+func execEvalNullIf(n *types.NullIfExpr, econtext *ExprContext) (types.Datum, error) {
+	left, err := ExecEvalExpr(n.Args[0], econtext)
+	if err != nil || left == nil {
+		return nil, err
+	}
+	right, err := ExecEvalExpr(n.Args[1], econtext)
+	if err != nil {
+		return nil, err
+	}
+	if right == nil {
+		return left, nil
+	}
+	equal, err := applyOperator(n.Op, n.Opno, []types.Datum{left, right}, econtext.EState.settings)
+	if err != nil {
+		return nil, err
+	}
+	if equal == true {
+		return nil, nil
+	}
+	return left, nil
+}
+
+/*
+execEvalCase gives the result of the first WHEN whose condition is true, the ELSE result when there is none.
+Results of other WHENs are not evaluated. A simple CASE sets the value its conditions compare for
+their duration, a CASE nested in one of them restores the outer value when it is done
+*/
+func execEvalCase(c *types.CaseExpr, econtext *ExprContext) (types.Datum, error) {
+	if c.Arg != nil {
+		arg, err := ExecEvalExpr(c.Arg, econtext)
+		if err != nil {
+			return nil, err
+		}
+		saved := econtext.CaseValue
+		econtext.CaseValue = arg
+		defer func() { econtext.CaseValue = saved }()
+	}
+	for _, when := range c.Args {
+		cond, err := ExecEvalExpr(when.Expr, econtext)
+		if err != nil {
+			return nil, err
+		}
+		if cond == true {
+			return ExecEvalExpr(when.Result, econtext)
+		}
+	}
+	return ExecEvalExpr(c.Defresult, econtext)
+}
+
+// execEvalMinMax is GREATEST or LEAST, the result is NULL only when all the arguments are
+func execEvalMinMax(m *types.MinMaxExpr, econtext *ExprContext) (types.Datum, error) {
+	var result types.Datum
+	for _, argExpr := range m.Args {
+		arg, err := ExecEvalExpr(argExpr, econtext)
+		if err != nil {
+			return nil, err
+		}
+		if arg == nil {
+			continue
+		}
+		if result == nil {
+			result = arg
+			continue
+		}
+		cmp, err := CompareDatums(arg, result)
+		if err != nil {
+			return nil, err
+		}
+		if (m.Op == types.IS_GREATEST && cmp > 0) || (m.Op == types.IS_LEAST && cmp < 0) {
+			result = arg
+		}
+	}
+	return result, nil
+}
+
+// execEvalBooleanTest is IS [NOT] TRUE / FALSE / UNKNOWN, NULL is unknown
+func execEvalBooleanTest(b *types.BooleanTest, econtext *ExprContext) (types.Datum, error) {
+	arg, err := ExecEvalExpr(b.Arg, econtext)
+	if err != nil {
+		return nil, err
+	}
+	var matched bool
+	switch b.BoolTestType {
+	case types.IS_TRUE, types.IS_NOT_TRUE:
+		matched = arg == true
+	case types.IS_FALSE, types.IS_NOT_FALSE:
+		matched = arg == false
+	default:
+		matched = arg == nil
+	}
+	//The IS NOT tests are the odd ones
+	return matched != (b.BoolTestType%2 == 1), nil
+}
+
+func execEvalFuncExpr(fn *types.FuncExpr, econtext *ExprContext) (types.Datum, error) {
+	proc := adt.LookupFunction(fn.Funcid)
+	if proc == nil {
+		return nil, fmt.Errorf("cache lookup failed for function %d", fn.Funcid)
+	}
+	//The ProjectSet node computed the set already, we get the value of the row it is working on
+	if proc.Retset {
+		value, ok := econtext.SRFValues[fn]
+		if !ok {
+			return nil, fmt.Errorf("set-valued function called in context that cannot accept a set")
+		}
+		return value, nil
+	}
+	return callFunction(proc, fn, econtext)
+}
+
+// execEvalSetFunction calls a set returning function, the values are its rows. NULL arguments give no rows
+func execEvalSetFunction(fn *types.FuncExpr, econtext *ExprContext) ([]types.Datum, error) {
+	proc := adt.LookupFunction(fn.Funcid)
+	if proc == nil {
+		return nil, fmt.Errorf("cache lookup failed for function %d", fn.Funcid)
+	}
+	result, err := callFunction(proc, fn, econtext)
+	if err != nil || result == nil {
+		return nil, err
+	}
+	return result.(adt.SetResult), nil
+}
+
+func callFunction(proc *adt.Function, fn *types.FuncExpr, econtext *ExprContext) (types.Datum, error) {
+	fcinfo := &adt.FunctionCallInfo{
+		Args:          make([]types.Datum, len(fn.Args)),
+		StmtStartTime: econtext.EState.stmtStartTime,
+		Settings:      econtext.EState.settings,
+	}
+	for i, argExpr := range fn.Args {
+		arg, err := ExecEvalExpr(argExpr, econtext)
+		if err != nil {
+			return nil, err
+		}
+		if arg == nil && proc.Strict {
+			return nil, nil
+		}
+		fcinfo.Args[i] = arg
+	}
+	return proc.Fn(fcinfo)
+}
+
+/*
+execEvalArrayExpr builds the array of ARRAY[...]. The elements of a multidimensional one are arrays
+themselves, NULL ones are left out like in postgres
+*/
+func execEvalArrayExpr(a *types.ArrayExpr, econtext *ExprContext) (types.Datum, error) {
+	elems := make([]types.Datum, len(a.Elements))
+	for i, elemExpr := range a.Elements {
+		elem, err := ExecEvalExpr(elemExpr, econtext)
+		if err != nil {
+			return nil, err
+		}
+		elems[i] = elem
+	}
+	if a.Multidims {
+		return adt.MakeMultidimArray(elems)
+	}
+	return elems, nil
+}
+
+// execEvalSubscriptingRef fetches an element or a slice of an array, a NULL subscript gives NULL
+func execEvalSubscriptingRef(ref *types.SubscriptingRef, econtext *ExprContext) (types.Datum, error) {
+	array, err := ExecEvalExpr(ref.Expr, econtext)
+	if err != nil || array == nil {
+		return nil, err
+	}
+	evalSubscripts := func(exprs []types.Node, omitted int64) ([]int64, error) {
+		subscripts := make([]int64, len(exprs))
+		for i, expr := range exprs {
+			if expr == nil {
+				subscripts[i] = omitted
+				continue
+			}
+			subscript, err := ExecEvalExpr(expr, econtext)
+			if err != nil || subscript == nil {
+				return nil, err
+			}
+			subscripts[i] = subscript.(int64)
+		}
+		return subscripts, nil
+	}
+
+	upper, err := evalSubscripts(ref.Upperindex, math.MaxInt64)
+	if err != nil || upper == nil {
+		return nil, err
+	}
+	if ref.Lowerindex == nil {
+		return adt.ArrayGetElement(array.([]types.Datum), upper), nil
+	}
+	lower, err := evalSubscripts(ref.Lowerindex, math.MinInt64)
+	if err != nil || lower == nil {
+		return nil, err
+	}
+	return adt.ArrayGetSlice(array.([]types.Datum), lower, upper), nil
+}
+
+/*
+execEvalScalarArrayOp compares the scalar with every element of the array, with the same three valued
+logic as ANY / ALL over a subquery. An empty array gives false for ANY and true for ALL, even for a NULL scalar
+*/
+func execEvalScalarArrayOp(expr *types.ScalarArrayOpExpr, econtext *ExprContext) (types.Datum, error) {
+	scalar, err := ExecEvalExpr(expr.Args[0], econtext)
+	if err != nil {
+		return nil, err
+	}
+	array, err := ExecEvalExpr(expr.Args[1], econtext)
+	if err != nil || array == nil {
+		return nil, err
+	}
+	acc := anyAllAccum{isAll: !expr.UseOr}
+	for _, elem := range adt.ArrayElements(array.([]types.Datum)) {
+		if err := acc.add(expr.Op, scalar, elem); err != nil {
+			return nil, err
+		}
+		if acc.done {
+			break
+		}
+	}
+	return acc.final(), nil
+}
+
+// execOperator applies a builtin operator to non NULL arguments
+func execOperator(op string, args []types.Datum, settings *adt.Settings) (types.Datum, error) {
+	if len(args) == 1 {
+		switch v := args[0].(type) {
+		case int64:
+			if v == math.MinInt64 {
+				return nil, fmt.Errorf("bigint out of range")
+			}
+			return -v, nil
+		case float64:
+			return -v, nil
+		case adt.Numeric:
+			return v.Neg(), nil
+		}
+		return nil, fmt.Errorf("operator does not exist: %s %T", op, args[0])
+	}
+
+	left, right := args[0], args[1]
+	switch op {
+	case "=", "<>", "<", "<=", ">", ">=":
+		cmp, err := CompareDatums(left, right)
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case "=":
+			return cmp == 0, nil
+		case "<>":
+			return cmp != 0, nil
+		case "<":
+			return cmp < 0, nil
+		case "<=":
+			return cmp <= 0, nil
+		case ">":
+			return cmp > 0, nil
+		}
+		return cmp >= 0, nil
+
+	case "||":
+		return adt.OutputDatum(left, settings) + adt.OutputDatum(right, settings), nil
+	}
+	return execArithmetic(op, left, right)
+}
+
+func execArithmetic(op string, left types.Datum, right types.Datum) (types.Datum, error) {
+	if ln, ok := left.(adt.Numeric); ok {
+		if rn, ok := right.(adt.Numeric); ok {
+			return execNumericArithmetic(op, ln, rn)
+		}
+	}
+
+	li, lIsInt := left.(int64)
+	ri, rIsInt := right.(int64)
+
+	if lIsInt && rIsInt && op != "^" {
+		switch op {
+		case "+":
+			result := li + ri
+			if (result > li) != (ri > 0) {
+				return nil, fmt.Errorf("bigint out of range")
+			}
+			return result, nil
+		case "-":
+			result := li - ri
+			if (result < li) != (ri > 0) {
+				return nil, fmt.Errorf("bigint out of range")
+			}
+			return result, nil
+		case "*":
+			if li != 0 && ri != 0 {
+				result := li * ri
+				if result/ri != li || (li == -1 && ri == math.MinInt64) || (ri == -1 && li == math.MinInt64) {
+					return nil, fmt.Errorf("bigint out of range")
+				}
+				return result, nil
+			}
+			return int64(0), nil
+		case "/", "%":
+			if ri == 0 {
+				return nil, fmt.Errorf("division by zero")
+			}
+			if ri == -1 {
+				if op == "%" {
+					return int64(0), nil
+				}
+				if li == math.MinInt64 {
+					return nil, fmt.Errorf("bigint out of range")
+				}
+				return -li, nil
+			}
+			if op == "/" {
+				return li / ri, nil
+			}
+			return li % ri, nil
+		}
+	}
+
+	lf, lok := toFloat(left)
+	rf, rok := toFloat(right)
+	if !lok || !rok {
+		return nil, fmt.Errorf("operator does not exist: %T %s %T", left, op, right)
+	}
+	switch op {
+	case "+":
+		return lf + rf, nil
+	case "-":
+		return lf - rf, nil
+	case "*":
+		return lf * rf, nil
+	case "/":
+		if rf == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return lf / rf, nil
+	case "^":
+		return adt.Float8Pow(lf, rf)
+	}
+	return nil, fmt.Errorf("operator does not exist: %T %s %T", left, op, right)
+}
+
+// The planner converts both operands of a numeric operator to numeric
+func execNumericArithmetic(op string, left adt.Numeric, right adt.Numeric) (types.Datum, error) {
+	var result adt.Numeric
+	var err error
+	switch op {
+	case "+":
+		result, err = left.Add(right)
+	case "-":
+		result, err = left.Sub(right)
+	case "*":
+		result, err = left.Mul(right)
+	case "/":
+		result, err = left.Div(right)
+	case "%":
+		result, err = left.Mod(right)
+	case "^":
+		result, err = left.Power(right)
+	default:
+		return nil, fmt.Errorf("operator does not exist: numeric %s numeric", op)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func toFloat(d types.Datum) (float64, bool) {
+	switch v := d.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+/*
+AND/OR follow SQL three valued logic:
+false AND NULL is false, true OR NULL is true, otherwise NULL poisons the result
+*/
+func execEvalBoolExpr(b *types.BoolExpr, econtext *ExprContext) (types.Datum, error) {
+	if b.Boolop == types.NOT_EXPR {
+		arg, err := ExecEvalExpr(b.Args[0], econtext)
+		if err != nil || arg == nil {
+			return nil, err
+		}
+		return !arg.(bool), nil
+	}
+
+	sawNull := false
+	for _, argExpr := range b.Args {
+		arg, err := ExecEvalExpr(argExpr, econtext)
+		if err != nil {
+			return nil, err
+		}
+		if arg == nil {
+			sawNull = true
+			continue
+		}
+		value := arg.(bool)
+		if b.Boolop == types.AND_EXPR && !value {
+			return false, nil
+		}
+		if b.Boolop == types.OR_EXPR && value {
+			return true, nil
+		}
+	}
+	if sawNull {
+		return nil, nil
+	}
+	return b.Boolop == types.AND_EXPR, nil
+}
+
+// CompareDatums returns -1, 0 or 1, both datums must be non NULL
+func CompareDatums(a types.Datum, b types.Datum) (int, error) {
+	return adt.CompareDatums(a, b)
+}
@@ -0,0 +1,118 @@
+package executor
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rautNishan/diskquery/access"
+	"github.com/rautNishan/diskquery/adt"
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+Building indexes (postgres catalog/index.c index_build and the btree build of access/nbtree/nbtsort.c)
+
+Every row of the relation file is read, the rows a partial index leaves out are skipped, the key expressions
+are evaluated and the entries sorted into the index file, or given to the hash or gin build for those indexes. A unique index fails on two entries with equal
+keys, unless one of the keys is NULL: NULLs are distinct from each other as in postgres.
+INSERT, UPDATE and DELETE keep the indexes of the table up to date (see nodeModifyTable.go), a relation file
+changed from outside makes them out of date instead (see access.IndexIsCurrent)
+*/
+
+// BuildIndex writes the index file for info at indexPath from the rows of the relation file at heapPath
+func BuildIndex(info *types.IndexInfo, relname string, heapPath string, colTypes []types.Oid, indexPath string) error {
+	//Taken before reading so a change made while we read makes the index out of date
+	stamp, err := access.StatHeap(heapPath)
+	if err != nil {
+		return fmt.Errorf("could not open file for relation \"%s\": %v", relname, err)
+	}
+	scan, err := access.HeapBeginScan(heapPath, relname)
+	if err != nil {
+		return err
+	}
+	defer scan.End()
+	toast, err := access.OpenToastRelation(heapPath)
+	if err != nil {
+		return err
+	}
+	defer toast.Close()
+
+	//Index entries are stored, they are computed the same whatever session builds the index. Nothing here sorts
+	estate := newEState(0, 0, &adt.DefaultSettings)
+	var tuples []access.IndexTuple
+	for {
+		line, offset, length, ok, err := scan.Next()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			break
+		}
+		row, err := heapFormTuple(colTypes, line, toast)
+		if err != nil {
+			return fmt.Errorf("relation \"%s\" line %d: %v", relname, scan.LineNo, err)
+		}
+		keys, matches, err := formIndexTuple(info, row, estate)
+		if err != nil {
+			return err
+		}
+		if !matches {
+			continue
+		}
+		tuples = append(tuples, access.IndexTuple{Keys: keys, Offset: offset, Length: length})
+	}
+
+	switch info.AccessMethod {
+	case access.HASH_AM_NAME:
+		return access.HashBuild(indexPath, stamp, tuples)
+	case access.GIN_AM_NAME:
+		return access.GinBuild(indexPath, stamp, tuples)
+	}
+	indexKeys := makeIndexKeys(info.Keys)
+	access.BTSort(indexKeys, tuples)
+	if info.Unique {
+		//INCLUDE columns are not part of what must be unique
+		for i := 1; i < len(tuples); i++ {
+			keys := tuples[i].Keys[:len(indexKeys)]
+			if hasNullKey(keys) || access.CompareIndexTuples(indexKeys, tuples[i-1].Keys, keys) != 0 {
+				continue
+			}
+			values := make([]string, len(keys))
+			for j, value := range keys {
+				values[j] = adt.OutputDatum(value, &adt.DefaultSettings)
+			}
+			return fmt.Errorf("could not create unique index \"%s\": Key (%s)=(%s) is duplicated",
+				info.Name, strings.Join(info.KeyNames, ", "), strings.Join(values, ", "))
+		}
+	}
+	return access.BTWrite(indexPath, stamp, tuples)
+}
+
+// formIndexTuple evaluates the keys and INCLUDE columns of an index for a row, matches is false for a row a partial index leaves out
+func formIndexTuple(info *types.IndexInfo, row types.Tuple, estate *EState) (keys []types.Datum, matches bool, err error) {
+	econtext := &ExprContext{ScanTuple: row, EState: estate}
+	if matches, err = ExecQual(info.Predicate, econtext); err != nil || !matches {
+		return nil, false, err
+	}
+	keys = make([]types.Datum, len(info.Keys)+len(info.Include))
+	for i, key := range info.Keys {
+		if keys[i], err = ExecEvalExpr(key.Expr, econtext); err != nil {
+			return nil, false, err
+		}
+	}
+	for i, include := range info.Include {
+		if keys[len(info.Keys)+i], err = ExecEvalExpr(include, econtext); err != nil {
+			return nil, false, err
+		}
+	}
+	return keys, true, nil
+}
+
+// makeIndexKeys is the order of the index columns for package access
+func makeIndexKeys(keys []types.SortKey) []access.IndexKey {
+	indexKeys := make([]access.IndexKey, len(keys))
+	for i, key := range keys {
+		indexKeys[i] = access.IndexKey{TypeOid: types.ExprType(key.Expr), Desc: key.Desc, NullsFirst: key.NullsFirst}
+	}
+	return indexKeys
+}
@@ -0,0 +1,197 @@
+package executor
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/rautNishan/diskquery/access"
+	"github.com/rautNishan/diskquery/adt"
+	"github.com/rautNishan/diskquery/guc"
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+The executor is a tree of PlanStates, one per plan node (Volcano / iterator model like postgres)
+The top node is asked for a tuple, it asks its children for theirs and so on
+Next returns a nil tuple once the node has nothing left
+*/
+
+type PlanState interface {
+	Next() (types.Tuple, error)
+	Close() error
+}
+
+// EState is the state of one run of a plan, shared by all of its nodes
+type EState struct {
+	ParamExecVals []types.Datum //Current values of the plan's Params
+	subPlans      map[*types.SubPlan]*subPlanState
+	ctes          map[types.PlanNode]*cteState //Materialized WITH queries by their plan
+	workTables    map[int]*Tuplestore          //Work tables of running recursive queries by WtParam
+	stmtStartTime time.Time                    //What now() and current_date are based on
+	workMem       int                          //kB a single sort or hash table may use before it spills to disk
+	settings      *adt.Settings                //Of the session, what casts and functions follow
+	owner         *access.ResourceOwner        //Holds the relation locks of the run
+}
+
+func newEState(nParamExec int, workMem int, settings *adt.Settings) *EState {
+	return &EState{
+		ParamExecVals: make([]types.Datum, nParamExec),
+		subPlans:      make(map[*types.SubPlan]*subPlanState),
+		ctes:          make(map[types.PlanNode]*cteState),
+		workTables:    make(map[int]*Tuplestore),
+		stmtStartTime: time.Now(),
+		workMem:       workMem,
+		settings:      settings,
+		owner:         access.NewResourceOwner(),
+	}
+}
+
+// Close releases what the run kept outside of its plan nodes, and the locks a failed node did not let go of
+func (estate *EState) Close() error {
+	var firstErr error
+	for _, state := range estate.ctes {
+		if err := state.end(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	access.LockReleaseAll(estate.owner)
+	return firstErr
+}
+
+// ExprContext is what expressions are evaluated against
+type ExprContext struct {
+	ScanTuple types.Tuple
+	AggValues []types.Datum //Finished aggregate values, only set above an Agg node
+	EState    *EState
+
+	SRFValues map[*types.FuncExpr]types.Datum //Current values of the set returning calls, only set in a ProjectSet node
+	CaseValue types.Datum                     //The value a simple CASE compares, what a CaseTestExpr gives
+}
+
+// ExecInitNode builds the executor state for a plan tree
+func ExecInitNode(plan types.PlanNode, estate *EState) (PlanState, error) {
+	switch node := plan.(type) {
+	case *types.Result:
+		return ExecInitResult(node, estate)
+	case *types.SeqScan:
+		return ExecInitSeqScan(node, estate)
+	case *types.Agg:
+		return ExecInitAgg(node, estate)
+	case *types.Sort:
+		return ExecInitSort(node, estate)
+	case *types.Limit:
+		return ExecInitLimit(node, estate)
+	case *types.Append:
+		return ExecInitAppend(node, estate)
+	case *types.SetOp:
+		return ExecInitSetOp(node, estate)
+	case *types.HashJoin:
+		return ExecInitHashJoin(node, estate)
+	case *types.NestLoop:
+		return ExecInitNestLoop(node, estate)
+	case *types.CteScan:
+		return ExecInitCteScan(node, estate)
+	case *types.WorkTableScan:
+		return ExecInitWorkTableScan(node, estate)
+	case *types.RecursiveUnion:
+		return ExecInitRecursiveUnion(node, estate)
+	case *types.WindowAgg:
+		return ExecInitWindowAgg(node, estate)
+	case *types.FunctionScan:
+		return ExecInitFunctionScan(node, estate)
+	case *types.ProjectSet:
+		return ExecInitProjectSet(node, estate)
+	case *types.IndexScan:
+		return ExecInitIndexScan(node, estate)
+	case *types.IndexOnlyScan:
+		return ExecInitIndexOnlyScan(node, estate)
+	case *types.ColumnarScan:
+		return ExecInitColumnarScan(node, estate)
+	case *types.ModifyTable:
+		return ExecInitModifyTable(node, estate)
+	}
+	return nil, fmt.Errorf("unrecognized plan node type: %T", plan)
+}
+
+/*
+ExecutorRun runs the plan to completion for a session, handing every result row to receive
+Junk columns are removed before receive sees the row
+Returns the number of rows processed
+*/
+func ExecutorRun(stmt *types.PlannedStmt, session *guc.Session, receive func(types.Tuple) error) (int64, error) {
+	estate := newEState(stmt.NParamExec, session.WorkMem, &session.Settings)
+	defer estate.Close()
+	state, err := ExecInitNode(stmt.PlanTree, estate)
+	if err != nil {
+		return 0, err
+	}
+	defer state.Close()
+
+	var processed int64
+	for {
+		tuple, err := state.Next()
+		if err != nil {
+			return processed, err
+		}
+		if tuple == nil {
+			//The rows an INSERT, UPDATE or DELETE changed, it returns none without RETURNING
+			if modify, ok := state.(*ModifyTableState); ok {
+				return modify.Processed(), nil
+			}
+			return processed, nil
+		}
+		if err := receive(filterJunk(tuple, stmt.TargetList)); err != nil {
+			return processed, err
+		}
+		processed++
+	}
+}
+
+func filterJunk(tuple types.Tuple, targetList []*types.TargetEntry) types.Tuple {
+	hasJunk := false
+	for _, tle := range targetList {
+		if tle.ResJunk {
+			hasJunk = true
+			break
+		}
+	}
+	if !hasJunk {
+		return tuple
+	}
+	result := make(types.Tuple, 0, len(tuple))
+	for i, tle := range targetList {
+		if !tle.ResJunk {
+			result = append(result, tuple[i])
+		}
+	}
+	return result
+}
+
+// ExecProject evaluates a target list, a nil target list returns the scan tuple as is
+func ExecProject(targetList []*types.TargetEntry, econtext *ExprContext) (types.Tuple, error) {
+	if targetList == nil {
+		return econtext.ScanTuple, nil
+	}
+	result := make(types.Tuple, len(targetList))
+	for i, tle := range targetList {
+		value, err := ExecEvalExpr(tle.Expr, econtext)
+		if err != nil {
+			return nil, err
+		}
+		result[i] = value
+	}
+	return result, nil
+}
+
+// ExecQual checks a qualification, NULL counts as false
+func ExecQual(qual types.Node, econtext *ExprContext) (bool, error) {
+	if qual == nil {
+		return true, nil
+	}
+	value, err := ExecEvalExpr(qual, econtext)
+	if err != nil {
+		return false, err
+	}
+	result, _ := value.(bool)
+	return result, nil
+}
@@ -0,0 +1,665 @@
+package executor
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/rautNishan/diskquery/adt"
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+Aggregation
+
+AGG_PLAIN: the whole input is one group
+AGG_SORTED: input arrives sorted by the group keys, a group ends when the key changes
+AGG_HASHED: groups live in a hash table keyed by the encoded group key
+
+Hashed aggregation spills when the hash table outgrows work_mem:
+once the table is full, tuples of groups already in the table keep being aggregated in memory,
+tuples of new groups are written to one of HASHAGG_PARTITIONS temporary files (by hash of the key).
+After the input is exhausted the in memory groups are emitted and every partition is aggregated
+again as its own input, spilling further if it still does not fit.
+A group is therefore always either completely in memory or completely spilled within one batch.
+*/
+
+const HASHAGG_PARTITIONS = 4
+
+// Rough fixed cost of a group and of one transition state in the hash table
+const (
+	groupOverhead = 64
+	transOverhead = 32
+)
+
+type aggGroup struct {
+	firstTuple types.Tuple
+	trans      []aggTrans
+}
+
+type hashAggBatch struct {
+	file  *TupleFile
+	depth int
+}
+
+type AggState struct {
+	plan   *types.Agg
+	child  PlanState
+	estate *EState
+	done   bool
+
+	//AGG_SORTED
+	pending    types.Tuple //First tuple of the next group
+	pendingKey string
+
+	//AGG_HASHED
+	table      map[string]*aggGroup
+	groups     []*aggGroup //Groups in order of creation, so output order is stable
+	emitPos    int
+	filled     bool
+	memUsed    int
+	batch      *hashAggBatch //Spilled input we are aggregating now, nil while reading the child
+	partitions []*TupleFile
+	batches    []*hashAggBatch //Spilled partitions waiting to be aggregated
+}
+
+func ExecInitAgg(node *types.Agg, estate *EState) (*AggState, error) {
+	child, err := ExecInitNode(node.Lefttree, estate)
+	if err != nil {
+		return nil, err
+	}
+	return &AggState{plan: node, child: child, estate: estate}, nil
+}
+
+func (as *AggState) Next() (types.Tuple, error) {
+	switch as.plan.Strategy {
+	case types.AGG_PLAIN:
+		return as.nextPlain()
+	case types.AGG_SORTED:
+		return as.nextSorted()
+	}
+	return as.nextHashed()
+}
+
+func (as *AggState) nextPlain() (types.Tuple, error) {
+	if as.done {
+		return nil, nil
+	}
+	as.done = true
+
+	group, err := as.newGroup(types.Tuple{})
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tuple, err := as.child.Next()
+		if err != nil {
+			return nil, err
+		}
+		if tuple == nil {
+			break
+		}
+		if _, err := as.advanceGroup(group, tuple); err != nil {
+			return nil, err
+		}
+	}
+	return as.finalizeGroup(group)
+}
+
+func (as *AggState) nextSorted() (types.Tuple, error) {
+	for !as.done {
+		if as.pending == nil {
+			tuple, key, err := as.fetchWithKey(as.child.Next)
+			if err != nil {
+				return nil, err
+			}
+			if tuple == nil {
+				as.done = true
+				return nil, nil
+			}
+			as.pending, as.pendingKey = tuple, key
+		}
+
+		group, err := as.newGroup(as.pending)
+		if err != nil {
+			return nil, err
+		}
+		groupKey := as.pendingKey
+		if _, err := as.advanceGroup(group, as.pending); err != nil {
+			return nil, err
+		}
+		as.pending = nil
+
+		for {
+			tuple, key, err := as.fetchWithKey(as.child.Next)
+			if err != nil {
+				return nil, err
+			}
+			if tuple == nil {
+				as.done = true
+				break
+			}
+			if key != groupKey {
+				as.pending, as.pendingKey = tuple, key
+				break
+			}
+			if _, err := as.advanceGroup(group, tuple); err != nil {
+				return nil, err
+			}
+		}
+
+		result, err := as.finalizeGroup(group)
+		if err != nil || result != nil {
+			return result, err
+		}
+	}
+	return nil, nil
+}
+
+func (as *AggState) nextHashed() (types.Tuple, error) {
+	for {
+		if !as.filled {
+			if err := as.fillHashTable(); err != nil {
+				return nil, err
+			}
+			as.filled = true
+		}
+
+		for as.emitPos < len(as.groups) {
+			group := as.groups[as.emitPos]
+			as.groups[as.emitPos] = nil
+			as.emitPos++
+			result, err := as.finalizeGroup(group)
+			if err != nil || result != nil {
+				return result, err
+			}
+		}
+
+		//This batch is done, move on to the next spilled partition
+		if as.batch != nil {
+			as.batch.file.Close()
+			as.batch = nil
+		}
+		if len(as.batches) == 0 {
+			return nil, nil
+		}
+		as.batch = as.batches[0]
+		as.batches = as.batches[1:]
+		as.filled = false
+	}
+}
+
+func (as *AggState) fillHashTable() error {
+	as.table = make(map[string]*aggGroup)
+	as.groups = nil
+	as.emitPos = 0
+	as.memUsed = 0
+	as.partitions = nil
+
+	input := as.child.Next
+	depth := 0
+	if as.batch != nil {
+		input = as.batch.file.ReadTuple
+		depth = as.batch.depth
+	}
+	budget := as.estate.workMem * 1024
+
+	for {
+		tuple, key, err := as.fetchWithKey(input)
+		if err != nil {
+			return err
+		}
+		if tuple == nil {
+			break
+		}
+
+		group, found := as.table[key]
+		if !found {
+			//Always keep at least one group so every batch makes progress
+			if len(as.groups) > 0 && as.memUsed >= budget {
+				if err := as.spillTuple(tuple, key, depth); err != nil {
+					return err
+				}
+				continue
+			}
+			if group, err = as.newGroup(tuple); err != nil {
+				return err
+			}
+			as.table[key] = group
+			as.groups = append(as.groups, group)
+			as.memUsed += len(key) + tupleSize(tuple) + groupOverhead + transOverhead*len(group.trans)
+		}
+		grown, err := as.advanceGroup(group, tuple)
+		if err != nil {
+			return err
+		}
+		as.memUsed += grown
+	}
+	as.table = nil
+
+	for _, partition := range as.partitions {
+		if partition == nil {
+			continue
+		}
+		if err := partition.Rewind(); err != nil {
+			return err
+		}
+		as.batches = append(as.batches, &hashAggBatch{file: partition, depth: depth + 1})
+	}
+	as.partitions = nil
+	return nil
+}
+
+func (as *AggState) spillTuple(tuple types.Tuple, key string, depth int) error {
+	if as.partitions == nil {
+		as.partitions = make([]*TupleFile, HASHAGG_PARTITIONS)
+	}
+	idx := hashPartition(key, depth, HASHAGG_PARTITIONS)
+
+	if as.partitions[idx] == nil {
+		file, err := NewTupleFile("hashagg")
+		if err != nil {
+			return err
+		}
+		as.partitions[idx] = file
+	}
+	return as.partitions[idx].WriteTuple(tuple)
+}
+
+// fetchWithKey reads the next input tuple and computes its encoded group key
+func (as *AggState) fetchWithKey(input func() (types.Tuple, error)) (types.Tuple, string, error) {
+	tuple, err := input()
+	if err != nil || tuple == nil {
+		return nil, "", err
+	}
+	keys, err := evalExprList(as.plan.GroupExprs, &ExprContext{ScanTuple: tuple, EState: as.estate})
+	if err != nil {
+		return nil, "", err
+	}
+	key, err := hashKey(keys)
+	if err != nil {
+		return nil, "", err
+	}
+	return tuple, key, nil
+}
+
+func (as *AggState) newGroup(firstTuple types.Tuple) (*aggGroup, error) {
+	group := &aggGroup{firstTuple: firstTuple, trans: make([]aggTrans, len(as.plan.Aggs))}
+	for i, aggref := range as.plan.Aggs {
+		trans, err := newAggTrans(aggref, as.estate.settings)
+		if err != nil {
+			return nil, err
+		}
+		group.trans[i] = trans
+	}
+	return group, nil
+}
+
+// advanceGroup feeds one input tuple to every aggregate of the group, returns the bytes the states grew by
+func (as *AggState) advanceGroup(group *aggGroup, tuple types.Tuple) (int, error) {
+	econtext := &ExprContext{ScanTuple: tuple, EState: as.estate}
+	grown := 0
+	for i, aggref := range as.plan.Aggs {
+		n, err := advanceAggregate(aggref, group.trans[i], econtext)
+		if err != nil {
+			return 0, err
+		}
+		grown += n
+	}
+	return grown, nil
+}
+
+// advanceAggregate feeds the tuple of econtext to one aggregate if it passes the FILTER
+func advanceAggregate(aggref *types.Aggref, trans aggTrans, econtext *ExprContext) (int, error) {
+	if aggref.AggFilter != nil {
+		ok, err := ExecQual(aggref.AggFilter, econtext)
+		if err != nil || !ok {
+			return 0, err
+		}
+	}
+	args, err := evalExprList(aggref.Args, econtext)
+	if err != nil {
+		return 0, err
+	}
+	return trans.advance(args)
+}
+
+// finalizeGroup computes the aggregate results, returns nil if HAVING rejects the group
+func (as *AggState) finalizeGroup(group *aggGroup) (types.Tuple, error) {
+	aggValues := make([]types.Datum, len(group.trans))
+	for i, trans := range group.trans {
+		aggValues[i] = trans.final()
+	}
+	econtext := &ExprContext{ScanTuple: group.firstTuple, AggValues: aggValues, EState: as.estate}
+	ok, err := ExecQual(as.plan.Qual, econtext)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return ExecProject(as.plan.TargetList, econtext)
+}
+
+func evalExprList(exprs []types.Node, econtext *ExprContext) ([]types.Datum, error) {
+	values := make([]types.Datum, len(exprs))
+	for i, expr := range exprs {
+		value, err := ExecEvalExpr(expr, econtext)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+func (as *AggState) Close() error {
+	for _, partition := range as.partitions {
+		if partition != nil {
+			partition.Close()
+		}
+	}
+	for _, batch := range as.batches {
+		batch.file.Close()
+	}
+	if as.batch != nil {
+		as.batch.file.Close()
+	}
+	return as.child.Close()
+}
+
+/*
+Transition states, one per aggregate per group
+advance is called for every input row that passes the FILTER and returns how many bytes the state grew by
+final produces the aggregate's result
+*/
+type aggTrans interface {
+	advance(args []types.Datum) (int, error)
+	final() types.Datum
+}
+
+func newAggTrans(aggref *types.Aggref, settings *adt.Settings) (aggTrans, error) {
+	var trans aggTrans
+	switch aggref.AggName {
+	case "count":
+		trans = &countTrans{star: aggref.AggStar}
+	case "sum":
+		trans = &sumTrans{numeric: aggref.AggType == types.NUMERICOID}
+	case "avg":
+		trans = &avgTrans{}
+	case "min":
+		trans = &minMaxTrans{isMax: false}
+	case "max":
+		trans = &minMaxTrans{isMax: true}
+	case "bool_and", "every":
+		trans = &boolTrans{isAnd: true}
+	case "bool_or":
+		trans = &boolTrans{isAnd: false}
+	case "string_agg":
+		trans = &stringAggTrans{}
+	case "array_agg":
+		trans = &arrayAggTrans{}
+	case "json_agg", "json_object_agg":
+		trans = &jsonAggTrans{state: adt.NewJsonAggState(aggref.AggName == "json_object_agg", settings)}
+	case "jsonb_agg", "jsonb_object_agg":
+		trans = &jsonAggTrans{state: adt.NewJsonbAggState(aggref.AggName == "jsonb_object_agg", settings)}
+	default:
+		return nil, fmt.Errorf("unrecognized aggregate: %s", aggref.AggName)
+	}
+	if aggref.AggDistinct {
+		trans = &distinctTrans{inner: trans, seen: make(map[string]struct{})}
+	}
+	return trans, nil
+}
+
+type countTrans struct {
+	star  bool
+	count int64
+}
+
+func (t *countTrans) advance(args []types.Datum) (int, error) {
+	if t.star || args[0] != nil {
+		t.count++
+	}
+	return 0, nil
+}
+
+func (t *countTrans) final() types.Datum {
+	return t.count
+}
+
+// sumTrans adds bigints as numerics when the sum is a numeric, smaller integers in a bigint
+type sumTrans struct {
+	sum     types.Datum
+	numeric bool
+}
+
+func (t *sumTrans) advance(args []types.Datum) (int, error) {
+	arg := args[0]
+	if v, ok := arg.(int64); ok && t.numeric {
+		arg = adt.NumericFromInt64(v)
+	}
+	switch v := arg.(type) {
+	case nil:
+		return 0, nil
+	case int64:
+		if t.sum == nil {
+			t.sum = v
+			return 0, nil
+		}
+		sum := t.sum.(int64)
+		if (v > 0 && sum > math.MaxInt64-v) || (v < 0 && sum < math.MinInt64-v) {
+			return 0, fmt.Errorf("bigint out of range")
+		}
+		t.sum = sum + v
+	case float64:
+		if t.sum == nil {
+			t.sum = v
+			return 0, nil
+		}
+		t.sum = t.sum.(float64) + v
+	case adt.Numeric:
+		if t.sum == nil {
+			t.sum = v
+			return 0, nil
+		}
+		sum, err := t.sum.(adt.Numeric).Add(v)
+		if err != nil {
+			return 0, err
+		}
+		t.sum = sum
+	}
+	return 0, nil
+}
+
+func (t *sumTrans) final() types.Datum {
+	return t.sum
+}
+
+// avgTrans sums integers and numerics exactly, as numerics, and double precision as double precision
+type avgTrans struct {
+	sum        float64
+	numericSum adt.Numeric
+	isNumeric  bool
+	count      int64
+}
+
+func (t *avgTrans) advance(args []types.Datum) (int, error) {
+	arg := args[0]
+	if v, ok := arg.(int64); ok {
+		arg = adt.NumericFromInt64(v)
+	}
+	if n, ok := arg.(adt.Numeric); ok {
+		if !t.isNumeric {
+			t.numericSum, t.isNumeric = n, true
+		} else {
+			sum, err := t.numericSum.Add(n)
+			if err != nil {
+				return 0, err
+			}
+			t.numericSum = sum
+		}
+		t.count++
+		return 0, nil
+	}
+	if value, ok := arg.(float64); ok {
+		t.sum += value
+		t.count++
+	}
+	return 0, nil
+}
+
+func (t *avgTrans) final() types.Datum {
+	if t.count == 0 {
+		return nil
+	}
+	if t.isNumeric {
+		//Cannot fail, the divisor is a positive integer
+		avg, _ := t.numericSum.Div(adt.NumericFromInt64(t.count))
+		return avg
+	}
+	return t.sum / float64(t.count)
+}
+
+type minMaxTrans struct {
+	isMax bool
+	value types.Datum
+}
+
+func (t *minMaxTrans) advance(args []types.Datum) (int, error) {
+	if args[0] == nil {
+		return 0, nil
+	}
+	if t.value == nil {
+		t.value = args[0]
+		return datumSize(args[0]), nil
+	}
+	cmp, err := CompareDatums(args[0], t.value)
+	if err != nil {
+		return 0, err
+	}
+	if (t.isMax && cmp > 0) || (!t.isMax && cmp < 0) {
+		grown := datumSize(args[0]) - datumSize(t.value)
+		t.value = args[0]
+		return grown, nil
+	}
+	return 0, nil
+}
+
+func (t *minMaxTrans) final() types.Datum {
+	return t.value
+}
+
+type boolTrans struct {
+	isAnd bool
+	value types.Datum
+}
+
+func (t *boolTrans) advance(args []types.Datum) (int, error) {
+	if args[0] == nil {
+		return 0, nil
+	}
+	value := args[0].(bool)
+	if t.value == nil {
+		t.value = value
+	} else if t.isAnd {
+		t.value = t.value.(bool) && value
+	} else {
+		t.value = t.value.(bool) || value
+	}
+	return 0, nil
+}
+
+func (t *boolTrans) final() types.Datum {
+	return t.value
+}
+
+// string_agg(value, delimiter), NULL values are skipped, the delimiter goes before every value but the first
+type stringAggTrans struct {
+	builder  strings.Builder
+	hasValue bool
+}
+
+func (t *stringAggTrans) advance(args []types.Datum) (int, error) {
+	if args[0] == nil {
+		return 0, nil
+	}
+	grown := 0
+	if t.hasValue && args[1] != nil {
+		delimiter := args[1].(string)
+		t.builder.WriteString(delimiter)
+		grown += len(delimiter)
+	}
+	value := args[0].(string)
+	t.builder.WriteString(value)
+	t.hasValue = true
+	return grown + len(value), nil
+}
+
+func (t *stringAggTrans) final() types.Datum {
+	if !t.hasValue {
+		return nil
+	}
+	return t.builder.String()
+}
+
+// array_agg keeps NULL inputs as NULL elements
+type arrayAggTrans struct {
+	elems    []types.Datum
+	hasValue bool
+}
+
+func (t *arrayAggTrans) advance(args []types.Datum) (int, error) {
+	t.elems = append(t.elems, args[0])
+	t.hasValue = true
+	return datumSize(args[0]), nil
+}
+
+func (t *arrayAggTrans) final() types.Datum {
+	if !t.hasValue {
+		return nil
+	}
+	return t.elems
+}
+
+// jsonAggState is what adt's json and jsonb aggregate states have in common
+type jsonAggState interface {
+	Add(key types.Datum, value types.Datum) (int, error)
+	Result() types.Datum
+}
+
+// json_agg and jsonb_agg take NULL inputs as JSON nulls, the object aggregates take a key and a value
+type jsonAggTrans struct {
+	state jsonAggState
+}
+
+func (t *jsonAggTrans) advance(args []types.Datum) (int, error) {
+	if len(args) == 2 {
+		return t.state.Add(args[0], args[1])
+	}
+	return t.state.Add(nil, args[0])
+}
+
+func (t *jsonAggTrans) final() types.Datum {
+	return t.state.Result()
+}
+
+// distinctTrans passes each distinct set of arguments to the wrapped aggregate only once
+type distinctTrans struct {
+	inner aggTrans
+	seen  map[string]struct{}
+}
+
+func (t *distinctTrans) advance(args []types.Datum) (int, error) {
+	key, err := hashKey(args)
+	if err != nil {
+		return 0, err
+	}
+	if _, ok := t.seen[key]; ok {
+		return 0, nil
+	}
+	t.seen[key] = struct{}{}
+	grown, err := t.inner.advance(args)
+	return grown + len(key) + 16, err
+}
+
+func (t *distinctTrans) final() types.Datum {
+	return t.inner.final()
+}
@@ -0,0 +1,43 @@
+package executor
+
+import "github.com/rautNishan/diskquery/types"
+
+// AppendState returns everything from its first child, then everything from the second and so on
+type AppendState struct {
+	children []PlanState
+	current  int
+}
+
+func ExecInitAppend(node *types.Append, estate *EState) (*AppendState, error) {
+	as := &AppendState{}
+	for _, subplan := range node.Appendplans {
+		child, err := ExecInitNode(subplan, estate)
+		if err != nil {
+			as.Close()
+			return nil, err
+		}
+		as.children = append(as.children, child)
+	}
+	return as, nil
+}
+
+func (as *AppendState) Next() (types.Tuple, error) {
+	for as.current < len(as.children) {
+		tuple, err := as.children[as.current].Next()
+		if err != nil || tuple != nil {
+			return tuple, err
+		}
+		as.current++
+	}
+	return nil, nil
+}
+
+func (as *AppendState) Close() error {
+	var firstErr error
+	for _, child := range as.children {
+		if err := child.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,206 @@
+package executor
+
+import (
+	"fmt"
+
+	"github.com/rautNishan/diskquery/access"
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+Columnar scan (the custom scan of citus columnar)
+
+The rows come from the columnar file of the table (see access/columnar.go), a chunk group at a time: the
+chunks of the columns the query uses are read and decoded, the other columns stay NULL. The zone keys are
+evaluated once when the scan starts and a chunk group whose zone maps rule one of them out is not read at
+all, the whole qual is checked again on every row of the others.
+
+A columnar file that is missing or out of date, the table is new or INSERT, UPDATE or DELETE changed its
+relation file, is built again from the relation file before the scan reads it. The scan holds
+ShareUpdateExclusiveLock meanwhile, the scans of the table that start then wait for it instead of building
+the file as well, and the catalogs are not locked
+*/
+type ColumnarScanState struct {
+	plan     *types.ColumnarScan
+	estate   *EState
+	file     *access.ColumnarFile
+	scanKeys []access.ScanKey
+	started  bool
+	done     bool
+	group    int             //Next chunk group
+	columns  [][]types.Datum //Values of the chunk group being returned, by column
+	rows     int
+	pos      int
+}
+
+// ExecInitColumnarScan locks the table for reading until the scan is closed and builds its columnar file when it is not current
+func ExecInitColumnarScan(node *types.ColumnarScan, estate *EState) (*ColumnarScanState, error) {
+	if err := access.LockRelationOid(node.Relid, access.AccessShareLock, estate.owner); err != nil {
+		return nil, err
+	}
+	if err := columnarBuildIfStale(node, estate); err != nil {
+		access.UnlockRelationOid(node.Relid, access.AccessShareLock, estate.owner)
+		return nil, err
+	}
+	file, err := access.ColumnarOpen(node.FilePath, node.Relname)
+	if err != nil {
+		access.UnlockRelationOid(node.Relid, access.AccessShareLock, estate.owner)
+		return nil, err
+	}
+	return &ColumnarScanState{plan: node, estate: estate, file: file, columns: make([][]types.Datum, len(node.ColTypes))}, nil
+}
+
+// columnarBuildIfStale builds the columnar file of the table again when it is not of the relation file as it is, the table is locked for reading
+func columnarBuildIfStale(node *types.ColumnarScan, estate *EState) error {
+	if access.ColumnarIsCurrent(node.FilePath) {
+		return nil
+	}
+	if err := access.LockRelationOid(node.Relid, access.ShareUpdateExclusiveLock, estate.owner); err != nil {
+		return err
+	}
+	defer access.UnlockRelationOid(node.Relid, access.ShareUpdateExclusiveLock, estate.owner)
+	//Another scan may have built it while we waited
+	if access.ColumnarIsCurrent(node.FilePath) {
+		return nil
+	}
+	return BuildColumnar(node.Relname, node.FilePath, node.ColTypes)
+}
+
+// beginScan evaluates the zone keys, a NULL argument matches nothing as the comparison would be NULL
+func (cs *ColumnarScanState) beginScan() error {
+	cs.started = true
+	heapStamp, err := access.StatHeap(cs.plan.FilePath)
+	if err != nil {
+		return fmt.Errorf("could not open file for relation \"%s\": %v", cs.plan.Relname, err)
+	}
+	if cs.file.HeapStamp != heapStamp || len(cs.file.ColTypes) != len(cs.plan.ColTypes) {
+		return fmt.Errorf("columnar file of relation \"%s\" is out of date, the relation changed after it was built", cs.plan.Relname)
+	}
+	econtext := &ExprContext{EState: cs.estate}
+	cs.scanKeys = make([]access.ScanKey, len(cs.plan.ZoneKeys))
+	for i, zoneKey := range cs.plan.ZoneKeys {
+		arg, err := ExecEvalExpr(zoneKey.Arg, econtext)
+		if err != nil {
+			return err
+		}
+		if arg == nil {
+			cs.done = true
+			return nil
+		}
+		cs.scanKeys[i] = access.ScanKey{AttNo: zoneKey.AttNo, Strategy: zoneKey.Strategy, Arg: arg}
+	}
+	return nil
+}
+
+// nextChunkGroup reads the chunks of the next chunk group the zone maps do not rule out, false when there is none
+func (cs *ColumnarScanState) nextChunkGroup() (bool, error) {
+	for cs.group < len(cs.file.Groups) {
+		group := cs.group
+		cs.group++
+		mayMatch, err := cs.file.ChunkGroupMayMatch(group, cs.scanKeys)
+		if err != nil {
+			return false, err
+		}
+		if !mayMatch {
+			continue
+		}
+		for _, attno := range cs.plan.AttNos {
+			if cs.columns[attno], err = cs.file.ReadChunk(group, attno); err != nil {
+				return false, err
+			}
+		}
+		cs.rows, cs.pos = cs.file.Groups[group].Rows, 0
+		return true, nil
+	}
+	return false, nil
+}
+
+func (cs *ColumnarScanState) Next() (types.Tuple, error) {
+	if !cs.started {
+		if err := cs.beginScan(); err != nil {
+			return nil, err
+		}
+	}
+	for !cs.done {
+		if cs.pos == cs.rows {
+			found, err := cs.nextChunkGroup()
+			if err != nil {
+				return nil, err
+			}
+			if !found {
+				cs.done = true
+				break
+			}
+			continue
+		}
+		tuple := make(types.Tuple, len(cs.plan.ColTypes))
+		for _, attno := range cs.plan.AttNos {
+			tuple[attno] = cs.columns[attno][cs.pos]
+		}
+		cs.pos++
+
+		econtext := &ExprContext{ScanTuple: tuple, EState: cs.estate}
+		ok, err := ExecQual(cs.plan.Qual, econtext)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		return ExecProject(cs.plan.TargetList, econtext)
+	}
+	return nil, nil
+}
+
+func (cs *ColumnarScanState) Close() error {
+	err := cs.file.Close()
+	access.UnlockRelationOid(cs.plan.Relid, access.AccessShareLock, cs.estate.owner)
+	return err
+}
+
+/*
+BuildColumnar writes the columnar file of a table from the rows of its relation file at heapPath, the way
+BuildIndex builds an index, stamped with the relation file it read
+*/
+func BuildColumnar(relname string, heapPath string, colTypes []types.Oid) error {
+	//Taken before reading so a change made while we read makes the columnar file out of date
+	stamp, err := access.StatHeap(heapPath)
+	if err != nil {
+		return fmt.Errorf("could not open file for relation \"%s\": %v", relname, err)
+	}
+	scan, err := access.HeapBeginScan(heapPath, relname)
+	if err != nil {
+		return err
+	}
+	defer scan.End()
+	toast, err := access.OpenToastRelation(heapPath)
+	if err != nil {
+		return err
+	}
+	defer toast.Close()
+
+	writer, err := access.ColumnarBeginWrite(heapPath, stamp, colTypes)
+	if err != nil {
+		return err
+	}
+	for {
+		line, _, _, ok, err := scan.Next()
+		if err == nil && !ok {
+			break
+		}
+		var row types.Tuple
+		if err == nil {
+			if row, err = heapFormTuple(colTypes, line, toast); err != nil {
+				err = fmt.Errorf("relation \"%s\" line %d: %v", relname, scan.LineNo, err)
+			}
+		}
+		if err == nil {
+			err = writer.WriteRow(row)
+		}
+		if err != nil {
+			writer.Abort()
+			return err
+		}
+	}
+	return writer.EndWrite()
+}
@@ -0,0 +1,116 @@
+package executor
+
+import "github.com/rautNishan/diskquery/types"
+
+/*
+CteScan reads a materialized WITH query (postgres executor/nodeCtescan.c)
+
+The WITH query's plan runs at most once per statement and its rows are kept in a Tuplestore shared by
+every CteScan of it. It runs lazily: a scan that reached the end of what is stored fetches the next row
+from the plan, so a WITH query that is only read partly (LIMIT) is only computed partly.
+When the WITH query reads Params of an outer query, the stored rows are thrown away whenever their
+values changed.
+*/
+
+type cteState struct {
+	plan      PlanState //nil before the first fetch and after the plan returned its last row
+	store     *Tuplestore
+	eof       bool
+	extValues string //Encoded ExtParams the stored rows were computed with
+}
+
+type CteScanState struct {
+	plan   *types.CteScan
+	estate *EState
+	shared *cteState
+	reader *TuplestoreReader
+}
+
+func ExecInitCteScan(node *types.CteScan, estate *EState) (*CteScanState, error) {
+	extValues := make(types.Tuple, len(node.ExtParams))
+	for i, paramId := range node.ExtParams {
+		extValues[i] = estate.ParamExecVals[paramId]
+	}
+	keyBuf, err := encodeTuple(nil, extValues)
+	if err != nil {
+		return nil, err
+	}
+	key := string(keyBuf)
+
+	shared, ok := estate.ctes[node.CtePlan]
+	if !ok || shared.extValues != key {
+		if ok {
+			if err := shared.end(); err != nil {
+				return nil, err
+			}
+		}
+		shared = &cteState{store: NewTuplestore(estate.workMem), extValues: key}
+		estate.ctes[node.CtePlan] = shared
+	}
+	return &CteScanState{plan: node, estate: estate, shared: shared, reader: shared.store.NewReader()}, nil
+}
+
+func (cs *CteScanState) Next() (types.Tuple, error) {
+	for {
+		tuple, err := cs.reader.Next()
+		if err != nil {
+			return nil, err
+		}
+		if tuple == nil {
+			fetched, err := cs.shared.fetch(cs.plan.CtePlan, cs.estate)
+			if err != nil || !fetched {
+				return nil, err
+			}
+			continue
+		}
+
+		econtext := &ExprContext{ScanTuple: tuple, EState: cs.estate}
+		ok, err := ExecQual(cs.plan.Qual, econtext)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return ExecProject(cs.plan.TargetList, econtext)
+		}
+	}
+}
+
+// fetch runs the WITH query for one more row and stores it, false once it has no more rows
+func (state *cteState) fetch(plan types.PlanNode, estate *EState) (bool, error) {
+	if state.eof {
+		return false, nil
+	}
+	if state.plan == nil {
+		planState, err := ExecInitNode(plan, estate)
+		if err != nil {
+			return false, err
+		}
+		state.plan = planState
+	}
+	tuple, err := state.plan.Next()
+	if err != nil {
+		return false, err
+	}
+	if tuple == nil {
+		state.eof = true
+		err := state.plan.Close()
+		state.plan = nil
+		return false, err
+	}
+	return true, state.store.PutTuple(tuple)
+}
+
+func (state *cteState) end() error {
+	state.store.End()
+	if state.plan != nil {
+		err := state.plan.Close()
+		state.plan = nil
+		return err
+	}
+	return nil
+}
+
+// The stored rows belong to the EState, they outlive a single scan
+func (cs *CteScanState) Close() error {
+	return nil
+}
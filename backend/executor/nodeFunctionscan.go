@@ -0,0 +1,60 @@
+package executor
+
+import (
+	"github.com/rautNishan/diskquery/adt"
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+FunctionScanState returns the rows of a function in FROM. The function is called on the first Next,
+all of its values are kept and handed out one per row
+*/
+type FunctionScanState struct {
+	plan   *types.FunctionScan
+	estate *EState
+	values []types.Datum
+	called bool
+	pos    int
+}
+
+func ExecInitFunctionScan(node *types.FunctionScan, estate *EState) (*FunctionScanState, error) {
+	return &FunctionScanState{plan: node, estate: estate}, nil
+}
+
+func (fs *FunctionScanState) Next() (types.Tuple, error) {
+	if !fs.called {
+		if err := fs.callFunction(); err != nil {
+			return nil, err
+		}
+		fs.called = true
+	}
+	for fs.pos < len(fs.values) {
+		econtext := &ExprContext{ScanTuple: types.Tuple{fs.values[fs.pos]}, EState: fs.estate}
+		fs.pos++
+		ok, err := ExecQual(fs.plan.Qual, econtext)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return ExecProject(fs.plan.TargetList, econtext)
+		}
+	}
+	return nil, nil
+}
+
+func (fs *FunctionScanState) callFunction() error {
+	econtext := &ExprContext{ScanTuple: types.Tuple{}, EState: fs.estate}
+	if fn, ok := fs.plan.FuncExpr.(*types.FuncExpr); ok && adt.LookupFunction(fn.Funcid).Retset {
+		values, err := execEvalSetFunction(fn, econtext)
+		fs.values = values
+		return err
+	}
+	//Any other function is a single row, NULL included
+	value, err := ExecEvalExpr(fs.plan.FuncExpr, econtext)
+	fs.values = []types.Datum{value}
+	return err
+}
+
+func (fs *FunctionScanState) Close() error {
+	return nil
+}
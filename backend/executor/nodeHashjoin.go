@@ -0,0 +1,304 @@
+package executor
+
+import (
+	"hash/fnv"
+
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+Hash semi and anti joins
+
+The inner side is read first and the encoded keys of its rows go into a hash set, semi and anti joins
+only return outer rows so the inner rows themselves are not kept. Then every outer row probes the set.
+
+When the set outgrows work_mem, keys that are not in it yet are written to one of HASHJOIN_BATCHES
+temporary files by hash. An outer row that does not find its key in memory may still match a spilled
+key, so if its batch has an inner file the row is written to the outer file of that batch.
+Once the outer side is done every batch is joined the same way, its inner file taking the place of
+the inner side, spilling again if it still does not fit.
+*/
+
+const HASHJOIN_BATCHES = 4
+
+// Rough fixed cost of one key in the hash set
+const hashEntryOverhead = 48
+
+type hashJoinBatch struct {
+	inner *TupleFile //Encoded inner keys
+	outer *TupleFile //Outer tuples
+	depth int
+}
+
+type HashJoinState struct {
+	plan   *types.HashJoin
+	outer  PlanState
+	inner  PlanState
+	estate *EState
+
+	table   map[string]struct{}
+	memUsed int
+	built   bool
+	done    bool
+
+	batch        *hashJoinBatch //Batch being joined, nil while joining the child plans
+	innerBatches []*TupleFile   //Spilled keys of the current batch
+	outerBatches []*TupleFile
+	batches      []*hashJoinBatch //Batches waiting to be joined
+
+	//What NOT IN needs to know about the whole inner side
+	innerEmpty   bool
+	innerHasNull bool
+}
+
+func ExecInitHashJoin(node *types.HashJoin, estate *EState) (*HashJoinState, error) {
+	outer, err := ExecInitNode(node.Lefttree, estate)
+	if err != nil {
+		return nil, err
+	}
+	inner, err := ExecInitNode(node.Righttree, estate)
+	if err != nil {
+		outer.Close()
+		return nil, err
+	}
+	return &HashJoinState{plan: node, outer: outer, inner: inner, estate: estate, innerEmpty: true}, nil
+}
+
+func (hs *HashJoinState) Next() (types.Tuple, error) {
+	for !hs.done {
+		if !hs.built {
+			if err := hs.build(); err != nil {
+				return nil, err
+			}
+			hs.built = true
+		}
+
+		var tuple types.Tuple
+		var err error
+		if hs.batch == nil {
+			tuple, err = hs.outer.Next()
+		} else {
+			tuple, err = hs.batch.outer.ReadTuple()
+		}
+		if err != nil {
+			return nil, err
+		}
+		if tuple == nil {
+			if err := hs.nextBatch(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		econtext := &ExprContext{ScanTuple: tuple, EState: hs.estate}
+		keys, err := evalExprList(hs.plan.OuterHashKeys, econtext)
+		if err != nil {
+			return nil, err
+		}
+
+		matched := false
+		if hasNullKey(keys) {
+			//NULL = x is never true, but for NOT IN it is not false either unless the subquery is empty
+			matched = hs.plan.NullAware && !hs.innerEmpty
+		} else {
+			key, err := hashKey(keys)
+			if err != nil {
+				return nil, err
+			}
+			if _, found := hs.table[key]; found {
+				matched = true
+			} else if hs.innerBatches != nil {
+				//The key may be in a batch that was spilled, decide when that batch is joined
+				idx := hashPartition(key, hs.depth(), HASHJOIN_BATCHES)
+				if hs.innerBatches[idx] != nil {
+					if err := hs.spillOuter(idx, tuple); err != nil {
+						return nil, err
+					}
+					continue
+				}
+			}
+		}
+
+		if hs.plan.JoinType == types.JOIN_SEMI && !matched {
+			continue
+		}
+		if hs.plan.JoinType == types.JOIN_ANTI && (matched || (hs.plan.NullAware && hs.innerHasNull)) {
+			continue
+		}
+		ok, err := ExecQual(hs.plan.Qual, econtext)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return ExecProject(hs.plan.TargetList, econtext)
+		}
+	}
+	return nil, nil
+}
+
+func (hs *HashJoinState) depth() int {
+	if hs.batch == nil {
+		return 0
+	}
+	return hs.batch.depth
+}
+
+// build reads the inner side of the current batch into the hash set
+func (hs *HashJoinState) build() error {
+	hs.table = make(map[string]struct{})
+	hs.memUsed = 0
+	hs.innerBatches, hs.outerBatches = nil, nil
+	budget := hs.estate.workMem * 1024
+	depth := hs.depth()
+
+	for {
+		var keys types.Tuple
+		if hs.batch == nil {
+			tuple, err := hs.inner.Next()
+			if err != nil {
+				return err
+			}
+			if tuple == nil {
+				break
+			}
+			keys, err = evalExprList(hs.plan.InnerHashKeys, &ExprContext{ScanTuple: tuple, EState: hs.estate})
+			if err != nil {
+				return err
+			}
+			hs.innerEmpty = false
+			if hasNullKey(keys) {
+				hs.innerHasNull = true
+				continue
+			}
+		} else {
+			var err error
+			if keys, err = hs.batch.inner.ReadTuple(); err != nil {
+				return err
+			}
+			if keys == nil {
+				break
+			}
+		}
+
+		key, err := hashKey(keys)
+		if err != nil {
+			return err
+		}
+		if _, found := hs.table[key]; found {
+			continue
+		}
+		//Always keep at least one key so every batch makes progress
+		if len(hs.table) > 0 && hs.memUsed >= budget {
+			if err := hs.spillInner(hashPartition(key, depth, HASHJOIN_BATCHES), keys); err != nil {
+				return err
+			}
+			continue
+		}
+		hs.table[key] = struct{}{}
+		hs.memUsed += len(key) + hashEntryOverhead
+	}
+	return nil
+}
+
+func (hs *HashJoinState) spillInner(idx int, keys types.Tuple) error {
+	if hs.innerBatches == nil {
+		hs.innerBatches = make([]*TupleFile, HASHJOIN_BATCHES)
+		hs.outerBatches = make([]*TupleFile, HASHJOIN_BATCHES)
+	}
+	if hs.innerBatches[idx] == nil {
+		file, err := NewTupleFile("hashjoin")
+		if err != nil {
+			return err
+		}
+		hs.innerBatches[idx] = file
+	}
+	return hs.innerBatches[idx].WriteTuple(keys)
+}
+
+func (hs *HashJoinState) spillOuter(idx int, tuple types.Tuple) error {
+	if hs.outerBatches[idx] == nil {
+		file, err := NewTupleFile("hashjoin")
+		if err != nil {
+			return err
+		}
+		hs.outerBatches[idx] = file
+	}
+	return hs.outerBatches[idx].WriteTuple(tuple)
+}
+
+// nextBatch finishes the current batch and moves on to the next one, done is set when there is none
+func (hs *HashJoinState) nextBatch() error {
+	depth := hs.depth()
+	for i := range hs.innerBatches {
+		inner, outer := hs.innerBatches[i], hs.outerBatches[i]
+		//Without outer rows there is nothing to join the spilled keys with
+		if inner == nil || outer == nil {
+			closeTupleFiles(inner, outer)
+			continue
+		}
+		if err := inner.Rewind(); err != nil {
+			return err
+		}
+		if err := outer.Rewind(); err != nil {
+			return err
+		}
+		hs.batches = append(hs.batches, &hashJoinBatch{inner: inner, outer: outer, depth: depth + 1})
+	}
+	hs.innerBatches, hs.outerBatches = nil, nil
+	hs.table = nil
+
+	if hs.batch != nil {
+		closeTupleFiles(hs.batch.inner, hs.batch.outer)
+		hs.batch = nil
+	}
+	if len(hs.batches) == 0 {
+		hs.done = true
+		return nil
+	}
+	hs.batch = hs.batches[0]
+	hs.batches = hs.batches[1:]
+	hs.built = false
+	return nil
+}
+
+func hasNullKey(keys types.Tuple) bool {
+	for _, key := range keys {
+		if key == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// hashPartition picks the spill file for an encoded key, the depth is mixed in so the tuples of one
+// partition spread over all partitions when that partition spills again
+func hashPartition(key string, depth int, npartitions int) int {
+	hasher := fnv.New64a()
+	hasher.Write([]byte{byte(depth)})
+	hasher.Write([]byte(key))
+	return int(hasher.Sum64() % uint64(npartitions))
+}
+
+func closeTupleFiles(files ...*TupleFile) {
+	for _, file := range files {
+		if file != nil {
+			file.Close()
+		}
+	}
+}
+
+func (hs *HashJoinState) Close() error {
+	closeTupleFiles(hs.innerBatches...)
+	closeTupleFiles(hs.outerBatches...)
+	for _, batch := range hs.batches {
+		closeTupleFiles(batch.inner, batch.outer)
+	}
+	if hs.batch != nil {
+		closeTupleFiles(hs.batch.inner, hs.batch.outer)
+	}
+	oerr := hs.outer.Close()
+	if ierr := hs.inner.Close(); oerr == nil {
+		return ierr
+	}
+	return oerr
+}
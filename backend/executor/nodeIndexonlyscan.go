@@ -0,0 +1,93 @@
+package executor
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/rautNishan/diskquery/access"
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+Index-only scan (postgres executor/nodeIndexonlyscan.c)
+
+The rows come from the index entries, the columns are not read from the relation file. As in postgres the
+heap is only read for the rows of pages the visibility map (see access/visibilitymap.go) does not say are all
+visible: our entries may be of rows DELETE or UPDATE left dead until VACUUM removes them, so the first byte
+of such a row is read to see it is still there, a dead row is line breaks
+*/
+type IndexOnlyScanState struct {
+	plan    *types.IndexOnlyScan
+	estate  *EState
+	file    *os.File
+	vm      *access.VisibilityMap
+	entries []access.IndexTuple
+	pos     int
+	started bool
+}
+
+// ExecInitIndexOnlyScan locks the relation for reading until the scan is closed
+func ExecInitIndexOnlyScan(node *types.IndexOnlyScan, estate *EState) (*IndexOnlyScanState, error) {
+	if err := access.LockRelationOid(node.Relid, access.AccessShareLock, estate.owner); err != nil {
+		return nil, err
+	}
+	file, err := os.Open(node.FilePath)
+	if err != nil {
+		access.UnlockRelationOid(node.Relid, access.AccessShareLock, estate.owner)
+		return nil, fmt.Errorf("could not open file for relation \"%s\": %v", node.Relname, err)
+	}
+	return &IndexOnlyScanState{plan: node, estate: estate, file: file}, nil
+}
+
+func (ios *IndexOnlyScanState) Next() (types.Tuple, error) {
+	if !ios.started {
+		ios.started = true
+		heapStamp, err := access.StatHeapFile(ios.file)
+		if err != nil {
+			return nil, fmt.Errorf("could not stat file for relation \"%s\": %v", ios.plan.Relname, err)
+		}
+		if ios.entries, err = indexBeginScan(&ios.plan.IndexScan, ios.estate, heapStamp); err != nil {
+			return nil, err
+		}
+		if ios.vm, err = access.VisibilityMapOpen(ios.file, ios.plan.FilePath, ios.plan.Relname); err != nil {
+			return nil, err
+		}
+	}
+	for ios.pos < len(ios.entries) {
+		entry := ios.entries[ios.pos]
+		ios.pos++
+		if !ios.vm.IsAllVisible(int(entry.Offset / access.BLCKSZ)) {
+			first, err := access.HeapFetch(ios.file, entry.Offset, 1)
+			if err != nil {
+				return nil, fmt.Errorf("could not read relation \"%s\" at offset %d: %v", ios.plan.Relname, entry.Offset, err)
+			}
+			if first == "\n" {
+				continue
+			}
+		}
+		//The columns the index does not have stay NULL, the planner made sure nothing reads them
+		tuple := make(types.Tuple, len(ios.plan.ColTypes))
+		for i, attno := range ios.plan.IndexAttNos {
+			if attno >= 0 {
+				tuple[attno] = entry.Keys[i]
+			}
+		}
+
+		econtext := &ExprContext{ScanTuple: tuple, EState: ios.estate}
+		ok, err := ExecQual(ios.plan.Qual, econtext)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		return ExecProject(ios.plan.TargetList, econtext)
+	}
+	return nil, nil
+}
+
+func (ios *IndexOnlyScanState) Close() error {
+	err := ios.file.Close()
+	access.UnlockRelationOid(ios.plan.Relid, access.AccessShareLock, ios.estate.owner)
+	return err
+}
@@ -0,0 +1,156 @@
+package executor
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/rautNishan/diskquery/access"
+	"github.com/rautNishan/diskquery/adt"
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+Index scan (postgres executor/nodeIndexscan.c)
+The scan key arguments are evaluated once when the scan starts, the index gives the entries that match them
+and each row is read from the relation file where its entry says. The whole qual is checked again on the
+row, the scan keys are only the part of it the index could use. An entry of a row DELETE or UPDATE left dead
+points at line breaks until VACUUM removes it (see access.HeapDelete), the row is not there any more
+*/
+type IndexScanState struct {
+	plan      *types.IndexScan
+	estate    *EState
+	file      *os.File
+	toast     *access.ToastRelation
+	entries   []access.IndexTuple
+	pos       int
+	started   bool
+	heapStamp access.HeapStamp   //Of the relation file the scan reads
+	tid       access.ItemPointer //Where the row last returned is, what UPDATE and DELETE change
+}
+
+// ExecInitIndexScan locks the relation for reading until the scan is closed
+func ExecInitIndexScan(node *types.IndexScan, estate *EState) (*IndexScanState, error) {
+	if err := access.LockRelationOid(node.Relid, access.AccessShareLock, estate.owner); err != nil {
+		return nil, err
+	}
+	file, err := os.Open(node.FilePath)
+	if err != nil {
+		access.UnlockRelationOid(node.Relid, access.AccessShareLock, estate.owner)
+		return nil, fmt.Errorf("could not open file for relation \"%s\": %v", node.Relname, err)
+	}
+	toast, err := access.OpenToastRelation(node.FilePath)
+	if err != nil {
+		file.Close()
+		access.UnlockRelationOid(node.Relid, access.AccessShareLock, estate.owner)
+		return nil, err
+	}
+	return &IndexScanState{plan: node, estate: estate, file: file, toast: toast}, nil
+}
+
+func (is *IndexScanState) beginScan() error {
+	is.started = true
+	//The file we have open, VACUUM FULL may have put another one at the path and rebuilt the index for it
+	var err error
+	if is.heapStamp, err = access.StatHeapFile(is.file); err != nil {
+		return fmt.Errorf("could not stat file for relation \"%s\": %v", is.plan.Relname, err)
+	}
+	is.entries, err = indexBeginScan(is.plan, is.estate, is.heapStamp)
+	return err
+}
+
+/*
+indexBeginScan searches the index, a NULL argument matches nothing as the comparison would be NULL.
+The index must have been built from the relation file heapStamp is of, the rows are read from that one
+*/
+func indexBeginScan(plan *types.IndexScan, estate *EState, heapStamp access.HeapStamp) ([]access.IndexTuple, error) {
+	outOfDate := func() error {
+		return fmt.Errorf("index \"%s\" is out of date, relation \"%s\" changed after it was built", plan.IndexName, plan.Relname)
+	}
+	econtext := &ExprContext{EState: estate}
+	scanKeys := make([]access.ScanKey, len(plan.ScanKeys))
+	for i, scanKey := range plan.ScanKeys {
+		arg, err := ExecEvalExpr(scanKey.Arg, econtext)
+		if err != nil {
+			return nil, err
+		}
+		if arg == nil {
+			return nil, nil
+		}
+		scanKeys[i] = access.ScanKey{AttNo: scanKey.AttNo, Strategy: scanKey.Strategy, Arg: arg}
+	}
+	switch plan.AccessMethod {
+	case access.HASH_AM_NAME:
+		//A single = scan key, the entries with the same hash code are rows the qual sorts out
+		entries, builtFrom, err := access.HashSearch(plan.IndexPath, plan.IndexName, scanKeys[0].Arg)
+		if err == nil && builtFrom != heapStamp {
+			err = outOfDate()
+		}
+		return entries, err
+	case access.GIN_AM_NAME:
+		//@> scan keys, the documents having all the keys of the arguments may contain them and the qual decides
+		queries := make([]*adt.Jsonb, len(scanKeys))
+		for i, scanKey := range scanKeys {
+			queries[i] = scanKey.Arg.(*adt.Jsonb)
+		}
+		entries, builtFrom, err := access.GinSearch(plan.IndexPath, plan.IndexName, queries)
+		if err == nil && builtFrom != heapStamp {
+			err = outOfDate()
+		}
+		return entries, err
+	}
+	include := make([]types.Oid, len(plan.IndexInclude))
+	for i, expr := range plan.IndexInclude {
+		include[i] = types.ExprType(expr)
+	}
+	index, err := access.BTOpen(plan.IndexPath, plan.IndexName, makeIndexKeys(plan.IndexKeys), include)
+	if err != nil {
+		return nil, err
+	}
+	if index.HeapStamp != heapStamp {
+		return nil, outOfDate()
+	}
+	return index.Search(scanKeys), nil
+}
+
+func (is *IndexScanState) Next() (types.Tuple, error) {
+	if !is.started {
+		if err := is.beginScan(); err != nil {
+			return nil, err
+		}
+	}
+	for is.pos < len(is.entries) {
+		entry := is.entries[is.pos]
+		is.pos++
+		line, err := access.HeapFetch(is.file, entry.Offset, entry.Length)
+		if err != nil {
+			return nil, fmt.Errorf("could not read relation \"%s\" at offset %d: %v", is.plan.Relname, entry.Offset, err)
+		}
+		if strings.HasPrefix(line, "\n") {
+			continue
+		}
+		tuple, err := heapFormTuple(is.plan.ColTypes, line, is.toast)
+		if err != nil {
+			return nil, fmt.Errorf("relation \"%s\" at offset %d: %v", is.plan.Relname, entry.Offset, err)
+		}
+
+		econtext := &ExprContext{ScanTuple: tuple, EState: is.estate}
+		ok, err := ExecQual(is.plan.Qual, econtext)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		is.tid = access.ItemPointer{Offset: entry.Offset, Length: entry.Length}
+		return ExecProject(is.plan.TargetList, econtext)
+	}
+	return nil, nil
+}
+
+func (is *IndexScanState) Close() error {
+	is.toast.Close()
+	err := is.file.Close()
+	access.UnlockRelationOid(is.plan.Relid, access.AccessShareLock, is.estate.owner)
+	return err
+}
@@ -0,0 +1,86 @@
+package executor
+
+import (
+	"fmt"
+
+	"github.com/rautNishan/diskquery/types"
+)
+
+// LimitState skips the first offset tuples and stops after count more
+type LimitState struct {
+	child    PlanState
+	offset   int64
+	count    int64
+	noCount  bool //LIMIT ALL / LIMIT NULL
+	position int64
+}
+
+func ExecInitLimit(node *types.Limit, estate *EState) (*LimitState, error) {
+	child, err := ExecInitNode(node.Lefttree, estate)
+	if err != nil {
+		return nil, err
+	}
+	ls := &LimitState{child: child, noCount: true}
+
+	if node.LimitOffset != nil {
+		offset, err := evalLimitExpr(node.LimitOffset, "OFFSET", estate)
+		if err != nil {
+			return nil, err
+		}
+		if offset != nil {
+			ls.offset = *offset
+		}
+	}
+	if node.LimitCount != nil {
+		count, err := evalLimitExpr(node.LimitCount, "LIMIT", estate)
+		if err != nil {
+			return nil, err
+		}
+		if count != nil {
+			ls.count = *count
+			ls.noCount = false
+		}
+	}
+
+	//Same as ExecSetTupleBound in postgres, a sort right below us only has to keep the top rows
+	if sortState, ok := child.(*SortState); ok && !ls.noCount {
+		sortState.SetBound(int(ls.offset + ls.count))
+	}
+	return ls, nil
+}
+
+// evalLimitExpr returns nil for a NULL limit, which means no limit at all
+func evalLimitExpr(expr types.Node, clause string, estate *EState) (*int64, error) {
+	value, err := ExecEvalExpr(expr, &ExprContext{EState: estate})
+	if err != nil || value == nil {
+		return nil, err
+	}
+	result := value.(int64)
+	if result < 0 {
+		return nil, fmt.Errorf("%s must not be negative", clause)
+	}
+	return &result, nil
+}
+
+func (ls *LimitState) Next() (types.Tuple, error) {
+	for ls.position < ls.offset {
+		tuple, err := ls.child.Next()
+		if err != nil || tuple == nil {
+			return nil, err
+		}
+		ls.position++
+	}
+	if !ls.noCount && ls.position >= ls.offset+ls.count {
+		return nil, nil
+	}
+	tuple, err := ls.child.Next()
+	if err != nil || tuple == nil {
+		return nil, err
+	}
+	ls.position++
+	return tuple, nil
+}
+
+func (ls *LimitState) Close() error {
+	return ls.child.Close()
+}
@@ -0,0 +1,387 @@
+package executor
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/rautNishan/diskquery/access"
+	"github.com/rautNishan/diskquery/adt"
+	"github.com/rautNishan/diskquery/catalog"
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+INSERT, UPDATE and DELETE (postgres executor/nodeModifyTable.c)
+
+The table is locked with AccessExclusiveLock from the start of the statement to its end, so the rows the subplan
+reads are still where it found them when they are changed and no other statement reads the table half written.
+The plan was made before the lock was taken: the table must still have the relation file and the indexes the
+plan knows of, a statement planned before a CREATE INDEX or DROP INDEX fails instead of leaving the index out.
+
+The subplan is run to the end first, then the new rows are checked, written and their index entries added:
+  - NOT NULL columns, and the text of each value must be one the relation file can store as it is, as we have
+    no quoting: no line breaks, no ',' but in the last column, not \N and not what reads as toasted
+  - unique btree indexes, against the entries of rows that are not being deleted and among the new rows
+  - the old rows are deleted (see access.HeapDelete) and the new ones inserted (access.HeapInsert), an UPDATE
+    is a delete and an insert as in postgres
+  - btree and hash indexes get the entries of the new rows added (access.BTInsert and access.HashInsert), gin
+    indexes are built again
+A crash in between leaves the indexes out of date with the relation file, the next statement changing the
+table builds them again, and the free space map with them, before doing anything (as VACUUM would)
+*/
+
+type ModifyTableState struct {
+	plan      *types.ModifyTable
+	estate    *EState
+	subplan   PlanState
+	done      bool
+	returning []types.Tuple //The RETURNING rows, returned once the statement is done
+	pos       int
+	processed int64 //Rows inserted, updated or deleted, what the command tag reports
+}
+
+// ExecInitModifyTable locks the table until the statement ends and checks the plan still fits it
+func ExecInitModifyTable(node *types.ModifyTable, estate *EState) (*ModifyTableState, error) {
+	if err := access.LockRelationOid(node.Relid, access.AccessExclusiveLock, estate.owner); err != nil {
+		return nil, err
+	}
+	mt := &ModifyTableState{plan: node, estate: estate}
+	err := mt.checkRelation()
+	if err == nil {
+		err = mt.repairIndexes()
+	}
+	if err == nil {
+		mt.subplan, err = ExecInitNode(node.Lefttree, estate)
+	}
+	if err != nil {
+		access.UnlockRelationOid(node.Relid, access.AccessExclusiveLock, estate.owner)
+		return nil, err
+	}
+	return mt, nil
+}
+
+// checkRelation fails when the table was dropped, rewritten or got other indexes after the plan was made
+func (mt *ModifyTableState) checkRelation() error {
+	rel, err := catalog.RelationIdGetRelation(mt.plan.Relid)
+	if err != nil {
+		return err
+	}
+	if rel == nil {
+		return fmt.Errorf("relation \"%s\" does not exist", mt.plan.Relname)
+	}
+	changed := rel.FilePath != mt.plan.FilePath || len(rel.Indexes) != len(mt.plan.Indexes)
+	for i := 0; !changed && i < len(rel.Indexes); i++ {
+		changed = rel.Indexes[i].Indexrelid != mt.plan.Indexes[i].Indexrelid
+	}
+	if changed {
+		return fmt.Errorf("could not serialize access due to concurrent update of relation \"%s\"", mt.plan.Relname)
+	}
+	return nil
+}
+
+/*
+repairIndexes builds the indexes and the free space map again when one of them is not of the relation file as
+it is: entries are only ever added to indexes of the current file, and the free space of dead rows only
+recorded once no index points at them. Every page is then all visible in the visibility map. The dead rows
+are still counted, VACUUM prunes them from their pages
+*/
+func (mt *ModifyTableState) repairIndexes() error {
+	current := access.FreeSpaceMapIsCurrent(mt.plan.FilePath)
+	for _, index := range mt.plan.Indexes {
+		current = current && access.IndexIsCurrent(index.Info.AccessMethod, index.Path, mt.plan.FilePath)
+	}
+	if current {
+		return nil
+	}
+	for _, index := range mt.plan.Indexes {
+		if err := BuildIndex(index.Info, mt.plan.Relname, mt.plan.FilePath, mt.plan.ColTypes, index.Path); err != nil {
+			return err
+		}
+	}
+	if err := access.VisibilityMapVacuum(mt.plan.FilePath, mt.plan.Relname); err != nil {
+		return err
+	}
+	return access.FreeSpaceMapVacuum(mt.plan.FilePath, mt.plan.Relname)
+}
+
+func (mt *ModifyTableState) Next() (types.Tuple, error) {
+	if !mt.done {
+		mt.done = true
+		if err := mt.execute(); err != nil {
+			return nil, err
+		}
+	}
+	if mt.pos == len(mt.returning) {
+		return nil, nil
+	}
+	mt.pos++
+	return mt.returning[mt.pos-1], nil
+}
+
+func (mt *ModifyTableState) execute() error {
+	plan := mt.plan
+	var rows []types.Tuple
+	var oldTids []access.ItemPointer
+	var heapStamp access.HeapStamp
+	for {
+		row, err := mt.subplan.Next()
+		if err != nil {
+			return err
+		}
+		if row == nil {
+			break
+		}
+		rows = append(rows, row)
+		switch scan := mt.subplan.(type) {
+		case *SeqScanState:
+			oldTids = append(oldTids, scan.tid)
+			heapStamp = scan.heapStamp
+		case *IndexScanState:
+			oldTids = append(oldTids, scan.tid)
+			heapStamp = scan.heapStamp
+		}
+	}
+	err := mt.subplan.Close()
+	mt.subplan = nil
+	if err != nil || len(rows) == 0 {
+		return err
+	}
+
+	var lines []string
+	if plan.Operation != types.CMD_DELETE {
+		if lines, err = mt.formLines(rows); err != nil {
+			return err
+		}
+	}
+	if plan.Operation != types.CMD_INSERT {
+		//Nothing of ours changes the file while we hold the lock, something outside of the server may have
+		if stamp, err := access.StatHeap(plan.FilePath); err != nil || stamp != heapStamp {
+			return fmt.Errorf("could not serialize access due to concurrent update of relation \"%s\"", plan.Relname)
+		}
+	}
+
+	//Index entries are stored, they are computed the same whatever session runs the statement
+	indexState := newEState(0, 0, &adt.DefaultSettings)
+	entries := make([][]access.IndexTuple, len(plan.Indexes))
+	matched := make([][]int, len(plan.Indexes)) //The rows each index has an entry for
+	if plan.Operation != types.CMD_DELETE {
+		for i, index := range plan.Indexes {
+			for j, row := range rows {
+				keys, matches, err := formIndexTuple(index.Info, row, indexState)
+				if err != nil {
+					return err
+				}
+				if matches {
+					entries[i] = append(entries[i], access.IndexTuple{Keys: keys})
+					matched[i] = append(matched[i], j)
+				}
+			}
+		}
+		if err := mt.checkUnique(entries, oldTids); err != nil {
+			return err
+		}
+	}
+
+	if len(oldTids) > 0 {
+		if err := access.HeapDelete(plan.FilePath, plan.Relname, oldTids, false); err != nil {
+			return err
+		}
+	}
+	var newTids []access.ItemPointer
+	if len(lines) > 0 {
+		if newTids, err = access.HeapInsert(plan.FilePath, plan.Relname, lines); err != nil {
+			return err
+		}
+	}
+	stamp, err := access.StatHeap(plan.FilePath)
+	if err != nil {
+		return fmt.Errorf("could not open file for relation \"%s\": %v", plan.Relname, err)
+	}
+	for i, index := range plan.Indexes {
+		for j := range entries[i] {
+			tid := newTids[matched[i][j]]
+			entries[i][j].Offset, entries[i][j].Length = tid.Offset, tid.Length
+		}
+		//DELETE adds nothing, the entries of the dead rows stay but the index is stamped with the new file
+		switch index.Info.AccessMethod {
+		case access.BTREE_AM_NAME:
+			var btree *access.BTIndex
+			if btree, err = openModifiedIndex(index); err == nil {
+				err = access.BTInsert(index.Path, btree, stamp, entries[i])
+			}
+		case access.HASH_AM_NAME:
+			err = access.HashInsert(index.Path, index.Info.Name, stamp, entries[i])
+		default:
+			err = BuildIndex(index.Info, plan.Relname, plan.FilePath, plan.ColTypes, index.Path)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	mt.processed = int64(len(rows))
+	switch plan.Operation {
+	case types.CMD_INSERT:
+		access.PgstatCountHeap(plan.Relid, mt.processed, 0, 0)
+	case types.CMD_UPDATE:
+		access.PgstatCountHeap(plan.Relid, 0, mt.processed, 0)
+	case types.CMD_DELETE:
+		access.PgstatCountHeap(plan.Relid, 0, 0, mt.processed)
+	}
+
+	if plan.ReturningList != nil {
+		for _, row := range rows {
+			econtext := &ExprContext{ScanTuple: row, EState: mt.estate}
+			result, err := ExecProject(plan.ReturningList, econtext)
+			if err != nil {
+				return err
+			}
+			mt.returning = append(mt.returning, result)
+		}
+	}
+	return nil
+}
+
+// formLines checks the new rows can be stored and makes their lines of the relation file
+func (mt *ModifyTableState) formLines(rows []types.Tuple) ([]string, error) {
+	plan := mt.plan
+	toast, err := access.OpenToastRelation(plan.FilePath)
+	if err != nil {
+		return nil, err
+	}
+	defer toast.Close()
+	lines := make([]string, len(rows))
+	fields := make([]string, len(plan.ColTypes))
+	for i, row := range rows {
+		for attno, value := range row {
+			if value == nil {
+				if plan.NotNull[attno] {
+					return nil, fmt.Errorf("null value in column \"%s\" of relation \"%s\" violates not-null constraint", plan.ColNames[attno], plan.Relname)
+				}
+				fields[attno] = `\N`
+				continue
+			}
+			field := adt.OutputDatum(value, &adt.DefaultSettings)
+			var problem string
+			switch {
+			case strings.ContainsAny(field, "\n\r"):
+				problem = "it contains a line break"
+			case attno < len(fields)-1 && strings.Contains(field, ","):
+				problem = "only the last column may contain ','"
+			case field == `\N`:
+				problem = `\N is read as NULL`
+			case toast.IsToasted(field):
+				problem = "it would be read as a toasted value"
+			}
+			if problem != "" {
+				return nil, fmt.Errorf("cannot store value of column \"%s\" of relation \"%s\": %s", plan.ColNames[attno], plan.Relname, problem)
+			}
+			fields[attno] = field
+		}
+		lines[i] = strings.Join(fields, ",")
+		if lines[i] == "" {
+			return nil, fmt.Errorf("cannot store value of column \"%s\" of relation \"%s\": an empty line is not a row", plan.ColNames[0], plan.Relname)
+		}
+	}
+	return lines, nil
+}
+
+/*
+checkUnique fails when a new entry of a unique btree index has the keys of another new entry or of an entry of
+a row that stays, NULL keys are distinct from each other. deleted are the rows the statement removes, the old
+versions of the rows of an UPDATE, and dead rows are not there any more either
+*/
+func (mt *ModifyTableState) checkUnique(entries [][]access.IndexTuple, deleted []access.ItemPointer) error {
+	var heap *os.File
+	defer func() {
+		if heap != nil {
+			heap.Close()
+		}
+	}()
+	isDeleted := make(map[access.ItemPointer]bool, len(deleted))
+	for _, tid := range deleted {
+		isDeleted[tid] = true
+	}
+	for i, index := range mt.plan.Indexes {
+		info := index.Info
+		if !info.Unique || info.AccessMethod != access.BTREE_AM_NAME {
+			continue
+		}
+		btree, err := openModifiedIndex(index)
+		if err != nil {
+			return err
+		}
+		nkeys := len(info.Keys)
+		duplicate := func(keys []types.Datum) error {
+			values := make([]string, nkeys)
+			for j, value := range keys[:nkeys] {
+				values[j] = adt.OutputDatum(value, &adt.DefaultSettings)
+			}
+			return fmt.Errorf("duplicate key value violates unique constraint \"%s\": Key (%s)=(%s) already exists",
+				info.Name, strings.Join(info.KeyNames, ", "), strings.Join(values, ", "))
+		}
+
+		var candidates []access.IndexTuple
+		for _, entry := range entries[i] {
+			if !hasNullKey(entry.Keys[:nkeys]) {
+				candidates = append(candidates, entry)
+			}
+		}
+		sorted := append([]access.IndexTuple(nil), candidates...)
+		access.BTSort(btree.Keys, sorted)
+		for j := 1; j < len(sorted); j++ {
+			if access.CompareIndexTuples(btree.Keys, sorted[j-1].Keys[:nkeys], sorted[j].Keys[:nkeys]) == 0 {
+				return duplicate(sorted[j].Keys)
+			}
+		}
+
+		for _, entry := range candidates {
+			scanKeys := make([]access.ScanKey, nkeys)
+			for attno := range scanKeys {
+				scanKeys[attno] = access.ScanKey{AttNo: attno, Strategy: types.BTEqualStrategyNumber, Arg: entry.Keys[attno]}
+			}
+			for _, match := range btree.Search(scanKeys) {
+				if isDeleted[access.ItemPointer{Offset: match.Offset, Length: match.Length}] {
+					continue
+				}
+				if heap == nil {
+					if heap, err = os.Open(mt.plan.FilePath); err != nil {
+						return fmt.Errorf("could not open file for relation \"%s\": %v", mt.plan.Relname, err)
+					}
+				}
+				first, err := access.HeapFetch(heap, match.Offset, 1)
+				if err != nil {
+					return fmt.Errorf("could not read relation \"%s\" at offset %d: %v", mt.plan.Relname, match.Offset, err)
+				}
+				if first != "\n" {
+					return duplicate(entry.Keys)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// openModifiedIndex reads a btree index of the table being changed
+func openModifiedIndex(index *types.ModifyTableIndex) (*access.BTIndex, error) {
+	include := make([]types.Oid, len(index.Info.Include))
+	for i, expr := range index.Info.Include {
+		include[i] = types.ExprType(expr)
+	}
+	return access.BTOpen(index.Path, index.Info.Name, makeIndexKeys(index.Info.Keys), include)
+}
+
+func (mt *ModifyTableState) Close() error {
+	var err error
+	if mt.subplan != nil {
+		err = mt.subplan.Close()
+	}
+	access.UnlockRelationOid(mt.plan.Relid, access.AccessExclusiveLock, mt.estate.owner)
+	return err
+}
+
+// Processed is the number of rows the statement inserted, updated or deleted
+func (mt *ModifyTableState) Processed() int64 {
+	return mt.processed
+}
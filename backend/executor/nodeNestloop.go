@@ -0,0 +1,158 @@
+package executor
+
+import "github.com/rautNishan/diskquery/types"
+
+/*
+Nested loop join
+
+The inner side is read once into a Tuplestore, then every outer tuple is joined with every stored inner
+tuple. In left and full joins an outer tuple without a match is returned with NULLs for the inner side.
+Right and full joins remember which inner tuples matched, the others come with NULLs for the outer side
+once the outer side is done
+*/
+type NestLoopState struct {
+	plan   *types.NestLoop
+	outer  PlanState
+	inner  PlanState
+	estate *EState
+
+	store        *Tuplestore //Inner tuples
+	innerMatched []bool      //Right and full joins only
+
+	outerTuple   types.Tuple //Outer tuple being joined, nil when the next one is needed
+	outerMatched bool
+	reader       *TuplestoreReader
+	innerPos     int
+	outerDone    bool
+}
+
+func ExecInitNestLoop(node *types.NestLoop, estate *EState) (*NestLoopState, error) {
+	outer, err := ExecInitNode(node.Lefttree, estate)
+	if err != nil {
+		return nil, err
+	}
+	inner, err := ExecInitNode(node.Righttree, estate)
+	if err != nil {
+		outer.Close()
+		return nil, err
+	}
+	return &NestLoopState{plan: node, outer: outer, inner: inner, estate: estate}, nil
+}
+
+func (ns *NestLoopState) Next() (types.Tuple, error) {
+	if ns.store == nil {
+		if err := ns.materializeInner(); err != nil {
+			return nil, err
+		}
+	}
+	for {
+		joined, err := ns.nextJoined()
+		if err != nil || joined == nil {
+			return nil, err
+		}
+		econtext := &ExprContext{ScanTuple: joined, EState: ns.estate}
+		ok, err := ExecQual(ns.plan.Qual, econtext)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return ExecProject(ns.plan.TargetList, econtext)
+		}
+	}
+}
+
+func (ns *NestLoopState) materializeInner() error {
+	ns.store = NewTuplestore(ns.estate.workMem)
+	for {
+		tuple, err := ns.inner.Next()
+		if err != nil {
+			return err
+		}
+		if tuple == nil {
+			return nil
+		}
+		if err := ns.store.PutTuple(tuple); err != nil {
+			return err
+		}
+		if ns.plan.JoinType == types.JOIN_RIGHT || ns.plan.JoinType == types.JOIN_FULL {
+			ns.innerMatched = append(ns.innerMatched, false)
+		}
+	}
+}
+
+// nextJoined returns the next joined tuple before Qual, nil when there are no more
+func (ns *NestLoopState) nextJoined() (types.Tuple, error) {
+	for !ns.outerDone {
+		if ns.outerTuple == nil {
+			tuple, err := ns.outer.Next()
+			if err != nil {
+				return nil, err
+			}
+			if tuple == nil {
+				ns.outerDone = true
+				ns.reader, ns.innerPos = ns.store.NewReader(), 0
+				break
+			}
+			ns.outerTuple, ns.outerMatched = tuple, false
+			ns.reader, ns.innerPos = ns.store.NewReader(), 0
+		}
+
+		innerTuple, err := ns.reader.Next()
+		if err != nil {
+			return nil, err
+		}
+		if innerTuple == nil {
+			outerTuple := ns.outerTuple
+			ns.outerTuple = nil
+			if !ns.outerMatched && (ns.plan.JoinType == types.JOIN_LEFT || ns.plan.JoinType == types.JOIN_FULL) {
+				return joinTuples(outerTuple, make(types.Tuple, ns.plan.InnerWidth)), nil
+			}
+			continue
+		}
+		innerPos := ns.innerPos
+		ns.innerPos++
+
+		joined := joinTuples(ns.outerTuple, innerTuple)
+		matched, err := ExecQual(ns.plan.JoinQual, &ExprContext{ScanTuple: joined, EState: ns.estate})
+		if err != nil {
+			return nil, err
+		}
+		if matched {
+			ns.outerMatched = true
+			if ns.innerMatched != nil {
+				ns.innerMatched[innerPos] = true
+			}
+			return joined, nil
+		}
+	}
+
+	//The inner tuples no outer tuple matched
+	for ns.innerMatched != nil {
+		innerTuple, err := ns.reader.Next()
+		if err != nil || innerTuple == nil {
+			return nil, err
+		}
+		innerPos := ns.innerPos
+		ns.innerPos++
+		if !ns.innerMatched[innerPos] {
+			return joinTuples(make(types.Tuple, ns.plan.OuterWidth), innerTuple), nil
+		}
+	}
+	return nil, nil
+}
+
+func joinTuples(outer types.Tuple, inner types.Tuple) types.Tuple {
+	joined := make(types.Tuple, 0, len(outer)+len(inner))
+	return append(append(joined, outer...), inner...)
+}
+
+func (ns *NestLoopState) Close() error {
+	if ns.store != nil {
+		ns.store.End()
+	}
+	err := ns.outer.Close()
+	if ierr := ns.inner.Close(); err == nil {
+		err = ierr
+	}
+	return err
+}
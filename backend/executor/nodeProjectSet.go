@@ -0,0 +1,84 @@
+package executor
+
+import (
+	"github.com/rautNishan/diskquery/adt"
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+ProjectSetState evaluates a select list with set returning functions in it (postgres nodeProjectSet.c)
+For every input tuple the sets are computed first, then the target list is projected once per row of
+the longest set, with the functions' values of that row and NULL for sets that ran out already.
+An input tuple whose sets are all empty gives no rows
+*/
+type ProjectSetState struct {
+	plan   *types.ProjectSet
+	child  PlanState
+	estate *EState
+	funcs  []*types.FuncExpr //The set returning calls in the target list
+
+	tuple types.Tuple //Input tuple the sets belong to
+	sets  [][]types.Datum
+	nrows int
+	row   int
+}
+
+func ExecInitProjectSet(node *types.ProjectSet, estate *EState) (*ProjectSetState, error) {
+	child, err := ExecInitNode(node.Lefttree, estate)
+	if err != nil {
+		return nil, err
+	}
+	ps := &ProjectSetState{plan: node, child: child, estate: estate}
+	for _, tle := range node.TargetList {
+		types.ExprWalker(tle.Expr, func(n types.Node) bool {
+			if fn, ok := n.(*types.FuncExpr); ok && adt.LookupFunction(fn.Funcid).Retset {
+				ps.funcs = append(ps.funcs, fn)
+				return false
+			}
+			return true
+		})
+	}
+	return ps, nil
+}
+
+func (ps *ProjectSetState) Next() (types.Tuple, error) {
+	for ps.row >= ps.nrows {
+		tuple, err := ps.child.Next()
+		if err != nil || tuple == nil {
+			return nil, err
+		}
+		if err := ps.computeSets(tuple); err != nil {
+			return nil, err
+		}
+	}
+
+	srfValues := make(map[*types.FuncExpr]types.Datum, len(ps.funcs))
+	for i, fn := range ps.funcs {
+		if ps.row < len(ps.sets[i]) {
+			srfValues[fn] = ps.sets[i][ps.row]
+		} else {
+			srfValues[fn] = nil
+		}
+	}
+	ps.row++
+	econtext := &ExprContext{ScanTuple: ps.tuple, EState: ps.estate, SRFValues: srfValues}
+	return ExecProject(ps.plan.TargetList, econtext)
+}
+
+func (ps *ProjectSetState) computeSets(tuple types.Tuple) error {
+	econtext := &ExprContext{ScanTuple: tuple, EState: ps.estate}
+	ps.tuple, ps.sets, ps.nrows, ps.row = tuple, make([][]types.Datum, len(ps.funcs)), 0, 0
+	for i, fn := range ps.funcs {
+		values, err := execEvalSetFunction(fn, econtext)
+		if err != nil {
+			return err
+		}
+		ps.sets[i] = values
+		ps.nrows = max(ps.nrows, len(values))
+	}
+	return nil
+}
+
+func (ps *ProjectSetState) Close() error {
+	return ps.child.Close()
+}
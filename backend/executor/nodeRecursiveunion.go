@@ -0,0 +1,148 @@
+package executor
+
+import "github.com/rautNishan/diskquery/types"
+
+/*
+RecursiveUnion runs WITH RECURSIVE (postgres executor/nodeRecursiveunion.c)
+
+First every row of the non-recursive term is returned and also put in the intermediate table.
+Then, round after round, the intermediate table becomes the work table, the recursive term runs from
+the start reading it through its WorkTableScan, and the rows it returns are returned and go into a new
+intermediate table. It stops after a round that returned nothing.
+
+For UNION (without ALL) every row returned so far is kept in a hash table and duplicates are dropped,
+so a recursive query over cyclic data still ends once it stops finding new rows. Like in postgres that
+hash table is not spilled to disk, the work and intermediate tables are.
+
+The work table's Param holds the round number, so SubPlans of the recursive term that read the work
+table see their ExtParams change and run again every round.
+*/
+type RecursiveUnionState struct {
+	plan         *types.RecursiveUnion
+	estate       *EState
+	nonRecursive PlanState
+	recursive    PlanState //The running round, nil between rounds
+	leftDone     bool
+
+	working      *Tuplestore
+	intermediate *Tuplestore
+	round        int64
+	seen         map[string]struct{}
+}
+
+func ExecInitRecursiveUnion(node *types.RecursiveUnion, estate *EState) (*RecursiveUnionState, error) {
+	nonRecursive, err := ExecInitNode(node.Lefttree, estate)
+	if err != nil {
+		return nil, err
+	}
+	rs := &RecursiveUnionState{
+		plan:         node,
+		estate:       estate,
+		nonRecursive: nonRecursive,
+		intermediate: NewTuplestore(estate.workMem),
+	}
+	if !node.All {
+		rs.seen = make(map[string]struct{})
+	}
+	//Rounds are numbered on from an earlier run, its cached SubPlan results must not match ours
+	rs.round, _ = estate.ParamExecVals[node.WtParam].(int64)
+	return rs, nil
+}
+
+func (rs *RecursiveUnionState) Next() (types.Tuple, error) {
+	for !rs.leftDone {
+		tuple, err := rs.nonRecursive.Next()
+		if err != nil {
+			return nil, err
+		}
+		if tuple == nil {
+			rs.leftDone = true
+			break
+		}
+		isNew, err := rs.isNew(tuple)
+		if err != nil {
+			return nil, err
+		}
+		if isNew {
+			return tuple, rs.intermediate.PutTuple(tuple)
+		}
+	}
+
+	for {
+		if rs.recursive == nil {
+			if rs.intermediate.Count() == 0 {
+				return nil, nil
+			}
+			if err := rs.startRound(); err != nil {
+				return nil, err
+			}
+		}
+		tuple, err := rs.recursive.Next()
+		if err != nil {
+			return nil, err
+		}
+		if tuple == nil {
+			err := rs.recursive.Close()
+			rs.recursive = nil
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		isNew, err := rs.isNew(tuple)
+		if err != nil {
+			return nil, err
+		}
+		if isNew {
+			return tuple, rs.intermediate.PutTuple(tuple)
+		}
+	}
+}
+
+// startRound makes the rows of the last round the work table and starts the recursive term over it
+func (rs *RecursiveUnionState) startRound() error {
+	if rs.working != nil {
+		rs.working.End()
+	}
+	rs.working, rs.intermediate = rs.intermediate, NewTuplestore(rs.estate.workMem)
+	rs.round++
+	rs.estate.ParamExecVals[rs.plan.WtParam] = rs.round
+	rs.estate.workTables[rs.plan.WtParam] = rs.working
+
+	recursive, err := ExecInitNode(rs.plan.Righttree, rs.estate)
+	if err != nil {
+		return err
+	}
+	rs.recursive = recursive
+	return nil
+}
+
+func (rs *RecursiveUnionState) isNew(tuple types.Tuple) (bool, error) {
+	if rs.seen == nil {
+		return true, nil
+	}
+	key, err := hashKey(tuple)
+	if err != nil {
+		return false, err
+	}
+	if _, found := rs.seen[key]; found {
+		return false, nil
+	}
+	rs.seen[key] = struct{}{}
+	return true, nil
+}
+
+func (rs *RecursiveUnionState) Close() error {
+	if rs.working != nil {
+		rs.working.End()
+	}
+	rs.intermediate.End()
+	delete(rs.estate.workTables, rs.plan.WtParam)
+	err := rs.nonRecursive.Close()
+	if rs.recursive != nil {
+		if rerr := rs.recursive.Close(); err == nil {
+			err = rerr
+		}
+	}
+	return err
+}
@@ -0,0 +1,67 @@
+package executor
+
+import "github.com/rautNishan/diskquery/types"
+
+/*
+ResultState without a child produces a single row computed from its target list (SELECT 1 + 1)
+With a child it projects every tuple the child returns
+*/
+type ResultState struct {
+	plan   *types.Result
+	child  PlanState
+	estate *EState
+	done   bool
+}
+
+func ExecInitResult(node *types.Result, estate *EState) (*ResultState, error) {
+	rs := &ResultState{plan: node, estate: estate}
+	if node.Lefttree != nil {
+		child, err := ExecInitNode(node.Lefttree, estate)
+		if err != nil {
+			return nil, err
+		}
+		rs.child = child
+	}
+	return rs, nil
+}
+
+func (rs *ResultState) Next() (types.Tuple, error) {
+	if rs.child != nil {
+		return rs.nextProjected()
+	}
+	if rs.done {
+		return nil, nil
+	}
+	rs.done = true
+
+	econtext := &ExprContext{ScanTuple: types.Tuple{}, EState: rs.estate}
+	ok, err := ExecQual(rs.plan.Qual, econtext)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return ExecProject(rs.plan.TargetList, econtext)
+}
+
+func (rs *ResultState) nextProjected() (types.Tuple, error) {
+	for {
+		tuple, err := rs.child.Next()
+		if err != nil || tuple == nil {
+			return nil, err
+		}
+		econtext := &ExprContext{ScanTuple: tuple, EState: rs.estate}
+		ok, err := ExecQual(rs.plan.Qual, econtext)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return ExecProject(rs.plan.TargetList, econtext)
+		}
+	}
+}
+
+func (rs *ResultState) Close() error {
+	if rs.child != nil {
+		return rs.child.Close()
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package executor
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rautNishan/diskquery/access"
+	"github.com/rautNishan/diskquery/adt"
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+Sequential scan over a relation's data file
+Every line is a row, columns are separated by ',' (the last column gets the rest of the line)
+Fields are in the text form of the column type, read with its input function
+A field \N is NULL (as in COPY's text format), so are the columns missing at the end of a short line
+Toasted fields are detoasted first (see access/heaptoast.go)
+The relation is read with access.HeapScan, which tells where each row is for UPDATE and DELETE
+*/
+type SeqScanState struct {
+	plan      *types.SeqScan
+	estate    *EState
+	scan      *access.HeapScan
+	toast     *access.ToastRelation
+	heapStamp access.HeapStamp   //Of the relation file when the scan started
+	tid       access.ItemPointer //Where the row last returned is, what UPDATE and DELETE change
+}
+
+// ExecInitSeqScan locks the relation for reading until the scan is closed
+func ExecInitSeqScan(node *types.SeqScan, estate *EState) (*SeqScanState, error) {
+	if err := access.LockRelationOid(node.Relid, access.AccessShareLock, estate.owner); err != nil {
+		return nil, err
+	}
+	ss := &SeqScanState{plan: node, estate: estate}
+	if err := ss.open(); err != nil {
+		access.UnlockRelationOid(node.Relid, access.AccessShareLock, estate.owner)
+		return nil, err
+	}
+	return ss, nil
+}
+
+func (ss *SeqScanState) open() error {
+	var err error
+	if ss.heapStamp, err = access.StatHeap(ss.plan.FilePath); err != nil {
+		return fmt.Errorf("could not open file for relation \"%s\": %v", ss.plan.Relname, err)
+	}
+	if ss.scan, err = access.HeapBeginScan(ss.plan.FilePath, ss.plan.Relname); err != nil {
+		return err
+	}
+	if ss.toast, err = access.OpenToastRelation(ss.plan.FilePath); err != nil {
+		ss.scan.End()
+		return err
+	}
+	return nil
+}
+
+func (ss *SeqScanState) Next() (types.Tuple, error) {
+	for {
+		line, offset, length, ok, err := ss.scan.Next()
+		if err != nil {
+			return nil, fmt.Errorf("could not read relation \"%s\": %v", ss.plan.Relname, err)
+		}
+		if !ok {
+			return nil, nil
+		}
+		tuple, err := ss.parseLine(line)
+		if err != nil {
+			return nil, err
+		}
+
+		econtext := &ExprContext{ScanTuple: tuple, EState: ss.estate}
+		ok, err = ExecQual(ss.plan.Qual, econtext)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		ss.tid = access.ItemPointer{Offset: offset, Length: length}
+		return ExecProject(ss.plan.TargetList, econtext)
+	}
+}
+
+func (ss *SeqScanState) parseLine(line string) (types.Tuple, error) {
+	tuple, err := heapFormTuple(ss.plan.ColTypes, line, ss.toast)
+	if err != nil {
+		return nil, fmt.Errorf("relation \"%s\" line %d: %v", ss.plan.Relname, ss.scan.LineNo, err)
+	}
+	return tuple, nil
+}
+
+// heapFormTuple reads the columns of a row from its line, toast is the toast file of the relation
+func heapFormTuple(colTypes []types.Oid, line string, toast *access.ToastRelation) (types.Tuple, error) {
+	fields := strings.SplitN(line, ",", len(colTypes))
+	tuple := make(types.Tuple, len(colTypes))
+	for i, field := range fields {
+		if field == `\N` {
+			continue
+		}
+		field, err := toast.Detoast(field)
+		if err != nil {
+			return nil, err
+		}
+		value, err := adt.InputDatum(colTypes[i], field, &adt.DefaultSettings)
+		if err != nil {
+			return nil, err
+		}
+		tuple[i] = value
+	}
+	return tuple, nil
+}
+
+func (ss *SeqScanState) Close() error {
+	ss.toast.Close()
+	err := ss.scan.End()
+	access.UnlockRelationOid(ss.plan.Relid, access.AccessShareLock, ss.estate.owner)
+	return err
+}
@@ -0,0 +1,244 @@
+package executor
+
+import (
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+SetOp implements INTERSECT and EXCEPT
+
+For every distinct tuple we count how often it appears on the left (nleft) and right (nright) side,
+then output it this many times:
+
+INTERSECT      nleft > 0 && nright > 0 ? 1 : 0
+INTERSECT ALL  min(nleft, nright)
+EXCEPT         nleft > 0 && nright == 0 ? 1 : 0
+EXCEPT ALL     max(nleft - nright, 0)
+
+SETOP_HASHED counts in a hash table (only tuples seen on the left can ever be output, so the
+right side only updates existing entries). SETOP_SORTED gets both sides sorted on all columns
+and walks them like a merge join. NULLs are equal to each other here, same as DISTINCT.
+*/
+
+type setOpGroup struct {
+	tuple  types.Tuple
+	nleft  int64
+	nright int64
+}
+
+type SetOpState struct {
+	plan  *types.SetOp
+	left  PlanState
+	right PlanState
+
+	//Tuple waiting to be returned and how many more copies of it are owed
+	output    types.Tuple
+	numOutput int64
+
+	//SETOP_HASHED
+	groups  []*setOpGroup
+	emitPos int
+	filled  bool
+
+	//SETOP_SORTED, the next unconsumed tuple of each side
+	leftNext  types.Tuple
+	rightNext types.Tuple
+	started   bool
+}
+
+func ExecInitSetOp(node *types.SetOp, estate *EState) (*SetOpState, error) {
+	left, err := ExecInitNode(node.Lefttree, estate)
+	if err != nil {
+		return nil, err
+	}
+	right, err := ExecInitNode(node.Righttree, estate)
+	if err != nil {
+		left.Close()
+		return nil, err
+	}
+	return &SetOpState{plan: node, left: left, right: right}, nil
+}
+
+func (ss *SetOpState) Next() (types.Tuple, error) {
+	for ss.numOutput == 0 {
+		var group *setOpGroup
+		var err error
+		if ss.plan.Strategy == types.SETOP_HASHED {
+			group, err = ss.nextHashedGroup()
+		} else {
+			group, err = ss.nextSortedGroup()
+		}
+		if err != nil || group == nil {
+			return nil, err
+		}
+		ss.output, ss.numOutput = group.tuple, ss.numOutputFor(group)
+	}
+	ss.numOutput--
+	return ss.output, nil
+}
+
+func (ss *SetOpState) numOutputFor(group *setOpGroup) int64 {
+	if ss.plan.Cmd == types.SETOP_INTERSECT {
+		if ss.plan.All {
+			return min(group.nleft, group.nright)
+		}
+		if group.nleft > 0 && group.nright > 0 {
+			return 1
+		}
+		return 0
+	}
+	if ss.plan.All {
+		return max(group.nleft-group.nright, 0)
+	}
+	if group.nleft > 0 && group.nright == 0 {
+		return 1
+	}
+	return 0
+}
+
+func (ss *SetOpState) nextHashedGroup() (*setOpGroup, error) {
+	if !ss.filled {
+		if err := ss.fillHashTable(); err != nil {
+			return nil, err
+		}
+		ss.filled = true
+	}
+	if ss.emitPos >= len(ss.groups) {
+		return nil, nil
+	}
+	group := ss.groups[ss.emitPos]
+	ss.groups[ss.emitPos] = nil
+	ss.emitPos++
+	return group, nil
+}
+
+func (ss *SetOpState) fillHashTable() error {
+	table := make(map[string]*setOpGroup)
+	for {
+		tuple, err := ss.left.Next()
+		if err != nil {
+			return err
+		}
+		if tuple == nil {
+			break
+		}
+		key, err := hashKey(tuple)
+		if err != nil {
+			return err
+		}
+		group, ok := table[key]
+		if !ok {
+			group = &setOpGroup{tuple: tuple}
+			table[key] = group
+			ss.groups = append(ss.groups, group)
+		}
+		group.nleft++
+	}
+
+	for {
+		tuple, err := ss.right.Next()
+		if err != nil {
+			return err
+		}
+		if tuple == nil {
+			return nil
+		}
+		key, err := hashKey(tuple)
+		if err != nil {
+			return err
+		}
+		if group, ok := table[key]; ok {
+			group.nright++
+		}
+	}
+}
+
+// nextSortedGroup returns the next distinct tuple with its counts from both sorted inputs
+func (ss *SetOpState) nextSortedGroup() (*setOpGroup, error) {
+	if !ss.started {
+		var err error
+		if ss.leftNext, err = ss.left.Next(); err != nil {
+			return nil, err
+		}
+		if ss.rightNext, err = ss.right.Next(); err != nil {
+			return nil, err
+		}
+		ss.started = true
+	}
+
+	for ss.leftNext != nil {
+		group := &setOpGroup{tuple: ss.leftNext}
+
+		//Skip right tuples smaller than the group, they can never be output
+		cmp := -1
+		for ss.rightNext != nil {
+			var err error
+			cmp, err = compareTuples(ss.rightNext, group.tuple)
+			if err != nil {
+				return nil, err
+			}
+			if cmp >= 0 {
+				break
+			}
+			if ss.rightNext, err = ss.right.Next(); err != nil {
+				return nil, err
+			}
+		}
+
+		if err := countRun(ss.left, &ss.leftNext, group.tuple, &group.nleft); err != nil {
+			return nil, err
+		}
+		if ss.rightNext != nil && cmp == 0 {
+			if err := countRun(ss.right, &ss.rightNext, group.tuple, &group.nright); err != nil {
+				return nil, err
+			}
+		}
+		return group, nil
+	}
+	return nil, nil
+}
+
+// countRun consumes the tuples equal to tuple from input, next holds the first one that differs
+func countRun(input PlanState, next *types.Tuple, tuple types.Tuple, count *int64) error {
+	for *next != nil {
+		cmp, err := compareTuples(*next, tuple)
+		if err != nil {
+			return err
+		}
+		if cmp != 0 {
+			return nil
+		}
+		*count++
+		if *next, err = input.Next(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compareTuples compares column by column in the order the Sort below us produced, NULLs last
+func compareTuples(a types.Tuple, b types.Tuple) (int, error) {
+	for i := range a {
+		switch {
+		case a[i] == nil && b[i] == nil:
+			continue
+		case a[i] == nil:
+			return 1, nil
+		case b[i] == nil:
+			return -1, nil
+		}
+		cmp, err := CompareDatums(a[i], b[i])
+		if err != nil || cmp != 0 {
+			return cmp, err
+		}
+	}
+	return 0, nil
+}
+
+func (ss *SetOpState) Close() error {
+	lerr := ss.left.Close()
+	if rerr := ss.right.Close(); lerr == nil {
+		return rerr
+	}
+	return lerr
+}
@@ -0,0 +1,110 @@
+package executor
+
+import (
+	"github.com/rautNishan/diskquery/types"
+)
+
+// SortState reads its whole input into a Tuplesort and then returns the tuples in order
+type SortState struct {
+	plan      *types.Sort
+	child     PlanState
+	estate    *EState
+	tuplesort *Tuplesort
+	bound     int
+	done      bool
+}
+
+func ExecInitSort(node *types.Sort, estate *EState) (*SortState, error) {
+	child, err := ExecInitNode(node.Lefttree, estate)
+	if err != nil {
+		return nil, err
+	}
+	return &SortState{plan: node, child: child, estate: estate}, nil
+}
+
+// SetBound is called by a Limit above us, only the first bound tuples will ever be fetched
+func (ss *SortState) SetBound(bound int) {
+	ss.bound = bound
+}
+
+func (ss *SortState) Next() (types.Tuple, error) {
+	if !ss.done {
+		if err := ss.sortInput(); err != nil {
+			return nil, err
+		}
+		ss.done = true
+	}
+	return ss.tuplesort.GetTuple()
+}
+
+func (ss *SortState) sortInput() error {
+	ss.tuplesort = NewTuplesort(ss.plan.SortKeys, ss.estate.workMem, ss.estate)
+	ss.tuplesort.SetBound(ss.bound)
+	for {
+		tuple, err := ss.child.Next()
+		if err != nil {
+			return err
+		}
+		if tuple == nil {
+			break
+		}
+		if err := ss.tuplesort.PutTuple(tuple); err != nil {
+			return err
+		}
+	}
+	return ss.tuplesort.PerformSort()
+}
+
+func evalSortKeys(sortKeys []types.SortKey, tuple types.Tuple, estate *EState) ([]types.Datum, error) {
+	econtext := &ExprContext{ScanTuple: tuple, EState: estate}
+	keys := make([]types.Datum, len(sortKeys))
+	for i, sortKey := range sortKeys {
+		value, err := ExecEvalExpr(sortKey.Expr, econtext)
+		if err != nil {
+			return nil, err
+		}
+		keys[i] = value
+	}
+	return keys, nil
+}
+
+// compareSortKeys compares two rows key by key, NULLs go wherever NullsFirst says
+func compareSortKeys(sortKeys []types.SortKey, a []types.Datum, b []types.Datum) (int, error) {
+	for i, sortKey := range sortKeys {
+		var cmp int
+		switch {
+		case a[i] == nil && b[i] == nil:
+			cmp = 0
+		case a[i] == nil:
+			cmp = 1
+			if sortKey.NullsFirst {
+				cmp = -1
+			}
+		case b[i] == nil:
+			cmp = -1
+			if sortKey.NullsFirst {
+				cmp = 1
+			}
+		default:
+			var err error
+			cmp, err = CompareDatums(a[i], b[i])
+			if err != nil {
+				return 0, err
+			}
+			if sortKey.Desc {
+				cmp = -cmp
+			}
+		}
+		if cmp != 0 {
+			return cmp, nil
+		}
+	}
+	return 0, nil
+}
+
+func (ss *SortState) Close() error {
+	if ss.tuplesort != nil {
+		ss.tuplesort.End()
+	}
+	return ss.child.Close()
+}
@@ -0,0 +1,199 @@
+package executor
+
+import (
+	"fmt"
+
+	"github.com/rautNishan/diskquery/adt"
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+SubPlans, subqueries used inside an expression (postgres executor/nodeSubplan.c)
+
+A correlated SubPlan first copies the outer row's values into its Params, then runs its plan from
+the start. An uncorrelated one runs once and keeps the result, unless it reads Params of a query
+further out (ExtParams), then it runs again whenever their values changed.
+For ANY / ALL the cached result is the first column of every row, the left hand side is compared
+against them on every call.
+*/
+
+type subPlanState struct {
+	valid     bool
+	extValues string //Encoded ExtParams the cached result was computed with
+	result    types.Datum
+	rows      []types.Datum //ANY / ALL
+}
+
+func execEvalSubPlan(subplan *types.SubPlan, econtext *ExprContext) (types.Datum, error) {
+	estate := econtext.EState
+	for i, arg := range subplan.Args {
+		value, err := ExecEvalExpr(arg, econtext)
+		if err != nil {
+			return nil, err
+		}
+		estate.ParamExecVals[subplan.ParParams[i]] = value
+	}
+
+	var testValue types.Datum
+	if subplan.Testexpr != nil {
+		var err error
+		if testValue, err = ExecEvalExpr(subplan.Testexpr, econtext); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(subplan.ParParams) > 0 {
+		return execScanSubPlan(subplan, testValue, estate)
+	}
+	return execCachedSubPlan(subplan, testValue, estate)
+}
+
+func execScanSubPlan(subplan *types.SubPlan, testValue types.Datum, estate *EState) (types.Datum, error) {
+	switch subplan.SubLinkType {
+	case types.EXISTS_SUBLINK:
+		found := false
+		err := runSubPlan(subplan, estate, func(types.Tuple) (bool, error) {
+			found = true
+			return false, nil
+		})
+		return found, err
+
+	case types.EXPR_SUBLINK:
+		var result types.Datum
+		seen := false
+		err := runSubPlan(subplan, estate, func(tuple types.Tuple) (bool, error) {
+			if seen {
+				return false, fmt.Errorf("more than one row returned by a subquery used as an expression")
+			}
+			seen = true
+			result = tuple[0]
+			return true, nil
+		})
+		//No row at all is NULL
+		return result, err
+	}
+
+	acc := anyAllAccum{isAll: subplan.SubLinkType == types.ALL_SUBLINK, settings: estate.settings}
+	err := runSubPlan(subplan, estate, func(tuple types.Tuple) (bool, error) {
+		if err := acc.add(subplan.OperName, testValue, tuple[0]); err != nil {
+			return false, err
+		}
+		return !acc.done, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return acc.final(), nil
+}
+
+func execCachedSubPlan(subplan *types.SubPlan, testValue types.Datum, estate *EState) (types.Datum, error) {
+	state, ok := estate.subPlans[subplan]
+	if !ok {
+		state = &subPlanState{}
+		estate.subPlans[subplan] = state
+	}
+
+	extValues := make(types.Tuple, len(subplan.ExtParams))
+	for i, paramId := range subplan.ExtParams {
+		extValues[i] = estate.ParamExecVals[paramId]
+	}
+	keyBuf, err := encodeTuple(nil, extValues)
+	if err != nil {
+		return nil, err
+	}
+	key := string(keyBuf)
+
+	isAnyAll := subplan.SubLinkType == types.ANY_SUBLINK || subplan.SubLinkType == types.ALL_SUBLINK
+	if !state.valid || state.extValues != key {
+		if isAnyAll {
+			state.rows = nil
+			err := runSubPlan(subplan, estate, func(tuple types.Tuple) (bool, error) {
+				state.rows = append(state.rows, tuple[0])
+				return true, nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			result, err := execScanSubPlan(subplan, nil, estate)
+			if err != nil {
+				return nil, err
+			}
+			state.result = result
+		}
+		state.valid = true
+		state.extValues = key
+	}
+
+	if !isAnyAll {
+		return state.result, nil
+	}
+	acc := anyAllAccum{isAll: subplan.SubLinkType == types.ALL_SUBLINK, settings: estate.settings}
+	for _, value := range state.rows {
+		if err := acc.add(subplan.OperName, testValue, value); err != nil {
+			return nil, err
+		}
+		if acc.done {
+			break
+		}
+	}
+	return acc.final(), nil
+}
+
+// runSubPlan runs the subplan from the start and hands every row to fn until fn returns false
+func runSubPlan(subplan *types.SubPlan, estate *EState, fn func(types.Tuple) (bool, error)) error {
+	state, err := ExecInitNode(subplan.Plan, estate)
+	if err != nil {
+		return err
+	}
+	defer state.Close()
+	for {
+		tuple, err := state.Next()
+		if err != nil || tuple == nil {
+			return err
+		}
+		more, err := fn(tuple)
+		if err != nil || !more {
+			return err
+		}
+	}
+}
+
+/*
+anyAllAccum combines the comparisons of ANY / ALL with three valued logic
+ANY is true once a comparison is true, ALL is false once one is false. Otherwise a NULL
+comparison makes the result NULL, and without any row ANY is false and ALL is true
+*/
+type anyAllAccum struct {
+	isAll    bool
+	settings *adt.Settings
+	sawNull  bool
+	done     bool
+	result   bool
+}
+
+func (acc *anyAllAccum) add(op string, testValue types.Datum, value types.Datum) error {
+	if testValue == nil || value == nil {
+		acc.sawNull = true
+		return nil
+	}
+	cmp, err := execOperator(op, []types.Datum{testValue, value}, acc.settings)
+	if err != nil {
+		return err
+	}
+	if matched := cmp.(bool); matched != acc.isAll {
+		acc.done = true
+		acc.result = matched
+	}
+	return nil
+}
+
+func (acc *anyAllAccum) final() types.Datum {
+	if acc.done {
+		return acc.result
+	}
+	if acc.sawNull {
+		return nil
+	}
+	return acc.isAll
+}
@@ -0,0 +1,777 @@
+package executor
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/rautNishan/diskquery/adt"
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+Window aggregation (postgres executor/nodeWindowAgg.c)
+
+The input arrives sorted by the partition keys and then the order keys. We read a whole partition into
+a tuplestore (it spills to disk past work_mem) and then return its rows one by one, each with the results
+of the window functions appended.
+
+Rows with equal order keys are peers, they form a peer group. rank and friends only need the current
+row's peer group, lag and lead read rows by their position in the partition.
+Aggregates and first_value / last_value / nth_value work on the frame of the current row, [frameHead, frameTail)
+minus what EXCLUDE removes. The ROWS frame counts rows, GROUPS counts peer groups and RANGE compares the
+value of the single order key with the current row's. All frame bounds only move forward as the current row
+does, so cursors walking over the partition find them.
+
+An aggregate keeps its state from one row to the next as long as the frame start does not move, only the
+rows the frame end moved over are added (the common running total). Otherwise it starts again from the frame start
+*/
+
+type WindowAggState struct {
+	plan    *types.WindowAgg
+	child   PlanState
+	estate  *EState
+	funcs   []*windowFuncState
+	partKey []types.SortKey //Partition keys as sort keys, to compare partition key values
+
+	buffer  *Tuplestore //Rows of the current partition
+	pending types.Tuple //First row of the next partition
+	started bool
+
+	current   *windowCursor //The row we return next
+	groupHead int           //First row of the current row's peer group
+	peerTail  *windowCursor //Finds the end of the current row's peer group
+	fetcher   *TuplestoreReader
+
+	//Frame of the current row
+	startOffset types.Datum
+	endOffset   types.Datum
+	frameValid  bool
+	frameHead   int
+	frameTail   int
+	headCursor  *windowCursor //RANGE and GROUPS offsets
+	tailCursor  *windowCursor
+}
+
+type windowFuncState struct {
+	wfunc *types.WindowFunc
+
+	//Aggregates, aggregated rows are [aggHead, aggTail)
+	aggref  *types.Aggref
+	trans   aggTrans
+	aggHead int
+	aggTail int
+	reader  *TuplestoreReader
+
+	//ntile, the number of buckets for this partition
+	buckets    types.Datum
+	hasBuckets bool
+}
+
+func ExecInitWindowAgg(node *types.WindowAgg, estate *EState) (*WindowAggState, error) {
+	child, err := ExecInitNode(node.Lefttree, estate)
+	if err != nil {
+		return nil, err
+	}
+	ws := &WindowAggState{plan: node, child: child, estate: estate}
+	for _, wfunc := range node.WindowFuncs {
+		state := &windowFuncState{wfunc: wfunc}
+		if wfunc.WinAgg {
+			state.aggref = &types.Aggref{
+				AggName:   wfunc.WinName,
+				Args:      wfunc.Args,
+				AggStar:   wfunc.WinStar,
+				AggFilter: wfunc.AggFilter,
+				AggType:   wfunc.WinType,
+			}
+		}
+		ws.funcs = append(ws.funcs, state)
+	}
+	for _, expr := range node.PartitionKeys {
+		ws.partKey = append(ws.partKey, types.SortKey{Expr: expr})
+	}
+	return ws, nil
+}
+
+func (ws *WindowAggState) Next() (types.Tuple, error) {
+	if ws.current == nil || ws.current.pos+1 >= ws.buffer.Count() {
+		more, err := ws.beginPartition()
+		if err != nil || !more {
+			return nil, err
+		}
+	} else {
+		if err := ws.current.advance(); err != nil {
+			return nil, err
+		}
+		if ws.current.newGroup {
+			ws.groupHead = ws.current.pos
+		}
+	}
+	ws.frameValid = false
+
+	input := ws.current.tuple
+	result := make(types.Tuple, len(input), len(input)+len(ws.funcs))
+	copy(result, input)
+	for _, state := range ws.funcs {
+		value, err := ws.evalWindowFunc(state)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, value)
+	}
+	return ExecProject(ws.plan.TargetList, &ExprContext{ScanTuple: result, EState: ws.estate})
+}
+
+// beginPartition reads the next partition into the buffer, false when the input is exhausted
+func (ws *WindowAggState) beginPartition() (bool, error) {
+	if !ws.started {
+		ws.started = true
+		tuple, err := ws.child.Next()
+		if err != nil {
+			return false, err
+		}
+		ws.pending = tuple
+	}
+	if ws.buffer != nil {
+		ws.buffer.End()
+		ws.buffer = nil
+	}
+	if ws.pending == nil {
+		return false, nil
+	}
+
+	ws.buffer = NewRandomAccessTuplestore(ws.estate.workMem)
+	first := ws.pending
+	ws.pending = nil
+	if err := ws.buffer.PutTuple(first); err != nil {
+		return false, err
+	}
+	firstKey, err := evalSortKeys(ws.partKey, first, ws.estate)
+	if err != nil {
+		return false, err
+	}
+	for {
+		tuple, err := ws.child.Next()
+		if err != nil {
+			return false, err
+		}
+		if tuple == nil {
+			break
+		}
+		key, err := evalSortKeys(ws.partKey, tuple, ws.estate)
+		if err != nil {
+			return false, err
+		}
+		if cmp, err := compareSortKeys(ws.partKey, firstKey, key); err != nil || cmp != 0 {
+			ws.pending = tuple
+			if err != nil {
+				return false, err
+			}
+			break
+		}
+		if err := ws.buffer.PutTuple(tuple); err != nil {
+			return false, err
+		}
+	}
+
+	ws.peerTail, ws.headCursor, ws.tailCursor = nil, nil, nil
+	ws.fetcher = ws.buffer.NewReader()
+	for _, state := range ws.funcs {
+		state.trans = nil
+		state.reader = nil
+		state.hasBuckets = false
+	}
+	if ws.current, err = ws.newCursor(); err != nil {
+		return false, err
+	}
+	ws.groupHead = 0
+	return true, ws.evalFrameOffsets()
+}
+
+// The frame offsets are evaluated once per partition
+func (ws *WindowAggState) evalFrameOffsets() error {
+	options := ws.plan.FrameOptions
+	econtext := &ExprContext{EState: ws.estate}
+	var err error
+	if options&types.FRAMEOPTION_START_OFFSET != 0 {
+		if ws.startOffset, err = ExecEvalExpr(ws.plan.StartOffset, econtext); err != nil {
+			return err
+		}
+		if err := ws.checkFrameOffset(ws.startOffset, "starting"); err != nil {
+			return err
+		}
+	}
+	if options&types.FRAMEOPTION_END_OFFSET != 0 {
+		if ws.endOffset, err = ExecEvalExpr(ws.plan.EndOffset, econtext); err != nil {
+			return err
+		}
+		if err := ws.checkFrameOffset(ws.endOffset, "ending"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ws *WindowAggState) checkFrameOffset(offset types.Datum, which string) error {
+	if offset == nil {
+		return fmt.Errorf("frame %s offset must not be null", which)
+	}
+	value, _ := toFloat(offset)
+	if n, ok := offset.(adt.Numeric); ok {
+		value = n.Float64()
+	}
+	if value < 0 || math.IsNaN(value) {
+		if ws.plan.FrameOptions&types.FRAMEOPTION_RANGE != 0 {
+			return fmt.Errorf("invalid preceding or following size in window function")
+		}
+		return fmt.Errorf("frame %s offset must not be negative", which)
+	}
+	return nil
+}
+
+func (ws *WindowAggState) evalWindowFunc(state *windowFuncState) (types.Datum, error) {
+	if state.wfunc.WinAgg {
+		return ws.evalWindowAggregate(state)
+	}
+
+	cur := ws.current
+	n := ws.buffer.Count()
+	switch state.wfunc.WinName {
+	case "row_number":
+		return int64(cur.pos + 1), nil
+	case "rank":
+		return int64(ws.groupHead + 1), nil
+	case "dense_rank":
+		return int64(cur.group + 1), nil
+	case "percent_rank":
+		if n <= 1 {
+			return float64(0), nil
+		}
+		return float64(ws.groupHead) / float64(n-1), nil
+	case "cume_dist":
+		groupTail, err := ws.groupTail()
+		if err != nil {
+			return nil, err
+		}
+		return float64(groupTail) / float64(n), nil
+	case "ntile":
+		return ws.ntile(state)
+	case "lag", "lead":
+		return ws.lagLead(state)
+	}
+
+	//first_value, last_value and nth_value
+	if err := ws.updateFrame(); err != nil {
+		return nil, err
+	}
+	segments := ws.frameSegments()
+	var pos int
+	switch state.wfunc.WinName {
+	case "first_value":
+		if len(segments) == 0 {
+			return nil, nil
+		}
+		pos = segments[0].start
+	case "last_value":
+		if len(segments) == 0 {
+			return nil, nil
+		}
+		pos = segments[len(segments)-1].end - 1
+	default:
+		nth, err := ExecEvalExpr(state.wfunc.Args[1], ws.econtext(cur.tuple))
+		if err != nil || nth == nil {
+			return nil, err
+		}
+		if nth.(int64) <= 0 {
+			return nil, fmt.Errorf("argument of nth_value must be greater than zero")
+		}
+		skip := nth.(int64) - 1
+		pos = -1
+		for _, segment := range segments {
+			if skip < int64(segment.end-segment.start) {
+				pos = segment.start + int(skip)
+				break
+			}
+			skip -= int64(segment.end - segment.start)
+		}
+		if pos < 0 {
+			return nil, nil
+		}
+	}
+	return ws.valueAt(state.wfunc.Args[0], pos)
+}
+
+func (ws *WindowAggState) econtext(tuple types.Tuple) *ExprContext {
+	return &ExprContext{ScanTuple: tuple, EState: ws.estate}
+}
+
+// valueAt evaluates expr against row pos of the partition
+func (ws *WindowAggState) valueAt(expr types.Node, pos int) (types.Datum, error) {
+	ws.fetcher.Seek(pos)
+	tuple, err := ws.fetcher.Next()
+	if err != nil {
+		return nil, err
+	}
+	return ExecEvalExpr(expr, ws.econtext(tuple))
+}
+
+/*
+ntile(n) splits the partition into n buckets that differ in size by at most one row,
+the bigger buckets come first
+*/
+func (ws *WindowAggState) ntile(state *windowFuncState) (types.Datum, error) {
+	if !state.hasBuckets {
+		buckets, err := ExecEvalExpr(state.wfunc.Args[0], ws.econtext(ws.current.tuple))
+		if err != nil {
+			return nil, err
+		}
+		if buckets != nil && buckets.(int64) <= 0 {
+			return nil, fmt.Errorf("argument of ntile must be greater than zero")
+		}
+		state.buckets, state.hasBuckets = buckets, true
+	}
+	if state.buckets == nil {
+		return nil, nil
+	}
+	n, buckets := int64(ws.buffer.Count()), state.buckets.(int64)
+	perBucket, bigger := n/buckets, n%buckets
+	pos := int64(ws.current.pos)
+	if pos < bigger*(perBucket+1) {
+		return pos/(perBucket+1) + 1, nil
+	}
+	return bigger + (pos-bigger*(perBucket+1))/perBucket + 1, nil
+}
+
+// lag and lead read the row offset rows before or after the current one, default when there is none
+func (ws *WindowAggState) lagLead(state *windowFuncState) (types.Datum, error) {
+	args := state.wfunc.Args
+	econtext := ws.econtext(ws.current.tuple)
+	offset := int64(1)
+	if len(args) > 1 {
+		value, err := ExecEvalExpr(args[1], econtext)
+		if err != nil || value == nil {
+			return nil, err
+		}
+		offset = value.(int64)
+	}
+	if state.wfunc.WinName == "lag" {
+		offset = -offset
+	}
+
+	target := int64(ws.current.pos) + offset
+	if target < 0 || target >= int64(ws.buffer.Count()) {
+		if len(args) > 2 {
+			return ExecEvalExpr(args[2], econtext)
+		}
+		return nil, nil
+	}
+	return ws.valueAt(args[0], int(target))
+}
+
+// evalWindowAggregate computes an aggregate over the frame of the current row
+func (ws *WindowAggState) evalWindowAggregate(state *windowFuncState) (types.Datum, error) {
+	if err := ws.updateFrame(); err != nil {
+		return nil, err
+	}
+	head, tail := ws.frameHead, ws.frameTail
+	if state.reader == nil {
+		state.reader = ws.buffer.NewReader()
+	}
+
+	//With EXCLUDE the rows in the middle of the frame change, every row starts again
+	if ws.plan.FrameOptions&types.FRAMEOPTION_EXCLUSION != 0 {
+		trans, err := newAggTrans(state.aggref, ws.estate.settings)
+		if err != nil {
+			return nil, err
+		}
+		state.trans = trans
+		for _, segment := range ws.frameSegments() {
+			if err := ws.aggregateRows(state, segment.start, segment.end); err != nil {
+				return nil, err
+			}
+		}
+		result := state.trans.final()
+		state.trans = nil
+		return result, nil
+	}
+
+	if state.trans == nil || head != state.aggHead || tail < state.aggTail {
+		trans, err := newAggTrans(state.aggref, ws.estate.settings)
+		if err != nil {
+			return nil, err
+		}
+		state.trans = trans
+		state.aggHead, state.aggTail = head, head
+	}
+	if tail > state.aggTail {
+		if err := ws.aggregateRows(state, state.aggTail, tail); err != nil {
+			return nil, err
+		}
+		state.aggTail = tail
+	}
+	return state.trans.final(), nil
+}
+
+func (ws *WindowAggState) aggregateRows(state *windowFuncState, start int, end int) error {
+	state.reader.Seek(start)
+	for pos := start; pos < end; pos++ {
+		tuple, err := state.reader.Next()
+		if err != nil {
+			return err
+		}
+		if _, err := advanceAggregate(state.aggref, state.trans, ws.econtext(tuple)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// groupTail is the row after the last peer of the current row
+func (ws *WindowAggState) groupTail() (int, error) {
+	if ws.peerTail == nil {
+		var err error
+		if ws.peerTail, err = ws.newCursor(); err != nil {
+			return 0, err
+		}
+	}
+	if err := ws.peerTail.seekGroup(ws.current.group + 1); err != nil {
+		return 0, err
+	}
+	return ws.peerTail.pos, nil
+}
+
+// updateFrame finds [frameHead, frameTail) for the current row, before EXCLUDE
+func (ws *WindowAggState) updateFrame() error {
+	if ws.frameValid {
+		return nil
+	}
+	options := ws.plan.FrameOptions
+	cur := ws.current
+	n := ws.buffer.Count()
+	var err error
+
+	switch {
+	case options&types.FRAMEOPTION_START_UNBOUNDED_PRECEDING != 0:
+		ws.frameHead = 0
+	case options&types.FRAMEOPTION_START_CURRENT_ROW != 0:
+		ws.frameHead = ws.groupHead
+		if options&types.FRAMEOPTION_ROWS != 0 {
+			ws.frameHead = cur.pos
+		}
+	default:
+		preceding := options&types.FRAMEOPTION_START_OFFSET_PRECEDING != 0
+		switch {
+		case options&types.FRAMEOPTION_ROWS != 0:
+			ws.frameHead = offsetRow(cur.pos, ws.startOffset.(int64), preceding, n)
+		case options&types.FRAMEOPTION_GROUPS != 0:
+			if ws.headCursor == nil {
+				if ws.headCursor, err = ws.newCursor(); err != nil {
+					return err
+				}
+			}
+			if err := ws.headCursor.seekGroup(offsetRow(cur.group, ws.startOffset.(int64), preceding, math.MaxInt)); err != nil {
+				return err
+			}
+			ws.frameHead = ws.headCursor.pos
+		default:
+			if ws.frameHead, err = ws.rangeHead(preceding); err != nil {
+				return err
+			}
+		}
+	}
+
+	switch {
+	case options&types.FRAMEOPTION_END_UNBOUNDED_FOLLOWING != 0:
+		ws.frameTail = n
+	case options&types.FRAMEOPTION_END_CURRENT_ROW != 0:
+		if options&types.FRAMEOPTION_ROWS != 0 {
+			ws.frameTail = cur.pos + 1
+		} else if ws.frameTail, err = ws.groupTail(); err != nil {
+			return err
+		}
+	default:
+		preceding := options&types.FRAMEOPTION_END_OFFSET_PRECEDING != 0
+		switch {
+		case options&types.FRAMEOPTION_ROWS != 0:
+			//Row offset is the last row of the frame, so the row after it is one further
+			last := offsetRow(cur.pos, ws.endOffset.(int64), preceding, n)
+			if !preceding || int64(cur.pos) >= ws.endOffset.(int64) {
+				last = min(last+1, n)
+			}
+			ws.frameTail = last
+		case options&types.FRAMEOPTION_GROUPS != 0:
+			if preceding && int64(cur.group) < ws.endOffset.(int64) {
+				ws.frameTail = 0
+				break
+			}
+			if ws.tailCursor == nil {
+				if ws.tailCursor, err = ws.newCursor(); err != nil {
+					return err
+				}
+			}
+			lastGroup := offsetRow(cur.group, ws.endOffset.(int64), preceding, math.MaxInt-1)
+			if err := ws.tailCursor.seekGroup(lastGroup + 1); err != nil {
+				return err
+			}
+			ws.frameTail = ws.tailCursor.pos
+		default:
+			if ws.frameTail, err = ws.rangeTail(preceding); err != nil {
+				return err
+			}
+		}
+	}
+	ws.frameValid = true
+	return nil
+}
+
+// offsetRow is pos moved offset back (preceding) or forward, kept within [0, limit]
+func offsetRow(pos int, offset int64, preceding bool, limit int) int {
+	if preceding {
+		if int64(pos) < offset {
+			return 0
+		}
+		return pos - int(offset)
+	}
+	if offset > int64(limit-pos) {
+		return limit
+	}
+	return pos + int(offset)
+}
+
+/*
+RANGE offsets compare the order key of a row with the current row's value moved by the offset.
+A NULL current value only has its NULL peers in the frame, a non NULL one never has NULLs
+*/
+func (ws *WindowAggState) rangeHead(preceding bool) (int, error) {
+	cur := ws.current
+	value := cur.keys[0]
+	if value == nil {
+		return ws.groupHead, nil
+	}
+	orderKey := ws.plan.OrderKeys[0]
+	bound := rangeBound(value, ws.startOffset, preceding != orderKey.Desc)
+
+	if ws.headCursor == nil {
+		var err error
+		if ws.headCursor, err = ws.newCursor(); err != nil {
+			return 0, err
+		}
+	}
+	c := ws.headCursor
+	for c.pos < ws.buffer.Count() {
+		rowValue := c.keys[0]
+		if rowValue == nil {
+			if !orderKey.NullsFirst {
+				break
+			}
+		} else {
+			cmp, err := CompareDatums(rowValue, bound)
+			if err != nil {
+				return 0, err
+			}
+			if orderKey.Desc {
+				cmp = -cmp
+			}
+			if cmp >= 0 {
+				break
+			}
+		}
+		if err := c.advance(); err != nil {
+			return 0, err
+		}
+	}
+	return c.pos, nil
+}
+
+func (ws *WindowAggState) rangeTail(preceding bool) (int, error) {
+	cur := ws.current
+	value := cur.keys[0]
+	if value == nil {
+		return ws.groupTail()
+	}
+	orderKey := ws.plan.OrderKeys[0]
+	bound := rangeBound(value, ws.endOffset, preceding != orderKey.Desc)
+
+	if ws.tailCursor == nil {
+		var err error
+		if ws.tailCursor, err = ws.newCursor(); err != nil {
+			return 0, err
+		}
+	}
+	c := ws.tailCursor
+	for c.pos < ws.buffer.Count() {
+		rowValue := c.keys[0]
+		if rowValue == nil {
+			if !orderKey.NullsFirst {
+				break
+			}
+		} else {
+			cmp, err := CompareDatums(rowValue, bound)
+			if err != nil {
+				return 0, err
+			}
+			if orderKey.Desc {
+				cmp = -cmp
+			}
+			if cmp > 0 {
+				break
+			}
+		}
+		if err := c.advance(); err != nil {
+			return 0, err
+		}
+	}
+	return c.pos, nil
+}
+
+// rangeBound is value minus or plus offset, an integer bound that overflows becomes an infinite one
+func rangeBound(value types.Datum, offset types.Datum, subtract bool) types.Datum {
+	if v, ok := value.(adt.Numeric); ok {
+		o := offset.(adt.Numeric)
+		if subtract {
+			o = o.Neg()
+		}
+		bound, err := v.Add(o)
+		if err != nil {
+			//Too far out for the numeric format, nothing is beyond it
+			return adt.NumericFromFloat64(math.Inf(o.Sign()))
+		}
+		return bound
+	}
+	if v, ok := value.(int64); ok {
+		if o, ok := offset.(int64); ok {
+			switch {
+			case subtract && v < math.MinInt64+o:
+				return math.Inf(-1)
+			case subtract:
+				return v - o
+			case v > math.MaxInt64-o:
+				return math.Inf(1)
+			}
+			return v + o
+		}
+	}
+	v, _ := toFloat(value)
+	o, _ := toFloat(offset)
+	if subtract {
+		return v - o
+	}
+	return v + o
+}
+
+type frameSegment struct {
+	start int
+	end   int
+}
+
+// frameSegments are the parts of the frame EXCLUDE leaves, in order
+func (ws *WindowAggState) frameSegments() []frameSegment {
+	head, tail := ws.frameHead, ws.frameTail
+	if head >= tail {
+		return nil
+	}
+	options := ws.plan.FrameOptions
+	if options&types.FRAMEOPTION_EXCLUSION == 0 {
+		return []frameSegment{{head, tail}}
+	}
+
+	pos := ws.current.pos
+	var excluded []frameSegment
+	switch {
+	case options&types.FRAMEOPTION_EXCLUDE_CURRENT_ROW != 0:
+		excluded = []frameSegment{{pos, pos + 1}}
+	default:
+		//The frame was computed before, so the peer group end is known already
+		groupTail, _ := ws.groupTail()
+		if options&types.FRAMEOPTION_EXCLUDE_GROUP != 0 {
+			excluded = []frameSegment{{ws.groupHead, groupTail}}
+		} else {
+			excluded = []frameSegment{{ws.groupHead, pos}, {pos + 1, groupTail}}
+		}
+	}
+
+	var segments []frameSegment
+	start := head
+	for _, ex := range excluded {
+		if ex.start >= ex.end || ex.end <= start {
+			continue
+		}
+		if ex.start > start {
+			segments = append(segments, frameSegment{start, min(ex.start, tail)})
+		}
+		start = max(start, ex.end)
+	}
+	if start < tail {
+		segments = append(segments, frameSegment{start, tail})
+	}
+	return segments
+}
+
+/*
+windowCursor walks forward over the rows of the partition, knowing the peer group of the row it is on
+*/
+type windowCursor struct {
+	ws       *WindowAggState
+	reader   *TuplestoreReader
+	pos      int //The partition's row count once past the last row
+	tuple    types.Tuple
+	keys     []types.Datum //Order key values of the row
+	group    int           //Peer group of the row, counted from 0
+	newGroup bool          //The last advance started a new peer group
+}
+
+// newCursor returns a cursor on the first row of the partition
+func (ws *WindowAggState) newCursor() (*windowCursor, error) {
+	c := &windowCursor{ws: ws, reader: ws.buffer.NewReader(), pos: -1, group: -1}
+	return c, c.advance()
+}
+
+func (c *windowCursor) advance() error {
+	count := c.ws.buffer.Count()
+	if c.pos >= count {
+		return nil
+	}
+	c.pos++
+	if c.pos == count {
+		c.tuple, c.keys, c.newGroup = nil, nil, false
+		return nil
+	}
+	tuple, err := c.reader.Next()
+	if err != nil {
+		return err
+	}
+	keys, err := evalSortKeys(c.ws.plan.OrderKeys, tuple, c.ws.estate)
+	if err != nil {
+		return err
+	}
+	c.newGroup = c.group < 0
+	if !c.newGroup {
+		cmp, err := compareSortKeys(c.ws.plan.OrderKeys, c.keys, keys)
+		if err != nil {
+			return err
+		}
+		c.newGroup = cmp != 0
+	}
+	if c.newGroup {
+		c.group++
+	}
+	c.tuple, c.keys = tuple, keys
+	return nil
+}
+
+// seekGroup moves forward to the first row of peer group group, or past the last row
+func (c *windowCursor) seekGroup(group int) error {
+	for c.pos < c.ws.buffer.Count() && c.group < group {
+		if err := c.advance(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ws *WindowAggState) Close() error {
+	if ws.buffer != nil {
+		ws.buffer.End()
+		ws.buffer = nil
+	}
+	return ws.child.Close()
+}
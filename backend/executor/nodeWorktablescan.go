@@ -0,0 +1,44 @@
+package executor
+
+import (
+	"fmt"
+
+	"github.com/rautNishan/diskquery/types"
+)
+
+// WorkTableScanState reads the rows the previous round of a recursive query produced
+type WorkTableScanState struct {
+	plan   *types.WorkTableScan
+	estate *EState
+	reader *TuplestoreReader
+}
+
+func ExecInitWorkTableScan(node *types.WorkTableScan, estate *EState) (*WorkTableScanState, error) {
+	//The RecursiveUnion puts the work table there before it starts a round
+	store, ok := estate.workTables[node.WtParam]
+	if !ok {
+		return nil, fmt.Errorf("work table of recursive query is not available")
+	}
+	return &WorkTableScanState{plan: node, estate: estate, reader: store.NewReader()}, nil
+}
+
+func (ws *WorkTableScanState) Next() (types.Tuple, error) {
+	for {
+		tuple, err := ws.reader.Next()
+		if err != nil || tuple == nil {
+			return nil, err
+		}
+		econtext := &ExprContext{ScanTuple: tuple, EState: ws.estate}
+		ok, err := ExecQual(ws.plan.Qual, econtext)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return ExecProject(ws.plan.TargetList, econtext)
+		}
+	}
+}
+
+func (ws *WorkTableScanState) Close() error {
+	return nil
+}
@@ -0,0 +1,309 @@
+package executor
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+
+	"github.com/rautNishan/diskquery/adt"
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+Temporary files for tuples that do not fit in work_mem (hash agg spills, sort runs, tuplestores)
+Tuples are written sequentially and read back in the same order
+
+On disk a tuple is: number of columns (uvarint), a null bitmap with a bit per column that is set when the
+column is not NULL (like the t_bits of a postgres heap tuple), then each non NULL datum as a tag byte and
+its payload. Array elements have no bitmap, a NULL element is a datumNull tag
+*/
+
+const (
+	datumNull byte = iota
+	datumInt8
+	datumFloat8
+	datumText
+	datumBool
+	datumArray
+	datumNumeric
+	datumDate
+	datumTimestamp
+	datumBytea
+	datumTime
+	datumTimestampTz
+	datumInterval
+	datumJson
+	datumJsonb
+	datumJsonPath
+	datumUUID
+)
+
+type TupleFile struct {
+	file   *os.File
+	writer *bufio.Writer
+	reader *bufio.Reader
+	count  int64
+	size   int64 //Bytes written so far
+}
+
+func NewTupleFile(prefix string) (*TupleFile, error) {
+	file, err := os.CreateTemp("", "diskquery_"+prefix+"_*")
+	if err != nil {
+		return nil, fmt.Errorf("could not create temporary file: %v", err)
+	}
+	return &TupleFile{file: file, writer: bufio.NewWriter(file)}, nil
+}
+
+func (tf *TupleFile) WriteTuple(tuple types.Tuple) error {
+	buf, err := encodeTuple(nil, tuple)
+	if err != nil {
+		return err
+	}
+	var lenBuf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(lenBuf[:], uint64(len(buf)))
+	if _, err := tf.writer.Write(lenBuf[:n]); err != nil {
+		return err
+	}
+	if _, err := tf.writer.Write(buf); err != nil {
+		return err
+	}
+	tf.count++
+	tf.size += int64(n + len(buf))
+	return nil
+}
+
+// Rewind flushes what was written and positions the file for reading from the start
+func (tf *TupleFile) Rewind() error {
+	if err := tf.writer.Flush(); err != nil {
+		return err
+	}
+	if _, err := tf.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	tf.reader = bufio.NewReader(tf.file)
+	return nil
+}
+
+// ReadTuple returns the next tuple, nil once the file is exhausted
+func (tf *TupleFile) ReadTuple() (types.Tuple, error) {
+	tuple, _, err := readTuple(tf.reader)
+	return tuple, err
+}
+
+/*
+ReaderAt returns a reader of the tuples from byte offset on, up to what was written so far
+It reads independently of ReadTuple and of other readers, and writing can go on while it is used
+*/
+func (tf *TupleFile) ReaderAt(offset int64) (*bufio.Reader, error) {
+	if tf.writer.Buffered() > 0 {
+		if err := tf.writer.Flush(); err != nil {
+			return nil, err
+		}
+	}
+	return bufio.NewReader(io.NewSectionReader(tf.file, offset, tf.size-offset)), nil
+}
+
+// readTuple reads one tuple and tells how many bytes it took, nil at the end of the input
+func readTuple(reader *bufio.Reader) (types.Tuple, int, error) {
+	length, err := binary.ReadUvarint(reader)
+	if err == io.EOF {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(reader, buf); err != nil {
+		return nil, 0, err
+	}
+	tuple, _, err := decodeTuple(buf)
+	var lenBuf [binary.MaxVarintLen64]byte
+	return tuple, binary.PutUvarint(lenBuf[:], length) + int(length), err
+}
+
+func (tf *TupleFile) Count() int64 {
+	return tf.count
+}
+
+// Close removes the file, temporary files never outlive the query
+func (tf *TupleFile) Close() error {
+	name := tf.file.Name()
+	tf.file.Close()
+	return os.Remove(name)
+}
+
+func encodeTuple(buf []byte, tuple types.Tuple) ([]byte, error) {
+	buf = binary.AppendUvarint(buf, uint64(len(tuple)))
+	bitmapStart := len(buf)
+	buf = append(buf, make([]byte, (len(tuple)+7)/8)...)
+	for i, d := range tuple {
+		if d == nil {
+			continue
+		}
+		buf[bitmapStart+i/8] |= 1 << (i % 8)
+		var err error
+		if buf, err = encodeDatum(buf, d); err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+func encodeDatum(buf []byte, d types.Datum) ([]byte, error) {
+	switch v := d.(type) {
+	case nil:
+		return append(buf, datumNull), nil
+	case int64:
+		buf = append(buf, datumInt8)
+		return binary.BigEndian.AppendUint64(buf, uint64(v)), nil
+	case float64:
+		buf = append(buf, datumFloat8)
+		return binary.BigEndian.AppendUint64(buf, math.Float64bits(v)), nil
+	case string:
+		buf = append(buf, datumText)
+		buf = binary.AppendUvarint(buf, uint64(len(v)))
+		return append(buf, v...), nil
+	case bool:
+		if v {
+			return append(buf, datumBool, 1), nil
+		}
+		return append(buf, datumBool, 0), nil
+	case []types.Datum:
+		buf = append(buf, datumArray)
+		return encodeTuple(buf, v)
+	case adt.Numeric:
+		//The text form keeps the display scale
+		text := v.String()
+		buf = append(buf, datumNumeric)
+		buf = binary.AppendUvarint(buf, uint64(len(text)))
+		return append(buf, text...), nil
+	case adt.Date:
+		buf = append(buf, datumDate)
+		return binary.BigEndian.AppendUint32(buf, uint32(v)), nil
+	case adt.Timestamp:
+		buf = append(buf, datumTimestamp)
+		return binary.BigEndian.AppendUint64(buf, uint64(v)), nil
+	case adt.TimeOfDay:
+		buf = append(buf, datumTime)
+		return binary.BigEndian.AppendUint64(buf, uint64(v)), nil
+	case adt.TimestampTz:
+		buf = append(buf, datumTimestampTz)
+		return binary.BigEndian.AppendUint64(buf, uint64(v)), nil
+	case adt.Interval:
+		buf = append(buf, datumInterval)
+		buf = binary.BigEndian.AppendUint64(buf, uint64(v.Time))
+		buf = binary.BigEndian.AppendUint32(buf, uint32(v.Day))
+		return binary.BigEndian.AppendUint32(buf, uint32(v.Month)), nil
+	case []byte:
+		buf = append(buf, datumBytea)
+		buf = binary.AppendUvarint(buf, uint64(len(v)))
+		return append(buf, v...), nil
+	case adt.Json:
+		buf = append(buf, datumJson)
+		buf = binary.AppendUvarint(buf, uint64(len(v)))
+		return append(buf, v...), nil
+	case *adt.Jsonb:
+		buf = append(buf, datumJsonb)
+		return adt.EncodeJsonb(buf, v), nil
+	case *adt.JsonPath:
+		//Paths are written as text and parsed again
+		text := adt.OutputDatum(v, &adt.DefaultSettings)
+		buf = append(buf, datumJsonPath)
+		buf = binary.AppendUvarint(buf, uint64(len(text)))
+		return append(buf, text...), nil
+	case adt.UUID:
+		buf = append(buf, datumUUID)
+		return append(buf, v[:]...), nil
+	}
+	return nil, fmt.Errorf("cannot write a value of type %T to a temporary file", d)
+}
+
+func decodeTuple(buf []byte) (types.Tuple, []byte, error) {
+	ncols, n := binary.Uvarint(buf)
+	if n <= 0 {
+		return nil, nil, fmt.Errorf("corrupted tuple in temporary file")
+	}
+	buf = buf[n:]
+	bitmapLen := (int(ncols) + 7) / 8
+	if len(buf) < bitmapLen {
+		return nil, nil, fmt.Errorf("corrupted tuple in temporary file")
+	}
+	bitmap, buf := buf[:bitmapLen], buf[bitmapLen:]
+	tuple := make(types.Tuple, ncols)
+	for i := range tuple {
+		if bitmap[i/8]&(1<<(i%8)) == 0 {
+			continue
+		}
+		var err error
+		tuple[i], buf, err = decodeDatum(buf)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return tuple, buf, nil
+}
+
+func decodeDatum(buf []byte) (types.Datum, []byte, error) {
+	if len(buf) == 0 {
+		return nil, nil, fmt.Errorf("corrupted tuple in temporary file")
+	}
+	tag, buf := buf[0], buf[1:]
+	switch tag {
+	case datumNull:
+		return nil, buf, nil
+	case datumInt8:
+		return int64(binary.BigEndian.Uint64(buf)), buf[8:], nil
+	case datumFloat8:
+		return math.Float64frombits(binary.BigEndian.Uint64(buf)), buf[8:], nil
+	case datumText:
+		length, n := binary.Uvarint(buf)
+		buf = buf[n:]
+		return string(buf[:length]), buf[length:], nil
+	case datumBool:
+		return buf[0] == 1, buf[1:], nil
+	case datumArray:
+		elems, rest, err := decodeTuple(buf)
+		return []types.Datum(elems), rest, err
+	case datumNumeric:
+		length, n := binary.Uvarint(buf)
+		buf = buf[n:]
+		value, err := adt.ParseNumeric(string(buf[:length]))
+		return value, buf[length:], err
+	case datumDate:
+		return adt.Date(int32(binary.BigEndian.Uint32(buf))), buf[4:], nil
+	case datumTimestamp:
+		return adt.Timestamp(int64(binary.BigEndian.Uint64(buf))), buf[8:], nil
+	case datumTime:
+		return adt.TimeOfDay(int64(binary.BigEndian.Uint64(buf))), buf[8:], nil
+	case datumTimestampTz:
+		return adt.TimestampTz(int64(binary.BigEndian.Uint64(buf))), buf[8:], nil
+	case datumInterval:
+		return adt.Interval{
+			Time:  int64(binary.BigEndian.Uint64(buf)),
+			Day:   int32(binary.BigEndian.Uint32(buf[8:])),
+			Month: int32(binary.BigEndian.Uint32(buf[12:])),
+		}, buf[16:], nil
+	case datumBytea:
+		length, n := binary.Uvarint(buf)
+		buf = buf[n:]
+		return bytes.Clone(buf[:length]), buf[length:], nil
+	case datumJson:
+		length, n := binary.Uvarint(buf)
+		buf = buf[n:]
+		return adt.Json(buf[:length]), buf[length:], nil
+	case datumJsonb:
+		return adt.DecodeJsonb(buf)
+	case datumJsonPath:
+		length, n := binary.Uvarint(buf)
+		buf = buf[n:]
+		value, err := adt.InputDatum(types.JSONPATHOID, string(buf[:length]), &adt.DefaultSettings)
+		return value, buf[length:], err
+	case datumUUID:
+		return adt.UUID(buf[:16]), buf[16:], nil
+	}
+	return nil, nil, fmt.Errorf("corrupted tuple in temporary file: unknown datum tag %d", tag)
+}
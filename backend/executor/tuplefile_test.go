@@ -0,0 +1,56 @@
+package executor
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/rautNishan/diskquery/adt"
+	"github.com/rautNishan/diskquery/types"
+)
+
+func TestTupleFileRoundTrip(t *testing.T) {
+	file, err := NewTupleFile("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	numeric, _ := adt.ParseNumeric("12.50")
+	tuples := []types.Tuple{
+		{int64(-1), 2.5, "a,b", true, nil},
+		{[]types.Datum{int64(1), nil}, numeric, adt.Date(-3), adt.Interval{Time: 1, Day: 2, Month: 3}, []byte{0, 1}},
+		{},
+	}
+	for _, tuple := range tuples {
+		if err := file.WriteTuple(tuple); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := file.Rewind(); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range tuples {
+		got, err := file.ReadTuple()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	}
+	if got, err := file.ReadTuple(); got != nil || err != nil {
+		t.Errorf("got %v, %v after the last tuple", got, err)
+	}
+}
+
+func TestTupleFileUnknownType(t *testing.T) {
+	file, err := NewTupleFile("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	err = file.WriteTuple(types.Tuple{int64(1), struct{}{}})
+	if err == nil || !strings.Contains(err.Error(), "cannot write a value of type struct {}") {
+		t.Errorf("got %v", err)
+	}
+}
@@ -0,0 +1,324 @@
+package executor
+
+import (
+	"container/heap"
+	"sort"
+
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+Tuplesort, modeled after postgres utils/sort/tuplesort.c
+
+Tuples are collected in memory until they exceed work_mem, then the in memory tuples are sorted
+and written out as a sorted run to a temporary file. Once the input ends the runs are merged
+with a k-way merge (a heap holding the current head of every run).
+If there are more runs than MAX_MERGE_ORDER they are first merged in groups into longer runs,
+so we never hold too many files open at once.
+
+With a bound (ORDER BY ... LIMIT n) only the n smallest tuples matter, we keep them in a
+max-heap and throw away anything larger than its top, so a top-N query never touches the disk
+as long as n tuples fit in work_mem.
+*/
+
+const MAX_MERGE_ORDER = 64
+
+type sortTuple struct {
+	keys  []types.Datum
+	tuple types.Tuple
+}
+
+type Tuplesort struct {
+	sortKeys []types.SortKey
+	estate   *EState
+	budget   int
+	bound    int
+	bounded  bool
+
+	memtuples []sortTuple
+	memUsed   int
+	runs      []*TupleFile
+	err       error //First comparison error, sort callbacks cannot return one
+
+	//Output state
+	pos    int
+	merger *runMerger
+}
+
+func NewTuplesort(sortKeys []types.SortKey, workMem int, estate *EState) *Tuplesort {
+	return &Tuplesort{sortKeys: sortKeys, estate: estate, budget: workMem * 1024}
+}
+
+// SetBound tells the sort only the first bound tuples will be fetched
+func (ts *Tuplesort) SetBound(bound int) {
+	if bound > 0 {
+		ts.bound = bound
+		ts.bounded = true
+	}
+}
+
+func (ts *Tuplesort) compare(a *sortTuple, b *sortTuple) int {
+	cmp, err := compareSortKeys(ts.sortKeys, a.keys, b.keys)
+	if err != nil && ts.err == nil {
+		ts.err = err
+	}
+	return cmp
+}
+
+func (ts *Tuplesort) PutTuple(tuple types.Tuple) error {
+	keys, err := evalSortKeys(ts.sortKeys, tuple, ts.estate)
+	if err != nil {
+		return err
+	}
+	item := sortTuple{keys: keys, tuple: tuple}
+	size := tupleSize(keys) + tupleSize(tuple)
+
+	if ts.bounded {
+		return ts.putBounded(item, size)
+	}
+
+	ts.memtuples = append(ts.memtuples, item)
+	ts.memUsed += size
+	if ts.memUsed >= ts.budget {
+		return ts.dumpRun()
+	}
+	return nil
+}
+
+// putBounded keeps the bound smallest tuples, memtuples is a max-heap while bounded
+func (ts *Tuplesort) putBounded(item sortTuple, size int) error {
+	h := &boundedHeap{ts: ts}
+	if len(ts.memtuples) < ts.bound {
+		heap.Push(h, item)
+		ts.memUsed += size
+	} else if ts.compare(&item, &ts.memtuples[0]) < 0 {
+		ts.memUsed += size - tupleSize(ts.memtuples[0].keys) - tupleSize(ts.memtuples[0].tuple)
+		ts.memtuples[0] = item
+		heap.Fix(h, 0)
+	}
+	if ts.err != nil {
+		return ts.err
+	}
+
+	//The bound is too large to keep in memory, forget about it and do a normal external sort
+	if ts.memUsed >= ts.budget {
+		ts.bounded = false
+		return ts.dumpRun()
+	}
+	return nil
+}
+
+func (ts *Tuplesort) sortMemtuples() error {
+	sort.SliceStable(ts.memtuples, func(i, j int) bool {
+		return ts.compare(&ts.memtuples[i], &ts.memtuples[j]) < 0
+	})
+	return ts.err
+}
+
+// dumpRun sorts what is in memory and writes it out as a new run
+func (ts *Tuplesort) dumpRun() error {
+	if err := ts.sortMemtuples(); err != nil {
+		return err
+	}
+	run, err := NewTupleFile("sort")
+	if err != nil {
+		return err
+	}
+	ts.runs = append(ts.runs, run)
+	for i := range ts.memtuples {
+		if err := run.WriteTuple(packSortTuple(&ts.memtuples[i])); err != nil {
+			return err
+		}
+	}
+	ts.memtuples = nil
+	ts.memUsed = 0
+	return run.Rewind()
+}
+
+// On disk the sort keys are stored in front of the tuple, so merging does not recompute them
+func packSortTuple(item *sortTuple) types.Tuple {
+	packed := make(types.Tuple, 0, len(item.keys)+len(item.tuple))
+	packed = append(packed, item.keys...)
+	return append(packed, item.tuple...)
+}
+
+func (ts *Tuplesort) unpackSortTuple(packed types.Tuple) sortTuple {
+	nkeys := len(ts.sortKeys)
+	return sortTuple{keys: packed[:nkeys], tuple: packed[nkeys:]}
+}
+
+// PerformSort is called once all tuples are in
+func (ts *Tuplesort) PerformSort() error {
+	//Everything fit in memory, for a bounded sort the heap is turned into sorted order here
+	if len(ts.runs) == 0 {
+		return ts.sortMemtuples()
+	}
+
+	if len(ts.memtuples) > 0 {
+		if err := ts.dumpRun(); err != nil {
+			return err
+		}
+	}
+
+	//Merge passes until the remaining runs can be merged in one go
+	for len(ts.runs) > MAX_MERGE_ORDER {
+		var merged []*TupleFile
+		for start := 0; start < len(ts.runs); start += MAX_MERGE_ORDER {
+			end := min(start+MAX_MERGE_ORDER, len(ts.runs))
+			run, err := ts.mergeRuns(ts.runs[start:end])
+			if err != nil {
+				return err
+			}
+			merged = append(merged, run)
+		}
+		ts.runs = merged
+	}
+
+	merger, err := newRunMerger(ts, ts.runs)
+	if err != nil {
+		return err
+	}
+	ts.merger = merger
+	return nil
+}
+
+// mergeRuns merges a group of runs into a single new run, the input runs are removed
+func (ts *Tuplesort) mergeRuns(runs []*TupleFile) (*TupleFile, error) {
+	merger, err := newRunMerger(ts, runs)
+	if err != nil {
+		return nil, err
+	}
+	output, err := NewTupleFile("sort")
+	if err != nil {
+		return nil, err
+	}
+	for {
+		item, err := merger.next()
+		if err != nil {
+			output.Close()
+			return nil, err
+		}
+		if item == nil {
+			break
+		}
+		if err := output.WriteTuple(packSortTuple(item)); err != nil {
+			output.Close()
+			return nil, err
+		}
+	}
+	for _, run := range runs {
+		run.Close()
+	}
+	return output, output.Rewind()
+}
+
+// GetTuple returns tuples in sorted order, nil when there are no more
+func (ts *Tuplesort) GetTuple() (types.Tuple, error) {
+	if ts.merger != nil {
+		item, err := ts.merger.next()
+		if err != nil || item == nil {
+			return nil, err
+		}
+		return item.tuple, nil
+	}
+	if ts.pos >= len(ts.memtuples) {
+		return nil, nil
+	}
+	tuple := ts.memtuples[ts.pos].tuple
+	ts.memtuples[ts.pos] = sortTuple{}
+	ts.pos++
+	return tuple, nil
+}
+
+// End releases the temporary files
+func (ts *Tuplesort) End() {
+	for _, run := range ts.runs {
+		run.Close()
+	}
+	ts.runs = nil
+	ts.memtuples = nil
+}
+
+// boundedHeap orders memtuples with the largest tuple on top
+type boundedHeap struct {
+	ts *Tuplesort
+}
+
+func (h *boundedHeap) Len() int { return len(h.ts.memtuples) }
+func (h *boundedHeap) Less(i, j int) bool {
+	return h.ts.compare(&h.ts.memtuples[i], &h.ts.memtuples[j]) > 0
+}
+func (h *boundedHeap) Swap(i, j int) {
+	h.ts.memtuples[i], h.ts.memtuples[j] = h.ts.memtuples[j], h.ts.memtuples[i]
+}
+func (h *boundedHeap) Push(x any) { h.ts.memtuples = append(h.ts.memtuples, x.(sortTuple)) }
+func (h *boundedHeap) Pop() any {
+	last := h.ts.memtuples[len(h.ts.memtuples)-1]
+	h.ts.memtuples = h.ts.memtuples[:len(h.ts.memtuples)-1]
+	return last
+}
+
+/*
+runMerger is the k-way merge, a min-heap with the current head tuple of every run
+Ties go to the earlier run, which keeps the sort stable
+*/
+type runMerger struct {
+	ts    *Tuplesort
+	runs  []*TupleFile
+	heads []mergeHead
+}
+
+type mergeHead struct {
+	item sortTuple
+	run  int
+}
+
+func newRunMerger(ts *Tuplesort, runs []*TupleFile) (*runMerger, error) {
+	m := &runMerger{ts: ts, runs: runs}
+	for i := range runs {
+		if err := m.pushNext(i); err != nil {
+			return nil, err
+		}
+	}
+	heap.Init(m)
+	return m, ts.err
+}
+
+func (m *runMerger) pushNext(run int) error {
+	packed, err := m.runs[run].ReadTuple()
+	if err != nil || packed == nil {
+		return err
+	}
+	heap.Push(m, mergeHead{item: m.ts.unpackSortTuple(packed), run: run})
+	return nil
+}
+
+func (m *runMerger) next() (*sortTuple, error) {
+	if len(m.heads) == 0 {
+		return nil, nil
+	}
+	head := heap.Pop(m).(mergeHead)
+	if err := m.pushNext(head.run); err != nil {
+		return nil, err
+	}
+	if m.ts.err != nil {
+		return nil, m.ts.err
+	}
+	return &head.item, nil
+}
+
+func (m *runMerger) Len() int { return len(m.heads) }
+func (m *runMerger) Less(i, j int) bool {
+	cmp := m.ts.compare(&m.heads[i].item, &m.heads[j].item)
+	if cmp == 0 {
+		return m.heads[i].run < m.heads[j].run
+	}
+	return cmp < 0
+}
+func (m *runMerger) Swap(i, j int) { m.heads[i], m.heads[j] = m.heads[j], m.heads[i] }
+func (m *runMerger) Push(x any)    { m.heads = append(m.heads, x.(mergeHead)) }
+func (m *runMerger) Pop() any {
+	last := m.heads[len(m.heads)-1]
+	m.heads = m.heads[:len(m.heads)-1]
+	return last
+}
@@ -0,0 +1,150 @@
+package executor
+
+import (
+	"bufio"
+
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+Tuplestore keeps tuples to be read back later, by any number of readers (postgres utils/sort/tuplestore.c)
+Tuples stay in memory until they exceed work_mem, then all of them move to a temporary file.
+Every reader has its own position, and tuples can still be added while readers are reading.
+A random access store also remembers where every tuple is in the file, so its readers can seek
+*/
+type Tuplestore struct {
+	budget       int
+	memtuples    []types.Tuple
+	memUsed      int
+	file         *TupleFile //Holds all the tuples once we spilled
+	count        int
+	randomAccess bool
+	offsets      []int64 //File offset of every tuple, random access only
+}
+
+func NewTuplestore(workMem int) *Tuplestore {
+	return &Tuplestore{budget: workMem * 1024}
+}
+
+func NewRandomAccessTuplestore(workMem int) *Tuplestore {
+	return &Tuplestore{budget: workMem * 1024, randomAccess: true}
+}
+
+func (ts *Tuplestore) PutTuple(tuple types.Tuple) error {
+	ts.count++
+	if ts.file != nil {
+		return ts.writeTuple(tuple)
+	}
+	ts.memtuples = append(ts.memtuples, tuple)
+	ts.memUsed += tupleSize(tuple)
+	if ts.memUsed < ts.budget {
+		return nil
+	}
+
+	file, err := NewTupleFile("store")
+	if err != nil {
+		return err
+	}
+	ts.file = file
+	for _, memtuple := range ts.memtuples {
+		if err := ts.writeTuple(memtuple); err != nil {
+			return err
+		}
+	}
+	ts.memtuples = nil
+	ts.memUsed = 0
+	return nil
+}
+
+func (ts *Tuplestore) writeTuple(tuple types.Tuple) error {
+	if ts.randomAccess {
+		ts.offsets = append(ts.offsets, ts.file.size)
+	}
+	return ts.file.WriteTuple(tuple)
+}
+
+func (ts *Tuplestore) Count() int {
+	return ts.count
+}
+
+// End releases the temporary file
+func (ts *Tuplestore) End() {
+	if ts.file != nil {
+		ts.file.Close()
+		ts.file = nil
+	}
+	ts.memtuples = nil
+	ts.offsets = nil
+}
+
+type TuplestoreReader struct {
+	store  *Tuplestore
+	pos    int //Tuples read so far
+	inFile bool
+	offset int64
+	reader *bufio.Reader //Reads the file from offset, up to what was in the file when it was made
+	limit  int           //Tuples the reader can see
+}
+
+func (ts *Tuplestore) NewReader() *TuplestoreReader {
+	return &TuplestoreReader{store: ts}
+}
+
+// Next returns the next tuple, nil when the reader has seen every tuple stored so far
+func (r *TuplestoreReader) Next() (types.Tuple, error) {
+	ts := r.store
+	if r.pos >= ts.count {
+		return nil, nil
+	}
+	if ts.file == nil {
+		tuple := ts.memtuples[r.pos]
+		r.pos++
+		return tuple, nil
+	}
+
+	//New tuples were written since the reader was made, or the store spilled while we were reading memory
+	if r.reader == nil || r.pos >= r.limit {
+		reader, err := ts.file.ReaderAt(r.offset)
+		if err != nil {
+			return nil, err
+		}
+		r.reader, r.limit = reader, ts.count
+		//The store spilled after we read some tuples from memory, skip them in the file
+		if !r.inFile {
+			r.inFile = true
+			for i := 0; i < r.pos; i++ {
+				_, n, err := readTuple(r.reader)
+				if err != nil {
+					return nil, err
+				}
+				r.offset += int64(n)
+			}
+		}
+	}
+	tuple, n, err := readTuple(r.reader)
+	if err != nil {
+		return nil, err
+	}
+	r.pos++
+	r.offset += int64(n)
+	return tuple, nil
+}
+
+// Seek moves the reader to tuple pos (counted from 0), only for random access stores
+func (r *TuplestoreReader) Seek(pos int) {
+	if pos == r.pos {
+		return
+	}
+	r.pos = pos
+	ts := r.store
+	if ts.file == nil {
+		return
+	}
+	r.inFile = true
+	r.reader = nil
+	if pos < len(ts.offsets) {
+		r.offset = ts.offsets[pos]
+	} else {
+		r.offset = ts.file.size
+	}
+}
@@ -0,0 +1,456 @@
+package guc
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rautNishan/diskquery/access"
+	"github.com/rautNishan/diskquery/adt"
+)
+
+/*
+Grand Unified Configuration, the settings SET / SHOW / RESET work on (postgres utils/misc/guc.c)
+
+Most settings belong to a session (PGC_USERSET in postgres): every connection has a Session, SET changes it
+and nothing else, and the planner and executor read the Session of the connection running the statement.
+A few belong to the whole server (PGC_SIGHUP), they are kept once here and only ALTER SYSTEM changes them.
+
+ALTER SYSTEM SET on a session setting changes the value new sessions start with and RESET goes back to,
+sessions already running keep what they have. Unlike postgres it is not written to postgresql.auto.conf,
+a restart forgets it
+*/
+
+// Session is the settings of one connection
+type Session struct {
+	EnableHashAgg            bool
+	EnableIndexScan          bool
+	EnableColumnarScan       bool
+	WorkMem                  int //kB a single sort or hash table may use before it spills to disk
+	DefaultTableAccessMethod string
+	Settings                 adt.Settings //What the input, output and cast functions of the types follow
+
+	timeZone      string //Name SHOW prints
+	intervalStyle string
+}
+
+// The server wide settings and what ALTER SYSTEM made of the session ones
+var system struct {
+	sync.Mutex
+	defaults            Session
+	autovacuum          bool
+	autovacuumNaptime   int //Seconds
+	autovacuumVacThresh int
+	autovacuumVacScale  float64
+}
+
+type configBool struct {
+	variable  func(s *Session) *bool
+	bootValue bool
+	sighup    bool //Server wide, variable ignores its session
+	shortDesc string
+}
+
+type configInt struct {
+	variable  func(s *Session) *int
+	bootValue int
+	min       int
+	max       int
+	unit      string //"kB" for memory settings, "s" for times, empty otherwise
+	sighup    bool
+	shortDesc string
+}
+
+type configReal struct {
+	variable  func(s *Session) *float64
+	bootValue float64
+	min       float64
+	max       float64
+	sighup    bool
+	shortDesc string
+}
+
+/*
+A string setting keeps the text SHOW prints, assign checks a new value, applies it to the session and
+returns the canonical spelling (postgres' check and assign hooks in one)
+*/
+type configString struct {
+	variable  func(s *Session) *string
+	bootValue string
+	assign    func(s *Session, value string) (string, error)
+	shortDesc string
+}
+
+var boolOptions = map[string]*configBool{
+	"enable_hashagg": {
+		variable:  func(s *Session) *bool { return &s.EnableHashAgg },
+		bootValue: true,
+		shortDesc: "Enables the planner's use of hashed aggregation plans.",
+	},
+	"enable_indexscan": {
+		variable:  func(s *Session) *bool { return &s.EnableIndexScan },
+		bootValue: true,
+		shortDesc: "Enables the planner's use of index-scan plans.",
+	},
+	"enable_columnarscan": {
+		variable:  func(s *Session) *bool { return &s.EnableColumnarScan },
+		bootValue: true,
+		shortDesc: "Enables the planner's use of columnar scans of columnar tables.",
+	},
+	"autovacuum": {
+		variable:  func(*Session) *bool { return &system.autovacuum },
+		bootValue: true,
+		sighup:    true,
+		shortDesc: "Starts the autovacuum subprocess.",
+	},
+}
+
+var intOptions = map[string]*configInt{
+	"work_mem": {
+		variable:  func(s *Session) *int { return &s.WorkMem },
+		bootValue: 4096,
+		min:       64,
+		max:       2147483647,
+		unit:      "kB",
+		shortDesc: "Sets the maximum memory to be used for query workspaces.",
+	},
+	"autovacuum_naptime": {
+		variable:  func(*Session) *int { return &system.autovacuumNaptime },
+		bootValue: 60,
+		min:       1,
+		max:       2147483,
+		unit:      "s",
+		sighup:    true,
+		shortDesc: "Time to sleep between autovacuum runs.",
+	},
+	"autovacuum_vacuum_threshold": {
+		variable:  func(*Session) *int { return &system.autovacuumVacThresh },
+		bootValue: 50,
+		min:       0,
+		max:       2147483647,
+		sighup:    true,
+		shortDesc: "Minimum number of tuple updates or deletes prior to vacuum.",
+	},
+}
+
+var realOptions = map[string]*configReal{
+	"autovacuum_vacuum_scale_factor": {
+		variable:  func(*Session) *float64 { return &system.autovacuumVacScale },
+		bootValue: 0.2,
+		min:       0,
+		max:       100,
+		sighup:    true,
+		shortDesc: "Number of tuple updates or deletes prior to vacuum as a fraction of reltuples.",
+	},
+}
+
+var stringOptions = map[string]*configString{
+	"timezone": {
+		variable:  func(s *Session) *string { return &s.timeZone },
+		bootValue: "UTC",
+		assign: func(s *Session, value string) (string, error) {
+			loc, err := adt.LoadTimeZone(value)
+			if err != nil {
+				return "", fmt.Errorf("invalid value for parameter \"TimeZone\": \"%s\"", value)
+			}
+			s.Settings.TimeZone = loc
+			return loc.String(), nil
+		},
+		shortDesc: "Sets the time zone for displaying and interpreting time stamps.",
+	},
+	"intervalstyle": {
+		variable:  func(s *Session) *string { return &s.intervalStyle },
+		bootValue: "postgres",
+		assign: func(s *Session, value string) (string, error) {
+			style, name, err := adt.ParseIntervalStyle(value)
+			if err != nil {
+				return "", err
+			}
+			s.Settings.IntervalStyle = style
+			return name, nil
+		},
+		shortDesc: "Sets the display format for interval values.",
+	},
+
+	"default_table_access_method": {
+		variable:  func(s *Session) *string { return &s.DefaultTableAccessMethod },
+		bootValue: access.HEAP_TABLE_AM_NAME,
+		assign: func(s *Session, value string) (string, error) {
+			if !access.IsTableAm(value) {
+				return "", fmt.Errorf("invalid value for parameter \"default_table_access_method\": \"%s\"", value)
+			}
+			return value, nil
+		},
+		shortDesc: "Sets the default table access method for new tables.",
+	},
+}
+
+func init() {
+	system.defaults.Settings = adt.DefaultSettings
+	for _, opt := range boolOptions {
+		*opt.variable(&system.defaults) = opt.bootValue
+	}
+	for _, opt := range intOptions {
+		*opt.variable(&system.defaults) = opt.bootValue
+	}
+	for _, opt := range realOptions {
+		*opt.variable(&system.defaults) = opt.bootValue
+	}
+	for _, opt := range stringOptions {
+		assigned, err := opt.assign(&system.defaults, opt.bootValue)
+		if err != nil {
+			panic(err)
+		}
+		*opt.variable(&system.defaults) = assigned
+	}
+}
+
+// NewSession makes the settings of a new connection, the boot values or what ALTER SYSTEM set
+func NewSession() *Session {
+	system.Lock()
+	defer system.Unlock()
+	session := system.defaults
+	return &session
+}
+
+// Autovacuum returns the autovacuum and autovacuum_naptime settings
+func Autovacuum() (bool, time.Duration) {
+	system.Lock()
+	defer system.Unlock()
+	return system.autovacuum, time.Duration(system.autovacuumNaptime) * time.Second
+}
+
+// AutovacuumVacuumThreshold returns the autovacuum_vacuum_threshold and autovacuum_vacuum_scale_factor settings
+func AutovacuumVacuumThreshold() (int, float64) {
+	system.Lock()
+	defer system.Unlock()
+	return system.autovacuumVacThresh, system.autovacuumVacScale
+}
+
+// SetConfigOption sets a setting of the session from its text value
+func (s *Session) SetConfigOption(name string, value string) error {
+	if isSighup(name) {
+		return fmt.Errorf("parameter \"%s\" cannot be changed now", name)
+	}
+	return setConfigOption(s, name, value)
+}
+
+// ResetConfigOption puts a setting of the session back to the value it started with
+func (s *Session) ResetConfigOption(name string) error {
+	if isSighup(name) {
+		return fmt.Errorf("parameter \"%s\" cannot be changed now", name)
+	}
+	system.Lock()
+	value, err := getConfigOption(&system.defaults, name)
+	system.Unlock()
+	if err != nil {
+		return err
+	}
+	return setConfigOption(s, name, value)
+}
+
+// GetConfigOption returns the current value of a setting as SHOW prints it
+func (s *Session) GetConfigOption(name string) (string, error) {
+	if isSighup(name) {
+		system.Lock()
+		defer system.Unlock()
+	}
+	return getConfigOption(s, name)
+}
+
+// AlterSystemSetConfigOption is ALTER SYSTEM SET, a nil value is ALTER SYSTEM RESET
+func AlterSystemSetConfigOption(name string, value *string) error {
+	system.Lock()
+	defer system.Unlock()
+	if value != nil {
+		return setConfigOption(&system.defaults, name, *value)
+	}
+	if opt, ok := boolOptions[name]; ok {
+		*opt.variable(&system.defaults) = opt.bootValue
+		return nil
+	}
+	if opt, ok := intOptions[name]; ok {
+		*opt.variable(&system.defaults) = opt.bootValue
+		return nil
+	}
+	if opt, ok := realOptions[name]; ok {
+		*opt.variable(&system.defaults) = opt.bootValue
+		return nil
+	}
+	if opt, ok := stringOptions[name]; ok {
+		return setConfigOption(&system.defaults, name, opt.bootValue)
+	}
+	return fmt.Errorf("unrecognized configuration parameter \"%s\"", name)
+}
+
+func isSighup(name string) bool {
+	if opt, ok := boolOptions[name]; ok {
+		return opt.sighup
+	}
+	if opt, ok := intOptions[name]; ok {
+		return opt.sighup
+	}
+	if opt, ok := realOptions[name]; ok {
+		return opt.sighup
+	}
+	return false
+}
+
+func setConfigOption(s *Session, name string, value string) error {
+	if opt, ok := boolOptions[name]; ok {
+		parsed, ok := parseBool(value)
+		if !ok {
+			return fmt.Errorf("parameter \"%s\" requires a Boolean value", name)
+		}
+		*opt.variable(s) = parsed
+		return nil
+	}
+	if opt, ok := intOptions[name]; ok {
+		parsed, err := parseInt(value, opt.unit)
+		if err != nil {
+			return fmt.Errorf("invalid value for parameter \"%s\": \"%s\"", name, value)
+		}
+		if parsed < opt.min || parsed > opt.max {
+			return fmt.Errorf("%d%s is outside the valid range for parameter \"%s\" (%d%s .. %d%s)",
+				parsed, opt.unit, name, opt.min, opt.unit, opt.max, opt.unit)
+		}
+		*opt.variable(s) = parsed
+		return nil
+	}
+	if opt, ok := realOptions[name]; ok {
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || math.IsNaN(parsed) {
+			return fmt.Errorf("parameter \"%s\" requires a numeric value", name)
+		}
+		if parsed < opt.min || parsed > opt.max {
+			return fmt.Errorf("%s is outside the valid range for parameter \"%s\" (%s .. %s)",
+				formatReal(parsed), name, formatReal(opt.min), formatReal(opt.max))
+		}
+		*opt.variable(s) = parsed
+		return nil
+	}
+	if opt, ok := stringOptions[name]; ok {
+		//assign changes s as it goes, a failed one must leave it as it was
+		changed := *s
+		assigned, err := opt.assign(&changed, value)
+		if err != nil {
+			return err
+		}
+		*opt.variable(&changed) = assigned
+		*s = changed
+		return nil
+	}
+	return fmt.Errorf("unrecognized configuration parameter \"%s\"", name)
+}
+
+func getConfigOption(s *Session, name string) (string, error) {
+	if opt, ok := boolOptions[name]; ok {
+		if *opt.variable(s) {
+			return "on", nil
+		}
+		return "off", nil
+	}
+	if opt, ok := intOptions[name]; ok {
+		return formatInt(*opt.variable(s), opt.unit), nil
+	}
+	if opt, ok := realOptions[name]; ok {
+		return formatReal(*opt.variable(s)), nil
+	}
+	if opt, ok := stringOptions[name]; ok {
+		return *opt.variable(s), nil
+	}
+	return "", fmt.Errorf("unrecognized configuration parameter \"%s\"", name)
+}
+
+// ConfigOption is one row of SHOW ALL
+type ConfigOption struct {
+	Name        string
+	Setting     string
+	Description string
+}
+
+func (s *Session) GetAllConfigOptions() []ConfigOption {
+	var options []ConfigOption
+	for name, opt := range boolOptions {
+		setting, _ := s.GetConfigOption(name)
+		options = append(options, ConfigOption{Name: name, Setting: setting, Description: opt.shortDesc})
+	}
+	for name, opt := range intOptions {
+		setting, _ := s.GetConfigOption(name)
+		options = append(options, ConfigOption{Name: name, Setting: setting, Description: opt.shortDesc})
+	}
+	for name, opt := range realOptions {
+		setting, _ := s.GetConfigOption(name)
+		options = append(options, ConfigOption{Name: name, Setting: setting, Description: opt.shortDesc})
+	}
+	for name, opt := range stringOptions {
+		options = append(options, ConfigOption{Name: name, Setting: *opt.variable(s), Description: opt.shortDesc})
+	}
+	sort.Slice(options, func(i, j int) bool { return options[i].Name < options[j].Name })
+	return options
+}
+
+func parseBool(value string) (bool, bool) {
+	switch strings.ToLower(value) {
+	case "on", "true", "yes", "1", "t":
+		return true, true
+	case "off", "false", "no", "0", "f":
+		return false, true
+	}
+	return false, false
+}
+
+type unitConversion struct {
+	suffix     string
+	multiplier int64
+}
+
+// The units a setting kept in kB (memory) or s (time) can be given in, largest first
+var unitConversions = map[string][]unitConversion{
+	"kB": {{"TB", 1024 * 1024 * 1024}, {"GB", 1024 * 1024}, {"MB", 1024}, {"kB", 1}},
+	"s":  {{"d", 24 * 60 * 60}, {"h", 60 * 60}, {"min", 60}, {"s", 1}},
+}
+
+/*
+parseInt accepts a plain number or, for memory and time settings, a number with a unit (64MB, 5min)
+Integer settings are 32 bit as in postgres, a value that does not fit once in the setting's unit is an error
+*/
+func parseInt(value string, unit string) (int, error) {
+	value = strings.TrimSpace(value)
+	lower := strings.ToLower(value)
+	multiplier := int64(1)
+	for _, conv := range unitConversions[unit] {
+		if strings.HasSuffix(lower, strings.ToLower(conv.suffix)) {
+			value = strings.TrimSpace(value[:len(value)-len(conv.suffix)])
+			multiplier = conv.multiplier
+			break
+		}
+	}
+	number, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if number > math.MaxInt32/multiplier || number < math.MinInt32/multiplier {
+		return 0, fmt.Errorf("value exceeds integer range")
+	}
+	return int(number * multiplier), nil
+}
+
+// formatInt prints memory and time in the largest unit that divides them, 65536kB is 64MB and 60s is 1min
+func formatInt(value int, unit string) string {
+	for _, conv := range unitConversions[unit] {
+		if value != 0 && int64(value)%conv.multiplier == 0 {
+			return strconv.FormatInt(int64(value)/conv.multiplier, 10) + conv.suffix
+		}
+	}
+	return strconv.Itoa(value) + unit
+}
+
+// formatReal prints a real setting the shortest way that reads back the same, as postgres' %g
+func formatReal(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -5,6 +5,7 @@ import (
 	"log"
 	"net"
 
+	"github.com/rautNishan/diskquery/commands"
 	"github.com/rautNishan/diskquery/connection"
 )
 
@@ -21,6 +22,7 @@ func main() {
 		log.Fatal("Error while starting server")
 	}
 	fmt.Println("Listning on port 3000")
+	go commands.AutoVacLauncherMain()
 	for {
 		conn, err := listner.Accept()
 		if err != nil {
@@ -0,0 +1,2837 @@
+package parser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/rautNishan/diskquery/adt"
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+Hand written recursive descent parser
+Postgres generates its parser from gram.y with bison, we walk the token stream instead
+Each parseXXX function consumes the tokens of one grammar rule and returns the raw parse tree for it
+
+Operator precedence (lowest to highest) follows postgres:
+OR, AND, NOT, IS, comparison, IN, ||, + -, * / %, ^, AT TIME ZONE, unary minus
+*/
+
+type Parser struct {
+	query  string
+	tokens []Token
+	pos    int
+}
+
+func NewParser(query string, tokens []Token) *Parser {
+	return &Parser{query: query, tokens: tokens}
+}
+
+func (p *Parser) current() Token {
+	return p.tokens[p.pos]
+}
+
+func (p *Parser) peekToken() Token {
+	if p.pos+1 < len(p.tokens) {
+		return p.tokens[p.pos+1]
+	}
+	return p.tokens[len(p.tokens)-1]
+}
+
+func (p *Parser) advance() Token {
+	tok := p.tokens[p.pos]
+	if tok.Type != TOKEN_EOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *Parser) check(tokenType TokenType) bool {
+	return p.current().Type == tokenType
+}
+
+// accept consumes the current token if it is of the given type
+func (p *Parser) accept(tokenType TokenType) bool {
+	if p.check(tokenType) {
+		p.advance()
+		return true
+	}
+	return false
+}
+
+func (p *Parser) expect(tokenType TokenType) (Token, error) {
+	if !p.check(tokenType) {
+		return Token{}, p.syntaxError()
+	}
+	return p.advance(), nil
+}
+
+/*
+Unreserved keywords can still be used as table, column and alias names
+(A column called "first" or "last" is common enough that we should not break it)
+*/
+var unreservedKeywords = map[TokenType]bool{
+	TOKEN_FILTER: true,
+	TOKEN_NULLS:  true,
+	TOKEN_FIRST:  true,
+	TOKEN_LAST:   true,
+	TOKEN_SHOW:   true,
+	TOKEN_RESET:  true,
+
+	TOKEN_RECURSIVE:    true,
+	TOKEN_MATERIALIZED: true,
+
+	TOKEN_PARTITION: true,
+	TOKEN_ROWS:      true,
+	TOKEN_RANGE:     true,
+	TOKEN_GROUPS:    true,
+	TOKEN_UNBOUNDED: true,
+	TOKEN_PRECEDING: true,
+	TOKEN_FOLLOWING: true,
+	TOKEN_CURRENT:   true,
+	TOKEN_ROW:       true,
+	TOKEN_EXCLUDE:   true,
+	TOKEN_TIES:      true,
+	TOKEN_OTHERS:    true,
+	TOKEN_NO:        true,
+
+	TOKEN_AT:   true,
+	TOKEN_TIME: true,
+	TOKEN_ZONE: true,
+
+	TOKEN_UNKNOWN: true,
+	TOKEN_ESCAPE:  true,
+
+	TOKEN_IF:           true,
+	TOKEN_CONCURRENTLY: true,
+	TOKEN_INCLUDE:      true,
+
+	TOKEN_VACUUM:  true,
+	TOKEN_VERBOSE: true,
+
+	TOKEN_STORAGE: true,
+}
+
+// checkIdent tells if the current token can be used as a name
+func (p *Parser) checkIdent() bool {
+	return p.check(TOKEN_IDENT) || unreservedKeywords[p.current().Type]
+}
+
+func (p *Parser) expectIdent() (Token, error) {
+	if !p.checkIdent() {
+		return Token{}, p.syntaxError()
+	}
+	tok := p.advance()
+	tok.Value = identName(tok)
+	return tok, nil
+}
+
+// identName is the name a token stands for, keywords are scanned upper case but names are lower case
+func identName(tok Token) string {
+	if tok.Type == TOKEN_IDENT {
+		return tok.Value
+	}
+	return strings.ToLower(tok.Value)
+}
+
+// QuoteIdentifier double quotes a name unless it reads back as itself: a lower case name that is not a reserved keyword
+func QuoteIdentifier(ident string) string {
+	plain := ident != ""
+	for i, c := range ident {
+		if !(c >= 'a' && c <= 'z' || c == '_' || i > 0 && c >= '0' && c <= '9') {
+			plain = false
+			break
+		}
+	}
+	if tokenType, isKeyword := keywords[strings.ToUpper(ident)]; isKeyword && !unreservedKeywords[tokenType] {
+		plain = false
+	}
+	if plain {
+		return ident
+	}
+	return "\"" + strings.ReplaceAll(ident, "\"", "\"\"") + "\""
+}
+
+/*
+sourceText is the text of the tokens from the one at location start up to the current token, an expression
+as it was written. It is kept in a catalog row so it has to fit on one line: the tokens are taken as they are
+and what is between them (white space, comments) becomes a single space, a string constant holding a line
+break is written again as an escape string
+*/
+func (p *Parser) sourceText(start int) string {
+	query := []rune(p.query)
+	var sb strings.Builder
+	prevEnd := -1
+	for _, tok := range p.tokens[:p.pos] {
+		if tok.Location < start {
+			continue
+		}
+		if prevEnd >= 0 && tok.Location > prevEnd {
+			sb.WriteByte(' ')
+		}
+		if tok.Type == TOKEN_SCONST && strings.ContainsAny(tok.Value, "\n\r") {
+			sb.WriteString(escapeStringLiteral(tok.Value))
+		} else {
+			sb.WriteString(string(query[tok.Location:tok.End]))
+		}
+		prevEnd = tok.End
+	}
+	return sb.String()
+}
+
+var escapeStringReplacer = strings.NewReplacer(`\`, `\\`, "'", "''", "\n", `\n`, "\r", `\r`)
+
+// escapeStringLiteral writes a string constant as an escape string E'...'
+func escapeStringLiteral(str string) string {
+	return "E'" + escapeStringReplacer.Replace(str) + "'"
+}
+
+func (p *Parser) syntaxError() error {
+	tok := p.current()
+	switch tok.Type {
+	case TOKEN_EOF:
+		return fmt.Errorf("syntax error at end of input")
+	case TOKEN_ERROR:
+		return fmt.Errorf("%s at position %d", tok.Value, tok.Location)
+	}
+	return fmt.Errorf("syntax error at or near \"%s\" at position %d", tok.Value, tok.Location)
+}
+
+// parseStmtList parses statements separated by semicolons
+func (p *Parser) parseStmtList() ([]types.Node, error) {
+	var stmts []types.Node
+	for {
+		for p.accept(TOKEN_SEMICOLON) {
+		}
+		if p.check(TOKEN_EOF) {
+			return stmts, nil
+		}
+		stmt, err := p.parseStmt()
+		if err != nil {
+			return nil, err
+		}
+		stmts = append(stmts, stmt)
+
+		if !p.check(TOKEN_SEMICOLON) && !p.check(TOKEN_EOF) {
+			return nil, p.syntaxError()
+		}
+	}
+}
+
+func (p *Parser) parseStmt() (types.Node, error) {
+	switch p.current().Type {
+	case TOKEN_SELECT, TOKEN_WITH, TOKEN_LPAREN:
+		return p.parseSelectStmt()
+	case TOKEN_SET:
+		return p.parseVariableSetStmt()
+	case TOKEN_RESET:
+		return p.parseVariableResetStmt()
+	case TOKEN_CREATE:
+		return p.parseCreateStmt()
+	case TOKEN_DROP:
+		return p.parseDropStmt()
+	case TOKEN_VACUUM:
+		return p.parseVacuumStmt()
+	case TOKEN_INSERT:
+		return p.parseInsertStmt()
+	case TOKEN_UPDATE:
+		return p.parseUpdateStmt()
+	case TOKEN_DELETE:
+		return p.parseDeleteStmt()
+	case TOKEN_ALTER:
+		if next := p.peekToken(); next.Type == TOKEN_IDENT && next.Value == "system" {
+			return p.parseAlterSystemStmt()
+		}
+		return p.parseAlterTableStmt()
+	case TOKEN_SHOW:
+		p.advance()
+		if p.accept(TOKEN_ALL) {
+			return &types.VariableShowStmt{Name: "all"}, nil
+		}
+		name, err := p.expectIdent()
+		if err != nil {
+			return nil, err
+		}
+		return &types.VariableShowStmt{Name: name.Value}, nil
+	}
+	return nil, p.syntaxError()
+}
+
+/*
+SET name {TO | =} {value | DEFAULT}
+SET TIME ZONE {value | LOCAL | DEFAULT}
+*/
+func (p *Parser) parseVariableSetStmt() (types.Node, error) {
+	p.advance()
+	if p.check(TOKEN_TIME) && p.peekToken().Type == TOKEN_ZONE {
+		p.advance()
+		p.advance()
+		if p.check(TOKEN_DEFAULT) || (p.check(TOKEN_IDENT) && p.current().Value == "local") {
+			p.advance()
+			return &types.VariableSetStmt{Kind: types.VAR_SET_DEFAULT, Name: "timezone"}, nil
+		}
+		tok := p.current()
+		switch {
+		case tok.Type == TOKEN_SCONST || tok.Type == TOKEN_ICONST || tok.Type == TOKEN_FCONST:
+			p.advance()
+		case tok.Type == TOKEN_MINUS && (p.peekToken().Type == TOKEN_ICONST || p.peekToken().Type == TOKEN_FCONST):
+			p.advance()
+			tok = p.advance()
+			tok.Value = "-" + tok.Value
+		default:
+			return nil, p.syntaxError()
+		}
+		return &types.VariableSetStmt{Kind: types.VAR_SET_VALUE, Name: "timezone", Value: tok.Value}, nil
+	}
+	name, err := p.expectIdent()
+	if err != nil {
+		return nil, err
+	}
+	if !p.accept(TOKEN_TO) {
+		if _, err := p.expect(TOKEN_EQ); err != nil {
+			return nil, err
+		}
+	}
+	if p.accept(TOKEN_DEFAULT) {
+		return &types.VariableSetStmt{Kind: types.VAR_SET_DEFAULT, Name: name.Value}, nil
+	}
+
+	tok := p.current()
+	switch {
+	case tok.Type == TOKEN_SCONST || tok.Type == TOKEN_ICONST || tok.Type == TOKEN_FCONST:
+		p.advance()
+	case tok.Type == TOKEN_MINUS && (p.peekToken().Type == TOKEN_ICONST || p.peekToken().Type == TOKEN_FCONST):
+		p.advance()
+		tok = p.advance()
+		tok.Value = "-" + tok.Value
+	case tok.Type == TOKEN_IDENT, keywordsReverse[tok.Type] != "":
+		p.advance()
+		tok.Value = identName(tok)
+	default:
+		return nil, p.syntaxError()
+	}
+	return &types.VariableSetStmt{Kind: types.VAR_SET_VALUE, Name: name.Value, Value: tok.Value}, nil
+}
+
+// RESET name
+func (p *Parser) parseVariableResetStmt() (types.Node, error) {
+	p.advance()
+	name, err := p.expectIdent()
+	if err != nil {
+		return nil, err
+	}
+	return &types.VariableSetStmt{Kind: types.VAR_RESET, Name: name.Value}, nil
+}
+
+// ALTER SYSTEM {SET name {TO | =} {value | DEFAULT} | RESET name}
+func (p *Parser) parseAlterSystemStmt() (types.Node, error) {
+	p.advance()
+	p.advance()
+	var setstmt types.Node
+	var err error
+	switch p.current().Type {
+	case TOKEN_SET:
+		setstmt, err = p.parseVariableSetStmt()
+	case TOKEN_RESET:
+		setstmt, err = p.parseVariableResetStmt()
+	default:
+		return nil, p.syntaxError()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &types.AlterSystemStmt{Setstmt: setstmt.(*types.VariableSetStmt)}, nil
+}
+
+// qualified_name: name | schema '.' name
+func (p *Parser) parseQualifiedName() (*types.RangeVar, error) {
+	tok, err := p.expectIdent()
+	if err != nil {
+		return nil, err
+	}
+	rangeVar := &types.RangeVar{Relname: tok.Value, Location: tok.Location}
+	if p.accept(TOKEN_DOT) {
+		tok, err := p.expectIdent()
+		if err != nil {
+			return nil, err
+		}
+		rangeVar.Schemaname = rangeVar.Relname
+		rangeVar.Relname = tok.Value
+	}
+	return rangeVar, nil
+}
+
+// CREATE TABLE [IF NOT EXISTS] qualified_name ([column_def, ...]) [USING name]
+func (p *Parser) parseCreateStmt() (types.Node, error) {
+	p.advance()
+	if p.check(TOKEN_UNIQUE) || p.check(TOKEN_INDEX) {
+		return p.parseIndexStmt()
+	}
+	if _, err := p.expect(TOKEN_TABLE); err != nil {
+		return nil, err
+	}
+	stmt := &types.CreateStmt{}
+	if p.accept(TOKEN_IF) {
+		if _, err := p.expect(TOKEN_NOT); err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(TOKEN_EXISTS); err != nil {
+			return nil, err
+		}
+		stmt.IfNotExists = true
+	}
+	var err error
+	if stmt.Relation, err = p.parseQualifiedName(); err != nil {
+		return nil, err
+	}
+
+	if _, err := p.expect(TOKEN_LPAREN); err != nil {
+		return nil, err
+	}
+	if !p.check(TOKEN_RPAREN) {
+		for {
+			colDef, err := p.parseColumnDef()
+			if err != nil {
+				return nil, err
+			}
+			stmt.TableElts = append(stmt.TableElts, colDef)
+			if !p.accept(TOKEN_COMMA) {
+				break
+			}
+		}
+	}
+	if _, err := p.expect(TOKEN_RPAREN); err != nil {
+		return nil, err
+	}
+	if p.accept(TOKEN_USING) {
+		method, err := p.expectIdent()
+		if err != nil {
+			return nil, err
+		}
+		stmt.AccessMethod = method.Value
+	}
+	return stmt, nil
+}
+
+// column_def: name type_name [STORAGE storage] [NOT NULL | NULL]...
+func (p *Parser) parseColumnDef() (*types.ColumnDef, error) {
+	name, err := p.expectIdent()
+	if err != nil {
+		return nil, err
+	}
+	colDef := &types.ColumnDef{Colname: name.Value, Location: name.Location}
+	if colDef.TypeName, err = p.parseTypeName(); err != nil {
+		return nil, err
+	}
+	if p.accept(TOKEN_STORAGE) {
+		if colDef.StorageName, err = p.parseStorageName(); err != nil {
+			return nil, err
+		}
+	}
+	for {
+		if p.accept(TOKEN_NOT) {
+			if _, err := p.expect(TOKEN_NULL); err != nil {
+				return nil, err
+			}
+			colDef.IsNotNull = true
+		} else if p.accept(TOKEN_NULL) {
+			colDef.IsNotNull = false
+		} else {
+			return colDef, nil
+		}
+	}
+}
+
+/*
+CREATE [UNIQUE] INDEX [CONCURRENTLY] [[IF NOT EXISTS] name] ON qualified_name [USING name]
+(index_elem, ...) [INCLUDE (index_elem, ...)] [WHERE a_expr]
+index_elem: {name | func_call | '(' a_expr ')'} [ASC | DESC] [NULLS {FIRST | LAST}]
+*/
+func (p *Parser) parseIndexStmt() (types.Node, error) {
+	stmt := &types.IndexStmt{Unique: p.accept(TOKEN_UNIQUE), AccessMethod: types.DEFAULT_INDEX_TYPE}
+	if _, err := p.expect(TOKEN_INDEX); err != nil {
+		return nil, err
+	}
+	stmt.Concurrent = p.accept(TOKEN_CONCURRENTLY)
+	if p.accept(TOKEN_IF) {
+		if _, err := p.expect(TOKEN_NOT); err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(TOKEN_EXISTS); err != nil {
+			return nil, err
+		}
+		stmt.IfNotExists = true
+	}
+	if stmt.IfNotExists || !p.check(TOKEN_ON) {
+		name, err := p.expectIdent()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Idxname = name.Value
+	}
+	if _, err := p.expect(TOKEN_ON); err != nil {
+		return nil, err
+	}
+	var err error
+	if stmt.Relation, err = p.parseQualifiedName(); err != nil {
+		return nil, err
+	}
+	if p.accept(TOKEN_USING) {
+		method, err := p.expectIdent()
+		if err != nil {
+			return nil, err
+		}
+		stmt.AccessMethod = method.Value
+	}
+
+	if _, err := p.expect(TOKEN_LPAREN); err != nil {
+		return nil, err
+	}
+	if stmt.IndexParams, err = p.parseIndexElemList(); err != nil {
+		return nil, err
+	}
+	if p.accept(TOKEN_INCLUDE) {
+		if _, err := p.expect(TOKEN_LPAREN); err != nil {
+			return nil, err
+		}
+		if stmt.IndexIncludingParams, err = p.parseIndexElemList(); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.accept(TOKEN_WHERE) {
+		start := p.current().Location
+		if stmt.WhereClause, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+		stmt.WhereText = p.sourceText(start)
+	}
+	return stmt, nil
+}
+
+// parseIndexElemList parses the index_elems after an opening parenthesis up to the closing one
+func (p *Parser) parseIndexElemList() ([]*types.IndexElem, error) {
+	var elems []*types.IndexElem
+	for {
+		elem, err := p.parseIndexElem()
+		if err != nil {
+			return nil, err
+		}
+		elems = append(elems, elem)
+		if !p.accept(TOKEN_COMMA) {
+			break
+		}
+	}
+	if _, err := p.expect(TOKEN_RPAREN); err != nil {
+		return nil, err
+	}
+	return elems, nil
+}
+
+func (p *Parser) parseIndexElem() (*types.IndexElem, error) {
+	elem := &types.IndexElem{Location: p.current().Location}
+	var err error
+	switch {
+	case p.accept(TOKEN_LPAREN):
+		start := p.current().Location
+		if elem.Expr, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+		elem.ExprText = p.sourceText(start)
+		if _, err := p.expect(TOKEN_RPAREN); err != nil {
+			return nil, err
+		}
+	case p.checkIdent() && p.peekToken().Type == TOKEN_LPAREN:
+		if elem.Expr, err = p.parseFuncCall(); err != nil {
+			return nil, err
+		}
+		elem.ExprText = p.sourceText(elem.Location)
+	default:
+		name, err := p.expectIdent()
+		if err != nil {
+			return nil, err
+		}
+		elem.Name = name.Value
+	}
+
+	if p.accept(TOKEN_ASC) {
+		elem.Ordering = types.SORTBY_ASC
+	} else if p.accept(TOKEN_DESC) {
+		elem.Ordering = types.SORTBY_DESC
+	}
+	if p.accept(TOKEN_NULLS) {
+		if p.accept(TOKEN_FIRST) {
+			elem.NullsOrdering = types.SORTBY_NULLS_FIRST
+		} else if p.accept(TOKEN_LAST) {
+			elem.NullsOrdering = types.SORTBY_NULLS_LAST
+		} else {
+			return nil, p.syntaxError()
+		}
+	}
+	return elem, nil
+}
+
+// DROP {TABLE | INDEX [CONCURRENTLY]} [IF EXISTS] qualified_name, ...
+func (p *Parser) parseDropStmt() (types.Node, error) {
+	p.advance()
+	stmt := &types.DropStmt{RemoveType: types.OBJECT_TABLE}
+	if p.accept(TOKEN_INDEX) {
+		stmt.RemoveType = types.OBJECT_INDEX
+		p.accept(TOKEN_CONCURRENTLY)
+	} else if _, err := p.expect(TOKEN_TABLE); err != nil {
+		return nil, err
+	}
+	if p.accept(TOKEN_IF) {
+		if _, err := p.expect(TOKEN_EXISTS); err != nil {
+			return nil, err
+		}
+		stmt.MissingOk = true
+	}
+	for {
+		rangeVar, err := p.parseQualifiedName()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Objects = append(stmt.Objects, rangeVar)
+		if !p.accept(TOKEN_COMMA) {
+			return stmt, nil
+		}
+	}
+}
+
+// VACUUM [FULL] [VERBOSE] [qualified_name, ...]
+func (p *Parser) parseVacuumStmt() (types.Node, error) {
+	p.advance()
+	stmt := &types.VacuumStmt{Full: p.accept(TOKEN_FULL), Verbose: p.accept(TOKEN_VERBOSE)}
+	if p.check(TOKEN_SEMICOLON) || p.check(TOKEN_EOF) {
+		return stmt, nil
+	}
+	for {
+		rangeVar, err := p.parseQualifiedName()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Rels = append(stmt.Rels, rangeVar)
+		if !p.accept(TOKEN_COMMA) {
+			return stmt, nil
+		}
+	}
+}
+
+// storage: {PLAIN | EXTERNAL | EXTENDED | MAIN | DEFAULT}, any name is taken here and checked when it is used
+func (p *Parser) parseStorageName() (string, error) {
+	if p.accept(TOKEN_DEFAULT) {
+		return "default", nil
+	}
+	name, err := p.expectIdent()
+	return name.Value, err
+}
+
+/*
+ALTER TABLE [IF EXISTS] qualified_name alter_table_cmd, ...
+alter_table_cmd: ALTER [COLUMN] name SET STORAGE storage
+*/
+func (p *Parser) parseAlterTableStmt() (types.Node, error) {
+	p.advance()
+	if _, err := p.expect(TOKEN_TABLE); err != nil {
+		return nil, err
+	}
+	stmt := &types.AlterTableStmt{}
+	if p.accept(TOKEN_IF) {
+		if _, err := p.expect(TOKEN_EXISTS); err != nil {
+			return nil, err
+		}
+		stmt.MissingOk = true
+	}
+	var err error
+	if stmt.Relation, err = p.parseQualifiedName(); err != nil {
+		return nil, err
+	}
+	for {
+		if _, err := p.expect(TOKEN_ALTER); err != nil {
+			return nil, err
+		}
+		p.accept(TOKEN_COLUMN)
+		name, err := p.expectIdent()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(TOKEN_SET); err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(TOKEN_STORAGE); err != nil {
+			return nil, err
+		}
+		cmd := &types.AlterTableCmd{Subtype: types.AT_SetStorage, Name: name.Value, Location: name.Location}
+		if cmd.StorageName, err = p.parseStorageName(); err != nil {
+			return nil, err
+		}
+		stmt.Cmds = append(stmt.Cmds, cmd)
+		if !p.accept(TOKEN_COMMA) {
+			return stmt, nil
+		}
+	}
+}
+
+/*
+INSERT INTO qualified_name [AS alias] ['(' name, ... ')'] insert_rest [RETURNING target_list]
+insert_rest: VALUES '(' value, ... ')', ... | DEFAULT VALUES | select_stmt
+value: expr | DEFAULT
+*/
+func (p *Parser) parseInsertStmt() (types.Node, error) {
+	p.advance()
+	if _, err := p.expect(TOKEN_INTO); err != nil {
+		return nil, err
+	}
+	rangeVar, err := p.parseQualifiedName()
+	if err != nil {
+		return nil, err
+	}
+	if p.accept(TOKEN_AS) {
+		alias, err := p.expectIdent()
+		if err != nil {
+			return nil, err
+		}
+		rangeVar.Alias = alias.Value
+	}
+	stmt := &types.InsertStmt{Relation: rangeVar}
+
+	//A parenthesized SELECT is the rows to insert, not a column list
+	if p.check(TOKEN_LPAREN) && !startsSelect(p.peekToken()) {
+		p.advance()
+		for {
+			col, err := p.expectIdent()
+			if err != nil {
+				return nil, err
+			}
+			stmt.Cols = append(stmt.Cols, &types.ResTarget{Name: col.Value, Location: col.Location})
+			if !p.accept(TOKEN_COMMA) {
+				break
+			}
+		}
+		if _, err := p.expect(TOKEN_RPAREN); err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case p.accept(TOKEN_VALUES):
+		for {
+			row, err := p.parseValuesRow()
+			if err != nil {
+				return nil, err
+			}
+			stmt.ValuesLists = append(stmt.ValuesLists, row)
+			if !p.accept(TOKEN_COMMA) {
+				break
+			}
+		}
+	case p.accept(TOKEN_DEFAULT):
+		if _, err := p.expect(TOKEN_VALUES); err != nil {
+			return nil, err
+		}
+	default:
+		if stmt.SelectStmt, err = p.parseSelectStmt(); err != nil {
+			return nil, err
+		}
+	}
+	if stmt.ReturningList, err = p.parseReturningClause(); err != nil {
+		return nil, err
+	}
+	return stmt, nil
+}
+
+// '(' value, ... ')' of VALUES
+func (p *Parser) parseValuesRow() ([]types.Node, error) {
+	if _, err := p.expect(TOKEN_LPAREN); err != nil {
+		return nil, err
+	}
+	var row []types.Node
+	for {
+		value, err := p.parseValueOrDefault()
+		if err != nil {
+			return nil, err
+		}
+		row = append(row, value)
+		if !p.accept(TOKEN_COMMA) {
+			break
+		}
+	}
+	if _, err := p.expect(TOKEN_RPAREN); err != nil {
+		return nil, err
+	}
+	return row, nil
+}
+
+// value: expr | DEFAULT
+func (p *Parser) parseValueOrDefault() (types.Node, error) {
+	if p.check(TOKEN_DEFAULT) {
+		return &types.SetToDefault{Location: p.advance().Location}, nil
+	}
+	return p.parseExpr()
+}
+
+/*
+UPDATE relation_expr_opt_alias SET name '=' value, ... [WHERE expr] [RETURNING target_list]
+relation_expr_opt_alias: qualified_name [[AS] alias]
+*/
+func (p *Parser) parseUpdateStmt() (types.Node, error) {
+	p.advance()
+	rangeVar, err := p.parseRelationExprOptAlias()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(TOKEN_SET); err != nil {
+		return nil, err
+	}
+	stmt := &types.UpdateStmt{Relation: rangeVar}
+	for {
+		col, err := p.expectIdent()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(TOKEN_EQ); err != nil {
+			return nil, err
+		}
+		value, err := p.parseValueOrDefault()
+		if err != nil {
+			return nil, err
+		}
+		stmt.TargetList = append(stmt.TargetList, &types.ResTarget{Name: col.Value, Val: value, Location: col.Location})
+		if !p.accept(TOKEN_COMMA) {
+			break
+		}
+	}
+	if p.accept(TOKEN_WHERE) {
+		if stmt.WhereClause, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	if stmt.ReturningList, err = p.parseReturningClause(); err != nil {
+		return nil, err
+	}
+	return stmt, nil
+}
+
+// DELETE FROM relation_expr_opt_alias [WHERE expr] [RETURNING target_list]
+func (p *Parser) parseDeleteStmt() (types.Node, error) {
+	p.advance()
+	if _, err := p.expect(TOKEN_FROM); err != nil {
+		return nil, err
+	}
+	rangeVar, err := p.parseRelationExprOptAlias()
+	if err != nil {
+		return nil, err
+	}
+	stmt := &types.DeleteStmt{Relation: rangeVar}
+	if p.accept(TOKEN_WHERE) {
+		if stmt.WhereClause, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	if stmt.ReturningList, err = p.parseReturningClause(); err != nil {
+		return nil, err
+	}
+	return stmt, nil
+}
+
+func (p *Parser) parseRelationExprOptAlias() (*types.RangeVar, error) {
+	rangeVar, err := p.parseQualifiedName()
+	if err != nil {
+		return nil, err
+	}
+	if p.accept(TOKEN_AS) {
+		alias, err := p.expectIdent()
+		if err != nil {
+			return nil, err
+		}
+		rangeVar.Alias = alias.Value
+	} else if p.checkIdent() {
+		rangeVar.Alias = identName(p.advance())
+	}
+	return rangeVar, nil
+}
+
+// [RETURNING target_list], nil without it
+func (p *Parser) parseReturningClause() ([]*types.ResTarget, error) {
+	if !p.accept(TOKEN_RETURNING) {
+		return nil, nil
+	}
+	return p.parseTargetList()
+}
+
+/*
+select_stmt: [with_clause] select_clause [ORDER BY sortby_list] [LIMIT {count | ALL}] [OFFSET start]
+
+select_clause: intersect_term {(UNION | EXCEPT) [ALL | DISTINCT] intersect_term}
+intersect_term: select_primary {INTERSECT [ALL | DISTINCT] select_primary}
+select_primary: simple_select | '(' select_stmt ')'
+
+INTERSECT binds tighter than UNION and EXCEPT, which are left associative (same as postgres)
+*/
+func (p *Parser) parseSelectStmt() (*types.SelectStmt, error) {
+	var withClause *types.WithClause
+	if p.check(TOKEN_WITH) {
+		var err error
+		if withClause, err = p.parseWithClause(); err != nil {
+			return nil, err
+		}
+	}
+
+	stmt, err := p.parseSelectClause()
+	if err != nil {
+		return nil, err
+	}
+	if withClause != nil {
+		if stmt.WithClause != nil {
+			return nil, fmt.Errorf("multiple WITH clauses not allowed at position %d", withClause.Location)
+		}
+		stmt.WithClause = withClause
+	}
+
+	if p.check(TOKEN_ORDER) {
+		location := p.advance().Location
+		if _, err := p.expect(TOKEN_BY); err != nil {
+			return nil, err
+		}
+		if stmt.SortClause != nil {
+			return nil, fmt.Errorf("multiple ORDER BY clauses not allowed at position %d", location)
+		}
+		sortClause, err := p.parseSortClause()
+		if err != nil {
+			return nil, err
+		}
+		stmt.SortClause = sortClause
+	}
+
+	if p.check(TOKEN_LIMIT) || p.check(TOKEN_OFFSET) {
+		location := p.current().Location
+		if stmt.LimitCount != nil || stmt.LimitOffset != nil {
+			return nil, fmt.Errorf("multiple LIMIT/OFFSET clauses not allowed at position %d", location)
+		}
+		if err := p.parseLimitOffset(stmt); err != nil {
+			return nil, err
+		}
+	}
+	return stmt, nil
+}
+
+/*
+with_clause: WITH [RECURSIVE] cte {, cte}
+cte: name ['(' column_name {, column_name} ')'] AS [[NOT] MATERIALIZED] '(' select_stmt ')'
+*/
+func (p *Parser) parseWithClause() (*types.WithClause, error) {
+	withClause := &types.WithClause{Location: p.advance().Location}
+	withClause.Recursive = p.accept(TOKEN_RECURSIVE)
+	for {
+		name, err := p.expectIdent()
+		if err != nil {
+			return nil, err
+		}
+		cte := &types.CommonTableExpr{Ctename: name.Value, Location: name.Location}
+
+		if p.accept(TOKEN_LPAREN) {
+			for {
+				colname, err := p.expectIdent()
+				if err != nil {
+					return nil, err
+				}
+				cte.Aliascolnames = append(cte.Aliascolnames, colname.Value)
+				if !p.accept(TOKEN_COMMA) {
+					break
+				}
+			}
+			if _, err := p.expect(TOKEN_RPAREN); err != nil {
+				return nil, err
+			}
+		}
+
+		if _, err := p.expect(TOKEN_AS); err != nil {
+			return nil, err
+		}
+		if p.accept(TOKEN_MATERIALIZED) {
+			cte.CteMaterialized = types.CTEMaterializeAlways
+		} else if p.check(TOKEN_NOT) && p.peekToken().Type == TOKEN_MATERIALIZED {
+			p.advance()
+			p.advance()
+			cte.CteMaterialized = types.CTEMaterializeNever
+		}
+
+		if cte.Ctequery, err = p.parseSubselect(); err != nil {
+			return nil, err
+		}
+		//CYCLE and SEARCH are not keywords, nothing else can follow the query
+		if tok := p.current(); tok.Type == TOKEN_IDENT {
+			switch tok.Value {
+			case "cycle":
+				if cte.CycleClause, err = p.parseCycleClause(); err != nil {
+					return nil, err
+				}
+			case "search":
+				return nil, fmt.Errorf("SEARCH in a recursive query is not implemented at position %d", tok.Location)
+			}
+		}
+		withClause.Ctes = append(withClause.Ctes, cte)
+		if !p.accept(TOKEN_COMMA) {
+			return withClause, nil
+		}
+	}
+}
+
+// parseCycleClause parses CYCLE col, ... SET mark_col [TO value DEFAULT default] USING path_col
+func (p *Parser) parseCycleClause() (*types.CTECycleClause, error) {
+	cycle := &types.CTECycleClause{Location: p.advance().Location}
+	for {
+		colname, err := p.expectIdent()
+		if err != nil {
+			return nil, err
+		}
+		cycle.CycleColList = append(cycle.CycleColList, colname.Value)
+		if !p.accept(TOKEN_COMMA) {
+			break
+		}
+	}
+	if _, err := p.expect(TOKEN_SET); err != nil {
+		return nil, err
+	}
+	markColumn, err := p.expectIdent()
+	if err != nil {
+		return nil, err
+	}
+	cycle.CycleMarkColumn = markColumn.Value
+	if p.accept(TOKEN_TO) {
+		if cycle.CycleMarkValue, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(TOKEN_DEFAULT); err != nil {
+			return nil, err
+		}
+		if cycle.CycleMarkDefault, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := p.expect(TOKEN_USING); err != nil {
+		return nil, err
+	}
+	pathColumn, err := p.expectIdent()
+	if err != nil {
+		return nil, err
+	}
+	cycle.CyclePathColumn = pathColumn.Value
+	return cycle, nil
+}
+
+func (p *Parser) parseSelectClause() (*types.SelectStmt, error) {
+	left, err := p.parseIntersectTerm()
+	if err != nil {
+		return nil, err
+	}
+	for p.check(TOKEN_UNION) || p.check(TOKEN_EXCEPT) {
+		op := types.SETOP_UNION
+		if p.advance().Type == TOKEN_EXCEPT {
+			op = types.SETOP_EXCEPT
+		}
+		all := p.parseSetQuantifier()
+		right, err := p.parseIntersectTerm()
+		if err != nil {
+			return nil, err
+		}
+		left = &types.SelectStmt{Op: op, All: all, Larg: left, Rarg: right}
+	}
+	return left, nil
+}
+
+func (p *Parser) parseIntersectTerm() (*types.SelectStmt, error) {
+	left, err := p.parseSelectPrimary()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept(TOKEN_INTERSECT) {
+		all := p.parseSetQuantifier()
+		right, err := p.parseSelectPrimary()
+		if err != nil {
+			return nil, err
+		}
+		left = &types.SelectStmt{Op: types.SETOP_INTERSECT, All: all, Larg: left, Rarg: right}
+	}
+	return left, nil
+}
+
+// parseSetQuantifier reads the optional ALL / DISTINCT after a set operator, true means ALL
+func (p *Parser) parseSetQuantifier() bool {
+	if p.accept(TOKEN_ALL) {
+		return true
+	}
+	p.accept(TOKEN_DISTINCT)
+	return false
+}
+
+func (p *Parser) parseSelectPrimary() (*types.SelectStmt, error) {
+	if p.accept(TOKEN_LPAREN) {
+		stmt, err := p.parseSelectStmt()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(TOKEN_RPAREN); err != nil {
+			return nil, err
+		}
+		return stmt, nil
+	}
+	return p.parseSimpleSelect()
+}
+
+/*
+SELECT [DISTINCT | ALL] target_list
+[FROM from_list]
+[WHERE expr]
+[GROUP BY expr_list]
+[HAVING expr]
+[WINDOW name AS window_specification {, name AS window_specification}]
+*/
+func (p *Parser) parseSimpleSelect() (*types.SelectStmt, error) {
+	if _, err := p.expect(TOKEN_SELECT); err != nil {
+		return nil, err
+	}
+	stmt := &types.SelectStmt{}
+
+	if p.accept(TOKEN_DISTINCT) {
+		stmt.Distinct = true
+	} else {
+		p.accept(TOKEN_ALL)
+	}
+
+	targetList, err := p.parseTargetList()
+	if err != nil {
+		return nil, err
+	}
+	stmt.TargetList = targetList
+
+	if p.accept(TOKEN_FROM) {
+		fromClause, err := p.parseFromList()
+		if err != nil {
+			return nil, err
+		}
+		stmt.FromClause = fromClause
+	}
+
+	if p.accept(TOKEN_WHERE) {
+		where, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		stmt.WhereClause = where
+	}
+
+	if p.accept(TOKEN_GROUP) {
+		if _, err := p.expect(TOKEN_BY); err != nil {
+			return nil, err
+		}
+		groupClause, err := p.parseExprList()
+		if err != nil {
+			return nil, err
+		}
+		stmt.GroupClause = groupClause
+	}
+
+	if p.accept(TOKEN_HAVING) {
+		having, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		stmt.HavingClause = having
+	}
+
+	if p.accept(TOKEN_WINDOW) {
+		for {
+			name, err := p.expectIdent()
+			if err != nil {
+				return nil, err
+			}
+			if _, err := p.expect(TOKEN_AS); err != nil {
+				return nil, err
+			}
+			windowDef, err := p.parseWindowSpecification()
+			if err != nil {
+				return nil, err
+			}
+			windowDef.Name = name.Value
+			windowDef.Location = name.Location
+			stmt.WindowClause = append(stmt.WindowClause, windowDef)
+			if !p.accept(TOKEN_COMMA) {
+				break
+			}
+		}
+	}
+
+	return stmt, nil
+}
+
+// sortby: expr [ASC | DESC] [NULLS {FIRST | LAST}]
+func (p *Parser) parseSortClause() ([]*types.SortBy, error) {
+	var sortClause []*types.SortBy
+	for {
+		location := p.current().Location
+		expr, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		sortBy := &types.SortBy{Node: expr, Location: location}
+
+		if p.accept(TOKEN_ASC) {
+			sortBy.SortbyDir = types.SORTBY_ASC
+		} else if p.accept(TOKEN_DESC) {
+			sortBy.SortbyDir = types.SORTBY_DESC
+		}
+
+		if p.accept(TOKEN_NULLS) {
+			if p.accept(TOKEN_FIRST) {
+				sortBy.SortbyNull = types.SORTBY_NULLS_FIRST
+			} else if p.accept(TOKEN_LAST) {
+				sortBy.SortbyNull = types.SORTBY_NULLS_LAST
+			} else {
+				return nil, p.syntaxError()
+			}
+		}
+		sortClause = append(sortClause, sortBy)
+
+		if !p.accept(TOKEN_COMMA) {
+			return sortClause, nil
+		}
+	}
+}
+
+// LIMIT and OFFSET can come in either order, each at most once
+func (p *Parser) parseLimitOffset(stmt *types.SelectStmt) error {
+	seenLimit, seenOffset := false, false
+	for {
+		switch {
+		case p.check(TOKEN_LIMIT) && !seenLimit:
+			p.advance()
+			seenLimit = true
+			if p.accept(TOKEN_ALL) {
+				continue
+			}
+			count, err := p.parseExpr()
+			if err != nil {
+				return err
+			}
+			stmt.LimitCount = count
+
+		case p.check(TOKEN_OFFSET) && !seenOffset:
+			p.advance()
+			seenOffset = true
+			offset, err := p.parseExpr()
+			if err != nil {
+				return err
+			}
+			stmt.LimitOffset = offset
+
+		default:
+			return nil
+		}
+	}
+}
+
+func (p *Parser) parseTargetList() ([]*types.ResTarget, error) {
+	var targets []*types.ResTarget
+	for {
+		target, err := p.parseTarget()
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, target)
+		if !p.accept(TOKEN_COMMA) {
+			return targets, nil
+		}
+	}
+}
+
+func (p *Parser) parseTarget() (*types.ResTarget, error) {
+	location := p.current().Location
+
+	if p.check(TOKEN_MULTIPLY) {
+		p.advance()
+		return &types.ResTarget{Val: &types.AStar{Location: location}, Location: location}, nil
+	}
+
+	val, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	target := &types.ResTarget{Val: val, Location: location}
+
+	if p.accept(TOKEN_AS) {
+		name, err := p.parseColLabel()
+		if err != nil {
+			return nil, err
+		}
+		target.Name = name
+	} else if p.checkIdent() {
+		target.Name = identName(p.advance())
+	}
+	return target, nil
+}
+
+// parseColLabel accepts any identifier or keyword, (SELECT 1 AS select is valid)
+func (p *Parser) parseColLabel() (string, error) {
+	tok := p.current()
+	if tok.Type == TOKEN_IDENT {
+		p.advance()
+		return tok.Value, nil
+	}
+	if name, isKeyword := keywordsReverse[tok.Type]; isKeyword {
+		p.advance()
+		return strings.ToLower(name), nil
+	}
+	return "", p.syntaxError()
+}
+
+func (p *Parser) parseFromList() ([]types.Node, error) {
+	var items []types.Node
+	for {
+		item, err := p.parseTableRef()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+		if !p.accept(TOKEN_COMMA) {
+			return items, nil
+		}
+	}
+}
+
+/*
+table_ref: qualified_name [[AS] alias] | (select) [[AS] alias [(column_alias, ...)]]
+table_ref: func_name '(' args ')' [[AS] alias [(column_alias, ...)]]
+table_ref: joined_table | '(' joined_table ')'
+
+joined_table: table_ref CROSS JOIN table_ref
+joined_table: table_ref [NATURAL] [INNER | {LEFT | RIGHT | FULL} [OUTER]] JOIN table_ref [ON expr | USING (name, ...)]
+Joins are left associative, a JOIN b JOIN c joins a and b first
+*/
+func (p *Parser) parseTableRef() (types.Node, error) {
+	item, err := p.parseTableRefPrimary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		join, cross, err := p.parseJoinType()
+		if err != nil || join == nil {
+			return item, err
+		}
+		join.Larg = item
+		if join.Rarg, err = p.parseTableRefPrimary(); err != nil {
+			return nil, err
+		}
+		if !cross && !join.IsNatural {
+			if err := p.parseJoinQual(join); err != nil {
+				return nil, err
+			}
+		}
+		item = join
+	}
+}
+
+// parseJoinType parses the keywords up to JOIN, nil when no join follows. cross is set for CROSS JOIN
+func (p *Parser) parseJoinType() (join *types.JoinExpr, cross bool, err error) {
+	join = &types.JoinExpr{JoinType: types.JOIN_INNER, Location: p.current().Location}
+	if p.accept(TOKEN_CROSS) {
+		if _, err := p.expect(TOKEN_JOIN); err != nil {
+			return nil, false, err
+		}
+		return join, true, nil
+	}
+	join.IsNatural = p.accept(TOKEN_NATURAL)
+	switch {
+	case p.accept(TOKEN_INNER):
+	case p.accept(TOKEN_LEFT):
+		join.JoinType = types.JOIN_LEFT
+		p.accept(TOKEN_OUTER)
+	case p.accept(TOKEN_RIGHT):
+		join.JoinType = types.JOIN_RIGHT
+		p.accept(TOKEN_OUTER)
+	case p.accept(TOKEN_FULL):
+		join.JoinType = types.JOIN_FULL
+		p.accept(TOKEN_OUTER)
+	case !join.IsNatural && !p.check(TOKEN_JOIN):
+		return nil, false, nil
+	}
+	if _, err := p.expect(TOKEN_JOIN); err != nil {
+		return nil, false, err
+	}
+	return join, false, nil
+}
+
+// parseJoinQual parses the ON or USING a join other than a CROSS or NATURAL one must have
+func (p *Parser) parseJoinQual(join *types.JoinExpr) error {
+	switch {
+	case p.accept(TOKEN_ON):
+		quals, err := p.parseExpr()
+		if err != nil {
+			return err
+		}
+		join.Quals = quals
+		return nil
+	case p.accept(TOKEN_USING):
+		if _, err := p.expect(TOKEN_LPAREN); err != nil {
+			return err
+		}
+		for {
+			colname, err := p.expectIdent()
+			if err != nil {
+				return err
+			}
+			join.UsingClause = append(join.UsingClause, colname.Value)
+			if !p.accept(TOKEN_COMMA) {
+				break
+			}
+		}
+		_, err := p.expect(TOKEN_RPAREN)
+		return err
+	}
+	return p.syntaxError()
+}
+
+func (p *Parser) parseTableRefPrimary() (types.Node, error) {
+	if p.check(TOKEN_LPAREN) && !startsSelect(p.peekToken()) {
+		p.advance()
+		item, err := p.parseTableRef()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(TOKEN_RPAREN); err != nil {
+			return nil, err
+		}
+		return item, nil
+	}
+	if p.check(TOKEN_LPAREN) {
+		return p.parseRangeSubselect()
+	}
+	if p.funcCallAhead() {
+		return p.parseRangeFunction()
+	}
+	rangeVar, err := p.parseQualifiedName()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.accept(TOKEN_AS) {
+		alias, err := p.expectIdent()
+		if err != nil {
+			return nil, err
+		}
+		rangeVar.Alias = alias.Value
+	} else if p.checkIdent() {
+		rangeVar.Alias = identName(p.advance())
+	}
+	return rangeVar, nil
+}
+
+func (p *Parser) parseRangeSubselect() (types.Node, error) {
+	location := p.current().Location
+	subquery, err := p.parseSubselect()
+	if err != nil {
+		return nil, err
+	}
+	rangeSubselect := &types.RangeSubselect{Subquery: subquery, Location: location}
+	rangeSubselect.Alias, rangeSubselect.ColNames, err = p.parseAliasClause()
+	if err != nil {
+		return nil, err
+	}
+	return rangeSubselect, nil
+}
+
+func (p *Parser) parseRangeFunction() (types.Node, error) {
+	location := p.current().Location
+	funcCall, err := p.parseFuncCall()
+	if err != nil {
+		return nil, err
+	}
+	rangeFunction := &types.RangeFunction{FuncCall: funcCall.(*types.FuncCall), Location: location}
+	rangeFunction.Alias, rangeFunction.ColNames, err = p.parseAliasClause()
+	if err != nil {
+		return nil, err
+	}
+	return rangeFunction, nil
+}
+
+// alias_clause: [AS] alias [(column_alias, ...)], the alias is empty when there is none
+func (p *Parser) parseAliasClause() (string, []string, error) {
+	var alias string
+	if p.accept(TOKEN_AS) {
+		tok, err := p.expectIdent()
+		if err != nil {
+			return "", nil, err
+		}
+		alias = tok.Value
+	} else if p.checkIdent() {
+		alias = identName(p.advance())
+	} else {
+		return "", nil, nil
+	}
+
+	var colnames []string
+	if p.accept(TOKEN_LPAREN) {
+		for {
+			colname, err := p.expectIdent()
+			if err != nil {
+				return "", nil, err
+			}
+			colnames = append(colnames, colname.Value)
+			if !p.accept(TOKEN_COMMA) {
+				break
+			}
+		}
+		if _, err := p.expect(TOKEN_RPAREN); err != nil {
+			return "", nil, err
+		}
+	}
+	return alias, colnames, nil
+}
+
+// startsSelect tells if a SELECT statement starts at tok
+func startsSelect(tok Token) bool {
+	return tok.Type == TOKEN_SELECT || tok.Type == TOKEN_WITH
+}
+
+// parseSubselect parses a parenthesized SELECT, as used by subqueries
+func (p *Parser) parseSubselect() (*types.SelectStmt, error) {
+	if _, err := p.expect(TOKEN_LPAREN); err != nil {
+		return nil, err
+	}
+	stmt, err := p.parseSelectStmt()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(TOKEN_RPAREN); err != nil {
+		return nil, err
+	}
+	return stmt, nil
+}
+
+func (p *Parser) parseExprList() ([]types.Node, error) {
+	var exprs []types.Node
+	for {
+		expr, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, expr)
+		if !p.accept(TOKEN_COMMA) {
+			return exprs, nil
+		}
+	}
+}
+
+func (p *Parser) parseExpr() (types.Node, error) {
+	return p.parseOr()
+}
+
+func (p *Parser) parseOr() (types.Node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.check(TOKEN_OR) {
+		location := p.advance().Location
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = makeBoolExpr(types.OR_EXPR, left, right, location)
+	}
+	return left, nil
+}
+
+func (p *Parser) parseAnd() (types.Node, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.check(TOKEN_AND) {
+		location := p.advance().Location
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = makeBoolExpr(types.AND_EXPR, left, right, location)
+	}
+	return left, nil
+}
+
+func (p *Parser) parseNot() (types.Node, error) {
+	if p.check(TOKEN_NOT) {
+		location := p.advance().Location
+		arg, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &types.BoolExpr{Boolop: types.NOT_EXPR, Args: []types.Node{arg}, Location: location}, nil
+	}
+	return p.parseIsExpr()
+}
+
+/*
+IS binds looser than the comparison operators, a = b IS NULL is (a = b) IS NULL:
+  - x IS [NOT] NULL
+  - x IS [NOT] TRUE / FALSE / UNKNOWN
+  - x IS [NOT] DISTINCT FROM y
+*/
+func (p *Parser) parseIsExpr() (types.Node, error) {
+	left, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+	for p.check(TOKEN_IS) {
+		location := p.advance().Location
+		negated := p.accept(TOKEN_NOT)
+		tok := p.current()
+		switch tok.Type {
+		case TOKEN_NULL:
+			p.advance()
+			nullTestType := types.IS_NULL
+			if negated {
+				nullTestType = types.IS_NOT_NULL
+			}
+			left = &types.NullTest{Arg: left, NullTestType: nullTestType, Location: location}
+		case TOKEN_TRUE, TOKEN_FALSE, TOKEN_UNKNOWN:
+			p.advance()
+			boolTestType := map[TokenType]types.BoolTestType{TOKEN_TRUE: types.IS_TRUE, TOKEN_FALSE: types.IS_FALSE, TOKEN_UNKNOWN: types.IS_UNKNOWN}[tok.Type]
+			if negated {
+				boolTestType++ //Every IS_X is followed by its IS_NOT_X
+			}
+			left = &types.BooleanTest{Arg: left, BoolTestType: boolTestType, Location: location}
+		case TOKEN_DISTINCT:
+			p.advance()
+			if _, err := p.expect(TOKEN_FROM); err != nil {
+				return nil, err
+			}
+			right, err := p.parseComparison()
+			if err != nil {
+				return nil, err
+			}
+			kind := types.AEXPR_DISTINCT
+			if negated {
+				kind = types.AEXPR_NOT_DISTINCT
+			}
+			left = &types.AExpr{Kind: kind, Name: "=", Lexpr: left, Rexpr: right, Location: location}
+		default:
+			return nil, p.syntaxError()
+		}
+	}
+	return left, nil
+}
+
+var comparisonOps = map[TokenType]string{
+	TOKEN_EQ: "=",
+	TOKEN_NE: "<>",
+	TOKEN_LT: "<",
+	TOKEN_LE: "<=",
+	TOKEN_GT: ">",
+	TOKEN_GE: ">=",
+}
+
+/*
+Comparison operators are non associative, a < b < c is a syntax error
+The right side can also be a subquery: a = ANY (SELECT ...), a > ALL (SELECT ...), SOME is ANY.
+Anything else in the parentheses is an array, a = ANY (ARRAY[1, 2])
+*/
+func (p *Parser) parseComparison() (types.Node, error) {
+	left, err := p.parseIn()
+	if err != nil {
+		return nil, err
+	}
+	if op, ok := comparisonOps[p.current().Type]; ok {
+		location := p.advance().Location
+		if p.check(TOKEN_ANY) || p.check(TOKEN_SOME) || p.check(TOKEN_ALL) {
+			all := p.advance().Type == TOKEN_ALL
+			if p.check(TOKEN_LPAREN) && startsSelect(p.peekToken()) {
+				subLinkType := types.ANY_SUBLINK
+				if all {
+					subLinkType = types.ALL_SUBLINK
+				}
+				subselect, err := p.parseSubselect()
+				if err != nil {
+					return nil, err
+				}
+				left = &types.SubLink{SubLinkType: subLinkType, Testexpr: left, OperName: op, Subselect: subselect, Location: location}
+			} else {
+				if _, err := p.expect(TOKEN_LPAREN); err != nil {
+					return nil, err
+				}
+				array, err := p.parseExpr()
+				if err != nil {
+					return nil, err
+				}
+				if _, err := p.expect(TOKEN_RPAREN); err != nil {
+					return nil, err
+				}
+				kind := types.AEXPR_OP_ANY
+				if all {
+					kind = types.AEXPR_OP_ALL
+				}
+				left = &types.AExpr{Kind: kind, Name: op, Lexpr: left, Rexpr: array, Location: location}
+			}
+		} else {
+			right, err := p.parseIn()
+			if err != nil {
+				return nil, err
+			}
+			left = makeAExpr(op, left, right, location)
+		}
+		if _, ok := comparisonOps[p.current().Type]; ok {
+			return nil, p.syntaxError()
+		}
+	}
+	return left, nil
+}
+
+/*
+a [NOT] IN (SELECT ...) is a SubLink, a [NOT] IN (x, y, z) becomes a = x OR a = y OR a = z
+(a <> x AND a <> y AND a <> z for NOT IN), which is how postgres evaluates an IN list too
+NOT IN (SELECT ...) is NOT (a = ANY (SELECT ...))
+*/
+func (p *Parser) parseIn() (types.Node, error) {
+	left, err := p.parseOther()
+	if err != nil {
+		return nil, err
+	}
+	if p.startsPatternMatch() {
+		return p.parsePatternMatch(left)
+	}
+	if !p.check(TOKEN_IN) && !(p.check(TOKEN_NOT) && p.peekToken().Type == TOKEN_IN) {
+		return left, nil
+	}
+	negated := p.accept(TOKEN_NOT)
+	location := p.advance().Location
+
+	var result types.Node
+	if p.check(TOKEN_LPAREN) && startsSelect(p.peekToken()) {
+		subselect, err := p.parseSubselect()
+		if err != nil {
+			return nil, err
+		}
+		result = &types.SubLink{SubLinkType: types.ANY_SUBLINK, Testexpr: left, OperName: "=", Subselect: subselect, Location: location}
+		if negated {
+			result = &types.BoolExpr{Boolop: types.NOT_EXPR, Args: []types.Node{result}, Location: location}
+		}
+		return result, nil
+	}
+
+	if _, err := p.expect(TOKEN_LPAREN); err != nil {
+		return nil, err
+	}
+	items, err := p.parseExprList()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(TOKEN_RPAREN); err != nil {
+		return nil, err
+	}
+	op, boolop := "=", types.OR_EXPR
+	if negated {
+		op, boolop = "<>", types.AND_EXPR
+	}
+	for _, item := range items {
+		cmp := makeAExpr(op, left, item, location)
+		if result == nil {
+			result = cmp
+		} else {
+			result = makeBoolExpr(boolop, result, cmp, location)
+		}
+	}
+	return result, nil
+}
+
+func (p *Parser) startsPatternMatch() bool {
+	isPatternKeyword := func(tokenType TokenType) bool {
+		return tokenType == TOKEN_LIKE || tokenType == TOKEN_ILIKE || tokenType == TOKEN_SIMILAR
+	}
+	return isPatternKeyword(p.current().Type) || p.check(TOKEN_NOT) && isPatternKeyword(p.peekToken().Type)
+}
+
+/*
+a [NOT] LIKE p [ESCAPE e] is the operator ~~ (!~~), ILIKE is ~~* (!~~*). With ESCAPE the pattern is
+like_escape(p, e). a [NOT] SIMILAR TO p [ESCAPE e] is a ~ similar_to_escape(p [, e]), a regular expression
+match (Same as postgres)
+*/
+func (p *Parser) parsePatternMatch(left types.Node) (types.Node, error) {
+	negated := p.accept(TOKEN_NOT)
+	tok := p.advance()
+	if tok.Type == TOKEN_SIMILAR {
+		if _, err := p.expect(TOKEN_TO); err != nil {
+			return nil, err
+		}
+	}
+	pattern, err := p.parseOther()
+	if err != nil {
+		return nil, err
+	}
+	args := []types.Node{pattern}
+	if p.accept(TOKEN_ESCAPE) {
+		escape, err := p.parseOther()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, escape)
+	}
+
+	var op string
+	switch tok.Type {
+	case TOKEN_LIKE:
+		op = "~~"
+	case TOKEN_ILIKE:
+		op = "~~*"
+	case TOKEN_SIMILAR:
+		op = "~"
+		pattern = &types.FuncCall{Funcname: "similar_to_escape", Args: args, Location: tok.Location}
+	}
+	if tok.Type != TOKEN_SIMILAR && len(args) > 1 {
+		pattern = &types.FuncCall{Funcname: "like_escape", Args: args, Location: tok.Location}
+	}
+	if negated {
+		op = "!" + op
+	}
+	return makeAExpr(op, left, pattern, tok.Location), nil
+}
+
+// parseOther handles operators without special precedence, || and the json operators
+func (p *Parser) parseOther() (types.Node, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	for p.check(TOKEN_CONCAT) || p.check(TOKEN_OP) {
+		tok := p.advance()
+		right, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		left = makeAExpr(tok.Value, left, right, tok.Location)
+	}
+	return left, nil
+}
+
+func (p *Parser) parseAdditive() (types.Node, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for p.check(TOKEN_PLUS) || p.check(TOKEN_MINUS) {
+		tok := p.advance()
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = makeAExpr(tok.Value, left, right, tok.Location)
+	}
+	return left, nil
+}
+
+func (p *Parser) parseMultiplicative() (types.Node, error) {
+	left, err := p.parseExponent()
+	if err != nil {
+		return nil, err
+	}
+	for p.check(TOKEN_MULTIPLY) || p.check(TOKEN_DIVIDE) || p.check(TOKEN_MODULO) {
+		tok := p.advance()
+		right, err := p.parseExponent()
+		if err != nil {
+			return nil, err
+		}
+		left = makeAExpr(tok.Value, left, right, tok.Location)
+	}
+	return left, nil
+}
+
+// ^ is left associative in postgres, 2 ^ 3 ^ 2 is 64
+func (p *Parser) parseExponent() (types.Node, error) {
+	left, err := p.parseAtTimeZone()
+	if err != nil {
+		return nil, err
+	}
+	for p.check(TOKEN_POWER) {
+		location := p.advance().Location
+		right, err := p.parseAtTimeZone()
+		if err != nil {
+			return nil, err
+		}
+		left = makeAExpr("^", left, right, location)
+	}
+	return left, nil
+}
+
+/*
+expr AT TIME ZONE zone is the function call timezone(zone, expr), AT binds tighter than ^ but
+looser than unary minus. AT alone is still a column label, SELECT x at
+*/
+func (p *Parser) parseAtTimeZone() (types.Node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.check(TOKEN_AT) && p.peekToken().Type == TOKEN_TIME {
+		location := p.advance().Location
+		p.advance()
+		if _, err := p.expect(TOKEN_ZONE); err != nil {
+			return nil, err
+		}
+		zone, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &types.FuncCall{Funcname: "timezone", Args: []types.Node{zone, left}, Location: location}
+	}
+	return left, nil
+}
+
+func (p *Parser) parseUnary() (types.Node, error) {
+	if p.check(TOKEN_MINUS) || p.check(TOKEN_PLUS) {
+		tok := p.advance()
+		//-9223372036854775808 is a bigint although 9223372036854775808 alone is too big for one
+		if next := p.current(); tok.Type == TOKEN_MINUS && next.Type == TOKEN_FCONST {
+			if value, err := strconv.ParseInt("-"+next.Value, 10, 64); err == nil {
+				p.advance()
+				return &types.AConst{Val: value, Location: tok.Location}, nil
+			}
+		}
+		arg, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		//Fold negative literals right away so -9223372036854775808 style constants stay constants
+		if c, ok := arg.(*types.AConst); ok && tok.Type == TOKEN_MINUS {
+			switch v := c.Val.(type) {
+			case int64:
+				return &types.AConst{Val: -v, Location: tok.Location}, nil
+			case float64:
+				return &types.AConst{Val: -v, Location: tok.Location}, nil
+			case adt.Numeric:
+				return &types.AConst{Val: v.Neg(), Location: tok.Location}, nil
+			}
+		}
+		if tok.Type == TOKEN_PLUS {
+			return arg, nil
+		}
+		return makeAExpr("-", nil, arg, tok.Location), nil
+	}
+	return p.parseTypecast()
+}
+
+// expr::type, binds tighter than any operator. -1::text is -(1::text)
+func (p *Parser) parseTypecast() (types.Node, error) {
+	expr, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for p.check(TOKEN_TYPECAST) {
+		location := p.advance().Location
+		typeName, err := p.parseTypeName()
+		if err != nil {
+			return nil, err
+		}
+		expr = &types.TypeCast{Arg: expr, TypeName: typeName, Location: location}
+	}
+	return expr, nil
+}
+
+func (p *Parser) parsePrimary() (types.Node, error) {
+	tok := p.current()
+
+	switch tok.Type {
+	case TOKEN_ICONST:
+		p.advance()
+		return &types.AConst{Val: tok.IntVal, Location: tok.Location}, nil
+
+	case TOKEN_FCONST:
+		p.advance()
+		value, err := adt.ParseNumeric(tok.Value)
+		if err != nil {
+			return nil, fmt.Errorf("%v at position %d", err, tok.Location)
+		}
+		return &types.AConst{Val: value, Location: tok.Location}, nil
+
+	case TOKEN_SCONST:
+		p.advance()
+		return &types.AConst{Val: tok.Value, Location: tok.Location}, nil
+
+	case TOKEN_TRUE, TOKEN_FALSE:
+		p.advance()
+		return &types.AConst{Val: tok.Type == TOKEN_TRUE, Location: tok.Location}, nil
+
+	case TOKEN_NULL:
+		p.advance()
+		return &types.AConst{Val: nil, Location: tok.Location}, nil
+
+	case TOKEN_LPAREN:
+		if startsSelect(p.peekToken()) {
+			subselect, err := p.parseSubselect()
+			if err != nil {
+				return nil, err
+			}
+			return &types.SubLink{SubLinkType: types.EXPR_SUBLINK, Subselect: subselect, Location: tok.Location}, nil
+		}
+		p.advance()
+		expr, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(TOKEN_RPAREN); err != nil {
+			return nil, err
+		}
+		return p.parseIndirection(expr)
+
+	case TOKEN_ARRAY:
+		p.advance()
+		if !p.check(TOKEN_LBRACKET) {
+			return nil, p.syntaxError()
+		}
+		return p.parseArrayExpr(tok.Location)
+
+	case TOKEN_EXISTS:
+		p.advance()
+		subselect, err := p.parseSubselect()
+		if err != nil {
+			return nil, err
+		}
+		return &types.SubLink{SubLinkType: types.EXISTS_SUBLINK, Subselect: subselect, Location: tok.Location}, nil
+
+	case TOKEN_EXTRACT:
+		return p.parseExtract()
+
+	case TOKEN_CAST:
+		return p.parseCast()
+
+	case TOKEN_CASE:
+		return p.parseCase()
+
+	case TOKEN_SUBSTRING:
+		return p.parseSubstring()
+
+	case TOKEN_POSITION:
+		return p.parsePosition()
+
+	case TOKEN_OVERLAY:
+		return p.parseOverlay()
+
+	case TOKEN_TRIM:
+		return p.parseTrim()
+
+	case TOKEN_COALESCE, TOKEN_GREATEST, TOKEN_LEAST:
+		p.advance()
+		args, err := p.parseParenExprList()
+		if err != nil {
+			return nil, err
+		}
+		switch tok.Type {
+		case TOKEN_COALESCE:
+			return &types.CoalesceExpr{Args: args, Location: tok.Location}, nil
+		case TOKEN_GREATEST:
+			return &types.MinMaxExpr{Op: types.IS_GREATEST, Args: args, Location: tok.Location}, nil
+		}
+		return &types.MinMaxExpr{Op: types.IS_LEAST, Args: args, Location: tok.Location}, nil
+
+	case TOKEN_NULLIF:
+		p.advance()
+		args, err := p.parseParenExprList()
+		if err != nil {
+			return nil, err
+		}
+		if len(args) != 2 {
+			return nil, fmt.Errorf("syntax error at or near \"NULLIF\" at position %d", tok.Location)
+		}
+		return &types.AExpr{Kind: types.AEXPR_NULLIF, Name: "=", Lexpr: args[0], Rexpr: args[1], Location: tok.Location}, nil
+	}
+
+	if p.checkIdent() {
+		switch {
+		case tok.Type == TOKEN_IDENT && sqlValueFunctions[tok.Value] && p.peekToken().Type != TOKEN_LPAREN:
+			//current_date and friends are written without parentheses
+			p.advance()
+			return &types.FuncCall{Funcname: tok.Value, Location: tok.Location}, nil
+		case p.typedLiteralAhead():
+			//Typed literal, type_name 'string'
+			typeName, err := p.parseTypeName()
+			if err != nil {
+				return nil, err
+			}
+			str := p.advance()
+			return &types.TypeCast{
+				Arg:      &types.AConst{Val: str.Value, Location: str.Location},
+				TypeName: typeName,
+				Location: typeName.Location,
+			}, nil
+		case p.funcCallAhead():
+			return p.parseFuncCall()
+		}
+		columnRef, err := p.parseColumnRef()
+		if err != nil {
+			return nil, err
+		}
+		if _, isStar := columnRef.(*types.AStar); isStar {
+			return columnRef, nil
+		}
+		return p.parseIndirection(columnRef)
+	}
+	return nil, p.syntaxError()
+}
+
+/*
+array_expr: '[' [expr_list | array_expr_list] ']', the part of ARRAY[...] after the keyword
+The elements are either all expressions or all bracketed lists themselves, ARRAY[[1, 2], [3, 4]]
+*/
+func (p *Parser) parseArrayExpr(location int) (types.Node, error) {
+	p.advance() //Skip '['
+	arrayExpr := &types.AArrayExpr{Location: location}
+	if p.accept(TOKEN_RBRACKET) {
+		return arrayExpr, nil
+	}
+	nested := p.check(TOKEN_LBRACKET)
+	for {
+		var elem types.Node
+		var err error
+		if nested {
+			if !p.check(TOKEN_LBRACKET) {
+				return nil, p.syntaxError()
+			}
+			elem, err = p.parseArrayExpr(p.current().Location)
+		} else {
+			elem, err = p.parseExpr()
+		}
+		if err != nil {
+			return nil, err
+		}
+		arrayExpr.Elements = append(arrayExpr.Elements, elem)
+		if !p.accept(TOKEN_COMMA) {
+			break
+		}
+	}
+	if _, err := p.expect(TOKEN_RBRACKET); err != nil {
+		return nil, err
+	}
+	return arrayExpr, nil
+}
+
+/*
+indirection: {'[' expr ']' | '[' [expr] ':' [expr] ']'} ...
+Subscripts of a column or a parenthesized expression, a[1], (ARRAY[1, 2, 3])[2:]
+*/
+func (p *Parser) parseIndirection(arg types.Node) (types.Node, error) {
+	if !p.check(TOKEN_LBRACKET) {
+		return arg, nil
+	}
+	indirection := &types.AIndirection{Arg: arg}
+	for p.check(TOKEN_LBRACKET) {
+		indices := &types.AIndices{Location: p.advance().Location}
+		var first types.Node
+		if !p.check(TOKEN_COLON) {
+			expr, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			first = expr
+		}
+		if p.accept(TOKEN_COLON) {
+			indices.IsSlice, indices.Lidx = true, first
+			if !p.check(TOKEN_RBRACKET) {
+				expr, err := p.parseExpr()
+				if err != nil {
+					return nil, err
+				}
+				indices.Uidx = expr
+			}
+		} else {
+			indices.Uidx = first
+		}
+		if _, err := p.expect(TOKEN_RBRACKET); err != nil {
+			return nil, err
+		}
+		indirection.Indirection = append(indirection.Indirection, indices)
+	}
+	return indirection, nil
+}
+
+/*
+typeName: name ['(' integer {, integer} ')'] | DOUBLE PRECISION
+typeName: {TIMESTAMP | TIME} ['(' integer ')'] [{WITH | WITHOUT} TIME ZONE]
+Either can be followed by array bounds, name[] or name[3]
+The integers are the type modifiers, numeric(10, 2). The SQL spelled names are turned into the names
+the type registry knows them by, timestamp(3) with time zone is "timestamp with time zone" with typmod 3
+*/
+func (p *Parser) parseTypeName() (*types.TypeName, error) {
+	nameTok, err := p.expectIdent()
+	if err != nil {
+		return nil, err
+	}
+	typeName := &types.TypeName{Name: nameTok.Value, Location: nameTok.Location}
+	//The types are all in pg_catalog, any other schema names a type that does not exist
+	if p.accept(TOKEN_DOT) {
+		tok, err := p.expectIdent()
+		if err != nil {
+			return nil, err
+		}
+		if typeName.Name == "pg_catalog" {
+			typeName.Name = tok.Value
+		} else {
+			typeName.Name += "." + tok.Value
+		}
+	}
+	if typeName.Name == "double" && p.check(TOKEN_IDENT) && p.current().Value == "precision" {
+		p.advance()
+		typeName.Name = "double precision"
+	}
+	if p.accept(TOKEN_LPAREN) {
+		for {
+			negative := p.accept(TOKEN_MINUS)
+			tok, err := p.expect(TOKEN_ICONST)
+			if err != nil {
+				return nil, err
+			}
+			if negative {
+				tok.IntVal = -tok.IntVal
+			}
+			typeName.Typmods = append(typeName.Typmods, tok.IntVal)
+			if !p.accept(TOKEN_COMMA) {
+				break
+			}
+		}
+		if _, err := p.expect(TOKEN_RPAREN); err != nil {
+			return nil, err
+		}
+	}
+
+	if typeName.Name == "timestamp" || typeName.Name == "time" {
+		withZone := p.check(TOKEN_WITH)
+		if withZone || (p.check(TOKEN_IDENT) && p.current().Value == "without") {
+			p.advance()
+			if _, err := p.expect(TOKEN_TIME); err != nil {
+				return nil, err
+			}
+			if _, err := p.expect(TOKEN_ZONE); err != nil {
+				return nil, err
+			}
+			if withZone {
+				typeName.Name += " with time zone"
+			} else {
+				typeName.Name += " without time zone"
+			}
+		}
+	}
+
+	//Array bounds are only decoration, int[3][3] is int[] as in postgres
+	isArray := false
+	for p.accept(TOKEN_LBRACKET) {
+		p.accept(TOKEN_ICONST)
+		if _, err := p.expect(TOKEN_RBRACKET); err != nil {
+			return nil, err
+		}
+		isArray = true
+	}
+	if isArray {
+		typeName.Name += "[]"
+	}
+	return typeName, nil
+}
+
+/*
+typedLiteralAhead tells if a type name followed by a string starts at the current token,
+numeric(10, 2) '1.5' and timestamp with time zone '...' are typed literals where numeric(10, 2)
+alone would be a function call. It tries to parse the type name and backs up again
+*/
+func (p *Parser) typedLiteralAhead() bool {
+	start := p.pos
+	defer func() { p.pos = start }()
+	if _, err := p.parseTypeName(); err != nil {
+		return false
+	}
+	return p.check(TOKEN_SCONST)
+}
+
+// funcCallAhead tells whether a function call starts at the current token
+func (p *Parser) funcCallAhead() bool {
+	start := p.pos
+	defer func() { p.pos = start }()
+	if _, err := p.parseFuncName(); err != nil {
+		return false
+	}
+	return p.check(TOKEN_LPAREN)
+}
+
+/*
+func_name: name | schema_name '.' name
+The functions are all in pg_catalog, a call qualified with any other schema is left to fail as a function that does not exist
+*/
+func (p *Parser) parseFuncName() (*types.FuncCall, error) {
+	name, err := p.expectIdent()
+	if err != nil {
+		return nil, err
+	}
+	funcCall := &types.FuncCall{Funcname: name.Value, Location: name.Location}
+	if p.accept(TOKEN_DOT) {
+		tok, err := p.expectIdent()
+		if err != nil {
+			return nil, err
+		}
+		if funcCall.Funcname == "pg_catalog" {
+			funcCall.Funcname = tok.Value
+		} else {
+			funcCall.Funcname += "." + tok.Value
+		}
+	}
+	return funcCall, nil
+}
+
+// The SQL standard's functions that are called without parentheses
+var sqlValueFunctions = map[string]bool{
+	"current_date":      true,
+	"current_timestamp": true,
+	"localtimestamp":    true,
+	"localtime":         true,
+}
+
+/*
+EXTRACT '(' field FROM expr ')'
+The field is a name or a string and becomes the first argument of the function extract, the unit
+is checked when the call runs
+*/
+func (p *Parser) parseExtract() (types.Node, error) {
+	location := p.advance().Location
+	if _, err := p.expect(TOKEN_LPAREN); err != nil {
+		return nil, err
+	}
+	fieldTok := p.current()
+	var field string
+	switch {
+	case fieldTok.Type == TOKEN_SCONST:
+		field = fieldTok.Value
+	case fieldTok.Type == TOKEN_IDENT, keywordsReverse[fieldTok.Type] != "":
+		field = identName(fieldTok)
+	default:
+		return nil, p.syntaxError()
+	}
+	p.advance()
+	if _, err := p.expect(TOKEN_FROM); err != nil {
+		return nil, err
+	}
+	source, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(TOKEN_RPAREN); err != nil {
+		return nil, err
+	}
+	return &types.FuncCall{
+		Funcname: "extract",
+		Args:     []types.Node{&types.AConst{Val: field, Location: fieldTok.Location}, source},
+		Location: location,
+	}, nil
+}
+
+// CAST '(' expr AS type_name ')'
+func (p *Parser) parseCast() (types.Node, error) {
+	location := p.advance().Location
+	if _, err := p.expect(TOKEN_LPAREN); err != nil {
+		return nil, err
+	}
+	arg, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(TOKEN_AS); err != nil {
+		return nil, err
+	}
+	typeName, err := p.parseTypeName()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(TOKEN_RPAREN); err != nil {
+		return nil, err
+	}
+	return &types.TypeCast{Arg: arg, TypeName: typeName, Location: location}, nil
+}
+
+/*
+case_expr: CASE [expr] when_clause [when_clause ...] [ELSE expr] END
+when_clause: WHEN expr THEN expr
+Without the expression after CASE each WHEN is a condition, with it a value compared to the expression
+*/
+func (p *Parser) parseCase() (types.Node, error) {
+	location := p.advance().Location
+	caseExpr := &types.CaseExpr{Location: location}
+	if !p.check(TOKEN_WHEN) {
+		arg, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		caseExpr.Arg = arg
+	}
+	if !p.check(TOKEN_WHEN) {
+		return nil, p.syntaxError()
+	}
+	for p.check(TOKEN_WHEN) {
+		whenLocation := p.advance().Location
+		expr, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(TOKEN_THEN); err != nil {
+			return nil, err
+		}
+		result, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		caseExpr.Args = append(caseExpr.Args, &types.CaseWhen{Expr: expr, Result: result, Location: whenLocation})
+	}
+	if p.accept(TOKEN_ELSE) {
+		defresult, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		caseExpr.Defresult = defresult
+	}
+	if _, err := p.expect(TOKEN_END); err != nil {
+		return nil, err
+	}
+	return caseExpr, nil
+}
+
+// parseParenExprList parses '(' expr_list ')'
+func (p *Parser) parseParenExprList() ([]types.Node, error) {
+	if _, err := p.expect(TOKEN_LPAREN); err != nil {
+		return nil, err
+	}
+	args, err := p.parseExprList()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(TOKEN_RPAREN); err != nil {
+		return nil, err
+	}
+	return args, nil
+}
+
+/*
+SUBSTRING(x FROM start [FOR count]), SUBSTRING(x FOR count [FROM start]) or the plain SUBSTRING(x, start [, count])
+All of them are calls of substring, a count without a start starts at 1
+*/
+func (p *Parser) parseSubstring() (types.Node, error) {
+	location := p.advance().Location
+	if _, err := p.expect(TOKEN_LPAREN); err != nil {
+		return nil, err
+	}
+	source, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	args := []types.Node{source}
+	switch {
+	case p.check(TOKEN_COMMA):
+		p.advance()
+		rest, err := p.parseExprList()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, rest...)
+	case p.check(TOKEN_FROM), p.check(TOKEN_FOR):
+		var start, count types.Node
+		for p.check(TOKEN_FROM) && start == nil || p.check(TOKEN_FOR) && count == nil {
+			isFrom := p.advance().Type == TOKEN_FROM
+			expr, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			if isFrom {
+				start = expr
+			} else {
+				count = expr
+			}
+		}
+		if start == nil {
+			start = &types.AConst{Val: int64(1), Location: -1}
+		}
+		args = append(args, start)
+		if count != nil {
+			args = append(args, count)
+		}
+	}
+	if _, err := p.expect(TOKEN_RPAREN); err != nil {
+		return nil, err
+	}
+	return &types.FuncCall{Funcname: "substring", Args: args, Location: location}, nil
+}
+
+/*
+POSITION(substring IN string) is position(string, substring)
+The substring is parsed below IN, so it cannot be an IN list itself
+*/
+func (p *Parser) parsePosition() (types.Node, error) {
+	location := p.advance().Location
+	if _, err := p.expect(TOKEN_LPAREN); err != nil {
+		return nil, err
+	}
+	search, err := p.parseOther()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(TOKEN_IN); err != nil {
+		return nil, err
+	}
+	source, err := p.parseOther()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(TOKEN_RPAREN); err != nil {
+		return nil, err
+	}
+	return &types.FuncCall{Funcname: "position", Args: []types.Node{source, search}, Location: location}, nil
+}
+
+// OVERLAY(x PLACING y FROM start [FOR count]) is overlay(x, y, start [, count]), the plain call form works too
+func (p *Parser) parseOverlay() (types.Node, error) {
+	location := p.advance().Location
+	if _, err := p.expect(TOKEN_LPAREN); err != nil {
+		return nil, err
+	}
+	source, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	args := []types.Node{source}
+	if p.accept(TOKEN_COMMA) {
+		rest, err := p.parseExprList()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, rest...)
+	} else {
+		for _, keyword := range []TokenType{TOKEN_PLACING, TOKEN_FROM, TOKEN_FOR} {
+			if keyword == TOKEN_FOR && !p.check(TOKEN_FOR) {
+				break
+			}
+			if _, err := p.expect(keyword); err != nil {
+				return nil, err
+			}
+			expr, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, expr)
+		}
+	}
+	if _, err := p.expect(TOKEN_RPAREN); err != nil {
+		return nil, err
+	}
+	return &types.FuncCall{Funcname: "overlay", Args: args, Location: location}, nil
+}
+
+/*
+TRIM([BOTH | LEADING | TRAILING] [characters] FROM string) or TRIM([BOTH | LEADING | TRAILING] string [, characters])
+Calls btrim, ltrim or rtrim with the string first. Without characters spaces are trimmed
+*/
+func (p *Parser) parseTrim() (types.Node, error) {
+	location := p.advance().Location
+	if _, err := p.expect(TOKEN_LPAREN); err != nil {
+		return nil, err
+	}
+	funcname := "btrim"
+	switch {
+	case p.accept(TOKEN_LEADING):
+		funcname = "ltrim"
+	case p.accept(TOKEN_TRAILING):
+		funcname = "rtrim"
+	default:
+		p.accept(TOKEN_BOTH)
+	}
+
+	var args []types.Node
+	if p.accept(TOKEN_FROM) {
+		list, err := p.parseExprList()
+		if err != nil {
+			return nil, err
+		}
+		args = list
+	} else {
+		list, err := p.parseExprList()
+		if err != nil {
+			return nil, err
+		}
+		args = list
+		if len(list) == 1 && p.accept(TOKEN_FROM) {
+			sources, err := p.parseExprList()
+			if err != nil {
+				return nil, err
+			}
+			args = append(sources, list[0])
+		}
+	}
+	if _, err := p.expect(TOKEN_RPAREN); err != nil {
+		return nil, err
+	}
+	return &types.FuncCall{Funcname: funcname, Args: args, Location: location}, nil
+}
+
+// parseColumnRef parses name, rel.name or rel.*
+func (p *Parser) parseColumnRef() (types.Node, error) {
+	tok := p.advance()
+	fields := []string{identName(tok)}
+
+	for p.check(TOKEN_DOT) {
+		p.advance()
+		if p.check(TOKEN_MULTIPLY) {
+			p.advance()
+			if len(fields) != 1 {
+				return nil, fmt.Errorf("improper qualified name (too many dotted names) at position %d", tok.Location)
+			}
+			return &types.AStar{Relname: fields[0], Location: tok.Location}, nil
+		}
+		field, err := p.expectIdent()
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, field.Value)
+	}
+	return &types.ColumnRef{Fields: fields, Location: tok.Location}, nil
+}
+
+/*
+func_name '(' [DISTINCT | ALL] args ')' [FILTER '(' WHERE expr ')'] [OVER {window_name | window_specification}]
+func_name '(' '*' ')' [FILTER '(' WHERE expr ')'] [OVER {window_name | window_specification}]
+*/
+func (p *Parser) parseFuncCall() (types.Node, error) {
+	funcCall, err := p.parseFuncName()
+	if err != nil {
+		return nil, err
+	}
+	p.advance() //Skip '('
+
+	if p.check(TOKEN_MULTIPLY) {
+		p.advance()
+		funcCall.AggStar = true
+	} else if !p.check(TOKEN_RPAREN) {
+		if p.accept(TOKEN_DISTINCT) {
+			funcCall.AggDistinct = true
+		} else {
+			p.accept(TOKEN_ALL)
+		}
+		args, err := p.parseExprList()
+		if err != nil {
+			return nil, err
+		}
+		funcCall.Args = args
+	}
+	if _, err := p.expect(TOKEN_RPAREN); err != nil {
+		return nil, err
+	}
+
+	if p.accept(TOKEN_FILTER) {
+		if _, err := p.expect(TOKEN_LPAREN); err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(TOKEN_WHERE); err != nil {
+			return nil, err
+		}
+		filter, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(TOKEN_RPAREN); err != nil {
+			return nil, err
+		}
+		funcCall.AggFilter = filter
+	}
+
+	if p.check(TOKEN_OVER) {
+		location := p.advance().Location
+		if p.checkIdent() {
+			name := p.advance()
+			funcCall.Over = &types.WindowDef{Name: identName(name), Location: name.Location}
+			return funcCall, nil
+		}
+		over, err := p.parseWindowSpecification()
+		if err != nil {
+			return nil, err
+		}
+		over.Location = location
+		funcCall.Over = over
+	}
+	return funcCall, nil
+}
+
+/*
+window_specification: '(' [existing_window_name] [PARTITION BY expr_list] [ORDER BY sortby_list] [frame_clause] ')'
+frame_clause: {RANGE | ROWS | GROUPS} {frame_bound | BETWEEN frame_bound AND frame_bound} [frame_exclusion]
+frame_exclusion: EXCLUDE {CURRENT ROW | GROUP | TIES | NO OTHERS}
+
+The name of an existing window cannot be one of the keywords that can start the rest
+*/
+func (p *Parser) parseWindowSpecification() (*types.WindowDef, error) {
+	if _, err := p.expect(TOKEN_LPAREN); err != nil {
+		return nil, err
+	}
+	windowDef := &types.WindowDef{FrameOptions: types.FRAMEOPTION_DEFAULTS}
+
+	switch p.current().Type {
+	case TOKEN_PARTITION, TOKEN_ROWS, TOKEN_RANGE, TOKEN_GROUPS:
+	default:
+		if p.checkIdent() {
+			windowDef.Refname = identName(p.advance())
+		}
+	}
+
+	if p.accept(TOKEN_PARTITION) {
+		if _, err := p.expect(TOKEN_BY); err != nil {
+			return nil, err
+		}
+		partitionClause, err := p.parseExprList()
+		if err != nil {
+			return nil, err
+		}
+		windowDef.PartitionClause = partitionClause
+	}
+
+	if p.accept(TOKEN_ORDER) {
+		if _, err := p.expect(TOKEN_BY); err != nil {
+			return nil, err
+		}
+		orderClause, err := p.parseSortClause()
+		if err != nil {
+			return nil, err
+		}
+		windowDef.OrderClause = orderClause
+	}
+
+	if p.check(TOKEN_RANGE) || p.check(TOKEN_ROWS) || p.check(TOKEN_GROUPS) {
+		if err := p.parseFrameClause(windowDef); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := p.expect(TOKEN_RPAREN); err != nil {
+		return nil, err
+	}
+	return windowDef, nil
+}
+
+func (p *Parser) parseFrameClause(windowDef *types.WindowDef) error {
+	options := types.FRAMEOPTION_NONDEFAULT
+	switch p.advance().Type {
+	case TOKEN_RANGE:
+		options |= types.FRAMEOPTION_RANGE
+	case TOKEN_ROWS:
+		options |= types.FRAMEOPTION_ROWS
+	default:
+		options |= types.FRAMEOPTION_GROUPS
+	}
+
+	location := p.current().Location
+	if p.accept(TOKEN_BETWEEN) {
+		startOptions, startOffset, err := p.parseFrameBound()
+		if err != nil {
+			return err
+		}
+		if _, err := p.expect(TOKEN_AND); err != nil {
+			return err
+		}
+		endLocation := p.current().Location
+		endOptions, endOffset, err := p.parseFrameBound()
+		if err != nil {
+			return err
+		}
+
+		//The END bits are the START bits shifted left by one
+		switch {
+		case startOptions&types.FRAMEOPTION_START_UNBOUNDED_FOLLOWING != 0:
+			return fmt.Errorf("frame start cannot be UNBOUNDED FOLLOWING at position %d", location)
+		case endOptions&types.FRAMEOPTION_START_UNBOUNDED_PRECEDING != 0:
+			return fmt.Errorf("frame end cannot be UNBOUNDED PRECEDING at position %d", endLocation)
+		case startOptions&types.FRAMEOPTION_START_CURRENT_ROW != 0 && endOptions&types.FRAMEOPTION_START_OFFSET_PRECEDING != 0:
+			return fmt.Errorf("frame starting from current row cannot have preceding rows at position %d", endLocation)
+		case startOptions&types.FRAMEOPTION_START_OFFSET_FOLLOWING != 0 &&
+			endOptions&(types.FRAMEOPTION_START_OFFSET_PRECEDING|types.FRAMEOPTION_START_CURRENT_ROW) != 0:
+			return fmt.Errorf("frame starting from following row cannot have preceding rows at position %d", endLocation)
+		}
+		options |= types.FRAMEOPTION_BETWEEN | startOptions | endOptions<<1
+		windowDef.StartOffset, windowDef.EndOffset = startOffset, endOffset
+	} else {
+		//A single bound is the start, the frame ends at the current row
+		startOptions, startOffset, err := p.parseFrameBound()
+		if err != nil {
+			return err
+		}
+		switch {
+		case startOptions&types.FRAMEOPTION_START_UNBOUNDED_FOLLOWING != 0:
+			return fmt.Errorf("frame start cannot be UNBOUNDED FOLLOWING at position %d", location)
+		case startOptions&types.FRAMEOPTION_START_OFFSET_FOLLOWING != 0:
+			return fmt.Errorf("frame starting from following row cannot end with current row at position %d", location)
+		}
+		options |= startOptions | types.FRAMEOPTION_END_CURRENT_ROW
+		windowDef.StartOffset = startOffset
+	}
+
+	if p.check(TOKEN_EXCLUDE) {
+		p.advance()
+		switch {
+		case p.check(TOKEN_CURRENT) && p.peekToken().Type == TOKEN_ROW:
+			p.advance()
+			p.advance()
+			options |= types.FRAMEOPTION_EXCLUDE_CURRENT_ROW
+		case p.accept(TOKEN_GROUP):
+			options |= types.FRAMEOPTION_EXCLUDE_GROUP
+		case p.accept(TOKEN_TIES):
+			options |= types.FRAMEOPTION_EXCLUDE_TIES
+		case p.check(TOKEN_NO) && p.peekToken().Type == TOKEN_OTHERS:
+			p.advance()
+			p.advance()
+		default:
+			return p.syntaxError()
+		}
+	}
+	windowDef.FrameOptions = options
+	return nil
+}
+
+// frame_bound: UNBOUNDED {PRECEDING | FOLLOWING} | CURRENT ROW | expr {PRECEDING | FOLLOWING}
+// Returns the FRAMEOPTION_START_* bit of the bound
+func (p *Parser) parseFrameBound() (int, types.Node, error) {
+	switch {
+	case p.check(TOKEN_UNBOUNDED) && p.peekToken().Type == TOKEN_PRECEDING:
+		p.advance()
+		p.advance()
+		return types.FRAMEOPTION_START_UNBOUNDED_PRECEDING, nil, nil
+	case p.check(TOKEN_UNBOUNDED) && p.peekToken().Type == TOKEN_FOLLOWING:
+		p.advance()
+		p.advance()
+		return types.FRAMEOPTION_START_UNBOUNDED_FOLLOWING, nil, nil
+	case p.check(TOKEN_CURRENT) && p.peekToken().Type == TOKEN_ROW:
+		p.advance()
+		p.advance()
+		return types.FRAMEOPTION_START_CURRENT_ROW, nil, nil
+	}
+
+	offset, err := p.parseExpr()
+	if err != nil {
+		return 0, nil, err
+	}
+	if p.accept(TOKEN_PRECEDING) {
+		return types.FRAMEOPTION_START_OFFSET_PRECEDING, offset, nil
+	}
+	if p.accept(TOKEN_FOLLOWING) {
+		return types.FRAMEOPTION_START_OFFSET_FOLLOWING, offset, nil
+	}
+	return 0, nil, p.syntaxError()
+}
+
+func makeAExpr(op string, left types.Node, right types.Node, location int) *types.AExpr {
+	return &types.AExpr{Kind: types.AEXPR_OP, Name: op, Lexpr: left, Rexpr: right, Location: location}
+}
+
+// makeBoolExpr flattens a AND b AND c into a single node with three args
+func makeBoolExpr(boolop types.BoolExprType, left types.Node, right types.Node, location int) *types.BoolExpr {
+	if b, ok := left.(*types.BoolExpr); ok && b.Boolop == boolop {
+		b.Args = append(b.Args, right)
+		return b
+	}
+	return &types.BoolExpr{Boolop: boolop, Args: []types.Node{left, right}, Location: location}
+}
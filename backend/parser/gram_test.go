@@ -0,0 +1,34 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/rautNishan/diskquery/types"
+)
+
+func TestIndexSourceText(t *testing.T) {
+	tests := []struct {
+		query string
+		expr  string
+		where string
+	}{
+		{"CREATE INDEX i ON t (id) WHERE v <> 'a  b'", "", "v <> 'a  b'"},
+		{"CREATE INDEX i ON t ((v||'x')) WHERE v <> 'é  ü'  AND\n\tid>0", "v||'x'", "v <> 'é  ü' AND id>0"},
+		{"CREATE INDEX i ON t (lower( v )) WHERE v <> 'line\nbreak' /* c */ OR v = 'it''s\\'", "lower( v )", `v <> E'line\nbreak' OR v = 'it''s\'`},
+		{"CREATE INDEX i ON t (id) WHERE v = 'a' -- c\n", "", "v = 'a'"},
+	}
+	for _, test := range tests {
+		stmts, err := RawParse(test.query, RAW_PARSE_DEFAULT)
+		if err != nil {
+			t.Errorf("%s: %v", test.query, err)
+			continue
+		}
+		stmt := stmts[0].(*types.IndexStmt)
+		if expr := stmt.IndexParams[0].ExprText; expr != test.expr {
+			t.Errorf("%s: expression %q, want %q", test.query, expr, test.expr)
+		}
+		if stmt.WhereText != test.where {
+			t.Errorf("%s: predicate %q, want %q", test.query, stmt.WhereText, test.where)
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package parser
 
-import "fmt"
+import (
+	"github.com/rautNishan/diskquery/types"
+)
 
 type RawParseMode int
 
@@ -13,12 +15,22 @@ const (
 	RAW_PARSE_SQL_ASSIGN3
 )
 
-func RawParse(query string, parseMode RawParseMode) {
+// RawParse turns a query string into a list of raw parse trees, one per statement
+func RawParse(query string, parseMode RawParseMode) ([]types.Node, error) {
 	scanner := NewScanner(query, 0)
 	tokens := scanner.GetTokens()
-	for _, token := range tokens {
-		fmt.Printf("Token raw type: %d\n", token.Type)
-		fmt.Printf("TokeyType: %s, Value: %s\n", keywordsReverse[token.Type], token.Value)
-		fmt.Printf("Token details: %v\n", token)
+	p := NewParser(query, tokens)
+
+	switch parseMode {
+	case RAW_PARSE_SQL_EXPR:
+		expr, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.check(TOKEN_EOF) {
+			return nil, p.syntaxError()
+		}
+		return []types.Node{expr}, nil
 	}
+	return p.parseStmtList()
 }
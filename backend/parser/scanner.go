@@ -1,6 +1,7 @@
 package parser
 
 import (
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
@@ -16,7 +17,7 @@ const (
 	TOKEN_ERROR
 	TOKEN_SCONST // String constant
 	TOKEN_ICONST // Integer constant
-	TOKEN_FCONST // Float constant
+	TOKEN_FCONST // Numeric constant, anything with a point or exponent and integers too big for bigint
 	TOKEN_IDENT  // Identifier
 	TOKEN_PARAM  // Parameter ($1, $2, etc.)
 
@@ -37,6 +38,7 @@ const (
 	TOKEN_ASSIGN   // :=
 	TOKEN_DOT      // .
 	TOKEN_DOTDOT   // ..
+	TOKEN_OP       // Other operators: -> ->> #> #>> #- @> <@ ? ?| ?& @? @@ &&
 
 	// Punctuation
 	TOKEN_LPAREN    // (
@@ -47,6 +49,7 @@ const (
 	TOKEN_RBRACKET  // ]
 	TOKEN_LBRACE    // {
 	TOKEN_RBRACE    // }
+	TOKEN_COLON     // :
 
 	// Keywords (start from 100 to avoid conflicts)
 	TOKEN_SELECT = 100 + iota
@@ -81,6 +84,8 @@ const (
 	TOKEN_FULL
 	TOKEN_OUTER
 	TOKEN_JOIN
+	TOKEN_CROSS
+	TOKEN_NATURAL
 	TOKEN_UNION
 	TOKEN_INTERSECT
 	TOKEN_EXCEPT
@@ -119,6 +124,59 @@ const (
 	TOKEN_LEAST
 	TOKEN_TRUE
 	TOKEN_FALSE
+	TOKEN_FILTER
+	TOKEN_ASC
+	TOKEN_DESC
+	TOKEN_NULLS
+	TOKEN_FIRST
+	TOKEN_LAST
+	TOKEN_TO
+	TOKEN_SHOW
+	TOKEN_RESET
+	TOKEN_DEFAULT
+	TOKEN_ANY
+	TOKEN_SOME
+	TOKEN_WITH
+	TOKEN_RECURSIVE
+	TOKEN_MATERIALIZED
+	TOKEN_OVER
+	TOKEN_PARTITION
+	TOKEN_WINDOW
+	TOKEN_ROWS
+	TOKEN_RANGE
+	TOKEN_GROUPS
+	TOKEN_UNBOUNDED
+	TOKEN_PRECEDING
+	TOKEN_FOLLOWING
+	TOKEN_CURRENT
+	TOKEN_ROW
+	TOKEN_EXCLUDE
+	TOKEN_TIES
+	TOKEN_OTHERS
+	TOKEN_NO
+	TOKEN_AT
+	TOKEN_TIME
+	TOKEN_ZONE
+	TOKEN_ARRAY
+	TOKEN_UNKNOWN
+	TOKEN_FOR
+	TOKEN_PLACING
+	TOKEN_BOTH
+	TOKEN_LEADING
+	TOKEN_TRAILING
+	TOKEN_ESCAPE
+	TOKEN_TYPECAST // ::
+	TOKEN_IF
+	TOKEN_UNIQUE
+	TOKEN_CONCURRENTLY
+	TOKEN_USING
+	TOKEN_INCLUDE
+	TOKEN_VACUUM
+	TOKEN_VERBOSE
+	TOKEN_ALTER
+	TOKEN_COLUMN
+	TOKEN_STORAGE
+	TOKEN_RETURNING
 )
 
 // Lexical token
@@ -126,8 +184,8 @@ type Token struct {
 	Type     TokenType
 	Value    string
 	IntVal   int64
-	FloatVal float64
 	Location int
+	End      int //Location just after the token
 }
 
 type ScannerState int
@@ -183,6 +241,8 @@ var keywordsReverse = map[TokenType]string{
 	TOKEN_FULL:        "FULL",
 	TOKEN_OUTER:       "OUTER",
 	TOKEN_JOIN:        "JOIN",
+	TOKEN_CROSS:       "CROSS",
+	TOKEN_NATURAL:     "NATURAL",
 	TOKEN_UNION:       "UNION",
 	TOKEN_INTERSECT:   "INTERSECT",
 	TOKEN_EXCEPT:      "EXCEPT",
@@ -221,6 +281,68 @@ var keywordsReverse = map[TokenType]string{
 	TOKEN_LEAST:       "LEAST",
 	TOKEN_TRUE:        "TRUE",
 	TOKEN_FALSE:       "FALSE",
+	TOKEN_FILTER:      "FILTER",
+	TOKEN_ASC:         "ASC",
+	TOKEN_DESC:        "DESC",
+	TOKEN_NULLS:       "NULLS",
+	TOKEN_FIRST:       "FIRST",
+	TOKEN_LAST:        "LAST",
+	TOKEN_TO:          "TO",
+	TOKEN_SHOW:        "SHOW",
+	TOKEN_RESET:       "RESET",
+	TOKEN_DEFAULT:     "DEFAULT",
+	TOKEN_ANY:         "ANY",
+	TOKEN_SOME:        "SOME",
+	TOKEN_WITH:        "WITH",
+	TOKEN_RECURSIVE:   "RECURSIVE",
+
+	TOKEN_MATERIALIZED: "MATERIALIZED",
+	TOKEN_OVER:         "OVER",
+	TOKEN_PARTITION:    "PARTITION",
+	TOKEN_WINDOW:       "WINDOW",
+	TOKEN_ROWS:         "ROWS",
+	TOKEN_RANGE:        "RANGE",
+	TOKEN_GROUPS:       "GROUPS",
+	TOKEN_UNBOUNDED:    "UNBOUNDED",
+	TOKEN_PRECEDING:    "PRECEDING",
+	TOKEN_FOLLOWING:    "FOLLOWING",
+	TOKEN_CURRENT:      "CURRENT",
+	TOKEN_ROW:          "ROW",
+	TOKEN_EXCLUDE:      "EXCLUDE",
+	TOKEN_TIES:         "TIES",
+	TOKEN_OTHERS:       "OTHERS",
+	TOKEN_NO:           "NO",
+
+	TOKEN_AT:   "AT",
+	TOKEN_TIME: "TIME",
+	TOKEN_ZONE: "ZONE",
+
+	TOKEN_ARRAY: "ARRAY",
+
+	TOKEN_UNKNOWN: "UNKNOWN",
+
+	TOKEN_FOR:      "FOR",
+	TOKEN_PLACING:  "PLACING",
+	TOKEN_BOTH:     "BOTH",
+	TOKEN_LEADING:  "LEADING",
+	TOKEN_TRAILING: "TRAILING",
+
+	TOKEN_ESCAPE: "ESCAPE",
+
+	TOKEN_IF:           "IF",
+	TOKEN_UNIQUE:       "UNIQUE",
+	TOKEN_CONCURRENTLY: "CONCURRENTLY",
+	TOKEN_USING:        "USING",
+	TOKEN_INCLUDE:      "INCLUDE",
+
+	TOKEN_VACUUM:  "VACUUM",
+	TOKEN_VERBOSE: "VERBOSE",
+
+	TOKEN_ALTER:   "ALTER",
+	TOKEN_COLUMN:  "COLUMN",
+	TOKEN_STORAGE: "STORAGE",
+
+	TOKEN_RETURNING: "RETURNING",
 }
 
 // Keywords mapping - case insensitive
@@ -257,6 +379,8 @@ var keywords = map[string]TokenType{
 	"FULL":        TOKEN_FULL,
 	"OUTER":       TOKEN_OUTER,
 	"JOIN":        TOKEN_JOIN,
+	"CROSS":       TOKEN_CROSS,
+	"NATURAL":     TOKEN_NATURAL,
 	"UNION":       TOKEN_UNION,
 	"INTERSECT":   TOKEN_INTERSECT,
 	"EXCEPT":      TOKEN_EXCEPT,
@@ -295,6 +419,68 @@ var keywords = map[string]TokenType{
 	"LEAST":       TOKEN_LEAST,
 	"TRUE":        TOKEN_TRUE,
 	"FALSE":       TOKEN_FALSE,
+	"FILTER":      TOKEN_FILTER,
+	"ASC":         TOKEN_ASC,
+	"DESC":        TOKEN_DESC,
+	"NULLS":       TOKEN_NULLS,
+	"FIRST":       TOKEN_FIRST,
+	"LAST":        TOKEN_LAST,
+	"TO":          TOKEN_TO,
+	"SHOW":        TOKEN_SHOW,
+	"RESET":       TOKEN_RESET,
+	"DEFAULT":     TOKEN_DEFAULT,
+	"ANY":         TOKEN_ANY,
+	"SOME":        TOKEN_SOME,
+	"WITH":        TOKEN_WITH,
+	"RECURSIVE":   TOKEN_RECURSIVE,
+
+	"MATERIALIZED": TOKEN_MATERIALIZED,
+	"OVER":         TOKEN_OVER,
+	"PARTITION":    TOKEN_PARTITION,
+	"WINDOW":       TOKEN_WINDOW,
+	"ROWS":         TOKEN_ROWS,
+	"RANGE":        TOKEN_RANGE,
+	"GROUPS":       TOKEN_GROUPS,
+	"UNBOUNDED":    TOKEN_UNBOUNDED,
+	"PRECEDING":    TOKEN_PRECEDING,
+	"FOLLOWING":    TOKEN_FOLLOWING,
+	"CURRENT":      TOKEN_CURRENT,
+	"ROW":          TOKEN_ROW,
+	"EXCLUDE":      TOKEN_EXCLUDE,
+	"TIES":         TOKEN_TIES,
+	"OTHERS":       TOKEN_OTHERS,
+	"NO":           TOKEN_NO,
+
+	"AT":   TOKEN_AT,
+	"TIME": TOKEN_TIME,
+	"ZONE": TOKEN_ZONE,
+
+	"ARRAY": TOKEN_ARRAY,
+
+	"UNKNOWN": TOKEN_UNKNOWN,
+
+	"FOR":      TOKEN_FOR,
+	"PLACING":  TOKEN_PLACING,
+	"BOTH":     TOKEN_BOTH,
+	"LEADING":  TOKEN_LEADING,
+	"TRAILING": TOKEN_TRAILING,
+
+	"ESCAPE": TOKEN_ESCAPE,
+
+	"IF":           TOKEN_IF,
+	"UNIQUE":       TOKEN_UNIQUE,
+	"CONCURRENTLY": TOKEN_CONCURRENTLY,
+	"USING":        TOKEN_USING,
+	"INCLUDE":      TOKEN_INCLUDE,
+
+	"VACUUM":  TOKEN_VACUUM,
+	"VERBOSE": TOKEN_VERBOSE,
+
+	"ALTER":   TOKEN_ALTER,
+	"COLUMN":  TOKEN_COLUMN,
+	"STORAGE": TOKEN_STORAGE,
+
+	"RETURNING": TOKEN_RETURNING,
 }
 
 func NewScanner(query string, state ScannerState) *Scanner {
@@ -343,6 +529,14 @@ func (s *Scanner) readChar() {
 	}
 }
 
+// offset is the location of the character the scanner is on
+func (s *Scanner) offset() int {
+	if s.current == 0 {
+		return s.location
+	}
+	return s.location - 1
+}
+
 func (s *Scanner) peekChar() rune {
 	return s.peek
 }
@@ -376,9 +570,10 @@ func (s *Scanner) scanIdentifier() Token {
 		}
 	}
 
+	//Unquoted identifiers are case insensitive, fold them to lower case like postgres does
 	return Token{
 		Type:     TOKEN_IDENT,
-		Value:    value,
+		Value:    strings.ToLower(value),
 		Location: start,
 	}
 
@@ -390,26 +585,29 @@ func (s *Scanner) scanQuotedIdentifier() Token {
 
 	s.readChar()
 
-	for s.current != '"' && s.current != 0 {
-		if s.current == '"' && s.peekChar() == '"' {
+	for {
+		switch {
+		case s.current == 0:
+			return Token{Type: TOKEN_ERROR, Value: "unterminated quoted identifier", Location: start}
+		case s.current == '"' && s.peekChar() == '"':
 			builder.WriteRune('"')
 			s.readChar() //Skip first quote
 			s.readChar() //Skip second quote
-		} else {
+		case s.current == '"':
+			s.readChar() //Skip closing quote
+			if builder.Len() == 0 {
+				return Token{Type: TOKEN_ERROR, Value: "zero-length delimited identifier", Location: start}
+			}
+			return Token{
+				Type:     TOKEN_IDENT,
+				Value:    builder.String(),
+				Location: start,
+			}
+		default:
 			builder.WriteRune(s.current)
 			s.readChar()
 		}
 	}
-
-	if s.current == '"' {
-		s.readChar() //Skip closing quote
-	}
-
-	return Token{
-		Type:     TOKEN_IDENT,
-		Value:    builder.String(),
-		Location: start,
-	}
 }
 
 func (s *Scanner) scanNumber() Token {
@@ -445,6 +643,9 @@ func (s *Scanner) scanNumber() Token {
 			s.readChar()
 		}
 
+		if !unicode.IsDigit(s.current) {
+			return Token{Type: TOKEN_ERROR, Value: "Invalid float: " + builder.String(), Location: start}
+		}
 		for unicode.IsDigit(s.current) {
 			builder.WriteRune(s.current)
 			s.readChar()
@@ -453,22 +654,16 @@ func (s *Scanner) scanNumber() Token {
 
 	value := builder.String()
 
+	//Like postgres the text is kept, the parser reads it as an exact numeric
 	if isFloat {
-		floatVal, err := strconv.ParseFloat(value, 64)
-		if err != nil {
-			return Token{Type: TOKEN_ERROR, Value: "Invalid float: " + value, Location: start}
-		}
-
-		return Token{
-			Type:     TOKEN_FCONST,
-			Value:    value,
-			FloatVal: floatVal,
-			Location: start,
-		}
+		return Token{Type: TOKEN_FCONST, Value: value, Location: start}
 	}
 
-	intVal, err := strconv.ParseInt(value, 10, 60)
+	intVal, err := strconv.ParseInt(value, 10, 64)
 	if err != nil {
+		if errors.Is(err, strconv.ErrRange) {
+			return Token{Type: TOKEN_FCONST, Value: value, Location: start}
+		}
 		return Token{
 			Type:     TOKEN_ERROR,
 			Value:    "Invalid integer: " + value,
@@ -484,48 +679,143 @@ func (s *Scanner) scanNumber() Token {
 	}
 }
 
-func (s *Scanner) scanString(quote rune) Token {
+// scanMatchOperator scans the pattern matching operators ~, ~*, ~~ and ~~*, prefix is "!" for their negations
+func (s *Scanner) scanMatchOperator(prefix string, location int) Token {
+	op := prefix + "~"
+	s.readChar()
+	if s.current == '~' {
+		op += "~"
+		s.readChar()
+	}
+	if s.current == '*' {
+		op += "*"
+		s.readChar()
+	}
+	return Token{Type: TOKEN_OP, Value: op, Location: location}
+}
+
+/*
+scanString scans a string constant. With standard_conforming_strings (always on, as in postgres since 9.1)
+a backslash is an ordinary character in '...', a quote inside the string is written twice. An escape
+string E'...' also takes the C-style backslash escapes
+*/
+func (s *Scanner) scanString(escape bool) Token {
 	start := s.location - 1
+	if escape {
+		s.readChar() //Skip the E
+	}
 	var builder strings.Builder
 	s.readChar()
 
-	for s.current != quote && s.current != 0 {
-		if s.current == quote && s.peekChar() == quote {
-			builder.WriteRune(s.current)
+	for {
+		switch {
+		case s.current == 0:
+			return Token{Type: TOKEN_ERROR, Value: "unterminated quoted string", Location: start}
+		case s.current == '\'' && s.peekChar() == '\'':
+			builder.WriteRune('\'')
 			s.readChar() //Skip first quote
 			s.readChar() //Skip second quote
-		} else if s.current == '\\' {
-			s.readChar()
-			switch s.current {
-			case 'n':
-				builder.WriteRune('\n')
-			case 't':
-				builder.WriteRune('\t')
-			case 'r':
-				builder.WriteRune('\r')
-			case '\\':
-				builder.WriteRune('\\')
-			case '\'':
-				builder.WriteRune('\'')
-			case '"':
-				builder.WriteRune('"')
-			default:
-				builder.WriteRune(s.current)
+		case s.current == '\'':
+			s.readChar() //Skip closing quote
+			if escape && !utf8.ValidString(builder.String()) {
+				return Token{Type: TOKEN_ERROR, Value: "invalid byte sequence for encoding \"UTF8\"", Location: start}
 			}
+			return Token{Type: TOKEN_SCONST, Value: builder.String(), Location: start}
+		case escape && s.current == '\\':
 			s.readChar()
-		} else {
+			if err := s.scanEscape(&builder); err != "" {
+				return Token{Type: TOKEN_ERROR, Value: err, Location: start}
+			}
+		default:
 			builder.WriteRune(s.current)
 			s.readChar()
 		}
 	}
-	if s.current == quote {
-		s.readChar() //Skip closing quote
+}
+
+// scanEscape scans the escape after a backslash of an escape string, the message of the error when it is invalid
+func (s *Scanner) scanEscape(builder *strings.Builder) string {
+	c := s.current
+	s.readChar()
+	switch c {
+	case 0:
+		return "unterminated quoted string"
+	case 'b':
+		builder.WriteByte('\b')
+	case 'f':
+		builder.WriteByte('\f')
+	case 'n':
+		builder.WriteByte('\n')
+	case 'r':
+		builder.WriteByte('\r')
+	case 't':
+		builder.WriteByte('\t')
+	case '0', '1', '2', '3', '4', '5', '6', '7':
+		//\o, \oo or \ooo octal byte value
+		value := int(c - '0')
+		for n := 1; n < 3 && s.current >= '0' && s.current <= '7'; n++ {
+			value = value*8 + int(s.current-'0')
+			s.readChar()
+		}
+		return writeEscapedByte(builder, value)
+	case 'x':
+		//\xh or \xhh hexadecimal byte value, without a digit the x is taken as is
+		value, n := 0, 0
+		for ; n < 2 && isHexDigit(s.current); n++ {
+			value = value*16 + hexValue(s.current)
+			s.readChar()
+		}
+		if n == 0 {
+			builder.WriteRune('x')
+			return ""
+		}
+		return writeEscapedByte(builder, value)
+	case 'u', 'U':
+		//\uxxxx or \Uxxxxxxxx unicode code point
+		digits := 4
+		if c == 'U' {
+			digits = 8
+		}
+		value := 0
+		for n := 0; n < digits; n++ {
+			if !isHexDigit(s.current) {
+				return "invalid Unicode escape"
+			}
+			value = value*16 + hexValue(s.current)
+			s.readChar()
+		}
+		if value == 0 || value > unicode.MaxRune || value >= 0xd800 && value <= 0xdfff {
+			return "invalid Unicode escape value"
+		}
+		builder.WriteRune(rune(value))
+	default:
+		//Any other character stands for itself, \\ and \' among them
+		builder.WriteRune(c)
 	}
+	return ""
+}
 
-	return Token{
-		Type:     TOKEN_SCONST,
-		Value:    builder.String(),
-		Location: start,
+// writeEscapedByte adds the byte of an octal or hexadecimal escape, the string is checked to be UTF-8 at its end
+func writeEscapedByte(builder *strings.Builder, value int) string {
+	if value == 0 || value > 0xff {
+		return fmt.Sprintf("invalid byte sequence for encoding \"UTF8\": 0x%02x", value)
+	}
+	builder.WriteByte(byte(value))
+	return ""
+}
+
+func isHexDigit(c rune) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
+
+func hexValue(c rune) int {
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c - '0')
+	case c >= 'a' && c <= 'f':
+		return int(c-'a') + 10
+	default:
+		return int(c-'A') + 10
 	}
 }
 
@@ -595,6 +885,9 @@ func (s *Scanner) NextToken() Token {
 	location := s.location - 1
 
 	switch {
+	case (s.current == 'E' || s.current == 'e') && s.peekChar() == '\'':
+		return s.scanString(true)
+
 	case unicode.IsLetter(s.current) || s.current == '_':
 		return s.scanIdentifier()
 
@@ -604,8 +897,8 @@ func (s *Scanner) NextToken() Token {
 	case unicode.IsDigit(s.current):
 		return s.scanNumber()
 
-	case s.current == '\'' || s.current == '"':
-		return s.scanString(s.current)
+	case s.current == '\'':
+		return s.scanString(false)
 
 	case s.current == '$':
 		return s.scanParameter()
@@ -625,6 +918,9 @@ func (s *Scanner) NextToken() Token {
 		} else if s.current == '>' {
 			s.readChar()
 			return Token{Type: TOKEN_NE, Value: "<>", Location: location}
+		} else if s.current == '@' {
+			s.readChar()
+			return Token{Type: TOKEN_OP, Value: "<@", Location: location}
 		}
 		return Token{Type: TOKEN_LT, Value: "<", Location: location}
 
@@ -642,8 +938,14 @@ func (s *Scanner) NextToken() Token {
 			s.readChar()
 			return Token{Type: TOKEN_NE, Value: "!=", Location: location}
 		}
+		if s.current == '~' {
+			return s.scanMatchOperator("!", location)
+		}
 		return Token{Type: TOKEN_ERROR, Value: "unexpected character: !", Location: location}
 
+	case s.current == '~':
+		return s.scanMatchOperator("", location)
+
 	case s.current == '|':
 		s.readChar()
 		if s.current == '|' {
@@ -652,13 +954,70 @@ func (s *Scanner) NextToken() Token {
 		}
 		return Token{Type: TOKEN_ERROR, Value: "unexpected character: |", Location: location}
 
+	//The json operators, postgres scans them as generic operators
+	case s.current == '-' && s.peekChar() == '>':
+		s.readChar()
+		s.readChar()
+		if s.current == '>' {
+			s.readChar()
+			return Token{Type: TOKEN_OP, Value: "->>", Location: location}
+		}
+		return Token{Type: TOKEN_OP, Value: "->", Location: location}
+
+	case s.current == '#':
+		s.readChar()
+		switch s.current {
+		case '>':
+			s.readChar()
+			if s.current == '>' {
+				s.readChar()
+				return Token{Type: TOKEN_OP, Value: "#>>", Location: location}
+			}
+			return Token{Type: TOKEN_OP, Value: "#>", Location: location}
+		case '-':
+			s.readChar()
+			return Token{Type: TOKEN_OP, Value: "#-", Location: location}
+		}
+		return Token{Type: TOKEN_ERROR, Value: "unexpected character: #", Location: location}
+
+	case s.current == '@':
+		s.readChar()
+		switch s.current {
+		case '>', '?', '@':
+			op := "@" + string(s.current)
+			s.readChar()
+			return Token{Type: TOKEN_OP, Value: op, Location: location}
+		}
+		return Token{Type: TOKEN_ERROR, Value: "unexpected character: @", Location: location}
+
+	case s.current == '?':
+		s.readChar()
+		if s.current == '|' || s.current == '&' {
+			op := "?" + string(s.current)
+			s.readChar()
+			return Token{Type: TOKEN_OP, Value: op, Location: location}
+		}
+		return Token{Type: TOKEN_OP, Value: "?", Location: location}
+
+	case s.current == '&':
+		s.readChar()
+		if s.current == '&' {
+			s.readChar()
+			return Token{Type: TOKEN_OP, Value: "&&", Location: location}
+		}
+		return Token{Type: TOKEN_ERROR, Value: "unexpected character: &", Location: location}
+
 	case s.current == ':':
 		s.readChar()
 		if s.current == '=' {
 			s.readChar()
 			return Token{Type: TOKEN_ASSIGN, Value: ":=", Location: location}
 		}
-		return Token{Type: TOKEN_ERROR, Value: "unexpected character: :", Location: location}
+		if s.current == ':' {
+			s.readChar()
+			return Token{Type: TOKEN_TYPECAST, Value: "::", Location: location}
+		}
+		return Token{Type: TOKEN_COLON, Value: ":", Location: location}
 
 	case s.current == '.':
 		s.readChar()
@@ -751,6 +1110,7 @@ func (s *Scanner) GetTokens() []Token {
 
 	for {
 		token := s.NextToken()
+		token.End = s.offset()
 		tokens = append(tokens, token)
 		if token.Type == TOKEN_EOF || token.Type == TOKEN_ERROR {
 			break
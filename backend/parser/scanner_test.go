@@ -0,0 +1,75 @@
+package parser
+
+import "testing"
+
+func TestScanString(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+		err   string
+	}{
+		{`'abc'`, "abc", ""},
+		{`'it''s'`, "it's", ""},
+		{`''''`, "'", ""},
+		{`''`, "", ""},
+		{`'\x41'`, `\x41`, ""},
+		{`'a\nb'`, `a\nb`, ""},
+		{`'a\'`, `a\`, ""},
+		{`E'a\nb'`, "a\nb", ""},
+		{`e'\t\\\''`, "\t\\'", ""},
+		{`E'it''s'`, "it's", ""},
+		{`E'\x41\101é\U0001F600'`, "AAé\U0001F600", ""},
+		{`E'\xg'`, "xg", ""},
+		{`E'\q'`, "q", ""},
+		{`E'\xc3\xa9'`, "é", ""},
+		{`'a  b'`, "a  b", ""},
+		{`'abc`, "", "unterminated quoted string"},
+		{`'it''`, "", "unterminated quoted string"},
+		{`E'\u12'`, "", "invalid Unicode escape"},
+		{`E'\ud800'`, "", "invalid Unicode escape value"},
+		{`E'\xff'`, "", "invalid byte sequence for encoding \"UTF8\""},
+		{`E'\0'`, "", "invalid byte sequence for encoding \"UTF8\": 0x00"},
+	}
+	for _, test := range tests {
+		tokens := NewScanner(test.query, SCANNER_NORMAL).GetTokens()
+		tok := tokens[0]
+		if test.err != "" {
+			if tok.Type != TOKEN_ERROR || tok.Value != test.err {
+				t.Errorf("%s: got %v %q, want error %q", test.query, tok.Type, tok.Value, test.err)
+			}
+			continue
+		}
+		if tok.Type != TOKEN_SCONST || tok.Value != test.want {
+			t.Errorf("%s: got %v %q, want %q", test.query, tok.Type, tok.Value, test.want)
+		}
+		if len(tokens) != 2 || tokens[1].Type != TOKEN_EOF {
+			t.Errorf("%s: the string is not the whole input: %v", test.query, tokens)
+		}
+	}
+}
+
+func TestScanQuotedIdentifier(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+		err   string
+	}{
+		{`"Abc"`, "Abc", ""},
+		{`"a""b"`, `a"b`, ""},
+		{`"a,b c"`, "a,b c", ""},
+		{`""`, "", "zero-length delimited identifier"},
+		{`"abc`, "", "unterminated quoted identifier"},
+	}
+	for _, test := range tests {
+		tok := NewScanner(test.query, SCANNER_NORMAL).GetTokens()[0]
+		if test.err != "" {
+			if tok.Type != TOKEN_ERROR || tok.Value != test.err {
+				t.Errorf("%s: got %v %q, want error %q", test.query, tok.Type, tok.Value, test.err)
+			}
+			continue
+		}
+		if tok.Type != TOKEN_IDENT || tok.Value != test.want {
+			t.Errorf("%s: got %v %q, want %q", test.query, tok.Type, tok.Value, test.want)
+		}
+	}
+}
@@ -0,0 +1,798 @@
+package planner
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/rautNishan/diskquery/adt"
+	"github.com/rautNishan/diskquery/catalog"
+	"github.com/rautNishan/diskquery/parser"
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+Parse analysis, turns the raw SelectStmt, InsertStmt, UpdateStmt or DeleteStmt into a Query where every name
+is resolved
+This is what postgres does in analyze.c before handing the Query to the planner
+*/
+
+type Query struct {
+	rte         *RangeTblEntry //The FROM item, nil without FROM
+	targetList  []*types.TargetEntry
+	whereClause types.Node
+	groupClause []types.Node
+	having      types.Node
+	aggs        []*types.Aggref
+	distinct    bool
+	sortClause  []SortGroupClause
+	limitCount  types.Node
+	limitOffset types.Node
+
+	windowClause   []*WindowClause //WindowFunc.WinRef is a position in this list
+	hasWindowFuncs bool
+
+	hasTargetSRFs bool //The select list calls set returning functions, they run in a ProjectSet node
+
+	//Set operations, larg and rarg are only set when setOp is not SETOP_NONE
+	setOp types.SetOperation
+	all   bool
+	larg  *Query
+	rarg  *Query
+
+	//INSERT, UPDATE and DELETE change resultRelation, see transformInsertStmt and transformUpdateStmt for what
+	//targetList is for them
+	commandType    types.CmdType
+	resultRelation *catalog.Relation
+	valuesLists    [][]*types.TargetEntry //The rows of INSERT ... VALUES
+	returningList  []*types.TargetEntry
+}
+
+func (*Query) NodeTag() types.NodeTag { return types.TQuery }
+
+/*
+RangeTblEntry is what a FROM item reads, either a relation, a subquery (derived table), a WITH query,
+a function call or a join of two other FROM items. A reference to an inlined WITH query also has its own
+copy of the query in subquery
+*/
+type RangeTblEntry struct {
+	refname  string //Name columns can be qualified with, the alias if one was given
+	columns  []catalog.Column
+	relation *catalog.Relation
+	subquery *Query
+	function types.Node //The analyzed call of a function in FROM, a single column of its result type
+
+	cte           *CommonTableExpr
+	cteLevelsUp   int  //How many query levels up the WITH is
+	selfReference bool //The work table of a recursive query
+
+	//A join of larg and rarg, it reads their tuples side by side. Its columns are what joinCols say
+	joinType  types.JoinType
+	larg      *RangeTblEntry
+	rarg      *RangeTblEntry
+	joinQuals types.Node
+	joinCols  []joinColumn
+}
+
+func (*RangeTblEntry) NodeTag() types.NodeTag { return types.TRangeTblEntry }
+
+// columnIndex finds a column by name, -1 if there is none
+func (rte *RangeTblEntry) columnIndex(colname string, location int) (int, error) {
+	attno := -1
+	for i, col := range rte.columns {
+		if col.Name != colname {
+			continue
+		}
+		//Only a subquery can have two columns with the same name, SELECT 1 AS a, 2 AS a
+		if attno >= 0 {
+			return -1, fmt.Errorf("column reference \"%s\" is ambiguous at position %d", colname, location)
+		}
+		attno = i
+	}
+	return attno, nil
+}
+
+// SortGroupClause is one ORDER BY item, it sorts on the output column TleIndex
+type SortGroupClause struct {
+	TleIndex   int
+	Desc       bool
+	NullsFirst bool
+}
+
+func (q *Query) hasAggs() bool {
+	return len(q.aggs) > 0
+}
+
+// transformStmt analyzes a SELECT, parentState is set when it is a subquery
+func transformStmt(stmt *types.SelectStmt, parentState *ParseState) (*Query, error) {
+	return transformQueryLevel(stmt, parentState, nil)
+}
+
+// ctes are the WITH queries of an enclosing set operation, its branches are part of the same query level
+func transformQueryLevel(stmt *types.SelectStmt, parentState *ParseState, ctes []*CommonTableExpr) (*Query, error) {
+	if stmt.Op != types.SETOP_NONE {
+		return transformSetOperationStmt(stmt, parentState, ctes)
+	}
+	return transformSelectStmt(stmt, parentState, ctes)
+}
+
+func transformSelectStmt(stmt *types.SelectStmt, parentState *ParseState, ctes []*CommonTableExpr) (*Query, error) {
+	ctes, err := transformWithClause(stmt.WithClause, parentState, ctes)
+	if err != nil {
+		return nil, err
+	}
+	pstate := &ParseState{parent: parentState, ctes: ctes}
+	query := &Query{distinct: stmt.Distinct}
+
+	if query.rte, err = pstate.transformFromClause(stmt.FromClause); err != nil {
+		return nil, err
+	}
+	pstate.rte = query.rte
+
+	if err := pstate.transformWindowClause(stmt.WindowClause); err != nil {
+		return nil, err
+	}
+
+	targetList, err := pstate.transformTargetList(stmt.TargetList, EXPR_KIND_SELECT_TARGET)
+	if err != nil {
+		return nil, err
+	}
+	query.targetList = targetList
+
+	if stmt.WhereClause != nil {
+		where, err := pstate.transformWhereClause(stmt.WhereClause, EXPR_KIND_WHERE)
+		if err != nil {
+			return nil, err
+		}
+		query.whereClause = where
+	}
+
+	for _, rawGroup := range stmt.GroupClause {
+		groupExpr, err := pstate.transformGroupExpr(rawGroup, targetList)
+		if err != nil {
+			return nil, err
+		}
+		query.groupClause = append(query.groupClause, groupExpr)
+	}
+
+	if stmt.HavingClause != nil {
+		having, err := pstate.transformWhereClause(stmt.HavingClause, EXPR_KIND_HAVING)
+		if err != nil {
+			return nil, err
+		}
+		query.having = having
+	}
+
+	//ORDER BY may add junk columns to the target list, so it goes before the grouping checks
+	for _, sortBy := range stmt.SortClause {
+		sortClause, err := pstate.transformSortClause(sortBy, query)
+		if err != nil {
+			return nil, err
+		}
+		query.sortClause = append(query.sortClause, sortClause)
+	}
+	query.aggs = pstate.aggs
+	query.windowClause = pstate.windowClause
+	query.hasWindowFuncs = pstate.hasWindowFuncs
+	query.hasTargetSRFs = pstate.hasTargetSRFs
+
+	if query.limitCount, err = transformLimitClause(stmt.LimitCount, EXPR_KIND_LIMIT); err != nil {
+		return nil, err
+	}
+	if query.limitOffset, err = transformLimitClause(stmt.LimitOffset, EXPR_KIND_OFFSET); err != nil {
+		return nil, err
+	}
+
+	if query.hasTargetSRFs && (query.hasAggs() || len(query.groupClause) > 0 || query.having != nil || query.hasWindowFuncs) {
+		return nil, fmt.Errorf("set-returning functions in the select list are not supported together with aggregates or window functions yet")
+	}
+
+	if query.hasAggs() || len(query.groupClause) > 0 || query.having != nil {
+		for _, tle := range query.targetList {
+			if err := checkUngroupedColumns(tle.Expr, query.groupClause); err != nil {
+				return nil, err
+			}
+		}
+		if err := checkUngroupedColumns(query.having, query.groupClause); err != nil {
+			return nil, err
+		}
+		//Windows are computed over the groups
+		for _, wc := range query.windowClause {
+			for _, expr := range wc.partitionClause {
+				if err := checkUngroupedColumns(expr, query.groupClause); err != nil {
+					return nil, err
+				}
+			}
+			for _, sortKey := range wc.orderClause {
+				if err := checkUngroupedColumns(sortKey.Expr, query.groupClause); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return query, nil
+}
+
+func (pstate *ParseState) transformFromItem(item types.Node) (*RangeTblEntry, error) {
+	switch n := item.(type) {
+	case *types.RangeVar:
+		if cte, levelsUp, counted := pstate.findCte(n.Relname); cte != nil && n.Schemaname == "" {
+			return pstate.transformCteReference(n, cte, levelsUp, counted)
+		}
+		rel, err := catalog.OpenRelation(n.Schemaname, n.Relname)
+		if err != nil {
+			return nil, err
+		}
+		if rel.Relkind == catalog.RELKIND_VIEW {
+			return transformViewReference(n, rel)
+		}
+		rte := &RangeTblEntry{refname: n.Relname, columns: rel.Columns, relation: rel}
+		if n.Alias != "" {
+			rte.refname = n.Alias
+		}
+		return rte, nil
+
+	case *types.RangeSubselect:
+		//Analyzed before our own FROM item is set, so the subquery cannot see it (no LATERAL)
+		subquery, err := transformStmt(n.Subquery, pstate)
+		if err != nil {
+			return nil, err
+		}
+		resolveTargetListUnknown(subquery.targetList)
+		rte := &RangeTblEntry{refname: n.Alias, subquery: subquery, columns: subqueryColumns(subquery.targetList, n.ColNames)}
+		if len(n.ColNames) > len(rte.columns) {
+			return nil, fmt.Errorf("table \"%s\" has %d columns available but %d columns specified at position %d",
+				n.Alias, len(rte.columns), len(n.ColNames), n.Location)
+		}
+		return rte, nil
+
+	case *types.JoinExpr:
+		return pstate.transformJoinExpr(n)
+
+	case *types.RangeFunction:
+		//Like a subquery in FROM the call cannot see our own FROM item, only the queries we are in
+		funcExpr, err := pstate.transformExpr(n.FuncCall, EXPR_KIND_FROM_FUNCTION)
+		if err != nil {
+			return nil, err
+		}
+		funcname := n.FuncCall.Funcname
+		if len(n.ColNames) > 1 {
+			return nil, fmt.Errorf("too many column aliases specified for function %s at position %d", funcname, n.Location)
+		}
+		rte := &RangeTblEntry{refname: funcname, function: funcExpr}
+		colname := funcname
+		if n.Alias != "" {
+			rte.refname, colname = n.Alias, n.Alias
+		}
+		if len(n.ColNames) == 1 {
+			colname = n.ColNames[0]
+		}
+		rte.columns = []catalog.Column{{Name: colname, TypeOid: types.ExprType(funcExpr)}}
+		return rte, nil
+	}
+	return nil, fmt.Errorf("unrecognized FROM item type: %T", item)
+}
+
+// subqueryColumns are the columns a subquery in FROM shows, named by colnames as far as they go
+/*
+A view is read as the subquery it is defined by (postgres rewrites the query with the view's _RETURN rule)
+The definition is analyzed on its own, names in it do not see the WITH queries of the query using the view
+*/
+func transformViewReference(rv *types.RangeVar, rel *catalog.Relation) (*RangeTblEntry, error) {
+	parseTrees, err := parser.RawParse(rel.ViewQuery, parser.RAW_PARSE_DEFAULT)
+	if err != nil {
+		return nil, fmt.Errorf("definition of view \"%s\" is invalid: %v", rel.Relname, err)
+	}
+	var stmt *types.SelectStmt
+	if len(parseTrees) == 1 {
+		stmt, _ = parseTrees[0].(*types.SelectStmt)
+	}
+	if stmt == nil {
+		return nil, fmt.Errorf("definition of view \"%s\" is not a single SELECT", rel.Relname)
+	}
+	subquery, err := transformStmt(stmt, nil)
+	if err != nil {
+		return nil, err
+	}
+	resolveTargetListUnknown(subquery.targetList)
+	rte := &RangeTblEntry{refname: rv.Relname, subquery: subquery, columns: subqueryColumns(subquery.targetList, nil)}
+	if rv.Alias != "" {
+		rte.refname = rv.Alias
+	}
+	return rte, nil
+}
+
+func subqueryColumns(targetList []*types.TargetEntry, colnames []string) []catalog.Column {
+	var columns []catalog.Column
+	for i, tle := range nonJunkColumns(targetList) {
+		col := catalog.Column{Name: tle.ResName, TypeOid: types.ExprType(tle.Expr)}
+		if i < len(colnames) {
+			col.Name = colnames[i]
+		}
+		columns = append(columns, col)
+	}
+	return columns
+}
+
+// transformTargetList analyzes a select list, or RETURNING when kind is EXPR_KIND_RETURNING
+func (pstate *ParseState) transformTargetList(targets []*types.ResTarget, kind ParseExprKind) ([]*types.TargetEntry, error) {
+	var targetList []*types.TargetEntry
+	for _, target := range targets {
+		if star, ok := target.Val.(*types.AStar); ok {
+			expanded, err := pstate.expandStar(star)
+			if err != nil {
+				return nil, err
+			}
+			targetList = append(targetList, expanded...)
+			continue
+		}
+
+		expr, err := pstate.transformExpr(target.Val, kind)
+		if err != nil {
+			return nil, err
+		}
+		name := target.Name
+		if name == "" {
+			name = figureColname(target.Val)
+		}
+		targetList = append(targetList, &types.TargetEntry{Expr: expr, ResName: name})
+	}
+	return targetList, nil
+}
+
+func (pstate *ParseState) expandStar(star *types.AStar) ([]*types.TargetEntry, error) {
+	if pstate.rte == nil {
+		return nil, fmt.Errorf("SELECT * with no tables specified is not valid at position %d", star.Location)
+	}
+	//rel.* is only the columns of that FROM item, even when it is part of a join
+	rte, offset := pstate.rte, 0
+	if star.Relname != "" {
+		if rte, offset = pstate.rte.findRefname(star.Relname, 0); rte == nil {
+			return nil, fmt.Errorf("missing FROM-clause entry for table \"%s\" at position %d", star.Relname, star.Location)
+		}
+	}
+	var targetList []*types.TargetEntry
+	for attno, col := range rte.columns {
+		targetList = append(targetList, &types.TargetEntry{Expr: rte.columnExpr(attno, offset, 0), ResName: col.Name})
+	}
+	return targetList, nil
+}
+
+// figureColname picks the output column name when there is no AS, the same way postgres does
+func figureColname(node types.Node) string {
+	switch n := node.(type) {
+	case *types.ColumnRef:
+		return n.Fields[len(n.Fields)-1]
+	case *types.FuncCall:
+		return n.Funcname
+	case *types.AArrayExpr:
+		return "array"
+	case *types.AIndirection:
+		return figureColname(n.Arg)
+	case *types.CoalesceExpr:
+		return "coalesce"
+	case *types.MinMaxExpr:
+		if n.Op == types.IS_GREATEST {
+			return "greatest"
+		}
+		return "least"
+	case *types.AExpr:
+		if n.Kind == types.AEXPR_NULLIF {
+			return "nullif"
+		}
+	case *types.CaseExpr:
+		return "case"
+	case *types.TypeCast:
+		//The name of what is converted, for a literal the type's
+		if name := figureColname(n.Arg); name != "?column?" {
+			return name
+		}
+		return strings.ToLower(n.TypeName.Name)
+	}
+	return "?column?"
+}
+
+func (pstate *ParseState) transformWhereClause(clause types.Node, kind ParseExprKind) (types.Node, error) {
+	expr, err := pstate.transformExpr(clause, kind)
+	if err != nil {
+		return nil, err
+	}
+	expr, err = coerceUnknown(expr, types.BOOLOID)
+	if err != nil {
+		return nil, err
+	}
+	if exprType := types.ExprType(expr); exprType != types.BOOLOID {
+		return nil, fmt.Errorf("argument of %s must be type boolean, not type %s", kind, adt.TypeName(exprType))
+	}
+	return expr, nil
+}
+
+/*
+GROUP BY items can be an ordinal (GROUP BY 1) or the name of an output column,
+input column names win over output names, same as postgres
+*/
+func (pstate *ParseState) transformGroupExpr(node types.Node, targetList []*types.TargetEntry) (types.Node, error) {
+	if c, ok := node.(*types.AConst); ok {
+		if pos, isInt := c.Val.(int64); isInt {
+			if pos < 1 || int(pos) > len(targetList) {
+				return nil, fmt.Errorf("GROUP BY position %d is not in select list at position %d", pos, c.Location)
+			}
+			expr := targetList[pos-1].Expr
+			if containsAggregate(expr) {
+				return nil, fmt.Errorf("aggregate functions are not allowed in GROUP BY at position %d", c.Location)
+			}
+			return expr, nil
+		}
+	}
+
+	if cref, ok := node.(*types.ColumnRef); ok && len(cref.Fields) == 1 {
+		if _, err := pstate.transformColumnRef(cref); err != nil {
+			for _, tle := range targetList {
+				if tle.ResName == cref.Fields[0] {
+					if containsAggregate(tle.Expr) {
+						return nil, fmt.Errorf("aggregate functions are not allowed in GROUP BY at position %d", cref.Location)
+					}
+					return tle.Expr, nil
+				}
+			}
+		}
+	}
+
+	expr, err := pstate.transformExpr(node, EXPR_KIND_GROUP_BY)
+	if err != nil {
+		return nil, err
+	}
+	return resolveUnknown(expr), nil
+}
+
+/*
+ORDER BY items are matched against the target list first, an ordinal or a bare output column name
+picks that column, anything else is an expression over the input
+Expressions not already in the target list are added as junk columns so the Sort can see them
+*/
+func (pstate *ParseState) transformSortClause(sortBy *types.SortBy, query *Query) (SortGroupClause, error) {
+	clause := SortGroupClause{TleIndex: -1, Desc: sortBy.SortbyDir == types.SORTBY_DESC}
+	//Postgres default: NULLs are larger than everything, so they come last in ASC and first in DESC
+	switch sortBy.SortbyNull {
+	case types.SORTBY_NULLS_FIRST:
+		clause.NullsFirst = true
+	case types.SORTBY_NULLS_LAST:
+		clause.NullsFirst = false
+	default:
+		clause.NullsFirst = clause.Desc
+	}
+
+	switch n := sortBy.Node.(type) {
+	case *types.AConst:
+		if pos, isInt := n.Val.(int64); isInt {
+			if pos < 1 || int(pos) > countNonJunk(query.targetList) {
+				return clause, fmt.Errorf("ORDER BY position %d is not in select list at position %d", pos, n.Location)
+			}
+			clause.TleIndex = int(pos) - 1
+			return clause, nil
+		}
+	case *types.ColumnRef:
+		if len(n.Fields) == 1 {
+			for i, tle := range query.targetList {
+				if tle.ResJunk || tle.ResName != n.Fields[0] {
+					continue
+				}
+				if clause.TleIndex >= 0 {
+					return clause, fmt.Errorf("ORDER BY \"%s\" is ambiguous at position %d", n.Fields[0], n.Location)
+				}
+				clause.TleIndex = i
+			}
+			if clause.TleIndex >= 0 {
+				return clause, nil
+			}
+		}
+	}
+
+	//The result of a set operation only has its output columns
+	if query.setOp != types.SETOP_NONE {
+		return clause, fmt.Errorf("invalid UNION/INTERSECT/EXCEPT ORDER BY clause at position %d, only result column names can be used", sortBy.Location)
+	}
+
+	expr, err := pstate.transformExpr(sortBy.Node, EXPR_KIND_ORDER_BY)
+	if err != nil {
+		return clause, err
+	}
+	expr = resolveUnknown(expr)
+
+	for i, tle := range query.targetList {
+		if reflect.DeepEqual(tle.Expr, expr) {
+			clause.TleIndex = i
+			return clause, nil
+		}
+	}
+	if query.distinct {
+		return clause, fmt.Errorf("for SELECT DISTINCT, ORDER BY expressions must appear in select list at position %d", sortBy.Location)
+	}
+	query.targetList = append(query.targetList, &types.TargetEntry{Expr: expr, ResName: "?column?", ResJunk: true})
+	clause.TleIndex = len(query.targetList) - 1
+	return clause, nil
+}
+
+func countNonJunk(targetList []*types.TargetEntry) int {
+	count := 0
+	for _, tle := range targetList {
+		if !tle.ResJunk {
+			count++
+		}
+	}
+	return count
+}
+
+// resolveTargetListUnknown makes output columns that are still unknown literals text
+func resolveTargetListUnknown(targetList []*types.TargetEntry) {
+	for _, tle := range targetList {
+		tle.Expr = resolveUnknown(tle.Expr)
+	}
+}
+
+// LIMIT and OFFSET are evaluated once before the query runs, so they cannot reference columns
+func transformLimitClause(clause types.Node, kind ParseExprKind) (types.Node, error) {
+	if clause == nil {
+		return nil, nil
+	}
+	pstate := &ParseState{}
+	expr, err := pstate.transformExpr(clause, kind)
+	if err != nil {
+		return nil, err
+	}
+	expr, err = coerceUnknown(expr, types.INT8OID)
+	if err != nil {
+		return nil, err
+	}
+	if exprType := types.ExprType(expr); exprType != types.INT8OID && exprType != types.INT4OID {
+		return nil, fmt.Errorf("argument of %s must be type bigint, not type %s", kind, adt.TypeName(exprType))
+	}
+	return expr, nil
+}
+
+/*
+openResultRelation opens the table an INSERT, UPDATE or DELETE changes (postgres setTargetTable), verb is
+what the statement does to it for the error messages
+*/
+func openResultRelation(rv *types.RangeVar, verb string) (*catalog.Relation, *RangeTblEntry, error) {
+	rel, err := catalog.OpenRelation(rv.Schemaname, rv.Relname)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch {
+	case rel.Relkind == catalog.RELKIND_VIEW:
+		return nil, nil, fmt.Errorf("cannot %s view \"%s\" at position %d", verb, rel.Relname, rv.Location)
+	case rel.Relkind != catalog.RELKIND_RELATION:
+		return nil, nil, fmt.Errorf("cannot %s relation \"%s\", it is not a table at position %d", verb, rel.Relname, rv.Location)
+	case rel.Relid < catalog.FirstNormalObjectId:
+		return nil, nil, fmt.Errorf("permission denied: \"%s\" is a system catalog at position %d", rel.Relname, rv.Location)
+	}
+	rte := &RangeTblEntry{refname: rel.Relname, columns: rel.Columns, relation: rel}
+	if rv.Alias != "" {
+		rte.refname = rv.Alias
+	}
+	return rel, rte, nil
+}
+
+// resultColumn finds a column of the table an INSERT or UPDATE changes by name
+func resultColumn(rel *catalog.Relation, name string, location int) (int, error) {
+	for attno, col := range rel.Columns {
+		if col.Name == name {
+			return attno, nil
+		}
+	}
+	return 0, fmt.Errorf("column \"%s\" of relation \"%s\" does not exist at position %d", name, rel.Relname, location)
+}
+
+/*
+transformAssignedExpr makes a value stored in a column of the type of the column, with the casts allowed in an
+assignment, and fit its type modifier (postgres transformAssignedExpr). DEFAULT is NULL, columns have no
+other default
+*/
+func (pstate *ParseState) transformAssignedExpr(value types.Node, col catalog.Column, kind ParseExprKind, location int) (types.Node, error) {
+	if _, ok := value.(*types.SetToDefault); ok {
+		return &types.Const{ConstType: col.TypeOid, Val: nil}, nil
+	}
+	expr, err := pstate.transformExpr(value, kind)
+	if err != nil {
+		return nil, err
+	}
+	return coerceAssignment(expr, col, location)
+}
+
+func coerceAssignment(expr types.Node, col catalog.Column, location int) (types.Node, error) {
+	source := types.ExprType(expr)
+	if source != col.TypeOid && source != types.UNKNOWNOID && !adt.CanCoerce(source, col.TypeOid, adt.COERCION_ASSIGNMENT) {
+		return nil, fmt.Errorf("column \"%s\" is of type %s but expression is of type %s at position %d",
+			col.Name, adt.TypeName(col.TypeOid), adt.TypeName(source), location)
+	}
+	expr, err := coerceType(expr, col.TypeOid)
+	if err == nil {
+		expr, err = coerceTypmod(expr, col.TypeOid, col.Typmod)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%v at position %d", err, location)
+	}
+	return expr, nil
+}
+
+// transformReturningList analyzes RETURNING, over the columns of the table changed
+func (pstate *ParseState) transformReturningList(returningList []*types.ResTarget) ([]*types.TargetEntry, error) {
+	targetList, err := pstate.transformTargetList(returningList, EXPR_KIND_RETURNING)
+	if err != nil {
+		return nil, err
+	}
+	resolveTargetListUnknown(targetList)
+	return targetList, nil
+}
+
+/*
+transformInsertStmt analyzes an INSERT (postgres transformInsertStmt). Each row inserted is a whole row of the
+table with its columns in order: the values given for the columns listed, all of them without a list, and
+NULL for the others. The rows of VALUES are in valuesLists, those of a SELECT are its targetList over the
+SELECT as a subquery in rte
+*/
+func transformInsertStmt(stmt *types.InsertStmt) (*Query, error) {
+	rel, rte, err := openResultRelation(stmt.Relation, "insert into")
+	if err != nil {
+		return nil, err
+	}
+	//The column each value goes in and where it was named
+	var attnos, locations []int
+	if len(stmt.Cols) == 0 {
+		for attno := range rel.Columns {
+			attnos = append(attnos, attno)
+			locations = append(locations, stmt.Relation.Location)
+		}
+	}
+	for _, target := range stmt.Cols {
+		attno, err := resultColumn(rel, target.Name, target.Location)
+		if err != nil {
+			return nil, err
+		}
+		for _, other := range attnos {
+			if other == attno {
+				return nil, fmt.Errorf("column \"%s\" specified more than once at position %d", target.Name, target.Location)
+			}
+		}
+		attnos = append(attnos, attno)
+		locations = append(locations, target.Location)
+	}
+	checkCount := func(n int) error {
+		switch {
+		case n > len(attnos):
+			return fmt.Errorf("INSERT has more expressions than target columns at position %d", stmt.Relation.Location)
+		case n < len(attnos) && len(stmt.Cols) > 0:
+			return fmt.Errorf("INSERT has more target columns than expressions at position %d", stmt.Cols[n].Location)
+		}
+		return nil
+	}
+	//A row of NULLs the values are put into
+	makeRow := func() []*types.TargetEntry {
+		row := make([]*types.TargetEntry, len(rel.Columns))
+		for attno, col := range rel.Columns {
+			row[attno] = &types.TargetEntry{Expr: &types.Const{ConstType: col.TypeOid, Val: nil}, ResName: col.Name}
+		}
+		return row
+	}
+
+	query := &Query{commandType: types.CMD_INSERT, resultRelation: rel}
+	switch {
+	case stmt.SelectStmt != nil:
+		subquery, err := transformStmt(stmt.SelectStmt, nil)
+		if err != nil {
+			return nil, err
+		}
+		columns := nonJunkColumns(subquery.targetList)
+		if err := checkCount(len(columns)); err != nil {
+			return nil, err
+		}
+		//Literals of the SELECT take the type of their column, as in VALUES
+		for i, tle := range columns {
+			if subquery.setOp == types.SETOP_NONE {
+				if tle.Expr, err = coerceUnknown(tle.Expr, rel.Columns[attnos[i]].TypeOid); err != nil {
+					return nil, fmt.Errorf("%v at position %d", err, locations[i])
+				}
+			}
+		}
+		resolveTargetListUnknown(subquery.targetList)
+		query.rte = &RangeTblEntry{refname: "*SELECT*", subquery: subquery, columns: subqueryColumns(subquery.targetList, nil)}
+		query.targetList = makeRow()
+		for i := range columns {
+			attno := attnos[i]
+			if query.targetList[attno].Expr, err = coerceAssignment(query.rte.columnExpr(i, 0, 0), rel.Columns[attno], locations[i]); err != nil {
+				return nil, err
+			}
+		}
+
+	case len(stmt.ValuesLists) > 0:
+		pstate := &ParseState{}
+		for _, values := range stmt.ValuesLists {
+			if len(values) != len(stmt.ValuesLists[0]) {
+				return nil, fmt.Errorf("VALUES lists must all be the same length at position %d", stmt.Relation.Location)
+			}
+			if err := checkCount(len(values)); err != nil {
+				return nil, err
+			}
+			row := makeRow()
+			for i, value := range values {
+				attno := attnos[i]
+				if row[attno].Expr, err = pstate.transformAssignedExpr(value, rel.Columns[attno], EXPR_KIND_VALUES, locations[i]); err != nil {
+					return nil, err
+				}
+			}
+			query.valuesLists = append(query.valuesLists, row)
+		}
+
+	default:
+		//DEFAULT VALUES
+		query.valuesLists = [][]*types.TargetEntry{makeRow()}
+	}
+
+	pstate := &ParseState{rte: rte}
+	if query.returningList, err = pstate.transformReturningList(stmt.ReturningList); err != nil {
+		return nil, err
+	}
+	return query, nil
+}
+
+/*
+transformUpdateStmt analyzes an UPDATE (postgres transformUpdateStmt). rte is the table, the targetList is
+the new version of a row: the value of SET for the columns it names and the column as it is for the others
+*/
+func transformUpdateStmt(stmt *types.UpdateStmt) (*Query, error) {
+	rel, rte, err := openResultRelation(stmt.Relation, "update")
+	if err != nil {
+		return nil, err
+	}
+	pstate := &ParseState{rte: rte}
+	query := &Query{commandType: types.CMD_UPDATE, resultRelation: rel, rte: rte}
+	query.targetList = make([]*types.TargetEntry, len(rel.Columns))
+	for attno, col := range rel.Columns {
+		query.targetList[attno] = &types.TargetEntry{Expr: rte.columnExpr(attno, 0, 0), ResName: col.Name}
+	}
+	assigned := make(map[int]bool)
+	for _, target := range stmt.TargetList {
+		attno, err := resultColumn(rel, target.Name, target.Location)
+		if err != nil {
+			return nil, err
+		}
+		if assigned[attno] {
+			return nil, fmt.Errorf("multiple assignments to same column \"%s\" at position %d", target.Name, target.Location)
+		}
+		assigned[attno] = true
+		if query.targetList[attno].Expr, err = pstate.transformAssignedExpr(target.Val, rel.Columns[attno], EXPR_KIND_UPDATE_SOURCE, target.Location); err != nil {
+			return nil, err
+		}
+	}
+	if err := pstate.transformModifyQual(query, stmt.WhereClause, stmt.ReturningList); err != nil {
+		return nil, err
+	}
+	return query, nil
+}
+
+// transformDeleteStmt analyzes a DELETE (postgres transformDeleteStmt), rte is the table and there is no targetList
+func transformDeleteStmt(stmt *types.DeleteStmt) (*Query, error) {
+	rel, rte, err := openResultRelation(stmt.Relation, "delete from")
+	if err != nil {
+		return nil, err
+	}
+	pstate := &ParseState{rte: rte}
+	query := &Query{commandType: types.CMD_DELETE, resultRelation: rel, rte: rte}
+	if err := pstate.transformModifyQual(query, stmt.WhereClause, stmt.ReturningList); err != nil {
+		return nil, err
+	}
+	return query, nil
+}
+
+// transformModifyQual analyzes the WHERE and RETURNING of an UPDATE or DELETE
+func (pstate *ParseState) transformModifyQual(query *Query, whereClause types.Node, returningList []*types.ResTarget) error {
+	var err error
+	if whereClause != nil {
+		if query.whereClause, err = pstate.transformWhereClause(whereClause, EXPR_KIND_WHERE); err != nil {
+			return err
+		}
+	}
+	query.returningList, err = pstate.transformReturningList(returningList)
+	return err
+}
@@ -0,0 +1,50 @@
+package planner
+
+import (
+	"sort"
+
+	"github.com/rautNishan/diskquery/access"
+	"github.com/rautNishan/diskquery/catalog"
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+Columnar paths
+
+A columnar table whose columnar file is current is scanned from that file instead of the relation file,
+unless an index can be used: the index finds the rows, the zone maps can only skip chunk groups. The zone
+keys are the conditions of WHERE a btree index could search a single column with (see matchIndexClause), on any
+column
+*/
+
+// makeColumnarScan returns a ColumnarScan of rel reading the columns in used
+func makeColumnarScan(rel *catalog.Relation, where types.Node, colTypes []types.Oid, used map[int]bool) *types.ColumnarScan {
+	scan := &types.ColumnarScan{
+		Plan:     types.Plan{Qual: where},
+		Relid:    rel.Relid,
+		Relname:  rel.Relname,
+		FilePath: rel.FilePath,
+		ColTypes: colTypes,
+	}
+	for attno := range used {
+		scan.AttNos = append(scan.AttNos, attno)
+	}
+	sort.Ints(scan.AttNos)
+
+	for _, cond := range conjuncts(where) {
+		op, ok := cond.(*types.OpExpr)
+		if !ok {
+			continue
+		}
+		for _, arg := range op.Args {
+			if v, ok := arg.(*types.Var); ok && v.LevelsUp == 0 {
+				if zoneKey, ok := matchIndexClause(cond, v, access.GetIndexAmRoutine(access.BTREE_AM_NAME)); ok {
+					zoneKey.AttNo = v.AttNo
+					scan.ZoneKeys = append(scan.ZoneKeys, zoneKey)
+					break
+				}
+			}
+		}
+	}
+	return scan
+}
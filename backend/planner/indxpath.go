@@ -0,0 +1,309 @@
+package planner
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/rautNishan/diskquery/access"
+	"github.com/rautNishan/diskquery/adt"
+	"github.com/rautNishan/diskquery/catalog"
+	"github.com/rautNishan/diskquery/parser"
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+Index paths (postgres optimizer/path/indxpath.c)
+
+We have no costs to weigh a scan against another, an index is used whenever WHERE restricts its first key.
+The AND-ed conditions of WHERE of the form key op value, op one of = < <= > >= and value a constant or an
+outer query's column, are the clauses an index can search with: = on a prefix of the index columns and then
+any of them on the next column, only = for a hash index. A gin index of jsonb searches with key @> value, or
+value <@ key, and every such condition is a scan key. An ordered index searches key LIKE 'abc%' as the range
+from 'abc' up to 'abd' (see matchLikePrefix). The index searching on the most columns is taken,
+one having all the columns the query reads over the others, then a hash index over a btree one and the first
+made of those left. With all the columns in the index the scan is index-only, the relation file is not read.
+
+A partial index only has some of the rows, it is used when each condition of its predicate is one of the
+conditions of WHERE written the same way. An index built before its relation file last changed points at
+rows that may not be there anymore and is left alone
+*/
+
+// The operator with the arguments swapped, value op key is key commutator value
+var commutators = map[string]string{
+	"<": ">", "<=": ">=", "=": "=", ">=": "<=", ">": "<",
+
+	"<@": "@>",
+}
+
+/*
+makeIndexScan returns an IndexScan of rel for the conditions of where, nil when no index can be used. When
+every column in used is in the index the scan is an IndexOnlyScan. The definitions of the indexes are
+analyzed again from pg_index for every query
+*/
+func makeIndexScan(rel *catalog.Relation, where types.Node, colTypes []types.Oid, used map[int]bool) (types.PlanNode, error) {
+	conds := conjuncts(where)
+	if len(conds) == 0 {
+		return nil, nil
+	}
+
+	var best *types.IndexScan
+	var bestAttNos []int
+	bestColumns, bestIndexOnly, bestOrdered := 0, false, false
+	for _, index := range rel.Indexes {
+		info, err := AnalyzeIndexDefinition(index, rel)
+		if err != nil {
+			return nil, err
+		}
+		if !access.IndexIsCurrent(info.AccessMethod, index.FilePath, rel.FilePath) || !predicateImplied(info.Predicate, conds) {
+			continue
+		}
+		am := access.GetIndexAmRoutine(info.AccessMethod)
+		scanKeys, columns := matchIndexClauses(info, am, conds)
+		if columns == 0 || columns < bestColumns {
+			continue
+		}
+		attnos, indexOnly := indexReturnsColumns(info, am, used)
+		//Of indexes searching as many columns one that makes reading the relation file unnecessary is better,
+		//then a hash index, which reads a bucket where a btree index is read whole
+		if columns == bestColumns {
+			if indexOnly != bestIndexOnly {
+				if !indexOnly {
+					continue
+				}
+			} else if am.CanOrder || !bestOrdered {
+				continue
+			}
+		}
+		bestColumns, bestIndexOnly, bestOrdered = columns, indexOnly, am.CanOrder
+		bestAttNos = attnos
+		best = &types.IndexScan{
+			Plan:         types.Plan{Qual: where},
+			Relid:        rel.Relid,
+			Relname:      rel.Relname,
+			FilePath:     rel.FilePath,
+			ColTypes:     colTypes,
+			IndexName:    index.Name,
+			IndexPath:    index.FilePath,
+			AccessMethod: info.AccessMethod,
+			IndexKeys:    info.Keys,
+			IndexInclude: info.Include,
+			ScanKeys:     scanKeys,
+		}
+	}
+	switch {
+	case best == nil:
+		return nil, nil
+	case bestIndexOnly:
+		return &types.IndexOnlyScan{IndexScan: *best, IndexAttNos: bestAttNos}, nil
+	}
+	return best, nil
+}
+
+/*
+indexReturnsColumns tells if the entries of an index have every column in used, and which column each of
+their values is (see IndexOnlyScan). An expression key is not a column even when its value is all a query
+needs, postgres would match the expression
+*/
+func indexReturnsColumns(info *types.IndexInfo, am *access.IndexAmRoutine, used map[int]bool) ([]int, bool) {
+	if !am.CanReturn {
+		return nil, false
+	}
+	attnos := make([]int, len(info.Indkey))
+	has := make(map[int]bool, len(info.Indkey))
+	for i, attnum := range info.Indkey {
+		attnos[i] = attnum - 1
+		has[attnum-1] = true
+	}
+	for attno := range used {
+		if !has[attno] {
+			return nil, false
+		}
+	}
+	return attnos, true
+}
+
+/*
+queryUsedColumns is every column of the FROM relation the query reads, in any of the expressions
+preprocessQuery goes through and in the keys of the semi joins. The columns a correlated subquery reads
+are in the arguments of its SubPlan
+*/
+func queryUsedColumns(query *Query, joins []*semiJoin) map[int]bool {
+	used := make(map[int]bool)
+	collect := func(expr types.Node) {
+		types.ExprWalker(expr, func(node types.Node) bool {
+			if v, ok := node.(*types.Var); ok && v.LevelsUp == 0 {
+				used[v.AttNo] = true
+			}
+			return true
+		})
+	}
+	for _, tle := range query.targetList {
+		collect(tle.Expr)
+	}
+	collect(query.whereClause)
+	for _, expr := range query.groupClause {
+		collect(expr)
+	}
+	collect(query.having)
+	for _, wc := range query.windowClause {
+		for _, expr := range wc.partitionClause {
+			collect(expr)
+		}
+		for _, clause := range wc.orderClause {
+			collect(clause.Expr)
+		}
+		collect(wc.startOffset)
+		collect(wc.endOffset)
+	}
+	for _, aggref := range query.aggs {
+		collect(aggref)
+	}
+	for _, join := range joins {
+		for _, key := range join.outerKeys {
+			collect(key)
+		}
+	}
+	return used
+}
+
+// AnalyzeIndexDefinition analyzes the CREATE INDEX statement pg_index keeps for an index
+func AnalyzeIndexDefinition(index *catalog.Index, rel *catalog.Relation) (*types.IndexInfo, error) {
+	stmts, err := parser.RawParse(index.Indexdef, parser.RAW_PARSE_DEFAULT)
+	if err != nil {
+		return nil, fmt.Errorf("invalid definition of index \"%s\": %v", index.Name, err)
+	}
+	stmt, ok := stmts[0].(*types.IndexStmt)
+	if len(stmts) != 1 || !ok {
+		return nil, fmt.Errorf("invalid definition of index \"%s\"", index.Name)
+	}
+	return TransformIndexStmt(stmt, rel)
+}
+
+// predicateImplied tells if every condition of a partial index's predicate is a condition of WHERE
+func predicateImplied(predicate types.Node, conds []types.Node) bool {
+	for _, predCond := range conjuncts(predicate) {
+		found := false
+		for _, cond := range conds {
+			if reflect.DeepEqual(predCond, cond) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+matchIndexClauses picks the scan keys for an index: the first = on each column as long as there is one,
+then every comparison on the column that has no = if the index is ordered. columns is how many index columns
+are searched on
+*/
+func matchIndexClauses(info *types.IndexInfo, am *access.IndexAmRoutine, conds []types.Node) (scanKeys []types.ScanKey, columns int) {
+	for attno, key := range info.Keys {
+		var ranges []types.ScanKey
+		equality := false
+		for _, cond := range conds {
+			var condKeys []types.ScanKey
+			if scanKey, ok := matchIndexClause(cond, key.Expr, am); ok {
+				condKeys = []types.ScanKey{scanKey}
+			} else if am.CanOrder {
+				condKeys = matchLikePrefix(cond, key.Expr)
+			}
+			if len(condKeys) == 0 {
+				continue
+			}
+			for i := range condKeys {
+				condKeys[i].AttNo = attno
+			}
+			if len(condKeys) == 1 && condKeys[0].Strategy == types.BTEqualStrategyNumber {
+				scanKeys = append(scanKeys, condKeys[0])
+				equality = true
+				break
+			}
+			ranges = append(ranges, condKeys...)
+		}
+		if equality {
+			columns++
+			continue
+		}
+		if len(ranges) > 0 {
+			scanKeys = append(scanKeys, ranges...)
+			columns++
+		}
+		break
+	}
+	return scanKeys, columns
+}
+
+// matchIndexClause tells if cond is keyExpr op value or value op keyExpr with an operator the index searches with
+func matchIndexClause(cond types.Node, keyExpr types.Node, am *access.IndexAmRoutine) (types.ScanKey, bool) {
+	//The comparisons are the executor's own operators and @> is adt's, for jsonb on both sides as the argument
+	//has the key's type
+	op, ok := cond.(*types.OpExpr)
+	if !ok || len(op.Args) != 2 {
+		return types.ScanKey{}, false
+	}
+	keyType := types.ExprType(keyExpr)
+	if strategy, ok := am.Strategies[op.Op]; ok && reflect.DeepEqual(op.Args[0], keyExpr) && isIndexArgument(op.Args[1], keyType) {
+		return types.ScanKey{Strategy: strategy, Arg: op.Args[1]}, true
+	}
+	if strategy, ok := am.Strategies[commutators[op.Op]]; ok && reflect.DeepEqual(op.Args[1], keyExpr) && isIndexArgument(op.Args[0], keyType) {
+		return types.ScanKey{Strategy: strategy, Arg: op.Args[0]}, true
+	}
+	return types.ScanKey{}, false
+}
+
+/*
+matchLikePrefix returns the scan keys of key LIKE 'pattern' for an ordered index when the pattern starts with
+literal characters (postgres prefix_quals): key >= prefix and key < the next string after every string starting
+with prefix, or key = pattern when it has no wildcards. The LIKE stays in the qual and sorts out the rows of
+the range that do not match
+*/
+func matchLikePrefix(cond types.Node, keyExpr types.Node) []types.ScanKey {
+	op, ok := cond.(*types.OpExpr)
+	if !ok || op.Op != "~~" || len(op.Args) != 2 || types.ExprType(keyExpr) != types.TEXTOID || !reflect.DeepEqual(op.Args[0], keyExpr) {
+		return nil
+	}
+	pattern, ok := op.Args[1].(*types.Const)
+	if !ok || pattern.Val == nil || pattern.ConstType != types.TEXTOID {
+		return nil
+	}
+	prefix, exact := adt.LikeFixedPrefix(pattern.Val.(string))
+	switch {
+	case exact:
+		return []types.ScanKey{{Strategy: types.BTEqualStrategyNumber, Arg: &types.Const{ConstType: types.TEXTOID, Val: prefix}}}
+	case prefix == "":
+		return nil
+	}
+	scanKeys := []types.ScanKey{{Strategy: types.BTGreaterEqualStrategyNumber, Arg: &types.Const{ConstType: types.TEXTOID, Val: prefix}}}
+	if greater, ok := adt.MakeGreaterString(prefix); ok {
+		scanKeys = append(scanKeys, types.ScanKey{Strategy: types.BTLessStrategyNumber, Arg: &types.Const{ConstType: types.TEXTOID, Val: greater}})
+	}
+	return scanKeys
+}
+
+/*
+isIndexArgument tells if the scan can compare the index column with arg: a value known when the scan starts,
+of the key's type or, as all of them are int64 datums, of another integer type. A literal whose conversion
+depends on the session is a CoerceExpr of a Const, it is known as well
+*/
+func isIndexArgument(arg types.Node, keyType types.Oid) bool {
+	switch a := arg.(type) {
+	case *types.Const, *types.Param:
+	case *types.CoerceExpr:
+		if _, ok := a.Arg.(*types.Const); !ok {
+			return false
+		}
+	default:
+		return false
+	}
+	argType := types.ExprType(arg)
+	return argType == keyType || isIntegerType(argType) && isIntegerType(keyType)
+}
+
+func isIntegerType(typ types.Oid) bool {
+	return typ == types.INT2OID || typ == types.INT4OID || typ == types.INT8OID
+}
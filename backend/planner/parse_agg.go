@@ -0,0 +1,214 @@
+package planner
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/rautNishan/diskquery/adt"
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+Aggregate functions we know about
+resultType checks the argument types and returns the type of the aggregate's result
+The transition functions that do the actual work live in executor/nodeAgg.go
+*/
+type aggregateDef struct {
+	nargs      int
+	resultType func(argTypes []types.Oid) (types.Oid, bool)
+}
+
+// sum of smallint and integer is a bigint, of bigint a numeric so it cannot overflow, as in postgres
+func sumResult(argTypes []types.Oid) (types.Oid, bool) {
+	switch argTypes[0] {
+	case types.INT2OID, types.INT4OID:
+		return types.INT8OID, true
+	case types.INT8OID, types.NUMERICOID:
+		return types.NUMERICOID, true
+	case types.FLOAT8OID:
+		return types.FLOAT8OID, true
+	}
+	return types.InvalidOid, false
+}
+
+// avg of any integer is a numeric, of double precision a double precision
+func avgResult(argTypes []types.Oid) (types.Oid, bool) {
+	if argTypes[0] == types.FLOAT8OID {
+		return types.FLOAT8OID, true
+	}
+	return types.NUMERICOID, isNumericType(argTypes[0])
+}
+
+func sameAsInput(argTypes []types.Oid) (types.Oid, bool) {
+	if adt.ArrayTypeOf(argTypes[0]) == types.InvalidOid {
+		return types.InvalidOid, false
+	}
+	return argTypes[0], true
+}
+
+func boolResult(argTypes []types.Oid) (types.Oid, bool) {
+	return types.BOOLOID, argTypes[0] == types.BOOLOID
+}
+
+var aggregates = map[string]aggregateDef{
+	"count":    {nargs: 1, resultType: func([]types.Oid) (types.Oid, bool) { return types.INT8OID, true }},
+	"sum":      {nargs: 1, resultType: sumResult},
+	"avg":      {nargs: 1, resultType: avgResult},
+	"min":      {nargs: 1, resultType: sameAsInput},
+	"max":      {nargs: 1, resultType: sameAsInput},
+	"bool_and": {nargs: 1, resultType: boolResult},
+	"bool_or":  {nargs: 1, resultType: boolResult},
+	"every":    {nargs: 1, resultType: boolResult},
+	"string_agg": {nargs: 2, resultType: func(argTypes []types.Oid) (types.Oid, bool) {
+		return types.TEXTOID, argTypes[0] == types.TEXTOID && argTypes[1] == types.TEXTOID
+	}},
+	"array_agg": {nargs: 1, resultType: func(argTypes []types.Oid) (types.Oid, bool) {
+		arrayType := adt.ArrayTypeOf(argTypes[0])
+		return arrayType, arrayType != types.InvalidOid
+	}},
+
+	//The json aggregates take values of any type
+	"json_agg":         {nargs: 1, resultType: func([]types.Oid) (types.Oid, bool) { return types.JSONOID, true }},
+	"jsonb_agg":        {nargs: 1, resultType: func([]types.Oid) (types.Oid, bool) { return types.JSONBOID, true }},
+	"json_object_agg":  {nargs: 2, resultType: func([]types.Oid) (types.Oid, bool) { return types.JSONOID, true }},
+	"jsonb_object_agg": {nargs: 2, resultType: func([]types.Oid) (types.Oid, bool) { return types.JSONBOID, true }},
+}
+
+func (pstate *ParseState) transformAggregateCall(fn *types.FuncCall) (types.Node, error) {
+	switch pstate.exprKind {
+	case EXPR_KIND_WHERE, EXPR_KIND_GROUP_BY, EXPR_KIND_FILTER, EXPR_KIND_LIMIT, EXPR_KIND_OFFSET,
+		EXPR_KIND_WINDOW_FRAME_RANGE, EXPR_KIND_WINDOW_FRAME_ROWS, EXPR_KIND_WINDOW_FRAME_GROUPS, EXPR_KIND_FROM_FUNCTION,
+		EXPR_KIND_JOIN_ON, EXPR_KIND_INDEX_EXPRESSION, EXPR_KIND_INDEX_PREDICATE, EXPR_KIND_VALUES, EXPR_KIND_UPDATE_SOURCE,
+		EXPR_KIND_RETURNING:
+		return nil, fmt.Errorf("aggregate functions are not allowed in %s at position %d", pstate.exprKind, fn.Location)
+	}
+	if pstate.inAgg {
+		return nil, fmt.Errorf("aggregate function calls cannot be nested at position %d", fn.Location)
+	}
+
+	def := aggregates[fn.Funcname]
+	aggref := &types.Aggref{AggName: fn.Funcname, AggStar: fn.AggStar, AggDistinct: fn.AggDistinct}
+
+	if fn.AggStar {
+		if fn.Funcname != "count" {
+			return nil, fmt.Errorf("%s(*) is not supported, only count(*) at position %d", fn.Funcname, fn.Location)
+		}
+	} else if len(fn.Args) != def.nargs {
+		return nil, fmt.Errorf("function %s with %d arguments does not exist at position %d", fn.Funcname, len(fn.Args), fn.Location)
+	}
+
+	pstate.inAgg = true
+	defer func() { pstate.inAgg = false }()
+
+	argTypes := make([]types.Oid, 0, len(fn.Args))
+	for _, rawArg := range fn.Args {
+		arg, err := pstate.transformExprRecurse(rawArg)
+		if err != nil {
+			return nil, err
+		}
+		arg = resolveUnknown(arg)
+		aggref.Args = append(aggref.Args, arg)
+		argTypes = append(argTypes, types.ExprType(arg))
+	}
+
+	if fn.AggStar {
+		aggref.AggType = types.INT8OID
+	} else {
+		resultType, ok := def.resultType(argTypes)
+		if !ok {
+			return nil, fmt.Errorf("function %s(%s) does not exist at position %d", fn.Funcname, typeNames(argTypes), fn.Location)
+		}
+		aggref.AggType = resultType
+	}
+
+	if fn.AggFilter != nil {
+		savedKind := pstate.exprKind
+		pstate.exprKind = EXPR_KIND_FILTER
+		filter, err := pstate.transformExprRecurse(fn.AggFilter)
+		pstate.exprKind = savedKind
+		if err != nil {
+			return nil, err
+		}
+		filter, err = coerceUnknown(filter, types.BOOLOID)
+		if err != nil {
+			return nil, err
+		}
+		if filterType := types.ExprType(filter); filterType != types.BOOLOID {
+			return nil, fmt.Errorf("argument of FILTER must be type boolean, not type %s at position %d", adt.TypeName(filterType), fn.Location)
+		}
+		aggref.AggFilter = filter
+	}
+
+	aggref.AggNo = len(pstate.aggs)
+	pstate.aggs = append(pstate.aggs, aggref)
+	return aggref, nil
+}
+
+func typeNames(typs []types.Oid) string {
+	names := ""
+	for i, typ := range typs {
+		if i > 0 {
+			names += ", "
+		}
+		names += adt.TypeName(typ)
+	}
+	return names
+}
+
+/*
+checkUngroupedColumns makes sure that in a grouped query every column reference outside of an
+aggregate is (part of) a GROUP BY expression, otherwise its value within a group is ambiguous
+*/
+func checkUngroupedColumns(expr types.Node, groupExprs []types.Node) error {
+	var err error
+	types.ExprWalker(expr, func(node types.Node) bool {
+		if err != nil {
+			return false
+		}
+		for _, groupExpr := range groupExprs {
+			if reflect.DeepEqual(node, groupExpr) {
+				return false
+			}
+		}
+		switch n := node.(type) {
+		case *types.Aggref:
+			return false
+		case *types.Var:
+			//Columns of an outer query are constant while this query runs
+			if n.LevelsUp == 0 {
+				err = fmt.Errorf("column \"%s\" must appear in the GROUP BY clause or be used in an aggregate function", n.Name)
+			}
+			return false
+		case *types.SubLink:
+			//The subquery runs once per group, it can only look at our grouped columns
+			walkQuery(n.Subselect.(*Query), 1, func(inner types.Node, levelsUp int) bool {
+				if v, ok := inner.(*types.Var); ok && v.LevelsUp == levelsUp && !isGroupedColumn(v, groupExprs) {
+					err = fmt.Errorf("subquery uses ungrouped column \"%s\" from outer query", v.Name)
+				}
+				return err == nil
+			})
+		}
+		return true
+	})
+	return err
+}
+
+func isGroupedColumn(outerVar *types.Var, groupExprs []types.Node) bool {
+	for _, groupExpr := range groupExprs {
+		if v, ok := groupExpr.(*types.Var); ok && v.AttNo == outerVar.AttNo && v.LevelsUp == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAggregate(expr types.Node) bool {
+	found := false
+	types.ExprWalker(expr, func(node types.Node) bool {
+		if _, ok := node.(*types.Aggref); ok {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
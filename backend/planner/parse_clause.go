@@ -0,0 +1,227 @@
+package planner
+
+import (
+	"fmt"
+
+	"github.com/rautNishan/diskquery/adt"
+	"github.com/rautNishan/diskquery/catalog"
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+Joins in FROM
+
+A join is a FROM item of its own that reads the tuples of its two sides next to each other, left first,
+so a column of either side is found at its position in that side plus the width of what is left of it.
+FROM a, b is a cross join of a and b. What the join shows as its columns are those of both sides,
+except that the columns of USING (or NATURAL) are merged into one, which comes first
+*/
+
+// joinColumn is a column of a join, the column of the left and of the right side it is, -1 for neither
+type joinColumn struct {
+	left  int
+	right int
+}
+
+// transformFromClause analyzes the FROM list, several items are joined without a condition
+func (pstate *ParseState) transformFromClause(items []types.Node) (*RangeTblEntry, error) {
+	var rte *RangeTblEntry
+	for _, item := range items {
+		next, err := pstate.transformFromItem(item)
+		if err != nil {
+			return nil, err
+		}
+		if rte == nil {
+			rte = next
+			continue
+		}
+		if rte, err = makeJoinRte(types.JOIN_INNER, rte, next, 0); err != nil {
+			return nil, err
+		}
+	}
+	return rte, nil
+}
+
+func (pstate *ParseState) transformJoinExpr(j *types.JoinExpr) (*RangeTblEntry, error) {
+	larg, err := pstate.transformFromItem(j.Larg)
+	if err != nil {
+		return nil, err
+	}
+	rarg, err := pstate.transformFromItem(j.Rarg)
+	if err != nil {
+		return nil, err
+	}
+	rte, err := makeJoinRte(j.JoinType, larg, rarg, j.Location)
+	if err != nil {
+		return nil, err
+	}
+
+	using := j.UsingClause
+	if j.IsNatural {
+		for _, col := range larg.columns {
+			if idx, _ := rarg.columnIndex(col.Name, j.Location); idx >= 0 {
+				using = append(using, col.Name)
+			}
+		}
+	}
+	if len(using) > 0 {
+		return rte, rte.mergeUsingColumns(using, j.Location)
+	}
+	if j.Quals == nil {
+		return rte, nil
+	}
+
+	//ON only sees the two sides of its own join
+	saved := pstate.rte
+	pstate.rte = rte
+	quals, err := pstate.transformExpr(j.Quals, EXPR_KIND_JOIN_ON)
+	pstate.rte = saved
+	if err != nil {
+		return nil, err
+	}
+	if quals, err = coerceUnknown(quals, types.BOOLOID); err != nil {
+		return nil, err
+	}
+	if qualType := types.ExprType(quals); qualType != types.BOOLOID {
+		return nil, fmt.Errorf("argument of JOIN/ON must be type boolean, not type %s at position %d", adt.TypeName(qualType), j.Location)
+	}
+	rte.joinQuals = quals
+	return rte, nil
+}
+
+// makeJoinRte joins larg and rarg without a condition, the join shows all their columns
+func makeJoinRte(joinType types.JoinType, larg *RangeTblEntry, rarg *RangeTblEntry, location int) (*RangeTblEntry, error) {
+	for _, refname := range larg.refnames() {
+		if refname == "" {
+			continue
+		}
+		if found, _ := rarg.findRefname(refname, 0); found != nil {
+			return nil, fmt.Errorf("table name \"%s\" specified more than once at position %d", refname, location)
+		}
+	}
+	rte := &RangeTblEntry{joinType: joinType, larg: larg, rarg: rarg}
+	for i, col := range larg.columns {
+		rte.columns = append(rte.columns, col)
+		rte.joinCols = append(rte.joinCols, joinColumn{left: i, right: -1})
+	}
+	for i, col := range rarg.columns {
+		rte.columns = append(rte.columns, col)
+		rte.joinCols = append(rte.joinCols, joinColumn{left: -1, right: i})
+	}
+	return rte, nil
+}
+
+/*
+mergeUsingColumns makes each USING column a single column of the join, put before all others.
+It is the left side's column in inner and left joins, the right side's in right joins and the one of the two
+that is not NULL in full joins. The join condition is that the two are equal
+*/
+func (rte *RangeTblEntry) mergeUsingColumns(using []string, location int) error {
+	var columns []catalog.Column
+	var joinCols []joinColumn
+	var quals []types.Node
+	merged := make(map[joinColumn]bool)
+	for i, name := range using {
+		for _, other := range using[:i] {
+			if other == name {
+				return fmt.Errorf("column name \"%s\" appears more than once in USING clause at position %d", name, location)
+			}
+		}
+		left, err := rte.larg.columnIndex(name, location)
+		if err != nil {
+			return err
+		}
+		if left < 0 {
+			return fmt.Errorf("column \"%s\" specified in USING clause does not exist in left table at position %d", name, location)
+		}
+		right, err := rte.rarg.columnIndex(name, location)
+		if err != nil {
+			return err
+		}
+		if right < 0 {
+			return fmt.Errorf("column \"%s\" specified in USING clause does not exist in right table at position %d", name, location)
+		}
+		ltype, rtype := rte.larg.columns[left].TypeOid, rte.rarg.columns[right].TypeOid
+		colType, err := selectCommonType("JOIN/USING", ltype, rtype)
+		if err != nil {
+			return fmt.Errorf("%v at position %d", err, location)
+		}
+		qual, err := makeOpExpr("=", rte.larg.columnExpr(left, 0, 0), rte.rarg.columnExpr(right, rte.larg.width(), 0), location)
+		if err != nil {
+			return err
+		}
+		quals = append(quals, qual)
+		columns = append(columns, catalog.Column{Name: name, TypeOid: colType})
+		joinCols = append(joinCols, joinColumn{left: left, right: right})
+		merged[joinColumn{left: left, right: -1}] = true
+		merged[joinColumn{left: -1, right: right}] = true
+	}
+	for i, jc := range rte.joinCols {
+		if !merged[jc] {
+			columns = append(columns, rte.columns[i])
+			joinCols = append(joinCols, jc)
+		}
+	}
+	rte.columns, rte.joinCols = columns, joinCols
+	rte.joinQuals = makeAnd(quals)
+	return nil
+}
+
+// width is the number of columns in the tuples the FROM item reads
+func (rte *RangeTblEntry) width() int {
+	if rte.larg != nil {
+		return rte.larg.width() + rte.rarg.width()
+	}
+	return len(rte.columns)
+}
+
+// refnames are the names the columns of the FROM item can be qualified with, those of both sides of a join
+func (rte *RangeTblEntry) refnames() []string {
+	if rte.larg != nil {
+		return append(rte.larg.refnames(), rte.rarg.refnames()...)
+	}
+	return []string{rte.refname}
+}
+
+// findRefname finds the FROM item called relname inside rte, whose tuple starts at offset, and where its tuple starts
+func (rte *RangeTblEntry) findRefname(relname string, offset int) (*RangeTblEntry, int) {
+	if rte.larg == nil {
+		if rte.refname == relname {
+			return rte, offset
+		}
+		return nil, 0
+	}
+	if found, at := rte.larg.findRefname(relname, offset); found != nil {
+		return found, at
+	}
+	return rte.rarg.findRefname(relname, offset+rte.larg.width())
+}
+
+// columnExpr is the expression reading column attno of the FROM item, whose tuple starts at offset
+func (rte *RangeTblEntry) columnExpr(attno int, offset int, levelsUp int) types.Node {
+	col := rte.columns[attno]
+	if rte.larg == nil {
+		return &types.Var{AttNo: offset + attno, Name: col.Name, VarType: col.TypeOid, LevelsUp: levelsUp}
+	}
+
+	sideExpr := func(side *RangeTblEntry, attno int, offset int) types.Node {
+		expr := side.columnExpr(attno, offset, levelsUp)
+		if types.ExprType(expr) != col.TypeOid {
+			expr = &types.CoerceExpr{Arg: expr, ResultType: col.TypeOid, ResultTypmod: -1}
+		}
+		return expr
+	}
+	jc := rte.joinCols[attno]
+	switch {
+	case jc.right < 0:
+		return sideExpr(rte.larg, jc.left, offset)
+	case jc.left < 0, rte.joinType == types.JOIN_RIGHT:
+		return sideExpr(rte.rarg, jc.right, offset+rte.larg.width())
+	case rte.joinType == types.JOIN_FULL:
+		return &types.CoalesceExpr{CoalesceType: col.TypeOid, Args: []types.Node{
+			sideExpr(rte.larg, jc.left, offset),
+			sideExpr(rte.rarg, jc.right, offset+rte.larg.width()),
+		}}
+	}
+	return sideExpr(rte.larg, jc.left, offset)
+}
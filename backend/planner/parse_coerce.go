@@ -0,0 +1,177 @@
+package planner
+
+import (
+	"fmt"
+
+	"github.com/rautNishan/diskquery/adt"
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+Type coercion of expressions (postgres parser/parse_coerce.c)
+Which conversions are allowed where is decided by the casts in adt, here they become CoerceExprs
+(or are done right away for constants)
+*/
+
+func isNumericType(typ types.Oid) bool {
+	return typ == types.INT8OID || typ == types.INT4OID || typ == types.INT2OID || typ == types.FLOAT8OID || typ == types.NUMERICOID
+}
+
+// numericCommonType is the type two numeric types are combined in, double precision wins over numeric over the
+// integer types, and two integers are combined in the wider of the two
+func numericCommonType(ltype types.Oid, rtype types.Oid) types.Oid {
+	switch {
+	case ltype == types.FLOAT8OID || rtype == types.FLOAT8OID:
+		return types.FLOAT8OID
+	case ltype == types.NUMERICOID || rtype == types.NUMERICOID:
+		return types.NUMERICOID
+	case ltype == types.INT8OID || rtype == types.INT8OID:
+		return types.INT8OID
+	case ltype == types.INT4OID || rtype == types.INT4OID:
+		return types.INT4OID
+	}
+	return types.INT2OID
+}
+
+// Integers and double precision need no casts between them, the executor's operators take them mixed.
+// Numeric is only combined with a value of its own type
+func isMixedNumeric(ltype types.Oid, rtype types.Oid) bool {
+	return isNumericType(ltype) && isNumericType(rtype) && ltype != types.NUMERICOID && rtype != types.NUMERICOID
+}
+
+/*
+coerceUnknown gives a string literal the type of whatever it is compared or combined with
+A type whose input depends on the session ('now', a timestamptz without a zone) is read when the statement
+runs, the planner only checks the literal is valid
+*/
+func coerceUnknown(expr types.Node, target types.Oid) (types.Node, error) {
+	c, ok := expr.(*types.Const)
+	if !ok || c.ConstType != types.UNKNOWNOID {
+		return expr, nil
+	}
+	if c.Val == nil {
+		return &types.Const{ConstType: target, Val: nil}, nil
+	}
+	//Types we cannot read a literal of leave it text
+	entry := adt.LookupType(target)
+	if entry == nil || entry.Input == nil || target == types.UNKNOWNOID {
+		return &types.Const{ConstType: types.TEXTOID, Val: c.Val}, nil
+	}
+	val, err := entry.Input(c.Val.(string), &adt.DefaultSettings)
+	if err != nil {
+		return nil, err
+	}
+	if entry.StableInput {
+		return &types.CoerceExpr{Arg: &types.Const{ConstType: types.TEXTOID, Val: c.Val}, ResultType: target, ResultTypmod: -1}, nil
+	}
+	return &types.Const{ConstType: target, Val: val}, nil
+}
+
+// resolveUnknown turns a leftover unknown literal into text
+func resolveUnknown(expr types.Node) types.Node {
+	if c, ok := expr.(*types.Const); ok && c.ConstType == types.UNKNOWNOID {
+		return &types.Const{ConstType: types.TEXTOID, Val: c.Val}
+	}
+	return expr
+}
+
+// coerceType converts expr to type target, the caller made sure a cast exists
+func coerceType(expr types.Node, target types.Oid) (types.Node, error) {
+	source := types.ExprType(expr)
+	switch {
+	case source == target:
+		return expr, nil
+	case source == types.UNKNOWNOID:
+		return coerceUnknown(expr, target)
+	}
+	if c, ok := expr.(*types.Const); ok && (c.Val == nil || !adt.CoercionIsStable(source, target)) {
+		if c.Val == nil {
+			return &types.Const{ConstType: target, Val: nil}, nil
+		}
+		val, err := adt.CoerceDatum(c.Val, source, target, &adt.DefaultSettings)
+		if err != nil {
+			return nil, err
+		}
+		return &types.Const{ConstType: target, Val: val}, nil
+	}
+	return &types.CoerceExpr{Arg: expr, ResultType: target, ResultTypmod: -1}, nil
+}
+
+// coerceTypmod makes expr, which is of type target already, fit the type modifier typmod
+func coerceTypmod(expr types.Node, target types.Oid, typmod int32) (types.Node, error) {
+	if typmod < 0 {
+		return expr, nil
+	}
+	switch e := expr.(type) {
+	case *types.Const:
+		if e.Val == nil {
+			return expr, nil
+		}
+		val, err := adt.ApplyTypmod(e.Val, target, typmod)
+		if err != nil {
+			return nil, err
+		}
+		return &types.Const{ConstType: target, Val: val}, nil
+	case *types.CoerceExpr:
+		if e.ResultTypmod < 0 {
+			return &types.CoerceExpr{Arg: e.Arg, ResultType: target, ResultTypmod: typmod}, nil
+		}
+	}
+	return &types.CoerceExpr{Arg: expr, ResultType: target, ResultTypmod: typmod}, nil
+}
+
+/*
+coerceOperands makes both operands of an operator the same type, converting the one that has an
+implicit cast to the other's type. Integers and double precision are left alone, operators take them mixed
+*/
+func coerceOperands(left types.Node, right types.Node) (types.Node, types.Node, error) {
+	ltype, rtype := types.ExprType(left), types.ExprType(right)
+	if ltype == rtype || isMixedNumeric(ltype, rtype) {
+		return left, right, nil
+	}
+	var err error
+	switch {
+	case adt.CanCoerce(ltype, rtype, adt.COERCION_IMPLICIT):
+		left, err = coerceType(left, rtype)
+	case adt.CanCoerce(rtype, ltype, adt.COERCION_IMPLICIT):
+		right, err = coerceType(right, ltype)
+	}
+	return left, right, err
+}
+
+/*
+transformTypeCast converts an expression to the named type, explicit casts are allowed.
+A literal is read by the input function of the type, as in DATE '2024-03-01', and then made to fit
+the type modifier if one is given: NUMERIC(5, 2) '3.14159' is 3.14
+*/
+func (pstate *ParseState) transformTypeCast(tc *types.TypeCast) (types.Node, error) {
+	target, ok := adt.LookupTypeName(tc.TypeName.Name)
+	if !ok {
+		return nil, fmt.Errorf("type \"%s\" does not exist at position %d", tc.TypeName.Name, tc.TypeName.Location)
+	}
+	typmod, err := adt.TypmodIn(target, tc.TypeName.Typmods)
+	if err != nil {
+		return nil, fmt.Errorf("%v at position %d", err, tc.TypeName.Location)
+	}
+	var arg types.Node
+	if array, ok := tc.Arg.(*types.AArrayExpr); ok && adt.LookupType(target).Category == adt.TYPCATEGORY_ARRAY {
+		arg, err = pstate.transformArrayExpr(array, target)
+	} else {
+		arg, err = pstate.transformExprRecurse(tc.Arg)
+	}
+	if err != nil {
+		return nil, err
+	}
+	source := types.ExprType(arg)
+	if !adt.CanCoerce(source, target, adt.COERCION_EXPLICIT) {
+		return nil, fmt.Errorf("cannot cast type %s to %s at position %d", adt.TypeName(source), adt.TypeName(target), tc.Location)
+	}
+	result, err := coerceType(arg, target)
+	if err == nil {
+		result, err = coerceTypmod(result, target, typmod)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%v at position %d", err, tc.Location)
+	}
+	return result, nil
+}
@@ -0,0 +1,438 @@
+package planner
+
+import (
+	"fmt"
+
+	"github.com/rautNishan/diskquery/adt"
+	"github.com/rautNishan/diskquery/catalog"
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+WITH queries (postgres parser/parse_cte.c)
+
+Every WITH item is analyzed together with the WITH clause, as a subquery of the query level the WITH
+belongs to but before that level's FROM is known. A table name in FROM is looked up among the WITH items
+of this and the enclosing query levels before the catalog, so a CTE hides a table of the same name.
+
+A CTE referenced once is inlined, the reference becomes a derived table. Every reference is analyzed
+again from the raw statement, so each one gets a query tree of its own.
+A CTE referenced more than once, or AS MATERIALIZED, runs once and every reference reads the stored
+rows (CteScan). AS NOT MATERIALIZED always inlines.
+
+WITH RECURSIVE name AS (non_recursive_term UNION [ALL] recursive_term) is always materialized.
+The recursive term reads the CTE once, and gets the rows the previous round produced (the work table).
+Postgres only allows that reference in the recursive term's FROM, we also allow it inside an IN or
+EXISTS subquery of the recursive term: without joins that is the only way to walk a tree stored in a table.
+CYCLE needs the reference in FROM, the path goes from a row of the work table to the rows made from it
+*/
+
+// CommonTableExpr is an analyzed WITH item
+type CommonTableExpr struct {
+	name         string
+	stmt         *types.SelectStmt
+	materialized types.CTEMaterialize
+	recursive    bool //Stays set only if the query really references itself
+	cycleClause  *types.CTECycleClause
+	location     int
+
+	pstate  *ParseState      //Stands for the query level of the WITH, it has no FROM
+	columns []catalog.Column //nil while the non-recursive term is analyzed
+	query   *Query
+
+	refCount     int //References from outside the CTE's own query
+	selfRefCount int
+}
+
+// inlined tells if the references become derived tables instead of reading the materialized result
+func (cte *CommonTableExpr) inlined() bool {
+	switch {
+	case cte.recursive, cte.materialized == types.CTEMaterializeAlways:
+		return false
+	case cte.materialized == types.CTEMaterializeNever:
+		return true
+	}
+	return cte.refCount <= 1
+}
+
+/*
+transformWithClause analyzes the items of a WITH clause and returns ctes with them added
+A WITH item can reference the items before it, a recursive one also itself
+*/
+func transformWithClause(withClause *types.WithClause, parentState *ParseState, ctes []*CommonTableExpr) ([]*CommonTableExpr, error) {
+	if withClause == nil {
+		return ctes, nil
+	}
+	for i, raw := range withClause.Ctes {
+		for _, other := range withClause.Ctes[:i] {
+			if other.Ctename == raw.Ctename {
+				return nil, fmt.Errorf("WITH query name \"%s\" specified more than once at position %d", raw.Ctename, raw.Location)
+			}
+		}
+
+		cte := &CommonTableExpr{
+			name:         raw.Ctename,
+			stmt:         raw.Ctequery,
+			materialized: raw.CteMaterialized,
+			recursive:    withClause.Recursive,
+			cycleClause:  raw.CycleClause,
+			location:     raw.Location,
+		}
+		//Full slice expressions so appending never writes into a list someone else holds
+		cte.pstate = &ParseState{parent: parentState, ctes: ctes}
+		if cte.recursive {
+			cte.pstate.ctes = append(ctes[:len(ctes):len(ctes)], cte)
+		}
+		if err := cte.analyze(raw.Aliascolnames); err != nil {
+			return nil, err
+		}
+		ctes = append(ctes[:len(ctes):len(ctes)], cte)
+	}
+	return ctes, nil
+}
+
+func (cte *CommonTableExpr) analyze(colnames []string) error {
+	stmt := cte.stmt
+	//The work table has the columns of the non-recursive term, they have to be known before the recursive term
+	if cte.recursive && stmt.Op == types.SETOP_UNION {
+		//Analyzed again as part of the whole query below, its references are counted there
+		preState := *cte.pstate
+		preState.inlineCopy = true
+		nonRecursive, err := transformStmt(stmt.Larg, &preState)
+		if err != nil {
+			return err
+		}
+		resolveTargetListUnknown(nonRecursive.targetList)
+		if cte.columns, err = cte.makeColumns(nonRecursive.targetList, colnames); err != nil {
+			return err
+		}
+	}
+
+	query, err := transformStmt(stmt, cte.pstate)
+	if err != nil {
+		return err
+	}
+	resolveTargetListUnknown(query.targetList)
+	cte.query = query
+
+	if cte.selfRefCount == 0 {
+		if cte.cycleClause != nil {
+			return fmt.Errorf("WITH query is not recursive at position %d", cte.cycleClause.Location)
+		}
+		cte.recursive = false
+		cte.columns, err = cte.makeColumns(query.targetList, colnames)
+		return err
+	}
+
+	switch {
+	case stmt.SortClause != nil:
+		return fmt.Errorf("ORDER BY in a recursive query is not implemented at position %d", cte.location)
+	case stmt.LimitOffset != nil:
+		return fmt.Errorf("OFFSET in a recursive query is not implemented at position %d", cte.location)
+	case stmt.LimitCount != nil:
+		return fmt.Errorf("LIMIT in a recursive query is not implemented at position %d", cte.location)
+	case query.rarg.setOp == types.SETOP_NONE && query.rarg.hasAggs():
+		return fmt.Errorf("aggregate functions are not allowed in a recursive query's recursive term at position %d", cte.location)
+	}
+	for i, tle := range nonJunkColumns(query.targetList) {
+		if nonRecursiveType, overallType := cte.columns[i].TypeOid, types.ExprType(tle.Expr); nonRecursiveType != overallType {
+			return fmt.Errorf("recursive query \"%s\" column %d has type %s in non-recursive term but type %s overall at position %d",
+				cte.name, i+1, adt.TypeName(nonRecursiveType), adt.TypeName(overallType), cte.location)
+		}
+	}
+	if cte.cycleClause != nil {
+		return cte.transformCycleClause(cte.cycleClause)
+	}
+	return nil
+}
+
+/*
+transformCycleClause adds the columns of CYCLE cols SET mark USING path to a recursive query (postgres
+rewriteSearchAndCycle). path is the array of the rows of the cycle columns met on the way to a row, mark
+tells if the row was already on its path. The recursive term stops at marked rows:
+
+	SELECT cols..., default AS mark, ARRAY[ROW(cycle cols)] AS path FROM (non_recursive_term)
+	UNION [ALL]
+	SELECT cols..., CASE WHEN ROW(cycle cols) = ANY(path) THEN value ELSE default END AS mark,
+	       path || ROW(cycle cols) AS path
+	FROM (SELECT ..., cte.path FROM cte ... WHERE ... AND cte.mark <> value)
+
+Without a record type the rows are their text (see RowExpr) and path is a text[]
+*/
+func (cte *CommonTableExpr) transformCycleClause(cycle *types.CTECycleClause) error {
+	query := cte.query
+	switch {
+	case query.larg.setOp != types.SETOP_NONE:
+		return fmt.Errorf("with a SEARCH or CYCLE clause, the left side of the UNION must be a SELECT at position %d", cycle.Location)
+	case query.rarg.setOp != types.SETOP_NONE:
+		return fmt.Errorf("with a SEARCH or CYCLE clause, the right side of the UNION must be a SELECT at position %d", cycle.Location)
+	case query.rarg.rte == nil || !query.rarg.rte.selfReference:
+		return fmt.Errorf("with a SEARCH or CYCLE clause, the recursive reference to WITH query \"%s\" must be at the top level of its right-hand SELECT at position %d",
+			cte.name, cycle.Location)
+	}
+
+	columnIndex := func(name string) int {
+		for i, col := range cte.columns {
+			if col.Name == name {
+				return i
+			}
+		}
+		return -1
+	}
+	var cycleCols []int
+	for _, name := range cycle.CycleColList {
+		attno := columnIndex(name)
+		if attno < 0 {
+			return fmt.Errorf("cycle column \"%s\" not in WITH query column list at position %d", name, cycle.Location)
+		}
+		for _, other := range cycleCols {
+			if other == attno {
+				return fmt.Errorf("cycle column \"%s\" specified more than once at position %d", name, cycle.Location)
+			}
+		}
+		cycleCols = append(cycleCols, attno)
+	}
+	switch {
+	case columnIndex(cycle.CycleMarkColumn) >= 0:
+		return fmt.Errorf("cycle mark column name \"%s\" already used in WITH query column list at position %d", cycle.CycleMarkColumn, cycle.Location)
+	case columnIndex(cycle.CyclePathColumn) >= 0:
+		return fmt.Errorf("cycle path column name \"%s\" already used in WITH query column list at position %d", cycle.CyclePathColumn, cycle.Location)
+	case cycle.CycleMarkColumn == cycle.CyclePathColumn:
+		return fmt.Errorf("cycle mark column name and cycle path column name are the same at position %d", cycle.Location)
+	}
+
+	markValue, markDefault, err := transformCycleMark(cycle)
+	if err != nil {
+		return err
+	}
+	markType := types.ExprType(markValue)
+	ncols := len(cte.columns)
+	cte.columns = append(cte.columns[:ncols:ncols],
+		catalog.Column{Name: cycle.CycleMarkColumn, TypeOid: markType},
+		catalog.Column{Name: cycle.CyclePathColumn, TypeOid: types.TEXTARRAYOID})
+	cycleRow := func(columns []types.Node) *types.RowExpr {
+		row := &types.RowExpr{}
+		for _, attno := range cycleCols {
+			row.Args = append(row.Args, columns[attno])
+		}
+		return row
+	}
+
+	if query.larg, err = cte.wrapCycleTerm(query.larg, func(columns []types.Node) (types.Node, types.Node, error) {
+		path := &types.ArrayExpr{ArrayType: types.TEXTARRAYOID, ElementType: types.TEXTOID, Elements: []types.Node{cycleRow(columns)}}
+		return markDefault, path, nil
+	}); err != nil {
+		return err
+	}
+
+	//The recursive term reads the mark and path of the work table's rows and passes the path on
+	rarg := query.rarg
+	rarg.rte.columns = cte.columns
+	wtMark := &types.Var{AttNo: ncols, Name: cycle.CycleMarkColumn, VarType: markType}
+	notCycle := &types.OpExpr{Op: "<>", Args: []types.Node{wtMark, markValue}, ResultType: types.BOOLOID}
+	rarg.whereClause = makeAnd(append(conjuncts(rarg.whereClause), notCycle))
+	addTargetEntry(rarg, &types.TargetEntry{
+		Expr:    &types.Var{AttNo: ncols + 1, Name: cycle.CyclePathColumn, VarType: types.TEXTARRAYOID},
+		ResName: cycle.CyclePathColumn,
+	})
+	if query.rarg, err = cte.wrapCycleTerm(rarg, func(columns []types.Node) (types.Node, types.Node, error) {
+		wtPath := columns[ncols]
+		mark := &types.CaseExpr{
+			CaseType: markType,
+			Args: []*types.CaseWhen{{
+				Expr:   &types.ScalarArrayOpExpr{Op: "=", UseOr: true, Args: []types.Node{cycleRow(columns), wtPath}},
+				Result: markValue,
+			}},
+			Defresult: markDefault,
+		}
+		path, err := makeTableOperator("||", wtPath, cycleRow(columns))
+		return mark, path, err
+	}); err != nil {
+		return err
+	}
+
+	for i, col := range cte.columns[ncols:] {
+		query.targetList = append(query.targetList, &types.TargetEntry{
+			Expr:    &types.Var{AttNo: ncols + i, Name: col.Name, VarType: col.TypeOid},
+			ResName: col.Name,
+		})
+	}
+	return nil
+}
+
+func (cte *CommonTableExpr) makeColumns(targetList []*types.TargetEntry, colnames []string) ([]catalog.Column, error) {
+	columns := subqueryColumns(targetList, colnames)
+	if len(colnames) > len(columns) {
+		return nil, fmt.Errorf("WITH query \"%s\" has %d columns available but %d columns specified at position %d",
+			cte.name, len(columns), len(colnames), cte.location)
+	}
+	return columns, nil
+}
+
+// findCte looks for a WITH query in this and the enclosing query levels
+// counted is false when the reference is made from a copy of another CTE that is being inlined
+func (pstate *ParseState) findCte(name string) (cte *CommonTableExpr, levelsUp int, counted bool) {
+	counted = true
+	for levelsUp, ps := 0, pstate; ps != nil; levelsUp, ps = levelsUp+1, ps.parent {
+		//That CTE's own query already counted its references
+		if ps.inlineCopy {
+			counted = false
+		}
+		for i := len(ps.ctes) - 1; i >= 0; i-- {
+			if ps.ctes[i].name == name {
+				return ps.ctes[i], levelsUp, counted
+			}
+		}
+	}
+	return nil, 0, false
+}
+
+func (pstate *ParseState) transformCteReference(rv *types.RangeVar, cte *CommonTableExpr, levelsUp int, counted bool) (*RangeTblEntry, error) {
+	rte := &RangeTblEntry{refname: rv.Relname, cte: cte, cteLevelsUp: levelsUp}
+	if rv.Alias != "" {
+		rte.refname = rv.Alias
+	}
+
+	//A reference to a recursive CTE from inside its own query
+	if cte.query == nil && cte.recursive {
+		if cte.columns == nil {
+			if cte.stmt.Op != types.SETOP_UNION {
+				return nil, fmt.Errorf("recursive query \"%s\" does not have the form non-recursive-term UNION [ALL] recursive-term at position %d", cte.name, cte.location)
+			}
+			return nil, fmt.Errorf("recursive reference to query \"%s\" must not appear within its non-recursive term at position %d", cte.name, rv.Location)
+		}
+		cte.selfRefCount++
+		if cte.selfRefCount > 1 {
+			return nil, fmt.Errorf("recursive reference to query \"%s\" must not appear more than once at position %d", cte.name, rv.Location)
+		}
+		rte.selfReference = true
+		rte.columns = cte.columns
+		return rte, nil
+	}
+
+	if counted {
+		cte.refCount++
+	}
+	rte.columns = cte.columns
+	if cte.recursive || cte.materialized == types.CTEMaterializeAlways {
+		return rte, nil
+	}
+
+	//Whether it is inlined is only known once all references are counted, so every reference gets its copy
+	copyState := *cte.pstate
+	copyState.inlineCopy = true
+	subquery, err := transformStmt(cte.stmt, &copyState)
+	if err != nil {
+		return nil, err
+	}
+	resolveTargetListUnknown(subquery.targetList)
+	incrementLevelsUp(subquery, levelsUp)
+	rte.subquery = subquery
+	return rte, nil
+}
+
+/*
+incrementLevelsUp moves a query that was analyzed as a subquery of one level down to a level delta
+levels below it, so whatever it references outside of itself is delta levels further away
+(postgres IncrementVarSublevelsUp)
+*/
+func incrementLevelsUp(query *Query, delta int) {
+	if delta == 0 {
+		return
+	}
+	//A GROUP BY expression can share its nodes with the target list, every Var is moved once
+	moved := make(map[*types.Var]bool)
+	walkQuery(query, 0, func(node types.Node, depth int) bool {
+		switch n := node.(type) {
+		case *types.Var:
+			if n.LevelsUp > depth && !moved[n] {
+				n.LevelsUp += delta
+				moved[n] = true
+			}
+		case *RangeTblEntry:
+			if n.cte != nil && n.cteLevelsUp > depth {
+				n.cteLevelsUp += delta
+			}
+		}
+		return true
+	})
+}
+
+/*
+transformCycleMark analyzes TO value DEFAULT default of a CYCLE clause, true and false when they are left out.
+Both are constants of a type they can be converted to that has <>
+*/
+func transformCycleMark(cycle *types.CTECycleClause) (types.Node, types.Node, error) {
+	if cycle.CycleMarkValue == nil {
+		return &types.Const{ConstType: types.BOOLOID, Val: true}, &types.Const{ConstType: types.BOOLOID, Val: false}, nil
+	}
+	pstate := &ParseState{}
+	value, err := pstate.transformExpr(cycle.CycleMarkValue, EXPR_KIND_NONE)
+	if err != nil {
+		return nil, nil, err
+	}
+	def, err := pstate.transformExpr(cycle.CycleMarkDefault, EXPR_KIND_NONE)
+	if err != nil {
+		return nil, nil, err
+	}
+	markType, err := selectCommonType("CYCLE", types.ExprType(value), types.ExprType(def))
+	if err != nil {
+		return nil, nil, fmt.Errorf("%v at position %d", err, cycle.Location)
+	}
+	if value, err = coerceType(value, markType); err != nil {
+		return nil, nil, err
+	}
+	if def, err = coerceType(def, markType); err != nil {
+		return nil, nil, err
+	}
+	for _, mark := range []types.Node{value, def} {
+		if coerce, ok := mark.(*types.CoerceExpr); ok {
+			mark = coerce.Arg
+		}
+		if _, ok := mark.(*types.Const); !ok {
+			return nil, nil, fmt.Errorf("CYCLE mark value and default must be constants at position %d", cycle.Location)
+		}
+	}
+	if entry := adt.LookupType(markType); entry == nil || entry.Compare == nil {
+		return nil, nil, fmt.Errorf("could not identify an inequality operator for type %s at position %d", adt.TypeName(markType), cycle.Location)
+	}
+	return value, def, nil
+}
+
+/*
+wrapCycleTerm makes a term of a recursive query with a CYCLE clause the derived table of a query returning
+its columns and the mark and path extra gives from them. The cycle columns are read from the derived
+table so the term's expressions are evaluated once
+*/
+func (cte *CommonTableExpr) wrapCycleTerm(term *Query, extra func(columns []types.Node) (mark types.Node, path types.Node, err error)) (*Query, error) {
+	incrementLevelsUp(term, 1)
+	rte := &RangeTblEntry{refname: cte.name, subquery: term, columns: subqueryColumns(term.targetList, nil)}
+	wrapper := &Query{rte: rte}
+	columns := make([]types.Node, len(rte.columns))
+	for i, col := range rte.columns {
+		columns[i] = &types.Var{AttNo: i, Name: col.Name, VarType: col.TypeOid}
+	}
+	ncols := len(cte.columns) - 2
+	for i, col := range cte.columns[:ncols] {
+		wrapper.targetList = append(wrapper.targetList, &types.TargetEntry{Expr: columns[i], ResName: col.Name})
+	}
+	mark, path, err := extra(columns)
+	if err != nil {
+		return nil, err
+	}
+	wrapper.targetList = append(wrapper.targetList,
+		&types.TargetEntry{Expr: mark, ResName: cte.cycleClause.CycleMarkColumn},
+		&types.TargetEntry{Expr: path, ResName: cte.cycleClause.CyclePathColumn})
+	return wrapper, nil
+}
+
+// addTargetEntry adds an output column to a query, in front of the junk columns ORDER BY may have added
+func addTargetEntry(query *Query, tle *types.TargetEntry) {
+	position := len(nonJunkColumns(query.targetList))
+	query.targetList = append(query.targetList[:position:position], append([]*types.TargetEntry{tle}, query.targetList[position:]...)...)
+	for i := range query.sortClause {
+		if query.sortClause[i].TleIndex >= position {
+			query.sortClause[i].TleIndex++
+		}
+	}
+}
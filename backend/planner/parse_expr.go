@@ -0,0 +1,769 @@
+package planner
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rautNishan/diskquery/adt"
+	"github.com/rautNishan/diskquery/types"
+)
+
+// ParseExprKind tells transformExpr which clause it is working on, mostly for error messages
+type ParseExprKind int
+
+const (
+	EXPR_KIND_NONE ParseExprKind = iota
+	EXPR_KIND_SELECT_TARGET
+	EXPR_KIND_WHERE
+	EXPR_KIND_GROUP_BY
+	EXPR_KIND_HAVING
+	EXPR_KIND_FILTER
+	EXPR_KIND_ORDER_BY
+	EXPR_KIND_LIMIT
+	EXPR_KIND_OFFSET
+	EXPR_KIND_WINDOW_PARTITION
+	EXPR_KIND_WINDOW_ORDER
+	EXPR_KIND_WINDOW_FRAME_RANGE
+	EXPR_KIND_WINDOW_FRAME_ROWS
+	EXPR_KIND_WINDOW_FRAME_GROUPS
+	EXPR_KIND_FROM_FUNCTION
+	EXPR_KIND_JOIN_ON
+	EXPR_KIND_INDEX_EXPRESSION
+	EXPR_KIND_INDEX_PREDICATE
+	EXPR_KIND_VALUES
+	EXPR_KIND_UPDATE_SOURCE
+	EXPR_KIND_RETURNING
+)
+
+func (kind ParseExprKind) String() string {
+	switch kind {
+	case EXPR_KIND_WHERE:
+		return "WHERE"
+	case EXPR_KIND_GROUP_BY:
+		return "GROUP BY"
+	case EXPR_KIND_HAVING:
+		return "HAVING"
+	case EXPR_KIND_FILTER:
+		return "FILTER"
+	case EXPR_KIND_ORDER_BY:
+		return "ORDER BY"
+	case EXPR_KIND_LIMIT:
+		return "LIMIT"
+	case EXPR_KIND_OFFSET:
+		return "OFFSET"
+	case EXPR_KIND_WINDOW_PARTITION:
+		return "window PARTITION BY"
+	case EXPR_KIND_WINDOW_ORDER:
+		return "window ORDER BY"
+	case EXPR_KIND_WINDOW_FRAME_RANGE:
+		return "window RANGE"
+	case EXPR_KIND_WINDOW_FRAME_ROWS:
+		return "window ROWS"
+	case EXPR_KIND_WINDOW_FRAME_GROUPS:
+		return "window GROUPS"
+	case EXPR_KIND_FROM_FUNCTION:
+		return "functions in FROM"
+	case EXPR_KIND_JOIN_ON:
+		return "JOIN conditions"
+	case EXPR_KIND_INDEX_EXPRESSION:
+		return "index expressions"
+	case EXPR_KIND_INDEX_PREDICATE:
+		return "index predicates"
+	case EXPR_KIND_VALUES:
+		return "VALUES"
+	case EXPR_KIND_UPDATE_SOURCE:
+		return "UPDATE"
+	case EXPR_KIND_RETURNING:
+		return "RETURNING"
+	}
+	return "this context"
+}
+
+// ParseState holds what we know while analyzing a single SELECT
+// A subquery gets its own ParseState, its parent is the ParseState of the query it is in
+type ParseState struct {
+	parent   *ParseState
+	rte      *RangeTblEntry //nil if there is no FROM
+	exprKind ParseExprKind
+	aggs     []*types.Aggref
+	inAgg    bool
+
+	windowClause   []*WindowClause //Windows of the WINDOW clause first, then those of OVER clauses
+	hasWindowFuncs bool
+	inWindowFunc   bool
+
+	hasTargetSRFs bool //A set returning function in the select list
+
+	ctes       []*CommonTableExpr //WITH queries visible at this level
+	inlineCopy bool               //Analyzing the copy of a WITH query for an inlined reference
+}
+
+func (pstate *ParseState) transformExpr(node types.Node, kind ParseExprKind) (types.Node, error) {
+	saved := pstate.exprKind
+	pstate.exprKind = kind
+	defer func() { pstate.exprKind = saved }()
+	return pstate.transformExprRecurse(node)
+}
+
+func (pstate *ParseState) transformExprRecurse(node types.Node) (types.Node, error) {
+	switch n := node.(type) {
+	case *types.AConst:
+		return makeConst(n.Val), nil
+	case *types.ColumnRef:
+		return pstate.transformColumnRef(n)
+	case *types.AExpr:
+		switch n.Kind {
+		case types.AEXPR_OP_ANY, types.AEXPR_OP_ALL:
+			return pstate.transformAExprOpAnyAll(n)
+		case types.AEXPR_DISTINCT, types.AEXPR_NOT_DISTINCT:
+			return pstate.transformAExprDistinct(n)
+		case types.AEXPR_NULLIF:
+			return pstate.transformAExprNullIf(n)
+		}
+		return pstate.transformAExpr(n)
+	case *types.BoolExpr:
+		return pstate.transformBoolExpr(n)
+	case *types.NullTest:
+		return pstate.transformNullTest(n)
+	case *types.BooleanTest:
+		return pstate.transformBooleanTest(n)
+	case *types.CoalesceExpr:
+		return pstate.transformCoalesceExpr(n)
+	case *types.MinMaxExpr:
+		return pstate.transformMinMaxExpr(n)
+	case *types.CaseExpr:
+		return pstate.transformCaseExpr(n)
+	case *types.CaseTestExpr:
+		//Put in place of a simple CASE's value by transformCaseExpr, it is analyzed already
+		return n, nil
+	case *types.FuncCall:
+		return pstate.transformFuncCall(n)
+	case *types.SubLink:
+		return pstate.transformSubLink(n)
+	case *types.TypeCast:
+		return pstate.transformTypeCast(n)
+	case *types.AArrayExpr:
+		return pstate.transformArrayExpr(n, types.InvalidOid)
+	case *types.AIndirection:
+		return pstate.transformIndirection(n)
+	case *types.AStar:
+		return nil, fmt.Errorf("\"*\" is not allowed in %s at position %d", pstate.exprKind, n.Location)
+	}
+	return nil, fmt.Errorf("unrecognized node type: %T", node)
+}
+
+func makeConst(val types.Datum) *types.Const {
+	switch val.(type) {
+	case int64:
+		return &types.Const{ConstType: types.INT8OID, Val: val}
+	case float64:
+		return &types.Const{ConstType: types.FLOAT8OID, Val: val}
+	case adt.Numeric:
+		return &types.Const{ConstType: types.NUMERICOID, Val: val}
+	case bool:
+		return &types.Const{ConstType: types.BOOLOID, Val: val}
+	}
+	//String literals (and NULL) stay unknown until they meet something that gives them a type
+	return &types.Const{ConstType: types.UNKNOWNOID, Val: val}
+}
+
+func (pstate *ParseState) transformColumnRef(cref *types.ColumnRef) (types.Node, error) {
+	if pstate.exprKind == EXPR_KIND_LIMIT || pstate.exprKind == EXPR_KIND_OFFSET {
+		return nil, fmt.Errorf("argument of %s must not contain variables at position %d", pstate.exprKind, cref.Location)
+	}
+	var relname, colname string
+	switch len(cref.Fields) {
+	case 1:
+		colname = cref.Fields[0]
+	case 2:
+		relname, colname = cref.Fields[0], cref.Fields[1]
+	default:
+		return nil, fmt.Errorf("improper qualified name (too many dotted names): %s", strings.Join(cref.Fields, "."))
+	}
+
+	//Our own FROM item first, then the queries we are a subquery of, from the inside out
+	foundRel := false
+	for levelsUp, ps := 0, pstate; ps != nil; levelsUp, ps = levelsUp+1, ps.parent {
+		if ps.rte == nil {
+			continue
+		}
+		rte, offset := ps.rte, 0
+		if relname != "" {
+			if rte, offset = ps.rte.findRefname(relname, 0); rte == nil {
+				continue
+			}
+		}
+		foundRel = true
+		attno, err := rte.columnIndex(colname, cref.Location)
+		if err != nil {
+			return nil, err
+		}
+		if attno >= 0 {
+			return rte.columnExpr(attno, offset, levelsUp), nil
+		}
+		if relname != "" {
+			break
+		}
+	}
+	if relname != "" && !foundRel {
+		return nil, fmt.Errorf("missing FROM-clause entry for table \"%s\" at position %d", relname, cref.Location)
+	}
+	return nil, fmt.Errorf("column \"%s\" does not exist at position %d", strings.Join(cref.Fields, "."), cref.Location)
+}
+
+func (pstate *ParseState) transformAExpr(a *types.AExpr) (types.Node, error) {
+	if a.Lexpr == nil {
+		arg, err := pstate.transformExprRecurse(a.Rexpr)
+		if err != nil {
+			return nil, err
+		}
+		if usesOperatorTable(a.Name, types.InvalidOid, types.ExprType(arg)) {
+			expr, err := makeTableOperator(a.Name, nil, arg)
+			if err != nil {
+				return nil, fmt.Errorf("%v at position %d", err, a.Location)
+			}
+			return expr, nil
+		}
+		arg, err = coerceUnknown(arg, types.FLOAT8OID)
+		if err != nil {
+			return nil, err
+		}
+		argType := types.ExprType(arg)
+		if !isNumericType(argType) {
+			return nil, fmt.Errorf("operator does not exist: %s %s at position %d", a.Name, adt.TypeName(argType), a.Location)
+		}
+		return &types.OpExpr{Op: a.Name, Args: []types.Node{arg}, ResultType: argType}, nil
+	}
+
+	left, err := pstate.transformExprRecurse(a.Lexpr)
+	if err != nil {
+		return nil, err
+	}
+	right, err := pstate.transformExprRecurse(a.Rexpr)
+	if err != nil {
+		return nil, err
+	}
+	return makeOpExpr(a.Name, left, right, a.Location)
+}
+
+// makeOpExpr applies a binary operator to two analyzed expressions
+func makeOpExpr(op string, left types.Node, right types.Node, location int) (types.Node, error) {
+	//Arithmetic with dates, times and intervals depends on both types, those operators are looked up
+	if usesOperatorTable(op, types.ExprType(left), types.ExprType(right)) {
+		expr, err := makeTableOperator(op, left, right)
+		if err != nil {
+			return nil, fmt.Errorf("%v at position %d", err, location)
+		}
+		return expr, nil
+	}
+
+	//An unknown literal takes the type of the other side, two unknowns are text. || is text concatenation for anything but jsonb
+	if op == "||" {
+		left, right = resolveUnknown(left), resolveUnknown(right)
+	}
+	left, err := coerceUnknown(left, types.ExprType(right))
+	if err != nil {
+		return nil, err
+	}
+	right, err = coerceUnknown(right, types.ExprType(left))
+	if err != nil {
+		return nil, err
+	}
+	left, right = resolveUnknown(left), resolveUnknown(right)
+	if left, right, err = coerceOperands(left, right); err != nil {
+		return nil, fmt.Errorf("%v at position %d", err, location)
+	}
+
+	resultType, err := operatorResultType(op, types.ExprType(left), types.ExprType(right))
+	if err != nil {
+		return nil, fmt.Errorf("%v at position %d", err, location)
+	}
+	return &types.OpExpr{Op: op, Args: []types.Node{left, right}, ResultType: resultType}, nil
+}
+
+func operatorResultType(op string, ltype types.Oid, rtype types.Oid) (types.Oid, error) {
+	notExist := fmt.Errorf("operator does not exist: %s %s %s", adt.TypeName(ltype), op, adt.TypeName(rtype))
+
+	switch op {
+	case "+", "-", "*", "/", "%":
+		if !isNumericType(ltype) || !isNumericType(rtype) {
+			return types.InvalidOid, notExist
+		}
+		resultType := numericCommonType(ltype, rtype)
+		if resultType == types.FLOAT8OID && op == "%" {
+			return types.InvalidOid, notExist
+		}
+		return resultType, nil
+
+	case "^":
+		if !isNumericType(ltype) || !isNumericType(rtype) {
+			return types.InvalidOid, notExist
+		}
+		if numericCommonType(ltype, rtype) == types.NUMERICOID {
+			return types.NUMERICOID, nil
+		}
+		return types.FLOAT8OID, nil
+
+	case "||":
+		return types.TEXTOID, nil
+
+	case "=", "<>", "<", "<=", ">", ">=":
+		//Types without an ordering, like json, have no comparison operators
+		if entry := adt.LookupType(ltype); entry != nil && entry.Compare == nil {
+			return types.InvalidOid, notExist
+		}
+		if ltype == rtype || (isNumericType(ltype) && isNumericType(rtype)) {
+			return types.BOOLOID, nil
+		}
+		return types.InvalidOid, notExist
+	}
+	return types.InvalidOid, notExist
+}
+
+/*
+transformAExprOpAnyAll analyzes scalar op ANY (array) and scalar op ALL (array)
+The scalar is converted to the array's element type, or the array to an array of the scalar's type,
+whichever works. An unknown literal on either side takes its type from the other one
+*/
+func (pstate *ParseState) transformAExprOpAnyAll(a *types.AExpr) (types.Node, error) {
+	left, err := pstate.transformExprRecurse(a.Lexpr)
+	if err != nil {
+		return nil, err
+	}
+	right, err := pstate.transformExprRecurse(a.Rexpr)
+	if err != nil {
+		return nil, err
+	}
+	if entry := adt.LookupType(types.ExprType(right)); entry != nil && entry.Category == adt.TYPCATEGORY_ARRAY {
+		if left, err = coerceUnknown(left, entry.ElemType); err != nil {
+			return nil, err
+		}
+	}
+	left = resolveUnknown(left)
+	ltype := types.ExprType(left)
+	if right, err = coerceUnknown(right, adt.ArrayTypeOf(ltype)); err != nil {
+		return nil, err
+	}
+	entry := adt.LookupType(types.ExprType(right))
+	if entry == nil || entry.Category != adt.TYPCATEGORY_ARRAY {
+		return nil, fmt.Errorf("op ANY/ALL (array) requires array on right side at position %d", a.Location)
+	}
+
+	elemType := entry.ElemType
+	if ltype != elemType && !isMixedNumeric(ltype, elemType) {
+		switch {
+		case adt.CanCoerce(ltype, elemType, adt.COERCION_IMPLICIT):
+			left, err = coerceType(left, elemType)
+		case adt.CanCoerce(elemType, ltype, adt.COERCION_IMPLICIT) && adt.ArrayTypeOf(ltype) != types.InvalidOid:
+			elemType = ltype
+			right, err = coerceType(right, adt.ArrayTypeOf(ltype))
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	resultType, err := operatorResultType(a.Name, types.ExprType(left), elemType)
+	if err != nil {
+		return nil, fmt.Errorf("%v at position %d", err, a.Location)
+	}
+	if resultType != types.BOOLOID {
+		return nil, fmt.Errorf("op ANY/ALL (array) requires operator to yield boolean at position %d", a.Location)
+	}
+	return &types.ScalarArrayOpExpr{Op: a.Name, UseOr: a.Kind == types.AEXPR_OP_ANY, Args: []types.Node{left, right}}, nil
+}
+
+/*
+transformAExprDistinct analyzes a IS [NOT] DISTINCT FROM b, the operands are matched up the way they
+are for a = b and the "=" found is what the DistinctExpr compares non NULL values with
+*/
+func (pstate *ParseState) transformAExprDistinct(a *types.AExpr) (types.Node, error) {
+	expr, err := pstate.transformAExpr(&types.AExpr{Kind: types.AEXPR_OP, Name: a.Name, Lexpr: a.Lexpr, Rexpr: a.Rexpr, Location: a.Location})
+	if err != nil {
+		return nil, err
+	}
+	op, ok := expr.(*types.OpExpr)
+	if !ok || op.ResultType != types.BOOLOID {
+		return nil, fmt.Errorf("IS DISTINCT FROM requires = operator to yield boolean at position %d", a.Location)
+	}
+	var result types.Node = &types.DistinctExpr{Op: op.Op, Opno: op.Opno, Args: op.Args}
+	if a.Kind == types.AEXPR_NOT_DISTINCT {
+		result = &types.BoolExpr{Boolop: types.NOT_EXPR, Args: []types.Node{result}, Location: a.Location}
+	}
+	return result, nil
+}
+
+// transformAExprNullIf analyzes NULLIF(a, b), the operands are matched up as for a = b
+func (pstate *ParseState) transformAExprNullIf(a *types.AExpr) (types.Node, error) {
+	expr, err := pstate.transformAExpr(&types.AExpr{Kind: types.AEXPR_OP, Name: a.Name, Lexpr: a.Lexpr, Rexpr: a.Rexpr, Location: a.Location})
+	if err != nil {
+		return nil, err
+	}
+	op, ok := expr.(*types.OpExpr)
+	if !ok || op.ResultType != types.BOOLOID {
+		return nil, fmt.Errorf("NULLIF requires = operator to yield boolean at position %d", a.Location)
+	}
+	return &types.NullIfExpr{Op: op.Op, Opno: op.Opno, Args: op.Args, ResultType: types.ExprType(op.Args[0])}, nil
+}
+
+/*
+transformCoalesceExpr analyzes COALESCE(a, b, ...), the arguments are converted to their common type
+the way the columns of a UNION are
+*/
+func (pstate *ParseState) transformCoalesceExpr(c *types.CoalesceExpr) (types.Node, error) {
+	args, commonType, err := pstate.transformCommonTypeArgs("COALESCE", c.Args, c.Location)
+	if err != nil {
+		return nil, err
+	}
+	return &types.CoalesceExpr{CoalesceType: commonType, Args: args, Location: c.Location}, nil
+}
+
+// transformMinMaxExpr analyzes GREATEST(...) and LEAST(...), which need a type whose values can be ordered
+func (pstate *ParseState) transformMinMaxExpr(m *types.MinMaxExpr) (types.Node, error) {
+	funcname := "GREATEST"
+	if m.Op == types.IS_LEAST {
+		funcname = "LEAST"
+	}
+	args, commonType, err := pstate.transformCommonTypeArgs(funcname, m.Args, m.Location)
+	if err != nil {
+		return nil, err
+	}
+	if entry := adt.LookupType(commonType); entry == nil || entry.Compare == nil {
+		return nil, fmt.Errorf("could not identify a comparison function for type %s at position %d", adt.TypeName(commonType), m.Location)
+	}
+	return &types.MinMaxExpr{MinMaxType: commonType, Op: m.Op, Args: args, Location: m.Location}, nil
+}
+
+/*
+transformCaseExpr analyzes CASE. In the simple form CASE x WHEN v THEN ... each WHEN becomes the condition
+x = v, with a CaseTestExpr for x so the executor evaluates x once. The results, ELSE included, are
+converted to their common type. A CASE without ELSE has a NULL one
+*/
+func (pstate *ParseState) transformCaseExpr(c *types.CaseExpr) (types.Node, error) {
+	var caseTest *types.CaseTestExpr
+	var arg types.Node
+	if c.Arg != nil {
+		var err error
+		if arg, err = pstate.transformExprRecurse(c.Arg); err != nil {
+			return nil, err
+		}
+		arg = resolveUnknown(arg)
+		caseTest = &types.CaseTestExpr{TypeId: types.ExprType(arg)}
+	}
+
+	whens := make([]*types.CaseWhen, len(c.Args))
+	rawResults := make([]types.Node, 0, len(c.Args)+1)
+	for i, when := range c.Args {
+		rawCond := when.Expr
+		if caseTest != nil {
+			rawCond = &types.AExpr{Kind: types.AEXPR_OP, Name: "=", Lexpr: caseTest, Rexpr: when.Expr, Location: when.Location}
+		}
+		cond, err := pstate.transformExprRecurse(rawCond)
+		if err != nil {
+			return nil, err
+		}
+		if cond, err = coerceUnknown(cond, types.BOOLOID); err != nil {
+			return nil, err
+		}
+		if condType := types.ExprType(cond); condType != types.BOOLOID {
+			return nil, fmt.Errorf("argument of CASE/WHEN must be type boolean, not type %s at position %d", adt.TypeName(condType), when.Location)
+		}
+		whens[i] = &types.CaseWhen{Expr: cond, Location: when.Location}
+		rawResults = append(rawResults, when.Result)
+	}
+	defresult := c.Defresult
+	if defresult == nil {
+		defresult = &types.AConst{Val: nil, Location: c.Location}
+	}
+	rawResults = append(rawResults, defresult)
+
+	results, commonType, err := pstate.transformCommonTypeArgs("CASE", rawResults, c.Location)
+	if err != nil {
+		return nil, err
+	}
+	for i, when := range whens {
+		when.Result = results[i]
+	}
+	return &types.CaseExpr{CaseType: commonType, Arg: arg, Args: whens, Defresult: results[len(whens)], Location: c.Location}, nil
+}
+
+// transformCommonTypeArgs analyzes the arguments of COALESCE, GREATEST or LEAST (or the results of a CASE) and converts them to one type
+func (pstate *ParseState) transformCommonTypeArgs(context string, rawArgs []types.Node, location int) ([]types.Node, types.Oid, error) {
+	args := make([]types.Node, len(rawArgs))
+	commonType := types.UNKNOWNOID
+	for i, rawArg := range rawArgs {
+		arg, err := pstate.transformExprRecurse(rawArg)
+		if err != nil {
+			return nil, types.InvalidOid, err
+		}
+		args[i] = arg
+		//Unknown literals take the type of the others, they are text only when all of them are unknown
+		if argType := types.ExprType(arg); argType != types.UNKNOWNOID {
+			if commonType, err = selectCommonType(context, commonType, argType); err != nil {
+				return nil, types.InvalidOid, fmt.Errorf("%v at position %d", err, location)
+			}
+		}
+	}
+	if commonType == types.UNKNOWNOID {
+		commonType = types.TEXTOID
+	}
+	for i, arg := range args {
+		var err error
+		if args[i], err = coerceType(arg, commonType); err != nil {
+			return nil, types.InvalidOid, err
+		}
+	}
+	return args, commonType, nil
+}
+
+// transformNullTest analyzes x IS [NOT] NULL, which works on a value of any type
+func (pstate *ParseState) transformNullTest(n *types.NullTest) (types.Node, error) {
+	arg, err := pstate.transformExprRecurse(n.Arg)
+	if err != nil {
+		return nil, err
+	}
+	return &types.NullTest{Arg: resolveUnknown(arg), NullTestType: n.NullTestType, Location: n.Location}, nil
+}
+
+func (pstate *ParseState) transformBooleanTest(b *types.BooleanTest) (types.Node, error) {
+	arg, err := pstate.transformExprRecurse(b.Arg)
+	if err != nil {
+		return nil, err
+	}
+	if arg, err = coerceUnknown(arg, types.BOOLOID); err != nil {
+		return nil, err
+	}
+	if argType := types.ExprType(arg); argType != types.BOOLOID {
+		testName := [...]string{"IS TRUE", "IS NOT TRUE", "IS FALSE", "IS NOT FALSE", "IS UNKNOWN", "IS NOT UNKNOWN"}[b.BoolTestType]
+		return nil, fmt.Errorf("argument of %s must be type boolean, not type %s at position %d", testName, adt.TypeName(argType), b.Location)
+	}
+	return &types.BooleanTest{Arg: arg, BoolTestType: b.BoolTestType, Location: b.Location}, nil
+}
+
+/*
+transformArrayExpr analyzes ARRAY[...], the elements are converted to their common type.
+Elements that are arrays themselves, as in ARRAY[[1, 2], [3, 4]], make a multidimensional array.
+Under a cast, ARRAY[...]::int[], arrayType is the type of the cast: the elements are converted to its element
+type right away and an empty ARRAY[] has a type. Otherwise it is InvalidOid
+*/
+func (pstate *ParseState) transformArrayExpr(a *types.AArrayExpr, arrayType types.Oid) (types.Node, error) {
+	if len(a.Elements) == 0 {
+		if arrayType == types.InvalidOid {
+			return nil, fmt.Errorf("cannot determine type of empty array at position %d", a.Location)
+		}
+		return &types.ArrayExpr{ArrayType: arrayType, ElementType: adt.LookupType(arrayType).ElemType, Elements: []types.Node{}}, nil
+	}
+	elements := make([]types.Node, len(a.Elements))
+	commonType := types.UNKNOWNOID
+	_, nested := a.Elements[0].(*types.AArrayExpr)
+	for i, rawElem := range a.Elements {
+		var elem types.Node
+		var err error
+		if sub, ok := rawElem.(*types.AArrayExpr); ok && arrayType != types.InvalidOid {
+			elem, err = pstate.transformArrayExpr(sub, arrayType)
+		} else {
+			elem, err = pstate.transformExprRecurse(rawElem)
+		}
+		if err != nil {
+			return nil, err
+		}
+		elements[i] = elem
+		if arrayType != types.InvalidOid && !nested {
+			elemType := types.ExprType(elem)
+			if commonType = adt.LookupType(arrayType).ElemType; !adt.CanCoerce(elemType, commonType, adt.COERCION_EXPLICIT) {
+				return nil, fmt.Errorf("cannot cast type %s to %s at position %d", adt.TypeName(elemType), adt.TypeName(commonType), a.Location)
+			}
+			continue
+		}
+		//Unknown literals and NULLs take the type of the others, they are text only when all of them are unknown
+		if elemType := types.ExprType(elem); elemType != types.UNKNOWNOID {
+			if commonType, err = selectCommonType("ARRAY", commonType, elemType); err != nil {
+				return nil, fmt.Errorf("%v at position %d", err, a.Location)
+			}
+		}
+	}
+	if commonType == types.UNKNOWNOID {
+		commonType = types.TEXTOID
+	}
+
+	result := &types.ArrayExpr{Elements: elements}
+	if entry := adt.LookupType(commonType); entry != nil && entry.Category == adt.TYPCATEGORY_ARRAY {
+		result.ArrayType, result.ElementType, result.Multidims = commonType, entry.ElemType, true
+	} else {
+		result.ArrayType, result.ElementType = adt.ArrayTypeOf(commonType), commonType
+		if result.ArrayType == types.InvalidOid {
+			return nil, fmt.Errorf("could not find array type for data type %s at position %d", adt.TypeName(commonType), a.Location)
+		}
+	}
+	for i, elem := range elements {
+		var err error
+		if elements[i], err = coerceType(elem, commonType); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+/*
+transformIndirection analyzes subscripts of an array, arr[2] or arr[1][2] is an element and
+arr[2:3] a slice. As in postgres, once one subscript is a slice they all are: arr[2][1:2] is arr[1:2][1:2]
+*/
+func (pstate *ParseState) transformIndirection(ind *types.AIndirection) (types.Node, error) {
+	arg, err := pstate.transformExprRecurse(ind.Arg)
+	if err != nil {
+		return nil, err
+	}
+	arrayType := types.ExprType(arg)
+	entry := adt.LookupType(arrayType)
+	if entry == nil || entry.Category != adt.TYPCATEGORY_ARRAY {
+		return nil, fmt.Errorf("cannot subscript type %s because it does not support subscripting at position %d",
+			adt.TypeName(arrayType), ind.Indirection[0].Location)
+	}
+
+	isSlice := false
+	for _, indices := range ind.Indirection {
+		isSlice = isSlice || indices.IsSlice
+	}
+	ref := &types.SubscriptingRef{Expr: arg, RefType: entry.ElemType}
+	if isSlice {
+		ref.RefType = arrayType
+	}
+	for _, indices := range ind.Indirection {
+		upper, err := pstate.transformSubscript(indices.Uidx, indices.Location)
+		if err != nil {
+			return nil, err
+		}
+		ref.Upperindex = append(ref.Upperindex, upper)
+		if !isSlice {
+			continue
+		}
+		var lower types.Node = &types.Const{ConstType: types.INT8OID, Val: int64(1)}
+		if indices.IsSlice {
+			if lower, err = pstate.transformSubscript(indices.Lidx, indices.Location); err != nil {
+				return nil, err
+			}
+		}
+		ref.Lowerindex = append(ref.Lowerindex, lower)
+	}
+	return ref, nil
+}
+
+// transformSubscript analyzes one array subscript, nil for a slice bound that was left out
+func (pstate *ParseState) transformSubscript(node types.Node, location int) (types.Node, error) {
+	if node == nil {
+		return nil, nil
+	}
+	subscript, err := pstate.transformExprRecurse(node)
+	if err != nil {
+		return nil, err
+	}
+	if subscript, err = coerceUnknown(subscript, types.INT8OID); err != nil {
+		return nil, err
+	}
+	subType := types.ExprType(subscript)
+	if subType == types.INT8OID {
+		return subscript, nil
+	}
+	if !adt.CanCoerce(subType, types.INT8OID, adt.COERCION_ASSIGNMENT) {
+		return nil, fmt.Errorf("array subscript must have type integer at position %d", location)
+	}
+	return coerceType(subscript, types.INT8OID)
+}
+
+func (pstate *ParseState) transformBoolExpr(b *types.BoolExpr) (types.Node, error) {
+	args := make([]types.Node, 0, len(b.Args))
+	for _, rawArg := range b.Args {
+		arg, err := pstate.transformExprRecurse(rawArg)
+		if err != nil {
+			return nil, err
+		}
+		arg, err = coerceUnknown(arg, types.BOOLOID)
+		if err != nil {
+			return nil, err
+		}
+		if argType := types.ExprType(arg); argType != types.BOOLOID {
+			opname := [...]string{"AND", "OR", "NOT"}[b.Boolop]
+			return nil, fmt.Errorf("argument of %s must be type boolean, not type %s at position %d", opname, adt.TypeName(argType), b.Location)
+		}
+		args = append(args, arg)
+	}
+	return &types.BoolExpr{Boolop: b.Boolop, Args: args}, nil
+}
+
+/*
+transformSubLink analyzes the subquery of a SubLink, with pstate as its parent so it can see our columns
+EXPR sublinks must return a single column, its type is the type of the SubLink.
+For ANY / ALL the left hand side is compared with the single column of the subquery
+*/
+func (pstate *ParseState) transformSubLink(sublink *types.SubLink) (types.Node, error) {
+	switch pstate.exprKind {
+	case EXPR_KIND_INDEX_EXPRESSION:
+		return nil, fmt.Errorf("cannot use subquery in index expression at position %d", sublink.Location)
+	case EXPR_KIND_INDEX_PREDICATE:
+		return nil, fmt.Errorf("cannot use subquery in index predicate at position %d", sublink.Location)
+	}
+	subquery, err := transformStmt(sublink.Subselect.(*types.SelectStmt), pstate)
+	if err != nil {
+		return nil, err
+	}
+	resolveTargetListUnknown(subquery.targetList)
+	columns := nonJunkColumns(subquery.targetList)
+	result := &types.SubLink{
+		SubLinkType: sublink.SubLinkType,
+		OperName:    sublink.OperName,
+		Subselect:   subquery,
+		Location:    sublink.Location,
+	}
+
+	switch sublink.SubLinkType {
+	case types.EXPR_SUBLINK:
+		if len(columns) != 1 {
+			return nil, fmt.Errorf("subquery must return only one column at position %d", sublink.Location)
+		}
+		result.ResultType = types.ExprType(columns[0].Expr)
+
+	case types.ANY_SUBLINK, types.ALL_SUBLINK:
+		if len(columns) != 1 {
+			return nil, fmt.Errorf("subquery has too many columns at position %d", sublink.Location)
+		}
+		testexpr, err := pstate.transformExprRecurse(sublink.Testexpr)
+		if err != nil {
+			return nil, err
+		}
+		subType := types.ExprType(columns[0].Expr)
+		if testexpr, err = coerceUnknown(testexpr, subType); err != nil {
+			return nil, err
+		}
+		//Only our side can be converted, the subquery's column is what it is
+		if testType := types.ExprType(testexpr); testType != subType && !isMixedNumeric(testType, subType) &&
+			adt.CanCoerce(testType, subType, adt.COERCION_IMPLICIT) {
+			if testexpr, err = coerceType(testexpr, subType); err != nil {
+				return nil, err
+			}
+		}
+		resultType, err := operatorResultType(sublink.OperName, types.ExprType(testexpr), subType)
+		if err != nil {
+			return nil, fmt.Errorf("%v at position %d", err, sublink.Location)
+		}
+		if resultType != types.BOOLOID {
+			return nil, fmt.Errorf("op ANY/ALL (subquery) requires operator to yield boolean at position %d", sublink.Location)
+		}
+		result.Testexpr = testexpr
+	}
+	return result, nil
+}
+
+func (pstate *ParseState) transformFuncCall(fn *types.FuncCall) (types.Node, error) {
+	if fn.Over != nil {
+		return pstate.transformWindowFuncCall(fn)
+	}
+	if _, isWindow := windowFunctions[fn.Funcname]; isWindow {
+		return nil, fmt.Errorf("window function %s requires an OVER clause at position %d", fn.Funcname, fn.Location)
+	}
+	if _, isAgg := aggregates[fn.Funcname]; isAgg {
+		return pstate.transformAggregateCall(fn)
+	}
+	if fn.AggStar || fn.AggDistinct || fn.AggFilter != nil {
+		return nil, fmt.Errorf("%s is not an aggregate function at position %d", fn.Funcname, fn.Location)
+	}
+	return pstate.transformFuncExpr(fn)
+}
@@ -0,0 +1,389 @@
+package planner
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rautNishan/diskquery/adt"
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+Resolution of overloaded functions and operators (postgres parser/parse_func.c)
+A name can stand for several functions with different argument types, the one the arguments fit best is
+chosen and the arguments are converted to its types
+*/
+
+/*
+selectCandidate picks the argument type list the given argument types fit best, the way postgres'
+func_select_candidate does:
+  - anyarray and anyelement in a candidate are replaced by the types the arguments give them
+  - every argument must convert to the candidate's type implicitly, an unknown literal fits any type
+    and any argument fits "any"
+  - keep the candidates with the most exact matches
+  - then those taking a preferred type (timestamptz, double precision) wherever a conversion is needed
+  - then those taking text for unknown literals
+  - then those taking for unknown literals the type all the known arguments have
+  - then those taking a preferred type for unknown literals, abs(NULL) is the double precision one
+
+Returns the candidate's index and its resolved argument types, -1 when none fits. ambiguous is set
+when several fit equally well
+*/
+func selectCandidate(argTypes []types.Oid, candidates [][]types.Oid) (best int, resolved []types.Oid, ambiguous bool) {
+	candidates = append([][]types.Oid{}, candidates...)
+	var viable []int
+	for i, candidate := range candidates {
+		if len(candidate) != len(argTypes) {
+			continue
+		}
+		candidate, ok := resolvePolymorphic(argTypes, candidate)
+		if !ok {
+			continue
+		}
+		candidates[i] = candidate
+		fits := true
+		for j, argType := range argTypes {
+			if argType != types.UNKNOWNOID && candidate[j] != types.ANYOID && !adt.CanCoerce(argType, candidate[j], adt.COERCION_IMPLICIT) {
+				fits = false
+				break
+			}
+		}
+		if fits {
+			viable = append(viable, i)
+		}
+	}
+
+	knownType := types.InvalidOid
+	for _, argType := range argTypes {
+		switch {
+		case argType == types.UNKNOWNOID:
+		case knownType == types.InvalidOid:
+			knownType = argType
+		case knownType != argType:
+			knownType = types.UNKNOWNOID //Known arguments of different types
+		}
+	}
+
+	rules := []func(argType types.Oid, candType types.Oid) bool{
+		func(argType types.Oid, candType types.Oid) bool {
+			return argType == candType
+		},
+		func(argType types.Oid, candType types.Oid) bool {
+			entry := adt.LookupType(candType)
+			return argType != candType && argType != types.UNKNOWNOID && entry != nil && entry.Preferred
+		},
+		func(argType types.Oid, candType types.Oid) bool {
+			entry := adt.LookupType(candType)
+			return argType == types.UNKNOWNOID && entry != nil && entry.Category == adt.TYPCATEGORY_STRING
+		},
+		func(argType types.Oid, candType types.Oid) bool {
+			return argType == types.UNKNOWNOID && candType == knownType
+		},
+		func(argType types.Oid, candType types.Oid) bool {
+			entry := adt.LookupType(candType)
+			return argType == types.UNKNOWNOID && entry != nil && entry.Preferred
+		},
+	}
+	for _, rule := range rules {
+		if len(viable) <= 1 {
+			break
+		}
+		bestCount := -1
+		var kept []int
+		for _, i := range viable {
+			count := 0
+			for j, argType := range argTypes {
+				if rule(argType, candidates[i][j]) {
+					count++
+				}
+			}
+			switch {
+			case count > bestCount:
+				bestCount, kept = count, []int{i}
+			case count == bestCount:
+				kept = append(kept, i)
+			}
+		}
+		viable = kept
+	}
+
+	switch len(viable) {
+	case 0:
+		return -1, nil, false
+	case 1:
+		return viable[0], candidates[viable[0]], false
+	}
+	return viable[0], candidates[viable[0]], true
+}
+
+/*
+resolvePolymorphic replaces anyarray and anyelement in a candidate's argument types by actual types
+(postgres enforce_generic_type_consistency). All of them share one element type, which the known
+argument types decide: the element type of an anyarray argument, the type of an anyelement one. When
+they differ they are unified the way UNION unifies column types. ok is false when that fails or
+when every polymorphic argument is an unknown literal. A candidate without them is returned as it is
+*/
+func resolvePolymorphic(argTypes []types.Oid, declared []types.Oid) (resolved []types.Oid, ok bool) {
+	elemType := types.InvalidOid
+	polymorphic := false
+	for j, declType := range declared {
+		var actual types.Oid
+		switch declType {
+		case types.ANYARRAYOID:
+			polymorphic = true
+			if argTypes[j] == types.UNKNOWNOID {
+				continue
+			}
+			entry := adt.LookupType(argTypes[j])
+			if entry == nil || entry.Category != adt.TYPCATEGORY_ARRAY {
+				return nil, false
+			}
+			actual = entry.ElemType
+		case types.ANYELEMENTOID:
+			polymorphic = true
+			if argTypes[j] == types.UNKNOWNOID {
+				continue
+			}
+			actual = argTypes[j]
+		default:
+			continue
+		}
+		if elemType == types.InvalidOid {
+			elemType = actual
+			continue
+		}
+		common, err := selectCommonType("polymorphic", elemType, actual)
+		if err != nil {
+			return nil, false
+		}
+		elemType = common
+	}
+	if !polymorphic {
+		return declared, true
+	}
+	arrayType := adt.ArrayTypeOf(elemType)
+	if elemType == types.InvalidOid || arrayType == types.InvalidOid {
+		return nil, false
+	}
+	resolved = make([]types.Oid, len(declared))
+	for j, declType := range declared {
+		switch declType {
+		case types.ANYARRAYOID:
+			resolved[j] = arrayType
+		case types.ANYELEMENTOID:
+			resolved[j] = elemType
+		default:
+			resolved[j] = declType
+		}
+	}
+	return resolved, true
+}
+
+// polymorphicResultType is the actual result type of a function or operator declared to return resultType
+func polymorphicResultType(resultType types.Oid, declared []types.Oid, resolved []types.Oid) types.Oid {
+	if resultType != types.ANYARRAYOID && resultType != types.ANYELEMENTOID {
+		return resultType
+	}
+	for j, declType := range declared {
+		switch {
+		case declType == resultType:
+			return resolved[j]
+		case declType == types.ANYARRAYOID:
+			return adt.LookupType(resolved[j]).ElemType
+		case declType == types.ANYELEMENTOID:
+			return adt.ArrayTypeOf(resolved[j])
+		}
+	}
+	return resultType
+}
+
+// coerceArgs converts each argument to the type the chosen function or operator declares for it, "any" takes the argument as it is
+func coerceArgs(args []types.Node, argTypes []types.Oid) ([]types.Node, error) {
+	coerced := make([]types.Node, len(args))
+	for i, arg := range args {
+		if argTypes[i] == types.ANYOID {
+			coerced[i] = resolveUnknown(arg)
+			continue
+		}
+		var err error
+		if coerced[i], err = coerceType(arg, argTypes[i]); err != nil {
+			return nil, err
+		}
+	}
+	return coerced, nil
+}
+
+func formatArgTypes(argTypes []types.Oid) string {
+	names := make([]string, len(argTypes))
+	for i, argType := range argTypes {
+		names[i] = adt.TypeName(argType)
+	}
+	return strings.Join(names, ", ")
+}
+
+// transformFuncExpr resolves a call of a builtin function that is neither an aggregate nor a window function
+func (pstate *ParseState) transformFuncExpr(fn *types.FuncCall) (types.Node, error) {
+	procs := adt.FunctionCandidates(fn.Funcname)
+	if len(procs) == 0 {
+		return nil, fmt.Errorf("function %s does not exist at position %d", fn.Funcname, fn.Location)
+	}
+
+	args := make([]types.Node, len(fn.Args))
+	argTypes := make([]types.Oid, len(fn.Args))
+	for i, rawArg := range fn.Args {
+		arg, err := pstate.transformExprRecurse(rawArg)
+		if err != nil {
+			return nil, err
+		}
+		args[i], argTypes[i] = arg, types.ExprType(arg)
+	}
+
+	//A variadic function is a candidate with its last argument type repeated as often as needed
+	candidates := make([][]types.Oid, len(procs))
+	for i, proc := range procs {
+		candidates[i] = proc.ArgTypes
+		if nfixed := len(proc.ArgTypes) - 1; proc.Variadic && len(argTypes) > nfixed {
+			candidates[i] = append([]types.Oid{}, proc.ArgTypes[:nfixed]...)
+			for len(candidates[i]) < len(argTypes) {
+				candidates[i] = append(candidates[i], proc.ArgTypes[nfixed])
+			}
+		}
+	}
+	best, resolved, ambiguous := selectCandidate(argTypes, candidates)
+	switch {
+	case best < 0:
+		return nil, fmt.Errorf("function %s(%s) does not exist at position %d", fn.Funcname, formatArgTypes(argTypes), fn.Location)
+	case ambiguous:
+		return nil, fmt.Errorf("function %s(%s) is not unique at position %d", fn.Funcname, formatArgTypes(argTypes), fn.Location)
+	}
+
+	proc := procs[best]
+	if proc.Retset {
+		if err := pstate.checkSetReturningCall(args, fn.Location); err != nil {
+			return nil, err
+		}
+	}
+	args, err := coerceArgs(args, resolved)
+	if err != nil {
+		return nil, fmt.Errorf("%v at position %d", err, fn.Location)
+	}
+	resultType := polymorphicResultType(proc.ResultType, candidates[best], resolved)
+	return &types.FuncExpr{Funcid: proc.Oid, Funcname: proc.Name, Args: args, FuncResultType: resultType}, nil
+}
+
+/*
+checkSetReturningCall makes sure a set returning function is called where a set can be taken: in FROM
+or in the select list, where a ProjectSet node runs it. Its arguments cannot be sets themselves
+*/
+func (pstate *ParseState) checkSetReturningCall(args []types.Node, location int) error {
+	switch {
+	case pstate.inAgg:
+		return fmt.Errorf("aggregate function calls cannot contain set-returning function calls at position %d", location)
+	case pstate.inWindowFunc:
+		return fmt.Errorf("window function calls cannot contain set-returning function calls at position %d", location)
+	case pstate.exprKind == EXPR_KIND_SELECT_TARGET:
+		pstate.hasTargetSRFs = true
+	case pstate.exprKind != EXPR_KIND_FROM_FUNCTION:
+		return fmt.Errorf("set-returning functions are not allowed in %s at position %d", pstate.exprKind, location)
+	}
+	for _, arg := range args {
+		if containsSetReturningCall(arg) {
+			return fmt.Errorf("set-returning function calls cannot be nested at position %d", location)
+		}
+	}
+	return nil
+}
+
+func containsSetReturningCall(expr types.Node) bool {
+	found := false
+	types.ExprWalker(expr, func(node types.Node) bool {
+		if fn, ok := node.(*types.FuncExpr); ok && adt.LookupFunction(fn.Funcid).Retset {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+/*
+usesOperatorTable tells if an operator on these operand types is one of adt's operators rather than the
+executor's own: arithmetic as soon as a date, time, interval or json value is involved, || of jsonb values
+or arrays, the json and array operators and pattern matching
+*/
+func usesOperatorTable(op string, ltype types.Oid, rtype types.Oid) bool {
+	category := func(typ types.Oid) byte {
+		if entry := adt.LookupType(typ); entry != nil {
+			return entry.Category
+		}
+		return 0
+	}
+	switch op {
+	case "+", "-", "*", "/":
+		for _, typ := range []types.Oid{ltype, rtype} {
+			switch category(typ) {
+			case adt.TYPCATEGORY_DATETIME, adt.TYPCATEGORY_TIMESPAN, adt.TYPCATEGORY_USER:
+				return true
+			}
+		}
+		return false
+	case "||":
+		if category(ltype) == adt.TYPCATEGORY_ARRAY || category(rtype) == adt.TYPCATEGORY_ARRAY {
+			return true
+		}
+		//text || jsonb is still text concatenation
+		return (ltype == types.JSONBOID || rtype == types.JSONBOID) &&
+			category(ltype) != adt.TYPCATEGORY_STRING && category(rtype) != adt.TYPCATEGORY_STRING
+	case "->", "->>", "#>", "#>>", "#-", "@>", "<@", "?", "?|", "?&", "@?", "@@", "&&":
+		return true
+	case "~~", "!~~", "~~*", "!~~*", "~", "!~", "~*", "!~*":
+		return true
+	}
+	return false
+}
+
+/*
+makeTableOperator resolves an operator of adt's table (postgres oper and make_op), left is nil for a
+prefix operator. Both operands are converted to the operator's types
+*/
+func makeTableOperator(name string, left types.Node, right types.Node) (types.Node, error) {
+	var argTypes []types.Oid
+	var args []types.Node
+	if left != nil {
+		args, argTypes = append(args, left), append(argTypes, types.ExprType(left))
+	}
+	args, argTypes = append(args, right), append(argTypes, types.ExprType(right))
+
+	var opers []*adt.Operator
+	var candidates [][]types.Oid
+	for _, oper := range adt.OperatorCandidates(name) {
+		if (oper.Left == types.InvalidOid) != (left == nil) {
+			continue
+		}
+		opers = append(opers, oper)
+		if left == nil {
+			candidates = append(candidates, []types.Oid{oper.Right})
+		} else {
+			candidates = append(candidates, []types.Oid{oper.Left, oper.Right})
+		}
+	}
+
+	best, resolved, ambiguous := selectCandidate(argTypes, candidates)
+	if best < 0 || ambiguous {
+		problem := "does not exist"
+		if ambiguous {
+			problem = "is not unique"
+		}
+		if left == nil {
+			return nil, fmt.Errorf("operator %s: %s %s", problem, name, adt.TypeName(argTypes[0]))
+		}
+		return nil, fmt.Errorf("operator %s: %s %s %s", problem, adt.TypeName(argTypes[0]), name, adt.TypeName(argTypes[1]))
+	}
+
+	oper := opers[best]
+	args, err := coerceArgs(args, resolved)
+	if err != nil {
+		return nil, err
+	}
+	resultType := polymorphicResultType(oper.ResultType, candidates[best], resolved)
+	return &types.OpExpr{Op: name, Opno: oper.Oid, Args: args, ResultType: resultType}, nil
+}
@@ -0,0 +1,141 @@
+package planner
+
+import (
+	"fmt"
+
+	"github.com/rautNishan/diskquery/access"
+	"github.com/rautNishan/diskquery/adt"
+	"github.com/rautNishan/diskquery/catalog"
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+Analysis of the expressions in utility statements (postgres parser/parse_utilcmd.c)
+
+The keys and the predicate of an index are evaluated on every row when the index is built and must give
+the same result whenever they are evaluated again, so there are no subqueries, aggregates, window functions
+or set returning functions in them and no calls of functions that depend on more than their arguments.
+INCLUDE only takes columns, their values are kept in the entries as they are
+*/
+
+// TransformIndexStmt analyzes the keys and the predicate of a CREATE INDEX against the columns of its table
+func TransformIndexStmt(stmt *types.IndexStmt, rel *catalog.Relation) (*types.IndexInfo, error) {
+	am := access.GetIndexAmRoutine(stmt.AccessMethod)
+	if am == nil {
+		return nil, fmt.Errorf("access method \"%s\" does not exist", stmt.AccessMethod)
+	}
+	if stmt.Unique && !am.CanUnique {
+		return nil, fmt.Errorf("access method \"%s\" does not support unique indexes", am.Name)
+	}
+	if len(stmt.IndexParams) > 1 && !am.CanMulticol {
+		return nil, fmt.Errorf("access method \"%s\" does not support multicolumn indexes", am.Name)
+	}
+	if len(stmt.IndexIncludingParams) > 0 && !am.CanInclude {
+		return nil, fmt.Errorf("access method \"%s\" does not support included columns", am.Name)
+	}
+
+	rte := &RangeTblEntry{refname: rel.Relname, columns: rel.Columns, relation: rel}
+	pstate := &ParseState{rte: rte}
+	info := &types.IndexInfo{Name: stmt.Idxname, AccessMethod: am.Name, Unique: stmt.Unique}
+
+	for _, elem := range stmt.IndexParams {
+		var expr types.Node
+		attnum := 0
+		keyName := elem.ExprText
+		if elem.Name != "" {
+			attno, err := rte.columnIndex(elem.Name, elem.Location)
+			if err != nil {
+				return nil, err
+			}
+			if attno < 0 {
+				return nil, fmt.Errorf("column \"%s\" does not exist at position %d", elem.Name, elem.Location)
+			}
+			col := rel.Columns[attno]
+			expr = &types.Var{AttNo: attno, Name: col.Name, VarType: col.TypeOid}
+			attnum = attno + 1
+			keyName = col.Name
+		} else {
+			var err error
+			if expr, err = pstate.transformExpr(elem.Expr, EXPR_KIND_INDEX_EXPRESSION); err != nil {
+				return nil, err
+			}
+			expr = resolveUnknown(expr)
+			if containsMutableFunctions(expr) {
+				return nil, fmt.Errorf("functions in index expression must be marked IMMUTABLE at position %d", elem.Location)
+			}
+		}
+
+		keyType := types.ExprType(expr)
+		if !am.HasOpclass(keyType) {
+			return nil, fmt.Errorf("data type %s has no default operator class for access method \"%s\" at position %d",
+				adt.TypeName(keyType), am.Name, elem.Location)
+		}
+		if !am.CanOrder {
+			if elem.Ordering != types.SORTBY_DEFAULT {
+				return nil, fmt.Errorf("access method \"%s\" does not support ASC/DESC options at position %d", am.Name, elem.Location)
+			}
+			if elem.NullsOrdering != types.SORTBY_NULLS_DEFAULT {
+				return nil, fmt.Errorf("access method \"%s\" does not support NULLS FIRST/LAST options at position %d", am.Name, elem.Location)
+			}
+		}
+		//As in ORDER BY, DESC puts the NULLs first unless told otherwise
+		key := types.SortKey{Expr: expr, Desc: elem.Ordering == types.SORTBY_DESC}
+		switch elem.NullsOrdering {
+		case types.SORTBY_NULLS_FIRST:
+			key.NullsFirst = true
+		case types.SORTBY_NULLS_LAST:
+			key.NullsFirst = false
+		default:
+			key.NullsFirst = key.Desc
+		}
+		info.Keys = append(info.Keys, key)
+		info.KeyNames = append(info.KeyNames, keyName)
+		info.Indkey = append(info.Indkey, attnum)
+	}
+
+	for _, elem := range stmt.IndexIncludingParams {
+		switch {
+		case elem.Name == "":
+			return nil, fmt.Errorf("expressions are not supported in included columns at position %d", elem.Location)
+		case elem.Ordering != types.SORTBY_DEFAULT:
+			return nil, fmt.Errorf("including column does not support ASC/DESC options at position %d", elem.Location)
+		case elem.NullsOrdering != types.SORTBY_NULLS_DEFAULT:
+			return nil, fmt.Errorf("including column does not support NULLS FIRST/LAST options at position %d", elem.Location)
+		}
+		attno, err := rte.columnIndex(elem.Name, elem.Location)
+		if err != nil {
+			return nil, err
+		}
+		if attno < 0 {
+			return nil, fmt.Errorf("column \"%s\" does not exist at position %d", elem.Name, elem.Location)
+		}
+		col := rel.Columns[attno]
+		info.Include = append(info.Include, &types.Var{AttNo: attno, Name: col.Name, VarType: col.TypeOid})
+		info.Indkey = append(info.Indkey, attno+1)
+	}
+
+	if stmt.WhereClause != nil {
+		predicate, err := pstate.transformWhereClause(stmt.WhereClause, EXPR_KIND_INDEX_PREDICATE)
+		if err != nil {
+			return nil, err
+		}
+		if containsMutableFunctions(predicate) {
+			return nil, fmt.Errorf("functions in index predicate must be marked IMMUTABLE")
+		}
+		info.Predicate = predicate
+	}
+	return info, nil
+}
+
+func containsMutableFunctions(expr types.Node) bool {
+	found := false
+	types.ExprWalker(expr, func(node types.Node) bool {
+		if fn, ok := node.(*types.FuncExpr); ok {
+			if proc := adt.LookupFunction(fn.Funcid); proc != nil && proc.Mutable {
+				found = true
+			}
+		}
+		return !found
+	})
+	return found
+}
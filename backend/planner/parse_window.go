@@ -0,0 +1,413 @@
+package planner
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/rautNishan/diskquery/adt"
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+Window functions (postgres parse_agg.c transformWindowFuncCall and parse_clause.c transformWindowDefinitions)
+
+Every window of the query, named in the WINDOW clause or written out in an OVER clause, becomes a
+WindowClause of the query and a window function points at it with WinRef. OVER clauses that spell out
+the same window share one WindowClause, their functions are computed by the same WindowAgg node.
+Any aggregate can be used as a window function, it is then computed over the window frame
+
+PARTITION BY and ORDER BY of a window are expressions over the input rows, unlike the query's ORDER BY
+an output column name or an ordinal means nothing special there (SQL:1999 rules, same as postgres)
+*/
+
+// WindowClause is an analyzed window
+type WindowClause struct {
+	name            string //Empty for the window of an OVER (...) clause
+	partitionClause []types.Node
+	orderClause     []types.SortKey
+	frameOptions    int
+	startOffset     types.Node
+	endOffset       types.Node
+	location        int
+}
+
+/*
+Window functions that are not aggregates
+check looks at the (already transformed) arguments, coerces them where needed and returns the result type
+*/
+type windowFunctionDef struct {
+	minArgs int
+	maxArgs int
+	check   func(args []types.Node) ([]types.Node, types.Oid, bool)
+}
+
+func noArgs(result types.Oid) func([]types.Node) ([]types.Node, types.Oid, bool) {
+	return func(args []types.Node) ([]types.Node, types.Oid, bool) {
+		return args, result, true
+	}
+}
+
+// coerceIntegerArgs makes the arguments from position first on integers
+func coerceIntegerArgs(args []types.Node, first int) bool {
+	for i := first; i < len(args); i++ {
+		arg, err := coerceUnknown(args[i], types.INT8OID)
+		if err != nil {
+			return false
+		}
+		if argType := types.ExprType(arg); argType != types.INT8OID && argType != types.INT4OID {
+			return false
+		}
+		args[i] = arg
+	}
+	return true
+}
+
+// The value of the first argument at another row, the other arguments are integers
+func valueAtRow(args []types.Node) ([]types.Node, types.Oid, bool) {
+	args[0] = resolveUnknown(args[0])
+	return args, types.ExprType(args[0]), coerceIntegerArgs(args, 1)
+}
+
+// lag(value [, offset [, default]]), default has the type of value
+func lagLead(args []types.Node) ([]types.Node, types.Oid, bool) {
+	args[0] = resolveUnknown(args[0])
+	valueType := types.ExprType(args[0])
+	if len(args) == 3 {
+		def, err := coerceUnknown(args[2], valueType)
+		if err != nil || types.ExprType(def) != valueType {
+			return args, types.InvalidOid, false
+		}
+		args[2] = def
+	}
+	return args, valueType, coerceIntegerArgs(args[:min(len(args), 2)], 1)
+}
+
+var windowFunctions = map[string]windowFunctionDef{
+	"row_number":   {0, 0, noArgs(types.INT8OID)},
+	"rank":         {0, 0, noArgs(types.INT8OID)},
+	"dense_rank":   {0, 0, noArgs(types.INT8OID)},
+	"percent_rank": {0, 0, noArgs(types.FLOAT8OID)},
+	"cume_dist":    {0, 0, noArgs(types.FLOAT8OID)},
+	"ntile": {1, 1, func(args []types.Node) ([]types.Node, types.Oid, bool) {
+		return args, types.INT4OID, coerceIntegerArgs(args, 0)
+	}},
+	"lag":         {1, 3, lagLead},
+	"lead":        {1, 3, lagLead},
+	"first_value": {1, 1, valueAtRow},
+	"last_value":  {1, 1, valueAtRow},
+	"nth_value":   {2, 2, valueAtRow},
+}
+
+func (pstate *ParseState) transformWindowFuncCall(fn *types.FuncCall) (types.Node, error) {
+	switch pstate.exprKind {
+	case EXPR_KIND_SELECT_TARGET, EXPR_KIND_ORDER_BY:
+	case EXPR_KIND_WINDOW_PARTITION, EXPR_KIND_WINDOW_ORDER, EXPR_KIND_WINDOW_FRAME_RANGE,
+		EXPR_KIND_WINDOW_FRAME_ROWS, EXPR_KIND_WINDOW_FRAME_GROUPS:
+		return nil, fmt.Errorf("window functions are not allowed in window definitions at position %d", fn.Location)
+	default:
+		return nil, fmt.Errorf("window functions are not allowed in %s at position %d", pstate.exprKind, fn.Location)
+	}
+	if pstate.inAgg {
+		return nil, fmt.Errorf("aggregate function calls cannot contain window function calls at position %d", fn.Location)
+	}
+	if pstate.inWindowFunc {
+		return nil, fmt.Errorf("window function calls cannot be nested at position %d", fn.Location)
+	}
+
+	aggDef, isAgg := aggregates[fn.Funcname]
+	winDef, isWindow := windowFunctions[fn.Funcname]
+	switch {
+	case !isAgg && !isWindow:
+		return nil, fmt.Errorf("OVER specified, but %s is not a window function nor an aggregate function at position %d", fn.Funcname, fn.Location)
+	case fn.AggDistinct:
+		return nil, fmt.Errorf("DISTINCT is not implemented for window functions at position %d", fn.Location)
+	case fn.AggFilter != nil && !isAgg:
+		return nil, fmt.Errorf("FILTER is not implemented for non-aggregate window functions at position %d", fn.Location)
+	case fn.AggStar && fn.Funcname != "count":
+		return nil, fmt.Errorf("%s(*) is not supported, only count(*) at position %d", fn.Funcname, fn.Location)
+	}
+
+	winRef, err := pstate.transformWindowReference(fn.Over)
+	if err != nil {
+		return nil, err
+	}
+	wfunc := &types.WindowFunc{WinName: fn.Funcname, WinRef: winRef, WinStar: fn.AggStar, WinAgg: isAgg}
+
+	pstate.inWindowFunc = true
+	defer func() { pstate.inWindowFunc = false }()
+
+	args := make([]types.Node, 0, len(fn.Args))
+	for _, rawArg := range fn.Args {
+		arg, err := pstate.transformExprRecurse(rawArg)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+
+	switch {
+	case fn.AggStar:
+		wfunc.WinType = types.INT8OID
+	case isAgg:
+		if len(args) != aggDef.nargs {
+			return nil, fmt.Errorf("function %s with %d arguments does not exist at position %d", fn.Funcname, len(args), fn.Location)
+		}
+		argTypes := make([]types.Oid, len(args))
+		for i := range args {
+			args[i] = resolveUnknown(args[i])
+			argTypes[i] = types.ExprType(args[i])
+		}
+		resultType, ok := aggDef.resultType(argTypes)
+		if !ok {
+			return nil, fmt.Errorf("function %s(%s) does not exist at position %d", fn.Funcname, typeNames(argTypes), fn.Location)
+		}
+		wfunc.WinType = resultType
+	default:
+		if len(args) < winDef.minArgs || len(args) > winDef.maxArgs {
+			return nil, fmt.Errorf("function %s with %d arguments does not exist at position %d", fn.Funcname, len(args), fn.Location)
+		}
+		checked, resultType, ok := winDef.check(args)
+		if !ok {
+			argTypes := make([]types.Oid, len(args))
+			for i := range args {
+				argTypes[i] = types.ExprType(args[i])
+			}
+			return nil, fmt.Errorf("function %s(%s) does not exist at position %d", fn.Funcname, typeNames(argTypes), fn.Location)
+		}
+		args, wfunc.WinType = checked, resultType
+	}
+	wfunc.Args = args
+
+	if fn.AggFilter != nil {
+		savedKind := pstate.exprKind
+		pstate.exprKind = EXPR_KIND_FILTER
+		filter, err := pstate.transformExprRecurse(fn.AggFilter)
+		pstate.exprKind = savedKind
+		if err != nil {
+			return nil, err
+		}
+		filter, err = coerceUnknown(filter, types.BOOLOID)
+		if err != nil {
+			return nil, err
+		}
+		if filterType := types.ExprType(filter); filterType != types.BOOLOID {
+			return nil, fmt.Errorf("argument of FILTER must be type boolean, not type %s at position %d", adt.TypeName(filterType), fn.Location)
+		}
+		wfunc.AggFilter = filter
+	}
+
+	pstate.hasWindowFuncs = true
+	return wfunc, nil
+}
+
+/*
+transformWindowReference finds the window of an OVER clause and returns its position in the query's windows
+OVER name uses a WINDOW clause entry as it is, an OVER (...) that matches a window we already have shares it
+*/
+func (pstate *ParseState) transformWindowReference(over *types.WindowDef) (int, error) {
+	if over.Name != "" {
+		if winRef := pstate.findWindow(over.Name); winRef >= 0 {
+			return winRef, nil
+		}
+		return -1, fmt.Errorf("window \"%s\" does not exist at position %d", over.Name, over.Location)
+	}
+
+	wc, err := pstate.transformWindowDef(over)
+	if err != nil {
+		return -1, err
+	}
+	for winRef, existing := range pstate.windowClause {
+		if sameWindow(existing, wc) {
+			return winRef, nil
+		}
+	}
+	pstate.windowClause = append(pstate.windowClause, wc)
+	return len(pstate.windowClause) - 1, nil
+}
+
+func (pstate *ParseState) findWindow(name string) int {
+	for winRef, wc := range pstate.windowClause {
+		if wc.name == name {
+			return winRef
+		}
+	}
+	return -1
+}
+
+func sameWindow(a *WindowClause, b *WindowClause) bool {
+	return a.frameOptions == b.frameOptions &&
+		reflect.DeepEqual(a.partitionClause, b.partitionClause) &&
+		reflect.DeepEqual(a.orderClause, b.orderClause) &&
+		reflect.DeepEqual(a.startOffset, b.startOffset) &&
+		reflect.DeepEqual(a.endOffset, b.endOffset)
+}
+
+// transformWindowClause analyzes the WINDOW clause, an entry can build on the entries before it
+func (pstate *ParseState) transformWindowClause(windowDefs []*types.WindowDef) error {
+	for _, def := range windowDefs {
+		if pstate.findWindow(def.Name) >= 0 {
+			return fmt.Errorf("window \"%s\" is already defined at position %d", def.Name, def.Location)
+		}
+		wc, err := pstate.transformWindowDef(def)
+		if err != nil {
+			return err
+		}
+		wc.name = def.Name
+		pstate.windowClause = append(pstate.windowClause, wc)
+	}
+	return nil
+}
+
+/*
+transformWindowDef analyzes a window specification
+With a reference to a named window the PARTITION BY comes from that window and so does the ORDER BY
+unless it has none, in which case we can add our own. The named window cannot have a frame clause
+*/
+func (pstate *ParseState) transformWindowDef(def *types.WindowDef) (*WindowClause, error) {
+	wc := &WindowClause{frameOptions: def.FrameOptions, location: def.Location}
+
+	var refwc *WindowClause
+	if def.Refname != "" {
+		winRef := pstate.findWindow(def.Refname)
+		if winRef < 0 {
+			return nil, fmt.Errorf("window \"%s\" does not exist at position %d", def.Refname, def.Location)
+		}
+		refwc = pstate.windowClause[winRef]
+		switch {
+		case def.PartitionClause != nil:
+			return nil, fmt.Errorf("cannot override PARTITION BY clause of window \"%s\" at position %d", def.Refname, def.Location)
+		case refwc.orderClause != nil && def.OrderClause != nil:
+			return nil, fmt.Errorf("cannot override ORDER BY clause of window \"%s\" at position %d", def.Refname, def.Location)
+		case refwc.frameOptions&types.FRAMEOPTION_NONDEFAULT != 0:
+			return nil, fmt.Errorf("cannot copy window \"%s\" because it has a frame clause at position %d", def.Refname, def.Location)
+		}
+		//Copies, the planner replaces the expressions of every window in place
+		wc.partitionClause = append([]types.Node(nil), refwc.partitionClause...)
+		wc.orderClause = append([]types.SortKey(nil), refwc.orderClause...)
+	}
+
+	for _, rawExpr := range def.PartitionClause {
+		expr, err := pstate.transformExpr(rawExpr, EXPR_KIND_WINDOW_PARTITION)
+		if err != nil {
+			return nil, err
+		}
+		wc.partitionClause = append(wc.partitionClause, resolveUnknown(expr))
+	}
+	for _, sortBy := range def.OrderClause {
+		expr, err := pstate.transformExpr(sortBy.Node, EXPR_KIND_WINDOW_ORDER)
+		if err != nil {
+			return nil, err
+		}
+		sortKey := types.SortKey{Expr: resolveUnknown(expr), Desc: sortBy.SortbyDir == types.SORTBY_DESC}
+		switch sortBy.SortbyNull {
+		case types.SORTBY_NULLS_FIRST:
+			sortKey.NullsFirst = true
+		case types.SORTBY_NULLS_DEFAULT:
+			sortKey.NullsFirst = sortKey.Desc
+		}
+		wc.orderClause = append(wc.orderClause, sortKey)
+	}
+
+	return wc, pstate.transformFrameOffsets(wc, def)
+}
+
+// transformFrameOffsets checks the frame of a window against its ORDER BY and analyzes the offsets
+func (pstate *ParseState) transformFrameOffsets(wc *WindowClause, def *types.WindowDef) error {
+	options := wc.frameOptions
+	hasOffset := options&(types.FRAMEOPTION_START_OFFSET|types.FRAMEOPTION_END_OFFSET) != 0
+
+	var kind ParseExprKind
+	var targetType types.Oid
+	switch {
+	case options&types.FRAMEOPTION_RANGE != 0:
+		kind = EXPR_KIND_WINDOW_FRAME_RANGE
+		if !hasOffset {
+			return nil
+		}
+		if len(wc.orderClause) != 1 {
+			return fmt.Errorf("RANGE with offset PRECEDING/FOLLOWING requires exactly one ORDER BY column at position %d", def.Location)
+		}
+		targetType = types.ExprType(wc.orderClause[0].Expr)
+		if !isNumericType(targetType) {
+			return fmt.Errorf("RANGE with offset PRECEDING/FOLLOWING is not supported for column type %s at position %d", adt.TypeName(targetType), def.Location)
+		}
+	case options&types.FRAMEOPTION_GROUPS != 0:
+		kind = EXPR_KIND_WINDOW_FRAME_GROUPS
+		if len(wc.orderClause) == 0 {
+			return fmt.Errorf("GROUPS mode requires an ORDER BY clause at position %d", def.Location)
+		}
+		targetType = types.INT8OID
+	default:
+		kind = EXPR_KIND_WINDOW_FRAME_ROWS
+		targetType = types.INT8OID
+	}
+
+	transformOffset := func(raw types.Node) (types.Node, error) {
+		if raw == nil {
+			return nil, nil
+		}
+		offset, err := pstate.transformExpr(raw, kind)
+		if err != nil {
+			return nil, err
+		}
+		if offset, err = coerceUnknown(offset, targetType); err != nil {
+			return nil, err
+		}
+		//Evaluated once per partition, so only columns of outer queries can be used
+		usesVars := false
+		types.ExprWalker(offset, func(node types.Node) bool {
+			if v, ok := node.(*types.Var); ok && v.LevelsUp == 0 {
+				usesVars = true
+			}
+			return !usesVars
+		})
+		if usesVars {
+			return nil, fmt.Errorf("argument of %s must not contain variables at position %d", kind.frameName(), def.Location)
+		}
+
+		offsetType := types.ExprType(offset)
+		switch {
+		case kind != EXPR_KIND_WINDOW_FRAME_RANGE:
+			if offsetType != types.INT8OID && offsetType != types.INT4OID {
+				return nil, fmt.Errorf("argument of %s must be type bigint, not type %s at position %d", kind.frameName(), adt.TypeName(offsetType), def.Location)
+			}
+		case !isNumericType(offsetType),
+			numericCommonType(targetType, offsetType) != targetType && !(isIntegerType(targetType) && isIntegerType(offsetType)):
+			//The offset may be of a narrower type than the column, never of a wider one. Any integer goes with an integer column
+			return nil, fmt.Errorf("RANGE with offset PRECEDING/FOLLOWING is not supported for column type %s and offset type %s at position %d",
+				adt.TypeName(targetType), adt.TypeName(offsetType), def.Location)
+		case offsetType != targetType && (targetType == types.NUMERICOID || targetType == types.FLOAT8OID):
+			return coerceType(offset, targetType)
+		}
+		return offset, nil
+	}
+
+	var err error
+	if wc.startOffset, err = transformOffset(def.StartOffset); err != nil {
+		return err
+	}
+	wc.endOffset, err = transformOffset(def.EndOffset)
+	return err
+}
+
+// frameName is ROWS, RANGE or GROUPS for the frame offset kinds
+func (kind ParseExprKind) frameName() string {
+	switch kind {
+	case EXPR_KIND_WINDOW_FRAME_RANGE:
+		return "RANGE"
+	case EXPR_KIND_WINDOW_FRAME_GROUPS:
+		return "GROUPS"
+	}
+	return "ROWS"
+}
+
+func containsWindowFunc(expr types.Node) bool {
+	found := false
+	types.ExprWalker(expr, func(node types.Node) bool {
+		if _, ok := node.(*types.WindowFunc); ok {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
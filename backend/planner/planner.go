@@ -0,0 +1,375 @@
+package planner
+
+import (
+	"fmt"
+
+	"github.com/rautNishan/diskquery/access"
+	"github.com/rautNishan/diskquery/guc"
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+Plan analyzes a raw parse tree and builds the plan the executor will run
+The enable_* settings of the session decide which plans may be chosen
+*/
+func Plan(stmt types.Node, session *guc.Session) (*types.PlannedStmt, error) {
+	switch s := stmt.(type) {
+	case *types.SelectStmt:
+		query, err := transformStmt(s, nil)
+		if err != nil {
+			return nil, err
+		}
+		//Whatever literals are still of unknown type are sent to the client as text
+		resolveTargetListUnknown(query.targetList)
+		return planQuery(query, session)
+	case *types.InsertStmt:
+		query, err := transformInsertStmt(s)
+		if err != nil {
+			return nil, err
+		}
+		return planQuery(query, session)
+	case *types.UpdateStmt:
+		query, err := transformUpdateStmt(s)
+		if err != nil {
+			return nil, err
+		}
+		return planQuery(query, session)
+	case *types.DeleteStmt:
+		query, err := transformDeleteStmt(s)
+		if err != nil {
+			return nil, err
+		}
+		return planQuery(query, session)
+	}
+	return nil, fmt.Errorf("unsupported statement type: %T", stmt)
+}
+
+func planQuery(query *Query, session *guc.Session) (*types.PlannedStmt, error) {
+	root := &PlannerInfo{glob: newPlannerGlobal(session)}
+	if query.commandType != types.CMD_SELECT {
+		plan, err := root.planModifyTable(query)
+		if err != nil {
+			return nil, err
+		}
+		return &types.PlannedStmt{CommandType: query.commandType, PlanTree: plan, TargetList: plan.ReturningList, NParamExec: root.glob.nParamExec}, nil
+	}
+	plan, err := planQueryTree(root, query)
+	if err != nil {
+		return nil, err
+	}
+	return &types.PlannedStmt{PlanTree: plan, TargetList: query.targetList, NParamExec: root.glob.nParamExec}, nil
+}
+
+/*
+planModifyTable plans an INSERT, UPDATE or DELETE (postgres make_modifytable). The rows to insert come from a
+Result per row of VALUES, under an Append when there are several, or from the plan of the SELECT. UPDATE and
+DELETE read the table with a SeqScan or an IndexScan, which tell where each row is in the relation file: never
+with an index-only scan or from the columnar file. The definitions of the indexes go with the plan, ModifyTable
+computes the entries of the rows it stores
+*/
+func (root *PlannerInfo) planModifyTable(query *Query) (*types.ModifyTable, error) {
+	rel := query.resultRelation
+	modify := &types.ModifyTable{Operation: query.commandType, Relid: rel.Relid, Relname: rel.Relname, FilePath: rel.FilePath}
+	for _, col := range rel.Columns {
+		modify.ColNames = append(modify.ColNames, col.Name)
+		modify.ColTypes = append(modify.ColTypes, col.TypeOid)
+		modify.NotNull = append(modify.NotNull, col.NotNull)
+	}
+
+	switch {
+	case query.commandType == types.CMD_INSERT && query.rte == nil:
+		var plans []types.PlanNode
+		for _, row := range query.valuesLists {
+			plan, err := planQueryTree(root, &Query{targetList: row})
+			if err != nil {
+				return nil, err
+			}
+			plans = append(plans, plan)
+		}
+		if len(plans) == 1 {
+			modify.Lefttree = plans[0]
+		} else {
+			modify.Lefttree = &types.Append{Appendplans: plans}
+		}
+
+	case query.commandType == types.CMD_INSERT:
+		plan, err := planQueryTree(root, &Query{rte: query.rte, targetList: query.targetList})
+		if err != nil {
+			return nil, err
+		}
+		modify.Lefttree = plan
+
+	default:
+		if err := root.preprocessQuery(query); err != nil {
+			return nil, err
+		}
+		plan, err := root.planFromItem(query.rte, query.whereClause)
+		if err != nil {
+			return nil, err
+		}
+		if root.glob.session.EnableIndexScan {
+			used := make(map[int]bool)
+			for attno := range rel.Columns {
+				used[attno] = true
+			}
+			indexScan, err := makeIndexScan(rel, query.whereClause, modify.ColTypes, used)
+			if err != nil {
+				return nil, err
+			}
+			if indexOnlyScan, ok := indexScan.(*types.IndexOnlyScan); ok {
+				indexScan = &indexOnlyScan.IndexScan
+			}
+			if indexScan != nil {
+				plan = indexScan
+			}
+		}
+		plan.GetPlan().TargetList = query.targetList
+		modify.Lefttree = plan
+	}
+
+	for _, tle := range query.returningList {
+		var err error
+		if tle.Expr, err = root.preprocessExpression(tle.Expr); err != nil {
+			return nil, err
+		}
+	}
+	modify.ReturningList = query.returningList
+
+	for _, index := range rel.Indexes {
+		info, err := AnalyzeIndexDefinition(index, rel)
+		if err != nil {
+			return nil, err
+		}
+		modify.Indexes = append(modify.Indexes, &types.ModifyTableIndex{Indexrelid: index.Indexrelid, Path: index.FilePath, Info: info})
+	}
+	return modify, nil
+}
+
+func planQueryTree(root *PlannerInfo, query *Query) (types.PlanNode, error) {
+	var plan types.PlanNode
+	var err error
+	if query.setOp != types.SETOP_NONE {
+		plan, err = planSetOperation(root, query)
+	} else {
+		plan, err = planSimpleQuery(root, query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if query.limitCount, err = root.preprocessExpression(query.limitCount); err != nil {
+		return nil, err
+	}
+	if query.limitOffset, err = root.preprocessExpression(query.limitOffset); err != nil {
+		return nil, err
+	}
+
+	//Sort keys are output columns of the node below, junk columns included
+	if len(query.sortClause) > 0 {
+		sortKeys := make([]types.SortKey, len(query.sortClause))
+		for i, clause := range query.sortClause {
+			tle := query.targetList[clause.TleIndex]
+			sortKeys[i] = types.SortKey{
+				Expr:       &types.Var{AttNo: clause.TleIndex, Name: tle.ResName, VarType: types.ExprType(tle.Expr)},
+				Desc:       clause.Desc,
+				NullsFirst: clause.NullsFirst,
+			}
+		}
+		plan = &types.Sort{Plan: types.Plan{Lefttree: plan}, SortKeys: sortKeys}
+	}
+
+	if query.limitCount != nil || query.limitOffset != nil {
+		plan = &types.Limit{
+			Plan:        types.Plan{Lefttree: plan},
+			LimitCount:  query.limitCount,
+			LimitOffset: query.limitOffset,
+		}
+	}
+
+	return plan, nil
+}
+
+/*
+planSimpleQuery plans the scan, grouping, window functions and DISTINCT of a plain SELECT
+Subqueries in WHERE that can be turned into semi or anti joins are joined right above the scan,
+whatever is left of WHERE is checked by the scan itself
+*/
+func planSimpleQuery(root *PlannerInfo, query *Query) (types.PlanNode, error) {
+	joins := pullUpSublinks(query)
+	if err := root.preprocessQuery(query); err != nil {
+		return nil, err
+	}
+
+	var plan types.PlanNode
+	if query.rte == nil {
+		plan = &types.Result{Plan: types.Plan{Qual: query.whereClause}}
+	} else {
+		var err error
+		if plan, err = root.planFromItem(query.rte, query.whereClause); err != nil {
+			return nil, err
+		}
+	}
+	//A relation read on its own may be read from its columnar file or through an index instead
+	if query.rte != nil && query.rte.relation != nil {
+		rel, seqScan := query.rte.relation, plan.(*types.SeqScan)
+		used := queryUsedColumns(query, joins)
+		if root.glob.session.EnableColumnarScan && rel.Relam == access.COLUMNAR_TABLE_AM_NAME {
+			plan = makeColumnarScan(rel, query.whereClause, seqScan.ColTypes, used)
+		}
+		if root.glob.session.EnableIndexScan {
+			indexScan, err := makeIndexScan(rel, query.whereClause, seqScan.ColTypes, used)
+			if err != nil {
+				return nil, err
+			}
+			if indexScan != nil {
+				plan = indexScan
+			}
+		}
+	}
+
+	for _, join := range joins {
+		joinPlan, err := root.makeHashJoin(plan, join)
+		if err != nil {
+			return nil, err
+		}
+		plan = joinPlan
+	}
+
+	//With window functions the scan or the Agg only computes what the WindowAggs need
+	targetList := query.targetList
+	if query.hasWindowFuncs {
+		targetList = makeWindowInputTargetList(query)
+	}
+	switch {
+	case query.hasAggs() || len(query.groupClause) > 0 || query.having != nil:
+		plan = root.makeAgg(plan, query.groupClause, query.aggs, targetList, query.having)
+	case query.hasTargetSRFs:
+		//The scan returns its tuples as they are, ProjectSet computes the select list on top of them
+		plan = &types.ProjectSet{Plan: types.Plan{TargetList: targetList, Lefttree: plan}}
+	default:
+		plan.GetPlan().TargetList = targetList
+	}
+	if query.hasWindowFuncs {
+		plan = makeWindowAggs(plan, query, targetList)
+	}
+
+	if query.distinct {
+		plan = root.makeDistinct(plan, query.targetList)
+	}
+	return plan, nil
+}
+
+/*
+planFromItem plans the scan of a FROM item, qual is checked on the tuples it returns
+A join reads both of its sides with a NestLoop, each side returns exactly its own columns
+*/
+func (root *PlannerInfo) planFromItem(rte *RangeTblEntry, qual types.Node) (types.PlanNode, error) {
+	switch {
+	case rte.larg != nil:
+		lplan, err := root.planJoinInput(rte.larg)
+		if err != nil {
+			return nil, err
+		}
+		rplan, err := root.planJoinInput(rte.rarg)
+		if err != nil {
+			return nil, err
+		}
+		joinQual, err := root.preprocessExpression(rte.joinQuals)
+		if err != nil {
+			return nil, err
+		}
+		return &types.NestLoop{
+			Plan:       types.Plan{Qual: qual, Lefttree: lplan, Righttree: rplan},
+			JoinType:   rte.joinType,
+			JoinQual:   joinQual,
+			OuterWidth: rte.larg.width(),
+			InnerWidth: rte.rarg.width(),
+		}, nil
+
+	case rte.selfReference:
+		return root.makeWorkTableScan(rte, qual), nil
+
+	case rte.cte != nil && !rte.cte.inlined():
+		return root.makeCteScan(rte, qual)
+
+	case rte.function != nil:
+		funcExpr, err := root.preprocessExpression(rte.function)
+		if err != nil {
+			return nil, err
+		}
+		return &types.FunctionScan{Plan: types.Plan{Qual: qual}, FuncExpr: funcExpr}, nil
+
+	case rte.subquery != nil:
+		subplan, err := planQueryTree(root.makeSubroot(), rte.subquery)
+		if err != nil {
+			return nil, err
+		}
+		return &types.Result{Plan: types.Plan{Qual: qual, Lefttree: subplan}}, nil
+	}
+
+	rel := rte.relation
+	colTypes := make([]types.Oid, len(rel.Columns))
+	for i, col := range rel.Columns {
+		colTypes[i] = col.TypeOid
+	}
+	return &types.SeqScan{
+		Plan:     types.Plan{Qual: qual},
+		Relid:    rel.Relid,
+		Relname:  rel.Relname,
+		FilePath: rel.FilePath,
+		ColTypes: colTypes,
+	}, nil
+}
+
+// planJoinInput plans one side of a join, a subquery's junk columns are left out so the other side's columns follow
+func (root *PlannerInfo) planJoinInput(rte *RangeTblEntry) (types.PlanNode, error) {
+	plan, err := root.planFromItem(rte, nil)
+	if err != nil || rte.larg != nil {
+		return plan, err
+	}
+	targetList := make([]*types.TargetEntry, len(rte.columns))
+	for attno, col := range rte.columns {
+		targetList[attno] = &types.TargetEntry{Expr: rte.columnExpr(attno, 0, 0), ResName: col.Name}
+	}
+	plan.GetPlan().TargetList = targetList
+	return plan, nil
+}
+
+/*
+makeAgg puts an Agg node on top of lefttree
+Without GROUP BY there is a single group, otherwise we either hash the groups or sort the input
+by the group keys so each group arrives as a run of consecutive tuples
+*/
+func (root *PlannerInfo) makeAgg(lefttree types.PlanNode, groupExprs []types.Node, aggs []*types.Aggref, targetList []*types.TargetEntry, having types.Node) types.PlanNode {
+	agg := &types.Agg{
+		Plan:       types.Plan{TargetList: targetList, Qual: having, Lefttree: lefttree},
+		GroupExprs: groupExprs,
+		Aggs:       aggs,
+	}
+
+	switch {
+	case len(groupExprs) == 0:
+		agg.Strategy = types.AGG_PLAIN
+	case root.glob.session.EnableHashAgg:
+		agg.Strategy = types.AGG_HASHED
+	default:
+		agg.Strategy = types.AGG_SORTED
+		sortKeys := make([]types.SortKey, len(groupExprs))
+		for i, groupExpr := range groupExprs {
+			sortKeys[i] = types.SortKey{Expr: groupExpr}
+		}
+		agg.Lefttree = &types.Sort{Plan: types.Plan{Lefttree: lefttree}, SortKeys: sortKeys}
+	}
+	return agg
+}
+
+// SELECT DISTINCT is a grouping on every output column without any aggregates
+func (root *PlannerInfo) makeDistinct(lefttree types.PlanNode, targetList []*types.TargetEntry) types.PlanNode {
+	groupExprs := make([]types.Node, len(targetList))
+	outputList := make([]*types.TargetEntry, len(targetList))
+	for i, tle := range targetList {
+		outVar := &types.Var{AttNo: i, Name: tle.ResName, VarType: types.ExprType(tle.Expr)}
+		groupExprs[i] = outVar
+		outputList[i] = &types.TargetEntry{Expr: outVar, ResName: tle.ResName, ResJunk: tle.ResJunk}
+	}
+	return root.makeAgg(lefttree, groupExprs, nil, outputList, nil)
+}
@@ -0,0 +1,199 @@
+package planner
+
+import (
+	"fmt"
+
+	"github.com/rautNishan/diskquery/adt"
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+transformSetOperationStmt analyzes UNION / INTERSECT / EXCEPT
+Both sides are analyzed on their own, then every output column gets a type both sides can be
+converted to. The result columns take their names from the leftmost SELECT
+*/
+func transformSetOperationStmt(stmt *types.SelectStmt, parentState *ParseState, ctes []*CommonTableExpr) (*Query, error) {
+	ctes, err := transformWithClause(stmt.WithClause, parentState, ctes)
+	if err != nil {
+		return nil, err
+	}
+	larg, err := transformQueryLevel(stmt.Larg, parentState, ctes)
+	if err != nil {
+		return nil, err
+	}
+	rarg, err := transformQueryLevel(stmt.Rarg, parentState, ctes)
+	if err != nil {
+		return nil, err
+	}
+
+	lcols, rcols := nonJunkColumns(larg.targetList), nonJunkColumns(rarg.targetList)
+	if len(lcols) != len(rcols) {
+		return nil, fmt.Errorf("each %s query must have the same number of columns", stmt.Op)
+	}
+
+	query := &Query{setOp: stmt.Op, all: stmt.All, larg: larg, rarg: rarg}
+	for i := range lcols {
+		commonType, err := selectCommonType(stmt.Op.String(), types.ExprType(lcols[i].Expr), types.ExprType(rcols[i].Expr))
+		if err != nil {
+			return nil, err
+		}
+		//Unknown literals are converted right away, everything else gets a CoerceExpr when planning
+		if lcols[i].Expr, err = coerceUnknown(lcols[i].Expr, commonType); err != nil {
+			return nil, err
+		}
+		if rcols[i].Expr, err = coerceUnknown(rcols[i].Expr, commonType); err != nil {
+			return nil, err
+		}
+		query.targetList = append(query.targetList, &types.TargetEntry{
+			Expr:    &types.Var{AttNo: i, Name: lcols[i].ResName, VarType: commonType},
+			ResName: lcols[i].ResName,
+		})
+	}
+
+	pstate := &ParseState{}
+	for _, sortBy := range stmt.SortClause {
+		sortClause, err := pstate.transformSortClause(sortBy, query)
+		if err != nil {
+			return nil, err
+		}
+		query.sortClause = append(query.sortClause, sortClause)
+	}
+	if query.limitCount, err = transformLimitClause(stmt.LimitCount, EXPR_KIND_LIMIT); err != nil {
+		return nil, err
+	}
+	if query.limitOffset, err = transformLimitClause(stmt.LimitOffset, EXPR_KIND_OFFSET); err != nil {
+		return nil, err
+	}
+	return query, nil
+}
+
+func nonJunkColumns(targetList []*types.TargetEntry) []*types.TargetEntry {
+	var columns []*types.TargetEntry
+	for _, tle := range targetList {
+		if !tle.ResJunk {
+			columns = append(columns, tle)
+		}
+	}
+	return columns
+}
+
+/*
+selectCommonType picks the type two set operation branches (or two ARRAY[...] elements) are unified to
+Unknown literals take the other side's type, numbers widen to numeric or double precision,
+otherwise one side must have an implicit cast to the other's type. context names the construct for errors
+*/
+func selectCommonType(context string, ltype types.Oid, rtype types.Oid) (types.Oid, error) {
+	switch {
+	case ltype == rtype:
+		if ltype == types.UNKNOWNOID {
+			return types.TEXTOID, nil
+		}
+		return ltype, nil
+	case ltype == types.UNKNOWNOID:
+		return rtype, nil
+	case rtype == types.UNKNOWNOID:
+		return ltype, nil
+	case isNumericType(ltype) && isNumericType(rtype):
+		return numericCommonType(ltype, rtype), nil
+	case adt.CanCoerce(ltype, rtype, adt.COERCION_IMPLICIT):
+		return rtype, nil
+	case adt.CanCoerce(rtype, ltype, adt.COERCION_IMPLICIT):
+		return ltype, nil
+	}
+	return types.InvalidOid, fmt.Errorf("%s types %s and %s cannot be matched", context, adt.TypeName(ltype), adt.TypeName(rtype))
+}
+
+/*
+planSetOperation builds the plan for a set operation Query
+UNION ALL just appends both sides, UNION removes duplicates on top of that the same way
+SELECT DISTINCT does. INTERSECT and EXCEPT count the copies of each tuple on both sides in a
+SetOp node, either with a hash table or by sorting both sides and merging them
+*/
+func planSetOperation(root *PlannerInfo, query *Query) (types.PlanNode, error) {
+	lplan, err := planSetOpChild(root, query.larg, query.targetList)
+	if err != nil {
+		return nil, err
+	}
+	rplan, err := planSetOpChild(root, query.rarg, query.targetList)
+	if err != nil {
+		return nil, err
+	}
+
+	if query.setOp == types.SETOP_UNION {
+		plan := types.PlanNode(&types.Append{Appendplans: []types.PlanNode{lplan, rplan}})
+		if !query.all {
+			plan = root.makeDistinct(plan, query.targetList)
+		}
+		return plan, nil
+	}
+
+	setOp := &types.SetOp{Cmd: query.setOp, All: query.all, Strategy: types.SETOP_HASHED}
+	if !root.glob.session.EnableHashAgg {
+		setOp.Strategy = types.SETOP_SORTED
+		lplan = sortOnAllColumns(lplan, query.targetList)
+		rplan = sortOnAllColumns(rplan, query.targetList)
+	}
+	setOp.Lefttree, setOp.Righttree = lplan, rplan
+	return setOp, nil
+}
+
+/*
+planRecursiveUnion plans WITH RECURSIVE, the UNION of its non-recursive and recursive terms
+The work table gets a Param of its own, the RecursiveUnion and the WorkTableScans find each other with it
+*/
+func planRecursiveUnion(root *PlannerInfo, cte *CommonTableExpr) (types.PlanNode, error) {
+	wtParam := root.glob.nParamExec
+	root.glob.nParamExec++
+	root.glob.workTables[cte] = &workTable{wtParam: wtParam, root: root}
+
+	query := cte.query
+	lplan, err := planSetOpChild(root, query.larg, query.targetList)
+	if err != nil {
+		return nil, err
+	}
+	rplan, err := planSetOpChild(root, query.rarg, query.targetList)
+	if err != nil {
+		return nil, err
+	}
+	return &types.RecursiveUnion{
+		Plan:    types.Plan{Lefttree: lplan, Righttree: rplan},
+		WtParam: wtParam,
+		All:     query.all,
+	}, nil
+}
+
+/*
+planSetOpChild plans one side of a set operation and makes its output match the result columns,
+junk columns are dropped and columns of a different type are converted
+*/
+func planSetOpChild(root *PlannerInfo, child *Query, resultColumns []*types.TargetEntry) (types.PlanNode, error) {
+	//The branches are part of the same query level, they share our PlannerInfo
+	plan, err := planQueryTree(root, child)
+	if err != nil {
+		return nil, err
+	}
+
+	needsProjection := len(child.targetList) != len(resultColumns)
+	projection := make([]*types.TargetEntry, len(resultColumns))
+	for i, column := range resultColumns {
+		childType := types.ExprType(child.targetList[i].Expr)
+		var expr types.Node = &types.Var{AttNo: i, Name: column.ResName, VarType: childType}
+		if resultType := types.ExprType(column.Expr); childType != resultType {
+			expr = &types.CoerceExpr{Arg: expr, ResultType: resultType, ResultTypmod: -1}
+			needsProjection = true
+		}
+		projection[i] = &types.TargetEntry{Expr: expr, ResName: column.ResName}
+	}
+	if !needsProjection {
+		return plan, nil
+	}
+	return &types.Result{Plan: types.Plan{TargetList: projection, Lefttree: plan}}, nil
+}
+
+func sortOnAllColumns(plan types.PlanNode, columns []*types.TargetEntry) types.PlanNode {
+	sortKeys := make([]types.SortKey, len(columns))
+	for i, column := range columns {
+		sortKeys[i] = types.SortKey{Expr: &types.Var{AttNo: i, Name: column.ResName, VarType: types.ExprType(column.Expr)}}
+	}
+	return &types.Sort{Plan: types.Plan{Lefttree: plan}, SortKeys: sortKeys}
+}
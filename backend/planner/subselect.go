@@ -0,0 +1,574 @@
+package planner
+
+import (
+	"github.com/rautNishan/diskquery/guc"
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+Planning of subqueries (postgres optimizer/plan/subselect.c)
+
+A SubLink in WHERE of the forms
+	EXISTS (SELECT ... WHERE inner = outer ...)
+	NOT EXISTS (SELECT ... WHERE inner = outer ...)
+	x IN (SELECT ...)
+	x NOT IN (SELECT ...) (uncorrelated only)
+is pulled up into a semi or anti join, the correlation conditions become hash keys so the subquery
+runs once instead of once per outer row. Every other SubLink becomes a SubPlan that the executor runs
+whenever it needs the value, columns of outer queries are passed to it as Params.
+*/
+
+// PlannerGlobal is shared by every query level of one statement
+type PlannerGlobal struct {
+	session    *guc.Session //Settings of the session the statement is planned for
+	nParamExec int
+	subPlans   map[*types.SubLink]*types.SubPlan //A SubLink shared by two expressions is planned once
+	ctePlans   map[*CommonTableExpr]*ctePlan     //Materialized WITH queries, planned at their first reference
+	workTables map[*CommonTableExpr]*workTable
+}
+
+type ctePlan struct {
+	plan      types.PlanNode
+	extParams []int
+}
+
+// workTable links the references to a recursive query's work table with its RecursiveUnion
+type workTable struct {
+	wtParam int
+	root    *PlannerInfo //The query level of the RecursiveUnion
+}
+
+func newPlannerGlobal(session *guc.Session) *PlannerGlobal {
+	return &PlannerGlobal{
+		session:    session,
+		subPlans:   make(map[*types.SubLink]*types.SubPlan),
+		ctePlans:   make(map[*CommonTableExpr]*ctePlan),
+		workTables: make(map[*CommonTableExpr]*workTable),
+	}
+}
+
+// PlannerInfo is the planner's state for one query level
+type PlannerInfo struct {
+	glob   *PlannerGlobal
+	parent *PlannerInfo
+
+	//Our columns that subqueries being planned below us reference, they become the SubPlan's Args
+	planParams []planParam
+	//Params of outer query levels this level (or anything below it) reads
+	extParams []int
+}
+
+type planParam struct {
+	paramId int
+	item    *types.Var
+}
+
+func (root *PlannerInfo) makeSubroot() *PlannerInfo {
+	return &PlannerInfo{glob: root.glob, parent: root}
+}
+
+// preprocessQuery replaces outer columns by Params and SubLinks by SubPlans in every expression of a simple query
+func (root *PlannerInfo) preprocessQuery(query *Query) error {
+	var err error
+	for _, tle := range query.targetList {
+		if tle.Expr, err = root.preprocessExpression(tle.Expr); err != nil {
+			return err
+		}
+	}
+	if query.whereClause, err = root.preprocessExpression(query.whereClause); err != nil {
+		return err
+	}
+	for i := range query.groupClause {
+		if query.groupClause[i], err = root.preprocessExpression(query.groupClause[i]); err != nil {
+			return err
+		}
+	}
+	if query.having, err = root.preprocessExpression(query.having); err != nil {
+		return err
+	}
+	for _, wc := range query.windowClause {
+		for i := range wc.partitionClause {
+			if wc.partitionClause[i], err = root.preprocessExpression(wc.partitionClause[i]); err != nil {
+				return err
+			}
+		}
+		for i := range wc.orderClause {
+			if wc.orderClause[i].Expr, err = root.preprocessExpression(wc.orderClause[i].Expr); err != nil {
+				return err
+			}
+		}
+		if wc.startOffset, err = root.preprocessExpression(wc.startOffset); err != nil {
+			return err
+		}
+		if wc.endOffset, err = root.preprocessExpression(wc.endOffset); err != nil {
+			return err
+		}
+	}
+	//The Agg node computes aggregates from this list, the Aggrefs in the target list only read the result
+	for _, aggref := range query.aggs {
+		if _, err = root.preprocessExpression(aggref); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (root *PlannerInfo) preprocessExpression(expr types.Node) (types.Node, error) {
+	var err error
+	result := types.ExprMutator(expr, func(node types.Node) types.Node {
+		if err != nil {
+			return node
+		}
+		switch n := node.(type) {
+		case *types.Var:
+			if n.LevelsUp > 0 {
+				return root.replaceOuterVar(n)
+			}
+		case *types.SubLink:
+			var subplan *types.SubPlan
+			if subplan, err = root.makeSubPlan(n); err != nil {
+				return node
+			}
+			return subplan
+		}
+		return node
+	})
+	return result, err
+}
+
+/*
+replaceOuterVar turns a column of an outer query into a Param
+The Param is registered with the query level the column belongs to, the SubPlan that level builds
+sets it before running the subquery. Every level in between reads it from outside
+*/
+func (root *PlannerInfo) replaceOuterVar(v *types.Var) *types.Param {
+	levelRoot := root
+	for i := 0; i < v.LevelsUp; i++ {
+		levelRoot = levelRoot.parent
+	}
+
+	paramId := -1
+	for _, param := range levelRoot.planParams {
+		if param.item.AttNo == v.AttNo {
+			paramId = param.paramId
+			break
+		}
+	}
+	if paramId < 0 {
+		paramId = root.glob.nParamExec
+		root.glob.nParamExec++
+		item := &types.Var{AttNo: v.AttNo, Name: v.Name, VarType: v.VarType}
+		levelRoot.planParams = append(levelRoot.planParams, planParam{paramId: paramId, item: item})
+	}
+
+	for level := root; level != levelRoot; level = level.parent {
+		level.extParams = append(level.extParams, paramId)
+	}
+	return &types.Param{ParamId: paramId, ParamType: v.VarType}
+}
+
+// makeSubPlan plans the subquery of a SubLink one level below us
+func (root *PlannerInfo) makeSubPlan(sublink *types.SubLink) (*types.SubPlan, error) {
+	if subplan, ok := root.glob.subPlans[sublink]; ok {
+		return subplan, nil
+	}
+
+	savedParams := root.planParams
+	root.planParams = nil
+	subroot := root.makeSubroot()
+	plan, err := planQueryTree(subroot, sublink.Subselect.(*Query))
+	params := root.planParams
+	root.planParams = savedParams
+	if err != nil {
+		return nil, err
+	}
+
+	subplan := &types.SubPlan{
+		SubLinkType: sublink.SubLinkType,
+		Testexpr:    sublink.Testexpr,
+		OperName:    sublink.OperName,
+		Plan:        plan,
+		ResultType:  sublink.ResultType,
+	}
+	isParParam := make(map[int]bool)
+	for _, param := range params {
+		subplan.ParParams = append(subplan.ParParams, param.paramId)
+		subplan.Args = append(subplan.Args, param.item)
+		isParParam[param.paramId] = true
+	}
+	for _, paramId := range subroot.extParams {
+		if !isParParam[paramId] {
+			isParParam[paramId] = true
+			subplan.ExtParams = append(subplan.ExtParams, paramId)
+		}
+	}
+	root.glob.subPlans[sublink] = subplan
+	return subplan, nil
+}
+
+/*
+makeCteScan reads a materialized WITH query
+The WITH query is planned one level below the query level the WITH belongs to, the first time it is
+referenced. The Params of outer queries it reads are read by every level between us and the WITH too
+*/
+func (root *PlannerInfo) makeCteScan(rte *RangeTblEntry, qual types.Node) (types.PlanNode, error) {
+	cteRoot := root
+	for i := 0; i < rte.cteLevelsUp; i++ {
+		cteRoot = cteRoot.parent
+	}
+
+	cte := rte.cte
+	info, ok := root.glob.ctePlans[cte]
+	if !ok {
+		subroot := cteRoot.makeSubroot()
+		var plan types.PlanNode
+		var err error
+		if cte.recursive {
+			plan, err = planRecursiveUnion(subroot, cte)
+		} else {
+			plan, err = planQueryTree(subroot, cte.query)
+		}
+		if err != nil {
+			return nil, err
+		}
+		info = &ctePlan{plan: plan}
+		seen := make(map[int]bool)
+		for _, paramId := range subroot.extParams {
+			if !seen[paramId] {
+				seen[paramId] = true
+				info.extParams = append(info.extParams, paramId)
+			}
+		}
+		root.glob.ctePlans[cte] = info
+	}
+
+	for level := root; level != cteRoot; level = level.parent {
+		level.extParams = append(level.extParams, info.extParams...)
+	}
+	return &types.CteScan{
+		Plan:      types.Plan{Qual: qual},
+		CteName:   cte.name,
+		CtePlan:   info.plan,
+		ExtParams: info.extParams,
+	}, nil
+}
+
+/*
+makeWorkTableScan reads the work table of the recursive query we are part of
+The work table changes every round, its Param is read by every level between us and the RecursiveUnion
+so SubPlans that read it are not cached across rounds
+*/
+func (root *PlannerInfo) makeWorkTableScan(rte *RangeTblEntry, qual types.Node) types.PlanNode {
+	wt := root.glob.workTables[rte.cte]
+	for level := root; level != wt.root; level = level.parent {
+		level.extParams = append(level.extParams, wt.wtParam)
+	}
+	return &types.WorkTableScan{Plan: types.Plan{Qual: qual}, WtParam: wt.wtParam}
+}
+
+// semiJoin is a WHERE clause SubLink pulled up into a join with the query's FROM item
+type semiJoin struct {
+	joinType  types.JoinType
+	nullAware bool
+	outerKeys []types.Node //Our expressions, matched with the subquery's output columns in order
+	subquery  *Query
+}
+
+// pullUpSublinks takes the SubLinks that can become joins out of the WHERE clause
+func pullUpSublinks(query *Query) []*semiJoin {
+	var joins []*semiJoin
+	var quals []types.Node
+	for _, qual := range conjuncts(query.whereClause) {
+		if join := convertSubLink(qual); join != nil {
+			joins = append(joins, join)
+			continue
+		}
+		quals = append(quals, qual)
+	}
+	if len(joins) > 0 {
+		query.whereClause = makeAnd(quals)
+	}
+	return joins
+}
+
+func convertSubLink(qual types.Node) *semiJoin {
+	joinType := types.JOIN_SEMI
+	if not, ok := qual.(*types.BoolExpr); ok && not.Boolop == types.NOT_EXPR {
+		qual = not.Args[0]
+		joinType = types.JOIN_ANTI
+	}
+	sublink, ok := qual.(*types.SubLink)
+	if !ok {
+		return nil
+	}
+	subquery := sublink.Subselect.(*Query)
+
+	switch sublink.SubLinkType {
+	case types.EXISTS_SUBLINK:
+		//An uncorrelated EXISTS is cheaper as a SubPlan, it runs only once
+		if !isSimpleSubquery(subquery) || !referencesLevel(subquery, 1) {
+			return nil
+		}
+		outerKeys, innerKeys, rest := splitCorrelation(subquery)
+		if len(outerKeys) == 0 {
+			return nil
+		}
+		pulled := *subquery
+		pulled.whereClause = rest
+		pulled.targetList = keyTargetList(innerKeys)
+		pulled.sortClause = nil
+		pulled.distinct = false
+		if referencesLevel(&pulled, 1) {
+			return nil
+		}
+		return &semiJoin{joinType: joinType, outerKeys: decrementLevelsUp(outerKeys), subquery: &pulled}
+
+	case types.ANY_SUBLINK:
+		if sublink.OperName != "=" {
+			return nil
+		}
+		if !referencesLevel(subquery, 1) {
+			//NOT IN gives NULL instead of true when the subquery returns a NULL, the join has to know
+			return &semiJoin{
+				joinType:  joinType,
+				nullAware: joinType == types.JOIN_ANTI,
+				outerKeys: []types.Node{sublink.Testexpr},
+				subquery:  subquery,
+			}
+		}
+		//For a correlated NOT IN the NULL rules apply per outer row, leave that to a SubPlan
+		if joinType == types.JOIN_ANTI || !isSimpleSubquery(subquery) {
+			return nil
+		}
+		outerKeys, innerKeys, rest := splitCorrelation(subquery)
+		if len(outerKeys) == 0 {
+			return nil
+		}
+		pulled := *subquery
+		pulled.whereClause = rest
+		pulled.targetList = keyTargetList(append([]types.Node{nonJunkColumns(subquery.targetList)[0].Expr}, innerKeys...))
+		pulled.sortClause = nil
+		pulled.distinct = false
+		if referencesLevel(&pulled, 1) {
+			return nil
+		}
+		outerKeys = append([]types.Node{sublink.Testexpr}, decrementLevelsUp(outerKeys)...)
+		return &semiJoin{joinType: joinType, outerKeys: outerKeys, subquery: &pulled}
+	}
+	return nil
+}
+
+// A subquery whose rows come straight from its FROM item, so filtering it by the join keys is the same
+// as running it once per outer row
+func isSimpleSubquery(query *Query) bool {
+	return query.setOp == types.SETOP_NONE && !query.hasAggs() && len(query.groupClause) == 0 &&
+		query.having == nil && query.limitCount == nil && query.limitOffset == nil && !query.hasWindowFuncs
+}
+
+/*
+splitCorrelation finds the conjuncts of the subquery's WHERE of the form inner = outer, where one side
+only uses the subquery's columns and the other only columns of the query right outside it.
+Returns both sides of those and the remaining conjuncts
+*/
+func splitCorrelation(subquery *Query) ([]types.Node, []types.Node, types.Node) {
+	var outerKeys, innerKeys, rest []types.Node
+	for _, qual := range conjuncts(subquery.whereClause) {
+		op, ok := qual.(*types.OpExpr)
+		if ok && op.Op == "=" && len(op.Args) == 2 {
+			left, right := op.Args[0], op.Args[1]
+			if isInnerExpr(left) && isOuterExpr(right) {
+				innerKeys, outerKeys = append(innerKeys, left), append(outerKeys, right)
+				continue
+			}
+			if isOuterExpr(left) && isInnerExpr(right) {
+				innerKeys, outerKeys = append(innerKeys, right), append(outerKeys, left)
+				continue
+			}
+		}
+		rest = append(rest, qual)
+	}
+	return outerKeys, innerKeys, makeAnd(rest)
+}
+
+func isInnerExpr(expr types.Node) bool {
+	return usesOnlyLevel(expr, 0, 1)
+}
+
+func isOuterExpr(expr types.Node) bool {
+	return usesOnlyLevel(expr, 1, 0)
+}
+
+// usesOnlyLevel tells if the expression uses columns of query level levelsUp but none of level
+// otherLevel, without aggregates or subqueries (columns further out are constants to both sides)
+func usesOnlyLevel(expr types.Node, levelsUp int, otherLevel int) bool {
+	found, ok := false, true
+	types.ExprWalker(expr, func(node types.Node) bool {
+		switch n := node.(type) {
+		case *types.Var:
+			if n.LevelsUp == levelsUp {
+				found = true
+			} else if n.LevelsUp == otherLevel {
+				ok = false
+			}
+		case *types.Aggref, *types.SubLink:
+			ok = false
+		}
+		return ok
+	})
+	return found && ok
+}
+
+// decrementLevelsUp moves expressions of a subquery's WHERE one level out
+func decrementLevelsUp(exprs []types.Node) []types.Node {
+	for i := range exprs {
+		exprs[i] = types.ExprMutator(exprs[i], func(node types.Node) types.Node {
+			if v, ok := node.(*types.Var); ok {
+				return &types.Var{AttNo: v.AttNo, Name: v.Name, VarType: v.VarType, LevelsUp: v.LevelsUp - 1}
+			}
+			return node
+		})
+	}
+	return exprs
+}
+
+func keyTargetList(keys []types.Node) []*types.TargetEntry {
+	targetList := make([]*types.TargetEntry, len(keys))
+	for i, key := range keys {
+		targetList[i] = &types.TargetEntry{Expr: key, ResName: "?column?"}
+	}
+	return targetList
+}
+
+/*
+makeHashJoin joins plan with a pulled up subquery
+The subquery returns exactly the inner keys, they are hashed and probed with the outer keys.
+Keys of different numeric types are both converted to their common type, 1 and 1.0 have to hash the same
+*/
+func (root *PlannerInfo) makeHashJoin(plan types.PlanNode, join *semiJoin) (types.PlanNode, error) {
+	innerPlan, err := planQueryTree(root.makeSubroot(), join.subquery)
+	if err != nil {
+		return nil, err
+	}
+	hashJoin := &types.HashJoin{
+		Plan:      types.Plan{Lefttree: plan, Righttree: innerPlan},
+		JoinType:  join.joinType,
+		NullAware: join.nullAware,
+	}
+	innerColumns := nonJunkColumns(join.subquery.targetList)
+	for i, outerKey := range join.outerKeys {
+		if outerKey, err = root.preprocessExpression(outerKey); err != nil {
+			return nil, err
+		}
+		innerType := types.ExprType(innerColumns[i].Expr)
+		var innerKey types.Node = &types.Var{AttNo: i, Name: innerColumns[i].ResName, VarType: innerType}
+		if outerType := types.ExprType(outerKey); outerType != innerType {
+			keyType := numericCommonType(outerType, innerType)
+			if outerType != keyType {
+				outerKey = &types.CoerceExpr{Arg: outerKey, ResultType: keyType, ResultTypmod: -1}
+			}
+			if innerType != keyType {
+				innerKey = &types.CoerceExpr{Arg: innerKey, ResultType: keyType, ResultTypmod: -1}
+			}
+		}
+		hashJoin.OuterHashKeys = append(hashJoin.OuterHashKeys, outerKey)
+		hashJoin.InnerHashKeys = append(hashJoin.InnerHashKeys, innerKey)
+	}
+	return hashJoin, nil
+}
+
+/*
+walkQuery calls fn for every expression node and FROM item of query and of all subqueries inside it
+levelsUp is how many query levels below the query the walk started at the node is, so a Var with
+LevelsUp == levelsUp + n references the query n levels above the starting one
+*/
+func walkQuery(query *Query, levelsUp int, fn func(node types.Node, levelsUp int) bool) {
+	walkExpr := func(expr types.Node) {
+		types.ExprWalker(expr, func(node types.Node) bool {
+			if !fn(node, levelsUp) {
+				return false
+			}
+			if sublink, ok := node.(*types.SubLink); ok {
+				walkQuery(sublink.Subselect.(*Query), levelsUp+1, fn)
+			}
+			return true
+		})
+	}
+
+	if query.setOp != types.SETOP_NONE {
+		walkQuery(query.larg, levelsUp, fn)
+		walkQuery(query.rarg, levelsUp, fn)
+	}
+	var walkRte func(rte *RangeTblEntry)
+	walkRte = func(rte *RangeTblEntry) {
+		fn(rte, levelsUp)
+		if rte.subquery != nil {
+			walkQuery(rte.subquery, levelsUp+1, fn)
+		}
+		walkExpr(rte.function)
+		if rte.larg != nil {
+			walkRte(rte.larg)
+			walkRte(rte.rarg)
+			walkExpr(rte.joinQuals)
+		}
+	}
+	if query.rte != nil {
+		walkRte(query.rte)
+	}
+	for _, tle := range query.targetList {
+		walkExpr(tle.Expr)
+	}
+	walkExpr(query.whereClause)
+	for _, groupExpr := range query.groupClause {
+		walkExpr(groupExpr)
+	}
+	walkExpr(query.having)
+	for _, wc := range query.windowClause {
+		for _, expr := range wc.partitionClause {
+			walkExpr(expr)
+		}
+		for _, sortKey := range wc.orderClause {
+			walkExpr(sortKey.Expr)
+		}
+		walkExpr(wc.startOffset)
+		walkExpr(wc.endOffset)
+	}
+	walkExpr(query.limitCount)
+	walkExpr(query.limitOffset)
+}
+
+// referencesLevel tells if anything in the query uses a column of the query levelsUp levels above it
+func referencesLevel(query *Query, levelsUp int) bool {
+	found := false
+	walkQuery(query, 0, func(node types.Node, depth int) bool {
+		if v, ok := node.(*types.Var); ok && v.LevelsUp == levelsUp+depth {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// conjuncts splits a qualification into its AND-ed parts
+func conjuncts(qual types.Node) []types.Node {
+	if qual == nil {
+		return nil
+	}
+	if and, ok := qual.(*types.BoolExpr); ok && and.Boolop == types.AND_EXPR {
+		var result []types.Node
+		for _, arg := range and.Args {
+			result = append(result, conjuncts(arg)...)
+		}
+		return result
+	}
+	return []types.Node{qual}
+}
+
+func makeAnd(quals []types.Node) types.Node {
+	switch len(quals) {
+	case 0:
+		return nil
+	case 1:
+		return quals[0]
+	}
+	return &types.BoolExpr{Boolop: types.AND_EXPR, Args: quals}
+}
@@ -0,0 +1,253 @@
+package planner
+
+import (
+	"reflect"
+	"sort"
+
+	"github.com/rautNishan/diskquery/types"
+)
+
+/*
+Planning of window functions (postgres optimizer/plan/planner.c, make_window_input_target and friends)
+
+The scan (or the Agg, in a grouped query) computes the window input target list: every output column
+that has no window function, the arguments of the window functions, the PARTITION BY and ORDER BY
+expressions and whatever columns and aggregates the rest of the output columns need.
+On top of that comes one WindowAgg node per window, each appends the results of its functions to
+the tuple it passes up. The last one computes the query's target list, with every expression the
+input list has and every window function replaced by a Var of the column holding it.
+
+A WindowAgg needs its input sorted by PARTITION BY and then ORDER BY. Windows whose sort order is a
+prefix of another window's come right after that one, so they read its sorted output and the input is
+only sorted once per distinct partitioning
+*/
+
+type windowPlan struct {
+	wc       *WindowClause
+	winRef   int
+	funcs    []*types.WindowFunc
+	sortKeys []types.SortKey //PARTITION BY then ORDER BY, Vars of the input list
+}
+
+// makeWindowInputTargetList builds the target list of the node below the first WindowAgg
+func makeWindowInputTargetList(query *Query) []*types.TargetEntry {
+	var inputList []*types.TargetEntry
+	add := func(expr types.Node, name string) {
+		if inputIndex(inputList, expr) < 0 {
+			inputList = append(inputList, &types.TargetEntry{Expr: expr, ResName: name, ResJunk: true})
+		}
+	}
+
+	for _, tle := range query.targetList {
+		if !containsWindowFunc(tle.Expr) {
+			add(tle.Expr, tle.ResName)
+			continue
+		}
+		types.ExprWalker(tle.Expr, func(node types.Node) bool {
+			switch n := node.(type) {
+			case *types.WindowFunc:
+				for _, arg := range n.Args {
+					add(arg, "?column?")
+				}
+				if n.AggFilter != nil {
+					add(n.AggFilter, "?column?")
+				}
+				return false
+			case *types.Var:
+				add(n, n.Name)
+				return false
+			case *types.Aggref:
+				add(n, n.AggName)
+				return false
+			}
+			return true
+		})
+	}
+
+	for _, winRef := range usedWindows(query) {
+		wc := query.windowClause[winRef]
+		for _, expr := range wc.partitionClause {
+			add(expr, "?column?")
+		}
+		for _, sortKey := range wc.orderClause {
+			add(sortKey.Expr, "?column?")
+		}
+	}
+	return inputList
+}
+
+// usedWindows are the windows the query's window functions use, in order of first use
+func usedWindows(query *Query) []int {
+	var winRefs []int
+	seen := make(map[int]bool)
+	for _, tle := range query.targetList {
+		types.ExprWalker(tle.Expr, func(node types.Node) bool {
+			if wfunc, ok := node.(*types.WindowFunc); ok {
+				if !seen[wfunc.WinRef] {
+					seen[wfunc.WinRef] = true
+					winRefs = append(winRefs, wfunc.WinRef)
+				}
+				return false
+			}
+			return true
+		})
+	}
+	return winRefs
+}
+
+func inputIndex(inputList []*types.TargetEntry, expr types.Node) int {
+	for i, tle := range inputList {
+		if reflect.DeepEqual(tle.Expr, expr) {
+			return i
+		}
+	}
+	return -1
+}
+
+// inputVar is the Var reading expr from the input list, expr has to be in it
+func inputVar(inputList []*types.TargetEntry, expr types.Node) *types.Var {
+	attno := inputIndex(inputList, expr)
+	return &types.Var{AttNo: attno, Name: inputList[attno].ResName, VarType: types.ExprType(expr)}
+}
+
+/*
+replaceInputExprs rewrites an expression evaluated above the input list node: the parts the input list
+computes become Vars of it and window functions become Vars of the columns the WindowAggs appended
+*/
+func replaceInputExprs(expr types.Node, inputList []*types.TargetEntry, funcColumns map[*types.WindowFunc]int) types.Node {
+	return types.ExprMutator(expr, func(node types.Node) types.Node {
+		if wfunc, ok := node.(*types.WindowFunc); ok {
+			if attno, ok := funcColumns[wfunc]; ok {
+				return &types.Var{AttNo: attno, Name: wfunc.WinName, VarType: wfunc.WinType}
+			}
+		}
+		if attno := inputIndex(inputList, node); attno >= 0 {
+			return &types.Var{AttNo: attno, Name: inputList[attno].ResName, VarType: types.ExprType(node)}
+		}
+		return node
+	})
+}
+
+// makeWindowAggs puts the WindowAgg nodes, and the sorts they need, on top of plan that computes inputList
+func makeWindowAggs(plan types.PlanNode, query *Query, inputList []*types.TargetEntry) types.PlanNode {
+	var windows []*windowPlan
+	byRef := make(map[int]*windowPlan)
+	for _, winRef := range usedWindows(query) {
+		wc := query.windowClause[winRef]
+		window := &windowPlan{wc: wc, winRef: winRef}
+		for _, expr := range wc.partitionClause {
+			window.sortKeys = append(window.sortKeys, types.SortKey{Expr: inputVar(inputList, expr)})
+		}
+		for _, sortKey := range wc.orderClause {
+			window.sortKeys = append(window.sortKeys, types.SortKey{
+				Expr:       inputVar(inputList, sortKey.Expr),
+				Desc:       sortKey.Desc,
+				NullsFirst: sortKey.NullsFirst,
+			})
+		}
+		windows = append(windows, window)
+		byRef[winRef] = window
+	}
+	for _, tle := range query.targetList {
+		types.ExprWalker(tle.Expr, func(node types.Node) bool {
+			if wfunc, ok := node.(*types.WindowFunc); ok {
+				byRef[wfunc.WinRef].funcs = append(byRef[wfunc.WinRef].funcs, wfunc)
+				return false
+			}
+			return true
+		})
+	}
+	sort.SliceStable(windows, func(i, j int) bool {
+		return compareWindowSortKeys(windows[i].sortKeys, windows[j].sortKeys) < 0
+	})
+
+	funcColumns := make(map[*types.WindowFunc]int)
+	nextColumn := len(inputList)
+	var sortedBy []types.SortKey
+	for _, window := range windows {
+		if !isSortKeyPrefix(window.sortKeys, sortedBy) {
+			plan = &types.Sort{Plan: types.Plan{Lefttree: plan}, SortKeys: window.sortKeys}
+			sortedBy = window.sortKeys
+		}
+
+		nPartition := len(window.wc.partitionClause)
+		winAgg := &types.WindowAgg{
+			Plan:         types.Plan{Lefttree: plan},
+			WinRef:       window.winRef,
+			OrderKeys:    window.sortKeys[nPartition:],
+			FrameOptions: window.wc.frameOptions,
+			StartOffset:  window.wc.startOffset,
+			EndOffset:    window.wc.endOffset,
+		}
+		for _, sortKey := range window.sortKeys[:nPartition] {
+			winAgg.PartitionKeys = append(winAgg.PartitionKeys, sortKey.Expr)
+		}
+		//The functions are copied, the originals stay in the target list until it is rewritten below
+		for _, wfunc := range window.funcs {
+			if _, done := funcColumns[wfunc]; done {
+				continue
+			}
+			computed := *wfunc
+			computed.Args = make([]types.Node, len(wfunc.Args))
+			for i, arg := range wfunc.Args {
+				computed.Args[i] = inputVar(inputList, arg)
+			}
+			if wfunc.AggFilter != nil {
+				computed.AggFilter = inputVar(inputList, wfunc.AggFilter)
+			}
+			winAgg.WindowFuncs = append(winAgg.WindowFuncs, &computed)
+			funcColumns[wfunc] = nextColumn
+			nextColumn++
+		}
+		plan = winAgg
+	}
+
+	targetList := make([]*types.TargetEntry, len(query.targetList))
+	for i, tle := range query.targetList {
+		targetList[i] = &types.TargetEntry{
+			Expr:    replaceInputExprs(tle.Expr, inputList, funcColumns),
+			ResName: tle.ResName,
+			ResJunk: tle.ResJunk,
+		}
+	}
+	plan.GetPlan().TargetList = targetList
+	return plan
+}
+
+/*
+compareWindowSortKeys orders windows so that one whose sort keys are a prefix of another's comes
+right after it: keys are compared one by one and a longer list goes first when one is a prefix of the other
+*/
+func compareWindowSortKeys(a []types.SortKey, b []types.SortKey) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		aVar, bVar := a[i].Expr.(*types.Var), b[i].Expr.(*types.Var)
+		switch {
+		case aVar.AttNo != bVar.AttNo:
+			return aVar.AttNo - bVar.AttNo
+		case a[i].Desc != b[i].Desc:
+			if a[i].Desc {
+				return 1
+			}
+			return -1
+		case a[i].NullsFirst != b[i].NullsFirst:
+			if a[i].NullsFirst {
+				return 1
+			}
+			return -1
+		}
+	}
+	return len(b) - len(a)
+}
+
+// isSortKeyPrefix tells if input sorted by sortedBy is also sorted by keys
+func isSortKeyPrefix(keys []types.SortKey, sortedBy []types.SortKey) bool {
+	if len(keys) > len(sortedBy) {
+		return false
+	}
+	for i := range keys {
+		if !reflect.DeepEqual(keys[i], sortedBy[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,238 @@
+package types
+
+// ExprType returns the result type of a primitive expression node
+func ExprType(expr Node) Oid {
+	switch e := expr.(type) {
+	case *Const:
+		return e.ConstType
+	case *Var:
+		return e.VarType
+	case *OpExpr:
+		return e.ResultType
+	case *FuncExpr:
+		return e.FuncResultType
+	case *BoolExpr:
+		return BOOLOID
+	case *ArrayExpr:
+		return e.ArrayType
+	case *RowExpr:
+		return TEXTOID
+	case *SubscriptingRef:
+		return e.RefType
+	case *ScalarArrayOpExpr, *DistinctExpr, *NullTest, *BooleanTest:
+		return BOOLOID
+	case *NullIfExpr:
+		return e.ResultType
+	case *CoalesceExpr:
+		return e.CoalesceType
+	case *MinMaxExpr:
+		return e.MinMaxType
+	case *CaseExpr:
+		return e.CaseType
+	case *CaseTestExpr:
+		return e.TypeId
+	case *Aggref:
+		return e.AggType
+	case *WindowFunc:
+		return e.WinType
+	case *CoerceExpr:
+		return e.ResultType
+	case *Param:
+		return e.ParamType
+	case *SubLink:
+		if e.SubLinkType == EXPR_SUBLINK {
+			return e.ResultType
+		}
+		return BOOLOID
+	case *SubPlan:
+		if e.SubLinkType == EXPR_SUBLINK {
+			return e.ResultType
+		}
+		return BOOLOID
+	case *TargetEntry:
+		return ExprType(e.Expr)
+	}
+	return InvalidOid
+}
+
+// ExprWalker calls fn for expr and everything below it, returning false from fn stops the descent
+// into that node's children. Subqueries are not entered, they are a query level of their own
+func ExprWalker(expr Node, fn func(Node) bool) {
+	if expr == nil || !fn(expr) {
+		return
+	}
+	switch e := expr.(type) {
+	case *OpExpr:
+		for _, arg := range e.Args {
+			ExprWalker(arg, fn)
+		}
+	case *FuncExpr:
+		for _, arg := range e.Args {
+			ExprWalker(arg, fn)
+		}
+	case *BoolExpr:
+		for _, arg := range e.Args {
+			ExprWalker(arg, fn)
+		}
+	case *ArrayExpr:
+		for _, elem := range e.Elements {
+			ExprWalker(elem, fn)
+		}
+	case *RowExpr:
+		for _, arg := range e.Args {
+			ExprWalker(arg, fn)
+		}
+	case *SubscriptingRef:
+		ExprWalker(e.Expr, fn)
+		for _, index := range e.Upperindex {
+			ExprWalker(index, fn)
+		}
+		for _, index := range e.Lowerindex {
+			ExprWalker(index, fn)
+		}
+	case *ScalarArrayOpExpr:
+		for _, arg := range e.Args {
+			ExprWalker(arg, fn)
+		}
+	case *DistinctExpr:
+		for _, arg := range e.Args {
+			ExprWalker(arg, fn)
+		}
+	case *NullIfExpr:
+		for _, arg := range e.Args {
+			ExprWalker(arg, fn)
+		}
+	case *CoalesceExpr:
+		for _, arg := range e.Args {
+			ExprWalker(arg, fn)
+		}
+	case *MinMaxExpr:
+		for _, arg := range e.Args {
+			ExprWalker(arg, fn)
+		}
+	case *CaseExpr:
+		ExprWalker(e.Arg, fn)
+		for _, when := range e.Args {
+			ExprWalker(when.Expr, fn)
+			ExprWalker(when.Result, fn)
+		}
+		ExprWalker(e.Defresult, fn)
+	case *NullTest:
+		ExprWalker(e.Arg, fn)
+	case *BooleanTest:
+		ExprWalker(e.Arg, fn)
+	case *Aggref:
+		for _, arg := range e.Args {
+			ExprWalker(arg, fn)
+		}
+		ExprWalker(e.AggFilter, fn)
+	case *WindowFunc:
+		for _, arg := range e.Args {
+			ExprWalker(arg, fn)
+		}
+		ExprWalker(e.AggFilter, fn)
+	case *CoerceExpr:
+		ExprWalker(e.Arg, fn)
+	case *SubLink:
+		ExprWalker(e.Testexpr, fn)
+	case *SubPlan:
+		ExprWalker(e.Testexpr, fn)
+		for _, arg := range e.Args {
+			ExprWalker(arg, fn)
+		}
+	case *TargetEntry:
+		ExprWalker(e.Expr, fn)
+	}
+}
+
+// ExprMutator replaces the nodes of an expression tree in place, fn gets every node top down and
+// returns the node to put in its place, the children of whatever fn returned are visited next
+func ExprMutator(expr Node, fn func(Node) Node) Node {
+	if expr == nil {
+		return nil
+	}
+	expr = fn(expr)
+	switch e := expr.(type) {
+	case *OpExpr:
+		for i := range e.Args {
+			e.Args[i] = ExprMutator(e.Args[i], fn)
+		}
+	case *FuncExpr:
+		for i := range e.Args {
+			e.Args[i] = ExprMutator(e.Args[i], fn)
+		}
+	case *BoolExpr:
+		for i := range e.Args {
+			e.Args[i] = ExprMutator(e.Args[i], fn)
+		}
+	case *ArrayExpr:
+		for i := range e.Elements {
+			e.Elements[i] = ExprMutator(e.Elements[i], fn)
+		}
+	case *RowExpr:
+		for i := range e.Args {
+			e.Args[i] = ExprMutator(e.Args[i], fn)
+		}
+	case *SubscriptingRef:
+		e.Expr = ExprMutator(e.Expr, fn)
+		for i := range e.Upperindex {
+			e.Upperindex[i] = ExprMutator(e.Upperindex[i], fn)
+		}
+		for i := range e.Lowerindex {
+			e.Lowerindex[i] = ExprMutator(e.Lowerindex[i], fn)
+		}
+	case *ScalarArrayOpExpr:
+		for i := range e.Args {
+			e.Args[i] = ExprMutator(e.Args[i], fn)
+		}
+	case *DistinctExpr:
+		for i := range e.Args {
+			e.Args[i] = ExprMutator(e.Args[i], fn)
+		}
+	case *NullIfExpr:
+		for i := range e.Args {
+			e.Args[i] = ExprMutator(e.Args[i], fn)
+		}
+	case *CoalesceExpr:
+		for i := range e.Args {
+			e.Args[i] = ExprMutator(e.Args[i], fn)
+		}
+	case *MinMaxExpr:
+		for i := range e.Args {
+			e.Args[i] = ExprMutator(e.Args[i], fn)
+		}
+	case *CaseExpr:
+		e.Arg = ExprMutator(e.Arg, fn)
+		for _, when := range e.Args {
+			when.Expr = ExprMutator(when.Expr, fn)
+			when.Result = ExprMutator(when.Result, fn)
+		}
+		e.Defresult = ExprMutator(e.Defresult, fn)
+	case *NullTest:
+		e.Arg = ExprMutator(e.Arg, fn)
+	case *BooleanTest:
+		e.Arg = ExprMutator(e.Arg, fn)
+	case *Aggref:
+		for i := range e.Args {
+			e.Args[i] = ExprMutator(e.Args[i], fn)
+		}
+		e.AggFilter = ExprMutator(e.AggFilter, fn)
+	case *WindowFunc:
+		for i := range e.Args {
+			e.Args[i] = ExprMutator(e.Args[i], fn)
+		}
+		e.AggFilter = ExprMutator(e.AggFilter, fn)
+	case *CoerceExpr:
+		e.Arg = ExprMutator(e.Arg, fn)
+	case *SubLink:
+		e.Testexpr = ExprMutator(e.Testexpr, fn)
+	case *SubPlan:
+		e.Testexpr = ExprMutator(e.Testexpr, fn)
+		for i := range e.Args {
+			e.Args[i] = ExprMutator(e.Args[i], fn)
+		}
+	case *TargetEntry:
+		e.Expr = ExprMutator(e.Expr, fn)
+	}
+	return expr
+}
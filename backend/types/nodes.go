@@ -3,3 +3,102 @@ package types
 type NodeTag int
 
 const TInvalid NodeTag = 0
+
+const (
+	// Statement nodes
+	TSelectStmt NodeTag = iota + 1
+	TVariableSetStmt
+	TVariableShowStmt
+	TCreateStmt
+	TColumnDef
+	TDropStmt
+	TIndexStmt
+	TIndexElem
+	TVacuumStmt
+	TAlterTableStmt
+	TAlterTableCmd
+	TAlterSystemStmt
+	TInsertStmt
+	TUpdateStmt
+	TDeleteStmt
+
+	// Parse tree expression nodes
+	TResTarget
+	TColumnRef
+	TAConst
+	TAExpr
+	TBoolExpr
+	TNullTest
+	TBooleanTest
+	TCoalesceExpr
+	TMinMaxExpr
+	TCaseExpr
+	TCaseWhen
+	TFuncCall
+	TAStar
+	TRangeVar
+	TRangeSubselect
+	TSortBy
+	TSubLink
+	TWithClause
+	TCommonTableExpr
+	TWindowDef
+	TTypeName
+	TTypeCast
+	TAArrayExpr
+	TAIndices
+	TAIndirection
+	TRangeFunction
+	TJoinExpr
+	TSetToDefault
+
+	// Primitive (resolved) expression nodes
+	TConst
+	TVar
+	TOpExpr
+	TAggref
+	TCoerceExpr
+	TTargetEntry
+	TParam
+	TSubPlan
+	TWindowFunc
+	TFuncExpr
+	TArrayExpr
+	TSubscriptingRef
+	TScalarArrayOpExpr
+	TDistinctExpr
+	TNullIfExpr
+	TCaseTestExpr
+
+	TRowExpr
+
+	// Analyzed statement (the planner's Query)
+	TQuery
+	TRangeTblEntry
+
+	// Plan nodes
+	TResult
+	TSeqScan
+	TAgg
+	TSort
+	TLimit
+	TAppend
+	TSetOp
+	THashJoin
+	TCteScan
+	TWorkTableScan
+	TRecursiveUnion
+	TWindowAgg
+	TFunctionScan
+	TProjectSet
+	TIndexScan
+	TIndexOnlyScan
+	TColumnarScan
+	TNestLoop
+	TModifyTable
+)
+
+// Node is implemented by every parse tree node, the same way every postgres node starts with a NodeTag
+type Node interface {
+	NodeTag() NodeTag
+}
@@ -0,0 +1,575 @@
+package types
+
+/*
+Raw parse tree nodes, these are what the grammar produces
+They only describe what the user wrote, names are not resolved yet (That is the planner's job)
+*/
+
+// Datum is a single SQL value, nil is SQL NULL
+type Datum = interface{}
+
+type SetOperation int
+
+const (
+	SETOP_NONE SetOperation = iota
+	SETOP_UNION
+	SETOP_INTERSECT
+	SETOP_EXCEPT
+)
+
+func (op SetOperation) String() string {
+	return [...]string{"", "UNION", "INTERSECT", "EXCEPT"}[op]
+}
+
+/*
+SelectStmt is either a simple SELECT or, when Op is not SETOP_NONE, a set operation
+on Larg and Rarg (only SortClause and the limits are used on a set operation node)
+*/
+type SelectStmt struct {
+	WithClause   *WithClause
+	Distinct     bool
+	TargetList   []*ResTarget
+	FromClause   []Node
+	WhereClause  Node
+	GroupClause  []Node
+	HavingClause Node
+	WindowClause []*WindowDef //WINDOW name AS (...), ...
+	SortClause   []*SortBy
+	LimitCount   Node //nil means no LIMIT (LIMIT ALL)
+	LimitOffset  Node
+
+	Op   SetOperation
+	All  bool
+	Larg *SelectStmt
+	Rarg *SelectStmt
+}
+
+// WithClause is WITH [RECURSIVE] name AS (...), ... in front of a SELECT
+type WithClause struct {
+	Ctes      []*CommonTableExpr
+	Recursive bool
+	Location  int
+}
+
+type CTEMaterialize int
+
+const (
+	CTEMaterializeDefault CTEMaterialize = iota //Let the planner decide
+	CTEMaterializeAlways                        //AS MATERIALIZED
+	CTEMaterializeNever                         //AS NOT MATERIALIZED
+)
+
+// CommonTableExpr is one WITH item, name (col, ...) AS [[NOT] MATERIALIZED] (query) [CYCLE ...]
+type CommonTableExpr struct {
+	Ctename         string
+	Aliascolnames   []string
+	CteMaterialized CTEMaterialize
+	Ctequery        *SelectStmt
+	CycleClause     *CTECycleClause
+	Location        int
+}
+
+/*
+CTECycleClause is CYCLE col, ... SET mark_col [TO value DEFAULT default] USING path_col of a recursive WITH
+item, CycleMarkValue and CycleMarkDefault are nil without TO ... DEFAULT
+*/
+type CTECycleClause struct {
+	CycleColList     []string
+	CycleMarkColumn  string
+	CycleMarkValue   Node
+	CycleMarkDefault Node
+	CyclePathColumn  string
+	Location         int
+}
+
+// ResTarget is one entry of the target list (SELECT a + 1 AS b)
+type ResTarget struct {
+	Name     string //Alias, empty if none was given
+	Val      Node
+	Location int
+}
+
+// ColumnRef is a (possibly qualified) column name, t.a is Fields ["t", "a"]
+type ColumnRef struct {
+	Fields   []string
+	Location int
+}
+
+// AConst is a literal constant
+type AConst struct {
+	Val      Datum
+	Location int
+}
+
+type AExprKind int
+
+const (
+	AEXPR_OP           AExprKind = iota //Normal operator
+	AEXPR_OP_ANY                        //scalar op ANY (array)
+	AEXPR_OP_ALL                        //scalar op ALL (array)
+	AEXPR_DISTINCT                      //IS DISTINCT FROM, Name is "="
+	AEXPR_NOT_DISTINCT                  //IS NOT DISTINCT FROM
+	AEXPR_NULLIF                        //NULLIF(a, b), Name is "="
+)
+
+// AExpr is an operator expression, for unary operators Lexpr is nil
+type AExpr struct {
+	Kind     AExprKind
+	Name     string
+	Lexpr    Node
+	Rexpr    Node
+	Location int
+}
+
+type BoolExprType int
+
+const (
+	AND_EXPR BoolExprType = iota
+	OR_EXPR
+	NOT_EXPR
+)
+
+type BoolExpr struct {
+	Boolop   BoolExprType
+	Args     []Node
+	Location int
+}
+
+type NullTestType int
+
+const (
+	IS_NULL NullTestType = iota
+	IS_NOT_NULL
+)
+
+// NullTest is x IS [NOT] NULL, it is never NULL itself
+type NullTest struct {
+	Arg          Node
+	NullTestType NullTestType
+	Location     int
+}
+
+type BoolTestType int
+
+// Each test is followed by its negation, the parser relies on that
+const (
+	IS_TRUE BoolTestType = iota
+	IS_NOT_TRUE
+	IS_FALSE
+	IS_NOT_FALSE
+	IS_UNKNOWN
+	IS_NOT_UNKNOWN
+)
+
+// BooleanTest is x IS [NOT] TRUE / FALSE / UNKNOWN, NULL counts as unknown and the result is never NULL
+type BooleanTest struct {
+	Arg          Node
+	BoolTestType BoolTestType
+	Location     int
+}
+
+// CoalesceExpr is COALESCE(a, b, ...), the first argument that is not NULL. Analysis sets CoalesceType
+type CoalesceExpr struct {
+	CoalesceType Oid
+	Args         []Node
+	Location     int
+}
+
+type MinMaxOp int
+
+const (
+	IS_GREATEST MinMaxOp = iota
+	IS_LEAST
+)
+
+// MinMaxExpr is GREATEST(a, b, ...) or LEAST(a, b, ...), NULL arguments are ignored. Analysis sets MinMaxType
+type MinMaxExpr struct {
+	MinMaxType Oid
+	Op         MinMaxOp
+	Args       []Node
+	Location   int
+}
+
+/*
+CaseExpr is CASE [Arg] WHEN ... THEN ... [ELSE Defresult] END. In the simple form with an Arg, analysis
+makes each WHEN expression a comparison of a CaseTestExpr, the value of Arg, with it. Analysis sets CaseType
+*/
+type CaseExpr struct {
+	CaseType  Oid
+	Arg       Node
+	Args      []*CaseWhen
+	Defresult Node
+	Location  int
+}
+
+// CaseWhen is one WHEN Expr THEN Result of a CASE
+type CaseWhen struct {
+	Expr     Node
+	Result   Node
+	Location int
+}
+
+// FuncCall is a function or aggregate call such as count(DISTINCT x) FILTER (WHERE y > 0)
+// Over is set for a window function call, f(x) OVER (...)
+type FuncCall struct {
+	Funcname    string
+	Args        []Node
+	AggStar     bool //count(*)
+	AggDistinct bool
+	AggFilter   Node
+	Over        *WindowDef
+	Location    int
+}
+
+/*
+WindowDef is the window of an OVER clause or an entry of the WINDOW clause
+OVER name only sets Name, OVER (name ...) sets Refname and builds on the named window.
+For WINDOW clause entries Name is the name being defined
+*/
+type WindowDef struct {
+	Name            string
+	Refname         string
+	PartitionClause []Node
+	OrderClause     []*SortBy
+	FrameOptions    int //FRAMEOPTION_* bits
+	StartOffset     Node
+	EndOffset       Node
+	Location        int
+}
+
+// Frame options, the same bits as postgres
+const (
+	FRAMEOPTION_NONDEFAULT                = 0x00001 //Any frame clause was given
+	FRAMEOPTION_RANGE                     = 0x00002
+	FRAMEOPTION_ROWS                      = 0x00004
+	FRAMEOPTION_GROUPS                    = 0x00008
+	FRAMEOPTION_BETWEEN                   = 0x00010
+	FRAMEOPTION_START_UNBOUNDED_PRECEDING = 0x00020
+	FRAMEOPTION_END_UNBOUNDED_PRECEDING   = 0x00040 //Disallowed
+	FRAMEOPTION_START_UNBOUNDED_FOLLOWING = 0x00080 //Disallowed
+	FRAMEOPTION_END_UNBOUNDED_FOLLOWING   = 0x00100
+	FRAMEOPTION_START_CURRENT_ROW         = 0x00200
+	FRAMEOPTION_END_CURRENT_ROW           = 0x00400
+	FRAMEOPTION_START_OFFSET_PRECEDING    = 0x00800
+	FRAMEOPTION_END_OFFSET_PRECEDING      = 0x01000
+	FRAMEOPTION_START_OFFSET_FOLLOWING    = 0x02000
+	FRAMEOPTION_END_OFFSET_FOLLOWING      = 0x04000
+	FRAMEOPTION_EXCLUDE_CURRENT_ROW       = 0x08000
+	FRAMEOPTION_EXCLUDE_GROUP             = 0x10000
+	FRAMEOPTION_EXCLUDE_TIES              = 0x20000
+
+	FRAMEOPTION_START_OFFSET = FRAMEOPTION_START_OFFSET_PRECEDING | FRAMEOPTION_START_OFFSET_FOLLOWING
+	FRAMEOPTION_END_OFFSET   = FRAMEOPTION_END_OFFSET_PRECEDING | FRAMEOPTION_END_OFFSET_FOLLOWING
+	FRAMEOPTION_EXCLUSION    = FRAMEOPTION_EXCLUDE_CURRENT_ROW | FRAMEOPTION_EXCLUDE_GROUP | FRAMEOPTION_EXCLUDE_TIES
+
+	//RANGE UNBOUNDED PRECEDING AND CURRENT ROW, what a window without a frame clause gets
+	FRAMEOPTION_DEFAULTS = FRAMEOPTION_RANGE | FRAMEOPTION_START_UNBOUNDED_PRECEDING | FRAMEOPTION_END_CURRENT_ROW
+)
+
+// AStar is '*' in a target list, optionally qualified (t.*)
+type AStar struct {
+	Relname  string
+	Location int
+}
+
+// RangeVar is a table reference in the FROM clause
+type RangeVar struct {
+	Schemaname string //Empty when the name is not qualified
+	Relname    string
+	Alias      string
+	Location   int
+}
+
+// TypeName is a type as written in a query, Typmods are the modifiers in parentheses: numeric(10, 2)
+type TypeName struct {
+	Name     string
+	Typmods  []int64
+	Location int
+}
+
+// TypeCast converts Arg to a type: CAST(x AS type), x::type or a typed literal, DATE '2024-03-01'
+type TypeCast struct {
+	Arg      Node
+	TypeName *TypeName
+	Location int
+}
+
+// AArrayExpr is ARRAY[...], an element that is itself written [...] is an AArrayExpr too: ARRAY[[1, 2], [3, 4]]
+type AArrayExpr struct {
+	Elements []Node
+	Location int
+}
+
+// AIndices is one subscript, [Uidx] or the slice [Lidx:Uidx] where either bound may be left out
+type AIndices struct {
+	IsSlice  bool
+	Lidx     Node
+	Uidx     Node
+	Location int
+}
+
+// AIndirection is an expression followed by subscripts, a[1][2:3]
+type AIndirection struct {
+	Arg         Node
+	Indirection []*AIndices
+}
+
+// RangeFunction is a function call in the FROM clause, unnest(a) AS alias (col)
+type RangeFunction struct {
+	FuncCall *FuncCall
+	Alias    string
+	ColNames []string
+	Location int
+}
+
+/*
+JoinExpr is a join in the FROM clause, a JOIN b ON quals or a JOIN b USING (cols)
+NATURAL joins on the columns both sides have, CROSS JOIN is an inner join without quals
+*/
+type JoinExpr struct {
+	JoinType    JoinType
+	IsNatural   bool
+	Larg        Node
+	Rarg        Node
+	UsingClause []string
+	Quals       Node
+	Location    int
+}
+
+// RangeSubselect is a subquery in the FROM clause, (SELECT ...) AS alias (col, ...)
+type RangeSubselect struct {
+	Subquery *SelectStmt
+	Alias    string
+	ColNames []string //Column aliases, may name fewer columns than the subquery returns
+	Location int
+}
+
+type SortByDir int
+
+const (
+	SORTBY_DEFAULT SortByDir = iota
+	SORTBY_ASC
+	SORTBY_DESC
+)
+
+type SortByNulls int
+
+const (
+	SORTBY_NULLS_DEFAULT SortByNulls = iota
+	SORTBY_NULLS_FIRST
+	SORTBY_NULLS_LAST
+)
+
+// SortBy is one ORDER BY item
+type SortBy struct {
+	Node       Node
+	SortbyDir  SortByDir
+	SortbyNull SortByNulls
+	Location   int
+}
+
+type VariableSetKind int
+
+const (
+	VAR_SET_VALUE   VariableSetKind = iota //SET name = value
+	VAR_SET_DEFAULT                        //SET name TO DEFAULT
+	VAR_RESET                              //RESET name
+)
+
+// VariableSetStmt is SET name = value and RESET name
+type VariableSetStmt struct {
+	Kind  VariableSetKind
+	Name  string
+	Value string
+}
+
+// AlterSystemStmt is ALTER SYSTEM SET name = value and ALTER SYSTEM RESET name
+type AlterSystemStmt struct {
+	Setstmt *VariableSetStmt
+}
+
+// VariableShowStmt is SHOW name, Name is "all" for SHOW ALL
+type VariableShowStmt struct {
+	Name string
+}
+
+/*
+CreateStmt is CREATE TABLE [IF NOT EXISTS] name (column type [STORAGE storage] [NOT NULL | NULL], ...) [USING method]
+Relation only has the (possibly qualified) name
+*/
+type CreateStmt struct {
+	Relation     *RangeVar
+	TableElts    []*ColumnDef
+	AccessMethod string //Empty without USING, default_table_access_method is used
+	IfNotExists  bool
+}
+
+// ColumnDef is a column definition in CREATE TABLE
+type ColumnDef struct {
+	Colname     string
+	TypeName    *TypeName
+	StorageName string //Empty without STORAGE
+	IsNotNull   bool
+	Location    int
+}
+
+type ObjectType int
+
+const (
+	OBJECT_TABLE ObjectType = iota
+	OBJECT_INDEX
+)
+
+// DropStmt is DROP {TABLE | INDEX} [IF EXISTS] name, ...
+type DropStmt struct {
+	RemoveType ObjectType
+	Objects    []*RangeVar
+	MissingOk  bool
+}
+
+/*
+IndexStmt is CREATE [UNIQUE] INDEX [CONCURRENTLY] [IF NOT EXISTS] [name] ON table [USING method] (key, ...)
+[INCLUDE (column, ...)] [WHERE predicate]
+Idxname is empty when the name is left to us and AccessMethod is DEFAULT_INDEX_TYPE without USING. The definition
+pg_index keeps is put together from the text the expressions were written as, WhereText for the predicate.
+IndexIncludingParams are parsed as keys, only columns without options are allowed
+*/
+type IndexStmt struct {
+	Idxname              string
+	Relation             *RangeVar
+	AccessMethod         string
+	IndexParams          []*IndexElem
+	IndexIncludingParams []*IndexElem
+	WhereClause          Node
+	WhereText            string
+	Unique               bool
+	Concurrent           bool
+	IfNotExists          bool
+}
+
+const DEFAULT_INDEX_TYPE = "btree"
+
+// IndexElem is a key of an index, either a column Name or an expression Expr written as ExprText
+type IndexElem struct {
+	Name          string
+	Expr          Node
+	ExprText      string
+	Ordering      SortByDir
+	NullsOrdering SortByNulls
+	Location      int
+}
+
+// VacuumStmt is VACUUM [FULL] [VERBOSE] [name, ...], without names every table is vacuumed
+type VacuumStmt struct {
+	Full    bool
+	Verbose bool
+	Rels    []*RangeVar
+}
+
+/*
+InsertStmt is INSERT INTO table [AS alias] [(column, ...)] {VALUES (expr, ...), ... | DEFAULT VALUES | select}
+[RETURNING target, ...]. Cols are the columns as ResTargets with only Name, all of them without a list.
+Exactly one of ValuesLists and SelectStmt is set unless it is DEFAULT VALUES, a value can be a SetToDefault
+*/
+type InsertStmt struct {
+	Relation      *RangeVar
+	Cols          []*ResTarget
+	ValuesLists   [][]Node
+	SelectStmt    *SelectStmt
+	ReturningList []*ResTarget
+}
+
+// UpdateStmt is UPDATE table [[AS] alias] SET column = expr, ... [WHERE expr] [RETURNING target, ...], Name of a target is the column
+type UpdateStmt struct {
+	Relation      *RangeVar
+	TargetList    []*ResTarget
+	WhereClause   Node
+	ReturningList []*ResTarget
+}
+
+// DeleteStmt is DELETE FROM table [[AS] alias] [WHERE expr] [RETURNING target, ...]
+type DeleteStmt struct {
+	Relation      *RangeVar
+	WhereClause   Node
+	ReturningList []*ResTarget
+}
+
+// SetToDefault is DEFAULT in VALUES or in SET column = DEFAULT, the column's default, which is NULL as there are no others
+type SetToDefault struct {
+	Location int
+}
+
+type AlterTableType int
+
+const (
+	AT_SetStorage AlterTableType = iota //ALTER [COLUMN] name SET STORAGE storage
+)
+
+// AlterTableStmt is ALTER TABLE [IF EXISTS] name cmd, ...
+type AlterTableStmt struct {
+	Relation  *RangeVar
+	Cmds      []*AlterTableCmd
+	MissingOk bool
+}
+
+// AlterTableCmd is one change of an ALTER TABLE, Name is the column it changes
+type AlterTableCmd struct {
+	Subtype     AlterTableType
+	Name        string
+	StorageName string
+	Location    int
+}
+
+func (*SelectStmt) NodeTag() NodeTag { return TSelectStmt }
+func (*ResTarget) NodeTag() NodeTag  { return TResTarget }
+func (*ColumnRef) NodeTag() NodeTag  { return TColumnRef }
+func (*AConst) NodeTag() NodeTag     { return TAConst }
+func (*AExpr) NodeTag() NodeTag      { return TAExpr }
+func (*BoolExpr) NodeTag() NodeTag   { return TBoolExpr }
+func (*FuncCall) NodeTag() NodeTag   { return TFuncCall }
+func (*AStar) NodeTag() NodeTag      { return TAStar }
+func (*RangeVar) NodeTag() NodeTag   { return TRangeVar }
+func (*SortBy) NodeTag() NodeTag     { return TSortBy }
+
+func (*RangeSubselect) NodeTag() NodeTag  { return TRangeSubselect }
+func (*WithClause) NodeTag() NodeTag      { return TWithClause }
+func (*CommonTableExpr) NodeTag() NodeTag { return TCommonTableExpr }
+func (*WindowDef) NodeTag() NodeTag       { return TWindowDef }
+func (*TypeName) NodeTag() NodeTag        { return TTypeName }
+func (*TypeCast) NodeTag() NodeTag        { return TTypeCast }
+func (*AArrayExpr) NodeTag() NodeTag      { return TAArrayExpr }
+func (*AIndices) NodeTag() NodeTag        { return TAIndices }
+func (*AIndirection) NodeTag() NodeTag    { return TAIndirection }
+func (*RangeFunction) NodeTag() NodeTag   { return TRangeFunction }
+func (*JoinExpr) NodeTag() NodeTag        { return TJoinExpr }
+
+func (*VariableSetStmt) NodeTag() NodeTag  { return TVariableSetStmt }
+func (*VariableShowStmt) NodeTag() NodeTag { return TVariableShowStmt }
+
+func (*CreateStmt) NodeTag() NodeTag { return TCreateStmt }
+func (*ColumnDef) NodeTag() NodeTag  { return TColumnDef }
+func (*DropStmt) NodeTag() NodeTag   { return TDropStmt }
+
+func (*IndexStmt) NodeTag() NodeTag { return TIndexStmt }
+func (*IndexElem) NodeTag() NodeTag { return TIndexElem }
+
+func (*VacuumStmt) NodeTag() NodeTag { return TVacuumStmt }
+
+func (*AlterTableStmt) NodeTag() NodeTag { return TAlterTableStmt }
+func (*AlterTableCmd) NodeTag() NodeTag  { return TAlterTableCmd }
+
+func (*AlterSystemStmt) NodeTag() NodeTag { return TAlterSystemStmt }
+
+func (*InsertStmt) NodeTag() NodeTag   { return TInsertStmt }
+func (*UpdateStmt) NodeTag() NodeTag   { return TUpdateStmt }
+func (*DeleteStmt) NodeTag() NodeTag   { return TDeleteStmt }
+func (*SetToDefault) NodeTag() NodeTag { return TSetToDefault }
+
+func (*NullTest) NodeTag() NodeTag    { return TNullTest }
+func (*BooleanTest) NodeTag() NodeTag { return TBooleanTest }
+
+func (*CoalesceExpr) NodeTag() NodeTag { return TCoalesceExpr }
+func (*MinMaxExpr) NodeTag() NodeTag   { return TMinMaxExpr }
+
+func (*CaseExpr) NodeTag() NodeTag { return TCaseExpr }
+func (*CaseWhen) NodeTag() NodeTag { return TCaseWhen }
@@ -0,0 +1,59 @@
+package types
+
+/*
+Type oids, these are the same numbers postgres uses so clients (psql, drivers) understand our RowDescription
+What we know about each type (name, input/output functions, casts) is in the registry in package adt
+*/
+const (
+	InvalidOid Oid = 0
+
+	BOOLOID      Oid = 16
+	BYTEAOID     Oid = 17
+	INT8OID      Oid = 20
+	INT2OID      Oid = 21
+	INT4OID      Oid = 23
+	TEXTOID      Oid = 25
+	FLOAT8OID    Oid = 701
+	UNKNOWNOID   Oid = 705
+	DATEOID      Oid = 1082
+	TIMEOID      Oid = 1083
+	TIMESTAMPOID Oid = 1114
+	NUMERICOID   Oid = 1700
+
+	TIMESTAMPTZOID Oid = 1184
+	INTERVALOID    Oid = 1186
+
+	JSONOID     Oid = 114
+	JSONBOID    Oid = 3802
+	JSONPATHOID Oid = 4072
+
+	UUIDOID Oid = 2950
+
+	REGCLASSOID Oid = 2205
+
+	BOOLARRAYOID      Oid = 1000
+	BYTEAARRAYOID     Oid = 1001
+	INT2ARRAYOID      Oid = 1005
+	INT4ARRAYOID      Oid = 1007
+	TEXTARRAYOID      Oid = 1009
+	INT8ARRAYOID      Oid = 1016
+	FLOAT8ARRAYOID    Oid = 1022
+	TIMESTAMPARRAYOID Oid = 1115
+	DATEARRAYOID      Oid = 1182
+	NUMERICARRAYOID   Oid = 1231
+
+	TIMEARRAYOID        Oid = 1183
+	TIMESTAMPTZARRAYOID Oid = 1185
+	INTERVALARRAYOID    Oid = 1187
+
+	JSONARRAYOID     Oid = 199
+	JSONBARRAYOID    Oid = 3807
+	JSONPATHARRAYOID Oid = 4073
+
+	UUIDARRAYOID Oid = 2951
+
+	ANYARRAYOID Oid = 2277 //Pseudo type of array datums whose element type we do not know, and of polymorphic array arguments
+	ANYOID      Oid = 2276 //Pseudo type of function arguments that take a value of any type
+
+	ANYELEMENTOID Oid = 2283 //Polymorphic argument, all of them in one call have the same type, the element type of the anyarray ones
+)
@@ -0,0 +1,353 @@
+package types
+
+/*
+Plan nodes, the planner builds a tree of these and the executor runs it
+Every plan node embeds Plan, TargetList and Qual are evaluated against the tuples the node produces
+A nil TargetList means the node returns its tuples untouched
+*/
+
+type Plan struct {
+	TargetList []*TargetEntry
+	Qual       Node
+	Lefttree   PlanNode
+	Righttree  PlanNode
+}
+
+type PlanNode interface {
+	Node
+	GetPlan() *Plan
+}
+
+// Result emits a single empty tuple (SELECT without FROM), with a Lefttree it projects the child's tuples
+type Result struct {
+	Plan
+}
+
+// SeqScan reads every row of a relation
+type SeqScan struct {
+	Plan
+	Relid    Oid
+	Relname  string
+	FilePath string
+	ColTypes []Oid
+}
+
+// How a scan key compares the index column with its argument (postgres access/stratnum.h)
+type StrategyNumber int
+
+// Btree strategies
+const (
+	BTLessStrategyNumber StrategyNumber = iota + 1
+	BTLessEqualStrategyNumber
+	BTEqualStrategyNumber
+	BTGreaterEqualStrategyNumber
+	BTGreaterStrategyNumber
+)
+
+// The strategy of a gin index of jsonb, the column contains the argument (@>). A hash index searches with BTEqualStrategyNumber
+const JsonbContainsStrategyNumber StrategyNumber = 7
+
+// ScanKey compares index column AttNo (0 based) with Arg, a Const or a Param evaluated when the scan starts
+type ScanKey struct {
+	AttNo    int
+	Strategy StrategyNumber
+	Arg      Node
+}
+
+/*
+IndexScan reads the rows of a relation its index finds for ScanKeys, fetching each from the relation file by
+where the index says it is. IndexKeys are the key expressions of the index, over the relation's columns,
+with the order of the index, and IndexInclude the Vars of its INCLUDE columns. Qual is all of WHERE, the scan
+keys only narrow down which rows are looked at
+*/
+type IndexScan struct {
+	Plan
+	Relid        Oid
+	Relname      string
+	FilePath     string
+	ColTypes     []Oid
+	IndexName    string
+	IndexPath    string
+	AccessMethod string
+	IndexKeys    []SortKey
+	IndexInclude []Node
+	ScanKeys     []ScanKey
+}
+
+/*
+IndexOnlyScan is an IndexScan that never reads the relation file, the query uses no column the index does
+not have. The tuples it makes have the relation's columns with the values of the index entries and NULL for
+the others, IndexAttNos is the column of each value of an entry, keys then INCLUDE columns, -1 for an
+expression key
+*/
+type IndexOnlyScan struct {
+	IndexScan
+	IndexAttNos []int
+}
+
+/*
+ColumnarScan reads a columnar table from its columnar file instead of its relation file. Only the columns in
+AttNos are read, the others are NULL in the tuples it makes, the planner made sure nothing reads them.
+ZoneKeys are the conditions of WHERE comparing a column (AttNo) with a value, the chunk groups whose zone
+maps show no row can meet one of them are skipped. Qual is all of WHERE
+*/
+type ColumnarScan struct {
+	Plan
+	Relid    Oid
+	Relname  string
+	FilePath string
+	ColTypes []Oid
+	AttNos   []int
+	ZoneKeys []ScanKey
+}
+
+type AggStrategy int
+
+const (
+	AGG_PLAIN  AggStrategy = iota //No GROUP BY, a single group
+	AGG_SORTED                    //Input is sorted by the group keys
+	AGG_HASHED                    //Groups are collected in a hash table
+)
+
+// Agg computes aggregates per group, TargetList and Qual (HAVING) see the first tuple of the group
+// and the finished aggregate values
+type Agg struct {
+	Plan
+	Strategy   AggStrategy
+	GroupExprs []Node
+	Aggs       []*Aggref
+}
+
+type SortKey struct {
+	Expr       Node
+	Desc       bool
+	NullsFirst bool
+}
+
+// Sort orders its input by SortKeys, evaluated against the input tuple
+type Sort struct {
+	Plan
+	SortKeys []SortKey
+}
+
+// Limit skips Offset rows and returns at most Count rows, either may be nil
+type Limit struct {
+	Plan
+	LimitOffset Node
+	LimitCount  Node
+}
+
+// Append returns the tuples of every child plan, one after the other
+type Append struct {
+	Plan
+	Appendplans []PlanNode
+}
+
+type SetOpStrategy int
+
+const (
+	SETOP_HASHED SetOpStrategy = iota //Count the tuples of both sides in a hash table
+	SETOP_SORTED                      //Both sides are sorted on all columns and merged
+)
+
+// SetOp does INTERSECT and EXCEPT of Lefttree and Righttree, comparing whole tuples
+type SetOp struct {
+	Plan
+	Cmd      SetOperation
+	All      bool
+	Strategy SetOpStrategy
+}
+
+type JoinType int
+
+const (
+	JOIN_INNER JoinType = iota //Pairs of matching tuples
+	JOIN_LEFT                  //And outer tuples without a match
+	JOIN_FULL                  //And the tuples of either side without a match
+	JOIN_RIGHT                 //And inner tuples without a match
+	JOIN_SEMI                  //Outer tuples with at least one match
+	JOIN_ANTI                  //Outer tuples without any match
+)
+
+/*
+NestLoop joins every Lefttree (outer) tuple with every Righttree (inner) tuple, the pairs that meet JoinQual
+match. A joined tuple is the outer tuple followed by the inner one, in outer joins the side without a match
+is all NULLs, OuterWidth and InnerWidth columns of them. Qual is checked on the joined tuples, like WHERE
+*/
+type NestLoop struct {
+	Plan
+	JoinType   JoinType
+	JoinQual   Node
+	OuterWidth int
+	InnerWidth int
+}
+
+/*
+HashJoin builds a hash table on the Righttree (inner) keys and probes it with the Lefttree (outer)
+keys, the keys are compared with = so NULLs never match. Semi and anti joins only return outer tuples.
+NullAware makes an anti join behave like NOT IN: a NULL key on either side means we cannot tell
+the tuples apart, so the outer tuple is not returned unless the inner side is empty
+*/
+type HashJoin struct {
+	Plan
+	JoinType      JoinType
+	OuterHashKeys []Node
+	InnerHashKeys []Node
+	NullAware     bool
+}
+
+/*
+CteScan reads the result of a WITH query that is materialized instead of being inlined
+All CteScans of the same WITH query share CtePlan, it runs once and its rows are kept for every scan.
+ExtParams are Params of outer queries the CTE reads, it runs again when they change
+*/
+type CteScan struct {
+	Plan
+	CteName   string
+	CtePlan   PlanNode
+	ExtParams []int
+}
+
+// WorkTableScan reads the rows the previous iteration of a recursive query produced
+type WorkTableScan struct {
+	Plan
+	WtParam int //Links the scan to its RecursiveUnion
+}
+
+/*
+RecursiveUnion runs WITH RECURSIVE, Lefttree is the non-recursive term and Righttree the recursive one
+Righttree runs over and over with the rows of the previous round as its work table until it returns nothing
+Without All, rows that were already returned are dropped, which also stops cycles. With All only a CYCLE
+clause stops them, the planner adds it to the terms as columns and a condition of the recursive term
+*/
+type RecursiveUnion struct {
+	Plan
+	WtParam int
+	All     bool
+}
+
+/*
+WindowAgg computes the window functions of one window, its input arrives sorted by PartitionKeys
+and then OrderKeys. Every input tuple comes out once, with the results of WindowFuncs appended,
+a nil TargetList returns that extended tuple. The Args of WindowFuncs are evaluated against the input tuple.
+StartOffset and EndOffset are the frame offsets, evaluated once per partition
+*/
+type WindowAgg struct {
+	Plan
+	WinRef        int
+	PartitionKeys []Node
+	OrderKeys     []SortKey
+	FrameOptions  int
+	StartOffset   Node
+	EndOffset     Node
+	WindowFuncs   []*WindowFunc
+}
+
+/*
+FunctionScan returns the rows of a function called in FROM, a set returning function gives a row per value
+and any other function a single row. FuncExpr is evaluated once, it cannot see columns of the query
+*/
+type FunctionScan struct {
+	Plan
+	FuncExpr Node
+}
+
+/*
+ProjectSet evaluates a target list with set returning functions in it (SELECT unnest(a) ...)
+An input tuple gives as many rows as the longest set any of them returns, the shorter ones are padded
+with NULLs and the other columns repeat
+*/
+type ProjectSet struct {
+	Plan
+}
+
+// CmdType is what a statement does (postgres nodes/nodes.h)
+type CmdType int
+
+const (
+	CMD_SELECT CmdType = iota
+	CMD_INSERT
+	CMD_UPDATE
+	CMD_DELETE
+)
+
+/*
+ModifyTable runs an INSERT, UPDATE or DELETE on a table (postgres executor/nodeModifyTable.c). Lefttree gives
+the rows to insert for INSERT, the columns of the table in order. For UPDATE and DELETE it is a SeqScan or
+IndexScan of the table that tells where each row it returns is, for UPDATE its TargetList makes the new
+version of the row. NotNull are the columns that cannot be NULL. Indexes are the indexes of the table, their
+entries change with the rows. ReturningList is evaluated on the rows stored, the old ones for DELETE, nothing
+is returned without RETURNING
+*/
+type ModifyTable struct {
+	Plan
+	Operation     CmdType
+	Relid         Oid
+	Relname       string
+	FilePath      string
+	ColNames      []string
+	ColTypes      []Oid
+	NotNull       []bool
+	Indexes       []*ModifyTableIndex
+	ReturningList []*TargetEntry
+}
+
+// ModifyTableIndex is an index of the table a ModifyTable changes, Info is its analyzed definition
+type ModifyTableIndex struct {
+	Indexrelid Oid
+	Path       string
+	Info       *IndexInfo
+}
+
+func (p *Plan) GetPlan() *Plan { return p }
+
+func (*Result) NodeTag() NodeTag  { return TResult }
+func (*SeqScan) NodeTag() NodeTag { return TSeqScan }
+func (*Agg) NodeTag() NodeTag     { return TAgg }
+func (*Sort) NodeTag() NodeTag    { return TSort }
+func (*Limit) NodeTag() NodeTag   { return TLimit }
+func (*Append) NodeTag() NodeTag  { return TAppend }
+func (*SetOp) NodeTag() NodeTag   { return TSetOp }
+
+func (*HashJoin) NodeTag() NodeTag       { return THashJoin }
+func (*CteScan) NodeTag() NodeTag        { return TCteScan }
+func (*WorkTableScan) NodeTag() NodeTag  { return TWorkTableScan }
+func (*RecursiveUnion) NodeTag() NodeTag { return TRecursiveUnion }
+func (*WindowAgg) NodeTag() NodeTag      { return TWindowAgg }
+func (*FunctionScan) NodeTag() NodeTag   { return TFunctionScan }
+func (*ProjectSet) NodeTag() NodeTag     { return TProjectSet }
+
+func (*IndexScan) NodeTag() NodeTag     { return TIndexScan }
+func (*IndexOnlyScan) NodeTag() NodeTag { return TIndexOnlyScan }
+
+func (*ColumnarScan) NodeTag() NodeTag { return TColumnarScan }
+func (*NestLoop) NodeTag() NodeTag     { return TNestLoop }
+func (*ModifyTable) NodeTag() NodeTag  { return TModifyTable }
+
+// PlannedStmt is what the planner hands to the executor
+// TargetList describes the columns of the result (ResJunk ones are filtered out before sending), for
+// INSERT, UPDATE and DELETE it is RETURNING and empty without it
+// NParamExec is the number of Params the plan uses
+type PlannedStmt struct {
+	CommandType CmdType
+	PlanTree    PlanNode
+	TargetList  []*TargetEntry
+	NParamExec  int
+}
+
+/*
+IndexInfo is an analyzed index definition (postgres nodes/execnodes.h): the keys are expressions over the
+columns of the table, a column key is a Var. KeyNames are the columns or the expressions as written, for
+messages. Include are the Vars of the INCLUDE columns, which the entries keep but are not searched or
+ordered on. Predicate is the WHERE of a partial index, nil for one on every row
+*/
+type IndexInfo struct {
+	Name         string
+	AccessMethod string
+	Unique       bool
+	Keys         []SortKey
+	KeyNames     []string
+	Include      []Node
+	Indkey       []int //Column number of each key then each INCLUDE column counting from 1, 0 for an expression
+	Predicate    Node
+}
@@ -0,0 +1,219 @@
+package types
+
+/*
+Primitive expression nodes, these are what parse analysis turns the raw parse tree into
+Names are resolved to column positions and every expression knows its result type
+BoolExpr, NullTest, BooleanTest, CoalesceExpr, MinMaxExpr and CaseExpr are shared with the raw parse tree (Same as postgres)
+*/
+
+// Const is a constant value of a known type
+type Const struct {
+	ConstType Oid
+	Val       Datum
+}
+
+// Var references a column of the tuple the expression is evaluated against
+// AttNo is 0 based position in that tuple
+// LevelsUp is 0 for a column of the query's own FROM item, 1 for the query a subquery is in and so on
+// (the planner replaces Vars with LevelsUp > 0 by Params, the executor never sees them)
+type Var struct {
+	AttNo    int
+	Name     string
+	VarType  Oid
+	LevelsUp int
+}
+
+// OpExpr is a builtin operator, for unary operators Args has a single element
+// Opno is the operator's entry in the operator table of package adt, InvalidOid for the arithmetic
+// and comparison operators the executor implements itself
+type OpExpr struct {
+	Op         string
+	Opno       Oid
+	Args       []Node
+	ResultType Oid
+}
+
+// FuncExpr is a call of a builtin function, Funcid is its entry in the function table of package adt
+type FuncExpr struct {
+	Funcid         Oid
+	Funcname       string
+	Args           []Node
+	FuncResultType Oid
+}
+
+/*
+ArrayExpr builds an array from Elements, all of type ElementType. With Multidims the elements are arrays
+themselves, the sub-arrays of an ARRAY[[1, 2], [3, 4]], and must all have the same dimensions
+*/
+type ArrayExpr struct {
+	ArrayType   Oid
+	ElementType Oid
+	Elements    []Node
+	Multidims   bool
+}
+
+/*
+SubscriptingRef fetches an element or a slice of the array Expr, one entry of Upperindex per subscript.
+Lowerindex is only set for a slice, with a nil entry for a bound that was left out (so are Upperindex entries)
+Subscripts out of range give NULL for an element and are clamped for a slice
+*/
+type SubscriptingRef struct {
+	Expr       Node
+	Upperindex []Node
+	Lowerindex []Node
+	RefType    Oid //The type of the result, the element type or for a slice the array type
+}
+
+/*
+ScalarArrayOpExpr is scalar op ANY (array) or scalar op ALL (array), UseOr for ANY
+Args are the scalar and the array, Op is one of the comparison operators of the executor
+*/
+type ScalarArrayOpExpr struct {
+	Op    string
+	UseOr bool
+	Args  []Node
+}
+
+/*
+DistinctExpr is a IS DISTINCT FROM b, an "=" operator (Op and Opno as in OpExpr) that treats NULL as
+a value: two NULLs are not distinct, a NULL and a value are. IS NOT DISTINCT FROM is NOT of it
+*/
+type DistinctExpr struct {
+	Op   string
+	Opno Oid
+	Args []Node
+}
+
+/*
+NullIfExpr is NULLIF(a, b), NULL when a = b and a otherwise. Op and Opno are the "=" as in OpExpr,
+the result has the type of a
+*/
+type NullIfExpr struct {
+	Op         string
+	Opno       Oid
+	Args       []Node
+	ResultType Oid
+}
+
+/*
+RowExpr is ROW(Args) in the text form record_out gives a row, there is no record type. The planner only makes
+them for the path column of a CYCLE clause, two rows are the same when their texts are
+*/
+type RowExpr struct {
+	Args []Node
+}
+
+// CaseTestExpr stands for the value a simple CASE compares with its WHEN expressions, the executor evaluates it once
+type CaseTestExpr struct {
+	TypeId Oid
+}
+
+// Aggref is an aggregate call, AggNo is its position in the Agg node's aggregate list
+type Aggref struct {
+	AggName     string
+	Args        []Node
+	AggStar     bool
+	AggDistinct bool
+	AggFilter   Node
+	AggNo       int
+	AggType     Oid
+}
+
+/*
+WindowFunc is a window function call, or an aggregate called with OVER
+WinRef is the position of its window in the query's window list. The WindowAgg node computing it
+appends the result to its input tuple, above that node the call is replaced by a Var of that column
+*/
+type WindowFunc struct {
+	WinName   string
+	Args      []Node
+	AggFilter Node
+	WinRef    int
+	WinStar   bool //count(*) OVER ...
+	WinAgg    bool //An aggregate, computed over the window frame
+	WinType   Oid
+}
+
+// CoerceExpr converts Arg to ResultType, for implicit conversions the analyzer inserts
+// ResultTypmod is the type modifier the result is made to fit, -1 for none
+type CoerceExpr struct {
+	Arg          Node
+	ResultType   Oid
+	ResultTypmod int32
+}
+
+// Param is a value set at run time by a SubPlan before it runs its plan, it carries the value of an
+// outer query's column into a correlated subquery (PARAM_EXEC in postgres)
+type Param struct {
+	ParamId   int
+	ParamType Oid
+}
+
+type SubLinkType int
+
+const (
+	EXISTS_SUBLINK SubLinkType = iota //EXISTS (SELECT ...)
+	ALL_SUBLINK                       //testexpr op ALL (SELECT ...)
+	ANY_SUBLINK                       //testexpr op ANY (SELECT ...), also testexpr IN (SELECT ...)
+	EXPR_SUBLINK                      //(SELECT ...) as a scalar value
+)
+
+/*
+SubLink is a subquery used in an expression
+The grammar produces it with Subselect set to the raw SelectStmt, parse analysis replaces that by the
+analyzed query and fills in ResultType. The planner turns every SubLink into a join or a SubPlan
+*/
+type SubLink struct {
+	SubLinkType SubLinkType
+	Testexpr    Node   //Left hand side of ANY / ALL, nil otherwise
+	OperName    string //Operator of ANY / ALL
+	Subselect   Node
+	ResultType  Oid //Type of the single column of an EXPR_SUBLINK
+	Location    int
+}
+
+/*
+SubPlan is a planned SubLink, the executor runs Plan whenever it needs the value
+Args are evaluated in the outer query and put into the Params ParParams before Plan runs, so a
+correlated subquery sees the current outer row. ExtParams are the Params of queries further out that
+Plan reads, a SubPlan without ParParams only has to run again when one of those changes
+*/
+type SubPlan struct {
+	SubLinkType SubLinkType
+	Testexpr    Node
+	OperName    string
+	Plan        PlanNode
+	ParParams   []int
+	Args        []Node
+	ExtParams   []int
+	ResultType  Oid
+}
+
+// TargetEntry is one column of a plan node's output
+// ResJunk columns are only needed by upper nodes (e.g sort keys) and are not sent to the client
+type TargetEntry struct {
+	Expr    Node
+	ResName string
+	ResJunk bool
+}
+
+func (*Const) NodeTag() NodeTag       { return TConst }
+func (*Var) NodeTag() NodeTag         { return TVar }
+func (*OpExpr) NodeTag() NodeTag      { return TOpExpr }
+func (*FuncExpr) NodeTag() NodeTag    { return TFuncExpr }
+func (*Aggref) NodeTag() NodeTag      { return TAggref }
+func (*WindowFunc) NodeTag() NodeTag  { return TWindowFunc }
+func (*CoerceExpr) NodeTag() NodeTag  { return TCoerceExpr }
+func (*TargetEntry) NodeTag() NodeTag { return TTargetEntry }
+func (*Param) NodeTag() NodeTag       { return TParam }
+func (*SubLink) NodeTag() NodeTag     { return TSubLink }
+func (*SubPlan) NodeTag() NodeTag     { return TSubPlan }
+
+func (*ArrayExpr) NodeTag() NodeTag         { return TArrayExpr }
+func (*SubscriptingRef) NodeTag() NodeTag   { return TSubscriptingRef }
+func (*ScalarArrayOpExpr) NodeTag() NodeTag { return TScalarArrayOpExpr }
+func (*DistinctExpr) NodeTag() NodeTag      { return TDistinctExpr }
+func (*NullIfExpr) NodeTag() NodeTag        { return TNullIfExpr }
+func (*CaseTestExpr) NodeTag() NodeTag      { return TCaseTestExpr }
+
+func (*RowExpr) NodeTag() NodeTag { return TRowExpr }
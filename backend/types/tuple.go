@@ -0,0 +1,4 @@
+package types
+
+// Tuple is a row flowing between executor nodes, one Datum per column
+type Tuple []Datum
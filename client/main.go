@@ -1,10 +1,13 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"io"
 	"net"
+	"strings"
 )
 
 func main() {
@@ -26,4 +29,57 @@ func main() {
 		buf.Write(payload)
 	}
 	conn.Write(buf.Bytes())
+
+	reader := bufio.NewReader(conn)
+	for range queries {
+		readResult(reader)
+	}
+}
+
+// readResult prints the server's response messages until it is ready for the next query
+func readResult(reader *bufio.Reader) {
+	for {
+		msgType, err := reader.ReadByte()
+		if err != nil {
+			return
+		}
+		var length uint32
+		binary.Read(reader, binary.BigEndian, &length)
+		data := make([]byte, length-4)
+		io.ReadFull(reader, data)
+
+		switch msgType {
+		case 'T':
+			count := int(binary.BigEndian.Uint16(data))
+			data = data[2:]
+			var names []string
+			for i := 0; i < count; i++ {
+				end := bytes.IndexByte(data, 0)
+				names = append(names, string(data[:end]))
+				data = data[end+1+18:] //Name terminator and the fixed size column fields
+			}
+			fmt.Println(strings.Join(names, " | "))
+		case 'D':
+			count := int(binary.BigEndian.Uint16(data))
+			data = data[2:]
+			var values []string
+			for i := 0; i < count; i++ {
+				size := int32(binary.BigEndian.Uint32(data))
+				data = data[4:]
+				if size < 0 {
+					values = append(values, "NULL")
+					continue
+				}
+				values = append(values, string(data[:size]))
+				data = data[size:]
+			}
+			fmt.Println(strings.Join(values, " | "))
+		case 'C':
+			fmt.Println(string(bytes.TrimRight(data, "\x00")))
+		case 'E':
+			fmt.Println("ERROR:", string(bytes.ReplaceAll(data, []byte{0}, []byte{' '})))
+		case 'Z':
+			return
+		}
+	}
 }